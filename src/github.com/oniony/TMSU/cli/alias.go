@@ -0,0 +1,172 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"strings"
+)
+
+var AliasCommand = Command{
+	Name:     "alias",
+	Synopsis: "Creates a tag alias",
+	Usages: []string{"tmsu alias [OPTION]... TAG ALIAS...",
+		"tmsu alias [TAG]",
+		"tmsu alias --delete ALIAS..."},
+	Description: `Creates one or more ALIASes for TAG such that the alias can be used in place of the tag name when tagging, untagging and querying files.
+
+When run with a TAG but no ALIAS lists the aliases of that tag. When run without arguments lists all of the aliases.
+
+An alias cannot have the same name as an existing tag or alias. Deleting a tag also deletes its aliases.`,
+	Examples: []string{`$ tmsu alias movie film`,
+		`$ tmsu files film`,
+		`$ tmsu alias
+film -> movie`,
+		`$ tmsu alias --delete film`},
+	Options: Options{Option{"--delete", "-d", "deletes the aliases", false, ""}},
+	Exec:    aliasExec,
+}
+
+// unexported
+
+func aliasExec(options Options, args []string, databasePath string) (error, warnings) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--delete") {
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+
+		return deleteAliases(store, tx, args)
+	}
+
+	switch len(args) {
+	case 0:
+		return listAliases(store, tx), nil
+	case 1:
+		return listAliasesForTag(store, tx, args[0])
+	default:
+		return addAliases(store, tx, args[0], args[1:])
+	}
+}
+
+func listAliases(store *storage.Storage, tx *storage.Tx) error {
+	log.Infof(2, "retrieving tag aliases.")
+
+	aliases, err := store.Aliases(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve aliases: %w", err)
+	}
+
+	width := 0
+	for _, alias := range aliases {
+		if len(alias.Name) > width {
+			width = len(alias.Name)
+		}
+	}
+
+	for _, alias := range aliases {
+		padding := strings.Repeat(" ", width-len(alias.Name))
+		fmt.Printf("%s%s -> %s\n", padding, escape(alias.Name, '=', ' '), escape(alias.Tag.Name, '=', ' '))
+	}
+
+	return nil
+}
+
+func listAliasesForTag(store *storage.Storage, tx *storage.Tx, tagArg string) (error, warnings) {
+	tagName := parseTagOrValueName(tagArg)
+
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return err, nil
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}, nil
+	}
+
+	log.Infof(2, "retrieving aliases for tag '%v'.", tagName)
+
+	aliases, err := store.AliasesByTagId(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve aliases for tag '%v': %w", tagName, err), nil
+	}
+
+	for _, alias := range aliases {
+		fmt.Println(escape(alias.Name, '=', ' '))
+	}
+
+	return nil, nil
+}
+
+func addAliases(store *storage.Storage, tx *storage.Tx, tagArg string, aliasArgs []string) (error, warnings) {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	tagName := parseTagOrValueName(tagArg)
+
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return err, nil
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, aliasArg := range aliasArgs {
+		aliasName := parseTagOrValueName(aliasArg)
+
+		log.Infof(2, "adding alias '%v' for tag '%v'", aliasName, tagName)
+
+		if _, err := store.AddAlias(tx, aliasName, *tag); err != nil {
+			warnings = append(warnings, fmt.Errorf("could not add alias '%v': %w", aliasName, err))
+		}
+	}
+
+	return nil, warnings
+}
+
+func deleteAliases(store *storage.Storage, tx *storage.Tx, aliasArgs []string) (error, warnings) {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, aliasArg := range aliasArgs {
+		aliasName := parseTagOrValueName(aliasArg)
+
+		log.Infof(2, "deleting alias '%v'", aliasName)
+
+		if err := store.DeleteAlias(tx, aliasName); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return nil, warnings
+}
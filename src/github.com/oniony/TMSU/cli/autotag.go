@@ -0,0 +1,249 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/rule"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+)
+
+var AutotagCommand = Command{
+	Name:     "autotag",
+	Synopsis: "Apply tags to files according to the rules",
+	Usages:   []string{"tmsu autotag [OPTION]... FILE..."},
+	Description: `Applies to each FILE the tags of the rules that it satisfies. Files that satisfy no rules are left untouched.
+
+See the 'rule' subcommand for how to define rules.
+
+With --from-path, tags are also extracted from the directory structure and file names of the files that match TEMPLATE, so that a collection organised into folders can be converted to tags. Within each directory or file name of TEMPLATE:
+
+  {NAME}  captures the value of the tag NAME
+  {}      captures the name of a tag
+  *       matches any text
+  ?       matches any one character
+
+A directory name of '**' matches any number of directories. A TEMPLATE beginning with a slash is matched against the whole of the absolute path, otherwise against its final directory and file names. The option may be repeated to apply several templates.
+
+Extracted names that are not valid tag or value names are skipped with a warning.`,
+	Examples: []string{"$ tmsu rule add 'glob:*.flac' music lossless",
+		"$ tmsu autotag --recursive ~/music",
+		"$ tmsu autotag --recursive --from-path 'Photos/{year}/{event}/*' ~/Photos",
+		"$ tmsu autotag -r --from-path 'music/{}/{artist} - {album}/*.flac' ~/music"},
+	Options: Options{{"--recursive", "-r", "recursively apply rules to directory contents", false, ""},
+		{"--include-hidden", "-H", "don't skip hidden files/directories when applying rules recursively", false, ""},
+		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, ""},
+		{"--from-path", "", "extract tags from paths matching TEMPLATE", true, ""}},
+	Exec: autotagExec,
+}
+
+// unexported
+
+func autotagExec(options Options, args []string, databasePath string) (error, warnings) {
+	recursive := options.HasOption("--recursive")
+	includeHidden := options.HasOption("--include-hidden")
+	explicit := options.HasOption("--explicit")
+
+	if len(args) < 1 {
+		return errTooFewArguments, nil
+	}
+
+	templates := make([]*rule.PathTemplate, 0, 1)
+	for _, text := range options.Arguments("--from-path") {
+		template, err := rule.ParsePathTemplate(text)
+		if err != nil {
+			return UsageError{err.Error()}, nil
+		}
+
+		templates = append(templates, template)
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	log.Infof(2, "loading settings")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	rules, err := loadRules(store, tx, settings)
+	if err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, path := range args {
+		if err := autotagPath(store, tx, settings, rules, templates, path, explicit, recursive, includeHidden, followSymlinks); err != nil {
+			switch {
+			case os.IsPermission(err):
+				warnings = append(warnings, PermissionDeniedError{path})
+			case os.IsNotExist(err):
+				warnings = append(warnings, NoSuchFileError{path})
+			default:
+				return err, warnings
+			}
+		}
+	}
+
+	return nil, warnings
+}
+
+func autotagPath(store *storage.Storage, tx *storage.Tx, settings entities.Settings, rules *ruleSet, templates []*rule.PathTemplate, path string, explicit, recursive, includeHidden, followSymlinks bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		return err
+	}
+
+	resolvedPath := absPath
+	if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		resolvedPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return err
+		}
+
+		stat, err = os.Lstat(resolvedPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Infof(2, "%v: evaluating rules", path)
+
+	pairs, err := rules.pairsFor(tx, resolvedPath)
+	if err != nil {
+		return err
+	}
+
+	templatePairs, err := pathTemplatePairs(store, tx, settings, templates, absPath)
+	if err != nil {
+		return err
+	}
+	pairs = append(pairs, templatePairs...)
+	if len(pairs) > 0 {
+		if err := tagPath(store, tx, absPath, pairs, explicit, false, includeHidden, false, false, followSymlinks, newFingerprintPool(settings, 1), settings.ReportDuplicates(), nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	if recursive && stat.IsDir() {
+		dir, err := os.Open(resolvedPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not open path: %w", path, err)
+		}
+
+		childNames, err := dir.Readdirnames(0)
+		dir.Close()
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve directory contents: %w", path, err)
+		}
+
+		for _, childName := range childNames {
+			childPath := filepath.Join(resolvedPath, childName)
+			if !includeHidden && _path.IsHidden(childPath) {
+				log.Infof(2, "%v: skipping hidden file/directory", childPath)
+				continue
+			}
+
+			if isIgnoredPath(childPath) {
+				continue
+			}
+
+			if err := autotagPath(store, tx, settings, rules, templates, childPath, explicit, true, includeHidden, followSymlinks); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// the tags extracted from the path by the templates that it matches
+func pathTemplatePairs(store *storage.Storage, tx *storage.Tx, settings entities.Settings, templates []*rule.PathTemplate, path string) (entities.TagIdValueIdPairs, error) {
+	tagArgs := make([]string, 0, 5)
+	for _, template := range templates {
+		pathTags, matches := template.Extract(path)
+		if !matches {
+			continue
+		}
+
+		log.Infof(2, "%v: matches path template '%v'", path, template)
+
+		for _, pathTag := range pathTags {
+			if err := entities.ValidateTagName(pathTag.TagName); err != nil {
+				log.Warnf("%v: skipping tag '%v' from path template '%v': %v", path, pathTag.TagName, template, err)
+				continue
+			}
+
+			tagArg := escape(pathTag.TagName, '\\', '=')
+			if pathTag.ValueName != "" {
+				if err := entities.ValidateValueName(pathTag.ValueName); err != nil {
+					log.Warnf("%v: skipping value '%v' from path template '%v': %v", path, pathTag.ValueName, template, err)
+					continue
+				}
+
+				tagArg += "=" + escape(pathTag.ValueName, '\\')
+			}
+
+			tagArgs = append(tagArgs, tagArg)
+		}
+	}
+
+	if len(tagArgs) == 0 {
+		return nil, nil
+	}
+
+	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		log.Warnf("%v: %v", path, warning)
+	}
+
+	return pairs, nil
+}
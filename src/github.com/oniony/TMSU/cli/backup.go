@@ -0,0 +1,93 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"time"
+)
+
+// unexported
+
+// backs up the database before a subcommand that changes it wholesale, unless
+// automatic backups are disabled
+func backupBeforeChange(store *storage.Storage, tx *storage.Tx) error {
+	if dryRun || store.ReadOnly() || os.Getenv("TMSU_REMOTE") != "" || storage.IsPostgres(store.DbPath) {
+		return nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %w", err)
+	}
+
+	retention := settings.BackupRetention()
+	if retention == 0 {
+		return nil
+	}
+
+	backup, err := storage.BackupAt(store.DbPath, retention)
+	if err != nil {
+		return fmt.Errorf("could not back up database: %w", err)
+	}
+
+	log.Infof(2, "backed up database to '%v'", backup.Path)
+
+	return nil
+}
+
+// backs up the database if the backup interval has elapsed since its latest backup
+func backupOnSchedule(store *storage.Storage) {
+	tx, err := store.Begin()
+	if err != nil {
+		log.Warnf("could not check for scheduled backup: %v", err)
+		return
+	}
+
+	settings, err := store.Settings(tx)
+	tx.Commit()
+	if err != nil {
+		log.Warnf("could not check for scheduled backup: %v", err)
+		return
+	}
+
+	interval := settings.BackupInterval()
+	retention := settings.BackupRetention()
+	if interval == 0 || retention == 0 {
+		return
+	}
+
+	backups, err := storage.BackupsAt(store.DbPath)
+	if err != nil {
+		log.Warnf("could not check for scheduled backup: %v", err)
+		return
+	}
+
+	if len(backups) > 0 && time.Since(backups[len(backups)-1].Time) < interval {
+		return
+	}
+
+	backup, err := storage.BackupAt(store.DbPath, retention)
+	if err != nil {
+		log.Warnf("could not back up database: %v", err)
+		return
+	}
+
+	log.Infof(2, "backed up database to '%v'", backup.Path)
+}
@@ -0,0 +1,866 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/terminal/ansi"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	term "golang.org/x/crypto/ssh/terminal"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+)
+
+var BrowseCommand = Command{
+	Name:     "browse",
+	Synopsis: "Browse tags and files interactively",
+	Usages:   []string{"tmsu browse [OPTION]... [QUERY]"},
+	Description: `Opens an interactive terminal browser showing the tags in the database on the left and the files matching them on the right.
+
+The files listed are those tagged with the highlighted tag or, once tags have been selected, those tagged with all of the selected tags. Alternatively a QUERY may be entered, or specified on the command line, to list the files matching it instead.
+
+The following keys are recognised:
+
+  Up/Down, k/j     Move the highlight
+  PgUp/PgDn        Move the highlight a page at a time
+  Home/End, g/G    Move to the first or last item
+  Tab, Left/Right  Switch between the tags and the files
+  Space            Select or deselect the highlighted tag
+  /                Enter a query (an empty query lists files by tag again)
+  t                Apply tags to the highlighted file
+  u                Remove tags from the highlighted file
+  Enter, o         Open the highlighted file
+  r                Reload the tags and files from the database
+  q, Ctrl-C        Quit
+
+Files are opened with 'xdg-open' ('open' on macOS). Changes made whilst browsing are recorded so they can be reverted with the 'undo' subcommand.`,
+	Examples: []string{"$ tmsu browse",
+		"$ tmsu browse music and not mp3"},
+	Options: Options{},
+	Exec:    browseExec,
+}
+
+// unexported
+
+func browseExec(options Options, args []string, databasePath string) (error, warnings) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("browse requires a terminal"), nil
+	}
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	browser := &browser{store: store, colour: colour, queryText: strings.Join(args, " "), selected: make(map[string]bool)}
+
+	return browser.run(), nil
+}
+
+type browsePane int
+
+const (
+	tagsPane browsePane = iota
+	filesPane
+)
+
+type browseTag struct {
+	name  string
+	count uint
+}
+
+type browser struct {
+	store  *storage.Storage
+	colour bool
+
+	tags      []browseTag
+	selected  map[string]bool
+	tagIndex  int
+	tagOffset int
+
+	queryText  string
+	files      entities.Files
+	fileTags   []string
+	fileIndex  int
+	fileOffset int
+
+	pane    browsePane
+	status  string
+	prompt  string
+	input   []rune
+	onInput func(string)
+
+	width, height int
+	quit          bool
+}
+
+func (browser *browser) run() error {
+	fd := int(os.Stdin.Fd())
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("could not configure terminal: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Print(enterAlternateScreen + hideCursor)
+	defer fmt.Print(showCursor + leaveAlternateScreen)
+
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+
+	next := make(chan bool)
+	defer close(next)
+	input := make(chan browseInput)
+	go readInput(next, input)
+
+	browser.reload()
+
+	for !browser.quit {
+		if err := browser.draw(fd); err != nil {
+			return err
+		}
+
+		next <- true
+
+	wait:
+		for {
+			select {
+			case <-resized:
+				if err := browser.draw(fd); err != nil {
+					return err
+				}
+			case in := <-input:
+				if in.err != nil {
+					return fmt.Errorf("could not read from terminal: %w", in.err)
+				}
+
+				for _, key := range parseKeys(in.data) {
+					if err := browser.handle(key, fd, state); err != nil {
+						return err
+					}
+				}
+
+				break wait
+			}
+		}
+	}
+
+	return nil
+}
+
+type browseInput struct {
+	data []byte
+	err  error
+}
+
+// reads from the terminal only when asked so that nothing is consumed whilst a file is being opened
+func readInput(next <-chan bool, input chan<- browseInput) {
+	buffer := make([]byte, 64)
+
+	for range next {
+		count, err := os.Stdin.Read(buffer)
+		data := make([]byte, count)
+		copy(data, buffer[:count])
+
+		input <- browseInput{data, err}
+	}
+}
+
+// keys
+
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyTab
+	keyBackspace
+	keyEscape
+	keyInterrupt
+)
+
+type key struct {
+	code keyCode
+	char rune
+}
+
+var escapeSequences = map[string]keyCode{
+	"[A":  keyUp,
+	"[B":  keyDown,
+	"[C":  keyRight,
+	"[D":  keyLeft,
+	"OA":  keyUp,
+	"OB":  keyDown,
+	"OC":  keyRight,
+	"OD":  keyLeft,
+	"[H":  keyHome,
+	"[F":  keyEnd,
+	"OH":  keyHome,
+	"OF":  keyEnd,
+	"[1~": keyHome,
+	"[4~": keyEnd,
+	"[5~": keyPageUp,
+	"[6~": keyPageDown,
+}
+
+func parseKeys(data []byte) []key {
+	keys := make([]key, 0, len(data))
+
+	for len(data) > 0 {
+		switch data[0] {
+		case 27:
+			length := escapeSequenceLength(data)
+			if length == 1 {
+				keys = append(keys, key{keyEscape, 0})
+			} else if code, ok := escapeSequences[string(data[1:length])]; ok {
+				keys = append(keys, key{code, 0})
+			}
+
+			data = data[length:]
+			continue
+		case '\r', '\n':
+			keys = append(keys, key{keyEnter, 0})
+		case '\t':
+			keys = append(keys, key{keyTab, 0})
+		case 127, 8:
+			keys = append(keys, key{keyBackspace, 0})
+		case 3:
+			keys = append(keys, key{keyInterrupt, 0})
+		default:
+			char, size := utf8.DecodeRune(data)
+			if char >= ' ' {
+				keys = append(keys, key{keyRune, char})
+			}
+
+			data = data[size:]
+			continue
+		}
+
+		data = data[1:]
+	}
+
+	return keys
+}
+
+// the length of the escape sequence at the start of the data, or one for a lone escape
+func escapeSequenceLength(data []byte) int {
+	if len(data) < 2 {
+		return 1
+	}
+
+	switch data[1] {
+	case 'O':
+		if len(data) < 3 {
+			return 2
+		}
+
+		return 3
+	case '[':
+		for index := 2; index < len(data); index++ {
+			if data[index] >= 0x40 && data[index] <= 0x7e {
+				return index + 1
+			}
+		}
+
+		return len(data)
+	}
+
+	return 1
+}
+
+// actions
+
+func (browser *browser) handle(key key, fd int, state *term.State) error {
+	if browser.onInput != nil {
+		browser.edit(key)
+		return nil
+	}
+
+	browser.status = ""
+
+	switch {
+	case key.code == keyInterrupt, key.code == keyRune && key.char == 'q':
+		browser.quit = true
+	case key.code == keyUp, key.code == keyRune && key.char == 'k':
+		browser.move(-1)
+	case key.code == keyDown, key.code == keyRune && key.char == 'j':
+		browser.move(1)
+	case key.code == keyPageUp:
+		browser.move(-browser.listHeight())
+	case key.code == keyPageDown:
+		browser.move(browser.listHeight())
+	case key.code == keyHome, key.code == keyRune && key.char == 'g':
+		browser.move(-browser.itemCount())
+	case key.code == keyEnd, key.code == keyRune && key.char == 'G':
+		browser.move(browser.itemCount())
+	case key.code == keyTab:
+		browser.pane = 1 - browser.pane
+	case key.code == keyLeft, key.code == keyRune && key.char == 'h':
+		browser.pane = tagsPane
+	case key.code == keyRight, key.code == keyRune && key.char == 'l':
+		browser.pane = filesPane
+	case key.code == keyRune && key.char == ' ':
+		browser.toggleTag()
+	case key.code == keyRune && key.char == '/':
+		browser.ask("query: ", browser.queryText, browser.setQuery)
+	case key.code == keyRune && key.char == 't':
+		if file := browser.file(); file != nil {
+			browser.ask("tag: ", "", func(input string) { browser.tagFile(file, input) })
+		}
+	case key.code == keyRune && key.char == 'u':
+		if file := browser.file(); file != nil {
+			browser.ask("untag: ", browser.tagName(), func(input string) { browser.untagFile(file, input) })
+		}
+	case key.code == keyEnter && browser.pane == tagsPane:
+		browser.pane = filesPane
+	case key.code == keyEnter, key.code == keyRune && key.char == 'o':
+		if file := browser.file(); file != nil {
+			return browser.open(file, fd, state)
+		}
+	case key.code == keyRune && key.char == 'r':
+		browser.reload()
+	}
+
+	return nil
+}
+
+func (browser *browser) edit(key key) {
+	switch key.code {
+	case keyRune:
+		browser.input = append(browser.input, key.char)
+	case keyBackspace:
+		if len(browser.input) > 0 {
+			browser.input = browser.input[:len(browser.input)-1]
+		}
+	case keyEscape, keyInterrupt:
+		browser.onInput = nil
+	case keyEnter:
+		onInput := browser.onInput
+		browser.onInput = nil
+		onInput(string(browser.input))
+	}
+}
+
+func (browser *browser) ask(prompt, initial string, onInput func(string)) {
+	browser.prompt = prompt
+	browser.input = []rune(initial)
+	browser.onInput = onInput
+}
+
+func (browser *browser) move(delta int) {
+	switch browser.pane {
+	case tagsPane:
+		index := clampIndex(browser.tagIndex+delta, len(browser.tags))
+		if index != browser.tagIndex {
+			browser.tagIndex = index
+			if browser.queryText == "" && len(browser.selected) == 0 {
+				browser.fileIndex = 0
+				browser.loadFiles("")
+			}
+		}
+	case filesPane:
+		index := clampIndex(browser.fileIndex+delta, len(browser.files))
+		if index != browser.fileIndex {
+			browser.fileIndex = index
+			browser.loadFileTags()
+		}
+	}
+}
+
+func (browser *browser) itemCount() int {
+	if browser.pane == tagsPane {
+		return len(browser.tags)
+	}
+
+	return len(browser.files)
+}
+
+func (browser *browser) toggleTag() {
+	tagName := browser.tagName()
+	if tagName == "" {
+		return
+	}
+
+	if browser.selected[tagName] {
+		delete(browser.selected, tagName)
+	} else {
+		browser.selected[tagName] = true
+	}
+
+	browser.queryText = ""
+	browser.fileIndex = 0
+	browser.loadFiles("")
+}
+
+func (browser *browser) setQuery(queryText string) {
+	browser.queryText = strings.TrimSpace(queryText)
+	browser.fileIndex = 0
+	browser.pane = filesPane
+	browser.loadFiles("")
+}
+
+func (browser *browser) tagFile(file *entities.File, input string) {
+	tagArgs := text.Tokenize(input)
+	if len(tagArgs) == 0 {
+		return
+	}
+
+	command := fmt.Sprintf("tmsu tag %v %v", file.Path(), input)
+	browser.change(command, fmt.Sprintf("tagged '%v'", path.Rel(file.Path())), func(tx *storage.Tx) (error, warnings) {
+		return tagPaths(browser.store, tx, tagArgs, []string{file.Path()}, false, false, false, false, false, false, false, 1)
+	})
+
+	browser.loadTags()
+	browser.loadFiles(file.Path())
+}
+
+func (browser *browser) untagFile(file *entities.File, input string) {
+	tagArgs := text.Tokenize(input)
+	if len(tagArgs) == 0 {
+		return
+	}
+
+	command := fmt.Sprintf("tmsu untag %v %v", file.Path(), input)
+	browser.change(command, fmt.Sprintf("untagged '%v'", path.Rel(file.Path())), func(tx *storage.Tx) (error, warnings) {
+		return untagPaths(browser.store, tx, []string{file.Path()}, tagArgs, false, false, false)
+	})
+
+	browser.loadTags()
+	browser.loadFiles(file.Path())
+}
+
+// applies a change within its own transaction, reporting the outcome in the status line
+func (browser *browser) change(command, success string, apply func(*storage.Tx) (error, warnings)) {
+	tx, err := browser.store.Begin()
+	if err != nil {
+		browser.status = err.Error()
+		return
+	}
+
+	if err := recordOperation(browser.store, tx, command); err != nil {
+		tx.Rollback()
+		browser.status = err.Error()
+		return
+	}
+
+	err, warnings := apply(tx)
+	if err != nil {
+		tx.Rollback()
+		browser.status = err.Error()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		browser.status = err.Error()
+		return
+	}
+
+	if len(warnings) > 0 {
+		browser.status = warnings[0].Error()
+		return
+	}
+
+	browser.status = success
+}
+
+func (browser *browser) open(file *entities.File, fd int, state *term.State) error {
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+
+	// hand the terminal back whilst the file is open in case the opener uses it
+	fmt.Print(showCursor + leaveAlternateScreen)
+	if err := term.Restore(fd, state); err != nil {
+		return fmt.Errorf("could not restore terminal: %w", err)
+	}
+
+	command := exec.Command(opener, file.Path())
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	if err := command.Run(); err != nil {
+		browser.status = fmt.Sprintf("could not open '%v': %v", path.Rel(file.Path()), err)
+	}
+
+	if _, err := term.MakeRaw(fd); err != nil {
+		return fmt.Errorf("could not configure terminal: %w", err)
+	}
+	fmt.Print(enterAlternateScreen + hideCursor)
+
+	return nil
+}
+
+// loading
+
+func (browser *browser) reload() {
+	browser.loadTags()
+
+	var currentPath string
+	if file := browser.file(); file != nil {
+		currentPath = file.Path()
+	}
+	browser.loadFiles(currentPath)
+}
+
+func (browser *browser) loadTags() {
+	tagName := browser.tagName()
+
+	tx, err := browser.store.Begin()
+	if err != nil {
+		browser.status = err.Error()
+		return
+	}
+	defer tx.Commit()
+
+	tags, err := browser.store.Tags(tx)
+	if err != nil {
+		browser.status = fmt.Sprintf("could not retrieve tags: %v", err)
+		return
+	}
+
+	usages, err := browser.store.TagUsage(tx)
+	if err != nil {
+		browser.status = fmt.Sprintf("could not retrieve tag usage: %v", err)
+		return
+	}
+
+	counts := make(map[entities.TagId]uint, len(usages))
+	for _, usage := range usages {
+		counts[usage.Id] = usage.FileCount
+	}
+
+	browser.tags = make([]browseTag, len(tags))
+	for index, tag := range tags {
+		browser.tags[index] = browseTag{tag.Name, counts[tag.Id]}
+
+		if tag.Name == tagName {
+			browser.tagIndex = index
+		}
+	}
+
+	for name := range browser.selected {
+		if !tags.ContainsCasedName(name, false) {
+			delete(browser.selected, name)
+		}
+	}
+
+	browser.tagIndex = clampIndex(browser.tagIndex, len(browser.tags))
+}
+
+// loads the files for the current query, keeping the highlight on the file at currentPath if it is still listed
+func (browser *browser) loadFiles(currentPath string) {
+	browser.files = nil
+	browser.fileTags = nil
+
+	tx, err := browser.store.Begin()
+	if err != nil {
+		browser.status = err.Error()
+		return
+	}
+	defer tx.Commit()
+
+	var files entities.Files
+	if browser.queryText != "" {
+		var warnings warnings
+		files, warnings, err = queryFiles(browser.store, tx, browser.queryText, nil, "", false, false, false, "name", false, 0)
+		if err == nil && len(warnings) > 0 {
+			browser.status = warnings[0].Error()
+		}
+	} else {
+		files, err = browser.store.FilesForQuery(tx, query.HasAll(browser.tagNames()), nil, "", false, false, "name", false, 0)
+	}
+	if err != nil {
+		browser.status = err.Error()
+		return
+	}
+
+	browser.files = files
+	for index, file := range files {
+		if file.Path() == currentPath {
+			browser.fileIndex = index
+		}
+	}
+	browser.fileIndex = clampIndex(browser.fileIndex, len(browser.files))
+
+	browser.loadFileTagsWithin(tx)
+}
+
+func (browser *browser) loadFileTags() {
+	tx, err := browser.store.Begin()
+	if err != nil {
+		browser.status = err.Error()
+		return
+	}
+	defer tx.Commit()
+
+	browser.loadFileTagsWithin(tx)
+}
+
+func (browser *browser) loadFileTagsWithin(tx *storage.Tx) {
+	browser.fileTags = nil
+
+	file := browser.file()
+	if file == nil {
+		return
+	}
+
+	tagNames, err := tagNamesForFile(browser.store, tx, file.Id, "", false, false, false, nil)
+	if err != nil {
+		browser.status = err.Error()
+		return
+	}
+
+	browser.fileTags = tagNames
+}
+
+// the names of the tags the files are listed for: the selected tags or else the highlighted tag
+func (browser *browser) tagNames() []string {
+	if len(browser.selected) == 0 {
+		if tagName := browser.tagName(); tagName != "" {
+			return []string{tagName}
+		}
+
+		return nil
+	}
+
+	tagNames := make([]string, 0, len(browser.selected))
+	for tagName := range browser.selected {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+
+	return tagNames
+}
+
+func (browser *browser) tagName() string {
+	if browser.tagIndex >= len(browser.tags) {
+		return ""
+	}
+
+	return browser.tags[browser.tagIndex].name
+}
+
+func (browser *browser) file() *entities.File {
+	if browser.fileIndex >= len(browser.files) {
+		return nil
+	}
+
+	return browser.files[browser.fileIndex]
+}
+
+// drawing
+
+const (
+	enterAlternateScreen = "\x1b[?1049h"
+	leaveAlternateScreen = "\x1b[?1049l"
+	showCursor           = "\x1b[?25h"
+	hideCursor           = "\x1b[?25l"
+	clearLine            = "\x1b[K"
+)
+
+func (browser *browser) listHeight() int {
+	return browser.height - 3
+}
+
+func (browser *browser) draw(fd int) error {
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return fmt.Errorf("could not determine terminal size: %w", err)
+	}
+	browser.width, browser.height = width, height
+
+	var buffer bytes.Buffer
+
+	if width < 20 || height < 5 {
+		buffer.WriteString("\x1b[H\x1b[2J" + fit("terminal too small", width))
+		_, err := os.Stdout.Write(buffer.Bytes())
+		return err
+	}
+
+	tagsWidth := width / 3
+	if tagsWidth > 40 {
+		tagsWidth = 40
+	}
+	filesWidth := width - tagsWidth - 1
+	rows := browser.listHeight()
+
+	browser.tagOffset = scrollOffset(browser.tagIndex, browser.tagOffset, rows)
+	browser.fileOffset = scrollOffset(browser.fileIndex, browser.fileOffset, rows)
+
+	moveTo(&buffer, 1)
+	buffer.WriteString(ansi.InvertCode + fit("Tags", tagsWidth) + " " + fit("Files: "+browser.describeFiles(), filesWidth) + ansi.ResetCode)
+
+	for row := 0; row < rows; row++ {
+		moveTo(&buffer, row+2)
+
+		buffer.WriteString(browser.highlight(tagsPane, browser.tagOffset+row, fit(browser.tagLine(browser.tagOffset+row), tagsWidth)))
+		buffer.WriteString("|")
+		buffer.WriteString(browser.highlight(filesPane, browser.fileOffset+row, browser.fileLine(browser.fileOffset+row, filesWidth)))
+		buffer.WriteString(clearLine)
+	}
+
+	moveTo(&buffer, height-1)
+	buffer.WriteString(ansi.InvertCode + fit(strings.Join(browser.fileTags, " "), width) + ansi.ResetCode)
+
+	moveTo(&buffer, height)
+	if browser.onInput != nil {
+		buffer.WriteString(fit(browser.prompt+string(browser.input), width-1) + clearLine)
+		fmt.Fprintf(&buffer, "\x1b[%v;%vH%v", height, minInt(utf8.RuneCountInString(browser.prompt)+len(browser.input)+1, width), showCursor)
+	} else {
+		status := browser.status
+		if status == "" {
+			status = "q quit  tab switch  space select  / query  t tag  u untag  o open  r reload"
+		}
+		buffer.WriteString(fit(status, width-1) + clearLine + hideCursor)
+	}
+
+	_, err = os.Stdout.Write(buffer.Bytes())
+	return err
+}
+
+func (browser *browser) describeFiles() string {
+	if browser.queryText != "" {
+		return browser.queryText
+	}
+
+	tagNames := browser.tagNames()
+	if len(tagNames) == 0 {
+		return "all"
+	}
+
+	return strings.Join(tagNames, " and ")
+}
+
+func (browser *browser) tagLine(index int) string {
+	if index >= len(browser.tags) {
+		return ""
+	}
+
+	tag := browser.tags[index]
+
+	marker := "  "
+	if browser.selected[tag.name] {
+		marker = "* "
+	}
+
+	return fmt.Sprintf("%v%v (%v)", marker, tag.name, tag.count)
+}
+
+func (browser *browser) fileLine(index, width int) string {
+	if index >= len(browser.files) {
+		return fit("", width)
+	}
+
+	file := browser.files[index]
+	line := fit(" "+path.Rel(file.Path()), width)
+
+	if browser.colour && file.IsDir {
+		return ansi.Blue(line)
+	}
+
+	return line
+}
+
+// highlights the line at index if it is the highlighted item of the pane
+func (browser *browser) highlight(pane browsePane, index int, line string) string {
+	switch {
+	case pane == tagsPane && index != browser.tagIndex, pane == filesPane && index != browser.fileIndex:
+		return line
+	case pane == tagsPane && len(browser.tags) == 0, pane == filesPane && len(browser.files) == 0:
+		return line
+	case pane == browser.pane:
+		return ansi.InvertCode + ansi.Strip(line) + ansi.ResetCode
+	}
+
+	return ansi.BoldCode + ansi.Strip(line) + ansi.ResetCode
+}
+
+func moveTo(buffer *bytes.Buffer, row int) {
+	fmt.Fprintf(buffer, "\x1b[%v;1H", row)
+}
+
+// truncates or pads the text to exactly width characters
+func fit(text string, width int) string {
+	length := utf8.RuneCountInString(text)
+
+	if length > width {
+		return string([]rune(text)[:width])
+	}
+
+	return text + strings.Repeat(" ", width-length)
+}
+
+// the offset of the first visible row such that the row at index is visible
+func scrollOffset(index, offset, rows int) int {
+	if index < offset {
+		return index
+	}
+	if index >= offset+rows {
+		return index - rows + 1
+	}
+
+	return offset
+}
+
+func clampIndex(index, count int) int {
+	if index >= count {
+		index = count - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+
+	return index
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
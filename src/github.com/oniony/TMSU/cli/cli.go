@@ -16,21 +16,32 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
 	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/progress"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/storage/database"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
 )
 
 func Run() {
 	helpCommands = commands
+	atomicCommands = commands
 
 	parser := NewOptionParser(globalOptions, commands)
-	command, options, arguments, err := parser.Parse(os.Args[1:]...)
+	lines := splitAtomicArgs(os.Args[1:])
+	command, options, arguments, err := parser.Parse(lines[0]...)
+	if len(lines) > 1 && (err != nil || !options.HasOption("--atomic")) {
+		// ';' separates commands only when they are run atomically
+		command, options, arguments, err = parser.Parse(os.Args[1:]...)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fail(UsageError{err.Error()}, nil, false)
 	}
 
 	switch {
@@ -42,46 +53,137 @@ func Run() {
 
 	log.Verbosity = options.Count("--verbose") + 1
 
+	// progress would be interleaved with the verbose messages
+	progress.Enabled = !options.HasOption("--quiet") && log.Verbosity == 1
+
+	readOnly = options.HasOption("--read-only")
+
+	if waitTimeout, err = parseWaitTimeout(options); err != nil {
+		fail(UsageError{err.Error()}, nil, false)
+	}
+	database.BusyTimeout = waitTimeout
+
+	if listedPathStyle, err = parsePathStyle(options); err != nil {
+		fail(UsageError{err.Error()}, nil, false)
+	}
+	lockDatabase = !unlockedCommands[command.Name]
+
+	// invalid formats are reported by the command itself
+	asJson, _ := useJson(options)
+
+	databasePath, err := resolveDatabasePath(options)
+	if err != nil {
+		fail(err, nil, asJson)
+	}
+
+	var warnings warnings
+	switch {
+	case options.HasOption("--dry-run") && options.HasOption("--atomic"):
+		err = UsageError{"--dry-run cannot be combined with --atomic"}
+	case options.HasOption("--dry-run"):
+		err, warnings = runDryRun(command, options, arguments, databasePath)
+	case options.HasOption("--atomic"):
+		err, warnings = runAtomicArgs(command, options, arguments, lines, databasePath)
+	default:
+		err, warnings = execWithHooks(command, options, arguments, databasePath)
+	}
+
+	if err != nil || len(warnings) > 0 {
+		fail(err, warnings, asJson)
+	}
+}
+
+// unexported
+
+var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, ""},
+	Option{"--help", "-h", "show help and exit", false, ""},
+	Option{"--version", "-V", "show version information and exit", false, ""},
+	Option{"--database", "-D", "use the specified database", true, ""},
+	Option{"--color", "", "colorize the output (auto/always/never)", true, ""},
+	Option{"--columns", "", "arrange listings in columns: auto, always, never or a width", true, ""},
+	Option{"--format", "", "output format (text/json)", true, ""},
+	Option{"--follow-symlinks", "", "follow symbolic links, overriding the 'followSymlinks' setting", false, ""},
+	Option{"--no-follow-symlinks", "", "do not follow symbolic links, overriding the 'followSymlinks' setting", false, ""},
+	Option{"--atomic", "", "run the commands separated by ';' arguments atomically", false, ""},
+	Option{"--dry-run", "", "report the changes the command would make without making them", false, ""},
+	Option{"--quiet", "", "do not show the progress of long operations", false, ""},
+	Option{"--read-only", "", "refuse to make any change to the database", false, ""},
+	Option{"--wait-timeout", "", "how long to wait for another process to finish changing the database, e.g. 30s (default 1m)", true, ""},
+	Option{"--path-style", "", "how the paths of files are listed: relative (default), absolute or db-relative", true, ""},
+}
+
+// reports the warnings and error, as JSON objects if requested, then exits with
+// the status of the error, or else the first warning
+func fail(err error, warnings warnings, asJson bool) {
+	failures := append(warnings, err)
+	if err == nil {
+		failures = warnings
+	}
+
+	for _, failure := range failures {
+		if asJson {
+			fmt.Fprintln(os.Stderr, errorJson(failure))
+		} else {
+			log.Warn(failure.Error())
+		}
+	}
+
+	if err == nil {
+		err = warnings[0]
+	}
+
+	os.Exit(codeFor(err).status)
+}
+
+// the database to use, which is, in order of precedence: that given by the
+// --database option; that named by the TMSU_DB environment variable; the
+// nearest .tmsu/db in the working directory or its ancestors; or else the
+// default database. Where several are listed, separated by the path list
+// separator, each is made absolute so that it is unaffected by commands that
+// change directory and is passed on as-is to hooks.
+func resolveDatabasePath(options Options) (string, error) {
 	var databasePath string
 	switch {
 	case options.HasOption("--database"):
 		log.Infof(2, "using database from command-line option")
+
 		databasePath = options.Get("--database").Argument
-	case os.Getenv("TMSU_DB") != "":
+		if databasePath == "" {
+			return "", UsageError{"--database requires a path"}
+		}
+	case os.Getenv(databaseEnvironmentVariable) != "":
 		log.Infof(2, "using database from environment variable")
-		databasePath = os.Getenv("TMSU_DB")
+
+		databasePath = os.Getenv(databaseEnvironmentVariable)
 	default:
+		var err error
 		databasePath, err = findDatabase()
 		if err != nil {
-			log.Fatalf("could not find database: %v", err)
+			return "", fmt.Errorf("could not find database: %w", err)
 		}
+
+		return databasePath, nil
 	}
 
-	err, warnings := command.Exec(options, arguments, databasePath)
+	// a connection string names a single database
+	if storage.IsPostgres(databasePath) {
+		return databasePath, nil
+	}
 
-	if warnings != nil {
-		for _, warning := range warnings {
-			log.Warn(warning)
+	databasePaths := filepath.SplitList(databasePath)
+	for index, path := range databasePaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return "", fmt.Errorf("%v: could not get absolute path: %w", path, err)
 		}
-	}
 
-	if err != nil {
-		log.Warn(err.Error())
+		databasePaths[index] = absPath
 	}
 
-	if err != nil || (warnings != nil && len(warnings) > 0) {
-		os.Exit(1)
-	}
+	return strings.Join(databasePaths, string(filepath.ListSeparator)), nil
 }
 
-// unexported
-
-var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, ""},
-	Option{"--help", "-h", "show help and exit", false, ""},
-	Option{"--version", "-V", "show version information and exit", false, ""},
-	Option{"--database", "-D", "use the specified database", true, ""},
-	Option{"--color", "", "colorize the output (auto/always/never)", true, ""},
-}
+const databaseEnvironmentVariable = "TMSU_DB"
 
 func findDatabase() (string, error) {
 	databasePath, err := findDatabaseInPath()
@@ -133,6 +235,84 @@ func findDatabaseInPath() (string, error) {
 	}
 }
 
+// the database path followed by the databases of the current directory and its
+// ancestors, nearest first
+func nestedDatabasePaths(databasePath string) ([]string, error) {
+	databasePaths := []string{databasePath}
+	seen := map[string]bool{filepath.Clean(databasePath): true}
+
+	path, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		dbPath := filepath.Join(path, ".tmsu", "db")
+
+		log.Infof(2, "looking for database at '%s'", dbPath)
+
+		_, err := os.Stat(dbPath)
+		switch {
+		case err == nil:
+			if !seen[dbPath] {
+				seen[dbPath] = true
+				databasePaths = append(databasePaths, dbPath)
+			}
+		case os.IsNotExist(err), os.IsPermission(err):
+		default:
+			return nil, err
+		}
+
+		if _path.IsRoot(path) {
+			return databasePaths, nil
+		}
+
+		path = filepath.Dir(path)
+	}
+}
+
+// the databases listed, one per line, in ~/.tmsu/databases. Blank lines and
+// those beginning with '#' are ignored.
+func federatedDatabasePaths() ([]string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("could not identify current user: %w", err)
+	}
+
+	listPath := filepath.Join(u.HomeDir, ".tmsu", "databases")
+
+	file, err := os.Open(listPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read list of databases: %w", err)
+	}
+	defer file.Close()
+
+	databasePaths := make([]string, 0, 10)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "~"+string(filepath.Separator)) {
+			line = filepath.Join(u.HomeDir, line[2:])
+		}
+
+		databasePaths = append(databasePaths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read list of databases: %w", err)
+	}
+
+	if len(databasePaths) == 0 {
+		return nil, fmt.Errorf("%v: no databases listed", listPath)
+	}
+
+	return databasePaths, nil
+}
+
 func findCommand(commands []*Command, commandName string) *Command {
 	for _, command := range commands {
 		if command.Name == commandName {
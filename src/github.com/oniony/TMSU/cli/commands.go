@@ -20,25 +20,66 @@ package cli
 // unexported
 
 var commands = []*Command{
+	&AliasCommand,
+	&AutotagCommand,
+	&BrowseCommand,
 	&ConfigCommand,
+	&CompletionCommand,
 	&CopyCommand,
+	&CopyTagsCommand,
+	&DaemonCommand,
+	&DbCommand,
+	&DedupeCommand,
 	&DeleteCommand,
+	&DeleteFileCommand,
+	&DiffCommand,
+	&DoctorCommand,
 	&DupesCommand,
+	&EncryptCommand,
+	&ExportCommand,
 	&FilesCommand,
+	&GraphCommand,
 	&HelpCommand,
 	&ImplyCommand,
+	&ImportCommand,
 	&InfoCommand,
 	&InitCommand,
+	&LogCommand,
 	&MergeCommand,
 	&MountCommand,
+	&MountsCommand,
+	&MoveCommand,
+	&NoteCommand,
+	&OpenCommand,
+	&PropCommand,
+	&RateCommand,
+	&RefingerprintCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&RepathCommand,
+	&RestoreCommand,
+	&RetagCommand,
+	&RuleCommand,
+	&ScriptCommand,
+	&ServeCommand,
+	&SnapshotCommand,
+	&StatsCommand,
 	&StatusCommand,
+	&SyncCommand,
+	&SyncXattrCommand,
 	&TagCommand,
+	&TagDefCommand,
+	&TagGroupCommand,
+	&TagInfoCommand,
 	&TagsCommand,
+	&TransactionCommand,
+	&UndoCommand,
 	&UnmountCommand,
 	&UntagCommand,
 	&UntaggedCommand,
 	&ValuesCommand,
+	&VerifyCommand,
 	&VersionCommand,
+	&ViewCommand,
+	&WatchCommand,
 	&VfsCommand}
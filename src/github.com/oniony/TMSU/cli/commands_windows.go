@@ -20,22 +20,58 @@ package cli
 // unexported
 
 var commands = []*Command{
+	&AliasCommand,
+	&AutotagCommand,
 	&ConfigCommand,
+	&CompletionCommand,
 	&CopyCommand,
+	&CopyTagsCommand,
+	&DbCommand,
+	&DedupeCommand,
 	&DeleteCommand,
+	&DeleteFileCommand,
+	&DiffCommand,
+	&DoctorCommand,
 	&DupesCommand,
+	&EncryptCommand,
+	&ExportCommand,
 	&FilesCommand,
+	&GraphCommand,
 	&HelpCommand,
 	&ImplyCommand,
+	&ImportCommand,
 	&InfoCommand,
 	&InitCommand,
+	&LogCommand,
 	&MergeCommand,
+	&MoveCommand,
+	&NoteCommand,
+	&OpenCommand,
+	&PropCommand,
+	&RateCommand,
+	&RefingerprintCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&RepathCommand,
+	&RestoreCommand,
+	&RetagCommand,
+	&RuleCommand,
+	&ScriptCommand,
+	&ServeCommand,
+	&SnapshotCommand,
+	&StatsCommand,
 	&StatusCommand,
+	&SyncCommand,
 	&TagCommand,
+	&TagDefCommand,
+	&TagGroupCommand,
+	&TagInfoCommand,
 	&TagsCommand,
+	&TransactionCommand,
+	&UndoCommand,
 	&UntagCommand,
 	&UntaggedCommand,
 	&ValuesCommand,
-	&VersionCommand}
+	&VerifyCommand,
+	&VersionCommand,
+	&ViewCommand}
@@ -18,33 +18,258 @@ package cli
 import (
 	"bytes"
 	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/ignore"
 	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/common/terminal"
 	"github.com/oniony/TMSU/common/terminal/ansi"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"github.com/oniony/TMSU/storage/database"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // unexported
 
+// set when run with --read-only, whereupon the database must not be changed
+var readOnly bool
+
+// how long to wait for another process to finish changing the database, as set
+// with --wait-timeout
+var waitTimeout = database.BusyTimeout
+
+// set unless the subcommand is one that does not take the database's lock,
+// whereupon its transactions against a local database are made whilst holding it
+var lockDatabase bool
+
+// the subcommands that do not take the database's lock: those that list from the
+// database, which the write-ahead log keeps from blocking or being blocked by a
+// writer and which would otherwise deadlock when piped to a subcommand that holds
+// the lock, such as 'tmsu files -0 | tmsu tag --null-stdin', and those that serve
+// requests, which would stall whilst another process is changing the database
+var unlockedCommands = map[string]bool{
+	"completion": true, "daemon": true, "diff": true, "dupes": true, "export": true, "files": true,
+	"graph": true, "info": true, "open": true, "serve": true, "stats": true,
+	"status": true, "tags": true, "untagged": true, "values": true, "verify": true,
+	"vfs": true}
+
+// the timeout specified with --wait-timeout, if any, or else the default
+func parseWaitTimeout(options Options) (time.Duration, error) {
+	if !options.HasOption("--wait-timeout") {
+		return database.BusyTimeout, nil
+	}
+
+	argument := options.Get("--wait-timeout").Argument
+	timeout, err := time.ParseDuration(argument)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid wait timeout '%v': specify a duration such as '30s' or '2m'", argument)
+	}
+
+	return timeout, nil
+}
+
 func openDatabase(path string) (*storage.Storage, error) {
-	storage, err := storage.OpenAt(path)
+	if atomicStore != nil && path == atomicDatabasePath {
+		return atomicStore, nil
+	}
+
+	if !storage.IsPostgres(path) && len(filepath.SplitList(path)) > 1 {
+		return nil, fmt.Errorf("several databases may only be queried with the 'files' subcommand")
+	}
+
+	globals, err := globalSettings()
+	if err != nil {
+		return nil, err
+	}
+	readOnlyRequested := readOnly || globals.ReadOnly()
+
+	var store *storage.Storage
+	switch address := os.Getenv("TMSU_REMOTE"); {
+	case address != "":
+		log.Infof(2, "using remote database at '%v'", address)
+
+		store, err = storage.OpenRemote(address, os.Getenv("TMSU_SECRET"), os.Getenv("TMSU_REMOTE_ROOT"))
+		if err == nil && readOnlyRequested {
+			store.SetReadOnly(true)
+		}
+	case storage.IsPostgres(path):
+		log.Infof(2, "using PostgreSQL database")
+
+		store, err = storage.OpenPostgres(path, os.Getenv("TMSU_REMOTE_ROOT"))
+		if err == nil && readOnlyRequested {
+			store.SetReadOnly(true)
+		}
+	default:
+		store, err = openLocalDatabase(path, readOnlyRequested)
+		if err == nil && lockDatabase {
+			store.UseLock(waitTimeout)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	store.UseGlobalSettings(globals)
+	store.SetUser(taggingUser())
+
+	listedPathRoot = store.RootPath
+
+	if !store.ReadOnly() {
+		if err := applyReadOnlySetting(store); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	if os.Getenv("TMSU_REMOTE") == "" && !storage.IsPostgres(path) && !store.ReadOnly() {
+		backupOnSchedule(store)
+	}
+
+	if path == hookDatabasePath {
+		store.TrackChanges()
+		hookStores = append(hookStores, store)
+	}
+
+	return store, nil
+}
+
+// refuses a subcommand that would change the database, before it has made any
+// change to the database or the file system, if the database is read-only
+func refuseIfStoreReadOnly(store *storage.Storage) error {
+	if store.ReadOnly() {
+		return database.DatabaseReadOnlyError{}
+	}
+
+	return nil
+}
+
+// refuses a subcommand that changes the database file directly, rather than via
+// the storage, if run with --read-only or the global 'readOnly' setting is enabled
+func refuseIfReadOnly() error {
+	if readOnly {
+		return database.DatabaseReadOnlyError{}
+	}
+
+	globals, err := globalSettings()
+	if err != nil {
+		return err
+	}
+	if globals.ReadOnly() {
+		return database.DatabaseReadOnlyError{}
+	}
+
+	return nil
+}
+
+// makes the storage refuse changes if the database's 'readOnly' setting is enabled
+func applyReadOnlySetting(store *storage.Storage) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %w", err)
+	}
+
+	if settings.ReadOnly() {
+		log.Info(2, "database is read-only")
+		store.SetReadOnly(true)
+	}
+
+	return nil
+}
+
+// the user to whom the tags applied are attributed, which is TMSU_USER if set
+// or else the name of the current user
+func taggingUser() string {
+	if name := os.Getenv("TMSU_USER"); name != "" {
+		return name
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		log.Infof(2, "could not identify current user: %v", err)
+		return ""
+	}
+
+	return u.Username
+}
+
+// opens the database at the path, read-only if requested, in which case it is
+// not upgraded
+func openLocalDatabase(path string, readOnly bool) (*storage.Storage, error) {
+	var store *storage.Storage
+	var err error
+	if encrypted, _ := storage.IsEncrypted(path); encrypted {
+		passphrase, passphraseErr := databasePassphrase(path)
+		if passphraseErr != nil {
+			return nil, passphraseErr
+		}
+
+		if readOnly {
+			store, err = storage.OpenReadOnlyAt(path, passphrase)
+		} else {
+			store, err = storage.OpenEncryptedAt(path, passphrase)
+		}
+		if _, incorrect := err.(database.DatabasePassphraseError); incorrect {
+			forgetPassphrase(path)
+		}
+	} else if readOnly {
+		store, err = storage.OpenReadOnlyAt(path, "")
+	} else {
+		store, err = storage.OpenAt(path)
+	}
 	if err != nil {
 		switch err.(type) {
 		case database.DatabaseNotFoundError:
-			return nil, fmt.Errorf("no database found: use 'tmsu init' to create one")
+			return nil, errNoDatabase
 		case database.DatabaseAccessError:
-			return nil, fmt.Errorf("cannot access database: %v", err)
+			return nil, fmt.Errorf("cannot access database: %w", err)
 		default:
 			return nil, err
 		}
 	}
 
-	return storage, nil
+	return store, nil
+}
+
+// records the changes made within the transaction so that 'tmsu undo' can revert them,
+// refusing the subcommand outright if the database is read-only
+func beginOperation(store *storage.Storage, tx *storage.Tx) error {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err
+	}
+
+	return recordOperation(store, tx, commandLine())
+}
+
+// the command line of the subcommand being run
+func commandLine() string {
+	args := os.Args[1:]
+	if atomicArgs != nil {
+		args = atomicArgs
+	}
+
+	return strings.Join(append([]string{"tmsu"}, args...), " ")
+}
+
+// records the changes made within the transaction against the command line specified
+func recordOperation(store *storage.Storage, tx *storage.Tx, command string) error {
+	if _, err := store.BeginOperation(tx, command); err != nil {
+		return fmt.Errorf("could not record operation: %w", err)
+	}
+
+	return nil
 }
 
 func stdoutIsCharDevice() bool {
@@ -78,6 +303,115 @@ func useColour(options Options) (bool, error) {
 	return false, fmt.Errorf("invalid argument '%v' for '--color'", when)
 }
 
+// whether symbolic links are to be followed, both when identifying the file a
+// path refers to and when traversing directories: the --no-dereference option of
+// the command and the global --follow-symlinks and --no-follow-symlinks options
+// take precedence over the database's 'followSymlinks' setting
+func followSymlinksPolicy(store *storage.Storage, options Options) (bool, error) {
+	if options.HasOption("--follow-symlinks") && options.HasOption("--no-follow-symlinks") {
+		return false, fmt.Errorf("--follow-symlinks and --no-follow-symlinks are mutually exclusive")
+	}
+
+	switch {
+	case options.HasOption("--no-dereference"), options.HasOption("--no-follow-symlinks"):
+		return false, nil
+	case options.HasOption("--follow-symlinks"):
+		return true, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve settings: %w", err)
+	}
+
+	return settings.FollowSymlinks(), nil
+}
+
+// the number of files to fingerprint concurrently, from the --jobs option
+func fingerprintJobs(options Options) (int, error) {
+	if !options.HasOption("--jobs") {
+		return fingerprint.DefaultJobs, nil
+	}
+
+	text := options.Get("--jobs").Argument
+
+	value, err := strconv.ParseUint(text, 10, 16)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid argument '%v' for '--jobs'", text)
+	}
+
+	return int(value), nil
+}
+
+// the pool with which files are fingerprinted using the database's algorithms
+func newFingerprintPool(settings entities.Settings, jobs int) *fingerprint.Pool {
+	return fingerprint.NewPool(settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), jobs)
+}
+
+// identifies the paths excluded by '.tmsuignore' files when walking directory trees
+var ignoreMatcher = ignore.NewMatcher()
+
+// whether the path is excluded by a '.tmsuignore' file in any of its ancestor directories
+func isIgnored(path string, isDir bool) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	if ignoreMatcher.Ignored(absPath, isDir) {
+		log.Infof(2, "%v: skipping ignored file/directory", path)
+		return true
+	}
+
+	return false
+}
+
+// whether the path, which need not be a directory, is excluded by a '.tmsuignore' file
+func isIgnoredPath(path string) bool {
+	stat, err := os.Stat(path)
+
+	return isIgnored(path, err == nil && stat.IsDir())
+}
+
+// the paths within the directory that are tagged or untagged when tagging or
+// untagging it recursively: those that are neither hidden, unless including
+// hidden files, nor ignored
+func recursiveChildPaths(path string, includeHidden bool) ([]string, error) {
+	osFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not open path: %w", path, err)
+	}
+
+	childNames, err := osFile.Readdirnames(0)
+	osFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve directory contents: %w", path, err)
+	}
+
+	childPaths := make([]string, 0, len(childNames))
+	for _, childName := range childNames {
+		childPath := filepath.Join(path, childName)
+		if !includeHidden && _path.IsHidden(childPath) {
+			log.Infof(2, "%v: skipping hidden file/directory", childPath)
+			continue
+		}
+
+		if isIgnoredPath(childPath) {
+			continue
+		}
+
+		childPaths = append(childPaths, childPath)
+	}
+
+	return childPaths, nil
+}
+
 type emptyStat struct {
 	name string
 }
@@ -107,12 +441,28 @@ func (emptyStat) Sys() interface{} {
 }
 
 func createTag(store *storage.Storage, tx *storage.Tx, tagName string) (*entities.Tag, error) {
+	if parentName := entities.ParentTagName(tagName); parentName != "" {
+		parent, err := store.TagByName(tx, parentName)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			if _, err := createTag(store, tx, parentName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	tag, err := store.AddTag(tx, tagName)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Warnf("new tag '%v'", tagName)
+	if dryRun {
+		log.Warnf("would create tag '%v'", tag.Name)
+	} else {
+		log.Warnf("new tag '%v'", tag.Name)
+	}
 
 	return tag, nil
 }
@@ -123,7 +473,11 @@ func createValue(store *storage.Storage, tx *storage.Tx, valueName string) (*ent
 		return nil, err
 	}
 
-	log.Warnf("new value '%v'", valueName)
+	if dryRun {
+		log.Warnf("would create value '%v'", valueName)
+	} else {
+		log.Warnf("new value '%v'", valueName)
+	}
 
 	return value, nil
 }
@@ -220,3 +574,34 @@ func escape(text string, chars ...rune) string {
 
 	return text
 }
+
+// replaces the control characters within text, such as the newline or tab that
+// may appear in a file name, with escape sequences such as '\n' and '\x1b', so
+// that each item listed occupies a single line and cannot write terminal
+// control codes. Output that must reproduce paths exactly should instead be
+// NUL-delimited (--print0) or JSON.
+func escapeControl(text string) string {
+	if strings.IndexFunc(text, unicode.IsControl) == -1 {
+		return text
+	}
+
+	var builder strings.Builder
+	for _, char := range text {
+		switch {
+		case char == '\n':
+			builder.WriteString(`\n`)
+		case char == '\r':
+			builder.WriteString(`\r`)
+		case char == '\t':
+			builder.WriteString(`\t`)
+		case unicode.IsControl(char) && char < 0x100:
+			fmt.Fprintf(&builder, `\x%02x`, char)
+		case unicode.IsControl(char):
+			fmt.Fprintf(&builder, `\u%04x`, char)
+		default:
+			builder.WriteRune(char)
+		}
+	}
+
+	return builder.String()
+}
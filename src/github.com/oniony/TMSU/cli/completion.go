@@ -0,0 +1,730 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var CompletionCommand = Command{
+	Name:     "completion",
+	Synopsis: "Generate a shell completion script",
+	Usages: []string{"tmsu completion SHELL",
+		"tmsu completion --values=TAG [PREFIX]"},
+	Description: `Writes a completion script for SHELL, which may be one of 'bash', 'zsh' or 'fish', to standard output.
+
+The script is generated from the subcommands and options of this version of TMSU so remains in step with them. Tag names and values are completed by querying the database in use, including one specified with the --database option on the command-line being completed.
+
+With --values the values applied with TAG, or the tag it is an alias of, that begin with PREFIX are listed one per line. The scripts use this to complete the value after 'TAG=' (or another comparison operator) in a tag or query argument.`,
+	Examples: []string{"$ source <(tmsu completion bash)",
+		"$ tmsu completion zsh >~/.zsh/functions/_tmsu",
+		"$ tmsu completion fish >~/.config/fish/completions/tmsu.fish",
+		"$ tmsu completion --values=year 19\n1963\n1999"},
+	Options: Options{{"--values", "", "list the values of TAG beginning with PREFIX", true, ""}},
+	Exec:    completionExec,
+}
+
+// unexported
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func completionExec(options Options, args []string, databasePath string) (error, warnings) {
+	if options.HasOption("--values") {
+		return completeValues(options.Get("--values").Argument, args, databasePath)
+	}
+
+	if len(args) < 1 {
+		return fmt.Errorf("shell must be specified: one of %v", strings.Join(completionShells, ", ")), nil
+	}
+	if len(args) > 1 {
+		return errTooManyArguments, nil
+	}
+
+	// uses the help command list as the command list cannot reference itself
+	commands := make([]*Command, 0, len(helpCommands))
+	for _, command := range helpCommands {
+		if !command.Hidden {
+			commands = append(commands, command)
+		}
+	}
+
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion(commands)
+	case "zsh":
+		script = zshCompletion(commands)
+	case "fish":
+		script = fishCompletion(commands)
+	default:
+		return fmt.Errorf("unsupported shell '%v': supported shells are %v", args[0], strings.Join(completionShells, ", ")), nil
+	}
+
+	fmt.Print(script)
+
+	return nil, nil
+}
+
+func completeValues(tagName string, args []string, databasePath string) (error, warnings) {
+	if len(args) > 1 {
+		return errTooManyArguments, nil
+	}
+
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	names, err := store.ValueNamesByTagName(tx, tagName, prefix)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values of tag '%v': %v", tagName, err), nil
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+
+	return nil, nil
+}
+
+// the kinds of argument a command accepts, as determined from its usages
+const (
+	filesArgument    = "files"
+	tagsArgument     = "tags"
+	settingsArgument = "settings"
+	commandsArgument = "commands"
+	shellsArgument   = "shells"
+)
+
+var usageArgumentKinds = map[string]string{
+	"FILE":       filesArgument,
+	"PATH":       filesArgument,
+	"DIR":        filesArgument,
+	"MOUNTPOINT": filesArgument,
+	"TAG":        tagsArgument,
+	"IMPL":       tagsArgument,
+	"QUERY":      tagsArgument,
+	"OLD":        tagsArgument,
+	"DEST":       tagsArgument,
+	"NAME":       settingsArgument,
+	"SUBCOMMAND": commandsArgument,
+	"SHELL":      shellsArgument,
+}
+
+var usageWordRegexp = regexp.MustCompile(`[A-Z]+`)
+
+func argumentKinds(command *Command) []string {
+	kinds := make([]string, 0, 2)
+
+	for _, usage := range command.Usages {
+		for _, word := range strings.Fields(usage) {
+			if strings.HasPrefix(strings.TrimLeft(word, "["), "-") {
+				continue
+			}
+
+			kind, ok := usageArgumentKinds[usageWordRegexp.FindString(word)]
+			if ok && !containsTag(kinds, kind) {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+
+	return kinds
+}
+
+var optionChoicesRegexps = []*regexp.Regexp{regexp.MustCompile(`\(([a-z0-9-]+(?:/[a-z0-9-]+)+)\)`),
+	regexp.MustCompile(`: ([a-z0-9-]+(?:, [a-z0-9-]+)+)$`)}
+
+// the permitted arguments of an option, where these are listed in its description
+func optionChoices(option Option) []string {
+	for _, choicesRegexp := range optionChoicesRegexps {
+		if match := choicesRegexp.FindStringSubmatch(option.Description); match != nil {
+			return strings.FieldsFunc(match[1], func(r rune) bool { return r == '/' || r == ',' || r == ' ' })
+		}
+	}
+
+	return nil
+}
+
+func optionNames(options Options, withArgumentOnly bool) []string {
+	names := make([]string, 0, len(options)*2)
+	for _, option := range options {
+		if withArgumentOnly && !option.HasArgument {
+			continue
+		}
+
+		if option.LongName != "" {
+			names = append(names, option.LongName)
+		}
+		if option.ShortName != "" {
+			names = append(names, option.ShortName)
+		}
+	}
+
+	return names
+}
+
+func commandNames(command *Command) []string {
+	return append([]string{command.Name}, command.Aliases...)
+}
+
+// bash
+
+func bashCompletion(commands []*Command) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(`# Bash completion script for tmsu, generated by 'tmsu completion bash'.
+# To enable, add the following to ~/.bashrc:
+#
+#     source <(tmsu completion bash)
+
+_tmsu_query() {
+    tmsu "${_tmsu_db[@]}" "$@" 2>/dev/null
+}
+
+_tmsu_commands() {
+`)
+
+	names := make([]string, 0, len(commands))
+	for _, command := range commands {
+		names = append(names, commandNames(command)...)
+	}
+	fmt.Fprintf(&buffer, "    echo '%v'\n}\n\n", strings.Join(names, " "))
+
+	writeBashCase := func(function string, value func(options Options, command *Command) string) {
+		fmt.Fprintf(&buffer, "%v() {\n    case \"$1\" in\n", function)
+		if text := value(globalOptions, nil); text != "" {
+			fmt.Fprintf(&buffer, "        '') echo '%v' ;;\n", text)
+		}
+		for _, command := range commands {
+			if text := value(command.Options, command); text != "" {
+				fmt.Fprintf(&buffer, "        %v) echo '%v' ;;\n", strings.Join(commandNames(command), "|"), text)
+			}
+		}
+		buffer.WriteString("    esac\n}\n\n")
+	}
+
+	writeBashCase("_tmsu_options", func(options Options, command *Command) string {
+		return strings.Join(optionNames(options, false), " ")
+	})
+	writeBashCase("_tmsu_options_with_arguments", func(options Options, command *Command) string {
+		return strings.Join(optionNames(options, true), " ")
+	})
+	writeBashCase("_tmsu_argument_kinds", func(options Options, command *Command) string {
+		if command == nil {
+			return ""
+		}
+		return strings.Join(argumentKinds(command), " ")
+	})
+
+	buffer.WriteString("_tmsu_option_choices() {\n    case \"$1:$2\" in\n")
+	writeChoices := func(options Options, names []string) {
+		for _, option := range options {
+			choices := optionChoices(option)
+			if len(choices) == 0 {
+				continue
+			}
+
+			patterns := make([]string, 0, 2)
+			for _, name := range []string{option.LongName, option.ShortName} {
+				if name == "" {
+					continue
+				}
+				for _, commandName := range names {
+					patterns = append(patterns, commandName+":"+name)
+				}
+			}
+
+			fmt.Fprintf(&buffer, "        %v) echo '%v' ;;\n", strings.Join(patterns, "|"), strings.Join(choices, " "))
+		}
+	}
+	writeChoices(globalOptions, []string{""})
+	for _, command := range commands {
+		writeChoices(command.Options, commandNames(command))
+	}
+	buffer.WriteString("    esac\n}\n\n")
+
+	buffer.WriteString(`# replies with the words matching the current word, which may follow a prefix
+# that bash treats as a separate word
+_tmsu_reply() {
+    local prefix="$1" cur="$2" words="$3"
+    if [[ $COMP_WORDBREAKS == *=* ]]; then
+        prefix=""
+    fi
+
+    # likewise any colon, such as that of a namespaced tag
+    local broken=""
+    if [[ $COMP_WORDBREAKS == *:* && $prefix$cur == *:* ]]; then
+        broken="$prefix$cur"
+        broken="${broken%"${broken##*:}"}"
+    fi
+
+    local word reply
+    while IFS= read -r word; do
+        if [[ -n $word ]]; then
+            reply="$prefix$word"
+            COMPREPLY+=("${reply#"$broken"}")
+        fi
+    done < <(compgen -W "$words" -- "$cur")
+}
+
+# the tags without a namespace along with the namespaces of the other tags
+_tmsu_tags_and_namespaces() {
+    local tag
+    while IFS= read -r tag; do
+        if [[ $tag =~ ^([^:/]+):. ]]; then
+            echo "${BASH_REMATCH[1]}:"
+        else
+            echo "$tag"
+        fi
+    done < <(_tmsu_query tags -1) | sort -u
+}
+
+_tmsu_complete_option_argument() {
+    local cmd="$1" option="$2" prefix="$3" cur="$4"
+    local choices
+    choices=$(_tmsu_option_choices "$cmd" "$option")
+    if [[ -z $choices ]]; then
+        choices=$(_tmsu_option_choices "" "$option")
+    fi
+
+    if [[ -n $choices ]]; then
+        _tmsu_reply "$prefix" "$cur" "$choices"
+    else
+        compopt -o filenames 2>/dev/null
+        COMPREPLY+=($(compgen -f -- "$cur"))
+    fi
+}
+
+_tmsu_complete_arguments() {
+    local cmd="$1" cur="$2"
+    local kind
+    for kind in $(_tmsu_argument_kinds "$cmd"); do
+        case "$kind" in
+            files)
+                compopt -o filenames 2>/dev/null
+                COMPREPLY+=($(compgen -f -- "$cur"))
+                ;;
+            tags)
+                # the value following the tag and a comparison operator
+                local valuePattern='^([^=<>!]+)([=<>!]*=)(.*)$'
+                if [[ $cur =~ $valuePattern ]]; then
+                    local tag="${BASH_REMATCH[1]}" operator="${BASH_REMATCH[2]}" value="${BASH_REMATCH[3]}"
+                    _tmsu_reply "$tag$operator" "$value" "$(_tmsu_query completion --values="$tag" -- ${value:+"$value"})"
+                elif [[ $cur == *:* ]]; then
+                    _tmsu_reply "" "$cur" "$(_tmsu_query tags -1 --namespace "${cur%%:*}")"
+                else
+                    _tmsu_reply "" "$cur" "$(_tmsu_tags_and_namespaces)"
+                    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *: ]]; then
+                        compopt -o nospace 2>/dev/null
+                    fi
+                fi
+                ;;
+            settings)
+                local settings="" setting
+                while IFS= read -r setting; do
+                    settings+="${setting%%=*} "
+                done < <(_tmsu_query config)
+                _tmsu_reply "" "$cur" "$settings"
+                ;;
+            commands)
+                _tmsu_reply "" "$cur" "$(_tmsu_commands)"
+                ;;
+            shells)
+                _tmsu_reply "" "$cur" 'bash zsh fish'
+                ;;
+        esac
+    done
+}
+
+_tmsu() {
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local -a words
+    read -ra words <<< "$line"
+
+    local cur=""
+    if [[ $line != *[[:space:]] && ${#words[@]} -gt 0 ]]; then
+        cur="${words[${#words[@]}-1]}"
+        unset 'words[${#words[@]}-1]'
+    fi
+
+    local cmd="" option="" word i
+    _tmsu_db=()
+    for ((i = 1; i < ${#words[@]}; i++)); do
+        word="${words[i]}"
+
+        if [[ -n $option ]]; then
+            if [[ $option == -D || $option == --database ]]; then
+                _tmsu_db=(--database="$word")
+            fi
+            option=""
+            continue
+        fi
+
+        case "$word" in
+            --database=*)
+                _tmsu_db=("$word")
+                ;;
+            --*=*)
+                ;;
+            -*)
+                if [[ " $(_tmsu_options_with_arguments "$cmd") $(_tmsu_options_with_arguments "") " == *" $word "* ]]; then
+                    option="$word"
+                fi
+                ;;
+            *)
+                if [[ -z $cmd ]]; then
+                    cmd="$word"
+                fi
+                ;;
+        esac
+    done
+
+    COMPREPLY=()
+
+    if [[ -n $option ]]; then
+        _tmsu_complete_option_argument "$cmd" "$option" "" "$cur"
+        return
+    fi
+
+    case "$cur" in
+        --*=*)
+            _tmsu_complete_option_argument "$cmd" "${cur%%=*}" "${cur%%=*}=" "${cur#*=}"
+            ;;
+        -*)
+            _tmsu_reply "" "$cur" "$(_tmsu_options "$cmd")"
+            ;;
+        *)
+            if [[ -z $cmd ]]; then
+                _tmsu_reply "" "$cur" "$(_tmsu_commands)"
+            else
+                _tmsu_complete_arguments "$cmd" "$cur"
+            fi
+            ;;
+    esac
+}
+
+complete -F _tmsu tmsu
+`)
+
+	return buffer.String()
+}
+
+// zsh
+
+func zshCompletion(commands []*Command) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(`#compdef tmsu
+
+# Zsh completion script for tmsu, generated by 'tmsu completion zsh'. Write
+# this to a file named '_tmsu' in your Zsh function path, e.g.:
+#
+#     tmsu completion zsh >/usr/share/zsh/site-functions/_tmsu
+
+_tmsu_query() {
+    tmsu "${_tmsu_db[@]}" "$@" 2>/dev/null
+}
+
+_tmsu_commands() {
+    local -a commands
+    commands=(
+`)
+
+	for _, command := range commands {
+		for _, name := range commandNames(command) {
+			fmt.Fprintf(&buffer, "        %v\n", zshQuote(name+":"+command.Synopsis))
+		}
+	}
+
+	buffer.WriteString(`    )
+
+    _describe -t commands 'command' commands
+}
+
+_tmsu_tags() {
+    setopt localoptions extendedglob
+
+    # the value following the tag and a comparison operator
+    if compset -P '[^=<>!]##[=<>!]#='; then
+        local -a values
+        values=(${(f)"$(_tmsu_query completion --values=${IPREFIX%%[=<>!]#=} -- $PREFIX)"})
+        _wanted values expl 'value' compadd -a values
+    elif compset -P '[^:/]##:'; then
+        local -a tags
+        tags=(${${(f)"$(_tmsu_query tags -1 --namespace ${IPREFIX%:})"}#*:})
+        _wanted tags expl 'tag' compadd -a tags
+    else
+        local -a tags namespaces
+        local ret=1
+        tags=(${(f)"$(_tmsu_query tags -1)"})
+        namespaces=(${(u)${(M)tags:#[^:/]##:?*}%%:*})
+        tags=(${tags:#[^:/]##:?*})
+        _wanted tags expl 'tag' compadd -a tags && ret=0
+        _wanted namespaces expl 'namespace' compadd -S ':' -a namespaces && ret=0
+        return ret
+    fi
+}
+
+_tmsu_settings() {
+    local -a settings
+    settings=(${${(f)"$(_tmsu_query config)"}%%=*})
+    _wanted settings expl 'setting' compadd -a settings
+}
+
+_tmsu_shells() {
+    _wanted shells expl 'shell' compadd bash zsh fish
+}
+
+`)
+
+	kindActions := map[string]string{
+		filesArgument:    "files:file:_files",
+		tagsArgument:     "tags:tag:_tmsu_tags",
+		settingsArgument: "settings:setting:_tmsu_settings",
+		commandsArgument: "commands:command:_tmsu_commands",
+		shellsArgument:   "shells:shell:_tmsu_shells",
+	}
+
+	for _, command := range commands {
+		fmt.Fprintf(&buffer, "_tmsu_cmd_%v() {\n    _arguments -s -w", command.Name)
+
+		for _, option := range command.Options {
+			fmt.Fprintf(&buffer, " \\\n        %v", zshOptionSpec(option))
+		}
+
+		kinds := argumentKinds(command)
+		if len(kinds) > 0 {
+			alternatives := make([]string, len(kinds))
+			for index, kind := range kinds {
+				alternatives[index] = kindActions[kind]
+			}
+
+			fmt.Fprintf(&buffer, " \\\n        %v", zshQuote("*: :_alternative "+strings.Join(alternatives, " ")))
+		}
+
+		buffer.WriteString(" \\\n    && ret=0\n}\n\n")
+	}
+
+	buffer.WriteString("_tmsu() {\n    local curcontext=\"$curcontext\" state line ret=1\n    typeset -A opt_args\n\n    _arguments -C")
+	for _, option := range globalOptions {
+		fmt.Fprintf(&buffer, " \\\n        %v", zshOptionSpec(option))
+	}
+	buffer.WriteString(` \
+        ': :_tmsu_commands' \
+        '*:: :->command' \
+    && ret=0
+
+    case $state in
+        (command)
+            _tmsu_db=()
+            if [[ -n ${opt_args[--database]:-${opt_args[-D]}} ]]; then
+                _tmsu_db=(--database=${~opt_args[--database]:-${opt_args[-D]}})
+            fi
+
+            curcontext="${curcontext%:*:*}:tmsu-$words[1]:"
+
+            case $words[1] in
+`)
+
+	for _, command := range commands {
+		fmt.Fprintf(&buffer, "                (%v) _tmsu_cmd_%v ;;\n", strings.Join(commandNames(command), "|"), command.Name)
+	}
+
+	buffer.WriteString(`            esac
+            ;;
+    esac
+
+    return ret
+}
+
+_tmsu "$@"
+`)
+
+	return buffer.String()
+}
+
+func zshOptionSpec(option Option) string {
+	description := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(option.Description)
+
+	argument := ""
+	if option.HasArgument {
+		if choices := optionChoices(option); len(choices) > 0 {
+			argument = ":argument:(" + strings.Join(choices, " ") + ")"
+		} else {
+			argument = ":argument:_files"
+		}
+	}
+
+	switch {
+	case option.LongName != "" && option.ShortName != "":
+		longName, shortName := option.LongName, option.ShortName
+		if option.HasArgument {
+			longName += "="
+			shortName += "+"
+		}
+
+		return fmt.Sprintf("'(%v %v)'{%v,%v}%v", option.LongName, option.ShortName, longName, shortName, zshQuote("["+description+"]"+argument))
+	case option.LongName != "":
+		name := option.LongName
+		if option.HasArgument {
+			name += "="
+		}
+
+		return zshQuote(name + "[" + description + "]" + argument)
+	default:
+		name := option.ShortName
+		if option.HasArgument {
+			name += "+"
+		}
+
+		return zshQuote(name + "[" + description + "]" + argument)
+	}
+}
+
+func zshQuote(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
+
+// fish
+
+func fishCompletion(commands []*Command) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(`# Fish completion script for tmsu, generated by 'tmsu completion fish'. To
+# enable, write this to ~/.config/fish/completions/tmsu.fish or run:
+#
+#     tmsu completion fish | source
+
+function __tmsu_query
+    set -l db
+    set -l tokens (commandline -opc)
+    for index in (seq (count $tokens))
+        switch $tokens[$index]
+            case '--database=*'
+                set db $tokens[$index]
+            case -D --database
+                set -l next (math $index + 1)
+                if test $next -le (count $tokens)
+                    set db --database=$tokens[$next]
+                end
+        end
+    end
+
+    tmsu $db $argv 2>/dev/null
+end
+
+function __tmsu_tags
+    set -l token (commandline -ct)
+    # the value following the tag and a comparison operator
+    if set -l match (string match -r -- '^([^=<>!]+)([=<>!]*=)(.*)$' $token)
+        for value in (__tmsu_query completion --values=$match[2])
+            echo $match[2]$match[3]$value
+        end
+    else if string match -q -- '*:*' $token
+        __tmsu_query tags -1 --namespace (string split -m 1 : -- $token)[1]
+    else
+        __tmsu_query tags -1 | string replace -r '^([^:/]+):.+$' '$1:' | sort -u
+    end
+end
+
+function __tmsu_settings
+    __tmsu_query config | string replace -r '=.*' ''
+end
+
+complete -c tmsu -f
+`)
+
+	names := make([]string, 0, len(commands))
+	for _, command := range commands {
+		names = append(names, commandNames(command)...)
+	}
+	noCommand := "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+
+	for _, option := range globalOptions {
+		fmt.Fprintf(&buffer, "complete -c tmsu %v\n", fishOptionSpec(option))
+	}
+
+	for _, command := range commands {
+		for _, name := range commandNames(command) {
+			fmt.Fprintf(&buffer, "complete -c tmsu -n %v -a %v -d %v\n", fishQuote(noCommand), name, fishQuote(command.Synopsis))
+		}
+	}
+
+	kindArguments := map[string]string{
+		filesArgument:    "-F",
+		tagsArgument:     "-a '(__tmsu_tags)'",
+		settingsArgument: "-a '(__tmsu_settings)'",
+		commandsArgument: "-a " + fishQuote(strings.Join(names, " ")),
+		shellsArgument:   "-a 'bash zsh fish'",
+	}
+
+	for _, command := range commands {
+		condition := fishQuote("__fish_seen_subcommand_from " + strings.Join(commandNames(command), " "))
+
+		for _, option := range command.Options {
+			fmt.Fprintf(&buffer, "complete -c tmsu -n %v %v\n", condition, fishOptionSpec(option))
+		}
+
+		for _, kind := range argumentKinds(command) {
+			fmt.Fprintf(&buffer, "complete -c tmsu -n %v %v\n", condition, kindArguments[kind])
+		}
+	}
+
+	return buffer.String()
+}
+
+func fishOptionSpec(option Option) string {
+	spec := make([]string, 0, 4)
+
+	if option.LongName != "" {
+		spec = append(spec, "-l "+strings.TrimPrefix(option.LongName, "--"))
+	}
+	if option.ShortName != "" {
+		spec = append(spec, "-s "+strings.TrimPrefix(option.ShortName, "-"))
+	}
+
+	if option.HasArgument {
+		if choices := optionChoices(option); len(choices) > 0 {
+			spec = append(spec, "-x -a "+fishQuote(strings.Join(choices, " ")))
+		} else {
+			spec = append(spec, "-r -F")
+		}
+	}
+
+	spec = append(spec, "-d "+fishQuote(option.Description))
+
+	return strings.Join(spec, " ")
+}
+
+func fishQuote(text string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(text) + "'"
+}
@@ -17,27 +17,102 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/collation"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/vfs"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var ConfigCommand = Command{
 	Name:     "config",
 	Synopsis: "Views or amends database settings",
-	Usages: []string{"tmsu config",
-		"tmsu config NAME[=VALUE]..."},
+	Usages: []string{"tmsu config [OPTION]... [list]",
+		"tmsu config [OPTION]... get NAME...",
+		"tmsu config [OPTION]... set NAME VALUE",
+		"tmsu config [OPTION]... NAME[=VALUE]...",
+		"tmsu config [OPTION]... --fingerprint-algorithm=ALGORITHM"},
 	Description: `Lists or views the database settings for the current database.
 
-Without arguments the complete set of settings are shown, otherwise lists the settings for the specified setting NAMEs.
+Without arguments, or with 'list', the complete set of settings are shown, otherwise lists the settings for the specified setting NAMEs. 'get' shows just the values of the settings.
 
-If a VALUE is specified then the setting is updated.`,
-	Options: Options{},
-	Exec:    configExec,
+If a VALUE is specified, or 'set' is used, then the setting is updated.
+
+Settings that are not set in the database take their values from the global configuration file, ~/.tmsu/config or that named by TMSU_CONFIG, and otherwise from the defaults. The file has one NAME=VALUE setting per line: blank lines and those beginning with '#' are ignored. With --global the settings of this file are shown or amended instead of those of the database, without the need for a database.
+
+The --fingerprint-algorithm option is a shorthand for updating the 'fileFingerprintAlgorithm' setting. Supported algorithms are: ` + strings.Join(fingerprint.FileAlgorithms, ", ") + ` and sparse:HASH[:MB]. The 'dynamic:' algorithms fingerprint only parts of files larger than 5MB. The 'sparse:' algorithms fingerprint only the first and last MB megabytes (default 16) of larger files, together with the file size, which greatly speeds up fingerprinting of very large files. When identifying duplicates, files whose fingerprints match are compared in full where their fingerprints are based upon only part of the files. The 'command' algorithm runs the external program given by the 'fingerprintCommand' setting instead. Changing the algorithm does not affect the fingerprints already in the database: use the 'refingerprint' subcommand to recalculate them.
+
+The 'auditLog' setting, when enabled, appends a line to the '` + storage.AuditLogName + `' file beside the database for every change made to it, recording when it was made, by whom, the command that made it and how many rows of each table it inserted, updated and deleted. Use the 'log' subcommand to view it.
+
+The 'backupRetention' setting determines how many automatic backups of the database are kept in the '` + storage.BackupDirectoryName + `' directory beside it, 10 by default, the oldest being removed first. The database is backed up before the 'delete', 'dedupe' and 'merge' subcommands and before 'untag' is applied to several files, and also whenever it is opened once the 'backupInterval' setting, e.g. '24h', has elapsed since the latest backup, unless this is 'none' (the default). A retention of 0 disables automatic backups. Use the 'restore' subcommand to list the backups or restore one.
+
+The 'canonicalPaths' setting, when enabled, resolves the directory of each path through any symbolic links before it is stored or looked up, so that a file reached through a linked directory is not added a second time under a different path. The file itself is not resolved, so that a symbolic link is still tagged as itself. Paths are always cleaned, so that './photo.jpg' and 'photo.jpg' are the same file. Changing the setting does not affect the paths already stored: use the 'repath' subcommand to convert them and 'doctor --fix' to merge entries that then refer to the same file.
+
+The 'collation' setting determines the order in which tag, value and file names are listed. 'binary', the default, orders them by their characters' code points, so that 'Zebra' precedes 'apple' and 'élan' follows 'zoo'. 'unicode' orders them alphabetically regardless of case and accents, which only break ties. A language code, such as 'sv', 'da' or 'es', additionally orders the letters particular to that language's alphabet as it does, and 'system' uses the language of the LC_ALL, LC_COLLATE or LANG environment variable. Exports are always in binary order.
+
+The 'defaultSort' setting determines the order in which the 'files' subcommand lists files when --sort is not specified: one of ` + strings.Join(fileSortTypes, ", ") + `. Where several databases are queried it is taken from the first.
+
+The 'directoryFingerprintAlgorithm' setting determines how directories are fingerprinted. Supported algorithms are: ` + strings.Join(fingerprint.DirectoryAlgorithms, ", ") + `. The 'contents' algorithm derives a directory's fingerprint from the names and fingerprints of everything beneath it, so that directories share a fingerprint only where their entire trees are identical. The 'sumSizes' algorithms add together the sizes of the files beneath the directory, the 'dynamic:' variant considering only the first 500 files.
+
+The 'fingerprintCommand' setting specifies the program run to fingerprint each file when the file fingerprint algorithm is 'command', e.g. 'phash %path' for perceptual image hashing or 'ssdeep -b %path'. The placeholder ` + fingerprint.CommandPathPlaceholder + ` is replaced with the path of the file, which is otherwise appended to the command. The program's output, less surrounding whitespace, becomes the fingerprint, prefixed with the program's name, so that files which the program considers alike, such as visually similar images, are reported together by the 'dupes' subcommand. The 'dedupe' subcommand removes only those copies that are also identical byte for byte.
+
+The 'followSymlinks' setting determines whether symbolic links are followed, both when identifying the file to tag and when traversing directories, by commands such as 'tag', 'untag', 'tags', 'status' and 'untagged'. It may be overridden with the global --follow-symlinks and --no-follow-symlinks options or the commands' own --no-dereference option.
+
+The 'ignoreTagCase' and 'normalizeTagNames' settings determine whether tag names are matched regardless of case and of Unicode normalization, such that 'Photo' and 'photo' refer to the same tag, as do 'café' written with a precomposed 'é' and with an 'e' followed by a combining accent. When normalizing, new tag names are stored in normalization form C. Tags that already differ only in this way may be merged with 'tmsu merge --variants'.
+
+The 'openHandlers' setting determines the commands with which the 'open' subcommand opens files of particular MIME types, e.g. 'image/*=feh;video/*=mpv --fullscreen'.
+
+The 'readOnly' setting, when enabled, makes every subcommand refuse to change the database, as does the global --read-only option, whilst queries continue to work. A database that is read-only is neither upgraded to a newer schema nor backed up, and the virtual filesystem is mounted read-only. The setting itself may still be disabled with 'tmsu config readOnly=no'.
+
+The 'recursiveTagLimit' setting determines the greatest number of files that 'tag --recursive' tags without --force, 10000 by default, so that an entire drive is not tagged by accident. A limit of 0 removes it.
+
+The 'relativePaths' setting determines whether the paths of files beneath the database's root path are stored relative to it, so that the database remains valid when the collection is moved to a different mount point, or as absolute paths. Changing the setting does not affect the paths already stored: use the 'repath' subcommand to convert them.
+
+The 'sidecars' setting determines whether each file's tags are mirrored to sidecar files, for the benefit of other tools, whenever they change: 'none' (the default), 'file' to write a FILE` + storage.SidecarExtension + ` beside each file with a TAG or TAG<TAB>VALUE per line, or 'directory' to write a '` + storage.DirectorySidecarName + `' file in each directory with a NAME<TAB>TAG[<TAB>VALUE] row for each tag of each file in it. Tabs, newlines and backslashes are escaped as \t, \n and \\. Sidecars are removed once the files have no tags. Use 'tmsu import --sidecars' to read tags back from them.
+
+The 'tagByContent' setting determines whether tags are applied to the contents of files, as identified by their fingerprints, rather than to their paths. Tagging or untagging a file then also tags or untags the other files with the same contents, and a copy of a file takes on its tags when it is added to the database, even if every earlier copy has since been removed. Files whose fingerprints are empty, such as directories when not fingerprinted, are tagged by path. Tags already applied when the setting is enabled are carried over to copies added afterwards.
+
+The 'trackInodes' setting, when enabled, records the device and inode number of each file as it is added to or updated in the database. The 'repair' subcommand uses these to recognise a file that has been renamed or moved within the same file system, even amongst many files of the same size, without fingerprinting it. It is not supported on Windows.
+
+The 'vfsFileNameTemplate' setting determines how files are named within the virtual filesystem. The placeholders {name}, {ext} and {id} are replaced with the file name less its extension, the extension and the file ID, whilst any other placeholder, such as {year}, is replaced with the file's value for that tag. The default is {name}.{id}.{ext}. Files whose names would clash are named using the default template.
+
+The 'vfsInboxTags' setting lists the tags, as TAG or TAG=VALUE separated by spaces, given to the files linked into the 'inbox' directory of a virtual filesystem mounted with --inbox, 'inbox' by default.
+
+The 'vfsRecentDays' setting determines how many days back the 'recent' directory of the virtual filesystem looks for files that were tagged, 7 by default.`,
+	Examples: []string{"$ tmsu config",
+		"$ tmsu config fileFingerprintAlgorithm",
+		"$ tmsu config get defaultSort",
+		"$ tmsu config set defaultSort mtime",
+		"$ tmsu config --global set followSymlinks no",
+		"$ tmsu config --fingerprint-algorithm=BLAKE2b",
+		"$ tmsu config --fingerprint-algorithm=sparse:SHA256:64",
+		"$ tmsu config fingerprintCommand='phash %path' fileFingerprintAlgorithm=command",
+		"$ tmsu config vfsFileNameTemplate='{year}-{name}.{ext}'"},
+	Options: Options{{"--fingerprint-algorithm", "", "set the file fingerprint algorithm", true, ""},
+		{"--global", "-g", "view or amend the global configuration file", false, ""}},
+	Exec: configExec,
 }
 
 // unexported
 
 func configExec(options Options, args []string, databasePath string) (error, warnings) {
+	verb, args, err := parseConfigVerb(args)
+	if err != nil {
+		return err, nil
+	}
+
+	if options.HasOption("--global") {
+		return globalConfigExec(options, verb, args)
+	}
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -50,34 +125,174 @@ func configExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	if options.HasOption("--fingerprint-algorithm") {
+		algorithm := options.Get("--fingerprint-algorithm").Argument
+
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+
+		if err := amendSetting(store, tx, "fileFingerprintAlgorithm", algorithm); err != nil {
+			return fmt.Errorf("could not amend setting 'fileFingerprintAlgorithm' to '%v': %w", algorithm, err), nil
+		}
+
+		if len(args) == 0 {
+			return nil, nil
+		}
+	}
+
 	if len(args) == 0 {
 		if err := listAllSettings(store, tx); err != nil {
 			return fmt.Errorf("could not list settings"), nil
 		}
 	}
 
-	if len(args) == 1 && strings.Index(args[0], "=") == -1 {
-		printSettingValue(store, tx, args[0])
+	if verb == "get" || len(args) == 1 && strings.Index(args[0], "=") == -1 {
+		for _, name := range args {
+			if err := printSettingValue(store, tx, name); err != nil {
+				return fmt.Errorf("could not show value for setting '%v': %w", name, err), nil
+			}
+		}
+
 		return nil, nil
 	}
 
 	for _, arg := range args {
-		parts := strings.Split(arg, "=")
+		parts := strings.SplitN(arg, "=", 2)
 		switch len(parts) {
 		case 1:
 			name := parts[0]
 			if err := printSetting(store, tx, name); err != nil {
-				return fmt.Errorf("could not show value for setting '%v': %v", name, err), nil
+				return fmt.Errorf("could not show value for setting '%v': %w", name, err), nil
 			}
 		case 2:
 			name := parts[0]
 			value := parts[1]
 
-			if err := amendSetting(store, tx, name, value); err != nil {
-				return fmt.Errorf("could not amend setting '%v' to '%v': %v", name, value, err), nil
+			// the setting that made the database read-only must itself remain
+			// amendable, else it could never be disabled
+			wasReadOnly := store.ReadOnly()
+			if name == "readOnly" && !readOnly {
+				store.SetReadOnly(false)
+			}
+
+			if err := refuseIfStoreReadOnly(store); err != nil {
+				store.SetReadOnly(wasReadOnly)
+				return err, nil
+			}
+
+			err := amendSetting(store, tx, name, value)
+			store.SetReadOnly(wasReadOnly)
+			if err != nil {
+				return fmt.Errorf("could not amend setting '%v' to '%v': %w", name, value, err), nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// separates the 'list', 'get' or 'set' verb, if any, from the arguments, which
+// for 'set' are rewritten in the NAME=VALUE form
+func parseConfigVerb(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", args, nil
+	}
+
+	verb := args[0]
+	args = args[1:]
+
+	switch verb {
+	case "list":
+		if len(args) > 0 {
+			return "", nil, errTooManyArguments
+		}
+	case "get":
+		if len(args) == 0 {
+			return "", nil, fmt.Errorf("setting name must be specified")
+		}
+	case "set":
+		switch {
+		case len(args) == 0:
+			return "", nil, fmt.Errorf("setting name must be specified")
+		case len(args) == 2 && strings.Index(args[0], "=") == -1:
+			args = []string{args[0] + "=" + args[1]}
+		}
+
+		for _, arg := range args {
+			if strings.Index(arg, "=") == -1 {
+				return "", nil, fmt.Errorf("setting '%v' value must be specified", arg)
+			}
+		}
+	default:
+		return "", append([]string{verb}, args...), nil
+	}
+
+	return verb, args, nil
+}
+
+func globalConfigExec(options Options, verb string, args []string) (error, warnings) {
+	if options.HasOption("--fingerprint-algorithm") {
+		algorithm := options.Get("--fingerprint-algorithm").Argument
+
+		if err := amendGlobalSetting("fileFingerprintAlgorithm", algorithm); err != nil {
+			return fmt.Errorf("could not amend setting 'fileFingerprintAlgorithm' to '%v': %w", algorithm, err), nil
+		}
+
+		if len(args) == 0 {
+			return nil, nil
+		}
+	}
+
+	globals, err := globalSettings()
+	if err != nil {
+		return err, nil
+	}
+
+	settings := storage.DefaultSettings()
+	for _, setting := range settings {
+		if globals.ContainsName(setting.Name) {
+			setting.Value = globals.Value(setting.Name)
+		}
+	}
+
+	if len(args) == 0 {
+		for _, setting := range settings {
+			printSettingAndValue(setting.Name, setting.Value)
+		}
+
+		return nil, nil
+	}
+
+	if verb == "get" || len(args) == 1 && strings.Index(args[0], "=") == -1 {
+		for _, name := range args {
+			if !settings.ContainsName(name) {
+				return fmt.Errorf("could not show value for setting '%v': no such setting '%v'", name, name), nil
+			}
+
+			fmt.Println(settings.Value(name))
+		}
+
+		return nil, nil
+	}
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		switch len(parts) {
+		case 1:
+			name := parts[0]
+			if !settings.ContainsName(name) {
+				return fmt.Errorf("could not show value for setting '%v': no such setting '%v'", name, name), nil
+			}
+
+			printSettingAndValue(name, settings.Value(name))
+		case 2:
+			name := parts[0]
+			value := parts[1]
+
+			if err := amendGlobalSetting(name, value); err != nil {
+				return fmt.Errorf("could not amend setting '%v' to '%v': %w", name, value, err), nil
 			}
-		default:
-			return fmt.Errorf("invalid argument, '%v'", arg), nil
 		}
 	}
 
@@ -87,7 +302,7 @@ func configExec(options Options, args []string, databasePath string) (error, war
 func listAllSettings(store *storage.Storage, tx *storage.Tx) error {
 	settings, err := store.Settings(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve settings: %v", err)
+		return fmt.Errorf("could not retrieve settings: %w", err)
 	}
 
 	for _, setting := range settings {
@@ -138,24 +353,247 @@ func printSettingAndValue(name, value string) {
 }
 
 func amendSetting(store *storage.Storage, tx *storage.Tx, name, value string) error {
+	if err := validateSetting(name, value); err != nil {
+		return err
+	}
+
+	setting, err := store.Setting(tx, name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve setting '%v'", err)
+	}
+
+	if _, err = store.UpdateSetting(tx, name, value); err != nil {
+		return fmt.Errorf("could not update setting '%v': %w", name, err)
+	}
+
+	if (name == "fileFingerprintAlgorithm" || name == "directoryFingerprintAlgorithm" || name == "fingerprintCommand") && value != setting.Value {
+		count, err := store.FileCount(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file count: %w", err)
+		}
+		if count > 0 {
+			log.Warnf("existing fingerprints are unchanged: use 'tmsu refingerprint' to recalculate them")
+		}
+	}
+
+	if (name == "relativePaths" || name == "canonicalPaths") && value != setting.Value {
+		count, err := store.FileCount(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file count: %w", err)
+		}
+		if count > 0 {
+			log.Warnf("existing paths are unchanged: use 'tmsu repath' to convert them")
+		}
+	}
+
+	return nil
+}
+
+func validateSetting(name, value string) error {
 	if name == "" {
 		return fmt.Errorf("setting name must be specified")
 	}
 	if value == "" {
 		return fmt.Errorf("setting '%v' value must be specified", name)
 	}
+	if !storage.DefaultSettings().ContainsName(name) {
+		return fmt.Errorf("no such setting '%v'", name)
+	}
 
-	setting, err := store.Setting(tx, name)
+	switch name {
+	case "backupInterval":
+		if value == "none" {
+			break
+		}
+		if interval, err := time.ParseDuration(value); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be 'none' or a duration such as '24h'", value, name)
+		}
+	case "backupRetention":
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be a number of backups", value, name)
+		}
+	case "recursiveTagLimit":
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be a number of files", value, name)
+		}
+	case "collation":
+		if err := collation.Validate(value); err != nil {
+			return err
+		}
+	case "defaultSort":
+		if !isFileSortType(value) {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be one of %v", value, name, strings.Join(fileSortTypes, ", "))
+		}
+	case "fileFingerprintAlgorithm":
+		if err := fingerprint.ValidateFileAlgorithm(value); err != nil {
+			return err
+		}
+	case "directoryFingerprintAlgorithm":
+		if err := fingerprint.ValidateDirectoryAlgorithm(value); err != nil {
+			return err
+		}
+	case "fingerprintCommand":
+		if err := fingerprint.ValidateCommand(value); err != nil {
+			return fmt.Errorf("invalid value '%v' for setting '%v': %w", value, name, err)
+		}
+	case "auditLog", "autoCreateTags", "autoCreateValues", "canonicalPaths", "followSymlinks", "ignoreTagCase", "normalizeTagNames", "readOnly", "relativePaths", "reportDuplicates", "tagByContent", "trackInodes":
+		switch value {
+		case "yes", "Yes", "YES", "true", "True", "TRUE", "no", "No", "false", "False", "FALSE":
+		default:
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be 'yes' or 'no'", value, name)
+		}
+	case "sidecars":
+		switch value {
+		case storage.NoSidecars, storage.FileSidecars, storage.DirectorySidecars:
+		default:
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be one of %v", value, name, strings.Join(storage.SidecarFormats, ", "))
+		}
+	case "openHandlers":
+		if _, err := parseOpenHandlers(value); err != nil {
+			return err
+		}
+	case "vfsFileNameTemplate":
+		if _, err := vfs.ParseFileNameTemplate(value); err != nil {
+			return err
+		}
+	case "vfsInboxTags":
+		if err := vfs.ValidateInboxTags(value); err != nil {
+			return err
+		}
+	case "vfsRecentDays":
+		if days, err := strconv.ParseUint(value, 10, 32); err != nil || days == 0 {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be a number of days", value, name)
+		}
+	}
+
+	return nil
+}
+
+// the global configuration file, which is ~/.tmsu/config unless TMSU_CONFIG is set
+func globalConfigPath() (string, error) {
+	if path := os.Getenv("TMSU_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	u, err := user.Current()
 	if err != nil {
-		return fmt.Errorf("could not retrieve setting '%v'", err)
+		return "", fmt.Errorf("could not identify current user: %w", err)
 	}
-	if setting == nil {
-		return fmt.Errorf("no such setting '%v'", name)
+
+	return filepath.Join(u.HomeDir, ".tmsu", "config"), nil
+}
+
+var cachedGlobalSettings entities.Settings
+
+// the settings of the global configuration file, which need not exist
+func globalSettings() (entities.Settings, error) {
+	if cachedGlobalSettings != nil {
+		return cachedGlobalSettings, nil
 	}
 
-	if _, err = store.UpdateSetting(tx, name, value); err != nil {
-		return fmt.Errorf("could not update setting '%v': %v", name, err)
+	path, err := globalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof(2, "reading global configuration '%v'", path)
+
+	lines, err := readGlobalConfigLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(entities.Settings, 0, len(lines))
+	for index, line := range lines {
+		name, value, ok := parseGlobalConfigLine(line)
+		if !ok {
+			continue
+		}
+		if name == "" || value == "" {
+			return nil, fmt.Errorf("%v:%v: expected NAME=VALUE", path, index+1)
+		}
+		if !storage.DefaultSettings().ContainsName(name) {
+			log.Warnf("%v:%v: unknown setting '%v'", path, index+1, name)
+			continue
+		}
+		if err := validateSetting(name, value); err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", path, index+1, err)
+		}
+
+		settings = append(settings, &entities.Setting{name, value})
+	}
+
+	cachedGlobalSettings = settings
+
+	return settings, nil
+}
+
+// updates the setting in the global configuration file, replacing the line on
+// which it is set, if any, so that comments are preserved
+func amendGlobalSetting(name, value string) error {
+	if err := validateSetting(name, value); err != nil {
+		return err
+	}
+
+	path, err := globalConfigPath()
+	if err != nil {
+		return err
 	}
 
+	lines, err := readGlobalConfigLines(path)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for index, line := range lines {
+		if lineName, _, ok := parseGlobalConfigLine(line); ok && lineName == name {
+			lines[index] = name + "=" + value
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		lines = append(lines, name+"="+value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create directory for '%v': %w", path, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("could not write global configuration: %w", err)
+	}
+
+	cachedGlobalSettings = nil
+
 	return nil
 }
+
+func readGlobalConfigLines(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not read global configuration: %w", err)
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// the setting on the line, unless it is blank or a comment
+func parseGlobalConfigLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", true
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
@@ -0,0 +1,75 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	term "golang.org/x/crypto/ssh/terminal"
+	"os"
+	"strings"
+)
+
+// the option by which the subcommands that ask for confirmation are told not to
+var yesOption = Option{"--yes", "-y", "do not ask for confirmation", false, ""}
+
+// the number of files a deletion or merge must affect before it asks for
+// confirmation
+const confirmationFileCount = 100
+
+// Asks whether to proceed with a change, unless --yes was specified, listing the
+// impact of the change and then the question on standard error and reading the
+// answer from standard input. An answer may be piped in, e.g. 'echo y |', but if
+// standard input is not a terminal and gives no answer then an error is returned
+// so that a script is not left to assume that the change was made.
+func confirm(options Options, impact []string, question string) (bool, error) {
+	if options.HasOption("--yes") {
+		return true, nil
+	}
+
+	for _, line := range impact {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	fmt.Fprintf(os.Stderr, "%v [y/N] ", question)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr)
+
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return false, errConfirmationRequired
+		}
+
+		return false, nil
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
+
+// the impact of a change affecting the named items, one line per item, such as
+// 'music: 1204 file(s)', together with the total number of files affected
+func fileCountImpact(names []string, fileCounts []uint) ([]string, uint) {
+	impact := make([]string, len(names))
+	total := uint(0)
+
+	for index, name := range names {
+		impact[index] = fmt.Sprintf("%v: %v file(s)", escape(name, '=', ' '), fileCounts[index])
+		total += fileCounts[index]
+	}
+
+	return impact, total
+}
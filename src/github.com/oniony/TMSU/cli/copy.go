@@ -36,7 +36,7 @@ var CopyCommand = Command{
 
 func copyExec(options Options, args []string, databasePath string) (error, warnings) {
 	if len(args) < 2 {
-		return fmt.Errorf("too few arguments"), nil
+		return errTooFewArguments, nil
 	}
 
 	sourceTagName := parseTagOrValueName(args[0])
@@ -58,9 +58,13 @@ func copyExec(options Options, args []string, databasePath string) (error, warni
 	}
 	defer tx.Commit()
 
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
 	sourceTag, err := store.TagByName(tx, sourceTagName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err), nil
+		return fmt.Errorf("could not retrieve tag '%v': %w", sourceTagName, err), nil
 	}
 	if sourceTag == nil {
 		return fmt.Errorf("no such tag '%v'", sourceTagName), nil
@@ -71,17 +75,17 @@ func copyExec(options Options, args []string, databasePath string) (error, warni
 	for _, destTagName := range destTagNames {
 		destTag, err := store.TagByName(tx, destTagName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %w", destTagName, err), warnings
 		}
 		if destTag != nil {
-			warnings = append(warnings, fmt.Sprintf("a tag with name '%v' already exists", destTagName))
+			warnings = append(warnings, fmt.Errorf("a tag with name '%v' already exists", destTagName))
 			continue
 		}
 
 		log.Infof(2, "copying tag '%v' to '%v'.", sourceTagName, destTagName)
 
 		if _, err = store.CopyTag(tx, sourceTag.Id, destTagName); err != nil {
-			return fmt.Errorf("could not copy tag '%v' to '%v': %v", sourceTagName, destTagName, err), warnings
+			return fmt.Errorf("could not copy tag '%v' to '%v': %w", sourceTagName, destTagName, err), warnings
 		}
 	}
 
@@ -0,0 +1,111 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+var CopyTagsCommand = Command{
+	Name:     "copy-tags",
+	Synopsis: "Copy the tags of one file to others",
+	Usages:   []string{"tmsu copy-tags [OPTION]... SOURCE DEST..."},
+	Description: `Applies the tags, and their values, explicitly applied to SOURCE to each DEST. The tags implied by these are implied for each DEST in turn.
+
+When --move is specified the tags are removed from SOURCE once they have been copied, transferring them to the DEST files. The changes are made within a single transaction so either every file is updated or none is.`,
+	Examples: []string{"$ tmsu copy-tags report.pdf report-final.pdf",
+		"$ tmsu copy-tags --move IMG_0001.jpg holiday.jpg"},
+	Options: Options{{"--move", "-m", "remove the tags from SOURCE once copied", false, ""},
+		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (copy the tags of and to the links themselves)", false, ""}},
+	Exec: copyTagsExec,
+}
+
+// unexported
+
+func copyTagsExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 2 {
+		return errTooFewArguments, nil
+	}
+
+	move := options.HasOption("--move")
+	explicit := options.HasOption("--explicit")
+
+	sourcePath, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", args[0], err), nil
+	}
+
+	destPaths := args[1:]
+	if move {
+		for _, destPath := range destPaths {
+			absDestPath, err := filepath.Abs(destPath)
+			if err != nil {
+				return fmt.Errorf("%v: could not get absolute path: %w", destPath, err), nil
+			}
+
+			if absDestPath == sourcePath {
+				return fmt.Errorf("%v: cannot move tags to the source file", destPath), nil
+			}
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	if err := beginOperation(store, tx); err != nil {
+		tx.Rollback()
+		return err, nil
+	}
+
+	err, warnings := tagFrom(store, tx, sourcePath, destPaths, explicit, false, false, false, false, followSymlinks, false, 1)
+	if err != nil {
+		tx.Rollback()
+		return err, warnings
+	}
+	if len(warnings) > 0 {
+		// leave every file as it was rather than moving tags to only some of the destinations
+		tx.Rollback()
+		return nil, warnings
+	}
+
+	if move {
+		if err, untagWarnings := untagPathsAll(store, tx, []string{sourcePath}, false, false, followSymlinks); err != nil {
+			tx.Rollback()
+			return err, append(warnings, untagWarnings...)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err, warnings
+	}
+
+	return nil, warnings
+}
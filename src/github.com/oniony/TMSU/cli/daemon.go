@@ -0,0 +1,190 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/dbus"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/libtmsu"
+)
+
+var DaemonCommand = Command{
+	Name:     "daemon",
+	Synopsis: "Serve desktop integrations",
+	Usages:   []string{"tmsu daemon --dbus"},
+	Description: `Runs in the background serving the database to desktop integrations, such as file manager extensions, until it is interrupted.
+
+With --dbus, the name 'org.tmsu.Tmsu' is registered on the session bus. Its object '/org/tmsu/Tmsu' has the interface 'org.tmsu.Tmsu' with these methods, which take absolute paths and tags in the TAG=VALUE form of the 'tag' subcommand:
+
+  Tag(s path, as tags)          applies the tags to the file
+  Untag(s path, as tags)        removes the tags from the file
+  FileTags(s path) -> as tags   lists the tags applied to the file
+  Files(s query) -> as paths    lists the files matching the query
+  Tags() -> as names            lists the tags in the database
+
+Failures are reported with the error 'org.tmsu.Tmsu.Error'.`,
+	Examples: []string{"$ tmsu daemon --dbus &",
+		"$ dbus-send --session --print-reply --dest=org.tmsu.Tmsu /org/tmsu/Tmsu org.tmsu.Tmsu.Files string:'cat'"},
+	Options: Options{{"--dbus", "", "register a service on the D-Bus session bus", false, ""}},
+	Exec:    daemonExec,
+}
+
+// unexported
+
+const dbusServiceName = "org.tmsu.Tmsu"
+const dbusObjectPath = dbus.ObjectPath("/org/tmsu/Tmsu")
+const dbusInterface = "org.tmsu.Tmsu"
+const dbusErrorName = "org.tmsu.Tmsu.Error"
+
+const dbusIntrospection = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect">
+      <arg name="data" type="s" direction="out"/>
+    </method>
+  </interface>
+  <interface name="org.tmsu.Tmsu">
+    <method name="Tag">
+      <arg name="path" type="s" direction="in"/>
+      <arg name="tags" type="as" direction="in"/>
+    </method>
+    <method name="Untag">
+      <arg name="path" type="s" direction="in"/>
+      <arg name="tags" type="as" direction="in"/>
+    </method>
+    <method name="FileTags">
+      <arg name="path" type="s" direction="in"/>
+      <arg name="tags" type="as" direction="out"/>
+    </method>
+    <method name="Files">
+      <arg name="query" type="s" direction="in"/>
+      <arg name="paths" type="as" direction="out"/>
+    </method>
+    <method name="Tags">
+      <arg name="names" type="as" direction="out"/>
+    </method>
+  </interface>
+</node>`
+
+func daemonExec(options Options, args []string, databasePath string) (error, warnings) {
+	if !options.HasOption("--dbus") {
+		return fmt.Errorf("no service specified: use --dbus"), nil
+	}
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("could not connect to session bus: %w", err), nil
+	}
+	defer conn.Close()
+
+	if err := conn.RequestName(dbusServiceName); err != nil {
+		return fmt.Errorf("could not register '%v' on session bus: %w", dbusServiceName, err), nil
+	}
+
+	log.Infof(2, "serving database '%v' as '%v'", store.DbPath, dbusServiceName)
+
+	return serveDbus(conn, libtmsu.FromStorage(store)), nil
+}
+
+func serveDbus(conn *dbus.Conn, db *libtmsu.Database) error {
+	for {
+		call, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("lost connection to session bus: %w", err)
+		}
+		if call.Type != dbus.MethodCall {
+			continue
+		}
+
+		log.Infof(2, "D-Bus call %v.%v from %v", call.Interface, call.Member, call.Sender)
+
+		if err := dispatchDbusCall(conn, db, call); err != nil {
+			return fmt.Errorf("could not reply on session bus: %w", err)
+		}
+	}
+}
+
+func dispatchDbusCall(conn *dbus.Conn, db *libtmsu.Database, call *dbus.Message) error {
+	if call.Path != dbusObjectPath {
+		return conn.ReplyError(call, "org.freedesktop.DBus.Error.UnknownObject", fmt.Sprintf("no such object '%v'", call.Path))
+	}
+
+	switch {
+	case call.Interface == "org.freedesktop.DBus.Introspectable" && call.Member == "Introspect":
+		return conn.Reply(call, "s", dbusIntrospection)
+	case call.Interface != dbusInterface && call.Interface != "":
+		return conn.ReplyError(call, "org.freedesktop.DBus.Error.UnknownInterface", fmt.Sprintf("no such interface '%v'", call.Interface))
+	}
+
+	var result []string
+	var err error
+	switch {
+	case call.Member == "Tag" && call.Signature == "sas":
+		err = db.TagFile(call.Body[0].(string), dbusTags(call.Body[1].([]string))...)
+	case call.Member == "Untag" && call.Signature == "sas":
+		err = db.UntagFile(call.Body[0].(string), dbusTags(call.Body[1].([]string))...)
+	case call.Member == "FileTags" && call.Signature == "s":
+		var tags []libtmsu.Tag
+		tags, err = db.FileTags(call.Body[0].(string))
+		for _, tag := range tags {
+			result = append(result, formatTagValueName(tag.Name, tag.Value, false, false, false))
+		}
+	case call.Member == "Files" && call.Signature == "s":
+		result, err = db.QueryFiles(call.Body[0].(string))
+	case call.Member == "Tags" && call.Signature == "":
+		result, err = db.Tags()
+	default:
+		return conn.ReplyError(call, "org.freedesktop.DBus.Error.UnknownMethod", fmt.Sprintf("no method '%v' with signature '%v'", call.Member, call.Signature))
+	}
+
+	if err != nil {
+		return conn.ReplyError(call, dbusErrorName, err.Error())
+	}
+
+	switch call.Member {
+	case "Tag", "Untag":
+		return conn.Reply(call, "")
+	}
+
+	if result == nil {
+		result = []string{}
+	}
+
+	return conn.Reply(call, "as", result)
+}
+
+// parses the tags given in the TAG=VALUE form
+func dbusTags(tagArgs []string) []libtmsu.Tag {
+	tags := make([]libtmsu.Tag, len(tagArgs))
+	for index, tagArg := range tagArgs {
+		tags[index].Name, tags[index].Value = parseTagEqValueName(tagArg)
+	}
+
+	return tags
+}
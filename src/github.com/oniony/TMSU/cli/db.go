@@ -0,0 +1,268 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+)
+
+var DbCommand = Command{
+	Name:     "db",
+	Synopsis: "Maintain the database",
+	Usages: []string{"tmsu db optimize",
+		"tmsu db migrate [--to VERSION]",
+		"tmsu db migrations"},
+	Description: `Performs maintenance upon the database.
+
+The 'optimize' action creates any of the indexes expected by TMSU that are missing from the database, gathers the statistics SQLite uses to plan queries (ANALYZE) and then rebuilds the database file to reclaim unused space (VACUUM). The size of the database before and after is reported, along with the rows and size of each table and index.
+
+The size of the individual tables and indexes is only reported if SQLite was built with the 'dbstat' virtual table.
+
+The database schema is migrated to the latest version whenever the database is opened by another subcommand. The 'migrate' action instead applies only the migrations up to and including the schema VERSION specified with --to, listing each as it is applied. Migrations cannot be reversed, nor will a database with a schema newer than this version of TMSU supports be opened.
+
+The 'migrations' action lists every migration with its schema version and whether it has been applied to the database, along with when, if recorded, without migrating the database.`,
+	Examples: []string{"$ tmsu db optimize",
+		"$ tmsu db migrate --to 0.8.0-7",
+		`$ tmsu db migrations
+Schema version: 0.8.0-7
+  0.5.0-0 applied renaming fingerprint algorithm setting
+  ...
+  0.8.0-7 applied creating content tag table (2026-10-14 09:30:12)
+  0.8.0-8 pending creating migration history table`},
+	Options: Options{Option{"--to", "", "migrate to the schema VERSION", true, ""}},
+	Exec:    dbExec,
+}
+
+// unexported
+
+func dbExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 1 {
+		return errTooFewArguments, nil
+	}
+
+	action := args[0]
+	args = args[1:]
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err, nil
+	}
+
+	switch action {
+	case "optimize":
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		return optimizeDatabase(databasePath, colour), nil
+	case "migrate":
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		version := ""
+		if options.HasOption("--to") {
+			version = options.Get("--to").Argument
+		}
+
+		return migrateDatabase(databasePath, version), nil
+	case "migrations":
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		return listMigrations(databasePath, colour), nil
+	}
+
+	return fmt.Errorf("invalid action '%v': expected migrate, migrations or optimize", action), nil
+}
+
+func optimizeDatabase(databasePath string, colour bool) error {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	size, unused, err := store.DatabaseSize(tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not determine database size: %w", err)
+	}
+
+	log.Info(2, "creating missing indexes")
+
+	created, err := store.CreateMissingIndexes(tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not create missing indexes: %w", err)
+	}
+
+	log.Info(2, "analyzing database")
+
+	if err := store.Analyze(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not analyze database: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Info(2, "vacuuming database")
+
+	if err := store.Vacuum(); err != nil {
+		return fmt.Errorf("could not vacuum database: %w", err)
+	}
+
+	tx, err = store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	optimizedSize, optimizedUnused, err := store.DatabaseSize(tx)
+	if err != nil {
+		return fmt.Errorf("could not determine database size: %w", err)
+	}
+
+	objects, err := store.DatabaseObjects(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tables and indexes: %w", err)
+	}
+
+	for _, name := range created {
+		fmt.Printf("created missing index '%v'\n", name)
+	}
+
+	printInfo("Size before", fmt.Sprintf("%v bytes (%v unused)", size, unused), colour)
+	printInfo("Size after", fmt.Sprintf("%v bytes (%v unused)", optimizedSize, optimizedUnused), colour)
+
+	fmt.Println()
+	printDatabaseObjects(objects)
+
+	return nil
+}
+
+func printDatabaseObjects(objects entities.DatabaseObjects) {
+	maxLength := 0
+	for _, object := range objects {
+		if len(object.Name) > maxLength {
+			maxLength = len(object.Name)
+		}
+	}
+
+	for _, object := range objects {
+		detail := object.Type
+		if object.Type == "table" {
+			detail = fmt.Sprintf("table, %v rows", object.Rows)
+		}
+		if object.Size >= 0 {
+			detail += fmt.Sprintf(", %v bytes", object.Size)
+		}
+
+		fmt.Printf("  %*s %v\n", -maxLength, object.Name, detail)
+	}
+}
+
+func migrateDatabase(databasePath, version string) error {
+	if err := refuseIfReadOnly(); err != nil {
+		return err
+	}
+
+	passphrase, err := migrationPassphrase(databasePath)
+	if err != nil {
+		return err
+	}
+
+	log.Info(2, "migrating database")
+
+	migrations, err := storage.MigrateAt(databasePath, passphrase, version)
+	if err != nil {
+		return fmt.Errorf("could not migrate database: %w", err)
+	}
+
+	for _, migration := range migrations {
+		fmt.Printf("%v %v\n", migration.Version, migration.Description)
+	}
+
+	return nil
+}
+
+func listMigrations(databasePath string, colour bool) error {
+	passphrase, err := migrationPassphrase(databasePath)
+	if err != nil {
+		return err
+	}
+
+	version, migrations, err := storage.MigrationsAt(databasePath, passphrase)
+	if err != nil {
+		return fmt.Errorf("could not retrieve migrations: %w", err)
+	}
+
+	printInfo("Schema version", version, colour)
+
+	for _, migration := range migrations {
+		status := "pending"
+		if migration.Applied {
+			status = "applied"
+		}
+
+		if migration.Time.IsZero() {
+			fmt.Printf("  %v %v %v\n", migration.Version, status, migration.Description)
+		} else {
+			fmt.Printf("  %v %v %v (%v)\n", migration.Version, status, migration.Description, migration.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	return nil
+}
+
+// the passphrase of the database to be migrated, which is opened directly
+// rather than via openDatabase as that would migrate it to the latest version
+func migrationPassphrase(databasePath string) (string, error) {
+	if os.Getenv("TMSU_REMOTE") != "" {
+		return "", errors.New("cannot migrate a remote database")
+	}
+	if storage.IsPostgres(databasePath) {
+		return "", errors.New("cannot migrate a PostgreSQL database")
+	}
+
+	encrypted, err := storage.IsEncrypted(databasePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errNoDatabase
+		}
+
+		return "", fmt.Errorf("cannot access database: %w", err)
+	}
+
+	if !encrypted {
+		return "", nil
+	}
+
+	return databasePassphrase(databasePath)
+}
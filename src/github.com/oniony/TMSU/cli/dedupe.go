@@ -0,0 +1,321 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+)
+
+var DedupeCommand = Command{
+	Name:     "dedupe",
+	Synopsis: "Consolidate duplicate files",
+	Usages:   []string{"tmsu dedupe OPTION"},
+	Description: `Consolidates the sets of duplicate files in the database so that only the first file of each set remains. The tags and note of each duplicate are merged onto the remaining file and the duplicate is removed from the database.
+
+Exactly one of the following actions must be specified for the duplicate files:
+
+  --hardlink            replace each duplicate with a hard link to the remaining file
+  --symlink             replace each duplicate with a symbolic link to the remaining file
+  --delete-keep-first   delete each duplicate
+
+The duplicates are compared in full before any action is taken. Directories and duplicates that are no longer identical to the remaining file are left untouched.
+
+Before deleting duplicates with --delete-keep-first the files that would be deleted are listed and confirmation is asked for. Specify --yes to delete them without confirmation, such as from a script.`,
+	Examples: []string{"$ tmsu dedupe --hardlink\n/tmp/copy of song.mp3: hard linked to /tmp/song.mp3",
+		"$ tmsu dedupe --delete-keep-first --pretend\n/tmp/copy of song.mp3: deleted"},
+	Options: Options{{"--hardlink", "", "replace duplicates with hard links", false, ""},
+		{"--symlink", "", "replace duplicates with symbolic links", false, ""},
+		{"--delete-keep-first", "", "delete all but the first of each set of duplicates", false, ""},
+		{"--pretend", "-P", "do not make any changes", false, ""},
+		yesOption},
+	Exec: dedupeExec,
+}
+
+// unexported
+
+type dedupeAction int
+
+const (
+	dedupeHardlink dedupeAction = iota
+	dedupeSymlink
+	dedupeDelete
+)
+
+func dedupeExec(options Options, args []string, databasePath string) (error, warnings) {
+	pretend := options.HasOption("--pretend")
+
+	actions := make([]dedupeAction, 0, 1)
+	if options.HasOption("--hardlink") {
+		actions = append(actions, dedupeHardlink)
+	}
+	if options.HasOption("--symlink") {
+		actions = append(actions, dedupeSymlink)
+	}
+	if options.HasOption("--delete-keep-first") {
+		actions = append(actions, dedupeDelete)
+	}
+	if len(actions) != 1 {
+		return fmt.Errorf("exactly one of --hardlink, --symlink or --delete-keep-first must be specified"), nil
+	}
+
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if !pretend {
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %w", err), nil
+	}
+
+	log.Info(2, "identifying duplicate files.")
+
+	candidateSets, err := store.DuplicateFiles(tx)
+	if err != nil {
+		return fmt.Errorf("could not identify duplicate files: %w", err), nil
+	}
+
+	if actions[0] == dedupeDelete && !pretend && !dryRun {
+		confirmed, err := confirmDuplicateDeletion(candidateSets, options)
+		if err != nil || !confirmed {
+			return err, nil
+		}
+	}
+
+	if !pretend {
+		if err := backupBeforeChange(store, tx); err != nil {
+			return err, nil
+		}
+	}
+
+	fingerprints := newFingerprintPool(settings, fingerprint.DefaultJobs)
+
+	warnings := make(warnings, 0, 10)
+	for _, candidateSet := range candidateSets {
+		fileSets, setWarnings := confirmDuplicates(candidateSet, fingerprints, false)
+		warnings = append(warnings, setWarnings...)
+
+		for _, fileSet := range fileSets {
+			setWarnings, err := dedupeFiles(store, tx, fileSet, actions[0], settings.FileFingerprintAlgorithm(), pretend)
+			warnings = append(warnings, setWarnings...)
+			if err != nil {
+				return err, warnings
+			}
+		}
+	}
+
+	return nil, warnings
+}
+
+// asks for confirmation before deleting the duplicates, listing those that would
+// be deleted were they all still identical to the first of their sets
+func confirmDuplicateDeletion(candidateSets []entities.Files, options Options) (bool, error) {
+	impact := make([]string, 0, len(candidateSets))
+	for _, candidateSet := range candidateSets {
+		if candidateSet[0].IsDir {
+			continue
+		}
+
+		for _, file := range candidateSet[1:] {
+			impact = append(impact, displayPath(file.Path()))
+		}
+	}
+
+	if len(impact) == 0 {
+		return true, nil
+	}
+
+	return confirm(options, impact, fmt.Sprintf("delete these %v duplicate file(s)?", len(impact)))
+}
+
+func dedupeFiles(store *storage.Storage, tx *storage.Tx, files entities.Files, action dedupeAction, algorithm string, pretend bool) (warnings, error) {
+	survivor := files[0]
+	if survivor.IsDir {
+		log.Infof(2, "%v: skipping duplicate directories", survivor.Path())
+		return nil, nil
+	}
+
+	survivorStat, err := os.Lstat(survivor.Path())
+	if err != nil {
+		return warnings{fmt.Errorf("%v: could not stat file: %w", survivor.Path(), err)}, nil
+	}
+	if !survivorStat.Mode().IsRegular() {
+		log.Infof(2, "%v: skipping as not a regular file", survivor.Path())
+		return nil, nil
+	}
+
+	survivorFingerprint, err := fingerprint.CreateExact(survivor.Path(), algorithm)
+	if err != nil {
+		return warnings{fmt.Errorf("%v: could not create fingerprint: %w", survivor.Path(), err)}, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, file := range files[1:] {
+		stat, err := os.Lstat(file.Path())
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not stat file: %w", file.Path(), err))
+			continue
+		}
+		if !stat.Mode().IsRegular() {
+			log.Infof(2, "%v: skipping as not a regular file", file.Path())
+			continue
+		}
+
+		sameFile := os.SameFile(survivorStat, stat)
+		if !sameFile {
+			fp, err := fingerprint.CreateExact(file.Path(), algorithm)
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("%v: could not create fingerprint: %w", file.Path(), err))
+				continue
+			}
+			if fp != survivorFingerprint {
+				warnings = append(warnings, fmt.Errorf("%v: no longer a duplicate of %v", file.Path(), survivor.Path()))
+				continue
+			}
+		}
+
+		if !pretend {
+			if !dryRun {
+				if err := dedupeFile(file.Path(), survivor.Path(), action, sameFile); err != nil {
+					warnings = append(warnings, err)
+					continue
+				}
+			}
+
+			if err := mergeFileInto(store, tx, file, survivor); err != nil {
+				return warnings, err
+			}
+		}
+
+		relPath := displayPath(file.Path())
+		relSurvivorPath := displayPath(survivor.Path())
+
+		switch action {
+		case dedupeHardlink:
+			fmt.Printf("%v: hard linked to %v\n", relPath, relSurvivorPath)
+		case dedupeSymlink:
+			fmt.Printf("%v: symbolically linked to %v\n", relPath, relSurvivorPath)
+		case dedupeDelete:
+			fmt.Printf("%v: deleted\n", relPath)
+		}
+	}
+
+	return warnings, nil
+}
+
+func dedupeFile(path, survivorPath string, action dedupeAction, sameFile bool) error {
+	switch action {
+	case dedupeHardlink:
+		if sameFile {
+			return nil
+		}
+
+		return replaceFile(path, func(tempPath string) error { return os.Link(survivorPath, tempPath) })
+	case dedupeSymlink:
+		return replaceFile(path, func(tempPath string) error { return os.Symlink(survivorPath, tempPath) })
+	case dedupeDelete:
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("%v: could not delete file: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// Replaces the file at path with the link created by the specified function.
+// The link is created alongside the file and then renamed over it so that the
+// file is left intact should the link not be created.
+func replaceFile(path string, createLink func(tempPath string) error) error {
+	tempPath := path + ".tmsu-dedupe"
+
+	if err := createLink(tempPath); err != nil {
+		return fmt.Errorf("%v: could not create link: %w", path, err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("%v: could not replace file with link: %w", path, err)
+	}
+
+	return nil
+}
+
+// Moves the explicit tags and note of a file onto another file and removes
+// the first file from the database.
+func mergeFileInto(store *storage.Storage, tx *storage.Tx, file, survivor *entities.File) error {
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file-tags: %w", file.Path(), err)
+	}
+
+	for _, fileTag := range fileTags {
+		exists, err := store.FileTagExists(tx, survivor.Id, fileTag.TagId, fileTag.ValueId, true)
+		if err != nil {
+			return fmt.Errorf("%v: could not determine whether file is tagged: %w", survivor.Path(), err)
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := store.AddFileTag(tx, survivor.Id, fileTag.TagId, fileTag.ValueId); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %w", survivor.Path(), err)
+		}
+	}
+
+	note, err := store.NoteByFileId(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve note: %w", file.Path(), err)
+	}
+	if note != nil && note.Text != "" {
+		survivorNote, err := store.NoteByFileId(tx, survivor.Id)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve note: %w", survivor.Path(), err)
+		}
+		if survivorNote == nil || survivorNote.Text == "" {
+			if _, err := store.UpdateNote(tx, survivor.Id, note.Text); err != nil {
+				return fmt.Errorf("%v: could not update note: %w", survivor.Path(), err)
+			}
+		}
+	}
+
+	if err := store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
+		return fmt.Errorf("%v: could not delete file-tags: %w", file.Path(), err)
+	}
+
+	return nil
+}
@@ -18,25 +18,30 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/storage"
+	"strconv"
 )
 
 var DeleteCommand = Command{
-	Name:        "delete",
-	Aliases:     []string{"del", "rm"},
-	Synopsis:    "Delete one or more tags",
-	Usages:      []string{"tmsu delete TAG..."},
-	Description: `Permanently deletes the TAGs specified.`,
+	Name:     "delete",
+	Aliases:  []string{"del", "rm"},
+	Synopsis: "Delete one or more tags",
+	Usages:   []string{"tmsu delete TAG..."},
+	Description: `Permanently deletes the TAGs specified.
+
+Before deleting tags, or values, applied to ` + strconv.Itoa(confirmationFileCount) + ` or more files between them, the number of files each is applied to is listed and confirmation is asked for. Specify --yes to delete them without confirmation, such as from a script.`,
 	Examples: []string{"$ tmsu delete pineapple",
-		"$ tmsu delete red green blue"},
-	Options: Options{Option{"--value", "", "delete a value", false, ""}},
-	Exec:    deleteExec,
+		"$ tmsu delete red green blue",
+		"$ tmsu delete music\nmusic: 1204 file(s)\ndelete these 1 tag(s)? [y/N] y"},
+	Options: Options{Option{"--value", "", "delete a value", false, ""},
+		yesOption},
+	Exec: deleteExec,
 }
 
 // unexported
 
 func deleteExec(options Options, args []string, databasePath string) (error, warnings) {
 	if len(args) == 0 {
-		return fmt.Errorf("too few arguments"), nil
+		return errTooFewArguments, nil
 	}
 
 	store, err := openDatabase(databasePath)
@@ -51,6 +56,19 @@ func deleteExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	confirmed, err := confirmDeletion(store, tx, args, options.HasOption("--value"), options)
+	if err != nil || !confirmed {
+		return err, nil
+	}
+
+	if err := backupBeforeChange(store, tx); err != nil {
+		return err, nil
+	}
+
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
 	if options.HasOption("--value") {
 		return deleteValue(store, tx, args)
 	}
@@ -66,16 +84,16 @@ func deleteTag(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error,
 
 		tag, err := store.TagByName(tx, tagName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
 		}
 		if tag == nil {
-			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
+			warnings = append(warnings, NoSuchTagError{tagName})
 			continue
 		}
 
 		err = store.DeleteTag(tx, tag.Id)
 		if err != nil {
-			return fmt.Errorf("could not delete tag '%v': %v", tagName, err), warnings
+			return fmt.Errorf("could not delete tag '%v': %w", tagName, err), warnings
 		}
 	}
 
@@ -90,17 +108,69 @@ func deleteValue(store *storage.Storage, tx *storage.Tx, valueArgs []string) (er
 
 		value, err := store.ValueByName(tx, valueName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve value '%v': %v", valueName, err), warnings
+			return fmt.Errorf("could not retrieve value '%v': %w", valueName, err), warnings
 		}
 		if value == nil {
-			warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
+			warnings = append(warnings, NoSuchValueError{valueName})
 			continue
 		}
 
 		if err = store.DeleteValue(tx, value.Id); err != nil {
-			return fmt.Errorf("could not delete value '%v': %v", valueName, err), warnings
+			return fmt.Errorf("could not delete value '%v': %w", valueName, err), warnings
 		}
 	}
 
 	return nil, warnings
 }
+
+// asks for confirmation before deleting tags, or values, applied to many files
+func confirmDeletion(store *storage.Storage, tx *storage.Tx, args []string, values bool, options Options) (bool, error) {
+	names := make([]string, 0, len(args))
+	fileCounts := make([]uint, 0, len(args))
+
+	for _, arg := range args {
+		name := parseTagOrValueName(arg)
+
+		var fileCount uint
+		if values {
+			value, err := store.ValueByName(tx, name)
+			if err != nil {
+				return false, fmt.Errorf("could not retrieve value '%v': %w", name, err)
+			}
+			if value == nil {
+				continue
+			}
+
+			if fileCount, err = store.FileCountByValueId(tx, value.Id); err != nil {
+				return false, fmt.Errorf("could not count files with value '%v': %w", name, err)
+			}
+		} else {
+			tag, err := store.TagByName(tx, name)
+			if err != nil {
+				return false, fmt.Errorf("could not retrieve tag '%v': %w", name, err)
+			}
+			if tag == nil {
+				continue
+			}
+
+			if fileCount, err = store.FileCountByTagId(tx, tag.Id); err != nil {
+				return false, fmt.Errorf("could not count files tagged '%v': %w", name, err)
+			}
+		}
+
+		names = append(names, name)
+		fileCounts = append(fileCounts, fileCount)
+	}
+
+	impact, total := fileCountImpact(names, fileCounts)
+	if total < confirmationFileCount {
+		return true, nil
+	}
+
+	kind := "tag(s)"
+	if values {
+		kind = "value(s)"
+	}
+
+	return confirm(options, impact, fmt.Sprintf("delete these %v %v?", len(names), kind))
+}
@@ -0,0 +1,165 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/trash"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var DeleteFileCommand = Command{
+	Name:     "delete-file",
+	Synopsis: "Delete files and remove them from the database",
+	Usages:   []string{"tmsu delete-file [OPTION]... FILE..."},
+	Description: `Removes each FILE from the database, along with its tags, and deletes it from disk according to the --policy specified:
+
+  untag   Leave the file on disk, removing only its tags
+  trash   Move the file to the trash (the default)
+  delete  Delete the file permanently
+
+Files are moved to the trash described by the FreeDesktop.org trash specification, from which a file manager can restore them. A file on a different filesystem to the home directory is moved to the '.Trash-UID' directory at the top of its filesystem.
+
+A directory is only deleted when --recursive is specified, whereupon the files beneath it are removed from the database too.
+
+The tags removed may be restored with the 'undo' subcommand, but a file deleted with the 'delete' policy cannot be recovered. See the 'mount' subcommand for the corresponding policy of the virtual filesystem.`,
+	Examples: []string{"$ tmsu delete-file blurry.jpg",
+		"$ tmsu delete-file --policy=delete draft.txt",
+		"$ tmsu delete-file --policy=untag --recursive old-photos"},
+	Options: Options{{"--policy", "-p", "what to do with the file on disk: " + strings.Join(trash.PolicyNames, ", "), true, "trash"},
+		{"--recursive", "-r", "delete directories and their contents", false, ""}},
+	Exec: deleteFileExec,
+}
+
+// unexported
+
+func deleteFileExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) == 0 {
+		return errTooFewArguments, nil
+	}
+
+	policy := trash.MoveToTrash
+	if options.HasOption("--policy") {
+		var err error
+		if policy, err = trash.ParsePolicy(options.Get("--policy").Argument); err != nil {
+			return UsageError{err.Error()}, nil
+		}
+	}
+
+	recursive := options.HasOption("--recursive")
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if err := backupBeforeChange(store, tx); err != nil {
+		return err, nil
+	}
+
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, path := range args {
+		warning, err := deleteFile(store, tx, path, policy, recursive)
+		if err != nil {
+			return err, warnings
+		}
+		if warning != nil {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	return nil, warnings
+}
+
+// applies the policy to the file on disk and then removes it, and any files
+// beneath it, from the database. A file that cannot be deleted results in a
+// warning and is left in the database.
+func deleteFile(store *storage.Storage, tx *storage.Tx, path string, policy trash.Policy, recursive bool) (error, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	switch {
+	case os.IsNotExist(err):
+		if file == nil {
+			return NoSuchFileError{path}, nil
+		}
+	case os.IsPermission(err):
+		return PermissionDeniedError{path}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%v: could not stat: %w", path, err)
+	}
+
+	isDir := (stat != nil && stat.IsDir()) || (stat == nil && file.IsDir)
+	if isDir && !recursive {
+		return fmt.Errorf("%v: is a directory: specify --recursive to delete it", path), nil
+	}
+
+	files := make(entities.Files, 0, 1)
+	if file != nil {
+		files = append(files, file)
+	}
+
+	if isDir {
+		dirFiles, err := store.FilesByDirectory(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve files for directory: %w", path, err)
+		}
+
+		files = append(files, dirFiles...)
+	}
+
+	if stat != nil && policy != trash.UntagOnly {
+		log.Infof(2, "%v: applying '%v' policy", path, policy)
+
+		if err := trash.Remove(absPath, policy); err != nil {
+			return fmt.Errorf("%v: could not delete: %w", path, err), nil
+		}
+	}
+
+	for _, file := range files {
+		log.Infof(2, "%v: removing from database", file.Path())
+
+		if err := store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
+			return nil, fmt.Errorf("%v: could not remove file's tags: %w", file.Path(), err)
+		}
+	}
+
+	return nil, nil
+}
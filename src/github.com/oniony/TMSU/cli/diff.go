@@ -0,0 +1,168 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/storage/database"
+	"path/filepath"
+)
+
+var DiffCommand = Command{
+	Name:     "diff",
+	Synopsis: "Compare the files matching two queries",
+	Usages:   []string{"tmsu diff [OPTION]... QUERY1 QUERY2"},
+	Description: `Lists the files that match only QUERY1, those that match only QUERY2 and those that match both. Sections without files are omitted.
+
+Each QUERY is as per the 'files' subcommand and must be quoted if it contains spaces. The sets of files are combined by the database.
+
+This is of use when refining a taxonomy of tags, such as when replacing one tag with several, or to check the effect of a script that retags files.`,
+	Examples: []string{"$ tmsu diff holiday 'beach or mountains'\nOnly in 'holiday':\n  ./office-party.jpg\n\nOnly in 'beach or mountains':\n  ./surfing.mp4\n\nIn both:\n  ./alps.jpg\n  ./beach.jpg",
+		"$ tmsu diff --count holiday 'beach or mountains'\nOnly in 'holiday': 1\nOnly in 'beach or mountains': 1\nIn both: 2"},
+	Options: Options{{"--count", "-c", "list the number of files rather than their names", false, ""},
+		{"--path", "-p", "compare only items under PATH (may be repeated)", true, ""},
+		{"--explicit", "-e", "compare only explicitly tagged files", false, ""},
+		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""}},
+	Exec: diffExec,
+}
+
+// unexported
+
+func diffExec(options Options, args []string, databasePath string) (error, warnings) {
+	switch {
+	case len(args) < 2:
+		return errTooFewArguments, nil
+	case len(args) > 2:
+		return errTooManyArguments, nil
+	}
+
+	showCount := options.HasOption("--count")
+	explicitOnly := options.HasOption("--explicit")
+	ignoreCase := options.HasOption("--ignore-case")
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	absPaths := make([]string, 0, 1)
+	for _, relPath := range options.Arguments("--path") {
+		absPath, err := filepath.Abs(relPath)
+		if err != nil {
+			return fmt.Errorf("could not get absolute path of '%v': %w", relPath, err), nil
+		}
+
+		absPaths = append(absPaths, absPath)
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	first, warnings, err := parseCheckedQuery(store, tx, args[0], ignoreCase, false)
+	if err != nil {
+		return err, warnings
+	}
+
+	second, secondWarnings, err := parseCheckedQuery(store, tx, args[1], ignoreCase, false)
+	warnings = append(warnings, secondWarnings...)
+	if err != nil {
+		return err, warnings
+	}
+
+	onlyFirst, onlySecond, both, err := diffQueries(store, tx, first, second, absPaths, explicitOnly, ignoreCase)
+	if err != nil {
+		return err, warnings
+	}
+
+	if asJson {
+		return printJson(jsonQueryDiff{relativePaths(onlyFirst), relativePaths(onlySecond), relativePaths(both)}), warnings
+	}
+
+	sections := []struct {
+		heading string
+		files   entities.Files
+	}{{fmt.Sprintf("Only in '%v'", args[0]), onlyFirst},
+		{fmt.Sprintf("Only in '%v'", args[1]), onlySecond},
+		{"In both", both}}
+
+	firstSection := true
+	for _, section := range sections {
+		if showCount {
+			fmt.Printf("%v: %v\n", section.heading, len(section.files))
+			continue
+		}
+
+		if len(section.files) == 0 {
+			continue
+		}
+
+		if firstSection {
+			firstSection = false
+		} else {
+			fmt.Println()
+		}
+
+		fmt.Printf("%v:\n", section.heading)
+		for _, file := range section.files {
+			fmt.Printf("  %v\n", escapeControl(displayPath(file.Path())))
+		}
+	}
+
+	return nil, warnings
+}
+
+// the files matching only the first query, only the second query and both queries
+func diffQueries(store *storage.Storage, tx *storage.Tx, first, second query.Expression, paths []string, explicitOnly, ignoreCase bool) (entities.Files, entities.Files, entities.Files, error) {
+	log.Info(2, "comparing query results")
+
+	onlyFirst, err := store.FilesForQueries(tx, first, second, database.Difference, paths, explicitOnly, ignoreCase, "name")
+	if err != nil {
+		return nil, nil, nil, queryError(err)
+	}
+
+	onlySecond, err := store.FilesForQueries(tx, second, first, database.Difference, paths, explicitOnly, ignoreCase, "name")
+	if err != nil {
+		return nil, nil, nil, queryError(err)
+	}
+
+	both, err := store.FilesForQueries(tx, first, second, database.Intersection, paths, explicitOnly, ignoreCase, "name")
+	if err != nil {
+		return nil, nil, nil, queryError(err)
+	}
+
+	return onlyFirst, onlySecond, both, nil
+}
+
+func relativePaths(files entities.Files) []string {
+	paths := make([]string, len(files))
+	for index, file := range files {
+		paths[index] = displayPath(file.Path())
+	}
+
+	return paths
+}
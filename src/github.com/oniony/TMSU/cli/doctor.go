@@ -0,0 +1,219 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+)
+
+var DoctorCommand = Command{
+	Name:     "doctor",
+	Synopsis: "Check the database for inconsistencies",
+	Usages:   []string{"tmsu doctor [--fix]"},
+	Description: `Checks the database for the inconsistencies that may accumulate in databases used by earlier versions of TMSU:
+
+  orphaned tags       - file tags or content tags whose file or tag no longer exists
+  dangling values     - file tags whose value no longer exists
+  duplicate files     - entries for the same file whose paths differ only in whether they are stored relative to the root path or in their Unicode normalization
+  untagged files      - file entries without any tags
+
+Each inconsistency found is reported as a problem. With --fix they are instead corrected: orphaned tags are deleted, dangling values are removed from their tags, the tags and note of each duplicate file are moved to the first entry for the file and the duplicate removed, and untagged file entries are removed. The database is backed up beforehand.
+
+Unlike the 'repair' and 'verify' subcommands the file system is not examined.`,
+	Examples: []string{"$ tmsu doctor",
+		"$ tmsu doctor --fix"},
+	Options: Options{{"--fix", "-f", "correct the inconsistencies found", false, ""}},
+	Exec:    doctorExec,
+}
+
+// unexported
+
+func doctorExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	fix := options.HasOption("--fix")
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if fix {
+		if err := backupBeforeChange(store, tx); err != nil {
+			return err, nil
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+	}
+
+	doctor := doctor{store, tx, fix, make(warnings, 0, 10)}
+
+	checks := []func() error{doctor.orphanedTags, doctor.danglingValues, doctor.duplicateFiles, doctor.untaggedFiles}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err, doctor.problems
+		}
+	}
+
+	return nil, doctor.problems
+}
+
+// checks the database for inconsistencies, reporting each as a problem or else correcting it
+type doctor struct {
+	store    *storage.Storage
+	tx       *storage.Tx
+	fix      bool
+	problems warnings
+}
+
+func (doctor *doctor) orphanedTags() error {
+	log.Info(2, "checking for orphaned tags")
+
+	fileTags, err := doctor.store.OrphanedFileTags(doctor.tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve orphaned file tags: %w", err)
+	}
+
+	for _, fileTag := range fileTags {
+		doctor.report(fmt.Sprintf("orphaned file tag of file #%v, tag #%v and value #%v", fileTag.FileId, fileTag.TagId, fileTag.ValueId))
+	}
+
+	contentTagCount, err := doctor.store.OrphanedContentTagCount(doctor.tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve orphaned content tags: %w", err)
+	}
+
+	if contentTagCount > 0 {
+		doctor.report(fmt.Sprintf("%v orphaned content tags", contentTagCount))
+	}
+
+	if !doctor.fix {
+		return nil
+	}
+
+	if err := doctor.store.DeleteOrphanedFileTags(doctor.tx); err != nil {
+		return fmt.Errorf("could not delete orphaned file tags: %w", err)
+	}
+
+	if err := doctor.store.DeleteOrphanedContentTags(doctor.tx); err != nil {
+		return fmt.Errorf("could not delete orphaned content tags: %w", err)
+	}
+
+	return nil
+}
+
+func (doctor *doctor) danglingValues() error {
+	log.Info(2, "checking for dangling values")
+
+	fileTags, err := doctor.store.DanglingValueFileTags(doctor.tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve file tags with dangling values: %w", err)
+	}
+
+	for _, fileTag := range fileTags {
+		file, err := doctor.store.File(doctor.tx, fileTag.FileId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file #%v: %w", fileTag.FileId, err)
+		}
+
+		tag, err := doctor.store.Tag(doctor.tx, fileTag.TagId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag #%v: %w", fileTag.TagId, err)
+		}
+
+		doctor.report(fmt.Sprintf("%v: tag '%v' has missing value #%v", file.Path(), tag.Name, fileTag.ValueId))
+	}
+
+	if !doctor.fix || len(fileTags) == 0 {
+		return nil
+	}
+
+	if err := doctor.store.ClearDanglingValues(doctor.tx); err != nil {
+		return fmt.Errorf("could not remove dangling values: %w", err)
+	}
+
+	return nil
+}
+
+func (doctor *doctor) duplicateFiles() error {
+	log.Info(2, "checking for duplicate files")
+
+	fileSets, err := doctor.store.NormalizedDuplicateFiles(doctor.tx)
+	if err != nil {
+		return fmt.Errorf("could not identify duplicate files: %w", err)
+	}
+
+	for _, files := range fileSets {
+		first := files[0]
+		for _, duplicate := range files[1:] {
+			doctor.report(fmt.Sprintf("%v: file #%v duplicates file #%v", duplicate.Path(), duplicate.Id, first.Id))
+
+			if doctor.fix {
+				if err := doctor.store.MergeDuplicateFile(doctor.tx, first.Id, duplicate.Id); err != nil {
+					return fmt.Errorf("%v: could not merge file #%v into file #%v: %w", duplicate.Path(), duplicate.Id, first.Id, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (doctor *doctor) untaggedFiles() error {
+	log.Info(2, "checking for untagged files")
+
+	files, err := doctor.store.UntaggedFiles(doctor.tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve untagged files: %w", err)
+	}
+
+	for _, file := range files {
+		doctor.report(fmt.Sprintf("%v: file #%v is untagged", file.Path(), file.Id))
+	}
+
+	if !doctor.fix || len(files) == 0 {
+		return nil
+	}
+
+	if err := deleteUntaggedFiles(doctor.store, doctor.tx, files); err != nil {
+		return fmt.Errorf("could not delete untagged files: %w", err)
+	}
+
+	return nil
+}
+
+// reports an inconsistency, which is a problem unless it is being corrected
+func (doctor *doctor) report(description string) {
+	if doctor.fix {
+		fmt.Printf("%v: fixed\n", description)
+		return
+	}
+
+	doctor.problems = append(doctor.problems, fmt.Errorf("%v", description))
+}
@@ -0,0 +1,240 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"sort"
+	"strings"
+)
+
+// unexported
+
+// the subcommands that may be run with --dry-run
+var dryRunCommands = map[string]bool{"dedupe": true, "merge": true, "rename": true, "repair": true, "retag": true, "tag": true, "untag": true}
+
+// set whilst a subcommand is run with --dry-run, during which the file system must not be changed
+var dryRun bool
+
+// the state of the database compared to identify the changes made by a subcommand
+type dryRunSnapshot struct {
+	files    map[entities.FileId]*entities.File
+	tags     map[entities.TagId]string
+	fileTags map[dryRunFileTag]bool
+}
+
+// a file tag identified by the name of its value so that renamed values are reported as retagging
+type dryRunFileTag struct {
+	fileId    entities.FileId
+	tagId     entities.TagId
+	valueName string
+}
+
+// runs the command within a transaction that is then rolled back, printing the
+// changes it would have made as commands that 'tmsu transaction' can apply
+func runDryRun(command *Command, options Options, arguments []string, databasePath string) (error, warnings) {
+	if !dryRunCommands[command.Name] {
+		return UsageError{fmt.Sprintf("the '%v' subcommand does not support --dry-run", command.Name)}, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := store.BeginBatch(); err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err), nil
+	}
+
+	atomicStore, atomicDatabasePath, dryRun = store, databasePath, true
+	defer func() {
+		atomicStore, atomicDatabasePath, dryRun = nil, "", false
+	}()
+
+	before, err := takeDryRunSnapshot(store)
+	if err != nil {
+		store.EndBatch(false)
+		return err, nil
+	}
+
+	err, warnings := command.Exec(options, arguments, databasePath)
+
+	var after *dryRunSnapshot
+	if err == nil {
+		after, err = takeDryRunSnapshot(store)
+	}
+
+	if rollbackErr := store.EndBatch(false); rollbackErr != nil {
+		return fmt.Errorf("could not roll back transaction: %w", rollbackErr), warnings
+	}
+
+	if err != nil {
+		return err, warnings
+	}
+
+	for _, line := range dryRunChanges(before, after) {
+		fmt.Println(line)
+	}
+
+	return nil, warnings
+}
+
+func takeDryRunSnapshot(store *storage.Storage) (*dryRunSnapshot, error) {
+	tx, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Commit()
+
+	files, err := store.Files(tx, "none")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %w", err)
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %w", err)
+	}
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve values: %w", err)
+	}
+
+	fileTags, err := store.FileTags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file tags: %w", err)
+	}
+
+	snapshot := dryRunSnapshot{make(map[entities.FileId]*entities.File, len(files)),
+		make(map[entities.TagId]string, len(tags)),
+		make(map[dryRunFileTag]bool, len(fileTags))}
+
+	for _, file := range files {
+		snapshot.files[file.Id] = file
+	}
+
+	for _, tag := range tags {
+		snapshot.tags[tag.Id] = tag.Name
+	}
+
+	valueNames := make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		valueNames[value.Id] = value.Name
+	}
+
+	for _, fileTag := range fileTags {
+		snapshot.fileTags[dryRunFileTag{fileTag.FileId, fileTag.TagId, valueNames[fileTag.ValueId]}] = true
+	}
+
+	return &snapshot, nil
+}
+
+// the commands that would make the changes between the snapshots: files are
+// moved and tags renamed first so that the remaining commands use the new names
+func dryRunChanges(before, after *dryRunSnapshot) []string {
+	moves := make([]string, 0, 10)
+	repairs := make([]string, 0, 10)
+	removals := make([]string, 0, 10)
+	for fileId, file := range before.files {
+		changed, ok := after.files[fileId]
+		switch {
+		case !ok:
+			removals = append(removals, dryRunCommand("untag", "--all", "--", file.Path()))
+		case changed.Path() != file.Path():
+			moves = append(moves, dryRunCommand("repair", "--manual", file.Path(), changed.Path()))
+		case changed.Fingerprint != file.Fingerprint, changed.Size != file.Size, !changed.ModTime.Equal(file.ModTime), changed.MimeType != file.MimeType:
+			repairs = append(repairs, dryRunCommand("repair", "--", changed.Path()))
+		}
+	}
+
+	renames := make([]string, 0, 10)
+	deletions := make([]string, 0, 10)
+	for tagId, name := range before.tags {
+		newName, ok := after.tags[tagId]
+		switch {
+		case !ok:
+			deletions = append(deletions, dryRunCommand("delete", "--", name))
+		case newName != name:
+			renames = append(renames, dryRunCommand("rename", "--", name, newName))
+		}
+	}
+
+	added := make(map[string][]string)
+	for fileTag := range after.fileTags {
+		if !before.fileTags[fileTag] {
+			path := after.files[fileTag.fileId].Path()
+			added[path] = append(added[path], formatTagValueName(after.tags[fileTag.tagId], fileTag.valueName, false, false, false))
+		}
+	}
+
+	removed := make(map[string][]string)
+	for fileTag := range before.fileTags {
+		_, fileKept := after.files[fileTag.fileId]
+		newName, tagKept := after.tags[fileTag.tagId]
+		if !after.fileTags[fileTag] && fileKept && tagKept {
+			path := after.files[fileTag.fileId].Path()
+			removed[path] = append(removed[path], formatTagValueName(newName, fileTag.valueName, false, false, false))
+		}
+	}
+
+	sort.Strings(moves)
+	sort.Strings(renames)
+	sort.Strings(repairs)
+	sort.Strings(deletions)
+	sort.Strings(removals)
+
+	lines := append(moves, renames...)
+	lines = append(lines, dryRunTagCommands("tag", added)...)
+	lines = append(lines, dryRunTagCommands("untag", removed)...)
+	lines = append(lines, repairs...)
+	lines = append(lines, deletions...)
+	lines = append(lines, removals...)
+
+	return lines
+}
+
+// a command per path, in path order, applying or removing its tags
+func dryRunTagCommands(name string, tagsByPath map[string][]string) []string {
+	paths := make([]string, 0, len(tagsByPath))
+	for path := range tagsByPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	lines := make([]string, len(paths))
+	for index, path := range paths {
+		tagArgs := tagsByPath[path]
+		sort.Strings(tagArgs)
+
+		lines[index] = dryRunCommand(name, append([]string{"--", path}, tagArgs...)...)
+	}
+
+	return lines
+}
+
+// the command line, quoted for 'tmsu transaction'
+func dryRunCommand(name string, args ...string) string {
+	escapedArgs := make([]string, len(args))
+	for index, arg := range args {
+		escapedArgs[index] = escape(arg, '\\', ' ', '"', '\'')
+	}
+
+	return name + " " + strings.Join(escapedArgs, " ")
+}
@@ -20,28 +20,103 @@ import (
 	"github.com/oniony/TMSU/common/filesystem"
 	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/common/log"
-	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/progress"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 var DupesCommand = Command{
-	Name:        "dupes",
-	Synopsis:    "Identify duplicate files",
-	Usages:      []string{"tmsu dupes [FILE]..."},
-	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.`,
+	Name:     "dupes",
+	Synopsis: "Identify duplicate files",
+	Usages:   []string{"tmsu dupes [--head-check] [FILE]...", "tmsu dupes --directories [DIR]...", "tmsu dupes --against OTHER_DB [FILE]...", "tmsu dupes --similar [--threshold=N] [--tag=TAG] [FILE]..."},
+	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.
+
+Where the fingerprint algorithm only fingerprints part of the larger files, such as the 'sparse:' algorithms, candidate duplicates are confirmed by comparing the entire file contents. Files in the database without a fingerprint, such as with the 'none' algorithm, are compared in the same way. Only files of the same size are compared, so a file whose size no other file shares is never read, and with --head-check files are also compared by their first ` + strconv.Itoa(fingerprint.HeadSize/1024) + ` KB before their entire contents, which avoids reading large files that differ from the start.
+
+When --directories is specified, duplicate directories are identified instead: each directory is fingerprinted from the names and contents of everything beneath it, as per the 'contents' directory fingerprint algorithm, so that only directories whose entire trees are identical are reported. Duplicate directories within directories that are themselves duplicates are not reported separately. Only directories in the database are considered to be duplicates.
+
+When --against is specified, the files in the database, or only those at FILE, are instead compared with the files in the database OTHER_DB, such as that of a main archive, and each is listed with its copies recorded there. With --missing, the files that have no copy in OTHER_DB are listed instead, so that a staging folder can be confirmed to be fully archived before it is deleted. Both databases must use the same file fingerprint algorithm.
+
+When --similar is specified, the images in the database, or only those at FILE, are instead compared by their appearance, so that photographs that look the same are identified even where they differ in encoding, resolution or metadata. Each JPEG, PNG and GIF image is reduced to a perceptual hash of ` + strconv.Itoa(fingerprint.PerceptualHashBits) + ` bits and images whose hashes differ in no more than --threshold bits, ` + strconv.Itoa(defaultSimilarityThreshold) + ` by default, are grouped together: a lower threshold finds only closer matches. Other files are ignored. With --tag, the images of each set are tagged TAG with the set's number as the value, so that the sets may be reviewed later, e.g. with 'tmsu files TAG=1'.`,
 	Examples: []string{"$ tmsu dupes\nSet of 2 duplicates:\n  /tmp/song.mp3\n  /tmp/copy of song.mp3a",
-		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3"},
-	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""}},
-	Exec:    dupesExec,
+		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3",
+		"$ tmsu dupes --directories\nSet of 2 duplicates:\n  /tmp/photos\n  /tmp/backup/photos",
+		"$ tmsu dupes --against /mnt/archive/.tmsu/db --recursive staging\nstaging/song.mp3:\n  /mnt/archive/music/song.mp3",
+		"$ tmsu dupes --against /mnt/archive/.tmsu/db --missing --recursive staging\nstaging/draft.txt",
+		"$ tmsu dupes --similar --threshold=5 --tag=similar\nSet of 2 duplicates:\n  /tmp/beach.jpg\n  /tmp/beach-small.png"},
+	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""},
+		Option{"--directories", "-d", "identify duplicate directory trees", false, ""},
+		Option{"--jobs", "-j", "fingerprint up to N files concurrently", true, ""},
+		Option{"--head-check", "", "compare the start of files of the same size before their entire contents", false, ""},
+		Option{"--against", "", "identify the files that also exist in the database OTHER_DB", true, ""},
+		Option{"--missing", "", "with --against, list the files that do not exist in OTHER_DB", false, ""},
+		Option{"--similar", "", "identify visually similar images", false, ""},
+		Option{"--threshold", "", "with --similar, the most bits in which the images' hashes may differ", true, ""},
+		Option{"--tag", "", "with --similar, tag each set of similar images TAG=N", true, ""}},
+	Exec: dupesExec,
 }
 
 // unexported
 
+// the number of bits in which the perceptual hashes of similar images may differ
+// unless otherwise specified
+const defaultSimilarityThreshold = 10
+
 func dupesExec(options Options, args []string, databasePath string) (error, warnings) {
 	recursive := options.HasOption("--recursive")
+	directories := options.HasOption("--directories")
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	jobs, err := fingerprintJobs(options)
+	if err != nil {
+		return err, nil
+	}
+
+	against := options.HasOption("--against")
+	missing := options.HasOption("--missing")
+	switch {
+	case missing && !against:
+		return UsageError{"--missing requires --against"}, nil
+	case against && directories:
+		return UsageError{"--against cannot be combined with --directories"}, nil
+	}
+
+	similar := options.HasOption("--similar")
+	headCheck := options.HasOption("--head-check")
+	switch {
+	case headCheck && (similar || directories):
+		return UsageError{"--head-check cannot be combined with --similar or --directories"}, nil
+	case !similar && (options.HasOption("--threshold") || options.HasOption("--tag")):
+		return UsageError{"--threshold and --tag require --similar"}, nil
+	case similar && (against || directories):
+		return UsageError{"--similar cannot be combined with --against or --directories"}, nil
+	}
+
+	threshold := defaultSimilarityThreshold
+	if options.HasOption("--threshold") {
+		text := options.Get("--threshold").Argument
+
+		value, err := strconv.ParseUint(text, 10, 8)
+		if err != nil || value > fingerprint.PerceptualHashBits {
+			return fmt.Errorf("invalid argument '%v' for '--threshold': must be a number of bits from 0 to %v", text, fingerprint.PerceptualHashBits), nil
+		}
+
+		threshold = int(value)
+	}
+
+	tagName := ""
+	if options.HasOption("--tag") {
+		tagName = options.Get("--tag").Argument
+
+		// tagging the sets changes the database
+		lockDatabase = true
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -49,30 +124,126 @@ func dupesExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer store.Close()
 
+	if tagName != "" {
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
 	}
 	defer tx.Commit()
 
-	switch len(args) {
-	case 0:
-		return findDuplicatesInDb(store, tx), nil
+	if against {
+		otherPath, err := filepath.Abs(options.Get("--against").Argument)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %w", options.Get("--against").Argument, err), nil
+		}
+
+		otherStore, err := openLocalDatabase(otherPath, true)
+		if err != nil {
+			return fmt.Errorf("%v: %w", otherPath, err), nil
+		}
+		defer otherStore.Close()
+
+		otherTx, err := otherStore.Begin()
+		if err != nil {
+			return err, nil
+		}
+		defer otherTx.Commit()
+
+		return findDuplicatesAgainst(store, tx, otherStore, otherTx, args, recursive, missing, headCheck, asJson, jobs)
+	}
+
+	if similar {
+		return findSimilarImages(store, tx, args, recursive, threshold, tagName, asJson, jobs)
+	}
+
+	switch {
+	case directories && len(args) == 0:
+		return findDuplicateDirectoriesInDb(store, tx, asJson, jobs)
+	case directories:
+		return findDuplicateDirectoriesOf(store, tx, args, recursive, asJson, jobs)
+	case len(args) == 0:
+		return findDuplicatesInDb(store, tx, headCheck, asJson, jobs)
 	default:
-		return findDuplicatesOf(store, tx, args, recursive)
+		return findDuplicatesOf(store, tx, args, recursive, headCheck, asJson, jobs)
 	}
 }
 
-func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
+func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx, headCheck, asJson bool, jobs int) (error, warnings) {
 	log.Info(2, "identifying duplicate files.")
 
-	fileSets, err := store.DuplicateFiles(tx)
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	candidateSets, err := store.DuplicateFiles(tx)
 	if err != nil {
-		return fmt.Errorf("could not identify duplicate files: %v", err)
+		return fmt.Errorf("could not identify duplicate files: %w", err), nil
+	}
+
+	// files without a fingerprint are candidates for one another where they share their size
+	unfingerprinted, err := store.UnfingerprintedFilesOfSharedSize(tx)
+	if err != nil {
+		return fmt.Errorf("could not identify duplicate files: %w", err), nil
+	}
+
+	fingerprints := newFingerprintPool(settings, jobs)
+
+	partialSets := make([]entities.Files, 0, 10)
+	for _, candidateSet := range candidateSets {
+		if isPartialSet(candidateSet, fingerprints.FileAlgorithm) {
+			partialSets = append(partialSets, candidateSet)
+		}
+	}
+	if len(unfingerprinted) > 0 {
+		partialSets = append(partialSets, unfingerprinted)
 	}
 
+	// the files of all of the sets are fingerprinted together to make best use of the pool
+	narrowedSets, warnings := narrowCandidates(partialSets, fingerprints, headCheck, true)
+	partialFiles := make(entities.Files, 0, 10)
+	for _, narrowedSet := range narrowedSets {
+		partialFiles = append(partialFiles, narrowedSet...)
+	}
+
+	bar := progress.Start("checking duplicates", uint(len(partialFiles)))
+	exactFingerprints, exactWarnings := createExactFingerprints(partialFiles, fingerprints, bar)
+	bar.Finish()
+	warnings = append(warnings, exactWarnings...)
+
+	fileSets := make([]entities.Files, 0, len(candidateSets))
+	for _, candidateSet := range candidateSets {
+		if isPartialSet(candidateSet, fingerprints.FileAlgorithm) {
+			fileSets = append(fileSets, groupDuplicates(candidateSet, exactFingerprints)...)
+		} else {
+			fileSets = append(fileSets, candidateSet)
+		}
+	}
+	fileSets = append(fileSets, groupDuplicates(unfingerprinted, exactFingerprints)...)
+
 	log.Infof(2, "found %v sets of duplicate files.", len(fileSets))
 
+	return printDuplicateSets(fileSets, asJson), warnings
+}
+
+func printDuplicateSets(fileSets []entities.Files, asJson bool) error {
+	if asJson {
+		jsonSets := make([][]string, len(fileSets))
+		for index, fileSet := range fileSets {
+			jsonSets[index] = make([]string, len(fileSet))
+			for fileIndex, file := range fileSet {
+				jsonSets[index][fileIndex] = displayPath(file.Path())
+			}
+		}
+
+		return printJson(jsonSets)
+	}
+
 	for index, fileSet := range fileSets {
 		if index > 0 {
 			fmt.Println()
@@ -81,15 +252,15 @@ func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
 		fmt.Printf("Set of %v duplicates:\n", len(fileSet))
 
 		for _, file := range fileSet {
-			relPath := _path.Rel(file.Path())
-			fmt.Printf("  %v\n", relPath)
+			relPath := displayPath(file.Path())
+			fmt.Printf("  %v\n", escapeControl(relPath))
 		}
 	}
 
 	return nil
 }
 
-func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) (error, warnings) {
+func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive, headCheck, asJson bool, jobs int) (error, warnings) {
 	settings, err := store.Settings(tx)
 	if err != nil {
 		return err, nil
@@ -101,10 +272,10 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 		if err != nil {
 			switch {
 			case os.IsNotExist(err):
-				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+				warnings = append(warnings, NoSuchFileError{path})
 				continue
 			case os.IsPermission(err):
-				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+				warnings = append(warnings, PermissionDeniedError{path})
 				continue
 			default:
 				return err, warnings
@@ -115,7 +286,7 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 	if recursive {
 		p, err := filesystem.Enumerate(paths...)
 		if err != nil {
-			return fmt.Errorf("could not enumerate paths: %v", err), warnings
+			return fmt.Errorf("could not enumerate paths: %w", err), warnings
 		}
 
 		paths = make([]string, len(p))
@@ -124,32 +295,90 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 		}
 	}
 
+	// the results are kept in the order of the paths, including those of the
+	// paths that are not fingerprinted
+	jsonResults := make([]*jsonDuplicates, len(paths))
+
+	candidateIndices, err := sizeCandidates(store, tx, paths)
+	if err != nil {
+		return err, warnings
+	}
+
+	candidatePaths := make([]string, len(candidateIndices))
+	for index, pathIndex := range candidateIndices {
+		candidatePaths[index] = paths[pathIndex]
+	}
+
+	for index, path := range paths {
+		jsonResults[index] = &jsonDuplicates{path, []string{}}
+	}
+	for _, pathIndex := range candidateIndices {
+		jsonResults[pathIndex] = nil
+	}
+
+	fingerprints := newFingerprintPool(settings, jobs)
+
+	bar := progress.Start("checking duplicates", uint(len(paths)))
+	bar.Add(uint(len(paths) - len(candidatePaths)))
+	defer bar.Finish()
+
 	first := true
-	for _, path := range paths {
+	err = fingerprints.CreateEach(candidatePaths, func(index int, fp fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		path := candidatePaths[index]
+
 		log.Infof(2, "%v: identifying duplicate files.", path)
 
-		fp, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
 		if err != nil {
-			return fmt.Errorf("%v: could not create fingerprint: %v", path, err), warnings
+			return fmt.Errorf("%v: could not create fingerprint: %w", path, err)
 		}
 
 		if fp == fingerprint.Fingerprint("") {
-			continue
+			return nil
 		}
 
 		files, err := store.FilesByFingerprint(tx, fp)
 		if err != nil {
-			return fmt.Errorf("%v: could not retrieve files matching fingerprint '%v': %v", path, fp, err), warnings
+			return fmt.Errorf("%v: could not retrieve files matching fingerprint '%v': %w", path, fp, err)
 		}
 
 		absPath, err := filepath.Abs(path)
 		if err != nil {
-			return fmt.Errorf("%v: could not determine absolute path: %v", path, err), warnings
+			return fmt.Errorf("%v: could not determine absolute path: %w", path, err)
 		}
 
 		// filter out the file we're searching on
 		dupes := files.Where(func(file *entities.File) bool { return file.Path() != absPath })
 
+		if stat, err := os.Stat(path); err == nil && stat.Mode().IsRegular() && len(dupes) > 0 {
+			file := &entities.File{Directory: filepath.Dir(absPath), Name: filepath.Base(absPath), Size: stat.Size()}
+
+			confirmedSets, setWarnings := confirmDuplicates(append(entities.Files{file}, dupes...), fingerprints, headCheck)
+			warnings = append(warnings, setWarnings...)
+
+			dupes = entities.Files{}
+			for _, confirmedSet := range confirmedSets {
+				if confirmedSet[0] == file {
+					dupes = confirmedSet[1:]
+				}
+			}
+		}
+
+		if asJson {
+			relPaths := make([]string, len(dupes))
+			for index, dupe := range dupes {
+				relPaths[index] = displayPath(dupe.Path())
+			}
+
+			jsonResults[candidateIndices[index]] = &jsonDuplicates{path, relPaths}
+			return nil
+		}
+
+		if len(dupes) > 0 {
+			progress.Clear()
+		}
+
 		if len(paths) > 1 && len(dupes) > 0 {
 			if first {
 				first = false
@@ -157,15 +386,481 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 				fmt.Println()
 			}
 
-			fmt.Printf("%v:\n", path)
+			fmt.Printf("%v:\n", escapeControl(path))
 
 			for _, dupe := range dupes {
-				relPath := _path.Rel(dupe.Path())
-				fmt.Printf("  %v\n", relPath)
+				relPath := displayPath(dupe.Path())
+				fmt.Printf("  %v\n", escapeControl(relPath))
 			}
 		} else {
 			for _, dupe := range dupes {
-				relPath := _path.Rel(dupe.Path())
+				relPath := displayPath(dupe.Path())
+				fmt.Println(escapeControl(relPath))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err, warnings
+	}
+
+	if asJson {
+		jsonDupes := make([]jsonDuplicates, 0, len(paths))
+		for _, jsonResult := range jsonResults {
+			if jsonResult != nil {
+				jsonDupes = append(jsonDupes, *jsonResult)
+			}
+		}
+
+		return printJson(jsonDupes), warnings
+	}
+
+	return nil, warnings
+}
+
+// Identifies which of the paths could have duplicates in the database, returning
+// their indices. A regular file cannot have a duplicate unless another file in
+// the database has the same size, so need not be fingerprinted.
+func sizeCandidates(store *storage.Storage, tx *storage.Tx, paths []string) ([]int, error) {
+	indices := make([]int, 0, len(paths))
+
+	for index, path := range paths {
+		stat, err := os.Lstat(path)
+		if err != nil || !stat.Mode().IsRegular() {
+			indices = append(indices, index)
+			continue
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not determine absolute path: %w", path, err)
+		}
+
+		files, err := store.FilesBySize(tx, stat.Size())
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve files of the same size: %w", path, err)
+		}
+
+		for _, file := range files {
+			if file.Path() != absPath {
+				indices = append(indices, index)
+				break
+			}
+		}
+
+		if len(indices) == 0 || indices[len(indices)-1] != index {
+			log.Infof(2, "%v: skipping as no other file has the same size", path)
+		}
+	}
+
+	return indices, nil
+}
+
+// identifies the files in the database that also exist in the other database
+func findDuplicatesAgainst(store *storage.Storage, tx *storage.Tx, otherStore *storage.Storage, otherTx *storage.Tx, paths []string, recursive, missing, headCheck, asJson bool, jobs int) (error, warnings) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	otherSettings, err := otherStore.Settings(otherTx)
+	if err != nil {
+		return err, nil
+	}
+
+	if settings.FileFingerprintAlgorithm() != otherSettings.FileFingerprintAlgorithm() {
+		return fmt.Errorf("cannot compare databases using different fingerprint algorithms: '%v' and '%v'", settings.FileFingerprintAlgorithm(), otherSettings.FileFingerprintAlgorithm()), nil
+	}
+
+	files, warnings, err := databaseFiles(store, tx, paths, recursive)
+	if err != nil {
+		return err, warnings
+	}
+
+	files = files.Where(func(file *entities.File) bool { return !file.IsDir && file.Fingerprint != fingerprint.Empty })
+
+	log.Infof(2, "identifying which of %v files exist in '%v'.", len(files), otherStore.DbPath)
+
+	fingerprints := newFingerprintPool(settings, jobs)
+
+	bar := progress.Start("checking duplicates", uint(len(files)))
+	jsonDupes := make([]jsonDuplicates, 0, len(files))
+	for _, file := range files {
+		bar.Add(1)
+
+		copies, err := otherStore.FilesByFingerprint(otherTx, file.Fingerprint)
+		if err != nil {
+			bar.Finish()
+			return fmt.Errorf("%v: could not retrieve files matching fingerprint '%v': %w", file.Path(), file.Fingerprint, err), warnings
+		}
+
+		if len(copies) > 0 {
+			confirmedSets, setWarnings := confirmDuplicates(append(entities.Files{file}, copies...), fingerprints, headCheck)
+			warnings = append(warnings, setWarnings...)
+
+			copies = entities.Files{}
+			for _, confirmedSet := range confirmedSets {
+				if confirmedSet[0] == file {
+					copies = confirmedSet[1:]
+				}
+			}
+		}
+
+		relPaths := make([]string, len(copies))
+		for index, dupe := range copies {
+			relPaths[index] = displayPath(dupe.Path())
+		}
+
+		jsonDupes = append(jsonDupes, jsonDuplicates{displayPath(file.Path()), relPaths})
+	}
+	bar.Finish()
+
+	if missing {
+		missingPaths := make([]string, 0, len(jsonDupes))
+		for _, dupes := range jsonDupes {
+			if len(dupes.Duplicates) == 0 {
+				missingPaths = append(missingPaths, dupes.Path)
+			}
+		}
+
+		if asJson {
+			return printJson(missingPaths), warnings
+		}
+
+		for _, path := range missingPaths {
+			fmt.Println(escapeControl(path))
+		}
+
+		return nil, warnings
+	}
+
+	if asJson {
+		return printJson(jsonDupes), warnings
+	}
+
+	first := true
+	for _, dupes := range jsonDupes {
+		if len(dupes.Duplicates) == 0 {
+			continue
+		}
+
+		if first {
+			first = false
+		} else {
+			fmt.Println()
+		}
+
+		fmt.Printf("%v:\n", escapeControl(dupes.Path))
+
+		for _, relPath := range dupes.Duplicates {
+			fmt.Printf("  %v\n", escapeControl(relPath))
+		}
+	}
+
+	return nil, warnings
+}
+
+// identifies the sets of images in the database that look alike, as judged by
+// the number of bits in which their perceptual hashes differ
+func findSimilarImages(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool, threshold int, tagName string, asJson bool, jobs int) (error, warnings) {
+	log.Info(2, "identifying similar images.")
+
+	files, warnings, err := databaseFiles(store, tx, paths, recursive)
+	if err != nil {
+		return err, warnings
+	}
+
+	files = files.Where(func(file *entities.File) bool { return !file.IsDir })
+
+	pool := fingerprint.NewPool("", "", "", jobs)
+
+	images := make(entities.Files, 0, len(files))
+	hashes := make([]fingerprint.Fingerprint, 0, len(files))
+
+	bar := progress.Start("checking images", uint(len(files)))
+	pool.CreatePerceptualEach(files.Paths(), func(index int, hash fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		file := files[index]
+
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not create perceptual hash: %w", file.Path(), err))
+			return nil
+		}
+
+		if hash == fingerprint.Empty {
+			log.Infof(2, "%v: skipping as not an image", file.Path())
+			return nil
+		}
+
+		images = append(images, file)
+		hashes = append(hashes, hash)
+		return nil
+	})
+	bar.Finish()
+
+	fileSets := groupSimilar(images, hashes, threshold)
+
+	log.Infof(2, "found %v sets of similar images.", len(fileSets))
+
+	if tagName != "" {
+		tagWarnings, err := tagSimilarSets(store, tx, fileSets, tagName)
+		warnings = append(warnings, tagWarnings...)
+		if err != nil {
+			return err, warnings
+		}
+	}
+
+	return printDuplicateSets(fileSets, asJson), warnings
+}
+
+// splits the images into the sets, of more than one image, linked by hashes
+// that differ in no more than the threshold number of bits
+func groupSimilar(files entities.Files, hashes []fingerprint.Fingerprint, threshold int) []entities.Files {
+	parents := make([]int, len(files))
+	for index := range parents {
+		parents[index] = index
+	}
+
+	root := func(index int) int {
+		for parents[index] != index {
+			parents[index] = parents[parents[index]]
+			index = parents[index]
+		}
+
+		return index
+	}
+
+	for index := range files {
+		for otherIndex := index + 1; otherIndex < len(files); otherIndex++ {
+			if fingerprint.PerceptualDistance(hashes[index], hashes[otherIndex]) <= threshold {
+				parents[root(otherIndex)] = root(index)
+			}
+		}
+	}
+
+	fileSets := make([]entities.Files, 0, 1)
+	setIndices := make(map[int]int, len(files))
+	for index, file := range files {
+		setIndex, ok := setIndices[root(index)]
+		if !ok {
+			setIndex = len(fileSets)
+			setIndices[root(index)] = setIndex
+			fileSets = append(fileSets, entities.Files{})
+		}
+
+		fileSets[setIndex] = append(fileSets[setIndex], file)
+	}
+
+	similarSets := make([]entities.Files, 0, len(fileSets))
+	for _, fileSet := range fileSets {
+		if len(fileSet) > 1 {
+			similarSets = append(similarSets, fileSet)
+		}
+	}
+
+	return similarSets
+}
+
+// tags the images of each set with the tag and the set's number as the value
+func tagSimilarSets(store *storage.Storage, tx *storage.Tx, fileSets []entities.Files, tagName string) (warnings, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := make(warnings, 0, 10)
+	for index, fileSet := range fileSets {
+		tagArg := tagName + "=" + strconv.Itoa(index+1)
+
+		var pairs entities.TagIdValueIdPairs
+		pairs, warnings, err = parseTagValuePairs(store, tx, settings, []string{tagArg}, warnings)
+		if err != nil {
+			return warnings, err
+		}
+
+		for _, file := range fileSet {
+			for _, pair := range pairs {
+				if _, err := store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+					return warnings, fmt.Errorf("%v: could not apply tag '%v': %w", file.Path(), tagArg, err)
+				}
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// retrieves the files in the database, or only those at the paths
+func databaseFiles(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) (entities.Files, warnings, error) {
+	warnings := make(warnings, 0, 10)
+
+	switch {
+	case len(paths) == 0:
+		files, err := store.Files(tx, "name")
+		if err != nil {
+			return nil, warnings, fmt.Errorf("could not retrieve files: %w", err)
+		}
+
+		return files, warnings, nil
+	case recursive:
+		files, err := filesAtOrBeneath(store, tx, paths)
+		return files, warnings, err
+	}
+
+	files := make(entities.Files, 0, len(paths))
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+		}
+		if file == nil {
+			warnings = append(warnings, fmt.Errorf("%v: file is not tagged", path))
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	return files, warnings, nil
+}
+
+func findDuplicateDirectoriesInDb(store *storage.Storage, tx *storage.Tx, asJson bool, jobs int) (error, warnings) {
+	log.Info(2, "identifying duplicate directories.")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	directories, fingerprints, warnings, err := directoryFingerprints(store, tx, settings, jobs)
+	if err != nil {
+		return err, warnings
+	}
+
+	fileSets := outermostDuplicates(groupDuplicates(directories, fingerprints))
+
+	log.Infof(2, "found %v sets of duplicate directories.", len(fileSets))
+
+	return printDuplicateSets(fileSets, asJson), warnings
+}
+
+func findDuplicateDirectoriesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive, asJson bool, jobs int) (error, warnings) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	dirPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				warnings = append(warnings, NoSuchFileError{path})
+				continue
+			case os.IsPermission(err):
+				warnings = append(warnings, PermissionDeniedError{path})
+				continue
+			default:
+				return err, warnings
+			}
+		}
+
+		if !stat.IsDir() {
+			warnings = append(warnings, fmt.Errorf("%v: not a directory", path))
+			continue
+		}
+
+		dirPaths = append(dirPaths, path)
+	}
+
+	if recursive {
+		entries, err := filesystem.Enumerate(dirPaths...)
+		if err != nil {
+			return fmt.Errorf("could not enumerate paths: %w", err), warnings
+		}
+
+		dirPaths = make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir {
+				dirPaths = append(dirPaths, entry.Path)
+			}
+		}
+	}
+
+	directories, fingerprints, dbWarnings, err := directoryFingerprints(store, tx, settings, jobs)
+	warnings = append(warnings, dbWarnings...)
+	if err != nil {
+		return err, warnings
+	}
+
+	pool := fingerprint.NewPool(settings.FileFingerprintAlgorithm(), "contents", settings.SymlinkFingerprintAlgorithm(), jobs)
+
+	jsonDupes := make([]jsonDuplicates, 0, len(dirPaths))
+	err = pool.CreateEach(dirPaths, func(index int, fp fingerprint.Fingerprint, err error) error {
+		path := dirPaths[index]
+
+		log.Infof(2, "%v: identifying duplicate directories.", path)
+
+		if err != nil {
+			return fmt.Errorf("%v: could not create fingerprint: %w", path, err)
+		}
+
+		if fp == fingerprint.Empty {
+			return nil
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not determine absolute path: %w", path, err)
+		}
+
+		relPaths := make([]string, 0, 1)
+		for _, directory := range directories {
+			if directory.Path() != absPath && fingerprints[directory] == fp {
+				relPaths = append(relPaths, displayPath(directory.Path()))
+			}
+		}
+
+		jsonDupes = append(jsonDupes, jsonDuplicates{path, relPaths})
+		return nil
+	})
+	if err != nil {
+		return err, warnings
+	}
+
+	if asJson {
+		return printJson(jsonDupes), warnings
+	}
+
+	first := true
+	for _, dupes := range jsonDupes {
+		if len(dupes.Duplicates) == 0 {
+			continue
+		}
+
+		if len(dirPaths) > 1 {
+			if first {
+				first = false
+			} else {
+				fmt.Println()
+			}
+
+			fmt.Printf("%v:\n", dupes.Path)
+
+			for _, relPath := range dupes.Duplicates {
+				fmt.Printf("  %v\n", relPath)
+			}
+		} else {
+			for _, relPath := range dupes.Duplicates {
 				fmt.Println(relPath)
 			}
 		}
@@ -173,3 +868,231 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 
 	return nil, warnings
 }
+
+// fingerprints the directories in the database from their entire contents
+func directoryFingerprints(store *storage.Storage, tx *storage.Tx, settings entities.Settings, jobs int) (entities.Files, map[*entities.File]fingerprint.Fingerprint, warnings, error) {
+	files, err := store.Files(tx, "name")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not retrieve files: %w", err)
+	}
+
+	directories := files.Where(func(file *entities.File) bool { return file.IsDir })
+
+	pool := fingerprint.NewPool(settings.FileFingerprintAlgorithm(), "contents", settings.SymlinkFingerprintAlgorithm(), jobs)
+
+	bar := progress.Start("checking duplicates", uint(len(directories)))
+	defer bar.Finish()
+
+	warnings := make(warnings, 0, 10)
+	fingerprints := make(map[*entities.File]fingerprint.Fingerprint, len(directories))
+
+	pool.CreateEach(directories.Paths(), func(index int, fp fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		directory := directories[index]
+
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not create fingerprint: %w", directory.Path(), err))
+			return nil
+		}
+
+		log.Infof(2, "%v: calculated fingerprint of directory contents", directory.Path())
+
+		if fp != fingerprint.Empty {
+			fingerprints[directory] = fp
+		}
+
+		return nil
+	})
+
+	return directories, fingerprints, warnings, nil
+}
+
+// drops the sets of duplicates lying entirely within directories that are themselves duplicates
+func outermostDuplicates(fileSets []entities.Files) []entities.Files {
+	duplicatePaths := make(map[string]bool)
+	for _, fileSet := range fileSets {
+		for _, file := range fileSet {
+			duplicatePaths[file.Path()] = true
+		}
+	}
+
+	outermostSets := make([]entities.Files, 0, len(fileSets))
+	for _, fileSet := range fileSets {
+		for _, file := range fileSet {
+			if !withinDuplicate(file.Path(), duplicatePaths) {
+				outermostSets = append(outermostSets, fileSet)
+				break
+			}
+		}
+	}
+
+	return outermostSets
+}
+
+func withinDuplicate(path string, duplicatePaths map[string]bool) bool {
+	for parent := filepath.Dir(path); parent != path; path, parent = parent, filepath.Dir(parent) {
+		if duplicatePaths[parent] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Where the fingerprints of a set of candidate duplicates were calculated from
+// only part of the files' contents, the set is split into the sets of files
+// whose entire contents match.
+func confirmDuplicates(files entities.Files, fingerprints *fingerprint.Pool, headCheck bool) ([]entities.Files, warnings) {
+	if !isPartialSet(files, fingerprints.FileAlgorithm) {
+		return []entities.Files{files}, nil
+	}
+
+	narrowedSets, warnings := narrowCandidates([]entities.Files{files}, fingerprints, headCheck, false)
+
+	narrowedFiles := make(entities.Files, 0, len(files))
+	for _, narrowedSet := range narrowedSets {
+		narrowedFiles = append(narrowedFiles, narrowedSet...)
+	}
+
+	exactFingerprints, exactWarnings := createExactFingerprints(narrowedFiles, fingerprints, nil)
+	warnings = append(warnings, exactWarnings...)
+
+	return splitSets(narrowedSets, fingerprintKey(exactFingerprints)), warnings
+}
+
+// whether the fingerprints of any of the files are calculated from only part of their contents
+func isPartialSet(files entities.Files, algorithm string) bool {
+	for _, file := range files {
+		if !file.IsDir && fingerprint.IsPartial(algorithm, file.Size) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Narrows each set of candidate duplicates to the files that share their size
+// with another file of the set and, where headCheck is specified, the
+// fingerprint of their first few kilobytes too, so that the files that cannot
+// be duplicates are never fingerprinted in their entirety.
+func narrowCandidates(candidateSets []entities.Files, fingerprints *fingerprint.Pool, headCheck, showProgress bool) ([]entities.Files, warnings) {
+	sizedSets := splitSets(candidateSets, func(file *entities.File) (string, bool) {
+		return strconv.FormatInt(file.Size, 10), !file.IsDir
+	})
+
+	if !headCheck {
+		return sizedSets, nil
+	}
+
+	files := make(entities.Files, 0, 10)
+	for _, sizedSet := range sizedSets {
+		files = append(files, sizedSet...)
+	}
+
+	var bar *progress.Bar
+	if showProgress {
+		bar = progress.Start("checking file heads", uint(len(files)))
+	}
+
+	headFingerprints, warnings := createHeadFingerprints(files, fingerprints, bar)
+	bar.Finish()
+
+	return splitSets(sizedSets, fingerprintKey(headFingerprints)), warnings
+}
+
+// fingerprints the first few kilobytes of the files concurrently
+func createHeadFingerprints(files entities.Files, fingerprints *fingerprint.Pool, bar *progress.Bar) (map[*entities.File]fingerprint.Fingerprint, warnings) {
+	warnings := make(warnings, 0, 10)
+	headFingerprints := make(map[*entities.File]fingerprint.Fingerprint, len(files))
+
+	fingerprints.CreateHeadEach(files.Paths(), func(index int, fp fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		file := files[index]
+
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not create fingerprint: %w", file.Path(), err))
+			return nil
+		}
+
+		log.Infof(2, "%v: calculated fingerprint of start of file", file.Path())
+
+		headFingerprints[file] = fp
+		return nil
+	})
+
+	return headFingerprints, warnings
+}
+
+// fingerprints the entire contents of the files concurrently
+func createExactFingerprints(files entities.Files, fingerprints *fingerprint.Pool, bar *progress.Bar) (map[*entities.File]fingerprint.Fingerprint, warnings) {
+	warnings := make(warnings, 0, 10)
+	exactFingerprints := make(map[*entities.File]fingerprint.Fingerprint, len(files))
+
+	fingerprints.CreateExactEach(files.Paths(), func(index int, fp fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		file := files[index]
+
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not create fingerprint: %w", file.Path(), err))
+			return nil
+		}
+
+		log.Infof(2, "%v: calculated fingerprint of entire file", file.Path())
+
+		exactFingerprints[file] = fp
+		return nil
+	})
+
+	return exactFingerprints, warnings
+}
+
+// splits the files into the sets, of more than one file, whose exact fingerprints match
+func groupDuplicates(files entities.Files, exactFingerprints map[*entities.File]fingerprint.Fingerprint) []entities.Files {
+	return splitSets([]entities.Files{files}, fingerprintKey(exactFingerprints))
+}
+
+// keys the files by their fingerprints, omitting those without
+func fingerprintKey(fingerprints map[*entities.File]fingerprint.Fingerprint) func(file *entities.File) (string, bool) {
+	return func(file *entities.File) (string, bool) {
+		fp, ok := fingerprints[file]
+		return string(fp), ok
+	}
+}
+
+// splits each set of files into the sets, of more than one file, with the same
+// key, omitting the files that have no key
+func splitSets(fileSets []entities.Files, key func(file *entities.File) (string, bool)) []entities.Files {
+	splitSets := make([]entities.Files, 0, len(fileSets))
+
+	for _, files := range fileSets {
+		keySets := make([]entities.Files, 0, 1)
+		setIndices := make(map[string]int, len(files))
+
+		for _, file := range files {
+			fileKey, ok := key(file)
+			if !ok {
+				continue
+			}
+
+			index, ok := setIndices[fileKey]
+			if !ok {
+				index = len(keySets)
+				setIndices[fileKey] = index
+				keySets = append(keySets, entities.Files{})
+			}
+
+			keySets[index] = append(keySets[index], file)
+		}
+
+		for _, keySet := range keySets {
+			if len(keySet) > 1 {
+				splitSets = append(splitSets, keySet)
+			}
+		}
+	}
+
+	return splitSets
+}
@@ -0,0 +1,120 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/storage"
+	"os"
+)
+
+var EncryptCommand = Command{
+	Name:     "encrypt",
+	Synopsis: "Encrypts the database with a passphrase",
+	Usages: []string{"tmsu encrypt",
+		"tmsu encrypt --decrypt"},
+	Description: `Encrypts the database with a passphrase so that its tag names, values and notes are not stored in plaintext. If the database is already encrypted then its passphrase is changed instead.
+
+The database is encrypted using AES-256-GCM with a key derived from the passphrase using scrypt.
+
+Whenever an encrypted database is opened its passphrase is read from the output of the command in the TMSU_PASSPHRASE_COMMAND environment variable, e.g. a password manager or agent, or otherwise from the TMSU_PASSPHRASE environment variable, or failing these is prompted for at the terminal. The new passphrase is read from the TMSU_NEW_PASSPHRASE environment variable or prompted for.
+
+An encrypted database is decrypted into memory when opened and written back whenever it is changed. Before each change it is reloaded if another process, such as the virtual filesystem, has since written it, and a change that would nevertheless overwrite another process's is refused rather than saved.
+
+The --decrypt option decrypts the database, storing it in plaintext once more.`,
+	Examples: []string{"$ tmsu encrypt",
+		"$ TMSU_PASSPHRASE_COMMAND='pass show tmsu' tmsu tags",
+		"$ tmsu encrypt --decrypt"},
+	Options: Options{{"--decrypt", "-d", "decrypt the database", false, ""}},
+	Exec:    encryptExec,
+}
+
+// unexported
+
+func encryptExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	if os.Getenv("TMSU_REMOTE") != "" {
+		return errors.New("cannot encrypt a remote database"), nil
+	}
+	if storage.IsPostgres(databasePath) {
+		return errors.New("cannot encrypt a PostgreSQL database"), nil
+	}
+
+	if err := refuseIfReadOnly(); err != nil {
+		return err, nil
+	}
+
+	encrypted, err := storage.IsEncrypted(databasePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errNoDatabase, nil
+		}
+
+		return fmt.Errorf("cannot access database: %w", err), nil
+	}
+
+	if options.HasOption("--decrypt") {
+		if !encrypted {
+			return errors.New("database is not encrypted"), nil
+		}
+
+		passphrase, err := databasePassphrase(databasePath)
+		if err != nil {
+			return err, nil
+		}
+
+		if err := storage.DecryptAt(databasePath, passphrase); err != nil {
+			return fmt.Errorf("could not decrypt database: %w", err), nil
+		}
+
+		forgetPassphrase(databasePath)
+
+		return nil, nil
+	}
+
+	if encrypted {
+		passphrase, err := databasePassphrase(databasePath)
+		if err != nil {
+			return err, nil
+		}
+
+		newPassphrase, err := newDatabasePassphrase(databasePath, true)
+		if err != nil {
+			return err, nil
+		}
+
+		if err := storage.ChangePassphraseAt(databasePath, passphrase, newPassphrase); err != nil {
+			return fmt.Errorf("could not change passphrase: %w", err), nil
+		}
+
+		return nil, nil
+	}
+
+	passphrase, err := newDatabasePassphrase(databasePath, false)
+	if err != nil {
+		return err, nil
+	}
+
+	if err := storage.EncryptAt(databasePath, passphrase); err != nil {
+		return fmt.Errorf("could not encrypt database: %w", err), nil
+	}
+
+	return nil, nil
+}
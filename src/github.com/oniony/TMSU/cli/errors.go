@@ -16,10 +16,23 @@
 package cli
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/oniony/TMSU/storage/database"
+	"os"
 )
 
-type warnings []string
+type warnings []error
+
+// An error in the way a command was invoked.
+type UsageError struct {
+	Reason string
+}
+
+func (err UsageError) Error() string {
+	return err.Reason
+}
 
 type NoSuchTagError struct {
 	Name string
@@ -36,3 +49,144 @@ type NoSuchValueError struct {
 func (err NoSuchValueError) Error() string {
 	return fmt.Sprintf("no such value '%v'", err.Name)
 }
+
+type NoSuchNamespaceError struct {
+	Name string
+}
+
+func (err NoSuchNamespaceError) Error() string {
+	return fmt.Sprintf("no such namespace '%v'", err.Name)
+}
+
+type NoSuchViewError struct {
+	Name string
+}
+
+func (err NoSuchViewError) Error() string {
+	return fmt.Sprintf("no such view '%v'", err.Name)
+}
+
+type NoSuchFileError struct {
+	Path string
+}
+
+func (err NoSuchFileError) Error() string {
+	return fmt.Sprintf("%v: no such file", err.Path)
+}
+
+type PermissionDeniedError struct {
+	Path string
+}
+
+func (err PermissionDeniedError) Error() string {
+	return fmt.Sprintf("%v: permission denied", err.Path)
+}
+
+// The file's contents have changed although its size and modification time have not.
+type CorruptFileError struct {
+	Path string
+}
+
+func (err CorruptFileError) Error() string {
+	return fmt.Sprintf("%v: contents changed although size and modification time did not: likely corrupt", err.Path)
+}
+
+// The changes made by a transaction were rolled back as one of its commands failed.
+type TransactionRolledBackError struct {
+	Command string
+	Reason  error
+}
+
+func (err TransactionRolledBackError) Error() string {
+	return fmt.Sprintf("'%v' failed: changes rolled back", err.Command)
+}
+
+func (err TransactionRolledBackError) Unwrap() error {
+	return err.Reason
+}
+
+// unexported
+
+var errTooFewArguments = UsageError{"too few arguments"}
+var errTooManyArguments = UsageError{"too many arguments"}
+var errNoDatabase = errors.New("no database found: use 'tmsu init' to create one")
+var errConfirmationRequired = UsageError{"confirmation required: specify --yes when standard input is not a terminal"}
+
+// the classes of failure, each reported with a distinct exit status so that
+// frontends need not interpret the messages
+type errorCode struct {
+	status int
+	name   string
+}
+
+var (
+	generalError        = errorCode{1, "error"}
+	usageError          = errorCode{2, "usage"}
+	noSuchTagError      = errorCode{3, "no-such-tag"}
+	noSuchValueError    = errorCode{4, "no-such-value"}
+	noSuchFileError     = errorCode{5, "no-such-file"}
+	permissionError     = errorCode{6, "permission-denied"}
+	noDatabaseError     = errorCode{7, "no-database"}
+	databaseLockedError = errorCode{8, "database-locked"}
+	constraintError     = errorCode{9, "constraint-violation"}
+	noSuchViewError     = errorCode{10, "no-such-view"}
+	corruptFileError    = errorCode{11, "corrupt-file"}
+	readOnlyError       = errorCode{12, "read-only"}
+)
+
+func codeFor(err error) errorCode {
+	var usage UsageError
+	var noSuchTag NoSuchTagError
+	var noSuchNamespace NoSuchNamespaceError
+	var noSuchValue NoSuchValueError
+	var noSuchDbValue database.NoSuchValueError
+	var noSuchFile NoSuchFileError
+	var noSuchDbFile database.NoSuchFileError
+	var permissionDenied PermissionDeniedError
+	var databaseNotFound database.DatabaseNotFoundError
+	var noSuchView NoSuchViewError
+	var noSuchDbView database.NoSuchViewError
+	var corruptFile CorruptFileError
+	var readOnlyDatabase database.DatabaseReadOnlyError
+
+	switch {
+	case errors.As(err, &usage):
+		return usageError
+	case errors.As(err, &noSuchTag), errors.As(err, &noSuchNamespace):
+		return noSuchTagError
+	case errors.As(err, &noSuchValue), errors.As(err, &noSuchDbValue):
+		return noSuchValueError
+	case errors.As(err, &noSuchFile), errors.As(err, &noSuchDbFile), errors.Is(err, os.ErrNotExist):
+		return noSuchFileError
+	case errors.As(err, &permissionDenied), errors.Is(err, os.ErrPermission):
+		return permissionError
+	case errors.Is(err, errNoDatabase), errors.As(err, &databaseNotFound):
+		return noDatabaseError
+	case errors.As(err, &noSuchView), errors.As(err, &noSuchDbView):
+		return noSuchViewError
+	case errors.As(err, &corruptFile):
+		return corruptFileError
+	case errors.As(err, &readOnlyDatabase):
+		return readOnlyError
+	case database.IsLocked(err):
+		return databaseLockedError
+	case database.IsConstraintViolation(err):
+		return constraintError
+	}
+
+	return generalError
+}
+
+type jsonError struct {
+	Error   string `json:"error"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func errorJson(err error) string {
+	code := codeFor(err)
+
+	text, _ := json.Marshal(jsonError{code.name, code.status, err.Error()})
+
+	return string(text)
+}
@@ -0,0 +1,268 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"sort"
+	"time"
+)
+
+var ExportCommand = Command{
+	Name:     "export",
+	Synopsis: "Export the database as text",
+	Usages:   []string{"tmsu export"},
+	Description: `Writes the contents of the database to standard output as JSON lines: one record per line for each setting, saved query, tag, alias, value, implication, rule and file.
+
+Records are written in a fixed order so that the output of successive exports can be compared with standard text tools or kept under version control. File paths within the database root are written relative to the root so that the export can be imported into a database elsewhere.
+
+The output can be read back in with the 'import' subcommand.`,
+	Examples: []string{"$ tmsu export >tags.jsonl",
+		`$ tmsu export
+{"type":"tag","name":"music"}
+{"type":"file","path":"./song.mp3","fingerprint":"d3a4...","modTime":"2018-01-01T00:00:00Z","size":4096,"tags":[{"name":"music"}]}`},
+	Options: Options{},
+	Exec:    exportExec,
+}
+
+// unexported
+
+type exportTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+type exportRecord struct {
+	Type         string            `json:"type"`
+	Name         string            `json:"name,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	Tag          string            `json:"tag,omitempty"`
+	Value        string            `json:"value,omitempty"`
+	ImpliedTag   string            `json:"impliedTag,omitempty"`
+	ImpliedValue string            `json:"impliedValue,omitempty"`
+	Path         string            `json:"path,omitempty"`
+	Fingerprint  string            `json:"fingerprint,omitempty"`
+	ModTime      *time.Time        `json:"modTime,omitempty"`
+	Size         int64             `json:"size,omitempty"`
+	IsDir        bool              `json:"isDir,omitempty"`
+	MimeType     string            `json:"mimeType,omitempty"`
+	Tags         []exportTag       `json:"tags,omitempty"`
+	Note         string            `json:"note,omitempty"`
+	Properties   map[string]string `json:"properties,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Colour       string            `json:"color,omitempty"`
+	Icon         string            `json:"icon,omitempty"`
+	Group        string            `json:"group,omitempty"`
+	Condition    string            `json:"condition,omitempty"`
+	ValuePattern string            `json:"valuePattern,omitempty"`
+	DefaultValue string            `json:"defaultValue,omitempty"`
+}
+
+func exportExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+
+	records, err := exportRecords(store, tx)
+	if err != nil {
+		return err, nil
+	}
+
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("could not encode output: %w", err), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func exportRecords(store *storage.Storage, tx *storage.Tx) ([]exportRecord, error) {
+	records := make([]exportRecord, 0, 100)
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve settings: %w", err)
+	}
+	for _, setting := range settings {
+		records = append(records, exportRecord{Type: "setting", Name: setting.Name, Value: setting.Value})
+	}
+
+	queries, err := store.Queries(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve queries: %w", err)
+	}
+	for _, query := range queries {
+		records = append(records, exportRecord{Type: "query", Text: query.Text})
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %w", err)
+	}
+	sort.Sort(tags)
+	tagNames := make(map[entities.TagId]string, len(tags))
+	for _, tag := range tags {
+		tagNames[tag.Id] = tag.Name
+
+		tagInfo, err := store.TagInfo(tx, *tag)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve information of tag '%v': %w", tag.Name, err)
+		}
+
+		groupName, err := store.TagGroupName(tx, tag.Id)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve group of tag '%v': %w", tag.Name, err)
+		}
+
+		tagConstraint, err := store.TagConstraint(tx, *tag)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve constraint of tag '%v': %w", tag.Name, err)
+		}
+
+		records = append(records, exportRecord{Type: "tag", Name: tag.Name, Description: tagInfo.Description, Colour: tagInfo.Colour, Icon: tagInfo.Icon, Group: groupName, ValuePattern: tagConstraint.Pattern, DefaultValue: tagConstraint.Default})
+	}
+
+	aliases, err := store.Aliases(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve aliases: %w", err)
+	}
+	sort.Sort(aliases)
+	for _, alias := range aliases {
+		records = append(records, exportRecord{Type: "alias", Name: alias.Name, Tag: alias.Tag.Name})
+	}
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve values: %w", err)
+	}
+	sort.Sort(values)
+	valueNames := make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		valueNames[value.Id] = value.Name
+		records = append(records, exportRecord{Type: "value", Name: value.Name})
+	}
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %w", err)
+	}
+	for _, implication := range implications {
+		records = append(records, exportRecord{Type: "implication",
+			Tag:          implication.ImplyingTag.Name,
+			Value:        implication.ImplyingValue.Name,
+			ImpliedTag:   implication.ImpliedTag.Name,
+			ImpliedValue: implication.ImpliedValue.Name})
+	}
+
+	rules, err := store.Rules(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve rules: %w", err)
+	}
+	for _, rule := range rules {
+		records = append(records, exportRecord{Type: "rule", Condition: rule.Condition, Text: rule.Tags})
+	}
+
+	files, err := store.Files(tx, "name")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path() < files[j].Path() })
+
+	for _, file := range files {
+		record, err := exportFile(store, tx, file, tagNames, valueNames)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func exportFile(store *storage.Storage, tx *storage.Tx, file *entities.File, tagNames map[entities.TagId]string, valueNames map[entities.ValueId]string) (exportRecord, error) {
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return exportRecord{}, fmt.Errorf("%v: could not retrieve file tags: %w", file.Path(), err)
+	}
+
+	tags := make([]exportTag, len(fileTags))
+	for index, fileTag := range fileTags {
+		tags[index] = exportTag{tagNames[fileTag.TagId], valueNames[fileTag.ValueId]}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+
+		return tags[i].Value < tags[j].Value
+	})
+
+	note, err := store.NoteByFileId(tx, file.Id)
+	if err != nil {
+		return exportRecord{}, fmt.Errorf("%v: could not retrieve note: %w", file.Path(), err)
+	}
+	noteText := ""
+	if note != nil {
+		noteText = note.Text
+	}
+
+	properties, err := store.PropertiesByFileId(tx, file.Id)
+	if err != nil {
+		return exportRecord{}, fmt.Errorf("%v: could not retrieve properties: %w", file.Path(), err)
+	}
+	var propertyValues map[string]string
+	if len(properties) > 0 {
+		propertyValues = make(map[string]string, len(properties))
+		for _, property := range properties {
+			propertyValues[property.Name] = property.Value
+		}
+	}
+
+	modTime := file.ModTime.UTC()
+
+	return exportRecord{Type: "file",
+		Path:        _path.RelTo(file.Path(), store.RootPath),
+		Fingerprint: string(file.Fingerprint),
+		ModTime:     &modTime,
+		Size:        file.Size,
+		IsDir:       file.IsDir,
+		MimeType:    file.MimeType,
+		Tags:        tags,
+		Note:        noteText,
+		Properties:  propertyValues}, nil
+}
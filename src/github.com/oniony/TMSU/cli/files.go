@@ -16,13 +16,17 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
-	"github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
+	"math"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -30,14 +34,59 @@ var FilesCommand = Command{
 	Name:     "files",
 	Aliases:  []string{"query"},
 	Synopsis: "List files with particular tags",
-	Usages:   []string{"tmsu files [OPTION]... [QUERY]"},
+	Usages: []string{"tmsu files [OPTION]... [QUERY]",
+		"tmsu files [OPTION]... --view VIEW [QUERY]"},
 	Description: `Lists the files in the database that match the QUERY specified. If no query is specified, all files in the database are listed.
 
-QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >= eq ne lt gt le ge.
+QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >= eq ne lt gt le ge in ~ !~ like.
+
+'TAG in (VALUE, ...)' matches files tagged TAG with any of the VALUEs listed, e.g. 'year in (2019, 2020, 2021)', and is equivalent to, but faster than, 'year=2019 or year=2020 or year=2021'.
+
+A tag name ending with '*' matches any of the tags whose names begin with the preceding text, e.g. 'photo*' matches 'photo', 'photos' and 'photography', unless a tag of that name exists.
+
+When a tag does not exist the tags with similar names are suggested. With --fuzzy the closest of these is used in its place.
+
+When a value in a comparison is a number the tag values are compared numerically, and values that are not numbers do not match. Otherwise values are compared alphabetically.
+
+The built-in 'mime' tag matches files by the MIME type detected when they were tagged or repaired, e.g. 'mime=image/jpeg'. Files tagged explicitly with a 'mime' tag also match.
+
+Likewise the built-in 'size', 'ext' and 'mtime' tags match files by their size, extension and modification time as recorded when they were tagged or repaired. Sizes are in bytes, optionally with a K, M, G or T suffix, e.g. 'size > 10M'. The extension is the text following the last '.' of the file name, e.g. 'ext=mp4'. Modification times are given as YYYY[-MM[-DD[THH:MM[:SS]]]] and are compared to the same precision, so 'mtime=2023-06' matches files modified in June 2023. 'mtime-after=DATE' matches files modified on or after DATE and 'mtime-before=DATE' those modified before it.
+
+The '~' operator matches the values of a tag against a regular expression delimited by '/', e.g. 'artist~/^The /', and '!~' matches the files whose values do not match it. The built-in 'name' tag matches files by their name, so 'name~/^IMG_\d+/ and photo' matches the photos whose names begin 'IMG_' and a number. Expressions are in the syntax of Go's regexp package, are matched case-insensitively with --ignore-case, and '\/' within them stands for '/'.
+
+The 'like' operator matches values against an SQL LIKE pattern, in which '%' matches any text and '_' any single character, e.g. "prop:source-url like '%flickr%'". A pattern within single quotation marks may contain whitespace and parentheses. Names prefixed with 'prop:' match the properties set with the 'prop' subcommand, as well as any tag of the same name, so 'photo and not prop:license' matches the photos without a license property.
+
+The built-in 'tagged-after' and 'tagged-before' tags similarly match files with any tag applied on or after, or before, the time given, e.g. 'tagged-after=2024-01-01 and holiday'. Tags applied before TMSU began recording these times match neither. The 'tags --chronological' subcommand lists the tags of a file in the order in which they were applied.
+
+The built-in 'tagged-by' tag matches files with any tag applied by the user given, e.g. 'tagged-by=alice and holiday'. Tags are attributed to the current user, or to the identity in TMSU_USER if set, and those applied before TMSU began recording users match no user. The 'tags --long' subcommand shows who applied each of the tags of a file.
+
+Files are listed by name unless --sort is specified: 'size' and 'time' (or 'mtime') order files by their size or modification time when last tagged or repaired, and 'tag-count' by the number of tags applied to them. --reverse reverses the order and --limit lists only the first N files, the ordering and limiting being performed by the database.
+
+When --path is specified only the items at or beneath PATH are listed. It may be repeated to list the items beneath any of several paths. The paths are matched by the database, so this remains fast for large databases.
+
+When --group-by is specified along with --count the number of matching files having each value of TAG is listed, giving a histogram of the values. Only the values applied explicitly are counted and the counting is performed by the database.
+
+With --rank each argument is a separate query term, such as a tag, and the files matching any of the terms are listed, most relevant first, rather than only those matching all of them: files matching more of the terms rank higher and, of those matching as many, the files matching the rarer terms, those that fewer files match, rank higher. Quote a term containing spaces, e.g. 'year >= 2020'. This is of use in exploratory searches.
+
+When --view is specified the files matching the query saved as VIEW are listed (see the 'view' subcommand). Any QUERY also specified further restricts these files.
+
+A QUERY may also refer to a saved view as 'view:VIEW', which stands for the view's query as if it were within parentheses, e.g. 'view:recent-photos and not archived'. A view may refer to other views but not, directly or indirectly, to itself. Where there is no view named VIEW, 'view:VIEW' is taken to be a tag name if there is a tag of that name and is otherwise reported as an unknown view.
+
+A query that is run frequently is added to the 'queries' directory of the virtual filesystem (see the 'mount' subcommand).
+
+When --nested is specified, the databases found in the current directory and its ancestors are all queried and the results combined. Each database contributes only those files beneath the directory containing its '.tmsu' directory, so a home-wide database can be searched together with a project-level database nested within it.
+
+Several databases may be queried at once by specifying their paths, separated by '` + string(filepath.ListSeparator) + `', with the global --database option or the TMSU_DB environment variable, or by listing them, one per line, in ~/.tmsu/databases and specifying --federated. Each file is then prefixed with the root path of the database it was found in and named relative to that root, other than with --print0, where the paths alone are listed. (In JSON each file is an object with 'root' and 'path' members.) Any --view is taken from the first database.
+
+Control characters within the names listed, such as newlines and tabs, are shown as escape sequences like '\n' so that each file occupies a single line. To pass the names to another program exactly, such as 'xargs -0' or 'tmsu tag --null-stdin', specify --print0, which lists them verbatim, each terminated by a NUL character, or use JSON.
+
+With --print each item is instead listed in the FORMAT given, in which the placeholders {path}, {id}, {tags}, {size} and {mtime} are replaced with the item's path, its file ID, its tags, separated by spaces, its size in bytes and its modification time, as recorded when it was last tagged or repaired, so that scripts can obtain exactly the details they need without running 'tags' for each file. Within FORMAT '\t' and '\n' stand for a tab and a newline, and '\\', '\{' and '\}' for a backslash and braces. Each item is followed by a newline or, with --print0, a NUL character, in which case control characters are not escaped.
+
+With --explain the files are not listed: instead the SQL generated for the query is printed, together with its parameters and the plan by which SQLite runs it, as reported by 'EXPLAIN QUERY PLAN'. A step of the plan reading 'SCAN' examines every row of a table, whereas 'SEARCH' uses an index. This is of use in understanding, and reporting, slow queries.
 
 Queries are run against the database so the results may not reflect the current state of the filesystem. Only tagged files are matched: to identify untagged files use the 'untagged' subcommand.
 
-Note: If your tag or value name contains whitespace, operators (e.g. '<') or parentheses ('(' or ')'), these must be escaped with a backslash '\', e.g. '\<tag\>' matches the tag name '<tag>'. Your shell, however, may use some punctuation for its own purposes: this can normally be avoided by enclosing the query in single quotation marks or by escaping the problem characters with a backslash.`,
+Note: If your tag or value name contains whitespace, operators (e.g. '<' or '~') or parentheses ('(' or ')'), these must be escaped with a backslash '\', e.g. '\<tag\>' matches the tag name '<tag>'. Likewise a tag or value named as an operator before it became one, such as 'in' or 'like', must have a character escaped, e.g. '\in'. Your shell, however, may use some punctuation for its own purposes: this can normally be avoided by enclosing the query in single quotation marks or by escaping the problem characters with a backslash.`,
 	Examples: []string{"$ tmsu files music mp3  # files with both 'music' and 'mp3'",
 		"$ tmsu files music and mp3  # same query but with explicit 'and'",
 		"$ tmsu files music and not mp3",
@@ -45,18 +94,50 @@ Note: If your tag or value name contains whitespace, operators (e.g. '<') or par
 		`$ tmsu files "year == 2017"`,
 		`$ tmsu files "year < 2017"`,
 		`$ tmsu files year lt 2017`,
+		`$ tmsu files "year >= 2015 and rating > 3"`,
+		`$ tmsu files "year in (2019, 2020, 2021)"`,
+		"$ tmsu files --count --group-by=year photo\nyear=2019: 204\nyear=2020: 87",
 		`$ tmsu files year`,
+		`$ tmsu files 'photo*'  # files tagged 'photo', 'photos', 'photography', &c.`,
+		`$ tmsu files --fuzzy phto  # files tagged 'photo'`,
+		`$ tmsu files mime=image/jpeg  # files detected as JPEG images`,
+		`$ tmsu files "size > 10M and ext=mp4 and mtime-after=2023-06-01"`,
+		`$ tmsu files 'name~/^IMG_\d+/ and photo'  # photos named like IMG_0042.jpg`,
+		`$ tmsu files "prop:source-url like '%flickr%'"`,
 		`$ tmsu files --path=/home/bob music`,
+		`$ tmsu files --path=photos --path=/mnt/archive/photos holiday`,
+		`$ tmsu files --sort=size --reverse --limit=10 video  # the ten largest videos`,
+		`$ tmsu files --rank beach sunset 'year >= 2020'  # files matching any, best matches first`,
+		`$ tmsu files --view recent-photos  # files matching a saved query`,
+		`$ tmsu files "view:recent-photos and not archived"  # combine a saved query with others`,
+		`$ tmsu files --nested music  # also query the databases of parent directories`,
+		`$ tmsu --database=$HOME/.tmsu/default.db:/mnt/archive/.tmsu/db files music`,
+		`$ tmsu files --federated music  # query the databases in ~/.tmsu/databases`,
+		`$ tmsu files --notes=receipt 2017  # files tagged '2017' with notes mentioning 'receipt'`,
+		`$ tmsu files --explain "music and year > 2015"`,
+		`$ tmsu files -0 music | xargs -0 mpv`,
+		"$ tmsu files --print '{id}\\t{size}\\t{path}\\t{tags}' music\n12\t4718592\tsong.mp3\tmp3 music year=2017",
 		`$ tmsu files 'contains\=equals'`,
 		`$ tmsu files '\<tag\>'`},
 	Options: Options{{"--directory", "-d", "list only items that are directories", false, ""},
 		{"--file", "-f", "list only items that are files", false, ""},
 		{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""},
 		{"--count", "-c", "lists the number of files rather than their names", false, ""},
-		{"--path", "-p", "list only items under PATH", true, ""},
+		{"--path", "-p", "list only items under PATH (may be repeated)", true, ""},
 		{"--explicit", "-e", "list only explicitly tagged files", false, ""},
-		{"--sort", "-s", "sort output: id, none, name, size, time", true, ""},
-		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""}},
+		{"--sort", "-s", "sort output: id, none, name, size, time, mtime, tag-count", true, ""},
+		{"--reverse", "-r", "reverse the sort order", false, ""},
+		{"--limit", "-l", "list at most N items", true, ""},
+		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""},
+		{"--fuzzy", "", "use the closest matching tag in place of a tag that does not exist", false, ""},
+		{"--group-by", "-g", "with --count, count the files having each value of TAG", true, ""},
+		{"--notes", "-n", "list only items with notes containing TEXT", true, ""},
+		{"--nested", "", "also query the databases of the parent directories", false, ""},
+		{"--federated", "", "query the databases listed in ~/.tmsu/databases", false, ""},
+		{"--view", "", "list the items matching the saved query VIEW", true, ""},
+		{"--rank", "", "list the items matching any of the query terms, most relevant first", false, ""},
+		{"--explain", "-x", "show the SQL for the query and how SQLite runs it rather than the files", false, ""},
+		{"--print", "", "list each item in FORMAT, e.g. '{path}\\t{size}\\t{tags}'", true, ""}},
 	Exec: filesExec,
 }
 
@@ -67,24 +148,159 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 	fileOnly := options.HasOption("--file")
 	print0 := options.HasOption("--print0")
 	showCount := options.HasOption("--count")
-	hasPath := options.HasOption("--path")
 	explicitOnly := options.HasOption("--explicit")
 	ignoreCase := options.HasOption("--ignore-case")
+	fuzzy := options.HasOption("--fuzzy")
+	format, err := newFormatter(options)
+	if err != nil {
+		return err, nil
+	}
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	notes := ""
+	if options.HasOption("--notes") {
+		notes = options.Get("--notes").Argument
+	}
 
-	sort := "name"
+	sort := ""
 	if options.HasOption("--sort") {
 		sort = options.Get("--sort").Argument
+
+		if !isFileSortType(sort) {
+			return fmt.Errorf("invalid argument '%v' for '--sort'", sort), nil
+		}
 	}
 
-	absPath := ""
-	if hasPath {
-		relPath := options.Get("--path").Argument
+	reverse := options.HasOption("--reverse")
+
+	limit := uint(0)
+	if options.HasOption("--limit") {
+		text := options.Get("--limit").Argument
+
+		value, err := strconv.ParseUint(text, 10, 0)
+		if err != nil || value == 0 {
+			return fmt.Errorf("invalid argument '%v' for '--limit'", text), nil
+		}
+
+		limit = uint(value)
+	}
 
-		var err error
-		absPath, err = filepath.Abs(relPath)
+	absPaths := make([]string, 0, 1)
+	for _, relPath := range options.Arguments("--path") {
+		if relPath == "" {
+			continue
+		}
+
+		absPath, err := filepath.Abs(relPath)
 		if err != nil {
 			return fmt.Errorf("could not get absolute path of '%v': %v'", relPath, err), nil
 		}
+
+		absPaths = append(absPaths, absPath)
+	}
+
+	groupBy := ""
+	if options.HasOption("--group-by") {
+		groupBy = options.Get("--group-by").Argument
+
+		switch {
+		case !showCount:
+			return fmt.Errorf("--group-by requires --count"), nil
+		case dirOnly || fileOnly:
+			return fmt.Errorf("--group-by cannot be combined with --directory or --file"), nil
+		}
+	}
+
+	queryText := strings.Join(args, " ")
+
+	databasePaths := filepath.SplitList(databasePath)
+	if storage.IsPostgres(databasePath) {
+		databasePaths = []string{databasePath}
+	}
+	if options.HasOption("--federated") {
+		databasePaths, err = federatedDatabasePaths()
+		if err != nil {
+			return err, nil
+		}
+	}
+	federated := len(databasePaths) > 1 || options.HasOption("--federated")
+
+	if format.print != nil {
+		switch {
+		case federated, options.HasOption("--nested"):
+			return fmt.Errorf("--print cannot be combined with multiple databases"), nil
+		case showCount, asJson, options.HasOption("--explain"):
+			return fmt.Errorf("--print cannot be combined with --count, --format=json or --explain"), nil
+		}
+	}
+
+	if options.HasOption("--rank") {
+		switch {
+		case federated, options.HasOption("--nested"):
+			return fmt.Errorf("--rank cannot be combined with multiple databases"), nil
+		case options.HasOption("--sort"), groupBy != "", options.HasOption("--explain"), options.HasOption("--view"):
+			return fmt.Errorf("--rank cannot be combined with --sort, --group-by, --explain or --view"), nil
+		case len(args) == 0:
+			return fmt.Errorf("--rank requires at least one query term"), nil
+		}
+	}
+
+	if sort == "" {
+		// the default is taken from the first database
+		sort = defaultFileSort(databasePaths[0])
+	}
+
+	if options.HasOption("--view") {
+		// views are taken from the first database
+		queryText, err = viewQueryText(databasePaths[0], options.Get("--view").Argument, queryText)
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	if options.HasOption("--explain") {
+		switch {
+		case federated, options.HasOption("--nested"):
+			return fmt.Errorf("--explain cannot be combined with multiple databases"), nil
+		case groupBy != "":
+			return fmt.Errorf("--explain cannot be combined with --group-by"), nil
+		}
+	}
+
+	if federated {
+		if options.HasOption("--nested") {
+			return fmt.Errorf("--nested cannot be combined with multiple databases"), nil
+		}
+
+		if sort == "tag-count" {
+			return fmt.Errorf("--sort=tag-count cannot be combined with multiple databases"), nil
+		}
+
+		if groupBy != "" {
+			return fmt.Errorf("--group-by cannot be combined with multiple databases"), nil
+		}
+
+		return listFederatedFilesForQuery(databasePaths, queryText, absPaths, notes, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy, format, asJson, sort, reverse, limit)
+	}
+
+	if options.HasOption("--nested") {
+		databasePaths, err := nestedDatabasePaths(databasePath)
+		if err != nil {
+			return fmt.Errorf("could not find databases: %w", err), nil
+		}
+
+		if sort == "tag-count" {
+			return fmt.Errorf("--sort=tag-count cannot be combined with --nested"), nil
+		}
+
+		if groupBy != "" {
+			return fmt.Errorf("--group-by cannot be combined with --nested"), nil
+		}
+
+		return listNestedFilesForQuery(databasePaths, queryText, absPaths, notes, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy, format, asJson, sort, reverse, limit)
 	}
 
 	store, err := openDatabase(databasePath)
@@ -99,18 +315,616 @@ func filesExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer tx.Commit()
 
-	queryText := strings.Join(args, " ")
-	return listFilesForQuery(store, tx, queryText, absPath, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, sort)
+	if options.HasOption("--explain") {
+		return explainFilesForQuery(store, tx, queryText, absPaths, notes, explicitOnly, ignoreCase, fuzzy, asJson, sort, reverse, queryLimit(limit, dirOnly, fileOnly))
+	}
+
+	if options.HasOption("--rank") {
+		return listRankedFilesForQuery(store, tx, args, absPaths, notes, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy, format, asJson, reverse, limit)
+	}
+
+	if groupBy != "" {
+		return listValueCountsForQuery(store, tx, queryText, absPaths, notes, groupBy, explicitOnly, ignoreCase, fuzzy, asJson)
+	}
+
+	return listFilesForQuery(store, tx, queryText, absPaths, notes, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy, format, asJson, sort, reverse, limit)
 }
 
 // unexported
 
-func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase bool, sort string) (error, warnings) {
+// the orders in which files may be listed
+var fileSortTypes = []string{"id", "none", "name", "size", "time", "mtime", "tag-count"}
+
+func isFileSortType(sort string) bool {
+	for _, sortType := range fileSortTypes {
+		if sort == sortType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the order configured by the database's 'defaultSort' setting, or by name where
+// the database cannot be opened, which is reported when it is queried
+func defaultFileSort(databasePath string) string {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return "name"
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return "name"
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return "name"
+	}
+
+	return settings.DefaultSort()
+}
+
+// the number of times a query is run before it is added to the queries directory
+const rememberedQueryUses = 5
+
+// the number of files read from the database at a time whilst they are listed
+const fileListingPageSize = 1000
+
+func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText string, paths []string, notes string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy bool, format *formatter, asJson bool, sort string, reverse bool, limit uint) (error, warnings) {
+	expression, warnings, err := parseCheckedQuery(store, tx, queryText, ignoreCase, fuzzy)
+	if err != nil {
+		return err, warnings
+	}
+
+	log.Info(2, "querying database")
+
+	cursor, err := store.FileCursorForQuery(tx, expression, paths, notes, explicitOnly, ignoreCase, sort, reverse, queryLimit(limit, dirOnly, fileOnly))
+	if err != nil {
+		return queryError(err), warnings
+	}
+
+	err = streamFiles(store, tx, cursor, dirOnly, fileOnly, print0, showCount, format, asJson, limit)
+	cursor.Close()
+	if err != nil {
+		return err, warnings
+	}
+
+	if queryText != "" && !store.ReadOnly() {
+		// frequently run queries are added to the virtual filesystem's queries directory
+		if err := store.UseQuery(tx, queryText, rememberedQueryUses); err != nil {
+			log.Warnf("could not record use of query: %v", err)
+		}
+	}
+
+	return nil, warnings
+}
+
+// lists the files matching any of the query terms, those matching the most terms
+// first and, of those matching as many, those matching the rarest terms
+func listRankedFilesForQuery(store *storage.Storage, tx *storage.Tx, terms []string, paths []string, notes string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy bool, format *formatter, asJson bool, reverse bool, limit uint) (error, warnings) {
+	fileCount, err := store.FileCount(tx)
+	if err != nil {
+		return fmt.Errorf("could not count files: %w", err), nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	files := make(entities.Files, 0, 100)
+	matchCounts := make(map[entities.FileId]uint)
+	rarities := make(map[entities.FileId]float64)
+
+	for _, term := range terms {
+		expression, termWarnings, err := parseCheckedQuery(store, tx, term, ignoreCase, fuzzy)
+		warnings = append(warnings, termWarnings...)
+		if err != nil {
+			return err, warnings
+		}
+
+		log.Infof(2, "querying database for '%v'", term)
+
+		termFiles, err := store.FilesForQuery(tx, expression, paths, notes, explicitOnly, ignoreCase, "none", false, 0)
+		if err != nil {
+			return queryError(err), warnings
+		}
+		if len(termFiles) == 0 {
+			continue
+		}
+
+		// the inverse document frequency: terms that fewer files match weigh more
+		rarity := math.Log(float64(fileCount) / float64(len(termFiles)))
+
+		for _, file := range termFiles {
+			if _, seen := matchCounts[file.Id]; !seen {
+				files = append(files, file)
+			}
+
+			matchCounts[file.Id]++
+			rarities[file.Id] += rarity
+		}
+	}
+
+	less := func(i, j int) bool {
+		first, second := files[i], files[j]
+		if matchCounts[first.Id] != matchCounts[second.Id] {
+			return matchCounts[first.Id] > matchCounts[second.Id]
+		}
+		if rarities[first.Id] != rarities[second.Id] {
+			return rarities[first.Id] > rarities[second.Id]
+		}
+		return first.Path() < second.Path()
+	}
+
+	if reverse {
+		sort.SliceStable(files, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(files, less)
+	}
+
+	return listFiles(store, tx, files, dirOnly, fileOnly, print0, showCount, format, asJson, limit), warnings
+}
+
+// lists the files as they are read from the cursor, so that huge results are not
+// held in memory, other than when they are arranged in columns
+func streamFiles(store *storage.Storage, tx *storage.Tx, cursor *storage.FileCursor, dirOnly, fileOnly, print0, showCount bool, format *formatter, asJson bool, limit uint) error {
+	output := bufio.NewWriter(os.Stdout)
+	defer output.Flush()
+
+	jsonPaths := newJsonArrayPrinter(output)
+	formattedPaths := make([]string, 0, 10)
+	count := uint(0)
+
+pages:
+	for {
+		files, err := cursor.Next(fileListingPageSize)
+		if err != nil {
+			return queryError(err)
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			if limit > 0 && count == limit {
+				break pages
+			}
+
+			if fileOnly && file.IsDir {
+				continue
+			}
+			if dirOnly && !file.IsDir {
+				continue
+			}
+
+			count++
+			relPath := displayPath(file.Path())
+
+			switch {
+			case showCount:
+			case asJson:
+				if err := jsonPaths.print(relPath); err != nil {
+					return err
+				}
+			case format.print != nil:
+				line, err := format.file(store, tx, file, print0)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprint(output, line, terminator(print0))
+			case print0:
+				fmt.Fprintf(output, "%v\000", relPath)
+			case format.width == 0:
+				fmt.Fprintln(output, format.path(escapeControl(relPath), file.IsDir))
+			default:
+				formattedPaths = append(formattedPaths, format.path(escapeControl(relPath), file.IsDir))
+			}
+		}
+	}
+
+	switch {
+	case asJson && showCount:
+		output.Flush()
+		return printJson(count)
+	case asJson:
+		jsonPaths.close()
+	case showCount:
+		fmt.Fprintln(output, count)
+	case print0, format.print != nil, format.width == 0:
+	default:
+		output.Flush()
+		format.printColumnsInOrder(formattedPaths)
+	}
+
+	return nil
+}
+
+// lists the number of files matching the query to which each value of the tag is applied
+func listValueCountsForQuery(store *storage.Storage, tx *storage.Tx, queryText string, paths []string, notes, tagName string, explicitOnly, ignoreCase, fuzzy, asJson bool) (error, warnings) {
+	tag, err := store.TagByNameOrAlias(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), nil
+	}
+	if tag == nil {
+		return NoSuchTagError{tagName}, nil
+	}
+
+	expression, warnings, err := parseCheckedQuery(store, tx, queryText, ignoreCase, fuzzy)
+	if err != nil {
+		return err, warnings
+	}
+
+	log.Info(2, "querying database")
+
+	counts, err := store.FileCountsByValueForQuery(tx, expression, paths, notes, explicitOnly, ignoreCase, tag.Id)
+	if err != nil {
+		return queryError(err), warnings
+	}
+
+	if asJson {
+		jsonCounts := make([]jsonValueFileCount, len(counts))
+		for index, count := range counts {
+			jsonCounts[index] = jsonValueFileCount{count.Name, count.FileCount}
+		}
+
+		if err := printJson(jsonCounts); err != nil {
+			return err, warnings
+		}
+
+		return nil, warnings
+	}
+
+	for _, count := range counts {
+		fmt.Printf("%v: %v\n", formatTagValueName(tag.Name, count.Name, false, false, false), count.FileCount)
+	}
+
+	return nil, warnings
+}
+
+// prints the SQL for the query, its parameters and SQLite's plan for running it
+func explainFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText string, paths []string, notes string, explicitOnly, ignoreCase, fuzzy, asJson bool, sort string, reverse bool, limit uint) (error, warnings) {
+	expression, warnings, err := parseCheckedQuery(store, tx, queryText, ignoreCase, fuzzy)
+	if err != nil {
+		return err, warnings
+	}
+
+	log.Info(2, "explaining query")
+
+	plan, err := store.ExplainFilesForQuery(tx, expression, paths, notes, explicitOnly, ignoreCase, sort, reverse, limit)
+	if err != nil {
+		return queryError(err), warnings
+	}
+
+	if asJson {
+		jsonSteps := make([]jsonQueryPlanStep, len(plan.Steps))
+		for index, step := range plan.Steps {
+			jsonSteps[index] = jsonQueryPlanStep{step.Id, step.Parent, step.Detail}
+		}
+
+		if err := printJson(jsonQueryPlan{strings.TrimSpace(plan.Sql), plan.Params, jsonSteps}); err != nil {
+			return err, warnings
+		}
+
+		return nil, warnings
+	}
+
+	fmt.Println("SQL:")
+	fmt.Println()
+	fmt.Println(strings.TrimSpace(plan.Sql))
+
+	if len(plan.Params) > 0 {
+		fmt.Println()
+		fmt.Println("Parameters:")
+		fmt.Println()
+
+		for index, param := range plan.Params {
+			if text, ok := param.(string); ok {
+				fmt.Printf("  ?%v = %q\n", index+1, text)
+			} else {
+				fmt.Printf("  ?%v = %v\n", index+1, param)
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Plan:")
+	fmt.Println()
+
+	depths := make(map[int]int, len(plan.Steps))
+	for _, step := range plan.Steps {
+		depth := 0
+		if parentDepth, ok := depths[step.Parent]; ok {
+			depth = parentDepth + 1
+		}
+		depths[step.Id] = depth
+
+		fmt.Printf("  %v%v\n", strings.Repeat("  ", depth), step.Detail)
+	}
+
+	return nil, warnings
+}
+
+// the query of the named view, restricted by any further query
+func viewQueryText(databasePath, name, queryText string) (string, error) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Commit()
+
+	viewText, err := viewQuery(store, tx, name)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.TrimSpace(queryText) == "":
+		return viewText, nil
+	case strings.TrimSpace(viewText) == "":
+		return queryText, nil
+	}
+
+	return "(" + viewText + ") and (" + queryText + ")", nil
+}
+
+// lists the union of the files matching the query in each of the databases
+func listNestedFilesForQuery(databasePaths []string, queryText string, paths []string, notes string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy bool, format *formatter, asJson bool, sort string, reverse bool, limit uint) (error, warnings) {
+	files, _, warnings, err := queryDatabasesFiles(databasePaths, queryText, paths, notes, dirOnly, fileOnly, explicitOnly, ignoreCase, fuzzy, sort, reverse, limit)
+	if err != nil {
+		return err, nil
+	}
+
+	if err := listFiles(nil, nil, files, dirOnly, fileOnly, print0, showCount, format, asJson, limit); err != nil {
+		return err, warnings
+	}
+
+	return nil, warnings
+}
+
+// lists the union of the files matching the query in each of the databases,
+// prefixed with the root path of the database they were found in
+func listFederatedFilesForQuery(databasePaths []string, queryText string, paths []string, notes string, dirOnly, fileOnly, print0, showCount, explicitOnly, ignoreCase, fuzzy bool, format *formatter, asJson bool, sort string, reverse bool, limit uint) (error, warnings) {
+	// databases on drives that are not mounted are skipped
+	warnings := make(warnings, 0, 10)
+	availablePaths := make([]string, 0, len(databasePaths))
+	for _, databasePath := range databasePaths {
+		if _, err := os.Stat(databasePath); err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: skipping unavailable database: %w", databasePath, err))
+			continue
+		}
+
+		availablePaths = append(availablePaths, databasePath)
+	}
+	if len(availablePaths) == 0 {
+		return errNoDatabase, warnings
+	}
+
+	files, rootPaths, queryWarnings, err := queryDatabasesFiles(availablePaths, queryText, paths, notes, dirOnly, fileOnly, explicitOnly, ignoreCase, fuzzy, sort, reverse, limit)
+	if err != nil {
+		return err, warnings
+	}
+	warnings = append(warnings, queryWarnings...)
+
+	if err := listFederatedFiles(files, rootPaths, dirOnly, fileOnly, print0, showCount, format, asJson, limit); err != nil {
+		return err, warnings
+	}
+
+	return nil, warnings
+}
+
+// queries each of the databases, returning the union of the files found, in
+// order, along with the root path of the database that each was found in
+func queryDatabasesFiles(databasePaths []string, queryText string, paths []string, notes string, dirOnly, fileOnly, explicitOnly, ignoreCase, fuzzy bool, sort string, reverse bool, limit uint) (entities.Files, map[string]string, warnings, error) {
+	files := make(entities.Files, 0, 10)
+	rootPaths := make(map[string]string, 10)
+
+	// only warn of problems, such as unknown tags, common to every database
+	warningCounts := make(map[string]int, 10)
+	allWarnings := make(warnings, 0, 10)
+	queried := 0
+
+	for _, databasePath := range databasePaths {
+		log.Infof(2, "querying database '%v'", databasePath)
+
+		dbFiles, dbWarnings, rootPath, err := queryDatabaseFiles(databasePath, queryText, paths, notes, explicitOnly, ignoreCase, fuzzy, sort, reverse, queryLimit(limit, dirOnly, fileOnly))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%v: %w", databasePath, err)
+		}
+		if rootPath == "" {
+			continue
+		}
+
+		queried++
+
+		for _, warning := range dbWarnings {
+			if warningCounts[warning.Error()] == 0 {
+				allWarnings = append(allWarnings, warning)
+			}
+			warningCounts[warning.Error()]++
+		}
+
+		for _, file := range dbFiles {
+			if _, ok := rootPaths[file.Path()]; ok {
+				continue
+			}
+
+			rootPaths[file.Path()] = rootPath
+			files = append(files, file)
+		}
+	}
+
+	warnings := make(warnings, 0, len(allWarnings))
+	for _, warning := range allWarnings {
+		if warningCounts[warning.Error()] == queried {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	sortFiles(files, sort, reverse)
+
+	return files, rootPaths, warnings, nil
+}
+
+// queries the files of a database that lie beneath its root path, which is
+// returned alongside or is empty if the path is outside of it
+func queryDatabaseFiles(databasePath, queryText string, paths []string, notes string, explicitOnly, ignoreCase, fuzzy bool, sort string, reverse bool, limit uint) (entities.Files, warnings, string, error) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer store.Close()
+
+	scopedPaths, ok := scopePaths(paths, store.RootPath)
+	if !ok {
+		log.Infof(2, "skipping database '%v' as '%v' is outside of its root path", databasePath, strings.Join(paths, "', '"))
+		return nil, nil, "", nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer tx.Commit()
+
+	files, warnings, err := queryFiles(store, tx, queryText, scopedPaths, notes, explicitOnly, ignoreCase, fuzzy, sort, reverse, limit)
+	return files, warnings, store.RootPath, err
+}
+
+// determines the narrower of each of the specified paths and a database's root
+// path, omitting those for which neither path contains the other, or false if
+// no paths remain
+func scopePaths(paths []string, rootPath string) ([]string, bool) {
+	if len(paths) == 0 {
+		return []string{rootPath}, true
+	}
+
+	scopedPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if scopedPath, ok := scopePath(path, rootPath); ok {
+			scopedPaths = append(scopedPaths, scopedPath)
+		}
+	}
+
+	return scopedPaths, len(scopedPaths) > 0
+}
+
+// determines the narrower of the specified path and a database's root path,
+// or false if neither path contains the other
+func scopePath(path, rootPath string) (string, bool) {
+	switch {
+	case path == "":
+		return rootPath, true
+	case isWithin(path, rootPath):
+		return path, true
+	case isWithin(rootPath, path):
+		return rootPath, true
+	}
+
+	return "", false
+}
+
+func isWithin(path, parentPath string) bool {
+	rel, err := filepath.Rel(parentPath, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// the limit to query the database with: files are filtered by type only once
+// retrieved so the limit cannot be applied by the database in that case
+func queryLimit(limit uint, dirOnly, fileOnly bool) uint {
+	if dirOnly || fileOnly {
+		return 0
+	}
+
+	return limit
+}
+
+func sortFiles(files entities.Files, sortType string, reverse bool) {
+	var less func(i, j int) bool
+
+	switch sortType {
+	case "name":
+		less = func(i, j int) bool { return files[i].Path() < files[j].Path() }
+	case "time", "mtime":
+		less = func(i, j int) bool {
+			if !files[i].ModTime.Equal(files[j].ModTime) {
+				return files[i].ModTime.Before(files[j].ModTime)
+			}
+			return files[i].Path() < files[j].Path()
+		}
+	case "size":
+		less = func(i, j int) bool {
+			if files[i].Size != files[j].Size {
+				return files[i].Size < files[j].Size
+			}
+			return files[i].Path() < files[j].Path()
+		}
+	default:
+		return
+	}
+
+	if reverse {
+		sort.SliceStable(files, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.SliceStable(files, less)
+	}
+}
+
+func queryFiles(store *storage.Storage, tx *storage.Tx, queryText string, paths []string, notes string, explicitOnly, ignoreCase, fuzzy bool, sort string, reverse bool, limit uint) (entities.Files, warnings, error) {
+	expression, warnings, err := parseCheckedQuery(store, tx, queryText, ignoreCase, fuzzy)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	log.Info(2, "querying database")
+
+	files, err := store.FilesForQuery(tx, expression, paths, notes, explicitOnly, ignoreCase, sort, reverse, limit)
+	if err != nil {
+		return nil, warnings, queryError(err)
+	}
+
+	return files, warnings, nil
+}
+
+// parses the query, reporting the tags and values within it that do not exist,
+// and replacing them with the closest existing tags if fuzzy is specified
+func parseCheckedQuery(store *storage.Storage, tx *storage.Tx, queryText string, ignoreCase, fuzzy bool) (query.Expression, warnings, error) {
 	log.Info(2, "parsing query")
 
 	expression, err := query.Parse(queryText)
 	if err != nil {
-		return fmt.Errorf("could not parse query: %v", err), nil
+		return nil, nil, fmt.Errorf("could not parse query: %w", err)
+	}
+
+	expression, err = store.ExpandViews(tx, expression)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not expand views: %w", err)
+	}
+
+	expression, err = store.ResolveAliases(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not resolve aliases: %w", err)
+	}
+
+	expression, err = store.ResolveTagNames(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not resolve tag names: %w", err)
+	}
+
+	expression, err = store.ExpandTagPrefixes(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not expand tag prefixes: %w", err)
 	}
 
 	log.Info(2, "checking tag names")
@@ -119,61 +933,204 @@ func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path s
 
 	tagNames, err := query.TagNames(expression)
 	if err != nil {
-		return fmt.Errorf("could not identify tag names: %v", err), nil
+		return nil, nil, fmt.Errorf("could not identify tag names: %w", err)
 	}
 
 	tags, err := store.TagsByCasedNames(tx, tagNames, ignoreCase)
+	corrections := make(map[string]string)
 	for _, tagName := range tagNames {
-		if err := entities.ValidateTagName(tagName); err != nil {
-			warnings = append(warnings, err.Error())
-			continue
+		// an existing tag may have a name that is no longer valid, such as 'in'
+		if !tags.ContainsCasedName(tagName, ignoreCase) {
+			if err := entities.ValidateTagName(tagName); err != nil {
+				warnings = append(warnings, err)
+				continue
+			}
 		}
 
-		if !tags.ContainsCasedName(tagName, ignoreCase) {
-			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
-			continue
+		if !tags.ContainsCasedName(tagName, ignoreCase) && !entities.IsBuiltInTagName(tagName) && tagName != entities.NameTagName && !entities.IsPropertyTagName(tagName) {
+			if _, corrected := corrections[tagName]; corrected {
+				continue
+			}
+
+			similarNames, err := store.SimilarTagNames(tx, tagName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not retrieve similar tag names: %w", err)
+			}
+
+			switch {
+			case len(similarNames) == 0:
+				warnings = append(warnings, NoSuchTagError{tagName})
+			case fuzzy:
+				log.Warnf("no such tag '%v': using '%v'", tagName, similarNames[0])
+				corrections[tagName] = similarNames[0]
+			default:
+				warnings = append(warnings, fmt.Errorf("%w: did you mean %v?", NoSuchTagError{tagName}, quotedList(similarNames)))
+			}
 		}
 	}
 
+	if len(corrections) > 0 {
+		expression = query.MapTagNames(expression, func(name string) string {
+			if correction, ok := corrections[name]; ok {
+				return correction
+			}
+
+			return name
+		})
+	}
+
+	expression, err = store.ResolveValueTypes(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	valueNames, err := query.ExactValueNames(expression)
 	if err != nil {
-		return fmt.Errorf("could not identify value names: %v", err), nil
+		return nil, nil, fmt.Errorf("could not identify value names: %w", err)
+	}
+
+	// MIME types and other file attributes are not stored as values
+	attributeValues := make(map[string]bool)
+	for _, tagName := range append(entities.BuiltInTagNames, entities.NameTagName) {
+		for _, valueName := range query.ComparedValueNames(expression, tagName) {
+			attributeValues[valueName] = true
+
+			if !tags.ContainsCasedName(tagName, ignoreCase) {
+				if err := entities.ValidateAttributeValue(tagName, valueName); err != nil {
+					warnings = append(warnings, err)
+				}
+			}
+		}
+	}
+
+	// nor are the values of properties, which are free text
+	propertyValues := make(map[string]bool)
+	for _, tagName := range tagNames {
+		if entities.IsPropertyTagName(tagName) {
+			for _, valueName := range query.ComparedValueNames(expression, tagName) {
+				propertyValues[valueName] = true
+			}
+		}
 	}
 
 	values, err := store.ValuesByCasedNames(tx, valueNames, ignoreCase)
 	for _, valueName := range valueNames {
-		if err := entities.ValidateValueName(valueName); err != nil {
-			warnings = append(warnings, err.Error())
+		if propertyValues[valueName] {
 			continue
 		}
 
 		if !values.ContainsCasedName(valueName, ignoreCase) {
-			warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
+			if err := entities.ValidateValueName(valueName); err != nil {
+				warnings = append(warnings, err)
+				continue
+			}
+		}
+
+		if !values.ContainsCasedName(valueName, ignoreCase) && !attributeValues[valueName] {
+			warnings = append(warnings, NoSuchValueError{valueName})
 			continue
 		}
 	}
 
-	log.Info(2, "querying database")
+	return expression, warnings, nil
+}
 
-	files, err := store.FilesForQuery(tx, expression, path, explicitOnly, ignoreCase, sort)
-	if err != nil {
-		if strings.Index(err.Error(), "parser stack overflow") > -1 {
-			return fmt.Errorf("the query is too complex (see the troubleshooting wiki for how to increase the stack size)"), warnings
+func queryError(err error) error {
+	if strings.Index(err.Error(), "parser stack overflow") > -1 {
+		return fmt.Errorf("the query is too complex (see the troubleshooting wiki for how to increase the stack size)")
+	}
+
+	return fmt.Errorf("could not query files: %w", err)
+}
+
+// lists up to three names, quoted, as alternatives, e.g. "'a', 'b' or 'c'"
+func quotedList(names []string) string {
+	if len(names) > 3 {
+		names = names[:3]
+	}
+
+	quoted := make([]string, len(names))
+	for index, name := range names {
+		quoted[index] = "'" + name + "'"
+	}
+
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+func listFiles(store *storage.Storage, tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool, format *formatter, asJson bool, limit uint) error {
+	relPaths := make([]string, 0, len(files))
+	formattedPaths := make([]string, 0, len(files))
+	for _, file := range files {
+		if limit > 0 && uint(len(relPaths)) == limit {
+			break
+		}
+
+		if fileOnly && file.IsDir {
+			continue
 		}
+		if dirOnly && !file.IsDir {
+			continue
+		}
+
+		absPath := file.Path()
+		relPath := displayPath(absPath)
 
-		return fmt.Errorf("could not query files: %v", err), warnings
+		formattedPath := format.path(escapeControl(relPath), file.IsDir)
+		if format.print != nil {
+			line, err := format.file(store, tx, file, print0)
+			if err != nil {
+				return err
+			}
+
+			formattedPath = line
+		}
+
+		relPaths = append(relPaths, relPath)
+		formattedPaths = append(formattedPaths, formattedPath)
 	}
 
-	if err = listFiles(tx, files, dirOnly, fileOnly, print0, showCount); err != nil {
-		return err, warnings
+	switch {
+	case asJson && showCount:
+		return printJson(len(relPaths))
+	case asJson:
+		return printJson(relPaths)
+	case showCount:
+		fmt.Println(len(relPaths))
+	case format.print != nil:
+		for _, line := range formattedPaths {
+			fmt.Print(line, terminator(print0))
+		}
+	case print0:
+		for _, relPath := range relPaths {
+			fmt.Printf("%v\000", relPath)
+		}
+	default:
+		format.printColumnsInOrder(formattedPaths)
 	}
 
-	return nil, warnings
+	return nil
+}
+
+type jsonFederatedFile struct {
+	Root string `json:"root"`
+	Path string `json:"path"`
 }
 
-func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool) error {
+// lists the files, each prefixed with the root path of its database and named
+// relative to it, other than with --print0 where the paths alone are listed
+func listFederatedFiles(files entities.Files, rootPaths map[string]string, dirOnly, fileOnly, print0, showCount bool, format *formatter, asJson bool, limit uint) error {
+	jsonFiles := make([]jsonFederatedFile, 0, len(files))
 	relPaths := make([]string, 0, len(files))
+	lines := make([]string, 0, len(files))
 	for _, file := range files {
+		if limit > 0 && uint(len(relPaths)) == limit {
+			break
+		}
+
 		if fileOnly && file.IsDir {
 			continue
 		}
@@ -182,26 +1139,49 @@ func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0,
 		}
 
 		absPath := file.Path()
-		relPath := path.Rel(absPath)
+		rootPath := rootPaths[absPath]
 
+		rootRelPath, err := filepath.Rel(rootPath, absPath)
+		if err != nil {
+			rootRelPath = absPath
+		}
+
+		relPath := displayPath(absPath)
+
+		jsonFiles = append(jsonFiles, jsonFederatedFile{rootPath, relPath})
 		relPaths = append(relPaths, relPath)
+		lines = append(lines, escapeControl(rootPath)+": "+format.path(escapeControl(rootRelPath), file.IsDir))
 	}
 
-	if showCount {
+	switch {
+	case asJson && showCount:
+		return printJson(len(relPaths))
+	case asJson:
+		return printJson(jsonFiles)
+	case showCount:
 		fmt.Println(len(relPaths))
-	} else {
+	case print0:
 		for _, relPath := range relPaths {
-			if print0 {
-				fmt.Printf("%v\000", relPath)
-			} else {
-				fmt.Println(relPath)
-			}
+			fmt.Printf("%v\000", relPath)
+		}
+	default:
+		for _, line := range lines {
+			fmt.Println(line)
 		}
 	}
 
 	return nil
 }
 
+// the text that ends each item listed
+func terminator(print0 bool) string {
+	if print0 {
+		return "\000"
+	}
+
+	return "\n"
+}
+
 func containsTag(tags []string, tag string) bool {
 	for _, iteratedTag := range tags {
 		if iteratedTag == tag {
@@ -0,0 +1,505 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/collation"
+	"github.com/oniony/TMSU/common/terminal"
+	"github.com/oniony/TMSU/common/terminal/ansi"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unexported
+
+type jsonTag struct {
+	Name        string     `json:"name"`
+	Value       string     `json:"value,omitempty"`
+	Explicit    bool       `json:"explicit"`
+	Implicit    bool       `json:"implicit"`
+	ImpliedBy   []string   `json:"impliedBy,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Colour      string     `json:"color,omitempty"`
+	Icon        string     `json:"icon,omitempty"`
+	Applied     *time.Time `json:"applied,omitempty"`
+	AppliedBy   string     `json:"appliedBy,omitempty"`
+}
+
+type jsonTagInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Colour      string `json:"color,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+type jsonTagGroup struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+type jsonFileTags struct {
+	Path string    `json:"path"`
+	Tags []jsonTag `json:"tags"`
+}
+
+type jsonFileTagCount struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+type jsonTagValues struct {
+	Tag    string   `json:"tag"`
+	Values []string `json:"values"`
+}
+
+type jsonTagValueCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type jsonValueTags struct {
+	Value string   `json:"value"`
+	Tags  []string `json:"tags"`
+}
+
+type jsonValueTagCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type jsonTagFileCount struct {
+	Tag   string `json:"tag"`
+	Count uint   `json:"count"`
+}
+
+type jsonTagTreeNode struct {
+	Tag      string            `json:"tag"`
+	Count    uint              `json:"count"`
+	Children []jsonTagTreeNode `json:"children"`
+}
+
+type jsonValueFileCount struct {
+	Value string `json:"value"`
+	Count uint   `json:"count"`
+}
+
+type jsonQueryPlan struct {
+	Sql    string              `json:"sql"`
+	Params []interface{}       `json:"params"`
+	Plan   []jsonQueryPlanStep `json:"plan"`
+}
+
+type jsonQueryPlanStep struct {
+	Id     int    `json:"id"`
+	Parent int    `json:"parent"`
+	Detail string `json:"detail"`
+}
+
+type jsonTagPairFileCount struct {
+	Tags  []string `json:"tags"`
+	Count uint     `json:"count"`
+}
+
+type jsonStats struct {
+	DatabaseSize  int64                  `json:"databaseSize"`
+	UntaggedCount uint                   `json:"untaggedCount"`
+	Tags          []jsonTagFileCount     `json:"tags"`
+	Pairs         []jsonTagPairFileCount `json:"pairs"`
+}
+
+type jsonImplication struct {
+	Tag          string `json:"tag"`
+	Value        string `json:"value,omitempty"`
+	ImpliedTag   string `json:"impliedTag"`
+	ImpliedValue string `json:"impliedValue,omitempty"`
+}
+
+type jsonView struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+type jsonInfo struct {
+	Database string             `json:"database"`
+	RootPath string             `json:"rootPath"`
+	Size     *int64             `json:"size,omitempty"`
+	Stats    *jsonInfoStats     `json:"stats,omitempty"`
+	Usage    []jsonTagFileCount `json:"usage,omitempty"`
+}
+
+type jsonInfoStats struct {
+	Tags            uint    `json:"tags"`
+	Values          uint    `json:"values"`
+	Files           uint    `json:"files"`
+	Taggings        uint    `json:"taggings"`
+	MeanTagsPerFile float32 `json:"meanTagsPerFile"`
+	MeanFilesPerTag float32 `json:"meanFilesPerTag"`
+}
+
+type jsonStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+type jsonMount struct {
+	DatabasePath string `json:"database,omitempty"`
+	MountPath    string `json:"mountPoint"`
+	Connected    bool   `json:"connected"`
+}
+
+type jsonDuplicates struct {
+	Path       string   `json:"path"`
+	Duplicates []string `json:"duplicates"`
+}
+
+type jsonQueryDiff struct {
+	OnlyFirst  []string `json:"onlyFirst"`
+	OnlySecond []string `json:"onlySecond"`
+	Both       []string `json:"both"`
+}
+
+type jsonHookEvent struct {
+	Event     string       `json:"event"`
+	Database  string       `json:"database"`
+	Arguments []string     `json:"arguments"`
+	Changes   []jsonChange `json:"changes,omitempty"`
+}
+
+type jsonChange struct {
+	Kind    string `json:"change"`
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	Value   string `json:"value,omitempty"`
+}
+
+type jsonFileProperties struct {
+	Path       string            `json:"path"`
+	Properties map[string]string `json:"properties"`
+}
+
+// formatter renders textual output according to the --color, --columns and --print options
+type formatter struct {
+	colour   bool
+	width    int                 // width to arrange columns within, or zero for one item per line
+	print    printFormat         // format of each file listed, or nil to list just the paths
+	collator *collation.Collator // order in which names are listed, or nil for binary order
+}
+
+func newFormatter(options Options) (*formatter, error) {
+	colour, err := useColour(options)
+	if err != nil {
+		return nil, err
+	}
+
+	width, err := columnsWidth(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var print printFormat
+	if options.HasOption("--print") {
+		if print, err = parsePrintFormat(options.Get("--print").Argument); err != nil {
+			return nil, err
+		}
+	}
+
+	return &formatter{colour, width, print, nil}, nil
+}
+
+func columnsWidth(options Options) (int, error) {
+	when := "auto"
+	if options.HasOption("--columns") {
+		when = options.Get("--columns").Argument
+	}
+
+	switch when {
+	case "", "auto":
+		if !stdoutIsCharDevice() {
+			return 0, nil
+		}
+
+		return terminal.Width(), nil
+	case "always":
+		if width := terminal.Width(); width > 0 {
+			return width, nil
+		}
+
+		return defaultColumnsWidth, nil
+	case "never":
+		return 0, nil
+	}
+
+	width, err := strconv.Atoi(when)
+	if err != nil || width < 1 {
+		return 0, fmt.Errorf("invalid argument '%v' for '--columns'", when)
+	}
+
+	return width, nil
+}
+
+const defaultColumnsWidth = 80
+
+// Lists names in the order of the database's configured collation.
+func (format *formatter) useCollation(store *storage.Storage, tx *storage.Tx) error {
+	collator, err := store.Collator(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve collation: %w", err)
+	}
+
+	format.collator = collator
+
+	return nil
+}
+
+func (format *formatter) printColumns(items []string) {
+	if format.collator != nil {
+		ansi.SortBy(items, format.collator.Less)
+	} else {
+		ansi.Sort(items)
+	}
+	format.printColumnsInOrder(items)
+}
+
+func (format *formatter) printColumnsInOrder(items []string) {
+	if format.width == 0 {
+		for _, item := range items {
+			fmt.Println(item)
+		}
+
+		return
+	}
+
+	terminal.PrintColumnsInOrder(items, format.width)
+}
+
+func (format *formatter) path(path string, isDir bool) string {
+	if format.colour && isDir {
+		return ansi.Blue(path)
+	}
+
+	return path
+}
+
+func (format *formatter) status(status Status) string {
+	if !format.colour {
+		return string(status)
+	}
+
+	switch status {
+	case TAGGED:
+		return ansi.Green(string(status))
+	case MODIFIED:
+		return ansi.Yellow(string(status))
+	case MISSING:
+		return ansi.Red(string(status))
+	}
+
+	return string(status)
+}
+
+// renders the file according to the --print format, looking up its tags only
+// where the format includes them; control characters within the path and tags
+// are escaped unless listing with --print0
+func (format *formatter) file(store *storage.Storage, tx *storage.Tx, file *entities.File, print0 bool) (string, error) {
+	escapeText := escapeControl
+	if print0 {
+		escapeText = func(text string) string { return text }
+	}
+
+	var builder strings.Builder
+	for _, part := range format.print {
+		if !part.placeholder {
+			builder.WriteString(part.text)
+			continue
+		}
+
+		switch part.text {
+		case "path":
+			builder.WriteString(escapeText(displayPath(file.Path())))
+		case "id":
+			builder.WriteString(strconv.FormatUint(uint64(file.Id), 10))
+		case "tags":
+			tagNames, err := tagNamesForFile(store, tx, file.Id, "", false, false, false, nil)
+			if err != nil {
+				return "", err
+			}
+
+			builder.WriteString(escapeText(strings.Join(tagNames, " ")))
+		case "size":
+			builder.WriteString(strconv.FormatInt(file.Size, 10))
+		case "mtime":
+			builder.WriteString(file.ModTime.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// the placeholders of a --print format
+var printPlaceholders = []string{"path", "id", "tags", "size", "mtime"}
+
+// a --print format: literal text interspersed with placeholders
+type printFormat []printPart
+
+type printPart struct {
+	text        string
+	placeholder bool
+}
+
+// parses a --print format, in which '\t', '\n' and '\\' stand for a tab, a
+// newline and a backslash and '\{' for a literal brace
+func parsePrintFormat(text string) (printFormat, error) {
+	if text == "" {
+		return nil, fmt.Errorf("print format must not be empty")
+	}
+
+	parts := make(printFormat, 0, 5)
+	literal := make([]rune, 0, len(text))
+	runes := []rune(text)
+	for index := 0; index < len(runes); index++ {
+		switch r := runes[index]; r {
+		case '\\':
+			if index+1 == len(runes) {
+				literal = append(literal, r)
+				break
+			}
+
+			index++
+			switch next := runes[index]; next {
+			case 't':
+				literal = append(literal, '\t')
+			case 'n':
+				literal = append(literal, '\n')
+			case '\\', '{', '}':
+				literal = append(literal, next)
+			default:
+				literal = append(literal, r, next)
+			}
+		case '{':
+			end := strings.IndexRune(string(runes[index+1:]), '}')
+			if end == -1 {
+				return nil, fmt.Errorf("invalid print format '%v': unterminated placeholder", text)
+			}
+
+			name := string(runes[index+1:])[:end]
+			if !isPrintPlaceholder(name) {
+				return nil, fmt.Errorf("invalid print format '%v': unknown placeholder '{%v}': supported placeholders are {%v}", text, name, strings.Join(printPlaceholders, "}, {"))
+			}
+
+			if len(literal) > 0 {
+				parts = append(parts, printPart{string(literal), false})
+				literal = literal[:0]
+			}
+			parts = append(parts, printPart{name, true})
+
+			index += len([]rune(name)) + 1
+		case '}':
+			return nil, fmt.Errorf("invalid print format '%v': unexpected '}'", text)
+		default:
+			literal = append(literal, r)
+		}
+	}
+
+	if len(literal) > 0 {
+		parts = append(parts, printPart{string(literal), false})
+	}
+
+	return parts, nil
+}
+
+func isPrintPlaceholder(name string) bool {
+	for _, placeholder := range printPlaceholders {
+		if name == placeholder {
+			return true
+		}
+	}
+
+	return false
+}
+
+func useJson(options Options) (bool, error) {
+	format := "text"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
+	}
+
+	switch format {
+	case "", "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+
+	return false, fmt.Errorf("invalid argument '%v' for '--format'", format)
+}
+
+func printJson(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("could not encode output: %w", err)
+	}
+
+	return nil
+}
+
+// prints a JSON array an element at a time, as printJson would print the whole
+// array, so that its elements need not all be held at once
+type jsonArrayPrinter struct {
+	writer io.Writer
+	count  int
+}
+
+func newJsonArrayPrinter(writer io.Writer) *jsonArrayPrinter {
+	return &jsonArrayPrinter{writer, 0}
+}
+
+func (printer *jsonArrayPrinter) print(value interface{}) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("could not encode output: %w", err)
+	}
+
+	separator := ","
+	if printer.count == 0 {
+		separator = "["
+	}
+	printer.count++
+
+	fmt.Fprint(printer.writer, separator, strings.TrimSuffix(buffer.String(), "\n"))
+	return nil
+}
+
+func (printer *jsonArrayPrinter) close() {
+	if printer.count == 0 {
+		fmt.Fprint(printer.writer, "[")
+	}
+
+	fmt.Fprintln(printer.writer, "]")
+}
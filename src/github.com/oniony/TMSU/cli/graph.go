@@ -0,0 +1,239 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strconv"
+	"strings"
+)
+
+var GraphCommand = Command{
+	Name:     "graph",
+	Synopsis: "Exports the tag taxonomy as a graph",
+	Usages:   []string{"tmsu graph [OPTION]..."},
+	Description: `Writes the tags, their implications and how often they are applied together to standard output as a graph for visualization with tools such as Graphviz or Gephi.
+
+Each tag is a node labelled with the number of files it is explicitly applied to, so that tags applied to no files stand out. Each implication is a directed edge from the implying tag to the implied tag, tags with values appearing as separate TAG=VALUE nodes. Each pair of tags applied to the same files is an undirected edge weighted by the number of files and with a strength, between 0 and 1, of the proportion of the files tagged with either that are tagged with both: pairs of similar strength may be redundant.
+
+The global --format option selects the format of the graph: 'dot' for Graphviz, which is the default, or 'graphml' for GraphML.
+
+Edges between tags applied together to fewer than N files are omitted if --min-files is specified.`,
+	Examples: []string{"$ tmsu graph | dot -Tsvg >tags.svg",
+		"$ tmsu graph --format=graphml --min-files=5 >tags.graphml"},
+	Options: Options{{"--min-files", "-m", "omit edges between tags applied together to fewer than N files", true, ""}},
+	Exec:    graphExec,
+}
+
+// unexported
+
+type graphNode struct {
+	name      string
+	fileCount uint
+	isTag     bool
+}
+
+type graphEdge struct {
+	from, to    string
+	implication bool
+	fileCount   uint
+	strength    float64
+}
+
+func graphExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	format := "dot"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
+	}
+
+	switch format {
+	case "dot", "graphml":
+	default:
+		return fmt.Errorf("invalid argument '%v' for '--format': must be 'dot' or 'graphml'", format), nil
+	}
+
+	var minFiles uint = 1
+	if options.HasOption("--min-files") {
+		text := options.Get("--min-files").Argument
+
+		value, err := strconv.ParseUint(text, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid argument '%v' for '--min-files'", text), nil
+		}
+
+		minFiles = uint(value)
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	nodes, edges, err := tagGraph(store, tx, minFiles)
+	if err != nil {
+		return err, nil
+	}
+
+	switch format {
+	case "graphml":
+		printGraphml(nodes, edges)
+	default:
+		printDot(nodes, edges)
+	}
+
+	return nil, nil
+}
+
+// the tags, and the tag and value pairs of the implications, together with the
+// implications and the pairs of tags applied to at least minFiles files
+func tagGraph(store *storage.Storage, tx *storage.Tx, minFiles uint) ([]graphNode, []graphEdge, error) {
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve tags: %w", err)
+	}
+
+	tagUsages, err := store.TagUsage(tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve tag usage: %w", err)
+	}
+
+	fileCounts := make(map[entities.TagId]uint, len(tagUsages))
+	for _, tagUsage := range tagUsages {
+		fileCounts[tagUsage.Id] = tagUsage.FileCount
+	}
+
+	nodes := make([]graphNode, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		nodes = append(nodes, graphNode{tag.Name, fileCounts[tag.Id], true})
+		seen[tag.Name] = true
+	}
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve implications: %w", err)
+	}
+
+	edges := make([]graphEdge, 0, len(implications))
+	for _, implication := range implications {
+		implying := formatTagValueName(implication.ImplyingTag.Name, implication.ImplyingValue.Name, false, false, false)
+		implied := formatTagValueName(implication.ImpliedTag.Name, implication.ImpliedValue.Name, false, false, false)
+
+		for _, name := range []string{implying, implied} {
+			if !seen[name] {
+				nodes = append(nodes, graphNode{name, 0, false})
+				seen[name] = true
+			}
+		}
+
+		edges = append(edges, graphEdge{implying, implied, true, 0, 0})
+	}
+
+	pairUsages, err := store.TagPairUsage(tx, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve tag pair usage: %w", err)
+	}
+
+	for _, pairUsage := range pairUsages {
+		if pairUsage.FileCount < minFiles {
+			continue
+		}
+
+		union := fileCounts[pairUsage.TagId] + fileCounts[pairUsage.OtherTagId] - pairUsage.FileCount
+		strength := float64(pairUsage.FileCount) / float64(union)
+
+		edges = append(edges, graphEdge{pairUsage.TagName, pairUsage.OtherTagName, false, pairUsage.FileCount, strength})
+	}
+
+	return nodes, edges, nil
+}
+
+func printDot(nodes []graphNode, edges []graphEdge) {
+	fmt.Println("digraph tmsu {")
+
+	for _, node := range nodes {
+		if node.isTag {
+			fmt.Printf("    %v [label=%v];\n", dotId(node.name), dotId(fmt.Sprintf("%v (%v)", node.name, node.fileCount)))
+		} else {
+			fmt.Printf("    %v [shape=box];\n", dotId(node.name))
+		}
+	}
+
+	for _, edge := range edges {
+		if edge.implication {
+			fmt.Printf("    %v -> %v;\n", dotId(edge.from), dotId(edge.to))
+		} else {
+			fmt.Printf("    %v -> %v [dir=none, style=dashed, weight=%v, label=\"%v\", penwidth=%.2f];\n", dotId(edge.from), dotId(edge.to), edge.fileCount, edge.fileCount, 1+4*edge.strength)
+		}
+	}
+
+	fmt.Println("}")
+}
+
+func dotId(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+func printGraphml(nodes []graphNode, edges []graphEdge) {
+	fmt.Println(`<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Println(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Println(`  <key id="label" for="node" attr.name="label" attr.type="string"/>`)
+	fmt.Println(`  <key id="files" for="node" attr.name="files" attr.type="int"/>`)
+	fmt.Println(`  <key id="type" for="edge" attr.name="type" attr.type="string"/>`)
+	fmt.Println(`  <key id="weight" for="edge" attr.name="weight" attr.type="int"/>`)
+	fmt.Println(`  <key id="strength" for="edge" attr.name="strength" attr.type="double"/>`)
+	fmt.Println(`  <graph id="tmsu" edgedefault="directed">`)
+
+	for _, node := range nodes {
+		fmt.Printf(`    <node id="%v"><data key="label">%v</data>`, xmlText(node.name), xmlText(node.name))
+		if node.isTag {
+			fmt.Printf(`<data key="files">%v</data>`, node.fileCount)
+		}
+		fmt.Println(`</node>`)
+	}
+
+	for _, edge := range edges {
+		if edge.implication {
+			fmt.Printf(`    <edge source="%v" target="%v"><data key="type">implication</data></edge>`+"\n", xmlText(edge.from), xmlText(edge.to))
+		} else {
+			fmt.Printf(`    <edge source="%v" target="%v" directed="false"><data key="type">co-occurrence</data><data key="weight">%v</data><data key="strength">%.4f</data></edge>`+"\n", xmlText(edge.from), xmlText(edge.to), edge.fileCount, edge.strength)
+		}
+	}
+
+	fmt.Println(`  </graph>`)
+	fmt.Println(`</graphml>`)
+}
+
+func xmlText(text string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(text))
+
+	return builder.String()
+}
@@ -27,12 +27,19 @@ import (
 )
 
 var HelpCommand = Command{
-	Name:        "help",
-	Synopsis:    "List subcommands or show help for a particular subcommand",
-	Usages:      []string{"tmsu help [OPTION]... [SUBCOMMAND]"},
-	Description: `Shows help summary or, where SUBCOMMAND is specified, help for SUBCOMMAND.`,
-	Options:     Options{{"--list", "-l", "list commands", false, ""}},
-	Exec:        helpExec,
+	Name:     "help",
+	Synopsis: "List subcommands or show help for a particular subcommand",
+	Usages: []string{"tmsu help [OPTION]... [SUBCOMMAND]",
+		"tmsu help --man SUBCOMMAND"},
+	Description: `Shows help summary or, where SUBCOMMAND is specified, help for SUBCOMMAND.
+
+With --man the help for SUBCOMMAND is instead written as a man page, which can be viewed with 'man -l' or installed as tmsu-SUBCOMMAND(1) so that the examples of every subcommand are available offline.`,
+	Examples: []string{"$ tmsu help files",
+		"$ tmsu help --man files | man -l -",
+		"$ tmsu help --man files >/usr/share/man/man1/tmsu-files.1"},
+	Options: Options{{"--list", "-l", "list commands", false, ""},
+		{"--man", "", "show the help for SUBCOMMAND as a man page", false, ""}},
+	Exec: helpExec,
 }
 
 // unexported
@@ -59,7 +66,21 @@ func helpExec(options Options, args []string, databasePath string) (error, warni
 		colour = terminal.Colour() && terminal.Width() > 0
 	}
 
-	if options.HasOption("--list") {
+	if options.HasOption("--man") {
+		switch {
+		case len(args) < 1:
+			return errTooFewArguments, nil
+		case len(args) > 1:
+			return errTooManyArguments, nil
+		}
+
+		command := findCommand(helpCommands, args[0])
+		if command == nil {
+			return fmt.Errorf("no such command '%v'", args[0]), nil
+		}
+
+		fmt.Print(manPage(command))
+	} else if options.HasOption("--list") {
 		listCommands()
 	} else {
 		switch len(args) {
@@ -117,6 +138,8 @@ func summary(colour bool) {
 
 	printOptions(globalOptions)
 
+	fmt.Println()
+	terminal.PrintWrapped("The global options may be given before or after the subcommand name. The database used is, in order of precedence: that specified with --database; that named by the " + databaseEnvironmentVariable + " environment variable; the nearest .tmsu/db in the working directory or its ancestors; or else ~/.tmsu/default.db.")
 	fmt.Println()
 	terminal.PrintWrapped("Specify subcommand name for detailed help on a particular subcommand, e.g. tmsu help files")
 }
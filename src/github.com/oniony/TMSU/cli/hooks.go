@@ -0,0 +1,167 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// the commands for which hooks are run: before the command is run, the hook
+// named 'pre-COMMAND' may veto it and afterwards the hook named 'post-COMMAND'
+// is passed the changes it made
+var hookedCommands = map[string]bool{"repair": true, "tag": true, "untag": true}
+
+// the environment variable set whilst a hook runs, within which hooks are not run
+const hookEnvironmentVariable = "TMSU_HOOK"
+
+// the database whose changes are tracked for a post-command hook, along with the storage opened upon it
+var hookDatabasePath string
+var hookStores []*storage.Storage
+
+// a post-command hook along with the changes to pass to it
+type pendingHook struct {
+	path      string
+	event     string
+	arguments []string
+	changes   []storage.Change
+}
+
+// runs the command along with its hooks, if any
+func execWithHooks(command *Command, options Options, arguments []string, databasePath string) (error, warnings) {
+	postHook, err, warnings := execBeforeHook(command, options, arguments, databasePath)
+	if err != nil || postHook == nil {
+		return err, warnings
+	}
+
+	if err := postHook.run(databasePath); err != nil {
+		warnings = append(warnings, err)
+	}
+
+	return nil, warnings
+}
+
+// runs the command after its pre-command hook, if any, returning its post-command
+// hook, if any, for the changes it made to the database
+func execBeforeHook(command *Command, options Options, arguments []string, databasePath string) (*pendingHook, error, warnings) {
+	preHook, postHook := commandHooks(command, databasePath)
+
+	if preHook != "" {
+		hook := pendingHook{preHook, "pre-" + command.Name, arguments, nil}
+		if err := hook.run(databasePath); err != nil {
+			return nil, err, nil
+		}
+	}
+
+	if postHook == "" {
+		err, warnings := command.Exec(options, arguments, databasePath)
+		return nil, err, warnings
+	}
+
+	hookDatabasePath = databasePath
+	defer func() {
+		hookDatabasePath, hookStores = "", nil
+	}()
+
+	if atomicStore != nil {
+		atomicStore.TrackChanges()
+		atomicStore.TakeChanges()
+	}
+
+	err, warnings := command.Exec(options, arguments, databasePath)
+	if err != nil {
+		return nil, err, warnings
+	}
+
+	changes := []storage.Change{}
+	for _, store := range append(hookStores, atomicStore) {
+		if store != nil {
+			changes = append(changes, store.TakeChanges()...)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil, warnings
+	}
+
+	return &pendingHook{postHook, "post-" + command.Name, arguments, changes}, nil, warnings
+}
+
+// the paths of the pre- and post-command hooks of the database, which are empty where there is no such hook
+func commandHooks(command *Command, databasePath string) (string, string) {
+	if command == nil || !hookedCommands[command.Name] || os.Getenv(hookEnvironmentVariable) != "" {
+		return "", ""
+	}
+
+	return hookPath(databasePath, "pre-"+command.Name), hookPath(databasePath, "post-"+command.Name)
+}
+
+// the path of the named hook within the 'hooks' directory beside the database,
+// or an empty string if there is no such executable
+func hookPath(databasePath, name string) string {
+	path := filepath.Join(filepath.Dir(databasePath), "hooks", name)
+
+	stat, err := os.Stat(path)
+	if err != nil || !stat.Mode().IsRegular() {
+		return ""
+	}
+
+	if runtime.GOOS != "windows" && stat.Mode().Perm()&0111 == 0 {
+		log.Infof(2, "ignoring hook '%v' as it is not executable", path)
+		return ""
+	}
+
+	return path
+}
+
+// runs the hook, passing it a JSON description of the event on standard input
+func (hook pendingHook) run(databasePath string) error {
+	absDatabasePath, err := filepath.Abs(databasePath)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]jsonChange, len(hook.changes))
+	for index, change := range hook.changes {
+		changes[index] = jsonChange{change.Kind, change.Path, change.OldPath, change.Tag, change.Value}
+	}
+
+	input, err := json.Marshal(jsonHookEvent{hook.event, absDatabasePath, hook.arguments, changes})
+	if err != nil {
+		return fmt.Errorf("could not encode %v hook input: %w", hook.event, err)
+	}
+
+	log.Infof(2, "running hook '%v'", hook.path)
+
+	command := exec.Command(hook.path)
+	command.Stdin = bytes.NewReader(append(input, '\n'))
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	command.Env = append(os.Environ(), databaseEnvironmentVariable+"="+absDatabasePath, hookEnvironmentVariable+"="+hook.event)
+
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("%v hook failed: %w", hook.event, err)
+	}
+
+	return nil
+}
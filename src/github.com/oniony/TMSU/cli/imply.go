@@ -34,13 +34,19 @@ When run without arguments lists the set of tag implications.
 
 Tag implications are applied at time of file query (not at time of tag application) therefore any changes to the implication rules will affect all further queries.
 
+An implication may be conditional upon a value, such that only files tagged TAG with that VALUE are implicitly tagged IMPL. TAG may also be one of the built-in tags 'ext', 'mime', 'mtime', 'mtime-after' or 'mtime-before', in which case the files whose extension, MIME type or modification time satisfies VALUE are implicitly tagged IMPL, e.g. 'ext=raw' for files named with a '.raw' extension or 'mtime=2023' for files last modified during 2023.
+
+Implications are transitive: if TAG implies IMPL and IMPL in turn implies another tag then files tagged TAG are implicitly tagged with both. An implication that would lead back to TAG, directly or through other implications, is rejected and the cycle it would create is reported.
+
 By default the 'tag' subcommand will not explicitly apply tags that are already implied by the implication rules.
 
-The 'tags' subcommand can be used to identify which tags applied to a file are implied.`,
+The 'tags' subcommand can be used to identify which tags applied to a file are implied and, with --explain, by which implications.`,
 	Examples: []string{`$ tmsu imply mp3 music`,
 		`$ tmsu imply
 mp3 -> music`,
 		`$ tmsu imply aubergine aka=eggplant`,
+		`$ tmsu imply rating=5 favourite`,
+		`$ tmsu imply ext=raw photo`,
 		`$ tmsu imply --delete mp3 music`},
 	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, ""}},
 	Exec:    implyExec,
@@ -66,9 +72,14 @@ func implyExec(options Options, args []string, databasePath string) (error, warn
 		return err, nil
 	}
 
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
 	if options.HasOption("--delete") {
 		if len(args) < 2 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		return deleteImplications(store, tx, args)
@@ -76,7 +87,7 @@ func implyExec(options Options, args []string, databasePath string) (error, warn
 
 	switch len(args) {
 	case 0:
-		return listImplications(store, tx, colour), nil
+		return listImplications(store, tx, colour, asJson), nil
 	case 1:
 		return fmt.Errorf("tag(s) to be implied must be specified"), nil
 	default:
@@ -84,12 +95,22 @@ func implyExec(options Options, args []string, databasePath string) (error, warn
 	}
 }
 
-func listImplications(store *storage.Storage, tx *storage.Tx, colour bool) error {
+func listImplications(store *storage.Storage, tx *storage.Tx, colour, asJson bool) error {
 	log.Infof(2, "retrieving tag implications.")
 
 	implications, err := store.Implications(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve implications: %v", err)
+		return fmt.Errorf("could not retrieve implications: %w", err)
+	}
+
+	if asJson {
+		jsonImplications := make([]jsonImplication, len(implications))
+		for index, implication := range implications {
+			jsonImplications[index] = jsonImplication{implication.ImplyingTag.Name, implication.ImplyingValue.Name,
+				implication.ImpliedTag.Name, implication.ImpliedValue.Name}
+		}
+
+		return printJson(jsonImplications)
 	}
 
 	width := 0
@@ -135,7 +156,11 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 
 	implyingTagName, implyingValueName := parseTagEqValueName(implyingTagArg)
 
-	implyingTag, err := store.TagByName(tx, implyingTagName)
+	if err := validateImplicationCondition(implyingTagName, implyingValueName); err != nil {
+		return err, nil
+	}
+
+	implyingTag, err := store.TagByNameOrAlias(tx, implyingTagName)
 	if err != nil {
 		return err, nil
 	}
@@ -169,7 +194,12 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 	for _, impliedTagArg := range impliedTagArgs {
 		impliedTagName, impliedValueName := parseTagEqValueName(impliedTagArg)
 
-		impliedTag, err := store.TagByName(tx, impliedTagName)
+		if entities.IsBuiltInTagName(impliedTagName) {
+			warnings = append(warnings, fmt.Errorf("built-in tag '%v' cannot be implied", impliedTagName))
+			continue
+		}
+
+		impliedTag, err := store.TagByNameOrAlias(tx, impliedTagName)
 		if err != nil {
 			return err, warnings
 		}
@@ -180,7 +210,7 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 					return err, warnings
 				}
 			} else {
-				warnings = append(warnings, fmt.Sprintf("no such tag '%v'", impliedTagName))
+				warnings = append(warnings, NoSuchTagError{impliedTagName})
 				continue
 			}
 		}
@@ -196,7 +226,7 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 					return err, warnings
 				}
 			} else {
-				warnings = append(warnings, fmt.Sprintf("no such value '%v'", impliedValueName))
+				warnings = append(warnings, NoSuchValueError{impliedValueName})
 				continue
 			}
 		}
@@ -204,13 +234,32 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (
 		log.Infof(2, "adding tag implication of '%v' to '%v'", implyingTagArg, impliedTagArg)
 
 		if err = store.AddImplication(tx, entities.TagIdValueIdPair{implyingTag.Id, implyingValue.Id}, entities.TagIdValueIdPair{impliedTag.Id, impliedValue.Id}); err != nil {
-			return fmt.Errorf("cannot add implication of '%v' to '%v': %v", implyingTagArg, impliedTagArg, err), warnings
+			return fmt.Errorf("cannot add implication of '%v' to '%v': %w", implyingTagArg, impliedTagArg, err), warnings
 		}
 	}
 
 	return nil, warnings
 }
 
+// implications may be conditional upon the value of a built-in tag, which is
+// satisfied by the attributes of the files, other than their size or when and by
+// whom they were tagged
+func validateImplicationCondition(tagName, valueName string) error {
+	if !entities.IsBuiltInTagName(tagName) {
+		return nil
+	}
+
+	switch tagName {
+	case entities.SizeTagName, entities.TaggedAfterTagName, entities.TaggedBeforeTagName, entities.TaggedByTagName:
+		return fmt.Errorf("implications cannot be conditional upon built-in tag '%v'", tagName)
+	}
+	if valueName == "" {
+		return fmt.Errorf("implications conditional upon built-in tag '%v' must specify a value", tagName)
+	}
+
+	return entities.ValidateAttributeValue(tagName, valueName)
+}
+
 func deleteImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
 	log.Infof(2, "loading settings")
 
@@ -219,7 +268,7 @@ func deleteImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string
 
 	implyingTagName, implyingValueName := parseTagEqValueName(implyingTagArg)
 
-	implyingTag, err := store.TagByName(tx, implyingTagName)
+	implyingTag, err := store.TagByNameOrAlias(tx, implyingTagName)
 	if err != nil {
 		return err, nil
 	}
@@ -241,12 +290,12 @@ func deleteImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string
 
 		impliedTagName, impliedValueName := parseTagEqValueName(impliedTagArg)
 
-		impliedTag, err := store.TagByName(tx, impliedTagName)
+		impliedTag, err := store.TagByNameOrAlias(tx, impliedTagName)
 		if err != nil {
 			return err, warnings
 		}
 		if impliedTag == nil {
-			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", impliedTagName))
+			warnings = append(warnings, NoSuchTagError{impliedTagName})
 		}
 
 		impliedValue, err := store.ValueByName(tx, impliedValueName)
@@ -254,11 +303,11 @@ func deleteImplications(store *storage.Storage, tx *storage.Tx, tagArgs []string
 			return err, warnings
 		}
 		if impliedValue == nil {
-			warnings = append(warnings, fmt.Sprintf("no such value '%v'", impliedValueName))
+			warnings = append(warnings, NoSuchValueError{impliedValueName})
 		}
 
 		if err := store.DeleteImplication(tx, entities.TagIdValueIdPair{implyingTag.Id, implyingValue.Id}, entities.TagIdValueIdPair{impliedTag.Id, impliedValue.Id}); err != nil {
-			return fmt.Errorf("could not delete tag implication of %v to %v: %v", implyingTagArg, impliedTagArg, err), warnings
+			return fmt.Errorf("could not delete tag implication of %v to %v: %w", implyingTagArg, impliedTagArg, err), warnings
 		}
 	}
 
@@ -0,0 +1,520 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/libtmsu"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ImportCommand = Command{
+	Name:     "import",
+	Synopsis: "Import a database export",
+	Usages: []string{"tmsu import [FILE]",
+		"tmsu import --sidecars [PATH]..."},
+	Description: `Reads records written by the 'export' subcommand from FILE, or from standard input if FILE is omitted or is '-', and adds them to the database.
+
+Tags, values, aliases, implications, rules, saved queries and settings are created as necessary. Relative file paths are resolved against the database root. Files that are already in the database are updated with the imported details and have the imported tags added to their existing tags.
+
+The files themselves are not examined: the imported fingerprints, modification times and sizes are used as-is. Use the 'status' or 'repair' subcommands afterwards to check the imported files against the file system.
+
+With --sidecars the tags are instead read from the sidecar files, as written when the 'sidecars' setting is enabled, found within each PATH, or the working directory if none is specified. Both 'FILE` + storage.SidecarExtension + `' and '` + storage.DirectorySidecarName + `' sidecars are read. The tagged files are added to the database as necessary and the tags and values created subject to the 'autoCreateTags' and 'autoCreateValues' settings.`,
+	Examples: []string{"$ tmsu export >tags.jsonl",
+		"$ tmsu --database=/mnt/usb/.tmsu/db import tags.jsonl",
+		"$ ssh host tmsu export | tmsu import",
+		"$ tmsu import --sidecars ~/photos"},
+	Options: Options{{"--sidecars", "", "import tags from sidecar files", false, ""}},
+	Exec:    importExec,
+}
+
+// unexported
+
+func importExec(options Options, args []string, databasePath string) (error, warnings) {
+	if options.HasOption("--sidecars") {
+		return importSidecarsExec(args, databasePath)
+	}
+
+	if len(args) > 1 {
+		return errTooManyArguments, nil
+	}
+
+	reader := io.Reader(os.Stdin)
+	if len(args) == 1 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("%v: could not open file: %w", args[0], err), nil
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	return importRecords(store, tx, reader)
+}
+
+func importRecords(store *storage.Storage, tx *storage.Tx, reader io.Reader) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record exportRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("line %v: could not parse record: %w", lineNumber, err), warnings
+		}
+
+		warning, err := importRecord(store, tx, record)
+		if err != nil {
+			return fmt.Errorf("line %v: %w", lineNumber, err), warnings
+		}
+		if warning != "" {
+			warnings = append(warnings, fmt.Errorf("line %v: %v", lineNumber, warning))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read input: %w", err), warnings
+	}
+
+	log.Infof(2, "imported %v line(s)", lineNumber)
+
+	return nil, warnings
+}
+
+func importRecord(store *storage.Storage, tx *storage.Tx, record exportRecord) (string, error) {
+	switch record.Type {
+	case "setting":
+		if _, err := store.UpdateSetting(tx, record.Name, record.Value); err != nil {
+			return "", fmt.Errorf("could not update setting '%v': %w", record.Name, err)
+		}
+	case "query":
+		return "", importQuery(store, tx, record.Text)
+	case "tag":
+		tag, err := importTag(store, tx, record.Name)
+		if err != nil {
+			return "", err
+		}
+
+		if err := importTagInfo(store, tx, *tag, record); err != nil {
+			return "", err
+		}
+
+		if err := importTagConstraint(store, tx, *tag, record); err != nil {
+			return "", err
+		}
+
+		return "", importTagGroup(store, tx, *tag, record.Group)
+	case "alias":
+		return importAlias(store, tx, record.Name, record.Tag)
+	case "value":
+		_, err := importValue(store, tx, record.Name)
+		return "", err
+	case "implication":
+		return "", importImplication(store, tx, record)
+	case "rule":
+		return "", importRule(store, tx, record.Condition, record.Text)
+	case "file":
+		return "", importFile(store, tx, record)
+	default:
+		return "", fmt.Errorf("unknown record type '%v'", record.Type)
+	}
+
+	return "", nil
+}
+
+func importQuery(store *storage.Storage, tx *storage.Tx, text string) error {
+	query, err := store.Query(tx, text)
+	if err != nil {
+		return fmt.Errorf("could not retrieve query '%v': %w", text, err)
+	}
+	if query != nil {
+		return nil
+	}
+
+	if _, err := store.AddQuery(tx, text); err != nil {
+		return fmt.Errorf("could not add query '%v': %w", text, err)
+	}
+
+	return nil
+}
+
+func importTag(store *storage.Storage, tx *storage.Tx, tagName string) (*entities.Tag, error) {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag '%v': %w", tagName, err)
+	}
+	if tag != nil {
+		return tag, nil
+	}
+
+	log.Infof(2, "adding tag '%v'", tagName)
+
+	tag, err = store.AddTag(tx, tagName)
+	if err != nil {
+		return nil, fmt.Errorf("could not add tag '%v': %w", tagName, err)
+	}
+
+	return tag, nil
+}
+
+func importTagInfo(store *storage.Storage, tx *storage.Tx, tag entities.Tag, record exportRecord) error {
+	tagInfo := entities.TagInfo{tag, record.Description, record.Colour, record.Icon}
+	if tagInfo.IsEmpty() {
+		return nil
+	}
+
+	if err := store.SetTagInfo(tx, tagInfo); err != nil {
+		return fmt.Errorf("could not set information of tag '%v': %w", tag.Name, err)
+	}
+
+	return nil
+}
+
+func importTagConstraint(store *storage.Storage, tx *storage.Tx, tag entities.Tag, record exportRecord) error {
+	tagConstraint := entities.TagConstraint{tag, record.ValuePattern, record.DefaultValue}
+	if tagConstraint.IsEmpty() {
+		return nil
+	}
+
+	if err := store.SetTagConstraint(tx, tagConstraint); err != nil {
+		return fmt.Errorf("could not set constraint of tag '%v': %w", tag.Name, err)
+	}
+
+	return nil
+}
+
+func importTagGroup(store *storage.Storage, tx *storage.Tx, tag entities.Tag, groupName string) error {
+	if groupName == "" {
+		return nil
+	}
+
+	if err := store.SetTagGroup(tx, tag, groupName); err != nil {
+		return fmt.Errorf("could not add tag '%v' to group '%v': %w", tag.Name, groupName, err)
+	}
+
+	return nil
+}
+
+func importValue(store *storage.Storage, tx *storage.Tx, valueName string) (*entities.Value, error) {
+	if valueName == "" {
+		return &entities.Value{}, nil
+	}
+
+	value, err := store.ValueByName(tx, valueName)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve value '%v': %w", valueName, err)
+	}
+	if value != nil {
+		return value, nil
+	}
+
+	log.Infof(2, "adding value '%v'", valueName)
+
+	value, err = store.AddValue(tx, valueName)
+	if err != nil {
+		return nil, fmt.Errorf("could not add value '%v': %w", valueName, err)
+	}
+
+	return value, nil
+}
+
+func importAlias(store *storage.Storage, tx *storage.Tx, aliasName, tagName string) (string, error) {
+	tag, err := importTag(store, tx, tagName)
+	if err != nil {
+		return "", err
+	}
+
+	alias, err := store.AliasByName(tx, aliasName)
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve alias '%v': %w", aliasName, err)
+	}
+	if alias != nil {
+		if alias.Tag.Id != tag.Id {
+			return fmt.Sprintf("alias '%v' already refers to tag '%v'", aliasName, alias.Tag.Name), nil
+		}
+
+		return "", nil
+	}
+
+	log.Infof(2, "adding alias '%v' for tag '%v'", aliasName, tagName)
+
+	if _, err := store.AddAlias(tx, aliasName, *tag); err != nil {
+		return "", fmt.Errorf("could not add alias '%v': %w", aliasName, err)
+	}
+
+	return "", nil
+}
+
+func importTagValuePair(store *storage.Storage, tx *storage.Tx, tagName, valueName string) (entities.TagIdValueIdPair, error) {
+	tag, err := importTag(store, tx, tagName)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+
+	value, err := importValue(store, tx, valueName)
+	if err != nil {
+		return entities.TagIdValueIdPair{}, err
+	}
+
+	return entities.TagIdValueIdPair{tag.Id, value.Id}, nil
+}
+
+func importImplication(store *storage.Storage, tx *storage.Tx, record exportRecord) error {
+	pair, err := importTagValuePair(store, tx, record.Tag, record.Value)
+	if err != nil {
+		return err
+	}
+
+	impliedPair, err := importTagValuePair(store, tx, record.ImpliedTag, record.ImpliedValue)
+	if err != nil {
+		return err
+	}
+
+	if err := store.AddImplication(tx, pair, impliedPair); err != nil {
+		return fmt.Errorf("could not add implication: %w", err)
+	}
+
+	return nil
+}
+
+func importRule(store *storage.Storage, tx *storage.Tx, condition, tags string) error {
+	rules, err := store.Rules(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve rules: %w", err)
+	}
+	for _, rule := range rules {
+		if rule.Condition == condition && rule.Tags == tags {
+			return nil
+		}
+	}
+
+	log.Infof(2, "adding rule '%v'", condition)
+
+	if _, err := store.AddRule(tx, condition, tags); err != nil {
+		return fmt.Errorf("could not add rule '%v': %w", condition, err)
+	}
+
+	return nil
+}
+
+func importFile(store *storage.Storage, tx *storage.Tx, record exportRecord) error {
+	if record.Path == "" {
+		return fmt.Errorf("file record has no path")
+	}
+
+	path := record.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(store.RootPath, path)
+	}
+
+	var modTime time.Time
+	if record.ModTime != nil {
+		modTime = *record.ModTime
+	}
+	fingerprint := fingerprint.Fingerprint(record.Fingerprint)
+
+	file, err := store.FileByPath(tx, path)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+	if file == nil {
+		log.Infof(2, "%v: adding file", path)
+
+		file, err = store.AddFile(tx, path, fingerprint, modTime, record.Size, record.IsDir, record.MimeType)
+		if err != nil {
+			return fmt.Errorf("%v: could not add file: %w", path, err)
+		}
+	} else {
+		log.Infof(2, "%v: updating file", path)
+
+		file, err = store.UpdateFile(tx, file.Id, path, fingerprint, modTime, record.Size, record.IsDir, record.MimeType)
+		if err != nil {
+			return fmt.Errorf("%v: could not update file: %w", path, err)
+		}
+	}
+
+	for _, tag := range record.Tags {
+		pair, err := importTagValuePair(store, tx, tag.Name, tag.Value)
+		if err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %w", path, err)
+		}
+	}
+
+	if record.Note != "" {
+		if _, err := store.UpdateNote(tx, file.Id, record.Note); err != nil {
+			return fmt.Errorf("%v: could not update note: %w", path, err)
+		}
+	}
+
+	for name, value := range record.Properties {
+		if err := entities.ValidatePropertyName(name); err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+
+		if _, err := store.UpdateProperty(tx, file.Id, name, value); err != nil {
+			return fmt.Errorf("%v: could not update property '%v': %w", path, name, err)
+		}
+	}
+
+	return nil
+}
+
+func importSidecarsExec(paths []string, databasePath string) (error, warnings) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	sidecarPaths := make([]string, 0, 10)
+	for _, path := range paths {
+		if err := findSidecars(path, &sidecarPaths); err != nil {
+			return err, nil
+		}
+	}
+
+	db := libtmsu.FromStorage(store)
+	warnings := make(warnings, 0, 10)
+
+	for _, sidecarPath := range sidecarPaths {
+		log.Infof(2, "%v: importing sidecar", sidecarPath)
+
+		sidecarTags, err := storage.ReadSidecar(sidecarPath)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not read sidecar: %w", sidecarPath, err))
+			continue
+		}
+
+		for _, path := range sidecarTagPaths(sidecarTags) {
+			tags := make([]libtmsu.Tag, 0, len(sidecarTags))
+			for _, sidecarTag := range sidecarTags {
+				if sidecarTag.Path == path {
+					tags = append(tags, libtmsu.Tag{sidecarTag.Tag, sidecarTag.Value})
+				}
+			}
+
+			if err := db.TagFile(path, tags...); err != nil {
+				warnings = append(warnings, fmt.Errorf("%v: could not import tags: %w", path, err))
+			}
+		}
+	}
+
+	return nil, warnings
+}
+
+// the sidecar files within the path
+func findSidecars(path string, sidecarPaths *[]string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not stat file: %w", path, err)
+	}
+
+	if !stat.IsDir() {
+		if isSidecar(path) {
+			*sidecarPaths = append(*sidecarPaths, path)
+		}
+
+		return nil
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not open directory: %w", path, err)
+	}
+
+	names, err := dir.Readdirnames(0)
+	dir.Close()
+	if err != nil {
+		return fmt.Errorf("%v: could not read directory entries: %w", path, err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := findSidecars(filepath.Join(path, name), sidecarPaths); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isSidecar(path string) bool {
+	return strings.HasSuffix(path, storage.SidecarExtension) || filepath.Base(path) == storage.DirectorySidecarName
+}
+
+// the distinct paths of the files tagged by a sidecar, in order
+func sidecarTagPaths(sidecarTags []storage.SidecarTag) []string {
+	paths := make([]string, 0, 1)
+	seen := make(map[string]bool)
+
+	for _, sidecarTag := range sidecarTags {
+		if !seen[sidecarTag.Path] {
+			seen[sidecarTag.Path] = true
+			paths = append(paths, sidecarTag.Path)
+		}
+	}
+
+	return paths
+}
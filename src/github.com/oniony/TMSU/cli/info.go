@@ -28,16 +28,40 @@ var InfoCommand = Command{
 	Name:        "info",
 	Synopsis:    "Show database information",
 	Usages:      []string{"tmsu info"},
-	Description: "Shows the database information.",
+	Description: "Shows the database information. See the 'stats' subcommand for statistics on the use of each tag.",
+	Examples: []string{`$ tmsu info
+Database: /home/bob/.tmsu/db
+Root path: /
+Size: 266240`,
+		`$ tmsu info --stats
+Database: /home/bob/.tmsu/db
+Root path: /
+Size: 266240
+
+Tags: 2
+Values: 0
+Files: 1
+Taggings: 2
+Mean tags per file: 2.00
+Mean files per tag: 1.00`},
 	Options: Options{
 		Option{"--stats", "-s", "show statistics", false, ""},
 		Option{"--usage", "-u", "show tag usage breakdown", false, ""}},
-	Exec:    infoExec,
-	Aliases: []string{"stats"},
+	Exec: infoExec,
 }
 
 // unexported
 
+// the statistics shown with --stats
+type infoStatistics struct {
+	tagCount           uint
+	valueCount         uint
+	fileCount          uint
+	fileTagCount       uint
+	averageTagsPerFile float32
+	averageFilesPerTag float32
+}
+
 func infoExec(options Options, args []string, databasePath string) (error, warnings) {
 	stats := options.HasOption("--stats")
 	usage := options.HasOption("--usage")
@@ -45,6 +69,10 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 	if err != nil {
 		return err, nil
 	}
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -58,6 +86,10 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 	}
 	defer tx.Commit()
 
+	if asJson {
+		return showJsonInfo(store, tx, stats, usage), nil
+	}
+
 	showBasic(store, tx, colour)
 
 	if stats {
@@ -71,6 +103,13 @@ func infoExec(options Options, args []string, databasePath string) (error, warni
 }
 
 func showBasic(store *storage.Storage, tx *storage.Tx, colour bool) error {
+	if storage.IsPostgres(store.DbPath) {
+		printInfo("Database", storage.RedactConnection(store.DbPath), colour)
+		printInfo("Root path", store.RootPath, colour)
+
+		return nil
+	}
+
 	printInfo("Database", store.DbPath, colour)
 	printInfo("Root path", store.RootPath, colour)
 
@@ -85,51 +124,60 @@ func showBasic(store *storage.Storage, tx *storage.Tx, colour bool) error {
 }
 
 func showStatistics(store *storage.Storage, tx *storage.Tx, colour bool) error {
+	statistics, err := retrieveStatistics(store, tx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printInfo("Tags", statistics.tagCount, colour)
+	printInfo("Values", statistics.valueCount, colour)
+	printInfo("Files", statistics.fileCount, colour)
+	printInfo("Taggings", statistics.fileTagCount, colour)
+	printInfof("Mean tags per file", "%1.2f", statistics.averageTagsPerFile, colour)
+	printInfof("Mean files per tag", "%1.2f", statistics.averageFilesPerTag, colour)
+
+	return nil
+}
+
+func retrieveStatistics(store *storage.Storage, tx *storage.Tx) (*infoStatistics, error) {
 	tagCount, err := store.TagCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag count: %v", err)
+		return nil, fmt.Errorf("could not retrieve tag count: %w", err)
 	}
 
 	valueCount, err := store.ValueCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve value count: %v", err)
+		return nil, fmt.Errorf("could not retrieve value count: %w", err)
 	}
 
 	fileCount, err := store.FileCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve file count: %v", err)
+		return nil, fmt.Errorf("could not retrieve file count: %w", err)
 	}
 
 	fileTagCount, err := store.FileTagCount(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve taggings count: %v", err)
+		return nil, fmt.Errorf("could not retrieve taggings count: %w", err)
 	}
 
-	var averageTagsPerFile float32
+	statistics := infoStatistics{tagCount: tagCount, valueCount: valueCount, fileCount: fileCount, fileTagCount: fileTagCount}
+
 	if fileCount > 0 {
-		averageTagsPerFile = float32(fileTagCount) / float32(fileCount)
+		statistics.averageTagsPerFile = float32(fileTagCount) / float32(fileCount)
 	}
 
-	var averageFilesPerTag float32
 	if tagCount > 0 {
-		averageFilesPerTag = float32(fileTagCount) / float32(tagCount)
+		statistics.averageFilesPerTag = float32(fileTagCount) / float32(tagCount)
 	}
 
-	fmt.Println()
-	printInfo("Tags", tagCount, colour)
-	printInfo("Values", valueCount, colour)
-	printInfo("Files", fileCount, colour)
-	printInfo("Taggings", fileTagCount, colour)
-	printInfof("Mean tags per file", "%1.2f", averageTagsPerFile, colour)
-	printInfof("Mean files per tag", "%1.2f", averageFilesPerTag, colour)
-
-	return nil
+	return &statistics, nil
 }
 
 func showUsage(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	tagUsages, err := store.TagUsage(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag usage: %v", err)
+		return fmt.Errorf("could not retrieve tag usage: %w", err)
 	}
 
 	maxLength := 0
@@ -158,6 +206,46 @@ func showUsage(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	return nil
 }
 
+func showJsonInfo(store *storage.Storage, tx *storage.Tx, stats, usage bool) error {
+	info := jsonInfo{Database: store.DbPath, RootPath: store.RootPath}
+
+	if storage.IsPostgres(store.DbPath) {
+		info.Database = storage.RedactConnection(store.DbPath)
+	} else {
+		stat, err := os.Stat(store.DbPath)
+		if err != nil {
+			return err
+		}
+
+		size := stat.Size()
+		info.Size = &size
+	}
+
+	if stats {
+		statistics, err := retrieveStatistics(store, tx)
+		if err != nil {
+			return err
+		}
+
+		info.Stats = &jsonInfoStats{statistics.tagCount, statistics.valueCount, statistics.fileCount,
+			statistics.fileTagCount, statistics.averageTagsPerFile, statistics.averageFilesPerTag}
+	}
+
+	if usage {
+		tagUsages, err := store.TagUsage(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag usage: %w", err)
+		}
+
+		info.Usage = make([]jsonTagFileCount, len(tagUsages))
+		for index, tagUsage := range tagUsages {
+			info.Usage[index] = jsonTagFileCount{tagUsage.Name, tagUsage.FileCount}
+		}
+	}
+
+	return printJson(info)
+}
+
 func printInfo(name string, value interface{}, colour bool) {
 	printInfof(name, "%v", value, colour)
 }
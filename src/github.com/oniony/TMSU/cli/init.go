@@ -16,37 +16,79 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/common/log"
 	"github.com/oniony/TMSU/storage"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 var InitCommand = Command{
 	Name:     "init",
 	Synopsis: "Initializes a new database",
-	Usages:   []string{"tmsu init [PATH]"},
+	Usages:   []string{"tmsu init [OPTION]... [PATH]"},
 	Description: `Initializes a new local database.
 
 Creates a .tmsu directory under PATH and initialises a new empty database within it.
 
 If no PATH is specified then the current working directory is assumed.
 
-The new database is used automatically whenever TMSU is invoked from a directory under PATH (unless overridden by the global --database option or the TMSU_DB environment variable.`,
-	Options: Options{},
-	Exec:    initExec,
+The new database is used automatically whenever TMSU is invoked from a directory under PATH (unless overridden by the global --database option or the TMSU_DB environment variable.
+
+The file fingerprint algorithm used by the new database can be chosen with the --fingerprint-algorithm option. (See the 'fileFingerprintAlgorithm' setting of the 'config' subcommand.)
+
+The --encrypt option encrypts the new database with a passphrase. (See the 'encrypt' subcommand.)
+
+The --template option seeds the new database with the taxonomy of another: its tags (with their descriptions, colours, icons and groups), aliases, values, implications and rules. The template is the output of the 'export' subcommand, read from the file PATH or downloaded from the http or https URL, so that a shared vocabulary can be kept in one place and used by every new database. The files, settings and saved queries of the template are ignored.`,
+	Examples: []string{"$ tmsu init",
+		"$ tmsu init --fingerprint-algorithm=BLAKE2b /mnt/archive",
+		"$ tmsu init --encrypt",
+		"$ tmsu init --template=https://example.org/taxonomy.jsonl ~/photos"},
+	Options: Options{{"--fingerprint-algorithm", "", "use the specified file fingerprint algorithm", true, ""},
+		{"--encrypt", "", "encrypt the database with a passphrase", false, ""},
+		{"--template", "", "seed the tags, aliases, implications and rules from the export at PATH or URL", true, ""}},
+	Exec: initExec,
 }
 
 // unexported
 
 func initExec(options Options, args []string, databasePath string) (error, warnings) {
+	if err := refuseIfReadOnly(); err != nil {
+		return err, nil
+	}
+
 	paths := args
 
+	var algorithm string
+	if options.HasOption("--fingerprint-algorithm") {
+		algorithm = options.Get("--fingerprint-algorithm").Argument
+
+		if err := fingerprint.ValidateFileAlgorithm(algorithm); err != nil {
+			return err, nil
+		}
+	}
+
+	var template []exportRecord
+	if options.HasOption("--template") {
+		var err error
+		template, err = readTemplate(options.Get("--template").Argument)
+		if err != nil {
+			return err, nil
+		}
+	}
+
 	if len(paths) == 0 {
 		workingDirectory, err := os.Getwd()
 		if err != nil {
-			return fmt.Errorf("could not identify working directory: %v", err), nil
+			return fmt.Errorf("could not identify working directory: %w", err), nil
 		}
 
 		paths = []string{workingDirectory}
@@ -54,15 +96,19 @@ func initExec(options Options, args []string, databasePath string) (error, warni
 
 	warnings := make(warnings, 0, 10)
 	for _, path := range paths {
-		if err := initializeDatabase(path); err != nil {
-			warnings = append(warnings, fmt.Sprintf("%v: could not initialize database: %v", path, err))
+		initWarnings, err := initializeDatabase(path, algorithm, options.HasOption("--encrypt"), template)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: could not initialize database: %w", path, err))
+		}
+		for _, warning := range initWarnings {
+			warnings = append(warnings, fmt.Errorf("%v: %v", path, warning))
 		}
 	}
 
 	return nil, warnings
 }
 
-func initializeDatabase(path string) error {
+func initializeDatabase(path, fingerprintAlgorithm string, encrypt bool, template []exportRecord) (warnings, error) {
 	log.Warnf("%v: creating database", path)
 
 	tmsuPath := filepath.Join(path, ".tmsu")
@@ -70,5 +116,130 @@ func initializeDatabase(path string) error {
 
 	dbPath := filepath.Join(tmsuPath, "db")
 
-	return storage.CreateAt(dbPath)
+	var passphrase string
+	if encrypt {
+		var err error
+		passphrase, err = newDatabasePassphrase(dbPath, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := storage.CreateEncryptedAt(dbPath, passphrase); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := storage.CreateAt(dbPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if fingerprintAlgorithm == "" && template == nil {
+		return nil, nil
+	}
+
+	var store *storage.Storage
+	var err error
+	if encrypt {
+		store, err = storage.OpenEncryptedAt(dbPath, passphrase)
+	} else {
+		store, err = storage.OpenAt(dbPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Commit()
+
+	if fingerprintAlgorithm != "" {
+		if _, err := store.UpdateSetting(tx, "fileFingerprintAlgorithm", fingerprintAlgorithm); err != nil {
+			return nil, fmt.Errorf("could not set fingerprint algorithm: %w", err)
+		}
+	}
+
+	return seedTaxonomy(store, tx, template)
+}
+
+// the types of export record that make up a template's taxonomy
+var templateRecordTypes = map[string]bool{"tag": true, "alias": true, "value": true, "implication": true, "rule": true}
+
+// reads the export records of the template at the path or URL
+func readTemplate(location string) ([]exportRecord, error) {
+	var reader io.Reader
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		log.Infof(2, "downloading template '%v'", location)
+
+		client := http.Client{Timeout: time.Minute}
+		response, err := client.Get(location)
+		if err != nil {
+			return nil, fmt.Errorf("could not download template: %w", err)
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not download template '%v': %v", location, response.Status)
+		}
+
+		reader = response.Body
+	} else {
+		file, err := os.Open(location)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not open template: %w", location, err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	records := make([]exportRecord, 0, 100)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record exportRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("%v: line %v: could not parse record: %w", location, lineNumber, err)
+		}
+
+		if templateRecordTypes[record.Type] {
+			records = append(records, record)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%v: could not read template: %w", location, err)
+	}
+
+	return records, nil
+}
+
+func seedTaxonomy(store *storage.Storage, tx *storage.Tx, template []exportRecord) (warnings, error) {
+	warnings := make(warnings, 0, 10)
+
+	for _, record := range template {
+		warning, err := importRecord(store, tx, record)
+		if err != nil {
+			return warnings, fmt.Errorf("could not apply template: %w", err)
+		}
+		if warning != "" {
+			warnings = append(warnings, errors.New(warning))
+		}
+	}
+
+	log.Infof(2, "seeded %v record(s) from template", len(template))
+
+	return warnings, nil
 }
@@ -0,0 +1,159 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/storage/database"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var LogCommand = Command{
+	Name:     "log",
+	Synopsis: "Show the audit log of changes",
+	Usages:   []string{"tmsu log [OPTION]..."},
+	Description: `Shows the changes made to the database, oldest first, as recorded in the audit log whilst the 'auditLog' setting is enabled: see the 'config' subcommand.
+
+Each change is shown with the time it was made, the user that made it, the command that made it and the number of rows of each table that it inserted (+), updated (~) and deleted (-). Reversals by the 'undo' subcommand are logged as changes in their own right.
+
+With --since only the changes made since the TIME specified are shown: either YYYY[-MM[-DD[THH:MM[:SS]]]], in local time, or a duration such as '90m' or '24h' before now. With --user only the changes made by the USER specified are shown.`,
+	Examples: []string{`$ tmsu config auditLog=yes
+$ tmsu tag song.mp3 music
+$ tmsu log
+2026-10-14 10:41:42 paul: tmsu tag song.mp3 music (file +1, file_tag +1, tag +1)`,
+		"$ tmsu log --since 2026-10-01",
+		"$ tmsu log --since 24h --user paul"},
+	Options: Options{{"--since", "-s", "show only the changes made since TIME", true, ""},
+		{"--user", "-u", "show only the changes made by USER", true, ""}},
+	Exec: logExec,
+}
+
+// unexported
+
+func logExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	if os.Getenv("TMSU_REMOTE") != "" || storage.IsPostgres(databasePath) {
+		return errors.New("changes are only logged for a database held in a local file"), nil
+	}
+	if _, err := os.Stat(databasePath); err != nil {
+		return errNoDatabase, nil
+	}
+
+	var since time.Time
+	if options.HasOption("--since") {
+		var err error
+		since, err = parseSince(options.Get("--since").Argument, time.Now())
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	user := ""
+	if options.HasOption("--user") {
+		user = options.Get("--user").Argument
+	}
+
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	entries, err := storage.ReadAuditLog(databasePath)
+	if err != nil {
+		return fmt.Errorf("could not read audit log: %w", err), nil
+	}
+	if entries == nil {
+		return nil, warnings{errors.New("no changes have been logged: enable the 'auditLog' setting to log them")}
+	}
+
+	selected := make([]storage.AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Time.Before(since) || (user != "" && entry.User != user) {
+			continue
+		}
+
+		selected = append(selected, entry)
+	}
+
+	if asJson {
+		return printJson(selected), nil
+	}
+
+	for _, entry := range selected {
+		user := entry.User
+		if user == "" {
+			user = "?"
+		}
+
+		fmt.Printf("%v %v: %v (%v)\n", entry.Time.Local().Format("2006-01-02 15:04:05"), user, entry.Command, formatRowCounts(entry.Changes))
+	}
+
+	return nil, nil
+}
+
+// parses the time from which to show changes, either a time in the local time
+// zone or a duration before now
+func parseSince(text string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(text); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+
+	localTime := strings.Replace(text, "T", " ", 1)
+	for _, layout := range []string{"2006", "2006-01", "2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if since, err := time.ParseInLocation(layout, localTime, time.Local); err == nil {
+			return since, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%v': expected YYYY[-MM[-DD[THH:MM[:SS]]]] or a duration such as '24h'", text)
+}
+
+// summarizes the rows changed in each table, e.g. 'file +1, file_tag +2 -1'
+func formatRowCounts(changes map[string]database.RowCounts) string {
+	tables := make([]string, 0, len(changes))
+	for table := range changes {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	summaries := make([]string, len(tables))
+	for index, table := range tables {
+		counts := changes[table]
+
+		summary := table
+		if counts.Inserted > 0 {
+			summary += fmt.Sprintf(" +%v", counts.Inserted)
+		}
+		if counts.Updated > 0 {
+			summary += fmt.Sprintf(" ~%v", counts.Updated)
+		}
+		if counts.Deleted > 0 {
+			summary += fmt.Sprintf(" -%v", counts.Deleted)
+		}
+
+		summaries[index] = summary
+	}
+
+	return strings.Join(summaries, ", ")
+}
@@ -0,0 +1,131 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/oniony/TMSU/common/terminal/ansi"
+	"github.com/oniony/TMSU/version"
+	"strings"
+)
+
+// unexported
+
+// renders the help for the command as a man page, such as for 'man -l', so that
+// the man pages are generated from the same text as the built-in help
+func manPage(command *Command) string {
+	buffer := new(bytes.Buffer)
+
+	fmt.Fprintf(buffer, ".TH %v 1 \"\" \"TMSU %v\" \"General Commands Manual\"\n", manEscape(strings.ToUpper("tmsu-"+command.Name)), version.Version)
+
+	buffer.WriteString(".SH NAME\n")
+	fmt.Fprintf(buffer, "tmsu\\-%v \\- %v\n", manEscape(command.Name), manEscape(ansi.Strip(command.Synopsis)))
+
+	buffer.WriteString(".SH SYNOPSIS\n")
+	for index, usage := range command.Usages {
+		if index > 0 {
+			buffer.WriteString(".br\n")
+		}
+		fmt.Fprintf(buffer, "\\fB%v\\fR\n", manEscape(usage))
+	}
+
+	buffer.WriteString(".SH DESCRIPTION\n")
+	writeManText(buffer, ansi.Strip(command.Description))
+
+	if len(command.Options) > 0 {
+		buffer.WriteString(".SH OPTIONS\n")
+		for _, option := range command.Options {
+			fmt.Fprintf(buffer, ".TP\n%v\n%v\n", manOptionName(option), manEscape(option.Description))
+		}
+	}
+
+	if len(command.Examples) > 0 {
+		buffer.WriteString(".SH EXAMPLES\n")
+		for _, example := range command.Examples {
+			buffer.WriteString(".PP\n.RS\n.nf\n")
+			for _, line := range strings.Split(example, "\n") {
+				buffer.WriteString(manLine(line) + "\n")
+			}
+			buffer.WriteString(".fi\n.RE\n")
+		}
+	}
+
+	if len(command.Aliases) > 0 {
+		buffer.WriteString(".SH ALIASES\n")
+		buffer.WriteString(manEscape(strings.Join(command.Aliases, ", ")) + "\n")
+	}
+
+	buffer.WriteString(".SH SEE ALSO\n")
+	buffer.WriteString("\\fBtmsu\\fR(1)\n")
+
+	return buffer.String()
+}
+
+// writes the paragraphs of the text, leaving the lines that are indented, such
+// as those of lists and tables, as they are
+func writeManText(buffer *bytes.Buffer, text string) {
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		buffer.WriteString(".PP\n")
+
+		preformatted := false
+		for _, line := range strings.Split(paragraph, "\n") {
+			indented := strings.HasPrefix(line, " ")
+
+			switch {
+			case indented && !preformatted:
+				buffer.WriteString(".nf\n")
+			case !indented && preformatted:
+				buffer.WriteString(".fi\n")
+			}
+			preformatted = indented
+
+			buffer.WriteString(manLine(line) + "\n")
+		}
+
+		if preformatted {
+			buffer.WriteString(".fi\n")
+		}
+	}
+}
+
+func manOptionName(option Option) string {
+	name := "\\fB" + manEscape(option.LongName) + "\\fR"
+	if option.HasArgument {
+		name += "=\\fIVALUE\\fR"
+	}
+	if option.ShortName != "" {
+		name = "\\fB" + manEscape(option.ShortName) + "\\fR, " + name
+	}
+
+	return name
+}
+
+// escapes a line of text so that it is not taken as a request
+func manLine(line string) string {
+	line = manEscape(line)
+	if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+		line = "\\&" + line
+	}
+
+	return line
+}
+
+var manEscaper = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+func manEscape(text string) string {
+	return manEscaper.Replace(text)
+}
@@ -18,25 +18,51 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var MergeCommand = Command{
-	Name:        "merge",
-	Synopsis:    "Merge tags",
-	Usages:      []string{"tmsu merge TAG... DEST"},
-	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.`,
+	Name:     "merge",
+	Synopsis: "Merge tags",
+	Usages:   []string{"tmsu merge TAG... DEST", "tmsu merge --value [--tag=TAG] VALUE... DEST", "tmsu merge --variants"},
+	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.
+
+When --namespace is specified the tags of the namespaces TAG are moved into namespace DEST, those colliding with a tag already within DEST being merged into it, e.g. 'people:alice' is merged into 'person:alice' whereas 'people:bob' is renamed 'person:bob'.
+
+When --value is specified VALUEs are merged into value DEST. With --tag the values are merged only where they are applied with TAG, e.g. to fold a mistyped 'year=20223' into 'year=2023' without affecting other tags with the value '20223'.
+
+When --variants is specified the tags whose names differ only by case or Unicode normalization, e.g. 'Photo' and 'photo', are each merged into the variant applied to the most files. This tidies a database before enabling the 'ignoreTagCase' or 'normalizeTagNames' settings.
+
+Before merging tags, values or namespaces applied to ` + strconv.Itoa(confirmationFileCount) + ` or more files between them, the number of files each is applied to is listed and confirmation is asked for. Specify --yes to merge them without confirmation, such as from a script.`,
 	Examples: []string{`$ tmsu merge cehese cheese`,
-		`$ tmsu merge outdoors outdoor outside`},
-	Options: Options{Option{"--value", "", "merge values", false, ""}},
-	Exec:    mergeExec,
+		`$ tmsu merge outdoors outdoor outside`,
+		`$ tmsu merge --namespace people persons person`,
+		`$ tmsu merge --value --tag=year 20223 2032 2023`,
+		"$ tmsu merge --variants\nPhoto: merged into photo"},
+	Options: Options{Option{"--value", "", "merge values", false, ""},
+		Option{"--tag", "-t", "merge values only where applied with TAG", true, ""},
+		Option{"--namespace", "", "merge tag namespaces", false, ""},
+		Option{"--variants", "", "merge tags differing only by case or Unicode normalization", false, ""},
+		Option{"--pretend", "-P", "do not make any changes", false, ""},
+		yesOption},
+	Exec: mergeExec,
 }
 
 // unexported
 
 func mergeExec(options Options, args []string, databasePath string) (error, warnings) {
-	if len(args) < 2 {
-		return fmt.Errorf("too few arguments"), nil
+	variants := options.HasOption("--variants")
+
+	switch {
+	case variants && len(args) > 0:
+		return errTooManyArguments, nil
+	case !variants && len(args) < 2:
+		return errTooFewArguments, nil
 	}
 
 	store, err := openDatabase(databasePath)
@@ -51,24 +77,157 @@ func mergeExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer tx.Commit()
 
-	sourceNames := make([]string, len(args)-1)
-	for index, name := range args[:len(args)-1] {
-		sourceNames[index] = parseTagOrValueName(name)
+	var sourceNames []string
+	var destName string
+	if !variants {
+		sourceNames = make([]string, len(args)-1)
+		for index, name := range args[:len(args)-1] {
+			sourceNames[index] = parseTagOrValueName(name)
+		}
+
+		destName = parseTagOrValueName(args[len(args)-1])
+
+		confirmed, err := confirmMerge(store, tx, sourceNames, destName, options)
+		if err != nil || !confirmed {
+			return err, nil
+		}
 	}
 
-	destName := parseTagOrValueName(args[len(args)-1])
+	if !options.HasOption("--pretend") {
+		if err := backupBeforeChange(store, tx); err != nil {
+			return err, nil
+		}
+	}
 
-	if options.HasOption("--value") {
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	if variants {
+		return mergeVariants(store, tx, options.HasOption("--pretend"))
+	}
+
+	switch {
+	case options.HasOption("--value") && options.HasOption("--tag"):
+		return mergeTagValues(store, tx, parseTagOrValueName(options.Get("--tag").Argument), sourceNames, destName)
+	case options.HasOption("--value"):
 		return mergeValues(store, tx, sourceNames, destName)
+	case options.HasOption("--namespace"):
+		return mergeNamespaces(store, tx, sourceNames, destName)
 	}
 
 	return mergeTags(store, tx, sourceNames, destName)
 }
 
+// asks for confirmation before merging tags, values or namespaces applied to many files
+func confirmMerge(store *storage.Storage, tx *storage.Tx, sourceNames []string, destName string, options Options) (bool, error) {
+	if options.HasOption("--pretend") || dryRun {
+		return true, nil
+	}
+
+	names := make([]string, 0, len(sourceNames))
+	fileCounts := make([]uint, 0, len(sourceNames))
+
+	for _, sourceName := range sourceNames {
+		if sourceName == destName {
+			continue
+		}
+
+		fileCount, found, err := mergeSourceFileCount(store, tx, sourceName, options)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			continue
+		}
+
+		names = append(names, sourceName)
+		fileCounts = append(fileCounts, fileCount)
+	}
+
+	impact, total := fileCountImpact(names, fileCounts)
+	if total < confirmationFileCount {
+		return true, nil
+	}
+
+	kind := "tag(s)"
+	switch {
+	case options.HasOption("--value"):
+		kind = "value(s)"
+	case options.HasOption("--namespace"):
+		kind = "namespace(s)"
+	}
+
+	return confirm(options, impact, fmt.Sprintf("merge these %v %v into '%v'?", len(names), kind, destName))
+}
+
+// the number of files to which the tag, value or namespace to be merged is applied
+func mergeSourceFileCount(store *storage.Storage, tx *storage.Tx, sourceName string, options Options) (uint, bool, error) {
+	switch {
+	case options.HasOption("--value") && options.HasOption("--tag"):
+		tagName := parseTagOrValueName(options.Get("--tag").Argument)
+		comparison := query.ComparisonExpression{query.TagExpression{tagName}, "==", query.ValueExpression{Name: sourceName}}
+
+		fileCount, err := store.FileCountForQuery(tx, comparison, nil, "", true, false)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not count files tagged '%v=%v': %w", tagName, sourceName, err)
+		}
+
+		return fileCount, fileCount > 0, nil
+	case options.HasOption("--value"):
+		value, err := store.ValueByName(tx, sourceName)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not retrieve value '%v': %w", sourceName, err)
+		}
+		if value == nil {
+			return 0, false, nil
+		}
+
+		fileCount, err := store.FileCountByValueId(tx, value.Id)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not count files with value '%v': %w", sourceName, err)
+		}
+
+		return fileCount, true, nil
+	case options.HasOption("--namespace"):
+		tags, err := store.TagsByNamespace(tx, sourceName)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not retrieve tags within namespace '%v': %w", sourceName, err)
+		}
+
+		fileCount := uint(0)
+		for _, tag := range tags {
+			tagFileCount, err := store.FileCountByTagId(tx, tag.Id)
+			if err != nil {
+				return 0, false, fmt.Errorf("could not count files tagged '%v': %w", tag.Name, err)
+			}
+
+			fileCount += tagFileCount
+		}
+
+		return fileCount, len(tags) > 0, nil
+	default:
+		tag, err := store.TagByName(tx, sourceName)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not retrieve tag '%v': %w", sourceName, err)
+		}
+		if tag == nil {
+			return 0, false, nil
+		}
+
+		fileCount, err := store.FileCountByTagId(tx, tag.Id)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not count files tagged '%v': %w", sourceName, err)
+		}
+
+		return fileCount, true, nil
+	}
+}
+
 func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string, destTagName string) (error, warnings) {
 	destTag, err := store.TagByName(tx, destTagName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err), nil
+		return fmt.Errorf("could not retrieve tag '%v': %w", destTagName, err), nil
 	}
 	if destTag == nil {
 		return fmt.Errorf("no such tag '%v'", destTagName), nil
@@ -77,38 +236,209 @@ func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string,
 	warnings := make(warnings, 0, 10)
 	for _, sourceTagName := range sourceTagNames {
 		if sourceTagName == destTagName {
-			warnings = append(warnings, fmt.Sprintf("cannot merge tag '%v' into itself", sourceTagName))
+			warnings = append(warnings, fmt.Errorf("cannot merge tag '%v' into itself", sourceTagName))
 			continue
 		}
 
 		sourceTag, err := store.TagByName(tx, sourceTagName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %w", sourceTagName, err), warnings
 		}
 		if sourceTag == nil {
-			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", sourceTagName))
+			warnings = append(warnings, NoSuchTagError{sourceTagName})
 			continue
 		}
 
-		log.Infof(2, "finding files tagged '%v'.", sourceTagName)
+		if err := mergeTag(store, tx, sourceTag, destTag); err != nil {
+			return err, warnings
+		}
+	}
 
-		fileTags, err := store.FileTagsByTagId(tx, sourceTag.Id, true)
-		if err != nil {
-			return fmt.Errorf("could not retrieve files for tag '%v': %v", sourceTagName, err), warnings
+	return nil, warnings
+}
+
+func mergeTag(store *storage.Storage, tx *storage.Tx, sourceTag, destTag *entities.Tag) error {
+	log.Infof(2, "finding files tagged '%v'.", sourceTag.Name)
+
+	fileTags, err := store.FileTagsByTagId(tx, sourceTag.Id, true)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files for tag '%v': %w", sourceTag.Name, err)
+	}
+
+	log.Infof(2, "applying tag '%v' to these files.", destTag.Name)
+
+	for _, fileTag := range fileTags {
+		if _, err = store.AddFileTag(tx, fileTag.FileId, destTag.Id, fileTag.ValueId); err != nil {
+			return fmt.Errorf("could not apply tag '%v' to file #%v: %w", destTag.Name, fileTag.FileId, err)
 		}
+	}
 
-		log.Infof(2, "applying tag '%v' to these files.", destTagName)
+	log.Infof(2, "deleting tag '%v'.", sourceTag.Name)
 
-		for _, fileTag := range fileTags {
-			if _, err = store.AddFileTag(tx, fileTag.FileId, destTag.Id, fileTag.ValueId); err != nil {
-				return fmt.Errorf("could not apply tag '%v' to file #%v: %v", destTagName, fileTag.FileId, err), warnings
+	if err = store.DeleteTag(tx, sourceTag.Id); err != nil {
+		return fmt.Errorf("could not delete tag '%v': %w", sourceTag.Name, err)
+	}
+
+	return nil
+}
+
+func mergeVariants(store *storage.Storage, tx *storage.Tx, pretend bool) (error, warnings) {
+	log.Info(2, "identifying tag name variants.")
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %w", err), nil
+	}
+
+	usages, err := store.TagUsage(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag usage: %w", err), nil
+	}
+
+	fileCounts := make(map[entities.TagId]uint, len(usages))
+	for _, usage := range usages {
+		fileCounts[usage.Id] = usage.FileCount
+	}
+
+	keys := make([]string, 0, len(tags))
+	variantsByKey := make(map[string]entities.Tags, len(tags))
+	for _, tag := range tags {
+		key := entities.TagNameKey(tag.Name, true, true)
+		if _, ok := variantsByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		variantsByKey[key] = append(variantsByKey[key], tag)
+	}
+
+	// merge the deepest tags of a hierarchy first so that their parents have
+	// only the children of the surviving variants by the time they are merged
+	sort.SliceStable(keys, func(i, j int) bool {
+		return strings.Count(keys[i], entities.TagNameSeparator) > strings.Count(keys[j], entities.TagNameSeparator)
+	})
+
+	for _, key := range keys {
+		variants := variantsByKey[key]
+		if len(variants) < 2 {
+			continue
+		}
+
+		destTag := survivingVariant(variants, fileCounts)
+
+		for _, sourceTag := range variants {
+			if sourceTag.Id == destTag.Id {
+				continue
+			}
+
+			fmt.Printf("%v: merged into %v\n", sourceTag.Name, destTag.Name)
+
+			if pretend {
+				continue
+			}
+
+			if err := moveChildTags(store, tx, sourceTag, destTag); err != nil {
+				return err, nil
+			}
+
+			if err := mergeTag(store, tx, sourceTag, destTag); err != nil {
+				return err, nil
 			}
 		}
+	}
 
-		log.Infof(2, "deleting tag '%v'.", sourceTagName)
+	return nil, nil
+}
 
-		if err = store.DeleteTag(tx, sourceTag.Id); err != nil {
-			return fmt.Errorf("could not delete tag '%v': %v", sourceTagName, err), warnings
+// the variant applied to the most files, preferring a normalized name and then the first by name
+func survivingVariant(variants entities.Tags, fileCounts map[entities.TagId]uint) *entities.Tag {
+	survivor := variants[0]
+	for _, variant := range variants[1:] {
+		switch {
+		case fileCounts[variant.Id] > fileCounts[survivor.Id]:
+			survivor = variant
+		case fileCounts[variant.Id] < fileCounts[survivor.Id]:
+			continue
+		case entities.NormalizeTagName(variant.Name) == variant.Name && entities.NormalizeTagName(survivor.Name) != survivor.Name:
+			survivor = variant
+		}
+	}
+
+	return survivor
+}
+
+// moves the children of a tag beneath another tag
+func moveChildTags(store *storage.Storage, tx *storage.Tx, sourceTag, destTag *entities.Tag) error {
+	descendants, err := store.DescendantTags(tx, sourceTag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags beneath '%v': %w", sourceTag.Name, err)
+	}
+
+	for _, descendant := range descendants {
+		if entities.ParentTagName(descendant.Name) != sourceTag.Name {
+			// moved along with its parent
+			continue
+		}
+
+		childName := destTag.Name + descendant.Name[len(sourceTag.Name):]
+
+		log.Infof(2, "renaming tag '%v' to '%v'.", descendant.Name, childName)
+
+		if _, err := store.RenameTag(tx, descendant.Id, childName); err != nil {
+			return fmt.Errorf("could not rename tag '%v' to '%v': %w", descendant.Name, childName, err)
+		}
+	}
+
+	return nil
+}
+
+func mergeNamespaces(store *storage.Storage, tx *storage.Tx, sourceNamespaces []string, destNamespace string) (error, warnings) {
+	if err := entities.ValidateTagNamespace(destNamespace); err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, sourceNamespace := range sourceNamespaces {
+		if sourceNamespace == destNamespace {
+			warnings = append(warnings, fmt.Errorf("cannot merge namespace '%v' into itself", sourceNamespace))
+			continue
+		}
+
+		sourceTags, err := store.TagsByNamespace(tx, sourceNamespace)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tags within namespace '%v': %w", sourceNamespace, err), warnings
+		}
+		if len(sourceTags) == 0 {
+			warnings = append(warnings, NoSuchNamespaceError{sourceNamespace})
+			continue
+		}
+
+		// move the deepest tags of a hierarchy first so that their parents are
+		// childless by the time they are merged
+		sort.SliceStable(sourceTags, func(i, j int) bool {
+			return strings.Count(sourceTags[i].Name, entities.TagNameSeparator) > strings.Count(sourceTags[j].Name, entities.TagNameSeparator)
+		})
+
+		for _, sourceTag := range sourceTags {
+			destTagName := entities.WithTagNamespace(sourceTag.Name, destNamespace)
+
+			destTag, err := store.TagByName(tx, destTagName)
+			if err != nil {
+				return fmt.Errorf("could not retrieve tag '%v': %w", destTagName, err), warnings
+			}
+
+			if destTag != nil {
+				if err := mergeTag(store, tx, sourceTag, destTag); err != nil {
+					return err, warnings
+				}
+
+				continue
+			}
+
+			log.Infof(2, "renaming tag '%v' to '%v'.", sourceTag.Name, destTagName)
+
+			if _, err := store.RenameTag(tx, sourceTag.Id, destTagName); err != nil {
+				return fmt.Errorf("could not rename tag '%v' to '%v': %w", sourceTag.Name, destTagName, err), warnings
+			}
 		}
 	}
 
@@ -118,7 +448,7 @@ func mergeTags(store *storage.Storage, tx *storage.Tx, sourceTagNames []string,
 func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []string, destValueName string) (error, warnings) {
 	destValue, err := store.ValueByName(tx, destValueName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve value '%v': %v", destValueName, err), nil
+		return fmt.Errorf("could not retrieve value '%v': %w", destValueName, err), nil
 	}
 	if destValue == nil {
 		return fmt.Errorf("no such value '%v'", destValueName), nil
@@ -128,16 +458,16 @@ func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []stri
 
 	for _, sourceValueName := range sourceValueNames {
 		if sourceValueName == destValueName {
-			warnings = append(warnings, fmt.Sprintf("cannot merge value '%v' into itself", sourceValueName))
+			warnings = append(warnings, fmt.Errorf("cannot merge value '%v' into itself", sourceValueName))
 			continue
 		}
 
 		sourceValue, err := store.ValueByName(tx, sourceValueName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve value '%v': %v", sourceValueName, err), warnings
+			return fmt.Errorf("could not retrieve value '%v': %w", sourceValueName, err), warnings
 		}
 		if sourceValue == nil {
-			warnings = append(warnings, fmt.Sprintf("no such value '%v'", sourceValueName))
+			warnings = append(warnings, NoSuchValueError{sourceValueName})
 			continue
 		}
 
@@ -145,21 +475,67 @@ func mergeValues(store *storage.Storage, tx *storage.Tx, sourceValueNames []stri
 
 		fileTags, err := store.FileTagsByValueId(tx, sourceValue.Id)
 		if err != nil {
-			return fmt.Errorf("could not retrieve files for value '%v': %v", sourceValueName, err), warnings
+			return fmt.Errorf("could not retrieve files for value '%v': %w", sourceValueName, err), warnings
 		}
 
 		log.Infof(2, "applying value '%v' to these files.", destValueName)
 
 		for _, fileTag := range fileTags {
 			if _, err = store.AddFileTag(tx, fileTag.FileId, fileTag.TagId, destValue.Id); err != nil {
-				return fmt.Errorf("could not apply value '%v' to file #%v: %v", destValueName, fileTag.FileId, err), warnings
+				return fmt.Errorf("could not apply value '%v' to file #%v: %w", destValueName, fileTag.FileId, err), warnings
 			}
 		}
 
 		log.Infof(2, "deleting value '%v'.", sourceValueName)
 
 		if err = store.DeleteValue(tx, sourceValue.Id); err != nil {
-			return fmt.Errorf("could not delete value '%v': %v", sourceValueName, err), warnings
+			return fmt.Errorf("could not delete value '%v': %w", sourceValueName, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+func mergeTagValues(store *storage.Storage, tx *storage.Tx, tagName string, sourceValueNames []string, destValueName string) (error, warnings) {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), nil
+	}
+	if tag == nil {
+		return fmt.Errorf("no such tag '%v'", tagName), nil
+	}
+
+	destValue, err := store.ValueByName(tx, destValueName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value '%v': %w", destValueName, err), nil
+	}
+	if destValue == nil {
+		return fmt.Errorf("no such value '%v'", destValueName), nil
+	}
+
+	values, err := store.ValuesByTag(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values for tag '%v': %w", tagName, err), nil
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, sourceValueName := range sourceValueNames {
+		if sourceValueName == destValueName {
+			warnings = append(warnings, fmt.Errorf("cannot merge value '%v' into itself", sourceValueName))
+			continue
+		}
+
+		sourceValue := values.Find(sourceValueName)
+		if sourceValue == nil {
+			warnings = append(warnings, fmt.Errorf("tag '%v' has no value '%v'", tagName, sourceValueName))
+			continue
+		}
+
+		log.Infof(2, "applying value '%v' of tag '%v' in place of value '%v'.", destValueName, tagName, sourceValueName)
+
+		if err := store.ReplaceFileTagValue(tx, tag.Id, sourceValue.Id, destValue.Id); err != nil {
+			return fmt.Errorf("could not merge value '%v' of tag '%v' into '%v': %w", sourceValueName, tagName, destValueName, err), warnings
 		}
 	}
 
@@ -0,0 +1,84 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/metadata"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+)
+
+// unexported
+
+// applies tags taken from the metadata of files, such as the camera model of
+// a photograph or the artist of a song
+type metadataExtractor struct {
+	store    *storage.Storage
+	settings entities.Settings
+}
+
+func newMetadataExtractor(store *storage.Storage, settings entities.Settings, extract bool) *metadataExtractor {
+	if !extract {
+		return nil
+	}
+
+	return &metadataExtractor{store, settings}
+}
+
+// the tags to apply to the file on account of its metadata
+func (extractor *metadataExtractor) pairsFor(tx *storage.Tx, file *entities.File) (entities.TagIdValueIdPairs, error) {
+	if extractor == nil || file.IsDir {
+		return nil, nil
+	}
+
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = detectMimeType(file.Path())
+	}
+
+	fields, err := metadata.Extract(file.Path(), mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not extract metadata: %w", file.Path(), err)
+	}
+
+	tagArgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if err := entities.ValidateValueName(field.Value); err != nil {
+			log.Warnf("%v: ignoring %v metadata: %v", file.Path(), field.Tag, err)
+			continue
+		}
+
+		tagArgs = append(tagArgs, field.Tag+"="+escape(field.Value, '\\', '='))
+	}
+
+	if len(tagArgs) == 0 {
+		return nil, nil
+	}
+
+	log.Infof(2, "%v: extracted metadata %v", file.Path(), tagArgs)
+
+	pairs, warnings, err := parseTagValuePairs(extractor.store, tx, extractor.settings, tagArgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		log.Warnf("%v: %v", file.Path(), warning)
+	}
+
+	return pairs, nil
+}
@@ -20,11 +20,14 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/trash"
+	"github.com/oniony/TMSU/storage"
 	"github.com/oniony/TMSU/vfs"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -34,7 +37,7 @@ var MountCommand = Command{
 	Synopsis: "Mount the virtual filesystem",
 	Usages: []string{"tmsu mount",
 		"tmsu mount [OPTION]... [FILE] MOUNTPOINT"},
-	Description: `Without arguments, lists the currently mounted file-systems, otherwise mounts a virtual file-system at the path MOUNTPOINT.
+	Description: `Without arguments, lists the currently mounted file-systems, as does the 'mounts' subcommand, otherwise mounts a virtual file-system at the path MOUNTPOINT.
 
 Where FILE is specified, the database at FILE is mounted.
 
@@ -42,12 +45,36 @@ If FILE is not specified but the TMSU_DB environment variable is defined then th
 
 Where neither FILE is specified nor TMSU_DB defined then the default database is mounted.
 
-To allow other users access to the mounted filesystem, pass the 'allow_other' FUSE option, e.g. 'tmsu mount --options=allow_other mp'. (FUSE only allows the root user to use this option unless 'user_allow_other' is present in '/etc/fuse.conf'.)`,
+To allow other users access to the mounted filesystem, pass the 'allow_other' FUSE option, e.g. 'tmsu mount --options=allow_other mp'. (FUSE only allows the root user to use this option unless 'user_allow_other' is present in '/etc/fuse.conf'.)
+
+On macOS the virtual file-system is mounted with macFUSE. The volume is named after MOUNTPOINT and the Finder is kept from storing its '._' files and 'com.apple' extended attributes within it: these defaults are overridden by passing the 'volname', 'appledouble' or 'applexattr' options explicitly. Files named '._*' or '.DS_Store' are not shown within it.
+
+Files can be tagged through the virtual file-system by creating a symbolic link to them within a tag directory, e.g. with 'ln -s', retagged by moving their symbolic link from one tag directory to another and untagged by deleting their symbolic link. Moving a symbolic link out of a tag directory, such as 'tags/a/b', removes each of its tags that the directory it is moved into does not have. Only symbolic links can be created: moving or copying a file itself into the virtual file-system, such as with 'mv' or 'cp', fails as it holds only symbolic links.
+
+A query can be saved as a view by creating a symbolic link within the 'views' directory named after the view and whose target is the query. See the 'view' subcommand.
+
+The 'untagged' directory lists the files in the database that have no tags and the 'recent' directory those tagged within the last 7 days, or the number of days of the 'vfsRecentDays' setting, so that newly added files can be triaged from a file manager.
+
+By default, deleting a symbolic link from a query, view, favorite, untagged or recent directory untags the file only. With --delete-policy=trash the file is instead removed from the database and moved to the trash and with --delete-policy=delete it is removed from the database and deleted permanently. Take care: under these policies 'rm -r' within the virtual filesystem removes the real files. See the 'delete-file' subcommand.
+
+With --previews each query and view directory also holds a '.previews' directory containing a JPEG thumbnail of each image and video within it, named after the file's symbolic link, so that a file manager can show the directory as a gallery. Thumbnails of JPEG, PNG and GIF images are generated directly whilst those of videos and other images require 'ffmpeg'. The thumbnails are generated on first access and cached in the 'cache/previews' directory beside the database.
+
+With --inbox the virtual filesystem also holds an 'inbox' directory into which files can be linked, with 'ln -s' or a file manager's option to link rather than copy or move, to add them to the database. Each file linked into the inbox is added, if it is not already, and tagged with the tags of the 'vfsInboxTags' setting, 'inbox' by default, and the directory lists the files that have all of these tags. Deleting a symbolic link from the inbox removes these tags from the file, leaving it in the database, unless another --delete-policy is in effect.`,
 	Examples: []string{"$ tmsu mount mp",
 		"$ tmsu mount /tmp/db mp",
-		"$ tmsu mount --options=allow_other mp"},
-	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""}},
-	Exec:    mountExec,
+		"$ tmsu mount --options=allow_other mp",
+		"$ tmsu mount --options=volname=Photos mp",
+		"$ ln -s ~/photos/beach.jpg mp/tags/holiday/",
+		"$ ln -s 'holiday and video' mp/views/holiday-videos",
+		"$ tmsu mount --delete-policy=trash mp",
+		"$ tmsu mount --previews mp",
+		"$ tmsu mount --inbox mp",
+		"$ ln -s ~/downloads/report.pdf mp/inbox/"},
+	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""},
+		Option{"--delete-policy", "", "what deleting a file within the virtual filesystem does: " + strings.Join(trash.PolicyNames, ", "), true, "untag"},
+		Option{"--previews", "", "show thumbnails of the images and videos within each query directory", false, ""},
+		Option{"--inbox", "", "add the files linked into the 'inbox' directory to the database", false, ""}},
+	Exec: mountExec,
 }
 
 // unexported
@@ -58,6 +85,17 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 		mountOptions = options.Get("--options").Argument
 	}
 
+	deletePolicy := trash.UntagOnly
+	if options.HasOption("--delete-policy") {
+		var err error
+		if deletePolicy, err = trash.ParsePolicy(options.Get("--delete-policy").Argument); err != nil {
+			return UsageError{err.Error()}, nil
+		}
+	}
+
+	previews := options.HasOption("--previews")
+	inbox := options.HasOption("--inbox")
+
 	store, err := openDatabase(databasePath)
 	if err != nil {
 		return err, nil
@@ -72,63 +110,37 @@ func mountExec(options Options, args []string, databasePath string) (error, warn
 
 	switch len(args) {
 	case 0:
-		if err := listMounts(); err != nil {
+		if err := listMounts(options); err != nil {
 			return err, nil
 		}
 	case 1:
 		mountPath := args[0]
 
-		if err := mountExplicit(store.DbPath, mountPath, mountOptions); err != nil {
+		if err := mountExplicit(store.DbPath, mountPath, mountOptions, deletePolicy, previews, inbox); err != nil {
 			return err, nil
 		}
 	case 2:
 		databasePath := args[0]
 		mountPath := args[1]
 
-		if err := mountExplicit(databasePath, mountPath, mountOptions); err != nil {
+		if err := mountExplicit(databasePath, mountPath, mountOptions, deletePolicy, previews, inbox); err != nil {
 			return err, nil
 		}
 	default:
-		return fmt.Errorf("too many arguments"), nil
+		return errTooManyArguments, nil
 	}
 
 	return nil, nil
 }
 
-func listMounts() error {
-	log.Info(2, "retrieving mount table.")
-
-	mt, err := vfs.GetMountTable()
-	if err != nil {
-		return fmt.Errorf("could not get mount table: %v", err)
-	}
-
-	if len(mt) == 0 {
-		log.Info(2, "mount table is empty.")
-	}
-
-	dbPathWidth := 0
-	for _, mount := range mt {
-		if len(mount.DatabasePath) > dbPathWidth {
-			dbPathWidth = len(mount.DatabasePath)
-		}
-	}
-
-	for _, mount := range mt {
-		fmt.Printf("%-*v\tat\t%v\n", dbPathWidth, mount.DatabasePath, mount.MountPath)
-	}
-
-	return nil
-}
-
-func mountExplicit(databasePath string, mountPath string, mountOptions string) error {
+func mountExplicit(databasePath string, mountPath string, mountOptions string, deletePolicy trash.Policy, previews, inbox bool) error {
 	if alreadyMounted(mountPath) {
 		return fmt.Errorf("%v: mount path already in use", mountPath)
 	}
 
 	stat, err := os.Stat(mountPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not stat: %v", mountPath, err)
+		return fmt.Errorf("%v: could not stat: %w", mountPath, err)
 	}
 	if stat == nil {
 		return fmt.Errorf("%v: mount point does not exist", mountPath)
@@ -137,28 +149,49 @@ func mountExplicit(databasePath string, mountPath string, mountOptions string) e
 		return fmt.Errorf("%v: mount point is not a directory", mountPath)
 	}
 
-	stat, err = os.Stat(databasePath)
-	if err != nil {
-		return fmt.Errorf("%v: could not stat: %v", databasePath, err)
-	}
-	if stat == nil {
-		return fmt.Errorf("%v: database does not exist", databasePath)
+	if !storage.IsPostgres(databasePath) {
+		stat, err = os.Stat(databasePath)
+		if err != nil {
+			return fmt.Errorf("%v: could not stat: %w", databasePath, err)
+		}
+		if stat == nil {
+			return fmt.Errorf("%v: database does not exist", databasePath)
+		}
 	}
 
 	log.Infof(2, "spawning daemon to mount VFS for database '%v' at '%v'", databasePath, mountPath)
 
-	args := []string{"vfs", "--database=" + databasePath, mountPath, "--options=" + mountOptions}
+	args := []string{"vfs", "--database=" + databasePath, mountPath, "--options=" + mountOptions, "--delete-policy=" + deletePolicy.String()}
+	if previews {
+		args = append(args, "--previews")
+	}
+	if inbox {
+		args = append(args, "--inbox")
+	}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
 	daemon := exec.Command(os.Args[0], args...)
 
+	// the daemon has no terminal from which to prompt for the passphrase
+	if encrypted, _ := storage.IsEncrypted(databasePath); encrypted {
+		passphrase, err := databasePassphrase(databasePath)
+		if err != nil {
+			return err
+		}
+
+		daemon.Env = append(os.Environ(), "TMSU_PASSPHRASE="+passphrase)
+	}
+
 	tempFile, err := ioutil.TempFile("", "tmsu-vfs-")
 	if err != nil {
-		return fmt.Errorf("could not get a temporary file: %v", err)
+		return fmt.Errorf("could not get a temporary file: %w", err)
 	}
 	daemon.Stderr = tempFile
 
 	err = daemon.Start()
 	if err != nil {
-		return fmt.Errorf("could not start daemon: %v", err)
+		return fmt.Errorf("could not start daemon: %w", err)
 	}
 
 	log.Info(2, "sleeping.")
@@ -172,7 +205,7 @@ func mountExplicit(databasePath string, mountPath string, mountOptions string) e
 	var rusage syscall.Rusage
 	_, err = syscall.Wait4(daemon.Process.Pid, &waitStatus, syscall.WNOHANG, &rusage)
 	if err != nil {
-		return fmt.Errorf("could not check daemon status: %v", err)
+		return fmt.Errorf("could not check daemon status: %w", err)
 	}
 
 	if waitStatus.Exited() {
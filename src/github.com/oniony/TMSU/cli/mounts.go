@@ -0,0 +1,92 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/vfs"
+)
+
+var MountsCommand = Command{
+	Name:     "mounts",
+	Synopsis: "List the mounted virtual filesystems",
+	Usages:   []string{"tmsu mounts"},
+	Description: `Lists the mounted virtual file-systems along with the databases they are of.
+
+Mounts left behind by a virtual file-system process that has exited are listed as disconnected: these can be removed with 'tmsu unmount --all' or by unmounting them individually.`,
+	Examples: []string{"$ tmsu mounts",
+		"$ tmsu mounts --format=json"},
+	Options: Options{},
+	Exec:    mountsExec,
+}
+
+// unexported
+
+func mountsExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	return listMounts(options), nil
+}
+
+func listMounts(options Options) error {
+	asJson, err := useJson(options)
+	if err != nil {
+		return err
+	}
+
+	log.Info(2, "retrieving mount table.")
+
+	mt, err := vfs.GetMountTable()
+	if err != nil {
+		return fmt.Errorf("could not get mount table: %w", err)
+	}
+
+	if len(mt) == 0 {
+		log.Info(2, "mount table is empty.")
+	}
+
+	if asJson {
+		mounts := make([]jsonMount, len(mt))
+		for index, mount := range mt {
+			mounts[index] = jsonMount{mount.DatabasePath, mount.MountPath, mount.Connected}
+		}
+
+		return printJson(mounts)
+	}
+
+	dbPathWidth := 0
+	for _, mount := range mt {
+		if len(mount.DatabasePath) > dbPathWidth {
+			dbPathWidth = len(mount.DatabasePath)
+		}
+	}
+
+	for _, mount := range mt {
+		if !mount.Connected {
+			fmt.Printf("%-*v\tat\t%v (disconnected)\n", dbPathWidth, "?", mount.MountPath)
+			continue
+		}
+
+		fmt.Printf("%-*v\tat\t%v\n", dbPathWidth, mount.DatabasePath, mount.MountPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"os"
+	"path/filepath"
+)
+
+var MoveCommand = Command{
+	Name:     "move",
+	Synopsis: "Move a file and update its path in the database",
+	Usages:   []string{"tmsu move SOURCE DEST"},
+	Description: `Moves or renames the file SOURCE to DEST on disk and updates its path in the database, along with the paths of any files beneath it if SOURCE is a directory. If DEST is an existing directory then SOURCE is moved into it.
+
+The database is updated within the same transaction as the file is moved so, unlike moving the file and subsequently running 'repair', the database never refers to the old path. If the database cannot be updated the file is moved back.
+
+DEST must not already exist and must be on the same filesystem as SOURCE.
+
+Note: 'mv' is an alias of the 'rename' subcommand, which renames tags rather than files.`,
+	Examples: []string{"$ tmsu move song.mp3 music/song.mp3",
+		"$ tmsu move photos /srv/media  # moves to /srv/media/photos"},
+	Options: Options{},
+	Exec:    moveExec,
+}
+
+// unexported
+
+func moveExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 2 {
+		return errTooFewArguments, nil
+	}
+	if len(args) > 2 {
+		return errTooManyArguments, nil
+	}
+
+	sourcePath, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", args[0], err), nil
+	}
+
+	destPath, err := filepath.Abs(args[1])
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", args[1], err), nil
+	}
+
+	if _, err := os.Lstat(sourcePath); err != nil {
+		switch {
+		case os.IsPermission(err):
+			return PermissionDeniedError{args[0]}, nil
+		case os.IsNotExist(err):
+			return NoSuchFileError{args[0]}, nil
+		default:
+			return err, nil
+		}
+	}
+
+	if stat, err := os.Stat(destPath); err == nil && stat.IsDir() {
+		destPath = filepath.Join(destPath, filepath.Base(sourcePath))
+	}
+
+	if _, err := os.Lstat(destPath); err == nil {
+		return fmt.Errorf("%v: already exists", destPath), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	log.Infof(2, "%v: moving to %v", sourcePath, destPath)
+
+	if err := os.Rename(sourcePath, destPath); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not move '%v' to '%v': %w", args[0], args[1], err), nil
+	}
+
+	if err := manualRepair(store, tx, sourcePath, destPath, false); err != nil {
+		tx.Rollback()
+		return restoreMovedFile(destPath, sourcePath, err), nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return restoreMovedFile(destPath, sourcePath, err), nil
+	}
+
+	return nil, nil
+}
+
+// moves the file back after the database could not be updated
+func restoreMovedFile(destPath, sourcePath string, err error) error {
+	log.Infof(2, "%v: moving back to %v", destPath, sourcePath)
+
+	if renameErr := os.Rename(destPath, sourcePath); renameErr != nil {
+		return fmt.Errorf("could not update database (%v) nor move '%v' back: %w", err, destPath, renameErr)
+	}
+
+	return fmt.Errorf("could not update database: %w", err)
+}
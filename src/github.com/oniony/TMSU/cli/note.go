@@ -0,0 +1,176 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var NoteCommand = Command{
+	Name:     "note",
+	Synopsis: "View or set the note attached to a file",
+	Usages: []string{"tmsu note [OPTION]... FILE [TEXT]...",
+		"tmsu note --delete FILE..."},
+	Description: `Attaches a free-text note to FILE. If TEXT is '-' then the note is read from standard input.
+
+When run without TEXT shows the note attached to FILE.
+
+Notes can only be attached to files that are tagged and are removed when the file is removed from the database. The 'files' subcommand can be used with the --notes option to find files with notes containing particular text.`,
+	Examples: []string{"$ tmsu note receipt.pdf Paid by card, claim back from work",
+		`$ tmsu note receipt.pdf
+Paid by card, claim back from work`,
+		"$ echo 'Multi-line notes' | tmsu note receipt.pdf -",
+		"$ tmsu files --notes='claim back'",
+		"$ tmsu note --delete receipt.pdf"},
+	Options: Options{Option{"--delete", "-d", "deletes the notes", false, ""}},
+	Exec:    noteExec,
+}
+
+// unexported
+
+func noteExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 1 {
+		return errTooFewArguments, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--delete") {
+		return deleteNotes(store, tx, args)
+	}
+
+	if len(args) == 1 {
+		return showNote(store, tx, args[0]), nil
+	}
+
+	text := strings.Join(args[1:], " ")
+	if text == "-" {
+		log.Infof(2, "reading note from standard input")
+
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("could not read standard input: %w", err), nil
+		}
+
+		text = strings.TrimRight(string(data), "\n")
+	}
+
+	return setNote(store, tx, args[0], text), nil
+}
+
+func showNote(store *storage.Storage, tx *storage.Tx, path string) error {
+	file, err := taggedFile(store, tx, path)
+	if err != nil {
+		return err
+	}
+
+	note, err := store.NoteByFileId(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve note: %w", path, err)
+	}
+
+	if note != nil {
+		fmt.Println(note.Text)
+	}
+
+	return nil
+}
+
+func setNote(store *storage.Storage, tx *storage.Tx, path, text string) error {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err
+	}
+
+	file, err := taggedFile(store, tx, path)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(2, "%v: updating note", path)
+
+	if _, err := store.UpdateNote(tx, file.Id, text); err != nil {
+		return fmt.Errorf("%v: could not update note: %w", path, err)
+	}
+
+	return nil
+}
+
+func deleteNotes(store *storage.Storage, tx *storage.Tx, paths []string) (error, warnings) {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, path := range paths {
+		file, err := taggedFile(store, tx, path)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+
+		log.Infof(2, "%v: deleting note", path)
+
+		note, err := store.NoteByFileId(tx, file.Id)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve note: %w", path, err), warnings
+		}
+		if note == nil {
+			warnings = append(warnings, fmt.Errorf("%v: no note", path))
+			continue
+		}
+
+		if err := store.DeleteNote(tx, file.Id); err != nil {
+			return fmt.Errorf("%v: could not delete note: %w", path, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+func taggedFile(store *storage.Storage, tx *storage.Tx, path string) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%v: file is not tagged", path)
+	}
+
+	return file, nil
+}
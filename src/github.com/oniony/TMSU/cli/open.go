@@ -0,0 +1,270 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var OpenCommand = Command{
+	Name:     "open",
+	Synopsis: "Open the files matching a query",
+	Usages: []string{"tmsu open [OPTION]... QUERY",
+		"tmsu open [OPTION]... --view VIEW [QUERY]"},
+	Description: `Opens the files in the database that match QUERY, as per the 'files' subcommand.
+
+Files are opened with 'xdg-open' ('open' on macOS), which is run once for each file, unless a handler is configured for the file's MIME type or --with is specified.
+
+Handlers are configured with the 'openHandlers' setting: a list of MIME type patterns and commands of the form 'PATTERN=COMMAND;PATTERN=COMMAND', where '*' in a pattern matches any text other than '/', e.g. 'image/*=feh;video/*=mpv --fullscreen'. The command of the first pattern to match the file's MIME type is used.
+
+The --with option opens all of the files with the command CMD instead. The files opened with each command other than 'xdg-open' are passed together to a single invocation of it.`,
+	Examples: []string{"$ tmsu open holiday and photo",
+		"$ tmsu open --with mpv 'music and year < 2000'",
+		"$ tmsu open --view recent-photos",
+		"$ tmsu config 'openHandlers=image/*=feh;video/*=mpv --fullscreen'"},
+	Options: Options{{"--with", "-w", "open the files with the command CMD", true, ""},
+		{"--explicit", "-e", "open only explicitly tagged files", false, ""},
+		{"--ignore-case", "-i", "ignore the case of tag and value names", false, ""},
+		{"--limit", "-l", "open at most N files", true, ""},
+		{"--view", "", "open the files matching the saved query VIEW", true, ""},
+		{"--pretend", "-P", "list the commands rather than running them", false, ""}},
+	Exec: openExec,
+}
+
+// unexported
+
+func openExec(options Options, args []string, databasePath string) (error, warnings) {
+	explicitOnly := options.HasOption("--explicit")
+	ignoreCase := options.HasOption("--ignore-case")
+	pretend := options.HasOption("--pretend")
+
+	if len(args) == 0 && !options.HasOption("--view") {
+		return errTooFewArguments, nil
+	}
+
+	var with []string
+	if options.HasOption("--with") {
+		text := options.Get("--with").Argument
+
+		with = strings.Fields(text)
+		if len(with) == 0 {
+			return fmt.Errorf("invalid argument '%v' for '--with'", text), nil
+		}
+	}
+
+	limit := uint(0)
+	if options.HasOption("--limit") {
+		text := options.Get("--limit").Argument
+
+		value, err := strconv.ParseUint(text, 10, 0)
+		if err != nil || value == 0 {
+			return fmt.Errorf("invalid argument '%v' for '--limit'", text), nil
+		}
+
+		limit = uint(value)
+	}
+
+	queryText := strings.Join(args, " ")
+
+	if options.HasOption("--view") {
+		var err error
+		queryText, err = viewQueryText(databasePath, options.Get("--view").Argument, queryText)
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		tx.Commit()
+		return err, nil
+	}
+
+	handlers, err := parseOpenHandlers(settings.OpenHandlers())
+	if err != nil {
+		tx.Commit()
+		return fmt.Errorf("invalid setting 'openHandlers': %w", err), nil
+	}
+
+	files, warnings, err := queryFiles(store, tx, queryText, nil, "", explicitOnly, ignoreCase, false, "name", false, limit)
+
+	// the transaction is not held open whilst the files are open
+	if err := tx.Commit(); err != nil {
+		return err, warnings
+	}
+
+	if err != nil {
+		return err, warnings
+	}
+
+	return nil, append(warnings, openFiles(files, handlers, with, pretend)...)
+}
+
+type openHandler struct {
+	pattern string
+	command []string
+}
+
+// Parses the 'openHandlers' setting, 'PATTERN=COMMAND;PATTERN=COMMAND'.
+func parseOpenHandlers(text string) ([]openHandler, error) {
+	handlers := make([]openHandler, 0, 5)
+
+	for _, entry := range strings.Split(text, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		pattern := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || pattern == "" {
+			return nil, fmt.Errorf("invalid handler '%v': expected PATTERN=COMMAND", entry)
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid MIME type pattern '%v': %w", pattern, err)
+		}
+
+		command := strings.Fields(parts[1])
+		if len(command) == 0 {
+			return nil, fmt.Errorf("invalid handler '%v': no command specified", entry)
+		}
+
+		handlers = append(handlers, openHandler{pattern, command})
+	}
+
+	return handlers, nil
+}
+
+// the command with which a file of the MIME type is opened, if a handler is configured
+func openHandlerFor(handlers []openHandler, mimeType string) []string {
+	for _, handler := range handlers {
+		if matched, _ := path.Match(handler.pattern, mimeType); matched {
+			return handler.command
+		}
+	}
+
+	return nil
+}
+
+func defaultOpener() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open"}
+	case "windows":
+		return []string{"cmd", "/c", "start", ""}
+	default:
+		return []string{"xdg-open"}
+	}
+}
+
+type openInvocation struct {
+	command []string
+	paths   []string
+}
+
+func openFiles(files entities.Files, handlers []openHandler, with []string, pretend bool) warnings {
+	warnings := make(warnings, 0, 10)
+
+	// the files are grouped by command in the order in which each command is first used
+	invocations := make([]*openInvocation, 0, 5)
+	invocationsByCommand := make(map[string]*openInvocation, 5)
+
+	for _, file := range files {
+		if _, err := os.Stat(file.Path()); err != nil {
+			switch {
+			case os.IsNotExist(err):
+				warnings = append(warnings, NoSuchFileError{file.Path()})
+			case os.IsPermission(err):
+				warnings = append(warnings, PermissionDeniedError{file.Path()})
+			default:
+				warnings = append(warnings, err)
+			}
+
+			continue
+		}
+
+		command := with
+		if command == nil {
+			command = openHandlerFor(handlers, file.MimeType)
+		}
+		if command == nil {
+			// the default opener accepts only a single file
+			invocations = append(invocations, &openInvocation{defaultOpener(), []string{file.Path()}})
+			continue
+		}
+
+		key := strings.Join(command, "\x00")
+		invocation, ok := invocationsByCommand[key]
+		if !ok {
+			invocation = &openInvocation{command, nil}
+			invocationsByCommand[key] = invocation
+			invocations = append(invocations, invocation)
+		}
+
+		invocation.paths = append(invocation.paths, file.Path())
+	}
+
+	for _, invocation := range invocations {
+		if pretend {
+			fmt.Println(invocation.String())
+			continue
+		}
+
+		log.Infof(2, "running '%v'", invocation)
+
+		args := append(append([]string{}, invocation.command[1:]...), invocation.paths...)
+
+		cmd := exec.Command(invocation.command[0], args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			warnings = append(warnings, fmt.Errorf("could not run '%v': %w", invocation.command[0], err))
+		}
+	}
+
+	return warnings
+}
+
+func (invocation openInvocation) String() string {
+	words := append([]string{}, invocation.command...)
+	for _, path := range invocation.paths {
+		words = append(words, _path.Rel(path))
+	}
+
+	return strings.Join(words, " ")
+}
@@ -65,6 +65,19 @@ func (options Options) Get(name string) *Option {
 	return nil
 }
 
+// the arguments of each occurrence of the named option
+func (options Options) Arguments(name string) []string {
+	arguments := make([]string, 0)
+
+	for _, option := range options {
+		if option.LongName == name || option.ShortName == name {
+			arguments = append(arguments, option.Argument)
+		}
+	}
+
+	return arguments
+}
+
 type OptionParser struct {
 	globalOptions Options
 	commandByName map[string]*Command
@@ -116,6 +129,9 @@ func (parser *OptionParser) Parse(args ...string) (command *Command, options Opt
 						option.Argument = args[index+1]
 						index++
 					}
+				} else if len(parts) == 2 {
+					// a flag may be qualified, e.g. '--unmodified=skip-fingerprint'
+					option.Argument = parts[1]
 				}
 
 				options = append(options, *option)
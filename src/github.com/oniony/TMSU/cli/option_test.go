@@ -76,3 +76,38 @@ func TestInvalidGlobalOption(test *testing.T) {
 		test.Fatal("Invalid option not identified.")
 	}
 }
+
+func TestQualifiedFlag(test *testing.T) {
+	parser := NewOptionParser(Options{}, []*Command{{Name: "a", Options: Options{Option{"--flag", "-f", "flag", false, ""}}}})
+
+	_, options, arguments, err := parser.Parse("a", "--flag=qualifier", "b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(options) != 1 {
+		test.Fatalf("Expected one option but were %v.", len(options))
+	}
+	if options[0].Argument != "qualifier" {
+		test.Fatalf("Expected option argument of 'qualifier' but was '%v'.", options[0].Argument)
+	}
+	if len(arguments) != 1 {
+		test.Fatalf("Expected one argument but were %v.", len(arguments))
+	}
+}
+
+func TestRepeatedOption(test *testing.T) {
+	parser := NewOptionParser(Options{}, []*Command{{Name: "a", Options: Options{Option{"--ignore", "-i", "ignore", true, ""}}}})
+
+	_, options, _, err := parser.Parse("a", "--ignore=*.tmp", "-i", "*.bak", "b")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	arguments := options.Arguments("--ignore")
+	if len(arguments) != 2 {
+		test.Fatalf("Expected two arguments but were %v.", len(arguments))
+	}
+	if arguments[0] != "*.tmp" || arguments[1] != "*.bak" {
+		test.Fatalf("Expected arguments of '*.tmp' and '*.bak' but were '%v'.", arguments)
+	}
+}
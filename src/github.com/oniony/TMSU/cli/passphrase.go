@@ -0,0 +1,153 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	term "golang.org/x/crypto/ssh/terminal"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// the passphrases of the encrypted databases opened so far, keyed by path, so
+// that each is only asked for once
+var passphrases = map[string]string{}
+
+// Retrieves the passphrase of the encrypted database at the path from the
+// agent command in TMSU_PASSPHRASE_COMMAND, the TMSU_PASSPHRASE environment
+// variable or, failing these, by prompting at the terminal.
+func databasePassphrase(databasePath string) (string, error) {
+	if passphrase, ok := passphrases[databasePath]; ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := readPassphrase(databasePath, "Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+
+	passphrases[databasePath] = passphrase
+
+	return passphrase, nil
+}
+
+// Retrieves the passphrase to newly encrypt the database at the path with from
+// the TMSU_NEW_PASSPHRASE environment variable or by prompting, twice, at the
+// terminal. Unless the database's passphrase is being changed the usual
+// sources of the passphrase are also consulted.
+func newDatabasePassphrase(databasePath string, changing bool) (string, error) {
+	passphrase := os.Getenv("TMSU_NEW_PASSPHRASE")
+
+	switch {
+	case passphrase != "":
+	case !changing && (os.Getenv("TMSU_PASSPHRASE_COMMAND") != "" || os.Getenv("TMSU_PASSPHRASE") != ""):
+		var err error
+		passphrase, err = readPassphrase(databasePath, "")
+		if err != nil {
+			return "", err
+		}
+	default:
+		var err error
+		passphrase, err = promptPassphrase("New passphrase: ")
+		if err != nil {
+			return "", err
+		}
+
+		confirmation, err := promptPassphrase("Confirm passphrase: ")
+		if err != nil {
+			return "", err
+		}
+
+		if confirmation != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+
+	if passphrase == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+
+	passphrases[databasePath] = passphrase
+
+	return passphrase, nil
+}
+
+// forgets a passphrase that proved to be incorrect
+func forgetPassphrase(databasePath string) {
+	delete(passphrases, databasePath)
+}
+
+func readPassphrase(databasePath, prompt string) (string, error) {
+	if command := os.Getenv("TMSU_PASSPHRASE_COMMAND"); command != "" {
+		return passphraseFromAgent(command, databasePath)
+	}
+
+	if passphrase := os.Getenv("TMSU_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	return promptPassphrase(prompt)
+}
+
+func passphraseFromAgent(command, databasePath string) (string, error) {
+	log.Infof(2, "retrieving passphrase using '%v'", command)
+
+	var shell *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		shell = exec.Command("cmd", "/c", command)
+	default:
+		shell = exec.Command("sh", "-c", command)
+	}
+
+	absDatabasePath, err := filepath.Abs(databasePath)
+	if err != nil {
+		absDatabasePath = databasePath
+	}
+
+	var stdout bytes.Buffer
+	shell.Stdout = &stdout
+	shell.Stderr = os.Stderr
+	shell.Env = append(os.Environ(), databaseEnvironmentVariable+"="+absDatabasePath)
+
+	if err := shell.Run(); err != nil {
+		return "", fmt.Errorf("could not retrieve passphrase: %w", err)
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+func promptPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("a passphrase is required but there is no terminal to prompt for it: see TMSU_PASSPHRASE_COMMAND")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("could not read passphrase: %w", err)
+	}
+
+	return string(passphrase), nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	_path "github.com/oniony/TMSU/common/path"
+	"path/filepath"
+	"strings"
+)
+
+// unexported
+
+// how the paths of files are listed, as set with --path-style
+type pathStyle int
+
+const (
+	relativePathStyle         pathStyle = iota // relative to the working directory where beneath it
+	absolutePathStyle                          // absolute
+	databaseRelativePathStyle                  // relative to the root path of the database where beneath it
+)
+
+var pathStyleNames = []string{"relative", "absolute", "db-relative"}
+
+var listedPathStyle = relativePathStyle
+
+// the root path of the database opened, to which db-relative paths are relative
+var listedPathRoot string
+
+// the path style specified with --path-style, if any, or else relative
+func parsePathStyle(options Options) (pathStyle, error) {
+	if options.Get("--path-style") == nil {
+		return relativePathStyle, nil
+	}
+
+	argument := options.Get("--path-style").Argument
+	for index, name := range pathStyleNames {
+		if argument == name {
+			return pathStyle(index), nil
+		}
+	}
+
+	return relativePathStyle, fmt.Errorf("invalid path style '%v': must be one of %v", argument, strings.Join(pathStyleNames, ", "))
+}
+
+// the path as it is to be listed, as per the --path-style option, so that every
+// subcommand lists paths alike
+func displayPath(path string) string {
+	switch listedPathStyle {
+	case absolutePathStyle:
+		if absPath, err := filepath.Abs(path); err == nil {
+			return absPath
+		}
+
+		return path
+	case databaseRelativePathStyle:
+		if listedPathRoot == "" {
+			return path
+		}
+
+		relPath, err := filepath.Rel(listedPathRoot, path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return path
+		}
+
+		return relPath
+	}
+
+	return _path.Rel(path)
+}
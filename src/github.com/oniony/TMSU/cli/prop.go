@@ -0,0 +1,234 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+)
+
+var PropCommand = Command{
+	Name:     "prop",
+	Synopsis: "View or set the properties of files",
+	Usages: []string{"tmsu prop set FILE NAME VALUE",
+		"tmsu prop get FILE NAME",
+		"tmsu prop unset FILE NAME...",
+		"tmsu prop list FILE..."},
+	Description: `Records arbitrary NAME=VALUE properties against files, such as checksums calculated by other tools, source URLs or licenses, without adding them to the tags.
+
+The 'set' action sets the property NAME of FILE to VALUE, replacing any existing value. The 'get' action shows the value of the property NAME of FILE and 'unset' removes the properties specified. The 'list' action shows all of the properties of each FILE.
+
+Properties can only be set upon files that are tagged and are removed when the file is removed from the database. They are included by the 'export' subcommand.
+
+Properties can be queried with the 'files' subcommand by prefixing the property name with 'prop:', which also matches any tag of the same name. Property values may be compared with the usual operators, the regular expression operators '~' and '!~' or with 'like', which matches SQL LIKE patterns where '%' matches any text and '_' any single character. Quote a pattern containing spaces with single quotes.`,
+	Examples: []string{"$ tmsu prop set photo.jpg source-url https://www.flickr.com/photos/example/123",
+		`$ tmsu prop get photo.jpg source-url
+https://www.flickr.com/photos/example/123`,
+		`$ tmsu prop list photo.jpg
+license=CC-BY-4.0
+source-url=https://www.flickr.com/photos/example/123`,
+		"$ tmsu prop unset photo.jpg license",
+		`$ tmsu files "prop:source-url like '%flickr%'"`,
+		`$ tmsu files "photo and not prop:license"`},
+	Options: Options{},
+	Exec:    propExec,
+}
+
+// unexported
+
+func propExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) < 1 {
+		return errTooFewArguments, nil
+	}
+
+	action := args[0]
+	args = args[1:]
+
+	switch action {
+	case "set":
+		if len(args) < 3 {
+			return errTooFewArguments, nil
+		}
+		if len(args) > 3 {
+			return errTooManyArguments, nil
+		}
+	case "get":
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+		if len(args) > 2 {
+			return errTooManyArguments, nil
+		}
+	case "unset":
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+	case "list":
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+	default:
+		return fmt.Errorf("invalid action '%v': expected get, list, set or unset", action), nil
+	}
+
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	switch action {
+	case "set":
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+
+		return setProperty(store, tx, args[0], args[1], args[2]), nil
+	case "get":
+		return showProperty(store, tx, args[0], args[1])
+	case "unset":
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+
+		return unsetProperties(store, tx, args[0], args[1:])
+	default:
+		return listProperties(store, tx, args, asJson)
+	}
+}
+
+func setProperty(store *storage.Storage, tx *storage.Tx, path, name, value string) error {
+	if err := entities.ValidatePropertyName(name); err != nil {
+		return err
+	}
+
+	file, err := taggedFile(store, tx, path)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(2, "%v: setting property '%v'", path, name)
+
+	if _, err := store.UpdateProperty(tx, file.Id, name, value); err != nil {
+		return fmt.Errorf("%v: could not update property '%v': %w", path, name, err)
+	}
+
+	return nil
+}
+
+func showProperty(store *storage.Storage, tx *storage.Tx, path, name string) (error, warnings) {
+	file, err := taggedFile(store, tx, path)
+	if err != nil {
+		return err, nil
+	}
+
+	property, err := store.Property(tx, file.Id, name)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve property '%v': %w", path, name, err), nil
+	}
+	if property == nil {
+		return nil, warnings{fmt.Errorf("%v: no property '%v'", path, name)}
+	}
+
+	fmt.Println(property.Value)
+
+	return nil, nil
+}
+
+func unsetProperties(store *storage.Storage, tx *storage.Tx, path string, names []string) (error, warnings) {
+	file, err := taggedFile(store, tx, path)
+	if err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, name := range names {
+		property, err := store.Property(tx, file.Id, name)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve property '%v': %w", path, name, err), warnings
+		}
+		if property == nil {
+			warnings = append(warnings, fmt.Errorf("%v: no property '%v'", path, name))
+			continue
+		}
+
+		log.Infof(2, "%v: removing property '%v'", path, name)
+
+		if err := store.DeleteProperty(tx, file.Id, name); err != nil {
+			return fmt.Errorf("%v: could not remove property '%v': %w", path, name, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+func listProperties(store *storage.Storage, tx *storage.Tx, paths []string, asJson bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+	fileProperties := make([]jsonFileProperties, 0, len(paths))
+
+	for _, path := range paths {
+		file, err := taggedFile(store, tx, path)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+
+		properties, err := store.PropertiesByFileId(tx, file.Id)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve properties: %w", path, err), warnings
+		}
+
+		if asJson {
+			values := make(map[string]string, len(properties))
+			for _, property := range properties {
+				values[property.Name] = property.Value
+			}
+
+			fileProperties = append(fileProperties, jsonFileProperties{path, values})
+			continue
+		}
+
+		for _, property := range properties {
+			if len(paths) > 1 {
+				fmt.Printf("%v: ", path)
+			}
+
+			fmt.Printf("%v=%v\n", property.Name, property.Value)
+		}
+	}
+
+	if asJson {
+		if err := printJson(fileProperties); err != nil {
+			return err, warnings
+		}
+	}
+
+	return nil, warnings
+}
@@ -0,0 +1,216 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strconv"
+)
+
+var RateCommand = Command{
+	Name:     "rate",
+	Synopsis: "Rate files",
+	Usages: []string{"tmsu rate [OPTION]... FILE... RATING",
+		"tmsu rate [OPTION]... --clear FILE..."},
+	Description: `Rates each FILE with a RATING from 1 to ` + strconv.Itoa(entities.MaxRating) + `, replacing any rating the file already has.
+
+Ratings are applied as values of the '` + entities.RatingTagName + `' tag, which is created as an int tag (see the 'tag-def' subcommand) so that files may be queried by their rating, e.g. 'tmsu files "` + entities.RatingTagName + ` >= 3"'.
+
+Files rated ` + strconv.Itoa(entities.FavoriteRating) + ` or more are favorites and appear within the 'favorites' directory of the virtual filesystem.
+
+With --clear the ratings of the files are removed.`,
+	Examples: []string{"$ tmsu rate sunset.jpg 5",
+		"$ tmsu rate *.mp3 3",
+		`$ tmsu files "rating >= 4"`,
+		"$ tmsu rate --clear sunset.jpg"},
+	Options: Options{{"--clear", "-c", "remove the ratings of the files", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (rate the link itself)", false, ""}},
+	Exec: rateExec,
+}
+
+// unexported
+
+func rateExec(options Options, args []string, databasePath string) (error, warnings) {
+	clear := options.HasOption("--clear")
+
+	var rating uint
+	paths := args
+	if clear {
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+	} else {
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+
+		var err error
+		rating, err = entities.ParseRating(args[len(args)-1])
+		if err != nil {
+			return err, nil
+		}
+
+		paths = args[:len(args)-1]
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	if clear {
+		return clearRatings(store, tx, paths, followSymlinks)
+	}
+
+	return ratePaths(store, tx, paths, rating, followSymlinks)
+}
+
+func ratePaths(store *storage.Storage, tx *storage.Tx, paths []string, rating uint, followSymlinks bool) (error, warnings) {
+	tag, err := ratingTag(store, tx)
+	if err != nil {
+		return err, nil
+	}
+
+	valueName := strconv.FormatUint(uint64(rating), 10)
+
+	value, err := store.ValueByName(tx, valueName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value '%v': %w", valueName, err), nil
+	}
+	if value == nil {
+		if value, err = store.AddValue(tx, valueName); err != nil {
+			return fmt.Errorf("could not create value '%v': %w", valueName, err), nil
+		}
+	}
+
+	tagArgs := []string{formatTagValueName(tag.Name, valueName, false, false, false)}
+
+	err, warnings := tagPaths(store, tx, tagArgs, paths, false, false, false, false, false, followSymlinks, false, 1)
+	if err != nil {
+		return err, warnings
+	}
+
+	// the previous ratings are removed once the new rating is applied so that
+	// files are not removed from the database for want of tags in between
+	for _, path := range paths {
+		// problems with the paths have already been reported whilst tagging
+		file, _, err := fileForTagsPath(store, tx, path, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if file == nil {
+			continue
+		}
+
+		if err := deleteRatings(store, tx, file.Id, tag.Id, value.Id); err != nil {
+			return fmt.Errorf("%v: could not remove rating: %w", path, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+func clearRatings(store *storage.Storage, tx *storage.Tx, paths []string, followSymlinks bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	tag, err := store.TagByName(tx, entities.RatingTagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %w", entities.RatingTagName, err), warnings
+	}
+
+	for _, path := range paths {
+		file, warning, err := fileForTagsPath(store, tx, path, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if warning != nil {
+			warnings = append(warnings, warning)
+			continue
+		}
+		if file == nil || tag == nil {
+			continue
+		}
+
+		if err := deleteRatings(store, tx, file.Id, tag.Id, 0); err != nil {
+			return fmt.Errorf("%v: could not remove rating: %w", path, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
+
+// retrieves the rating tag, creating it as an int tag if it does not yet exist
+func ratingTag(store *storage.Storage, tx *storage.Tx) (*entities.Tag, error) {
+	tag, err := store.TagByName(tx, entities.RatingTagName)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag '%v': %w", entities.RatingTagName, err)
+	}
+	if tag != nil {
+		return tag, nil
+	}
+
+	tag, err = createTag(store, tx, entities.RatingTagName)
+	if err != nil {
+		return nil, fmt.Errorf("could not create tag '%v': %w", entities.RatingTagName, err)
+	}
+
+	log.Infof(2, "setting type of tag '%v' to '%v'", tag.Name, entities.IntegerValues)
+
+	if err := store.SetTagType(tx, *tag, entities.IntegerValues); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// removes the file's ratings other than that with the specified value
+func deleteRatings(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, tagId entities.TagId, keepValueId entities.ValueId) error {
+	fileTags, err := store.FileTagsByFileId(tx, fileId, true)
+	if err != nil {
+		return err
+	}
+
+	for _, fileTag := range fileTags {
+		if fileTag.TagId != tagId || (keepValueId != 0 && fileTag.ValueId == keepValueId) {
+			continue
+		}
+
+		if err := store.DeleteFileTag(tx, fileId, fileTag.TagId, fileTag.ValueId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+)
+
+var RefingerprintCommand = Command{
+	Name:     "refingerprint",
+	Synopsis: "Recalculate file fingerprints",
+	Usages:   []string{"tmsu refingerprint [OPTION]... [PATH]..."},
+	Description: `Recalculates the fingerprints of the files in the database using the current fingerprint algorithm settings.
+
+This is necessary after changing the 'fileFingerprintAlgorithm', 'directoryFingerprintAlgorithm' or 'symlinkFingerprintAlgorithm' settings so that duplicates and moved files continue to be identified.
+
+Where PATHs are specified only the files at or under these paths are recalculated. Files that are missing are reported and left unchanged: use the 'repair' subcommand to deal with these.`,
+	Examples: []string{"$ tmsu config --fingerprint-algorithm=BLAKE2b",
+		"$ tmsu refingerprint",
+		"$ tmsu refingerprint /home/bob/videos"},
+	Options: Options{{"--pretend", "-P", "do not make any changes", false, ""}},
+	Exec:    refingerprintExec,
+}
+
+// unexported
+
+func refingerprintExec(options Options, args []string, databasePath string) (error, warnings) {
+	pretend := options.HasOption("--pretend")
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if !pretend {
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	files, err := refingerprintFiles(store, tx, args)
+	if err != nil {
+		return err, nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %w", err), nil
+	}
+
+	warnings := make(warnings, 0, 10)
+	for _, file := range files {
+		if err := refingerprintFile(store, tx, file, pretend, settings); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return nil, warnings
+}
+
+func refingerprintFiles(store *storage.Storage, tx *storage.Tx, paths []string) (entities.Files, error) {
+	if len(paths) == 0 {
+		files, err := store.Files(tx, "name")
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve files: %w", err)
+		}
+
+		return files, nil
+	}
+
+	files := make(entities.Files, 0, 100)
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+
+		dirFiles, err := store.FilesByDirectory(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve files for directory: %w", path, err)
+		}
+
+		files = append(files, dirFiles...)
+	}
+
+	return files, nil
+}
+
+func refingerprintFile(store *storage.Storage, tx *storage.Tx, file *entities.File, pretend bool, settings entities.Settings) error {
+	path := file.Path()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%v: missing", path)
+		}
+
+		return fmt.Errorf("%v: could not stat file: %w", path, err)
+	}
+
+	log.Infof(2, "%v: recalculating fingerprint", path)
+
+	fp, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+	if err != nil {
+		return fmt.Errorf("%v: could not create fingerprint: %w", path, err)
+	}
+
+	if fp == file.Fingerprint {
+		return nil
+	}
+
+	if !pretend {
+		if _, err := store.UpdateFile(tx, file.Id, path, fp, stat.ModTime(), stat.Size(), stat.IsDir(), file.MimeType); err != nil {
+			return fmt.Errorf("%v: could not update file in database: %w", path, err)
+		}
+	}
+
+	fmt.Printf("%v: recalculated fingerprint\n", path)
+
+	return nil
+}
@@ -25,25 +25,40 @@ var RenameCommand = Command{
 	Name:     "rename",
 	Aliases:  []string{"mv"},
 	Synopsis: "Rename a tag or value",
-	Usages:   []string{"tmsu rename [OPTION]... OLD NEW"},
+	Usages: []string{"tmsu rename [OPTION]... OLD NEW",
+		"tmsu rename --value TAG OLD NEW"},
 	Description: `Renames a tag or value from OLD to NEW.
 
-Attempting to rename a tag or value with a name that already exists will result in an error. To merge tags or values use the 'merge' subcommand instead.`,
+Attempting to rename a tag or value with a name that already exists will result in an error. To merge tags or values use the 'merge' subcommand instead.
+
+When --namespace is specified the tags of namespace OLD are moved to namespace NEW, e.g. 'person:alice' becomes 'people:alice'. No tag is moved if any of them would collide with a tag already within namespace NEW.
+
+When --value is specified with a TAG the value OLD is renamed NEW for that tag alone, e.g. to correct 'year=20223' without affecting other tags with the value '20223'. It is an error for TAG to already have the value NEW on any file: use 'merge --value --tag' instead.`,
 	Examples: []string{"$ tmsu rename montain mountain",
-		"$ tmsu rename --value MMXVII 2017"},
-	Options: Options{{"--value", "", "rename a value", false, ""}},
-	Exec:    renameExec,
+		"$ tmsu rename person:alic person:alice",
+		"$ tmsu rename --value MMXVII 2017",
+		"$ tmsu rename --value year 20223 2023",
+		"$ tmsu rename --namespace person people"},
+	Options: Options{{"--value", "", "rename a value", false, ""},
+		{"--namespace", "", "rename a tag namespace", false, ""}},
+	Exec: renameExec,
 }
 
 // unexported
 
 func renameExec(options Options, args []string, databasePath string) (error, warnings) {
 	if len(args) < 2 {
-		return fmt.Errorf("too few arguments"), nil
+		return errTooFewArguments, nil
+	}
+
+	tagName := ""
+	if len(args) == 3 && options.HasOption("--value") {
+		tagName = parseTagOrValueName(args[0])
+		args = args[1:]
 	}
 
 	if len(args) > 2 {
-		return fmt.Errorf("too many arguments"), nil
+		return errTooManyArguments, nil
 	}
 
 	currentName := parseTagOrValueName(args[0])
@@ -61,8 +76,17 @@ func renameExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
-	if options.HasOption("--value") {
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	switch {
+	case options.HasOption("--value") && tagName != "":
+		return renameTagValue(store, tx, tagName, currentName, newName), nil
+	case options.HasOption("--value"):
 		return renameValue(store, tx, currentName, newName), nil
+	case options.HasOption("--namespace"):
+		return renameNamespace(store, tx, currentName, newName), nil
 	}
 
 	return renameTag(store, tx, currentName, newName), nil
@@ -71,7 +95,7 @@ func renameExec(options Options, args []string, databasePath string) (error, war
 func renameTag(store *storage.Storage, tx *storage.Tx, currentName, newName string) error {
 	sourceTag, err := store.TagByName(tx, currentName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", currentName, err)
+		return fmt.Errorf("could not retrieve tag '%v': %w", currentName, err)
 	}
 	if sourceTag == nil {
 		return fmt.Errorf("no such tag '%v'", currentName)
@@ -79,7 +103,7 @@ func renameTag(store *storage.Storage, tx *storage.Tx, currentName, newName stri
 
 	destTag, err := store.TagByName(tx, newName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", newName, err)
+		return fmt.Errorf("could not retrieve tag '%v': %w", newName, err)
 	}
 	if destTag != nil {
 		return fmt.Errorf("tag '%v' already exists", newName)
@@ -89,7 +113,25 @@ func renameTag(store *storage.Storage, tx *storage.Tx, currentName, newName stri
 
 	_, err = store.RenameTag(tx, sourceTag.Id, newName)
 	if err != nil {
-		return fmt.Errorf("could not rename tag '%v' to '%v': %v", currentName, newName, err)
+		return fmt.Errorf("could not rename tag '%v' to '%v': %w", currentName, newName, err)
+	}
+
+	return nil
+}
+
+func renameNamespace(store *storage.Storage, tx *storage.Tx, currentName, newName string) error {
+	tags, err := store.TagsByNamespace(tx, currentName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags within namespace '%v': %w", currentName, err)
+	}
+	if len(tags) == 0 {
+		return NoSuchNamespaceError{currentName}
+	}
+
+	log.Infof(2, "moving the tags of namespace '%v' to '%v'.", currentName, newName)
+
+	if _, err := store.RenameTagNamespace(tx, currentName, newName); err != nil {
+		return fmt.Errorf("could not rename namespace '%v' to '%v': %w", currentName, newName, err)
 	}
 
 	return nil
@@ -98,7 +140,7 @@ func renameTag(store *storage.Storage, tx *storage.Tx, currentName, newName stri
 func renameValue(store *storage.Storage, tx *storage.Tx, currentName, newName string) error {
 	sourceValue, err := store.ValueByName(tx, currentName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve value '%v': %v", currentName, err)
+		return fmt.Errorf("could not retrieve value '%v': %w", currentName, err)
 	}
 	if sourceValue == nil {
 		return fmt.Errorf("no such value '%v'", currentName)
@@ -106,7 +148,7 @@ func renameValue(store *storage.Storage, tx *storage.Tx, currentName, newName st
 
 	destValue, err := store.ValueByName(tx, newName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve value '%v': %v", newName, err)
+		return fmt.Errorf("could not retrieve value '%v': %w", newName, err)
 	}
 	if destValue != nil {
 		return fmt.Errorf("value '%v' already exists", newName)
@@ -116,7 +158,50 @@ func renameValue(store *storage.Storage, tx *storage.Tx, currentName, newName st
 
 	_, err = store.RenameValue(tx, sourceValue.Id, newName)
 	if err != nil {
-		return fmt.Errorf("could not rename value '%v' to '%v': %v", currentName, newName, err)
+		return fmt.Errorf("could not rename value '%v' to '%v': %w", currentName, newName, err)
+	}
+
+	return nil
+}
+
+func renameTagValue(store *storage.Storage, tx *storage.Tx, tagName, currentName, newName string) error {
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err)
+	}
+	if tag == nil {
+		return fmt.Errorf("no such tag '%v'", tagName)
+	}
+
+	values, err := store.ValuesByTag(tx, tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve values for tag '%v': %w", tagName, err)
+	}
+
+	sourceValue := values.Find(currentName)
+	if sourceValue == nil {
+		return fmt.Errorf("tag '%v' has no value '%v'", tagName, currentName)
+	}
+
+	if values.Find(newName) != nil {
+		return fmt.Errorf("tag '%v' already has value '%v'", tagName, newName)
+	}
+
+	destValue, err := store.ValueByName(tx, newName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve value '%v': %w", newName, err)
+	}
+	if destValue == nil {
+		destValue, err = store.AddValue(tx, newName)
+		if err != nil {
+			return fmt.Errorf("could not create value '%v': %w", newName, err)
+		}
+	}
+
+	log.Infof(2, "renaming value '%v' of tag '%v' to '%v'.", currentName, tagName, newName)
+
+	if err := store.ReplaceFileTagValue(tx, tag.Id, sourceValue.Id, destValue.Id); err != nil {
+		return fmt.Errorf("could not rename value '%v' of tag '%v' to '%v': %w", currentName, tagName, newName, err)
 	}
 
 	return nil
@@ -16,15 +16,16 @@
 package cli
 
 import (
-	"errors"
+	"bufio"
 	"fmt"
 	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/common/log"
-	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/progress"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -36,23 +37,38 @@ var RepairCommand = Command{
 		"tmsu repair [OPTION]... repair --manual OLD NEW"},
 	Description: `Fixes broken paths and stale fingerprints in the database caused by file modifications and moves.
 
-Modified files are identified by a change to the file's modification time or file size. These files are repaired by updating the details in the database.
+Modified files are identified by a change to the file's modification time or file size. These files are repaired by updating the details in the database. Files whose modification time and size are unchanged are trusted to be unmodified and are not fingerprinted, so routine repairs of large collections are quick.
+
+The --unmodified option recalculates the fingerprints and MIME types of these unmodified files too, or with --unmodified=skip-fingerprint only their MIME types. The --paranoid option instead fingerprints every unmodified file and repairs any whose contents have changed despite an unchanged modification time and size.
 
 An attempt is made to find missing files under PATHs specified. If a file with the same fingerprint is found then the database is updated with the new file's details. If no PATHs are specified, or no match can be found, then the file is instead reported as missing.
 
+Only files of the same size are considered. Of those with the same fingerprint, the ones that also have the missing file's modification time are preferred, as moving a file retains this whereas copying it usually does not. When the 'trackInodes' setting is enabled, a file with the same modification time and the device and inode number recorded for the missing file is taken to be the moved file without fingerprinting any of them. (See the 'config' subcommand.)
+
+Where a missing file is found at more than one location, the locations beneath PREFIX are preferred when --prefer-path is specified. If the choice is still ambiguous then --interactive prompts for the location to use, otherwise the file is reported as ambiguous and left unchanged.
+
 Files that have been both moved and modified cannot be repaired and must be manually relocated.
 
-When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. Any affected files' fingerprints are updated providing the file exists at the new location. No further repairs are attempted in this mode.`,
+When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. Any affected files' fingerprints are updated providing the file exists at the new location. No further repairs are attempted in this mode.
+
+Files moved with the 'move' subcommand have their paths updated as they are moved and so do not need repairing.
+
+The 'pre-repair' and 'post-repair' hooks, if present, are run before and after the repair, the latter being passed the files updated or removed. See the 'tag' subcommand for more information.`,
 	Examples: []string{"$ tmsu repair",
 		"$ tmsu repair /new/path  # look for missing files here",
 		"$ tmsu repair --path=/home/sally  # repair subset of database",
+		"$ tmsu repair --prefer-path=/mnt/photos /mnt  # prefer new locations under /mnt/photos",
 		"$ tmsu repair --manual /home/bob /home/fred  # manually repair paths"},
 	Options: Options{{"--path", "-p", "limit repair to files in database under path", true, ""},
 		{"--pretend", "-P", "do not make any changes", false, ""},
 		{"--remove", "-R", "remove missing files from the database", false, ""},
 		{"--manual", "-m", "manually relocate files", false, ""},
-		{"--unmodified", "-u", "recalculate fingerprints for unmodified files", false, ""},
-		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""}},
+		{"--prefer-path", "", "prefer new locations under PREFIX when a file is found at several", true, ""},
+		{"--interactive", "-i", "prompt for the new location when a file is found at several", false, ""},
+		{"--unmodified", "-u", "recalculate fingerprints and MIME types for unmodified files (=skip-fingerprint for only MIME types)", false, ""},
+		{"--paranoid", "", "fingerprint unmodified files to detect changed contents", false, ""},
+		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""},
+		{"--jobs", "-j", "fingerprint up to N files concurrently", true, ""}},
 	Exec: repairExec,
 }
 
@@ -67,6 +83,12 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer store.Close()
 
+	if !pretend {
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
@@ -75,7 +97,7 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 
 	if options.HasOption("--manual") {
 		if len(args) < 2 {
-			return errors.New("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		fromPath := args[0]
@@ -88,14 +110,40 @@ func repairExec(options Options, args []string, databasePath string) (error, war
 		searchPaths := args
 		removeMissing := options.HasOption("--remove")
 		recalcUnmodified := options.HasOption("--unmodified")
+		paranoid := options.HasOption("--paranoid")
+
+		skipFingerprint := false
+		if recalcUnmodified {
+			switch argument := options.Get("--unmodified").Argument; argument {
+			case "":
+			case "skip-fingerprint":
+				skipFingerprint = true
+			default:
+				return fmt.Errorf("invalid argument '%v' for '--unmodified'", argument), nil
+			}
+		}
 		rationalize := options.HasOption("--rationalize")
+		interactive := options.HasOption("--interactive")
+
+		preferPath := ""
+		if options.HasOption("--prefer-path") {
+			preferPath, err = filepath.Abs(options.Get("--prefer-path").Argument)
+			if err != nil {
+				return fmt.Errorf("%v: could not determine absolute path", err), nil
+			}
+		}
 
 		limitPath := ""
 		if options.HasOption("--path") {
 			limitPath = options.Get("--path").Argument
 		}
 
-		if err := fullRepair(store, tx, searchPaths, limitPath, removeMissing, recalcUnmodified, rationalize, pretend); err != nil {
+		jobs, err := fingerprintJobs(options)
+		if err != nil {
+			return err, nil
+		}
+
+		if err := fullRepair(store, tx, searchPaths, limitPath, preferPath, removeMissing, recalcUnmodified, skipFingerprint, paranoid, rationalize, interactive, pretend, jobs); err != nil {
 			return err, nil
 		}
 	}
@@ -118,7 +166,7 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 
 	dbFile, err := store.FileByPath(tx, absFromPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", fromPath, err)
+		return fmt.Errorf("%v: could not retrieve file: %w", fromPath, err)
 	}
 
 	if dbFile != nil {
@@ -133,13 +181,13 @@ func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath strin
 
 	dbFiles, err := store.FilesByDirectory(tx, absFromPath)
 	if err != nil {
-		return fmt.Errorf("could not retrieve files from storage: %v", err)
+		return fmt.Errorf("could not retrieve files from storage: %w", err)
 	}
 
 	for _, dbFile = range dbFiles {
-		relFileFromPath := _path.Rel(dbFile.Path())
+		relFileFromPath := displayPath(dbFile.Path())
 		absFileToPath := strings.Replace(dbFile.Path(), absFromPath, absToPath, 1)
-		relFileToPath := _path.Rel(absFileToPath)
+		relFileToPath := displayPath(absFileToPath)
 
 		log.Infof(2, "%v: updating to %v", relFileFromPath, relFileToPath)
 
@@ -180,13 +228,13 @@ func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.Fil
 		size := stat.Size()
 		isDir := stat.IsDir()
 
-		_, err = store.UpdateFile(tx, file.Id, toPath, fingerprint, modTime, size, isDir)
+		_, err = store.UpdateFile(tx, file.Id, toPath, fingerprint, modTime, size, isDir, detectMimeType(toPath))
 
 		return err
 	}
 }
 
-func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, limitPath string, removeMissing, recalcUnmodified, rationalize, pretend bool) error {
+func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, limitPath, preferPath string, removeMissing, recalcUnmodified, skipFingerprint, paranoid, rationalize, interactive, pretend bool, jobs int) error {
 	absLimitPath := ""
 	if limitPath != "" {
 		var err error
@@ -205,12 +253,12 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 
 	dbFiles, err := store.FilesByDirectory(tx, absLimitPath)
 	if err != nil {
-		return fmt.Errorf("could not retrieve files from storage: %v", err)
+		return fmt.Errorf("could not retrieve files from storage: %w", err)
 	}
 
 	dbFile, err := store.FileByPath(tx, absLimitPath)
 	if err != nil {
-		return fmt.Errorf("could not retrieve file from storage: %v", err)
+		return fmt.Errorf("could not retrieve file from storage: %w", err)
 	}
 
 	if dbFile != nil {
@@ -221,17 +269,35 @@ func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, li
 
 	unmodfied, modified, missing := determineStatuses(dbFiles)
 
-	if recalcUnmodified {
-		if err = repairUnmodified(store, tx, unmodfied, pretend, settings); err != nil {
+	total := len(modified)
+	if recalcUnmodified || paranoid {
+		total += len(unmodfied)
+	}
+	if len(searchPaths) > 0 {
+		total += len(missing)
+	}
+
+	bar := progress.Start("repairing", uint(total))
+	defer bar.Finish()
+
+	fingerprints := newFingerprintPool(settings, jobs)
+
+	switch {
+	case recalcUnmodified:
+		if err = repairUnmodified(store, tx, unmodfied, skipFingerprint, pretend, fingerprints, bar); err != nil {
+			return err
+		}
+	case paranoid:
+		if err = verifyUnmodified(store, tx, unmodfied, pretend, fingerprints, bar); err != nil {
 			return err
 		}
 	}
 
-	if err = repairModified(store, tx, modified, pretend, settings); err != nil {
+	if err = repairModified(store, tx, modified, pretend, fingerprints, bar); err != nil {
 		return err
 	}
 
-	if err = repairMoved(store, tx, missing, searchPaths, pretend, settings); err != nil {
+	if err = repairMoved(store, tx, missing, searchPaths, preferPath, interactive, pretend, fingerprints, bar); err != nil {
 		return err
 	}
 
@@ -269,7 +335,7 @@ func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.
 	for _, file := range files {
 		fileTags, err := store.FileTagsByFileId(tx, file.Id, false)
 		if err != nil {
-			return fmt.Errorf("could not determine tags for file '%v': %v", file.Path(), err)
+			return fmt.Errorf("could not determine tags for file '%v': %w", file.Path(), err)
 		}
 
 		for _, fileTag := range fileTags {
@@ -321,63 +387,121 @@ func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing en
 	return
 }
 
-func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, settings entities.Settings) error {
+func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, skipFingerprint, pretend bool, fingerprints *fingerprint.Pool, bar *progress.Bar) error {
+	if skipFingerprint {
+		return repairUnmodifiedMimeTypes(store, tx, unmodified, pretend, bar)
+	}
+
 	log.Infof(2, "recalculating fingerprints for unmodified files")
 
-	for _, dbFile := range unmodified {
+	return fingerprints.CreateEach(unmodified.Paths(), func(index int, fingerprint fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		dbFile := unmodified[index]
+		if err != nil {
+			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
+			return nil
+		}
+
 		stat, err := os.Stat(dbFile.Path())
 		if err != nil {
 			return err
 		}
 
-		fingerprint, err := fingerprint.Create(dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
-		if err != nil {
-			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
+		if !pretend {
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir(), detectMimeType(dbFile.Path()))
+			if err != nil {
+				return fmt.Errorf("%v: could not update file in database: %w", dbFile.Path(), err)
+			}
+		}
+
+		progress.Printf("%v: recalculated fingerprint\n", dbFile.Path())
+
+		return nil
+	})
+}
+
+func repairUnmodifiedMimeTypes(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, bar *progress.Bar) error {
+	log.Infof(2, "recalculating MIME types for unmodified files")
+
+	for _, dbFile := range unmodified {
+		bar.Add(1)
+
+		mimeType := detectMimeType(dbFile.Path())
+		if mimeType == dbFile.MimeType {
 			continue
 		}
 
 		if !pretend {
-			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), dbFile.Fingerprint, dbFile.ModTime, dbFile.Size, dbFile.IsDir, mimeType)
 			if err != nil {
-				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
+				return fmt.Errorf("%v: could not update file in database: %w", dbFile.Path(), err)
 			}
 		}
 
-		fmt.Printf("%v: recalculated fingerprint\n", dbFile.Path())
+		progress.Printf("%v: recalculated MIME type\n", dbFile.Path())
 	}
 
 	return nil
 }
 
-func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "repairing modified files")
+// fingerprints the unmodified files, repairing those that have changed regardless
+func verifyUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, fingerprints *fingerprint.Pool, bar *progress.Bar) error {
+	log.Infof(2, "verifying fingerprints of unmodified files")
 
-	for _, dbFile := range modified {
-		stat, err := os.Stat(dbFile.Path())
+	changed := make(entities.Files, 0, 10)
+
+	fingerprints.CreateEach(unmodified.Paths(), func(index int, fingerprint fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		dbFile := unmodified[index]
 		if err != nil {
-			return err
+			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
+			return nil
+		}
+
+		if fingerprint != dbFile.Fingerprint {
+			log.Infof(2, "%v: contents changed", dbFile.Path())
+			changed = append(changed, dbFile)
 		}
 
-		fingerprint, err := fingerprint.Create(dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		return nil
+	})
+
+	return repairModified(store, tx, changed, pretend, fingerprints, nil)
+}
+
+func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, pretend bool, fingerprints *fingerprint.Pool, bar *progress.Bar) error {
+	log.Infof(2, "repairing modified files")
+
+	return fingerprints.CreateEach(modified.Paths(), func(index int, fingerprint fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		dbFile := modified[index]
 		if err != nil {
 			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
-			continue
+			return nil
+		}
+
+		stat, err := os.Stat(dbFile.Path())
+		if err != nil {
+			return err
 		}
 
 		if !pretend {
-			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir(), detectMimeType(dbFile.Path()))
 			if err != nil {
-				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
+				return fmt.Errorf("%v: could not update file in database: %w", dbFile.Path(), err)
 			}
 		}
 
-		fmt.Printf("%v: updated fingerprint\n", dbFile.Path())
-	}
+		progress.Printf("%v: updated fingerprint\n", dbFile.Path())
 
-	return nil
+		return nil
+	})
 }
 
-func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pretend bool, settings entities.Settings) error {
+func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, preferPath string, interactive, pretend bool, fingerprints *fingerprint.Pool, bar *progress.Bar) error {
 	log.Infof(2, "repairing moved files")
 
 	if len(missing) == 0 || len(searchPaths) == 0 {
@@ -390,50 +514,196 @@ func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files,
 		return err
 	}
 
+	var reader *bufio.Reader
+	if interactive {
+		reader = bufio.NewReader(os.Stdin)
+	}
+
+	claimed := make(map[string]bool)
+
 	for index, dbFile := range missing {
+		bar.Add(1)
+
 		log.Infof(2, "%v: searching for new location", dbFile.Path())
 
 		pathsOfSize := pathsBySize[dbFile.Size]
 		log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
 
-		for _, candidatePath := range pathsOfSize {
-			candidateFile, err := store.FileByPath(tx, candidatePath)
+		candidatePaths, err := findMovedFile(store, tx, dbFile, pathsOfSize, claimed, fingerprints)
+		if err != nil {
+			return err
+		}
+
+		if len(candidatePaths) > 1 && preferPath != "" {
+			candidatePaths = preferredPaths(candidatePaths, preferPath)
+		}
+
+		var newPath string
+		switch {
+		case len(candidatePaths) == 0:
+			continue
+		case len(candidatePaths) == 1:
+			newPath = candidatePaths[0]
+		case interactive:
+			newPath, err = promptForPath(reader, dbFile.Path(), candidatePaths)
 			if err != nil {
 				return err
 			}
-			if candidateFile != nil {
-				// file is already tagged
-				continue
-			}
+		default:
+			progress.Printf("%v: ambiguous, found at %v\n", dbFile.Path(), strings.Join(candidatePaths, ", "))
+		}
 
-			stat, err := os.Stat(candidatePath)
-			if err != nil {
-				return fmt.Errorf("%v: could not stat file: %v", candidatePath, err)
-			}
+		// an ambiguous file exists somewhere so is neither reported missing nor removed
+		missing[index] = nil
 
-			fingerprint, err := fingerprint.Create(candidatePath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+		if newPath == "" {
+			continue
+		}
+
+		stat, err := os.Stat(newPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not stat file: %w", newPath, err)
+		}
+
+		if !pretend {
+			_, err := store.UpdateFile(tx, dbFile.Id, newPath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir, detectMimeType(newPath))
 			if err != nil {
-				return fmt.Errorf("%v: could not create fingerprint: %v", candidatePath, err)
+				return fmt.Errorf("%v: could not update file in database: %w", dbFile.Path(), err)
 			}
+		}
 
-			if fingerprint == dbFile.Fingerprint {
-				if !pretend {
-					_, err := store.UpdateFile(tx, dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
-					if err != nil {
-						return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
-					}
-				}
+		progress.Printf("%v: updated path to %v\n", dbFile.Path(), newPath)
+
+		claimed[newPath] = true
+	}
+
+	return nil
+}
+
+// identifies the untagged paths amongst those specified to which the missing file
+// has moved: that with the file's recorded identity and modification time if
+// there is one, otherwise those with the file's fingerprint, narrowed to those
+// that also have its modification time, as a move retains this whereas a copy
+// usually does not
+func findMovedFile(store *storage.Storage, tx *storage.Tx, dbFile *entities.File, paths []string, claimed map[string]bool, fingerprints *fingerprint.Pool) ([]string, error) {
+	identity, err := store.FileIdentity(tx, dbFile.Id)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file identity: %w", dbFile.Path(), err)
+	}
+
+	sameModTimePaths := make([]string, 0, len(paths))
+	otherPaths := make([]string, 0, len(paths))
+
+	for _, candidatePath := range paths {
+		if claimed[candidatePath] {
+			continue
+		}
 
-				fmt.Printf("%v: updated path to %v\n", dbFile.Path(), candidatePath)
+		candidateFile, err := store.FileByPath(tx, candidatePath)
+		if err != nil {
+			return nil, err
+		}
+		if candidateFile != nil {
+			// file is already tagged
+			continue
+		}
 
-				missing[index] = nil
+		stat, err := os.Stat(candidatePath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not stat file: %w", candidatePath, err)
+		}
 
-				break
+		if !dbFile.ModTime.Equal(stat.ModTime().UTC()) {
+			otherPaths = append(otherPaths, candidatePath)
+			continue
+		}
+
+		if identity != nil {
+			if candidateIdentity := storage.FileIdentityOf(stat); candidateIdentity != nil && candidateIdentity.SameFile(*identity) {
+				log.Infof(2, "%v: identified by inode at %v", dbFile.Path(), candidatePath)
+				return []string{candidatePath}, nil
 			}
 		}
+
+		sameModTimePaths = append(sameModTimePaths, candidatePath)
 	}
 
-	return nil
+	candidatePaths, err := pathsWithFingerprint(sameModTimePaths, dbFile.Fingerprint, fingerprints)
+	if err != nil || len(candidatePaths) > 0 {
+		return candidatePaths, err
+	}
+
+	return pathsWithFingerprint(otherPaths, dbFile.Fingerprint, fingerprints)
+}
+
+// the paths amongst those specified whose files have the specified fingerprint
+func pathsWithFingerprint(paths []string, expected fingerprint.Fingerprint, fingerprints *fingerprint.Pool) ([]string, error) {
+	matchingPaths := make([]string, 0, 1)
+
+	err := fingerprints.CreateEach(paths, func(index int, fingerprint fingerprint.Fingerprint, err error) error {
+		if err != nil {
+			return fmt.Errorf("%v: could not create fingerprint: %w", paths[index], err)
+		}
+
+		if fingerprint == expected {
+			matchingPaths = append(matchingPaths, paths[index])
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matchingPaths, nil
+}
+
+// the paths beneath preferPath, or all of the paths if none are beneath it
+func preferredPaths(paths []string, preferPath string) []string {
+	preferred := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if isWithin(path, preferPath) {
+			preferred = append(preferred, path)
+		}
+	}
+
+	if len(preferred) == 0 {
+		return paths
+	}
+
+	return preferred
+}
+
+// asks which of the candidate paths the missing file has moved to, returning an empty path to skip it
+func promptForPath(reader *bufio.Reader, path string, candidatePaths []string) (string, error) {
+	progress.Printf("%v: found at multiple locations:\n", path)
+	for index, candidatePath := range candidatePaths {
+		progress.Printf("  %v) %v\n", index+1, candidatePath)
+	}
+
+	for {
+		progress.Printf("choose location [1-%v, or blank to skip]: ", len(candidatePaths))
+
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return "", nil
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return "", nil
+		}
+
+		choice, convErr := strconv.Atoi(line)
+		if convErr == nil && choice >= 1 && choice <= len(candidatePaths) {
+			return candidatePaths[choice-1], nil
+		}
+
+		if err != nil {
+			return "", nil
+		}
+	}
 }
 
 func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.Files, pretend, force bool) error {
@@ -445,13 +715,13 @@ func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.File
 		if force {
 			if !pretend {
 				if err := store.DeleteFileTagsByFileId(tx, dbFile.Id); err != nil {
-					return fmt.Errorf("%v: could not delete file-tags: %v", dbFile.Path(), err)
+					return fmt.Errorf("%v: could not delete file-tags: %w", dbFile.Path(), err)
 				}
 			}
 
-			fmt.Printf("%v: removed\n", dbFile.Path())
+			progress.Printf("%v: removed\n", dbFile.Path())
 		} else {
-			fmt.Printf("%v: missing\n", dbFile.Path())
+			progress.Printf("%v: missing\n", dbFile.Path())
 		}
 	}
 
@@ -495,13 +765,13 @@ func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string)
 
 		dir, err := os.Open(absPath)
 		if err != nil {
-			return fmt.Errorf("%v: could not open directory: %v", path, err)
+			return fmt.Errorf("%v: could not open directory: %w", path, err)
 		}
 
 		names, err := dir.Readdirnames(0)
 		dir.Close()
 		if err != nil {
-			return fmt.Errorf("%v: could not read directory entries: %v", path, err)
+			return fmt.Errorf("%v: could not read directory entries: %w", path, err)
 		}
 
 		for _, name := range names {
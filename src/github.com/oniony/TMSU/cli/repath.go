@@ -0,0 +1,102 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+)
+
+var RepathCommand = Command{
+	Name:     "repath",
+	Synopsis: "Converts the stored file paths between relative and absolute",
+	Usages: []string{"tmsu repath [OPTION]... --make-relative",
+		"tmsu repath [OPTION]... --make-absolute"},
+	Description: `Converts the paths stored in the database for the files within it.
+
+With --make-relative the paths of the files beneath the database's root path, the directory containing its '.tmsu' directory, are stored relative to the root path, so that the database remains valid when the collection is moved, or mounted elsewhere, as a whole. This is the default.
+
+With --make-absolute every path is instead stored as an absolute path, so that the database may be moved independently of the files.
+
+Where the 'canonicalPaths' setting is enabled the paths are also resolved through any linked directories.
+
+The 'relativePaths' setting, which determines how the paths of newly tagged files are stored, is updated to match.`,
+	Examples: []string{"$ tmsu repath --make-absolute",
+		"$ tmsu repath --pretend --make-relative"},
+	Options: Options{{"--make-relative", "", "store paths beneath the root path relative to it", false, ""},
+		{"--make-absolute", "", "store every path as an absolute path", false, ""},
+		{"--pretend", "-P", "list the conversions without making them", false, ""}},
+	Exec: repathExec,
+}
+
+// unexported
+
+func repathExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	makeRelative := options.HasOption("--make-relative")
+	makeAbsolute := options.HasOption("--make-absolute")
+	pretend := options.HasOption("--pretend")
+
+	switch {
+	case makeRelative && makeAbsolute:
+		return fmt.Errorf("--make-relative and --make-absolute are mutually exclusive"), nil
+	case !makeRelative && !makeAbsolute:
+		return fmt.Errorf("one of --make-relative or --make-absolute must be specified"), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	conversions, err := store.ConvertPaths(tx, makeRelative)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not convert paths: %w", err), nil
+	}
+
+	for _, conversion := range conversions {
+		if pretend {
+			fmt.Printf("%v -> %v\n", conversion.OldPath, conversion.NewPath)
+		} else {
+			log.Infof(2, "%v: storing as '%v'", conversion.OldPath, conversion.NewPath)
+		}
+	}
+
+	if pretend {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"os"
+)
+
+var RestoreCommand = Command{
+	Name:     "restore",
+	Synopsis: "Restore the database from a backup",
+	Usages: []string{"tmsu restore [--list]",
+		"tmsu restore --restore TIMESTAMP"},
+	Description: `Lists the backups of the database or replaces the database with one of them.
+
+The database is backed up automatically, to the '` + storage.BackupDirectoryName + `' directory beside it, before subcommands that make sweeping changes and, optionally, periodically: see the 'backupRetention' and 'backupInterval' settings of the 'config' subcommand.
+
+With --list, or without options, lists the backups, oldest first, with their TIMESTAMP and size in bytes. With --restore the database is replaced by the backup with the TIMESTAMP specified. The database is itself backed up first so that the restoration may be reversed.`,
+	Examples: []string{`$ tmsu restore --list
+20261012T181502.318Z 188416
+20261014T085503.730Z 192512`,
+		"$ tmsu restore --restore 20261012T181502.318Z"},
+	Options: Options{{"--list", "-l", "list the backups", false, ""},
+		{"--restore", "-r", "restore the backup with the TIMESTAMP", true, ""}},
+	Exec: restoreExec,
+}
+
+// unexported
+
+func restoreExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	if os.Getenv("TMSU_REMOTE") != "" {
+		return errors.New("cannot restore a remote database"), nil
+	}
+	if storage.IsPostgres(databasePath) {
+		return errors.New("a PostgreSQL database is backed up with PostgreSQL's own tools"), nil
+	}
+
+	if options.HasOption("--restore") {
+		if options.HasOption("--list") {
+			return fmt.Errorf("--list cannot be combined with --restore"), nil
+		}
+
+		if err := refuseIfReadOnly(); err != nil {
+			return err, nil
+		}
+
+		return restoreBackup(databasePath, options.Get("--restore").Argument), nil
+	}
+
+	return listBackups(databasePath), nil
+}
+
+func listBackups(databasePath string) error {
+	backups, err := storage.BackupsAt(databasePath)
+	if err != nil {
+		return fmt.Errorf("could not retrieve backups: %w", err)
+	}
+
+	for _, backup := range backups {
+		fmt.Printf("%v %v\n", backup.Timestamp, backup.Size)
+	}
+
+	return nil
+}
+
+func restoreBackup(databasePath, timestamp string) error {
+	backups, err := storage.BackupsAt(databasePath)
+	if err != nil {
+		return fmt.Errorf("could not retrieve backups: %w", err)
+	}
+
+	found := false
+	for _, backup := range backups {
+		if backup.Timestamp == timestamp {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no backup '%v': use 'tmsu restore --list' to list the backups", timestamp)
+	}
+
+	// the database may be restored though it has been removed
+	if _, err := os.Stat(databasePath); err == nil {
+		backup, err := storage.BackupAt(databasePath, 0)
+		if err != nil {
+			return fmt.Errorf("could not back up database: %w", err)
+		}
+
+		if backup.Timestamp == timestamp {
+			return fmt.Errorf("the backup '%v' was only just taken: try again", timestamp)
+		}
+
+		log.Infof(2, "backed up database to '%v'", backup.Path)
+	}
+
+	if err := storage.RestoreAt(databasePath, timestamp); err != nil {
+		return fmt.Errorf("could not restore database: %w", err)
+	}
+
+	return nil
+}
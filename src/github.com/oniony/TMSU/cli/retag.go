@@ -0,0 +1,318 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var RetagCommand = Command{
+	Name:     "retag",
+	Synopsis: "Rename, merge, split and drop tags from a mapping file",
+	Usages:   []string{"tmsu retag [OPTION]... --map FILE"},
+	Description: `Applies the tag transformations listed in the mapping FILE, or standard input if FILE is '-', across the whole database.
+
+Each line of the mapping holds tab separated tag names, the first being the tag to transform:
+
+  OLD           drops tag OLD, removing it from every file
+  OLD NEW       renames tag OLD to NEW, or merges it into NEW if NEW already exists
+  OLD NEW...    splits tag OLD into each NEW, with the value OLD had upon each file
+
+A split that lists OLD amongst the new tags keeps OLD whilst applying the others alongside it. Blank lines and lines beginning with '#' are ignored.
+
+The lines are applied in turn, so a later line may refer to a tag created by an earlier one. The changes are made within a single transaction: if any line cannot be applied then the database is left unchanged. A report of each transformation and the number of files it affected is printed. Specify --pretend to print the report without making any changes.
+
+Before making changes affecting ` + strconv.Itoa(confirmationFileCount) + ` or more files between them, confirmation is asked for. Specify --yes to apply them without confirmation, such as from a script.`,
+	Examples: []string{"$ cat mapping.tsv\n# fix typos\nmontain\tmountain\noutdoors\toutdoor\nlandscape-photo\tlandscape\tphoto\ntemp",
+		"$ tmsu retag --pretend --map mapping.tsv\nrename 'montain' to 'mountain': 3 file(s)\nmerge 'outdoors' into 'outdoor': 12 file(s)\nsplit 'landscape-photo' into 'landscape', 'photo': 7 file(s)\ndrop 'temp': 2 file(s)"},
+	Options: Options{Option{"--map", "-m", "read the tag transformations from FILE", true, ""},
+		Option{"--pretend", "-P", "do not make any changes", false, ""},
+		yesOption},
+	Exec: retagExec,
+}
+
+// unexported
+
+// a line of a retag mapping
+type retagMapping struct {
+	line    int
+	source  string
+	targets []string
+}
+
+func retagExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+	if !options.HasOption("--map") {
+		return UsageError{"the mapping file must be specified with --map"}, nil
+	}
+
+	pretend := options.HasOption("--pretend")
+
+	mapPath := options.Get("--map").Argument
+	reader := io.Reader(os.Stdin)
+	if mapPath != "-" {
+		file, err := os.Open(mapPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not open file: %w", mapPath, err), nil
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	mappings, err := readRetagMappings(reader)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	if !pretend {
+		if err := backupBeforeChange(store, tx); err != nil {
+			tx.Rollback()
+			return err, nil
+		}
+	}
+
+	if err := beginOperation(store, tx); err != nil {
+		tx.Rollback()
+		return err, nil
+	}
+
+	// the transformations are made even when pretending so that the file
+	// counts of the later lines reflect the changes of the earlier ones
+	report := make([]string, len(mappings))
+	total := uint(0)
+	for index, mapping := range mappings {
+		description, fileCount, err := retag(store, tx, mapping)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("line %v: %w", mapping.line, err), nil
+		}
+
+		report[index] = fmt.Sprintf("%v: %v file(s)", description, fileCount)
+		total += fileCount
+	}
+
+	for _, line := range report {
+		fmt.Println(line)
+	}
+
+	if pretend {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	if total >= confirmationFileCount && !dryRun {
+		confirmed, err := confirm(options, nil, fmt.Sprintf("apply these %v change(s)?", len(mappings)))
+		if err != nil || !confirmed {
+			tx.Rollback()
+			return err, nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err, nil
+	}
+
+	return nil, nil
+}
+
+func readRetagMappings(reader io.Reader) ([]retagMapping, error) {
+	mappings := make([]retagMapping, 0, 10)
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		mapping, err := parseRetagMapping(line)
+		if err != nil {
+			return nil, UsageError{fmt.Sprintf("line %v: %v", lineNumber, err)}
+		}
+		mapping.line = lineNumber
+
+		mappings = append(mappings, mapping)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read mapping: %w", err)
+	}
+
+	return mappings, nil
+}
+
+func parseRetagMapping(line string) (retagMapping, error) {
+	fields := strings.Split(line, "\t")
+
+	source := fields[0]
+	if source == "" {
+		return retagMapping{}, fmt.Errorf("missing tag name")
+	}
+
+	targets := make([]string, 0, len(fields)-1)
+	for _, target := range fields[1:] {
+		if target == "" {
+			// tolerate trailing tabs
+			continue
+		}
+
+		for _, existing := range targets {
+			if existing == target {
+				return retagMapping{}, fmt.Errorf("tag '%v' is listed more than once", target)
+			}
+		}
+
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 1 && targets[0] == source {
+		return retagMapping{}, fmt.Errorf("cannot map tag '%v' to itself", source)
+	}
+
+	return retagMapping{0, source, targets}, nil
+}
+
+// applies a mapping, returning a description of the transformation and the
+// number of files that were tagged with the transformed tag
+func retag(store *storage.Storage, tx *storage.Tx, mapping retagMapping) (string, uint, error) {
+	sourceTag, err := store.TagByName(tx, mapping.source)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not retrieve tag '%v': %w", mapping.source, err)
+	}
+	if sourceTag == nil {
+		return "", 0, NoSuchTagError{mapping.source}
+	}
+
+	fileCount, err := store.FileCountByTagId(tx, sourceTag.Id)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not count files tagged '%v': %w", mapping.source, err)
+	}
+
+	switch len(mapping.targets) {
+	case 0:
+		log.Infof(2, "deleting tag '%v'.", sourceTag.Name)
+
+		if err := store.DeleteTag(tx, sourceTag.Id); err != nil {
+			return "", 0, fmt.Errorf("could not delete tag '%v': %w", sourceTag.Name, err)
+		}
+
+		return fmt.Sprintf("drop '%v'", sourceTag.Name), fileCount, nil
+	case 1:
+		destName := mapping.targets[0]
+
+		destTag, err := store.TagByName(tx, destName)
+		if err != nil {
+			return "", 0, fmt.Errorf("could not retrieve tag '%v': %w", destName, err)
+		}
+		if destTag != nil {
+			if err := mergeTag(store, tx, sourceTag, destTag); err != nil {
+				return "", 0, err
+			}
+
+			return fmt.Sprintf("merge '%v' into '%v'", sourceTag.Name, destTag.Name), fileCount, nil
+		}
+
+		if err := renameTag(store, tx, sourceTag.Name, destName); err != nil {
+			return "", 0, err
+		}
+
+		return fmt.Sprintf("rename '%v' to '%v'", sourceTag.Name, destName), fileCount, nil
+	}
+
+	if err := splitTag(store, tx, sourceTag, mapping.targets); err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("split '%v' into '%v'", sourceTag.Name, strings.Join(mapping.targets, "', '")), fileCount, nil
+}
+
+// applies each of the destination tags to the files tagged with the source
+// tag, with the same values, and then deletes the source tag unless it is
+// amongst the destinations
+func splitTag(store *storage.Storage, tx *storage.Tx, sourceTag *entities.Tag, destNames []string) error {
+	log.Infof(2, "finding files tagged '%v'.", sourceTag.Name)
+
+	fileTags, err := store.FileTagsByTagId(tx, sourceTag.Id, true)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files for tag '%v': %w", sourceTag.Name, err)
+	}
+
+	keepSource := false
+	for _, destName := range destNames {
+		if destName == sourceTag.Name {
+			keepSource = true
+			continue
+		}
+
+		destTag, err := store.TagByName(tx, destName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", destName, err)
+		}
+		if destTag == nil {
+			log.Infof(2, "creating tag '%v'.", destName)
+
+			destTag, err = store.AddTag(tx, destName)
+			if err != nil {
+				return fmt.Errorf("could not create tag '%v': %w", destName, err)
+			}
+		}
+
+		log.Infof(2, "applying tag '%v' to the files tagged '%v'.", destTag.Name, sourceTag.Name)
+
+		for _, fileTag := range fileTags {
+			if _, err = store.AddFileTag(tx, fileTag.FileId, destTag.Id, fileTag.ValueId); err != nil {
+				return fmt.Errorf("could not apply tag '%v' to file #%v: %w", destTag.Name, fileTag.FileId, err)
+			}
+		}
+	}
+
+	if keepSource {
+		return nil
+	}
+
+	log.Infof(2, "deleting tag '%v'.", sourceTag.Name)
+
+	if err = store.DeleteTag(tx, sourceTag.Id); err != nil {
+		return fmt.Errorf("could not delete tag '%v': %w", sourceTag.Name, err)
+	}
+
+	return nil
+}
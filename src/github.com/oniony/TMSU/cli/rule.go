@@ -0,0 +1,252 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/rule"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strconv"
+	"strings"
+)
+
+var RuleCommand = Command{
+	Name:     "rule",
+	Synopsis: "Manage automatic tagging rules",
+	Usages: []string{"tmsu rule add CONDITION TAG[=VALUE]...",
+		"tmsu rule delete ID...",
+		"tmsu rule [list]"},
+	Description: `Manages the rules by which files are tagged automatically.
+
+A rule applies its TAGs to any file that satisfies its CONDITION when that file is tagged with the 'tag' subcommand or examined by the 'autotag' subcommand. CONDITION takes one of the following forms:
+
+  glob:PATTERN     - the file name matches the wildcard PATTERN, or the absolute path does where PATTERN contains a slash
+  regex:PATTERN    - the absolute path matches the regular expression PATTERN
+  mime:TYPE        - the file has the MIME type TYPE, which may contain wildcards, e.g. 'audio/*'
+  exif:FIELD=VALUE - the image has the EXIF field FIELD, e.g. 'Make', 'Model' or 'DateTimeOriginal', with a value matching the wildcard VALUE
+
+The MIME type of a file is identified by its extension or, failing that, its content.
+
+When run without arguments, or with 'list', lists the rules.`,
+	Examples: []string{"$ tmsu rule add 'glob:*.flac' music lossless",
+		"$ tmsu rule add 'exif:Make=Canon' photo camera=canon",
+		`$ tmsu rule
+1: glob:*.flac -> music lossless
+2: exif:Make=Canon -> photo camera=canon`,
+		"$ tmsu rule delete 2"},
+	Options: Options{},
+	Exec:    ruleExec,
+}
+
+// unexported
+
+func ruleExec(options Options, args []string, databasePath string) (error, warnings) {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:]
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	switch action {
+	case "list":
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		return listRules(store, tx), nil
+	case "add":
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+
+		return addRule(store, tx, args[0], args[1:])
+	case "delete":
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+
+		return deleteRules(store, tx, args)
+	}
+
+	return fmt.Errorf("invalid action '%v': expected add, delete or list", action), nil
+}
+
+func listRules(store *storage.Storage, tx *storage.Tx) error {
+	log.Info(2, "retrieving rules")
+
+	rules, err := store.Rules(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve rules: %w", err)
+	}
+
+	for _, rule := range rules {
+		fmt.Printf("%v: %v -> %v\n", rule.Id, rule.Condition, rule.Tags)
+	}
+
+	return nil
+}
+
+func addRule(store *storage.Storage, tx *storage.Tx, conditionText string, tagArgs []string) (error, warnings) {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	if _, err := rule.ParseCondition(conditionText); err != nil {
+		return err, nil
+	}
+
+	log.Infof(2, "loading settings")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	// create the tags now so that a rule does not silently fail to apply them
+	_, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, nil)
+	if err != nil {
+		return err, warnings
+	}
+	if len(warnings) > 0 {
+		return nil, warnings
+	}
+
+	escapedTagArgs := make([]string, len(tagArgs))
+	for index, tagArg := range tagArgs {
+		escapedTagArgs[index] = escape(tagArg, '\\', ' ', '"', '\'')
+	}
+
+	log.Infof(2, "adding rule '%v'", conditionText)
+
+	if _, err := store.AddRule(tx, conditionText, strings.Join(escapedTagArgs, " ")); err != nil {
+		return fmt.Errorf("could not add rule: %w", err), nil
+	}
+
+	return nil, nil
+}
+
+func deleteRules(store *storage.Storage, tx *storage.Tx, ids []string) (error, warnings) {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, id := range ids {
+		ruleId, err := strconv.ParseUint(id, 10, 0)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("invalid rule '%v'", id))
+			continue
+		}
+
+		log.Infof(2, "deleting rule #%v", ruleId)
+
+		if err := store.DeleteRule(tx, entities.RuleId(ruleId)); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return nil, warnings
+}
+
+// the rules of a database with their conditions parsed. The tags of each
+// rule are resolved when it is first satisfied.
+type ruleSet struct {
+	store    *storage.Storage
+	settings entities.Settings
+	rules    []*parsedRule
+}
+
+type parsedRule struct {
+	rule      *entities.Rule
+	condition rule.Condition
+	pairs     entities.TagIdValueIdPairs
+	resolved  bool
+}
+
+func loadRules(store *storage.Storage, tx *storage.Tx, settings entities.Settings) (*ruleSet, error) {
+	log.Info(2, "loading rules")
+
+	rules, err := store.Rules(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve rules: %w", err)
+	}
+
+	parsedRules := make([]*parsedRule, len(rules))
+	for index, entity := range rules {
+		condition, err := rule.ParseCondition(entity.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%v: %w", entity.Id, err)
+		}
+
+		parsedRules[index] = &parsedRule{entity, condition, nil, false}
+	}
+
+	return &ruleSet{store, settings, parsedRules}, nil
+}
+
+// the tags to apply to the file on account of the rules that it satisfies
+func (rules *ruleSet) pairsFor(tx *storage.Tx, path string) (entities.TagIdValueIdPairs, error) {
+	if rules == nil || len(rules.rules) == 0 {
+		return nil, nil
+	}
+
+	pairs := make(entities.TagIdValueIdPairs, 0, 10)
+
+	for _, parsed := range rules.rules {
+		satisfied, err := parsed.condition.Matches(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not evaluate rule #%v: %w", path, parsed.rule.Id, err)
+		}
+		if !satisfied {
+			continue
+		}
+
+		log.Infof(2, "%v: satisfies rule #%v", path, parsed.rule.Id)
+
+		if !parsed.resolved {
+			var warnings warnings
+			parsed.pairs, warnings, err = parseTagValuePairs(rules.store, tx, rules.settings, text.Tokenize(parsed.rule.Tags), nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, warning := range warnings {
+				log.Warnf("rule #%v: %v", parsed.rule.Id, warning)
+			}
+
+			parsed.resolved = true
+		}
+
+		pairs = append(pairs, parsed.pairs...)
+	}
+
+	return pairs, nil
+}
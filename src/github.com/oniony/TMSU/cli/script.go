@@ -0,0 +1,502 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ScriptCommand = Command{
+	Name:     "script",
+	Synopsis: "Run a script of commands",
+	Usages:   []string{"tmsu script [FILE]"},
+	Description: `Runs the script read from FILE, or from standard input if no FILE is specified, committing its changes only if it completes. The commands are run within this process against the one database transaction, which is far quicker than running 'tmsu' for each.
+
+Each line holds a statement, its words quoted as they would be for the shell. Blank lines and lines beginning with '#' are ignored. The statements are:
+
+  COMMAND ARGS...           runs the subcommand, without the leading 'tmsu'
+  set NAME WORDS...         sets the variable NAME to the words
+  echo WORDS...             prints the words
+  for NAME in files QUERY   runs the statements up to 'end' for each file matching QUERY
+  for NAME in tags [FILE]   runs them for each tag, or each tag of FILE
+  for NAME in values [TAG]  runs them for each value, or each value of TAG
+  for NAME in WORDS...      runs them for each of the words
+  if CONDITION              runs the statements up to 'else' or 'end' if CONDITION holds, else those up to 'end'
+
+The conditions are:
+
+  A = B, A != B             the words are, or are not, the same
+  A ~ PATTERN, A !~ PATTERN A does, or does not, match the regular expression
+  FILE matches QUERY        the file matches the query
+  not CONDITION             the condition does not hold
+
+Within each word '$NAME' and '${NAME}' are replaced by the value of the variable and '$$' by '$'. The files of a loop are listed, and the conditions tested, against the changes made so far, a query naming a tag that does not yet exist matching no files.
+
+Should a command fail or report a problem then the script stops and its changes are rolled back.`,
+	Examples: []string{"$ tmsu script retag.tmsu",
+		`$ printf 'for tag in tags\n  echo $tag\nend\n' | tmsu script`,
+		`$ printf 'for file in files photo\n  if $file ~ "\\.raw$"\n    tag $file raw\n  end\nend\n' | tmsu script`},
+	Options: Options{},
+	Exec:    scriptExec,
+}
+
+// unexported
+
+// a statement of a script along with, for a loop or condition, the statements
+// it runs
+type scriptStatement struct {
+	line   int
+	words  []string
+	body   []scriptStatement
+	orElse []scriptStatement
+}
+
+type scriptRunner struct {
+	run       *atomicRun
+	store     *storage.Storage
+	parser    *OptionParser
+	inherited Options
+	variables map[string]string
+}
+
+var scriptNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var scriptVariableRegexp = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+func scriptExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 1 {
+		return errTooManyArguments, nil
+	}
+
+	reader := io.Reader(os.Stdin)
+	if len(args) == 1 {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("could not open '%v': %w", args[0], err), nil
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	statements, err := parseScript(reader)
+	if err != nil {
+		return err, nil
+	}
+
+	run, err := beginAtomically(databasePath)
+	if err != nil {
+		return err, nil
+	}
+
+	runner := scriptRunner{run, atomicStore, NewOptionParser(globalOptions, atomicCommands), inheritedOptions(options), make(map[string]string)}
+	if err, warnings := runner.runBlock(statements); err != nil {
+		return err, warnings
+	}
+
+	return run.end()
+}
+
+// parses the statements of the script, checking their syntax before any is run
+func parseScript(reader io.Reader) ([]scriptStatement, error) {
+	lines := make([]scriptStatement, 0, 10)
+
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, scriptStatement{line: number, words: text.Tokenize(line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read script: %w", err)
+	}
+
+	commands := buildCommandByNameMap(atomicCommands)
+
+	statements, index, err := parseScriptBlock(lines, 0, commands)
+	if err != nil {
+		return nil, err
+	}
+	if index < len(lines) {
+		return nil, scriptSyntaxError(lines[index], "'%v' without 'if' or 'for'", lines[index].words[0])
+	}
+
+	return statements, nil
+}
+
+// parses the statements up to the 'else' or 'end' that closes the block, or to
+// the end of the script, returning the index of the closing line
+func parseScriptBlock(lines []scriptStatement, index int, commands map[string]*Command) ([]scriptStatement, int, error) {
+	statements := make([]scriptStatement, 0, len(lines)-index)
+
+	for index < len(lines) {
+		statement := lines[index]
+		if err := checkScriptStatement(statement, commands); err != nil {
+			return nil, 0, err
+		}
+
+		switch statement.words[0] {
+		case "else", "end":
+			return statements, index, nil
+		case "for", "if":
+			body, next, err := parseScriptBlock(lines, index+1, commands)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			var orElse []scriptStatement
+			if statement.words[0] == "if" && next < len(lines) && lines[next].words[0] == "else" {
+				if orElse, next, err = parseScriptBlock(lines, next+1, commands); err != nil {
+					return nil, 0, err
+				}
+			}
+
+			if next == len(lines) {
+				return nil, 0, scriptSyntaxError(statement, "'%v' without 'end'", statement.words[0])
+			}
+			if lines[next].words[0] != "end" {
+				return nil, 0, scriptSyntaxError(lines[next], "'else' without 'if'")
+			}
+
+			statement.body, statement.orElse = body, orElse
+			index = next + 1
+		default:
+			index++
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements, index, nil
+}
+
+func checkScriptStatement(statement scriptStatement, commands map[string]*Command) error {
+	words := statement.words
+
+	switch words[0] {
+	case "else", "end":
+		if len(words) > 1 {
+			return scriptSyntaxError(statement, "unexpected '%v' after '%v'", words[1], words[0])
+		}
+	case "echo":
+	case "set":
+		if len(words) < 2 || !scriptNameRegexp.MatchString(words[1]) {
+			return scriptSyntaxError(statement, "expected 'set NAME WORDS...'")
+		}
+	case "for":
+		if len(words) < 3 || !scriptNameRegexp.MatchString(words[1]) || words[2] != "in" {
+			return scriptSyntaxError(statement, "expected 'for NAME in ...'")
+		}
+		if len(words) > 5 && (words[3] == "tags" || words[3] == "values") {
+			return scriptSyntaxError(statement, "expected 'for NAME in %v [%v]'", words[3], map[string]string{"tags": "FILE", "values": "TAG"}[words[3]])
+		}
+	case "if":
+		if err := checkScriptCondition(words[1:]); err != nil {
+			return scriptSyntaxError(statement, "%v", err)
+		}
+	default:
+		if name := words[0]; !strings.Contains(name, "$") && commands[name] == nil {
+			return scriptSyntaxError(statement, "unknown subcommand '%v'", name)
+		}
+	}
+
+	return nil
+}
+
+func checkScriptCondition(words []string) error {
+	for len(words) > 0 && words[0] == "not" {
+		words = words[1:]
+	}
+
+	switch {
+	case len(words) == 3 && isScriptComparison(words[1]):
+		return nil
+	case len(words) >= 2 && words[1] == "matches":
+		return nil
+	}
+
+	return fmt.Errorf("expected a condition such as 'A = B', 'A ~ PATTERN' or 'FILE matches QUERY'")
+}
+
+func isScriptComparison(operator string) bool {
+	switch operator {
+	case "=", "!=", "~", "!~":
+		return true
+	}
+
+	return false
+}
+
+func scriptSyntaxError(statement scriptStatement, format string, args ...interface{}) error {
+	return UsageError{fmt.Sprintf("line %v: %v", statement.line, fmt.Sprintf(format, args...))}
+}
+
+func (runner *scriptRunner) runBlock(statements []scriptStatement) (error, warnings) {
+	for _, statement := range statements {
+		if err, warnings := runner.runStatement(statement); err != nil {
+			return err, warnings
+		}
+	}
+
+	return nil, nil
+}
+
+// runs the statement, returning the error with which the script was stopped
+// and its changes rolled back
+func (runner *scriptRunner) runStatement(statement scriptStatement) (error, warnings) {
+	words, err := runner.expand(statement.words)
+	if err != nil {
+		return runner.fail(statement, err)
+	}
+
+	switch statement.words[0] {
+	case "echo":
+		fmt.Println(strings.Join(words[1:], " "))
+	case "set":
+		runner.variables[statement.words[1]] = strings.Join(words[2:], " ")
+	case "for":
+		items, err := runner.loopItems(words[3:])
+		if err != nil {
+			return runner.fail(statement, err)
+		}
+
+		for _, item := range items {
+			runner.variables[statement.words[1]] = item
+			if err, warnings := runner.runBlock(statement.body); err != nil {
+				return err, warnings
+			}
+		}
+	case "if":
+		holds, err := runner.test(words[1:])
+		if err != nil {
+			return runner.fail(statement, err)
+		}
+
+		if holds {
+			return runner.runBlock(statement.body)
+		}
+
+		return runner.runBlock(statement.orElse)
+	default:
+		step, err := parseAtomicStep(runner.parser, words, runner.inherited)
+		if err != nil {
+			return runner.fail(statement, err)
+		}
+
+		return runner.run.exec(*step)
+	}
+
+	return nil, nil
+}
+
+// stops the script, rolling back its changes
+func (runner *scriptRunner) fail(statement scriptStatement, err error) (error, warnings) {
+	reason := fmt.Errorf("line %v: %w", statement.line, err)
+
+	return runner.run.abort(TransactionRolledBackError{strings.Join(statement.words, " "), reason}, warnings{reason})
+}
+
+// the words with the variables they reference substituted
+func (runner *scriptRunner) expand(words []string) ([]string, error) {
+	expanded := make([]string, len(words))
+
+	var err error
+	for index, word := range words {
+		expanded[index] = scriptVariableRegexp.ReplaceAllStringFunc(word, func(reference string) string {
+			if reference == "$$" {
+				return "$"
+			}
+
+			match := scriptVariableRegexp.FindStringSubmatch(reference)
+			name := match[1] + match[2]
+
+			value, ok := runner.variables[name]
+			if !ok && err == nil {
+				err = fmt.Errorf("undefined variable '%v'", name)
+			}
+
+			return value
+		})
+	}
+
+	return expanded, err
+}
+
+// the items a loop iterates over
+func (runner *scriptRunner) loopItems(words []string) ([]string, error) {
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	tx, err := runner.store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Commit()
+
+	switch words[0] {
+	case "files":
+		files, err := runner.queryFiles(tx, strings.Join(words[1:], " "), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]string, len(files))
+		for index, file := range files {
+			paths[index] = _path.Rel(file.Path())
+		}
+
+		return paths, nil
+	case "tags":
+		if len(words) == 1 {
+			tags, err := runner.store.Tags(tx)
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve tags: %w", err)
+			}
+
+			names := make([]string, len(tags))
+			for index, tag := range tags {
+				names[index] = tag.Name
+			}
+
+			return names, nil
+		}
+
+		file, err := runner.fileByPath(tx, words[1])
+		if err != nil || file == nil {
+			return nil, err
+		}
+
+		names, err := tagNamesForFile(runner.store, tx, file.Id, "", false, false, false, nil)
+		return names, err
+	case "values":
+		var values entities.Values
+		if len(words) == 1 {
+			values, err = runner.store.Values(tx)
+		} else {
+			tag, err := runner.store.TagByNameOrAlias(tx, words[1])
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve tag '%v': %w", words[1], err)
+			}
+			if tag == nil {
+				return nil, NoSuchTagError{words[1]}
+			}
+
+			values, err = runner.store.ValuesByTag(tx, tag.Id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve values: %w", err)
+		}
+
+		names := make([]string, len(values))
+		for index, value := range values {
+			names[index] = value.Name
+		}
+
+		return names, nil
+	}
+
+	return words, nil
+}
+
+// determines whether the condition holds
+func (runner *scriptRunner) test(words []string) (bool, error) {
+	if words[0] == "not" {
+		holds, err := runner.test(words[1:])
+		return !holds, err
+	}
+
+	switch words[1] {
+	case "=":
+		return words[0] == words[2], nil
+	case "!=":
+		return words[0] != words[2], nil
+	case "~", "!~":
+		pattern, err := regexp.Compile(words[2])
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression '%v': %w", words[2], err)
+		}
+
+		return pattern.MatchString(words[0]) == (words[1] == "~"), nil
+	}
+
+	absPath, err := filepath.Abs(words[0])
+	if err != nil {
+		return false, fmt.Errorf("%v: could not get absolute path: %w", words[0], err)
+	}
+
+	tx, err := runner.store.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Commit()
+
+	files, err := runner.queryFiles(tx, strings.Join(words[2:], " "), []string{absPath})
+	if err != nil {
+		return false, err
+	}
+
+	for _, file := range files {
+		if file.Path() == absPath {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// the files matching the query, beneath the paths if any are specified. The
+// warnings of tags that do not exist are not reported as such tags simply
+// match no files.
+func (runner *scriptRunner) queryFiles(tx *storage.Tx, queryText string, paths []string) (entities.Files, error) {
+	expression, _, err := parseCheckedQuery(runner.store, tx, queryText, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := runner.store.FilesForQuery(tx, expression, paths, "", false, false, "name", false, 0)
+	if err != nil {
+		return nil, queryError(err)
+	}
+
+	return files, nil
+}
+
+func (runner *scriptRunner) fileByPath(tx *storage.Tx, path string) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	file, err := runner.store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+
+	return file, nil
+}
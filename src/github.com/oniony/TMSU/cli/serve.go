@@ -0,0 +1,95 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"os"
+)
+
+var ServeCommand = Command{
+	Name:     "serve",
+	Synopsis: "Share the database with other machines",
+	Usages:   []string{"tmsu serve ADDRESS", "tmsu serve --http ADDRESS"},
+	Description: `Serves the database to TMSU clients connecting to ADDRESS, which is either HOST:PORT for a TCP socket or unix:PATH for a local socket. This allows files on shared storage to be tagged from several machines against one database.
+
+Clients use the served database in place of a local one when the TMSU_REMOTE environment variable holds the address. Paths are stored relative to the root path of the served database, which should therefore be the same on each machine: set TMSU_REMOTE_ROOT on a client where the shared storage is mounted elsewhere.
+
+Clients must authenticate with the secret held in the TMSU_SECRET environment variable of the server. A secret is required when serving over TCP, where connections are not otherwise restricted, but is optional for local sockets, which can only be used by their owner. The protocol is not encrypted so should only be used on a trusted network.
+
+With --http, a REST API is served at ADDRESS instead, so that web frontends and mobile applications can browse and edit tags over the network. Requests must present the secret as a bearer token in an 'Authorization: Bearer SECRET' header, the secret again being required over TCP. Responses are JSON, errors being reported as per --format=json with an appropriate HTTP status. The endpoints are:
+
+  GET /files?q=QUERY          List the files matching QUERY, or all files
+  GET /files/ID               Retrieve the file with ID and its tags
+  POST /files/ID/tags         Apply tags, given as {"tags": ["TAG[=VALUE]", ...]}
+  DELETE /files/ID/tags/TAG   Remove the tag TAG, or TAG=VALUE, from the file
+  GET /tags                   List the tags and the number of files tagged with each
+
+Changes made through the API are recorded so they can be reverted with the 'undo' subcommand. HTTP is not encrypted, so serve the API behind a TLS proxy beyond a trusted network.
+
+The command runs until it is interrupted.`,
+	Examples: []string{"$ TMSU_SECRET=swordfish tmsu serve :7790",
+		"$ TMSU_REMOTE=nas:7790 TMSU_SECRET=swordfish tmsu tag /mnt/nas/photos/cat.jpg cat",
+		"$ tmsu serve unix:/tmp/tmsu.socket",
+		"$ TMSU_REMOTE=unix:/tmp/tmsu.socket tmsu files cat",
+		"$ TMSU_SECRET=swordfish tmsu serve --http :8080",
+		"$ curl -H 'Authorization: Bearer swordfish' 'http://nas:8080/files?q=cat'"},
+	Options: Options{{"--http", "", "serve a REST API over HTTP at ADDRESS", true, ""}},
+	Exec:    serveExec,
+}
+
+// unexported
+
+func serveExec(options Options, args []string, databasePath string) (error, warnings) {
+	serveApi := options.HasOption("--http")
+
+	switch {
+	case serveApi && len(args) > 0, len(args) > 1:
+		return errTooManyArguments, nil
+	case !serveApi && len(args) < 1:
+		return errTooFewArguments, nil
+	}
+
+	var address string
+	if serveApi {
+		address = options.Get("--http").Argument
+	} else {
+		address = args[0]
+	}
+
+	store, err := openLocalDatabase(databasePath, readOnly)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	log.Infof(2, "serving database '%v'", store.DbPath)
+
+	if serveApi {
+		if err := serveHttp(store, address, os.Getenv("TMSU_SECRET")); err != nil {
+			return fmt.Errorf("could not serve REST API on '%v': %w", address, err), nil
+		}
+
+		return nil, nil
+	}
+
+	if err := store.Serve(address, os.Getenv("TMSU_SECRET")); err != nil {
+		return fmt.Errorf("could not serve database on '%v': %w", address, err), nil
+	}
+
+	return nil, nil
+}
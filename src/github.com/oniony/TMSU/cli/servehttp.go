@@ -0,0 +1,373 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"github.com/oniony/TMSU/storage/database"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the largest request body accepted
+const maxHttpRequestSize = 1 << 20
+
+type jsonApiFile struct {
+	Id   entities.FileId `json:"id"`
+	Path string          `json:"path"`
+	Tags []jsonTag       `json:"tags,omitempty"`
+}
+
+type jsonApiTags struct {
+	Tags []string `json:"tags"`
+}
+
+// the REST API served by 'serve --http'. Requests are handled one at a time as
+// each is run within its own transaction.
+type httpApi struct {
+	store  *storage.Storage
+	secret string
+	lock   sync.Mutex
+}
+
+// serves the REST API at the address, which is either HOST:PORT or unix:PATH,
+// until the listener fails
+func serveHttp(store *storage.Storage, address, secret string) error {
+	listener, err := database.Listen(address, secret)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	api := &httpApi{store: store, secret: secret}
+
+	log.Infof(2, "serving REST API on '%v'", address)
+
+	return http.Serve(listener, api.handle(api.route))
+}
+
+// a route of the API: the method and the components of its path with '*' in
+// place of a variable component
+type httpRoute struct {
+	method     string
+	components []string
+	handler    func(*http.Request, []string, *storage.Tx) (interface{}, error)
+}
+
+func (api *httpApi) route(request *http.Request, tx *storage.Tx) (interface{}, error) {
+	return routeHttp(request, tx, []httpRoute{
+		{http.MethodGet, []string{"files"}, api.listFiles},
+		{http.MethodGet, []string{"files", "*"}, api.getFile},
+		{http.MethodPost, []string{"files", "*", "tags"}, api.tagFile},
+		{http.MethodDelete, []string{"files", "*", "tags", "*"}, api.untagFile},
+		{http.MethodGet, []string{"tags"}, api.listTags},
+	})
+}
+
+// runs the handler of the route matching the request, passing it the variable
+// components of the path. The components are split before being unescaped so
+// that a tag name may contain an escaped slash.
+func routeHttp(request *http.Request, tx *storage.Tx, routes []httpRoute) (interface{}, error) {
+	components := strings.Split(strings.Trim(request.URL.EscapedPath(), "/"), "/")
+	for index, component := range components {
+		unescaped, err := url.PathUnescape(component)
+		if err != nil {
+			return nil, UsageError{fmt.Sprintf("invalid path '%v': %v", request.URL.EscapedPath(), err)}
+		}
+
+		components[index] = unescaped
+	}
+
+	methodAllowed := true
+	for _, route := range routes {
+		variables, matches := matchHttpRoute(route.components, components)
+		if !matches {
+			continue
+		}
+		if route.method != request.Method {
+			methodAllowed = false
+			continue
+		}
+
+		return route.handler(request, variables, tx)
+	}
+
+	if !methodAllowed {
+		return nil, httpError{http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed for '%v'", request.Method, request.URL.Path)}
+	}
+
+	return nil, httpError{http.StatusNotFound, fmt.Errorf("no such endpoint '%v'", request.URL.Path)}
+}
+
+func matchHttpRoute(pattern, components []string) ([]string, bool) {
+	if len(pattern) != len(components) {
+		return nil, false
+	}
+
+	variables := make([]string, 0, 2)
+	for index, component := range pattern {
+		switch component {
+		case "*":
+			variables = append(variables, components[index])
+		case components[index]:
+		default:
+			return nil, false
+		}
+	}
+
+	return variables, true
+}
+
+// an error reported with a particular HTTP status
+type httpError struct {
+	status int
+	err    error
+}
+
+func (err httpError) Error() string {
+	return err.err.Error()
+}
+
+// wraps a handler with authentication, serialisation and the encoding of its
+// response, or of its error, as JSON
+func (api *httpApi) handle(handler func(*http.Request, *storage.Tx) (interface{}, error)) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		log.Infof(2, "%v %v", request.Method, request.URL)
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if !api.authorised(request) {
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writeHttpError(writer, http.StatusUnauthorized, fmt.Errorf("a valid token is required"))
+			return
+		}
+
+		api.lock.Lock()
+		defer api.lock.Unlock()
+
+		tx, err := api.store.Begin()
+		if err != nil {
+			writeHttpError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		response, err := handler(request, tx)
+		if err != nil {
+			tx.Rollback()
+			writeHttpError(writer, httpStatusFor(err), err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			writeHttpError(writer, httpStatusFor(err), err)
+			return
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(response)
+	}
+}
+
+// whether the request bears the secret as a bearer token, where one is required
+func (api *httpApi) authorised(request *http.Request) bool {
+	if api.secret == "" {
+		return true
+	}
+
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(api.secret)) == 1
+}
+
+// GET /files?q=QUERY lists the files matching the query, or all files
+func (api *httpApi) listFiles(request *http.Request, variables []string, tx *storage.Tx) (interface{}, error) {
+	expression, warnings, err := parseCheckedQuery(api.store, tx, request.URL.Query().Get("q"), false, false)
+	if err != nil {
+		return nil, UsageError{err.Error()}
+	}
+	if len(warnings) > 0 {
+		return nil, warnings[0]
+	}
+
+	files, err := api.store.FilesForQuery(tx, expression, nil, "", false, false, "name", false, 0)
+	if err != nil {
+		return nil, queryError(err)
+	}
+
+	jsonFiles := make([]jsonApiFile, len(files))
+	for index, file := range files {
+		jsonFiles[index] = jsonApiFile{file.Id, file.Path(), nil}
+	}
+
+	return jsonFiles, nil
+}
+
+// GET /files/ID retrieves a file with its tags
+func (api *httpApi) getFile(request *http.Request, variables []string, tx *storage.Tx) (interface{}, error) {
+	file, err := api.file(tx, variables[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return api.fileWithTags(tx, file)
+}
+
+// POST /files/ID/tags applies the tags, given as {"tags": ["TAG[=VALUE]", ...]}
+func (api *httpApi) tagFile(request *http.Request, variables []string, tx *storage.Tx) (interface{}, error) {
+	file, err := api.file(tx, variables[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var body jsonApiTags
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, request.Body, maxHttpRequestSize))
+	if err := decoder.Decode(&body); err != nil {
+		return nil, UsageError{fmt.Sprintf("invalid request body: %v", err)}
+	}
+	if len(body.Tags) == 0 {
+		return nil, UsageError{"no tags specified"}
+	}
+
+	command := fmt.Sprintf("tmsu tag %v %v", file.Path(), strings.Join(body.Tags, " "))
+	if err := recordOperation(api.store, tx, command); err != nil {
+		return nil, err
+	}
+
+	err, warnings := tagPaths(api.store, tx, body.Tags, []string{file.Path()}, false, false, false, false, false, false, false, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		return nil, warnings[0]
+	}
+
+	return api.fileWithTags(tx, file)
+}
+
+// DELETE /files/ID/tags/TAG[=VALUE] removes the tag
+func (api *httpApi) untagFile(request *http.Request, variables []string, tx *storage.Tx) (interface{}, error) {
+	file, err := api.file(tx, variables[0])
+	if err != nil {
+		return nil, err
+	}
+
+	tagArg := variables[1]
+
+	command := fmt.Sprintf("tmsu untag %v %v", file.Path(), tagArg)
+	if err := recordOperation(api.store, tx, command); err != nil {
+		return nil, err
+	}
+
+	err, warnings := untagPaths(api.store, tx, []string{file.Path()}, []string{tagArg}, false, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		return nil, warnings[0]
+	}
+
+	return api.fileWithTags(tx, file)
+}
+
+// GET /tags lists the tags with the number of files each is applied to
+func (api *httpApi) listTags(request *http.Request, variables []string, tx *storage.Tx) (interface{}, error) {
+	tags, err := api.store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %w", err)
+	}
+
+	usages, err := api.store.TagUsage(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag usage: %w", err)
+	}
+
+	counts := make(map[entities.TagId]uint, len(usages))
+	for _, usage := range usages {
+		counts[usage.Id] = usage.FileCount
+	}
+
+	jsonCounts := make([]jsonTagFileCount, len(tags))
+	for index, tag := range tags {
+		jsonCounts[index] = jsonTagFileCount{tag.Name, counts[tag.Id]}
+	}
+
+	return jsonCounts, nil
+}
+
+// the file with the ID given in the request path
+func (api *httpApi) file(tx *storage.Tx, idText string) (*entities.File, error) {
+	id, err := strconv.ParseUint(idText, 10, 32)
+	if err != nil {
+		return nil, UsageError{fmt.Sprintf("invalid file ID '%v'", idText)}
+	}
+
+	file, err := api.store.File(tx, entities.FileId(id))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file '%v': %w", id, err)
+	}
+	if file == nil {
+		return nil, NoSuchFileError{fmt.Sprintf("file #%v", id)}
+	}
+
+	return file, nil
+}
+
+func (api *httpApi) fileWithTags(tx *storage.Tx, file *entities.File) (interface{}, error) {
+	tags, err := jsonTagsForFile(api.store, tx, file.Id, "", false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonApiFile{file.Id, file.Path(), tags}, nil
+}
+
+// the HTTP status reporting the class of error
+func httpStatusFor(err error) int {
+	if httpErr, ok := err.(httpError); ok {
+		return httpErr.status
+	}
+
+	switch codeFor(err) {
+	case usageError, constraintError:
+		return http.StatusBadRequest
+	case noSuchTagError, noSuchValueError, noSuchFileError, noSuchViewError:
+		return http.StatusNotFound
+	case permissionError, readOnlyError:
+		return http.StatusForbidden
+	case databaseLockedError:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+func writeHttpError(writer http.ResponseWriter, status int, err error) {
+	writer.WriteHeader(status)
+	fmt.Fprintln(writer, errorJson(err))
+}
@@ -0,0 +1,328 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"sort"
+	"strings"
+)
+
+var SnapshotCommand = Command{
+	Name:     "snapshot",
+	Synopsis: "Record and compare the files matching a query over time",
+	Usages: []string{"tmsu snapshot save NAME QUERY",
+		"tmsu snapshot diff [OPTION]... NAME",
+		"tmsu snapshot delete NAME...",
+		"tmsu snapshot [list]"},
+	Description: `Manages snapshots: records, each under the name NAME, of the files that matched a QUERY, and of their tags, at the time the snapshot was saved.
+
+The 'diff' action evaluates the snapshot's query again and reports how its result has since changed: the files that now match but did not (+), those that matched but no longer do (-) and those that match still but whose tags have changed (~), with the tags added and removed. This is of use for tracking the progress of curation over weeks, such as of a query for the files still to be reviewed.
+
+Files are identified by their ID, so a file that has been moved or renamed is not reported as removed and added. Only the explicit tags of the files are compared.
+
+When run without arguments, or with 'list', lists the snapshots with the time each was saved.`,
+	Examples: []string{`$ tmsu snapshot save triage "photo and not reviewed"`,
+		`$ tmsu snapshot diff triage
++ ./beach.jpg
+- ./harbour.jpg
+~ ./sunset.jpg: +holiday -todo`,
+		`$ tmsu snapshot diff --count triage
+Added: 1
+Removed: 1
+Retagged: 1`,
+		`$ tmsu snapshot
+triage: photo and not reviewed (2024-05-01 09:30:00)`,
+		"$ tmsu snapshot delete triage"},
+	Options: Options{{"--count", "-c", "list the number of files added, removed and retagged rather than their names", false, ""}},
+	Exec:    snapshotExec,
+}
+
+// unexported
+
+func snapshotExec(options Options, args []string, databasePath string) (error, warnings) {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:]
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	switch action {
+	case "list":
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		return listSnapshots(store, tx), nil
+	case "save":
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+
+		return saveSnapshot(store, tx, args[0], strings.Join(args[1:], " "))
+	case "diff":
+		switch {
+		case len(args) < 1:
+			return errTooFewArguments, nil
+		case len(args) > 1:
+			return errTooManyArguments, nil
+		}
+
+		return diffSnapshot(store, tx, args[0], options.HasOption("--count"))
+	case "delete":
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+
+		return nil, deleteSnapshots(store, tx, args)
+	}
+
+	return fmt.Errorf("invalid action '%v': expected save, diff, delete or list", action), nil
+}
+
+func listSnapshots(store *storage.Storage, tx *storage.Tx) error {
+	log.Info(2, "retrieving snapshots")
+
+	snapshots, err := store.Snapshots(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve snapshots: %w", err)
+	}
+
+	for _, snapshot := range snapshots {
+		fmt.Printf("%v: %v (%v)\n", snapshot.Name, snapshot.Query, snapshot.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+func saveSnapshot(store *storage.Storage, tx *storage.Tx, name, queryText string) (error, warnings) {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	log.Infof(2, "saving snapshot '%v'", name)
+
+	snapshotFiles, warnings, err := snapshotFilesForQuery(store, tx, queryText)
+	if err != nil {
+		return err, warnings
+	}
+
+	if _, err := store.AddSnapshot(tx, name, queryText, snapshotFiles); err != nil {
+		return fmt.Errorf("could not save snapshot '%v': %w", name, err), warnings
+	}
+
+	return nil, warnings
+}
+
+func diffSnapshot(store *storage.Storage, tx *storage.Tx, name string, showCount bool) (error, warnings) {
+	snapshot, err := store.SnapshotByName(tx, name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve snapshot '%v': %w", name, err), nil
+	}
+	if snapshot == nil {
+		return fmt.Errorf("no such snapshot '%v'", name), nil
+	}
+
+	log.Infof(2, "comparing snapshot '%v'", name)
+
+	earlierFiles, err := store.SnapshotFiles(tx, snapshot.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve the files of snapshot '%v': %w", name, err), nil
+	}
+
+	laterFiles, warnings, err := snapshotFilesForQuery(store, tx, snapshot.Query)
+	if err != nil {
+		return err, warnings
+	}
+
+	changes, err := snapshotChanges(store, tx, earlierFiles, laterFiles)
+	if err != nil {
+		return err, warnings
+	}
+
+	if showCount {
+		counts := make(map[byte]int, 3)
+		for _, change := range changes {
+			counts[change.kind]++
+		}
+
+		fmt.Printf("Added: %v\n", counts['+'])
+		fmt.Printf("Removed: %v\n", counts['-'])
+		fmt.Printf("Retagged: %v\n", counts['~'])
+
+		return nil, warnings
+	}
+
+	for _, change := range changes {
+		path := escapeControl(displayPath(change.path))
+
+		if change.kind == '~' {
+			fmt.Printf("%c %v: %v\n", change.kind, path, strings.Join(change.tags, " "))
+		} else {
+			fmt.Printf("%c %v\n", change.kind, path)
+		}
+	}
+
+	return nil, warnings
+}
+
+func deleteSnapshots(store *storage.Storage, tx *storage.Tx, names []string) warnings {
+	warnings := make(warnings, 0, 10)
+
+	for _, name := range names {
+		log.Infof(2, "deleting snapshot '%v'", name)
+
+		if err := store.DeleteSnapshot(tx, name); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return warnings
+}
+
+// a file whose membership of, or tags within, the result of a snapshot's
+// query has changed: added (+), removed (-) or retagged (~)
+type snapshotChange struct {
+	kind byte
+	path string
+	tags []string // +TAG or -TAG for each tag added or removed
+}
+
+// the files matching the query now, with their explicit tags
+func snapshotFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText string) (entities.SnapshotFiles, warnings, error) {
+	expression, warnings, err := parseCheckedQuery(store, tx, queryText, false, false)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	files, err := store.FilesForQuery(tx, expression, nil, "", false, false, "name", false, 0)
+	if err != nil {
+		return nil, warnings, queryError(err)
+	}
+
+	snapshotFiles := make(entities.SnapshotFiles, len(files))
+	for index, file := range files {
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("could not retrieve file-tags for file '%v': %w", file.Id, err)
+		}
+
+		tags, err := tagNamesForFileTags(store, tx, fileTags, "", nil, false)
+		if err != nil {
+			return nil, warnings, err
+		}
+
+		snapshotFiles[index] = &entities.SnapshotFile{file.Id, file.Path(), tags}
+	}
+
+	return snapshotFiles, warnings, nil
+}
+
+// the changes between the files recorded by a snapshot and those matching its
+// query now, by path
+func snapshotChanges(store *storage.Storage, tx *storage.Tx, earlierFiles, laterFiles entities.SnapshotFiles) ([]snapshotChange, error) {
+	earlierById := make(map[entities.FileId]*entities.SnapshotFile, len(earlierFiles))
+	for _, earlierFile := range earlierFiles {
+		earlierById[earlierFile.FileId] = earlierFile
+	}
+
+	laterById := make(map[entities.FileId]*entities.SnapshotFile, len(laterFiles))
+	for _, laterFile := range laterFiles {
+		laterById[laterFile.FileId] = laterFile
+	}
+
+	changes := make([]snapshotChange, 0, 10)
+
+	for _, laterFile := range laterFiles {
+		earlierFile, ok := earlierById[laterFile.FileId]
+		if !ok {
+			changes = append(changes, snapshotChange{'+', laterFile.Path, nil})
+			continue
+		}
+
+		if tags := tagChanges(earlierFile.Tags, laterFile.Tags); len(tags) > 0 {
+			changes = append(changes, snapshotChange{'~', laterFile.Path, tags})
+		}
+	}
+
+	for _, earlierFile := range earlierFiles {
+		if _, ok := laterById[earlierFile.FileId]; ok {
+			continue
+		}
+
+		// the file may have moved since, or have been removed from the database
+		path := earlierFile.Path
+		file, err := store.File(tx, earlierFile.FileId)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve file '%v': %w", earlierFile.FileId, err)
+		}
+		if file != nil {
+			path = file.Path()
+		}
+
+		changes = append(changes, snapshotChange{'-', path, nil})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+
+	return changes, nil
+}
+
+// the tags added (+TAG) and removed (-TAG) between the earlier and later tags
+func tagChanges(earlierTags, laterTags []string) []string {
+	earlier := make(map[string]bool, len(earlierTags))
+	for _, tag := range earlierTags {
+		earlier[tag] = true
+	}
+
+	later := make(map[string]bool, len(laterTags))
+	for _, tag := range laterTags {
+		later[tag] = true
+	}
+
+	changes := make([]string, 0, 2)
+	for _, tag := range laterTags {
+		if !earlier[tag] {
+			changes = append(changes, "+"+tag)
+		}
+	}
+	for _, tag := range earlierTags {
+		if !later[tag] {
+			changes = append(changes, "-"+tag)
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,185 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/terminal/ansi"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"strconv"
+)
+
+var StatsCommand = Command{
+	Name:     "stats",
+	Synopsis: "Show tag usage statistics",
+	Usages:   []string{"tmsu stats [OPTION]..."},
+	Description: `Shows the size of the database, the number of untagged files beneath the current working directory, the number of files each tag is applied to and the pairs of tags most often applied to the same files.
+
+Tags and pairs of tags are listed most used first. Only the ten most used of each are shown unless --top is specified, a value of zero showing them all.
+
+See the 'info' subcommand for the tag, value and file totals.`,
+	Examples: []string{"$ tmsu stats",
+		"$ tmsu stats --top 3",
+		"$ tmsu stats --format=json"},
+	Options: Options{{"--top", "-t", "show only the N most used tags and pairs of tags", true, ""}},
+	Exec:    statsExec,
+}
+
+// unexported
+
+const defaultStatsTop = 10
+
+func statsExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 0 {
+		return errTooManyArguments, nil
+	}
+
+	var top uint = defaultStatsTop
+	if options.HasOption("--top") {
+		text := options.Get("--top").Argument
+
+		value, err := strconv.ParseUint(text, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid argument '%v' for '--top'", text), nil
+		}
+
+		top = uint(value)
+	}
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err, nil
+	}
+
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	// the size of a PostgreSQL database is not known
+	var databaseSize int64
+	if !storage.IsPostgres(store.DbPath) {
+		stat, err := os.Stat(store.DbPath)
+		if err != nil {
+			return fmt.Errorf("could not determine database size: %w", err), nil
+		}
+
+		databaseSize = stat.Size()
+	}
+
+	paths, err := directoryEntries(".")
+	if err != nil {
+		return err, nil
+	}
+
+	untaggedCount, err := findUntaggedCount(store, tx, paths, 1, untaggedWalk{followSymlinks: true, maxDepth: -1})
+	if err != nil {
+		return err, nil
+	}
+
+	tagUsages, err := store.TopTagUsage(tx, top)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag usage: %w", err), nil
+	}
+
+	pairUsages, err := store.TagPairUsage(tx, top)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag pair usage: %w", err), nil
+	}
+
+	if asJson {
+		return printJsonStats(databaseSize, untaggedCount, tagUsages, pairUsages), nil
+	}
+
+	if !storage.IsPostgres(store.DbPath) {
+		printInfo("Database size", databaseSize, colour)
+	}
+	printInfo("Untagged files", untaggedCount, colour)
+
+	if len(tagUsages) > 0 {
+		names := make([]string, len(tagUsages))
+		counts := make([]uint, len(tagUsages))
+		for index, tagUsage := range tagUsages {
+			names[index] = tagUsage.Name
+			counts[index] = tagUsage.FileCount
+		}
+
+		fmt.Println()
+		fmt.Println("Tags:")
+		printCounts(names, counts, colour)
+	}
+
+	if len(pairUsages) > 0 {
+		names := make([]string, len(pairUsages))
+		counts := make([]uint, len(pairUsages))
+		for index, pairUsage := range pairUsages {
+			names[index] = pairUsage.TagName + ", " + pairUsage.OtherTagName
+			counts[index] = pairUsage.FileCount
+		}
+
+		fmt.Println()
+		fmt.Println("Tag pairs:")
+		printCounts(names, counts, colour)
+	}
+
+	return nil, nil
+}
+
+func printJsonStats(databaseSize int64, untaggedCount uint, tagUsages []entities.TagFileCount, pairUsages []entities.TagPairFileCount) error {
+	stats := jsonStats{databaseSize, untaggedCount, make([]jsonTagFileCount, len(tagUsages)), make([]jsonTagPairFileCount, len(pairUsages))}
+
+	for index, tagUsage := range tagUsages {
+		stats.Tags[index] = jsonTagFileCount{tagUsage.Name, tagUsage.FileCount}
+	}
+
+	for index, pairUsage := range pairUsages {
+		stats.Pairs[index] = jsonTagPairFileCount{[]string{pairUsage.TagName, pairUsage.OtherTagName}, pairUsage.FileCount}
+	}
+
+	return printJson(stats)
+}
+
+func printCounts(names []string, counts []uint, colour bool) {
+	maxLength := 0
+	for _, name := range names {
+		if len(name) > maxLength {
+			maxLength = len(name)
+		}
+	}
+
+	for index, name := range names {
+		count := strconv.FormatUint(uint64(counts[index]), 10)
+		if colour {
+			count = ansi.Yellow(count)
+		}
+
+		fmt.Printf("  %*s %v\n", -maxLength, name, count)
+	}
+}
@@ -23,8 +23,10 @@ import (
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 )
 
 //TODO should return warnings for permission errors
@@ -44,6 +46,8 @@ Where PATHs are not specified the status of the database is shown.
 
 Status codes of T, M and ! mean that the file has been tagged (and thus is in the TMSU database). Modified files are those with a different modification time or size to that in the database. Missing files are those in the database but that no longer exist in the file-system.
 
+Untagged files and directories excluded by a '.tmsuignore' file are not reported, nor are the database and the files kept beside it, such as its write-ahead log ('db-wal'), shared memory index ('db-shm') and lock. See the 'tag' subcommand for more information.
+
 Note: The 'repair' subcommand can be used to fix problems caused by files that have been modified or moved on disk.`,
 	Examples: []string{"$ tmsu status",
 		"$ tmsu status .",
@@ -62,22 +66,33 @@ const (
 	MISSING  Status = '!'
 )
 
+func (status Status) String() string {
+	switch status {
+	case UNTAGGED:
+		return "untagged"
+	case TAGGED:
+		return "tagged"
+	case MODIFIED:
+		return "modified"
+	case MISSING:
+		return "missing"
+	default:
+		return string(status)
+	}
+}
+
 type StatusReport struct {
-	Rows []Row
+	Rows  []Row
+	paths map[string]bool
 }
 
 func (report *StatusReport) AddRow(row Row) {
 	report.Rows = append(report.Rows, row)
+	report.paths[row.Path] = true
 }
 
 func (report *StatusReport) ContainsRow(path string) bool {
-	for _, row := range report.Rows {
-		if row.Path == path {
-			return true
-		}
-	}
-
-	return false
+	return report.paths[path]
 }
 
 type Row struct {
@@ -86,14 +101,21 @@ type Row struct {
 }
 
 func NewReport() *StatusReport {
-	return &StatusReport{make([]Row, 0, 10)}
+	return &StatusReport{make([]Row, 0, 10), make(map[string]bool, 10)}
 }
 
 // unexported
 
 func statusExec(options Options, args []string, databasePath string) (error, warnings) {
 	dirOnly := options.HasOption("--directory")
-	followSymlinks := !options.HasOption("--no-dereference")
+	format, err := newFormatter(options)
+	if err != nil {
+		return err, nil
+	}
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -101,6 +123,11 @@ func statusExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer store.Close()
 
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
@@ -121,7 +148,11 @@ func statusExec(options Options, args []string, databasePath string) (error, war
 		}
 	}
 
-	printReport(report)
+	if asJson {
+		return printReportAsJson(report), nil
+	}
+
+	printReport(report, format)
 
 	return nil, nil
 }
@@ -133,7 +164,7 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymli
 
 	files, err := store.Files(tx, "name")
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve files: %v", err)
+		return nil, fmt.Errorf("could not retrieve files: %w", err)
 	}
 
 	err = statusCheckFiles(files, report)
@@ -152,7 +183,7 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymli
 	}
 
 	for _, path := range topLevelPaths {
-		if err = findNewFiles(path, report, dirOnly, followSymlinks); err != nil {
+		if err = findNewFiles(store, path, report, dirOnly, followSymlinks); err != nil {
 			return nil, err
 		}
 	}
@@ -163,10 +194,14 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, followSymli
 func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly, followSymlinks bool) (*StatusReport, error) {
 	report := NewReport()
 
-	for _, path := range paths {
+	absPaths := make([]string, len(paths))
+	resolvedPaths := make([]string, len(paths))
+	stats := make([]os.FileInfo, len(paths))
+
+	for index, path := range paths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
-			return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+			return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
 		}
 
 		log.Infof(2, "%v: resolving file", path)
@@ -179,21 +214,36 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 			case os.IsNotExist(err), os.IsPermission(err):
 				stat = emptyStat{}
 			default:
-				return nil, fmt.Errorf("%v: could not stat path: %v", path, err)
+				return nil, fmt.Errorf("%v: could not stat path: %w", path, err)
 			}
 		} else if stat.Mode()&os.ModeSymlink != 0 {
 			resolvedPath, err = _path.Dereference(absPath)
 			if err != nil {
-				return nil, fmt.Errorf("%v: could not dereference symbolic link: %v", path, err)
+				return nil, fmt.Errorf("%v: could not dereference symbolic link: %w", path, err)
 			}
 		}
 
-		log.Infof(2, "%v: checking file in database", path)
+		absPaths[index] = absPath
+		resolvedPaths[index] = resolvedPath
+		stats[index] = stat
+	}
 
-		file, err := store.FileByPath(tx, resolvedPath)
-		if err != nil {
-			return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
-		}
+	log.Info(2, "checking files in database")
+
+	files, err := store.FilesByPaths(tx, resolvedPaths)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %w", err)
+	}
+
+	filesByPath := make(map[string]*entities.File, len(files))
+	for _, file := range files {
+		filesByPath[file.Path()] = file
+	}
+
+	for index, path := range paths {
+		absPath, resolvedPath, stat := absPaths[index], resolvedPaths[index], stats[index]
+
+		file := filesByPath[resolvedPath]
 		if file != nil {
 			err = statusCheckFile(absPath, file, report)
 			if err != nil {
@@ -201,12 +251,15 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 			}
 		}
 
-		if !dirOnly && (stat.Mode()&os.ModeSymlink == 0 || followSymlinks) {
+		// only a directory, or one that has since gone, can have files beneath it
+		mayHaveDescendants := !stat.Mode().IsRegular() || (file != nil && file.IsDir)
+
+		if !dirOnly && mayHaveDescendants && (stat.Mode()&os.ModeSymlink == 0 || followSymlinks) {
 			log.Infof(2, "%v: retrieving files from database.", path)
 
 			files, err := store.FilesByDirectory(tx, resolvedPath)
 			if err != nil {
-				return nil, fmt.Errorf("%v: could not retrieve files for directory: %v", path, err)
+				return nil, fmt.Errorf("%v: could not retrieve files for directory: %w", path, err)
 			}
 
 			err = statusCheckFiles(files, report)
@@ -215,7 +268,7 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 			}
 		}
 
-		err = findNewFiles(absPath, report, dirOnly, followSymlinks)
+		err = findNewFiles(store, absPath, report, dirOnly, followSymlinks)
 		if err != nil {
 			return nil, err
 		}
@@ -224,9 +277,36 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 	return report, nil
 }
 
+// checks the files concurrently, as the time taken is dominated by waiting upon
+// the file-system, adding the rows to the report in the order of the files
 func statusCheckFiles(files entities.Files, report *StatusReport) error {
-	for _, file := range files {
-		if err := statusCheckFile(file.Path(), file, report); err != nil {
+	stats := make([]os.FileInfo, len(files))
+	errs := make([]error, len(files))
+
+	indices := make(chan int, statWorkerCount)
+	var waitGroup sync.WaitGroup
+
+	for worker := 0; worker < statWorkerCount; worker++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for index := range indices {
+				stats[index], errs[index] = os.Stat(files[index].Path())
+			}
+		}()
+	}
+
+	for index := range files {
+		indices <- index
+	}
+	close(indices)
+
+	waitGroup.Wait()
+
+	for index, file := range files {
+		if err := statusReportFile(file.Path(), file, stats[index], errs[index], report); err != nil {
 			return err
 		}
 	}
@@ -234,10 +314,17 @@ func statusCheckFiles(files entities.Files, report *StatusReport) error {
 	return nil
 }
 
+var statWorkerCount = 4 * runtime.NumCPU()
+
 func statusCheckFile(absPath string, file *entities.File, report *StatusReport) error {
+	stat, err := os.Stat(file.Path())
+
+	return statusReportFile(absPath, file, stat, err, report)
+}
+
+func statusReportFile(absPath string, file *entities.File, stat os.FileInfo, err error, report *StatusReport) error {
 	log.Infof(2, "%v: checking file status.", absPath)
 
-	stat, err := os.Stat(file.Path())
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
@@ -251,7 +338,7 @@ func statusCheckFile(absPath string, file *entities.File, report *StatusReport)
 			report.AddRow(Row{file.Path(), MISSING})
 			return nil
 		default:
-			return fmt.Errorf("%v: could not stat: %v", file.Path(), err)
+			return fmt.Errorf("%v: could not stat: %w", file.Path(), err)
 		}
 	} else {
 		if stat.Size() != file.Size || !stat.ModTime().UTC().Equal(file.ModTime) {
@@ -268,19 +355,28 @@ func statusCheckFile(absPath string, file *entities.File, report *StatusReport)
 	return nil
 }
 
-func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlinks bool) error {
+func findNewFiles(store *storage.Storage, searchPath string, report *StatusReport, dirOnly, followSymlinks bool) error {
 	log.Infof(2, "%v: finding new files.", searchPath)
 
 	absPath, err := filepath.Abs(searchPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not get absolute path: %v", searchPath, err)
+		return fmt.Errorf("%v: could not get absolute path: %w", searchPath, err)
+	}
+
+	if store.IsDatabaseFile(absPath) {
+		return nil
 	}
 
 	if !report.ContainsRow(absPath) {
 		report.AddRow(Row{absPath, UNTAGGED})
 	}
 
-	stat, err := os.Stat(absPath)
+	stat := os.Stat
+	if !followSymlinks {
+		stat = os.Lstat
+	}
+
+	info, err := stat(absPath)
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
@@ -289,27 +385,67 @@ func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlin
 			log.Warnf("%v: permission denied.", searchPath)
 			return nil
 		default:
-			return fmt.Errorf("%v: could not stat: %v", searchPath, err)
+			return fmt.Errorf("%v: could not stat: %w", searchPath, err)
 		}
 	}
 
-	if !dirOnly && stat.IsDir() {
-		dir, err := os.Open(absPath)
-		if err != nil {
-			return fmt.Errorf("%v: could not open file: %v", searchPath, err)
+	if !dirOnly && info.IsDir() {
+		return findNewDirectoryEntries(store, absPath, report, followSymlinks)
+	}
+
+	return nil
+}
+
+// uses the file information read with the directory listing so that only
+// symbolic links need to be stat'ed individually
+func findNewDirectoryEntries(store *storage.Storage, dirPath string, report *StatusReport, followSymlinks bool) error {
+	log.Infof(2, "%v: finding new files.", dirPath)
+
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not open file: %w", dirPath, err)
+	}
+
+	entries, err := dir.Readdir(0)
+	dir.Close()
+	if err != nil {
+		return fmt.Errorf("%v: could not read directory listing: %w", dirPath, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+
+		if isIgnored(entryPath, entry.IsDir()) || store.IsDatabaseFile(entryPath) {
+			continue
 		}
 
-		dirNames, err := dir.Readdirnames(0)
-		if err != nil {
-			return fmt.Errorf("%v: could not read directory listing: %v", searchPath, err)
+		if !report.ContainsRow(entryPath) {
+			report.AddRow(Row{entryPath, UNTAGGED})
 		}
 
-		sort.Strings(dirNames)
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if !followSymlinks {
+				continue
+			}
 
-		for _, dirName := range dirNames {
-			dirPath := filepath.Join(absPath, dirName)
-			err = findNewFiles(dirPath, report, dirOnly, followSymlinks)
+			entry, err = os.Stat(entryPath)
 			if err != nil {
+				switch {
+				case os.IsNotExist(err):
+					continue
+				case os.IsPermission(err):
+					log.Warnf("%v: permission denied.", entryPath)
+					continue
+				default:
+					return fmt.Errorf("%v: could not stat: %w", entryPath, err)
+				}
+			}
+		}
+
+		if entry.IsDir() {
+			if err := findNewDirectoryEntries(store, entryPath, report, followSymlinks); err != nil {
 				return err
 			}
 		}
@@ -318,22 +454,36 @@ func findNewFiles(searchPath string, report *StatusReport, dirOnly, followSymlin
 	return nil
 }
 
-func printReport(report *StatusReport) {
-	printRows(report.Rows, TAGGED)
-	printRows(report.Rows, MODIFIED)
-	printRows(report.Rows, MISSING)
-	printRows(report.Rows, UNTAGGED)
+func printReport(report *StatusReport, format *formatter) {
+	printRows(report.Rows, TAGGED, format)
+	printRows(report.Rows, MODIFIED, format)
+	printRows(report.Rows, MISSING, format)
+	printRows(report.Rows, UNTAGGED, format)
+}
+
+func printReportAsJson(report *StatusReport) error {
+	rows := make([]jsonStatus, 0, len(report.Rows))
+
+	for _, status := range []Status{TAGGED, MODIFIED, MISSING, UNTAGGED} {
+		for _, row := range report.Rows {
+			if row.Status == status {
+				rows = append(rows, jsonStatus{displayPath(row.Path), status.String()})
+			}
+		}
+	}
+
+	return printJson(rows)
 }
 
-func printRows(rows []Row, status Status) {
+func printRows(rows []Row, status Status, format *formatter) {
 	for _, row := range rows {
 		if row.Status == status {
-			printRow(row)
+			printRow(row, format)
 		}
 	}
 }
 
-func printRow(row Row) {
-	relPath := _path.Rel(row.Path)
-	fmt.Printf("%v %v\n", string(row.Status), relPath)
+func printRow(row Row, format *formatter) {
+	relPath := displayPath(row.Path)
+	fmt.Printf("%v %v\n", format.status(row.Status), escapeControl(relPath))
 }
@@ -0,0 +1,447 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var SyncCommand = Command{
+	Name:     "sync",
+	Synopsis: "Synchronize tags with another database",
+	Usages:   []string{"tmsu sync [OPTION]... OTHER_DB"},
+	Description: `Merges the tags of the database with those of the database at OTHER_DB, such as one on a laptop with another on a NAS, so that afterwards the files in each have the same tags. Each change made is reported.
+
+Files are matched by fingerprint and otherwise by their paths relative to the roots of the databases, so the databases should use the same fingerprint algorithm. A file tagged in only one of the databases is added to the other at the same relative path.
+
+Where a tag is applied to a file in only one of the databases the times at which the tags were applied and the time of the previous synchronization of the two databases decide which change wins: a tag applied since the previous synchronization is added to the other database, whereas one applied before it must since have been removed from the other database and so is removed. When the databases have not been synchronized before, or when synchronized from the other database, tags are only ever added. Tags keep the times at which, and the users by whom, they were originally applied.
+
+Only the tags applied to files are synchronized. Use the 'export' and 'import' subcommands to copy implications, aliases and settings.`,
+	Examples: []string{"$ tmsu sync /mnt/nas/.tmsu/db\n./holiday.jpg: tagged beach in /mnt/nas/.tmsu/db\n./draft.txt: untagged todo in /home/alice/.tmsu/db",
+		"$ tmsu sync --pretend /mnt/nas/.tmsu/db"},
+	Options: Options{{"--pretend", "-P", "report the changes without making them", false, ""}},
+	Exec:    syncExec,
+}
+
+// unexported
+
+// one of the databases being synchronized
+type syncSide struct {
+	store      *storage.Storage
+	tx         *storage.Tx
+	name       string
+	tagNames   map[entities.TagId]string
+	valueNames map[entities.ValueId]string
+}
+
+// a file as recorded in each of the databases being synchronized, either of
+// which is nil where the file is recorded in only the other, with its path
+// relative to the root of each, which is the same where it is recorded in only one
+type syncPair struct {
+	paths [2]string
+	files [2]*entities.File
+}
+
+func syncExec(options Options, args []string, databasePath string) (error, warnings) {
+	switch {
+	case len(args) < 1:
+		return errTooFewArguments, nil
+	case len(args) > 1:
+		return errTooManyArguments, nil
+	}
+
+	if os.Getenv("TMSU_REMOTE") != "" {
+		return fmt.Errorf("a remote database cannot be synchronized"), nil
+	}
+	if storage.IsPostgres(databasePath) || storage.IsPostgres(args[0]) {
+		return fmt.Errorf("a PostgreSQL database cannot be synchronized"), nil
+	}
+
+	pretend := options.HasOption("--pretend")
+
+	otherPath, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", args[0], err), nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	localPath, err := filepath.Abs(store.DbPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", store.DbPath, err), nil
+	}
+	if localPath == otherPath {
+		return fmt.Errorf("cannot synchronize a database with itself"), nil
+	}
+
+	otherStore, err := openLocalDatabase(otherPath, readOnly)
+	if err != nil {
+		return fmt.Errorf("%v: %w", otherPath, err), nil
+	}
+	defer otherStore.Close()
+
+	sides := [2]*syncSide{{store: store, name: localPath}, {store: otherStore, name: otherPath}}
+	for _, side := range sides {
+		tx, err := side.store.Begin()
+		if err != nil {
+			rollbackSync(sides)
+			return err, nil
+		}
+		side.tx = tx
+
+		if !pretend {
+			if err := backupBeforeChange(side.store, side.tx); err != nil {
+				rollbackSync(sides)
+				return err, nil
+			}
+		}
+
+		if err := beginOperation(side.store, side.tx); err != nil {
+			rollbackSync(sides)
+			return err, nil
+		}
+	}
+
+	if err := syncDatabases(sides, pretend); err != nil {
+		rollbackSync(sides)
+		return err, nil
+	}
+
+	if pretend {
+		rollbackSync(sides)
+		return nil, nil
+	}
+
+	now := time.Now()
+	for index, side := range sides {
+		peer := sides[1-index].name
+		if err := side.store.UpdateSyncTime(side.tx, peer, now); err != nil {
+			rollbackSync(sides)
+			return fmt.Errorf("could not record synchronization: %w", err), nil
+		}
+	}
+
+	for _, side := range sides {
+		if err := side.tx.Commit(); err != nil {
+			return err, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func rollbackSync(sides [2]*syncSide) {
+	for _, side := range sides {
+		if side.tx != nil {
+			side.tx.Rollback()
+		}
+	}
+}
+
+func syncDatabases(sides [2]*syncSide, pretend bool) error {
+	// a tag applied no later than the previous synchronization was present in
+	// both databases then, so if it is missing from one it has been removed;
+	// the earlier of the recorded times errs towards keeping tags
+	var lastSync time.Time
+	for index, side := range sides {
+		syncTime, err := side.store.LastSyncTime(side.tx, sides[1-index].name)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve previous synchronization: %w", side.name, err)
+		}
+
+		if index == 0 || syncTime.Before(lastSync) {
+			lastSync = syncTime
+		}
+	}
+
+	if lastSync.IsZero() {
+		log.Info(2, "databases have not been synchronized before")
+	} else {
+		log.Infof(2, "databases were last synchronized at %v", lastSync)
+	}
+
+	files := [2]entities.Files{}
+	for index, side := range sides {
+		if err := side.loadNames(); err != nil {
+			return err
+		}
+
+		sideFiles, err := side.store.Files(side.tx, "name")
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve files: %w", side.name, err)
+		}
+		files[index] = sideFiles
+	}
+
+	for _, pair := range pairSyncFiles(sides, files) {
+		if err := syncFile(sides, pair, lastSync, pretend); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (side *syncSide) loadNames() error {
+	tags, err := side.store.Tags(side.tx)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve tags: %w", side.name, err)
+	}
+
+	side.tagNames = make(map[entities.TagId]string, len(tags))
+	for _, tag := range tags {
+		side.tagNames[tag.Id] = tag.Name
+	}
+
+	values, err := side.store.Values(side.tx)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve values: %w", side.name, err)
+	}
+
+	side.valueNames = make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		side.valueNames[value.Id] = value.Name
+	}
+
+	return nil
+}
+
+// pairs the files of the two databases: first those with the same path and
+// fingerprint, then those with the same fingerprint and lastly those with the
+// same path, which may have been modified since they were tagged
+func pairSyncFiles(sides [2]*syncSide, files [2]entities.Files) []syncPair {
+	relPath := func(index int, file *entities.File) string {
+		return _path.RelTo(file.Path(), sides[index].store.RootPath)
+	}
+
+	byPath := make(map[string]*entities.File, len(files[1]))
+	byFingerprint := make(map[string]entities.Files, len(files[1]))
+	for _, file := range files[1] {
+		byPath[relPath(1, file)] = file
+		if file.Fingerprint != "" {
+			byFingerprint[string(file.Fingerprint)] = append(byFingerprint[string(file.Fingerprint)], file)
+		}
+	}
+
+	paired := make(map[entities.FileId]*entities.File, len(files[0]))
+	pairedOther := make(map[entities.FileId]bool, len(files[1]))
+	pair := func(file, other *entities.File) {
+		paired[file.Id] = other
+		pairedOther[other.Id] = true
+	}
+
+	for _, file := range files[0] {
+		if other := byPath[relPath(0, file)]; other != nil && other.Fingerprint == file.Fingerprint {
+			pair(file, other)
+		}
+	}
+
+	for _, file := range files[0] {
+		if paired[file.Id] != nil || file.Fingerprint == "" {
+			continue
+		}
+
+		for _, other := range byFingerprint[string(file.Fingerprint)] {
+			if !pairedOther[other.Id] {
+				pair(file, other)
+				break
+			}
+		}
+	}
+
+	for _, file := range files[0] {
+		if other := byPath[relPath(0, file)]; paired[file.Id] == nil && other != nil && !pairedOther[other.Id] {
+			pair(file, other)
+		}
+	}
+
+	pairs := make([]syncPair, 0, len(files[0])+len(files[1]))
+	for _, file := range files[0] {
+		path := relPath(0, file)
+		otherPath := path
+		if other := paired[file.Id]; other != nil {
+			otherPath = relPath(1, other)
+		}
+
+		pairs = append(pairs, syncPair{[2]string{path, otherPath}, [2]*entities.File{file, paired[file.Id]}})
+	}
+	for _, other := range files[1] {
+		if !pairedOther[other.Id] {
+			path := relPath(1, other)
+			pairs = append(pairs, syncPair{[2]string{path, path}, [2]*entities.File{nil, other}})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].paths[0] < pairs[j].paths[0] })
+
+	return pairs
+}
+
+// reconciles the tags of a file between the databases
+func syncFile(sides [2]*syncSide, pair syncPair, lastSync time.Time, pretend bool) error {
+	tags := [2]map[exportTag]*entities.FileTag{}
+	for index, side := range sides {
+		tags[index] = make(map[exportTag]*entities.FileTag)
+
+		file := pair.files[index]
+		if file == nil {
+			continue
+		}
+
+		fileTags, err := side.store.FileTagsByFileId(side.tx, file.Id, true)
+		if err != nil {
+			return fmt.Errorf("%v: %v: could not retrieve file tags: %w", side.name, pair.paths[index], err)
+		}
+
+		for _, fileTag := range fileTags {
+			tags[index][exportTag{side.tagNames[fileTag.TagId], side.valueNames[fileTag.ValueId]}] = fileTag
+		}
+	}
+
+	// tags are added before any are removed so that a file is not deleted for
+	// want of tags whilst it is still to be tagged
+	for index := range sides {
+		for _, key := range missingSyncTags(tags[index], tags[1-index]) {
+			fileTag := tags[index][key]
+			if !lastSync.IsZero() && !fileTag.Applied.After(lastSync) {
+				continue
+			}
+
+			other := sides[1-index]
+			fmt.Printf("%v: tagged %v in %v\n", pair.paths[1-index], formatTagValueName(key.Name, key.Value, false, false, false), other.name)
+
+			if pretend {
+				continue
+			}
+
+			file, err := other.syncedFile(pair.paths[1-index], pair.files[index], pair.files[1-index])
+			if err != nil {
+				return err
+			}
+			pair.files[1-index] = file
+
+			if err := other.tagSynced(pair.paths[1-index], file, key, fileTag); err != nil {
+				return err
+			}
+		}
+	}
+
+	for index, side := range sides {
+		for _, key := range missingSyncTags(tags[index], tags[1-index]) {
+			fileTag := tags[index][key]
+			if lastSync.IsZero() || fileTag.Applied.After(lastSync) {
+				continue
+			}
+
+			fmt.Printf("%v: untagged %v in %v\n", pair.paths[index], formatTagValueName(key.Name, key.Value, false, false, false), side.name)
+
+			if pretend {
+				continue
+			}
+
+			if err := side.untagSynced(pair.paths[index], fileTag); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// the tags of one database missing from the other, in name order
+func missingSyncTags(tags, otherTags map[exportTag]*entities.FileTag) []exportTag {
+	keys := make([]exportTag, 0, len(tags))
+	for key := range tags {
+		if _, ok := otherTags[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+
+		return keys[i].Value < keys[j].Value
+	})
+
+	return keys
+}
+
+// the file to tag, which is added at the same relative path as the source
+// file if not already in the database
+func (side *syncSide) syncedFile(path string, source, file *entities.File) (*entities.File, error) {
+	if file != nil {
+		return file, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(side.store.RootPath, path)
+	}
+
+	file, err := side.store.FileByPath(side.tx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v: could not retrieve file: %w", side.name, path, err)
+	}
+	if file != nil {
+		return file, nil
+	}
+
+	log.Infof(2, "%v: %v: adding file", side.name, path)
+
+	file, err = side.store.AddFile(side.tx, path, source.Fingerprint, source.ModTime, source.Size, source.IsDir, source.MimeType)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v: could not add file: %w", side.name, path, err)
+	}
+
+	return file, nil
+}
+
+func (side *syncSide) tagSynced(path string, file *entities.File, key exportTag, source *entities.FileTag) error {
+	pair, err := importTagValuePair(side.store, side.tx, key.Name, key.Value)
+	if err != nil {
+		return fmt.Errorf("%v: %v: %w", side.name, path, err)
+	}
+
+	if _, err := side.store.AddFileTagAsApplied(side.tx, file.Id, pair.TagId, pair.ValueId, source.Applied, source.AppliedBy); err != nil {
+		return fmt.Errorf("%v: %v: could not apply tag: %w", side.name, path, err)
+	}
+
+	return nil
+}
+
+func (side *syncSide) untagSynced(path string, fileTag *entities.FileTag) error {
+	if err := side.store.DeleteFileTag(side.tx, fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
+		// the tag may already have been removed along with another file's content
+		if _, ok := err.(storage.FileTagDoesNotExist); !ok {
+			return fmt.Errorf("%v: %v: could not remove tag: %w", side.name, path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/xattr"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+)
+
+var SyncXattrCommand = Command{
+	Name:     "sync-xattr",
+	Synopsis: "Synchronize tags with extended attributes",
+	Usages:   []string{"tmsu sync-xattr [OPTION]... [FILE]..."},
+	Description: `Synchronizes the tags of each FILE with its '` + xattr.TagsName + `' extended attribute, as used by GNOME Files and other tools following the freedesktop.org conventions, or those of every file in the database if no FILE is specified.
+
+By default the synchronization is in both directions: tags listed in the attribute but not applied to the file are applied, creating the tags and values subject to the 'autoCreateTags' and 'autoCreateValues' settings, and the file's explicit tags are added to the attribute. Files not yet in the database are added if their attribute lists any tags. Tags removed from one side are therefore restored from the other: use --from-xattr to make the database match the attributes, removing tags not listed, or --to-xattr to overwrite the attributes with the tags of the database.
+
+The attribute holds a comma-separated list of tags, each as TAG or TAG=VALUE. Commas and equals signs within names are escaped with a backslash. Extended attributes are supported only on Linux and only on file systems that allow user attributes.`,
+	Examples: []string{"$ tmsu sync-xattr",
+		"$ tmsu sync-xattr --recursive ~/photos",
+		"$ tmsu sync-xattr --to-xattr report.pdf"},
+	Options: Options{{"--from-xattr", "", "make the tags match the attributes", false, ""},
+		{"--to-xattr", "", "make the attributes match the tags", false, ""},
+		{"--recursive", "-r", "recursively synchronize directory contents", false, ""},
+		{"--include-hidden", "-H", "don't skip hidden files/directories when synchronizing recursively", false, ""}},
+	Exec: syncXattrExec,
+}
+
+// unexported
+
+type xattrSyncDirection int
+
+const (
+	syncBoth xattrSyncDirection = iota
+	syncFromXattr
+	syncToXattr
+)
+
+type xattrSync struct {
+	store          *storage.Storage
+	tx             *storage.Tx
+	settings       entities.Settings
+	direction      xattrSyncDirection
+	includeHidden  bool
+	followSymlinks bool
+	fingerprints   *fingerprint.Pool
+	warnings       warnings
+}
+
+func syncXattrExec(options Options, args []string, databasePath string) (error, warnings) {
+	direction := syncBoth
+	switch {
+	case options.HasOption("--from-xattr") && options.HasOption("--to-xattr"):
+		return fmt.Errorf("--from-xattr and --to-xattr cannot be combined"), nil
+	case options.HasOption("--from-xattr"):
+		direction = syncFromXattr
+	case options.HasOption("--to-xattr"):
+		direction = syncToXattr
+	}
+
+	recursive := options.HasOption("--recursive")
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err, nil
+	}
+
+	sync := &xattrSync{store, tx, settings, direction, options.HasOption("--include-hidden"), followSymlinks, newFingerprintPool(settings, 1), make(warnings, 0, 10)}
+
+	paths := args
+	if len(paths) == 0 {
+		files, err := store.Files(tx, "name")
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %w", err), nil
+		}
+
+		paths = make([]string, len(files))
+		for index, file := range files {
+			paths[index] = file.Path()
+		}
+	}
+
+	for _, path := range paths {
+		if err := sync.path(path, recursive); err != nil {
+			return err, sync.warnings
+		}
+	}
+
+	return nil, sync.warnings
+}
+
+func (sync *xattrSync) path(path string, recursive bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		return sync.warn(path, err)
+	}
+
+	if stat.Mode()&os.ModeSymlink != 0 {
+		if !sync.followSymlinks {
+			log.Infof(2, "%v: skipping symbolic link", path)
+			return nil
+		}
+
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return sync.warn(path, err)
+		}
+
+		stat, err = os.Stat(absPath)
+		if err != nil {
+			return sync.warn(path, err)
+		}
+	}
+
+	if err := sync.file(path, absPath); err != nil {
+		return err
+	}
+
+	if recursive && stat.IsDir() {
+		dir, err := os.Open(absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not open path: %w", path, err)
+		}
+
+		childNames, err := dir.Readdirnames(0)
+		dir.Close()
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve directory contents: %w", path, err)
+		}
+
+		for _, childName := range childNames {
+			childPath := filepath.Join(absPath, childName)
+			if !sync.includeHidden && _path.IsHidden(childPath) {
+				log.Infof(2, "%v: skipping hidden file/directory", childPath)
+				continue
+			}
+
+			if err := sync.path(childPath, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (sync *xattrSync) file(path, absPath string) error {
+	log.Infof(2, "%v: synchronizing tags with extended attribute", path)
+
+	attribute, err := xattr.Get(absPath, xattr.TagsName)
+	if err != nil {
+		return sync.warn(path, err)
+	}
+	items := xattr.ParseList(attribute)
+
+	file, err := sync.store.FileByPath(sync.tx, absPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+
+	var filePairs entities.TagIdValueIdPairs
+	if file != nil {
+		fileTags, err := sync.store.FileTagsByFileId(sync.tx, file.Id, true)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve tags: %w", path, err)
+		}
+
+		filePairs = fileTags.ToTagIdValueIdPairs()
+	}
+
+	var attributePairs entities.TagIdValueIdPairs
+	if sync.direction != syncToXattr {
+		attributePairs, sync.warnings, err = parseTagValuePairs(sync.store, sync.tx, sync.settings, items, sync.warnings)
+		if err != nil {
+			return err
+		}
+
+		if err := sync.applyPairs(path, absPath, file, filePairs, attributePairs); err != nil {
+			return err
+		}
+	}
+
+	if sync.direction == syncFromXattr {
+		return nil
+	}
+
+	if sync.direction == syncToXattr {
+		items = nil
+	}
+
+	for _, pair := range filePairs {
+		if sync.direction == syncBoth && attributePairs.Contains(pair) {
+			continue
+		}
+
+		item, err := sync.attributeItem(pair)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, item)
+	}
+
+	newAttribute := xattr.FormatList(items)
+	if newAttribute == attribute {
+		return nil
+	}
+
+	log.Infof(2, "%v: updating extended attribute", path)
+
+	if newAttribute == "" {
+		err = xattr.Remove(absPath, xattr.TagsName)
+	} else {
+		err = xattr.Set(absPath, xattr.TagsName, newAttribute)
+	}
+	if err != nil {
+		return sync.warn(path, err)
+	}
+
+	return nil
+}
+
+// applies the attribute's tags missing from the file and, when synchronizing
+// from the attributes, removes those the attribute does not list
+func (sync *xattrSync) applyPairs(path, absPath string, file *entities.File, filePairs, attributePairs entities.TagIdValueIdPairs) error {
+	missingPairs := make(entities.TagIdValueIdPairs, 0, len(attributePairs))
+	for _, pair := range attributePairs {
+		if !filePairs.Contains(pair) && !missingPairs.Contains(pair) {
+			missingPairs = append(missingPairs, pair)
+		}
+	}
+
+	if len(missingPairs) > 0 {
+		if file == nil {
+			if err := tagPath(sync.store, sync.tx, absPath, missingPairs, true, false, true, false, false, false, sync.fingerprints, sync.settings.ReportDuplicates(), nil, nil, nil); err != nil {
+				return sync.warn(path, err)
+			}
+		} else {
+			for _, pair := range missingPairs {
+				if _, err := sync.store.AddFileTag(sync.tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+					return fmt.Errorf("%v: could not apply tags: %w", path, err)
+				}
+			}
+		}
+	}
+
+	if sync.direction == syncFromXattr && file != nil {
+		for _, pair := range filePairs {
+			if attributePairs.Contains(pair) {
+				continue
+			}
+
+			if err := sync.store.DeleteFileTag(sync.tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+				return fmt.Errorf("%v: could not remove tags: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// formats the tag and value as an item of the attribute
+func (sync *xattrSync) attributeItem(pair entities.TagIdValueIdPair) (string, error) {
+	tag, err := sync.store.Tag(sync.tx, pair.TagId)
+	if err != nil {
+		return "", err
+	}
+	if tag == nil {
+		return "", fmt.Errorf("no such tag #%v", pair.TagId)
+	}
+
+	item := escape(tag.Name, '\\', ',', '=')
+
+	if pair.ValueId != 0 {
+		value, err := sync.store.Value(sync.tx, pair.ValueId)
+		if err != nil {
+			return "", err
+		}
+		if value == nil {
+			return "", fmt.Errorf("no such value #%v", pair.ValueId)
+		}
+
+		item += "=" + escape(value.Name, '\\', ',')
+	}
+
+	return item, nil
+}
+
+// records a warning for a file that cannot be synchronized
+func (sync *xattrSync) warn(path string, err error) error {
+	switch {
+	case os.IsPermission(err):
+		sync.warnings = append(sync.warnings, PermissionDeniedError{path})
+	case os.IsNotExist(err):
+		sync.warnings = append(sync.warnings, NoSuchFileError{path})
+	default:
+		sync.warnings = append(sync.warnings, fmt.Errorf("%v: could not synchronize extended attribute: %w", path, err))
+	}
+
+	return nil
+}
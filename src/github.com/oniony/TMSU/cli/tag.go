@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/mimetype"
 	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/progress"
 	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
@@ -28,6 +30,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var TagCommand = Command{
@@ -37,34 +40,72 @@ var TagCommand = Command{
 		`tmsu tag [OPTION]... --tags="TAG[=VALUE]..." FILE...`,
 		"tmsu tag [OPTION]... --from=SOURCE FILE...",
 		"tmsu tag [OPTION]... --where=QUERY TAG[=VALUE]...",
+		"tmsu tag [OPTION]... --extract-metadata FILE [TAG[=VALUE]...]",
 		"tmsu tag [OPTION]... --create {TAG|=VALUE}...",
-		"tmsu tag [OPTION[... -"},
+		"tmsu tag [OPTION[... -",
+		"tmsu tag [OPTION]... --null-stdin TAG[=VALUE]...",
+		"tmsu tag [OPTION]... --batch",
+		"tmsu tag [OPTION]... --from-file=MANIFEST"},
 	Description: `Tags the file FILE with the TAGs and VALUEs specified.
 
-Optionally tags applied to files may be attributed with a VALUE using the TAG=VALUE syntax.
+Optionally tags applied to files may be attributed with a VALUE using the TAG=VALUE syntax. A tag may be applied to the same file several times with different values, e.g. 'author=alice author=bob', and a query for any one of those values will match the file.
 
 Tag and value names may consist of one or more letter, number, punctuation and symbol characters (from the corresponding Unicode categories). Tag names cannot contain the slash '/' or backslash '\' characters.
 
+Before tagging recursively, TMSU checks that no more files would be tagged than the 'recursiveTagLimit' setting permits, 10000 by default, and that no directory beneath the paths lies on a different file system, such as a mounted backup drive, and otherwise refuses to tag any. --force overrides both checks, whilst with --one-file-system directories on other file systems are tagged without their contents, as with 'find -xdev'.
+
+When tagging recursively, files and directories excluded by a '.tmsuignore' file in their directory or any directory above are skipped. These files list patterns in the syntax of '.gitignore' files: for example '*.tmp' excludes temporary files at any depth, 'build/' excludes directories named 'build' and '!keep.tmp' re-includes a file excluded by an earlier pattern.
+
+When --where is specified the TAGs are applied to every file matching QUERY (see the 'files' subcommand for the query syntax) within a single transaction. With --pretend each tag that would be applied is listed rather than applied and no tags or values are created. Files already explicitly tagged with a TAG are not listed.
+
+The tags of any rule that a file satisfies are applied alongside those specified. See the 'rule' subcommand for more information.
+
+When --extract-metadata is specified, tags are also applied from the metadata of the files according to their MIME type: the camera model, lens and year of JPEG and TIFF photographs from their EXIF data, e.g. 'camera=X100' and 'year=2019', and the artist, album, year and genre of MP3 files from their ID3 tags.
+
+When --suggest is specified, up to five further tags are suggested once the files have been tagged: those most often applied to the other files with any of the tags just applied, together with the number of such files. Tags already applied to the files tagged are not suggested. The suggestions are listed on standard output in the form 'TAG (COUNT)' and are not applied.
+
 Tags will not be applied if they are already implied by tag implications. This behaviour can be overridden with the --explicit option. See the 'imply' subcommand for more information.
 
 If a single argument of - is passed, TMSU will read lines from standard input in the format 'FILE TAG[=VALUE]...'.
 
+When run with --null-stdin, TMSU reads the files to tag from standard input, each terminated by a NUL character as written by 'find -print0' or 'tmsu files -0', and applies the TAGs specified, or those of --tags, to each. As no character other than NUL is treated specially, this is the safest way to tag files whose names contain spaces, quotation marks or newlines.
+
+When run with --batch, TMSU reads lines from standard input in the format 'FILE<TAB>TAG[=VALUE]...' until the input is closed. FILE may contain any character other than tab and newline. The changes are committed in chunks of lines rather than once at the end, so this mode is suitable for tagging very large numbers of files or for use by long-running processes.
+
+The --from-file option likewise applies the lines of the MANIFEST file, such as tags generated by an external classifier, and reports how many lines were applied and how many failed. Lines that fail are reported and skipped rather than preventing the remainder from being applied.
+
+Executables named 'pre-tag' and 'post-tag' within the 'hooks' directory beside the database are run before and after tagging. A failing 'pre-tag' hook prevents the files from being tagged, and the 'post-tag' hook is passed a JSON description of the tags applied on standard input.
+
 Note: The equals '=' and whitespace characters must be escaped with a backslash '\' when used within a tag or value name. However, your shell may use the backslash for its own purposes: this can normally be avoided by enclosing the argument in single quotation marks or by escaping the backslash with an additional backslash '\\'.`,
 	Examples: []string{"$ tmsu tag mountain1.jpg photo landscape holiday good country=france",
 		"$ tmsu tag --from=mountain1.jpg mountain2.jpg",
 		`$ tmsu tag --tags="landscape" field1.jpg field2.jpg`,
+		"$ tmsu tag --extract-metadata holiday.jpg photo",
 		"$ tmsu tag --create bad rubbish awful =2017",
 		`$ tmsu tag --where="bad and good" confused`,
-		"$ tmsu tag sheep.jpg '<tag>'"},
+		"$ tmsu tag --where='photo and year=2020' --pretend reviewed\n/home/bob/beach.jpg: reviewed",
+		"$ tmsu tag sheep.jpg '<tag>'",
+		`$ find . -name '*.mp3' -printf '%p\tmusic mp3\n' | tmsu tag --batch`,
+		"$ find . -name '*.mp3' -print0 | tmsu tag --null-stdin music mp3",
+		"$ tmsu tag --from-file=classified.tsv",
+		"$ tmsu tag --suggest sunset.jpg beach"},
 	Options: Options{{"--tags", "-t", "the set of tags to apply", true, ""},
 		{"--recursive", "-r", "recursively apply tags to directory contents", false, ""},
 		{"--include-hidden", "-H", "don't skip hidden files/directories when tagging recursively", false, ""},
+		{"--one-file-system", "-x", "don't descend into directories on other file systems when tagging recursively", false, ""},
 		{"--from", "-f", "copy tags from the SOURCE file", true, ""},
 		{"--where", "-w", "tags files matching QUERY", true, ""},
+		{"--pretend", "", "list the tags that would be applied by --where rather than applying them", false, ""},
 		{"--create", "-c", "create tags or values without tagging any files", false, ""},
 		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, ""},
-		{"--force", "-F", "apply tags to non-existent or non-permissioned paths", false, ""},
-		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, ""}},
+		{"--force", "-F", "apply tags to non-existent or non-permissioned paths, or beyond the recursive limits", false, ""},
+		{"--no-dereference", "-P", "do not follow symbolic links (tag the link itself)", false, ""},
+		{"--extract-metadata", "-m", "apply tags from file metadata such as EXIF and ID3", false, ""},
+		{"--batch", "-b", "read tab-separated files and tags from standard input", false, ""},
+		{"--null-stdin", "", "read NUL-terminated files to tag from standard input", false, ""},
+		{"--from-file", "", "apply the tab-separated files and tags in MANIFEST", true, ""},
+		{"--jobs", "-j", "fingerprint up to N files concurrently when tagging recursively", true, ""},
+		{"--suggest", "-s", "suggest further tags often applied alongside those applied", false, ""}},
 	Exec: tagExec,
 }
 
@@ -73,9 +114,42 @@ Note: The equals '=' and whitespace characters must be escaped with a backslash
 func tagExec(options Options, args []string, databasePath string) (error, warnings) {
 	recursive := options.HasOption("--recursive")
 	includeHidden := options.HasOption("--include-hidden")
+	oneFileSystem := options.HasOption("--one-file-system")
 	explicit := options.HasOption("--explicit")
 	force := options.HasOption("--force")
-	followSymlinks := !options.HasOption("--no-dereference")
+	extractMetadata := options.HasOption("--extract-metadata")
+	suggest := options.HasOption("--suggest")
+
+	if suggest {
+		for _, name := range []string{"--batch", "--from-file", "--create", "--from", "--where"} {
+			if options.HasOption(name) {
+				return fmt.Errorf("--suggest cannot be combined with %v", name), nil
+			}
+		}
+
+		if len(args) == 1 && args[0] == "-" {
+			return fmt.Errorf("--suggest cannot be combined with reading from standard input"), nil
+		}
+	}
+
+	pretend := options.HasOption("--pretend")
+	if pretend && !options.HasOption("--where") {
+		return fmt.Errorf("--pretend requires --where"), nil
+	}
+
+	nullStdin := options.HasOption("--null-stdin")
+	if nullStdin {
+		for _, name := range []string{"--batch", "--from-file", "--create", "--from", "--where"} {
+			if options.HasOption(name) {
+				return UsageError{"--null-stdin cannot be combined with " + name}, nil
+			}
+		}
+	}
+
+	jobs, err := fingerprintJobs(options)
+	if err != nil {
+		return err, nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -83,68 +157,138 @@ func tagExec(options Options, args []string, databasePath string) (error, warnin
 	}
 	defer store.Close()
 
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
+	if options.HasOption("--batch") {
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		return tagBatch(store, os.Stdin, "standard input", false, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks, extractMetadata, jobs)
+	}
+
+	if options.HasOption("--from-file") {
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		manifestPath := options.Get("--from-file").Argument
+
+		manifest, err := os.Open(manifestPath)
+		if err != nil {
+			return fmt.Errorf("could not open manifest: %w", err), nil
+		}
+		defer manifest.Close()
+
+		return tagBatch(store, manifest, manifestPath, true, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks, extractMetadata, jobs)
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
 	}
 	defer tx.Commit()
 
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
 	switch {
+	case nullStdin:
+		tagArgs := args
+		if options.HasOption("--tags") {
+			if len(args) > 0 {
+				return errTooManyArguments, nil
+			}
+
+			tagArgs = text.Tokenize(options.Get("--tags").Argument)
+		}
+		if len(tagArgs) == 0 && !extractMetadata {
+			return errTooFewArguments, nil
+		}
+
+		paths, err := readNullTerminated(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("could not read files from standard input: %w", err), nil
+		}
+		if len(paths) == 0 {
+			return nil, nil
+		}
+
+		err, warnings := tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata, jobs)
+		if err == nil && suggest {
+			err = suggestTags(store, tx, tagArgs, paths, followSymlinks)
+		}
+
+		return err, warnings
 	case options.HasOption("--create"):
 		if len(args) == 0 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		return createTagsValues(store, tx, args)
 	case options.HasOption("--tags"):
 		if len(args) < 1 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		tagArgs := text.Tokenize(options.Get("--tags").Argument)
 		if len(tagArgs) == 0 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		paths := args
 		if len(paths) < 1 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
+		}
+
+		err, warnings := tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata, jobs)
+		if err == nil && suggest {
+			err = suggestTags(store, tx, tagArgs, paths, followSymlinks)
 		}
 
-		return tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, force, followSymlinks)
+		return err, warnings
 	case options.HasOption("--from"):
 		if len(args) < 1 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		fromPath, err := filepath.Abs(options.Get("--from").Argument)
 		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", fromPath, err), nil
+			return fmt.Errorf("%v: could not get absolute path: %w", fromPath, err), nil
 		}
 
 		paths := args
 
-		return tagFrom(store, tx, fromPath, paths, explicit, recursive, includeHidden, force, followSymlinks)
+		return tagFrom(store, tx, fromPath, paths, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata, jobs)
 	case options.HasOption("--where"):
 		if len(args) < 1 {
-			return fmt.Errorf("too few arguments"), nil
+			return errTooFewArguments, nil
 		}
 
 		query := options.Get("--where").Argument
 		tagArgs := args
 
-		return tagWhere(store, tx, query, explicit, tagArgs)
+		return tagWhere(store, tx, query, explicit, pretend, tagArgs)
 	case len(args) == 1 && args[0] == "-":
-		return readStandardInput(store, tx, recursive, includeHidden, explicit, force, followSymlinks)
+		return readStandardInput(store, tx, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks, extractMetadata, jobs)
 	default:
-		if len(args) < 2 {
-			return fmt.Errorf("too few arguments"), nil
+		if len(args) < 2 && !(extractMetadata && len(args) == 1) {
+			return errTooFewArguments, nil
 		}
 
 		paths := args[0:1]
 		tagArgs := args[1:]
 
-		return tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, force, followSymlinks)
+		err, warnings := tagPaths(store, tx, tagArgs, paths, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata, jobs)
+		if err == nil && suggest {
+			err = suggestTags(store, tx, tagArgs, paths, followSymlinks)
+		}
+
+		return err, warnings
 	}
 }
 
@@ -159,28 +303,28 @@ func createTagsValues(store *storage.Storage, tx *storage.Tx, tagArgs []string)
 
 			value, err := store.ValueByName(tx, name)
 			if err != nil {
-				return fmt.Errorf("could not check if value '%v' exists: %v", name, err), warnings
+				return fmt.Errorf("could not check if value '%v' exists: %w", name, err), warnings
 			}
 
 			if value == nil {
 				if _, err := store.AddValue(tx, name); err != nil {
-					return fmt.Errorf("could not create value '%v': %v", name, err), warnings
+					return fmt.Errorf("could not create value '%v': %w", name, err), warnings
 				}
 			} else {
-				warnings = append(warnings, fmt.Sprintf("value '%v' already exists", name))
+				warnings = append(warnings, fmt.Errorf("value '%v' already exists", name))
 			}
 		} else {
 			tag, err := store.TagByName(tx, name)
 			if err != nil {
-				return fmt.Errorf("could not check if tag '%v' exists: %v", name, err), warnings
+				return fmt.Errorf("could not check if tag '%v' exists: %w", name, err), warnings
 			}
 
 			if tag == nil {
 				if _, err := store.AddTag(tx, name); err != nil {
-					return fmt.Errorf("could not create tag '%v': %v", name, err), warnings
+					return fmt.Errorf("could not create tag '%v': %w", name, err), warnings
 				}
 			} else {
-				warnings = append(warnings, fmt.Sprintf("tag '%v' already exists", name))
+				warnings = append(warnings, fmt.Errorf("tag '%v' already exists", name))
 			}
 		}
 	}
@@ -188,7 +332,7 @@ func createTagsValues(store *storage.Storage, tx *storage.Tx, tagArgs []string)
 	return nil, warnings
 }
 
-func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, explicit, recursive, includeHidden, force, followSymlinks bool) (error, warnings) {
+func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata bool, jobs int) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
 	log.Infof(2, "loading settings")
@@ -198,20 +342,41 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 		return err, warnings
 	}
 
+	if recursive && !force {
+		if err := checkRecursiveScope(paths, includeHidden, oneFileSystem, followSymlinks, settings.RecursiveTagLimit()); err != nil {
+			return err, warnings
+		}
+	}
+
 	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, warnings)
 	if err != nil {
 		return err, warnings
 	}
 
+	rules, err := loadRules(store, tx, settings)
+	if err != nil {
+		return err, warnings
+	}
+
+	extractor := newMetadataExtractor(store, settings, extractMetadata)
+	fingerprints := newFingerprintPool(settings, jobs)
+
+	// the total is estimated as the directories are read
+	var bar *progress.Bar
+	if recursive {
+		bar = progress.Start("tagging", uint(len(paths)))
+		defer bar.Finish()
+	}
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), settings.ReportDuplicates()); err != nil {
+		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, fingerprints, settings.ReportDuplicates(), rules, extractor, bar); err != nil {
 			switch {
 			case os.IsPermission(err):
-				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+				warnings = append(warnings, PermissionDeniedError{path})
 			case os.IsNotExist(err):
-				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+				warnings = append(warnings, NoSuchFileError{path})
 			default:
-				return fmt.Errorf("%v: could not stat file: %v", path, err), warnings
+				return fmt.Errorf("%v: could not stat file: %w", path, err), warnings
 			}
 		}
 	}
@@ -219,17 +384,24 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 	return nil, warnings
 }
 
-func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []string, explicit, recursive, includeHidden, force, followSymlinks bool) (error, warnings) {
+func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []string, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata bool, jobs int) (error, warnings) {
 	log.Infof(2, "loading settings")
 
 	settings, err := store.Settings(tx)
 	if err != nil {
-		return fmt.Errorf("could not retrieve settings: %v", err), nil
+		return fmt.Errorf("could not retrieve settings: %w", err), nil
 	}
 
 	stat, err := os.Lstat(fromPath)
 	if err != nil {
-		return err, nil
+		switch {
+		case os.IsPermission(err):
+			return PermissionDeniedError{fromPath}, nil
+		case os.IsNotExist(err):
+			return NoSuchFileError{fromPath}, nil
+		default:
+			return err, nil
+		}
 	}
 	if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
 		fromPath, err = _path.Dereference(fromPath)
@@ -238,9 +410,15 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 		}
 	}
 
+	if recursive && !force {
+		if err := checkRecursiveScope(paths, includeHidden, oneFileSystem, followSymlinks, settings.RecursiveTagLimit()); err != nil {
+			return err, nil
+		}
+	}
+
 	file, err := store.FileByPath(tx, fromPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", fromPath, err), nil
+		return fmt.Errorf("%v: could not retrieve file: %w", fromPath, err), nil
 	}
 	if file == nil {
 		return fmt.Errorf("%v: path is not tagged", fromPath), nil
@@ -248,7 +426,7 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 
 	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve filetags: %v", fromPath, err), nil
+		return fmt.Errorf("%v: could not retrieve filetags: %w", fromPath, err), nil
 	}
 
 	pairs := make([]entities.TagIdValueIdPair, len(fileTags))
@@ -256,17 +434,25 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 		pairs[index] = entities.TagIdValueIdPair{fileTag.TagId, fileTag.ValueId}
 	}
 
+	rules, err := loadRules(store, tx, settings)
+	if err != nil {
+		return err, nil
+	}
+
+	extractor := newMetadataExtractor(store, settings, extractMetadata)
+	fingerprints := newFingerprintPool(settings, jobs)
+
 	warnings := make(warnings, 0, 10)
 
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, force, followSymlinks, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm(), settings.ReportDuplicates()); err != nil {
+		if err := tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, fingerprints, settings.ReportDuplicates(), rules, extractor, nil); err != nil {
 			switch {
 			case os.IsPermission(err):
-				warnings = append(warnings, fmt.Sprintf("%v: permission denied", path))
+				warnings = append(warnings, PermissionDeniedError{path})
 			case os.IsNotExist(err):
-				warnings = append(warnings, fmt.Sprintf("%v: no such file", path))
+				warnings = append(warnings, NoSuchFileError{path})
 			default:
-				return fmt.Errorf("%v: could not stat file: %v", path, err), warnings
+				return fmt.Errorf("%v: could not stat file: %w", path, err), warnings
 			}
 		}
 	}
@@ -274,7 +460,7 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 	return nil, warnings
 }
 
-func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit bool, tagArgs []string) (error, warnings) {
+func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit, pretend bool, tagArgs []string) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
 	log.Infof(2, "loading settings")
@@ -288,16 +474,25 @@ func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit
 
 	expression, err := query.Parse(queryText)
 	if err != nil {
-		return fmt.Errorf("could not parse query: %v", err), warnings
+		return fmt.Errorf("could not parse query: %w", err), warnings
 	}
 
 	log.Info(2, "querying files")
 
-	files, err := store.FilesForQuery(tx, expression, "", explicit, false, "none")
+	sort := "none"
+	if pretend {
+		sort = "name"
+	}
+
+	files, err := store.FilesForQuery(tx, expression, nil, "", explicit, false, sort, false, 0)
 	if err != nil {
 		return err, warnings
 	}
 
+	if pretend {
+		return listTagsWhere(store, tx, settings, files, tagArgs)
+	}
+
 	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, warnings)
 	if err != nil {
 		return err, warnings
@@ -308,18 +503,116 @@ func tagWhere(store *storage.Storage, tx *storage.Tx, queryText string, explicit
 	for _, file := range files {
 		for _, pair := range pairs {
 			if _, err = store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
-				return fmt.Errorf("could not apply tags: %v", err), warnings
+				return fmt.Errorf("could not apply tags: %w", err), warnings
+			}
+		}
+	}
+
+	return nil, warnings
+}
+
+// lists the tags that tagging the files would apply, without creating any tags or values
+func listTagsWhere(store *storage.Storage, tx *storage.Tx, settings entities.Settings, files entities.Files, tagArgs []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, tagArg := range tagArgs {
+		tagName, valueName := parseTagEqValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil && !settings.AutoCreateTags() {
+			warnings = append(warnings, NoSuchTagError{tagName})
+			continue
+		}
+
+		var value *entities.Value
+		if tag != nil {
+			tagName = tag.Name
+
+			valueName, err = store.TagValueName(tx, *tag, valueName)
+			if err != nil {
+				return err, warnings
+			}
+
+			value, err = store.ValueByName(tx, valueName)
+			if err != nil {
+				return fmt.Errorf("could not retrieve value '%v': %w", valueName, err), warnings
+			}
+		}
+		if value == nil && valueName != "" && !settings.AutoCreateValues() {
+			warnings = append(warnings, NoSuchValueError{valueName})
+			continue
+		}
+
+		for _, file := range files {
+			if tag != nil && value != nil {
+				exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, true)
+				if err != nil {
+					return fmt.Errorf("could not check if tag exists: %w", err), warnings
+				}
+				if exists {
+					continue
+				}
 			}
+
+			fmt.Printf("%v: %v\n", displayPath(file.Path()), formatTagValueName(tagName, valueName, false, false, false))
 		}
 	}
 
 	return nil, warnings
 }
 
-func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, recursive, includeHidden, force, followSymlinks bool, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg string, reportDuplicates bool) error {
+// the number of further tags suggested by --suggest
+const suggestionLimit = 5
+
+func suggestTags(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, followSymlinks bool) error {
+	log.Info(2, "identifying suggested tags")
+
+	tagIds := make(entities.TagIds, 0, len(tagArgs))
+	for _, tagArg := range tagArgs {
+		tagName, _ := parseTagEqValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return err
+		}
+		if tag != nil {
+			tagIds = append(tagIds, tag.Id)
+		}
+	}
+
+	fileIds := make(entities.FileIds, 0, len(paths))
+	for _, path := range paths {
+		// problems with the paths have already been reported whilst tagging
+		file, _, err := fileForTagsPath(store, tx, path, followSymlinks)
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			fileIds = append(fileIds, file.Id)
+		}
+	}
+
+	suggestions, err := store.CoOccurringTags(tx, tagIds, fileIds, suggestionLimit)
+	if err != nil {
+		return fmt.Errorf("could not identify suggested tags: %w", err)
+	}
+
+	for _, suggestion := range suggestions {
+		fmt.Printf("%v (%v)\n", formatTagValueName(suggestion.Name, "", false, false, false), suggestion.FileCount)
+	}
+
+	return nil
+}
+
+func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks bool, fingerprints *fingerprint.Pool, reportDuplicates bool, rules *ruleSet, extractor *metadataExtractor, bar *progress.Bar) error {
+	defer bar.Add(1)
+
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		return fmt.Errorf("%v: could not get absolute path: %w", path, err)
 	}
 
 	log.Infof(2, "%v: resolving path", path)
@@ -354,15 +647,15 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 
 	file, err := store.FileByPath(tx, absPath)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		return fmt.Errorf("%v: could not retrieve file: %w", path, err)
 	}
 	if file == nil {
 		log.Infof(2, "%v: creating fingerprint", path)
 
-		fp, err := fingerprint.Create(absPath, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg)
+		fp, err := fingerprints.Create(absPath)
 		if err != nil {
 			if !force || !(os.IsNotExist(err) || os.IsPermission(err)) {
-				return fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+				return fmt.Errorf("%v: could not create fingerprint: %w", path, err)
 			}
 		}
 
@@ -371,25 +664,27 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 
 			count, err := store.FileCountByFingerprint(tx, fp)
 			if err != nil {
-				return fmt.Errorf("%v: could not identify duplicates: %v", path, err)
+				return fmt.Errorf("%v: could not identify duplicates: %w", path, err)
 			}
 			if count != 0 {
-				log.Warnf("'%v' is a duplicate", path)
+				log.Warnf("'%v' is a duplicate", escapeControl(path))
 			}
 		}
 
 		log.Infof(2, "%v: adding file", path)
 
-		file, err = store.AddFile(tx, absPath, fp, stat.ModTime(), int64(stat.Size()), stat.IsDir())
+		mimeType := detectMimeType(absPath)
+
+		file, err = store.AddFile(tx, absPath, fp, stat.ModTime(), int64(stat.Size()), stat.IsDir(), mimeType)
 		if err != nil {
-			return fmt.Errorf("%v: could not add file to database: %v", path, err)
+			return fmt.Errorf("%v: could not add file to database: %w", path, err)
 		}
 	}
 
 	if !explicit {
 		pairs, err = removeAlreadyAppliedTagValuePairs(store, tx, pairs, file)
 		if err != nil {
-			return fmt.Errorf("%v: could not remove applied tags: %v", path, err)
+			return fmt.Errorf("%v: could not remove applied tags: %w", path, err)
 		}
 	}
 
@@ -397,12 +692,39 @@ func tagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []entiti
 
 	for _, pair := range pairs {
 		if _, err = store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
-			return fmt.Errorf("%v: could not apply tags: %v", path, err)
+			return fmt.Errorf("%v: could not apply tags: %w", path, err)
+		}
+	}
+
+	rulePairs, err := rules.pairsFor(tx, absPath)
+	if err != nil {
+		return err
+	}
+
+	metadataPairs, err := extractor.pairsFor(tx, file)
+	if err != nil {
+		return err
+	}
+
+	if derivedPairs := append(rulePairs, metadataPairs...); len(derivedPairs) > 0 {
+		if !explicit {
+			derivedPairs, err = removeAlreadyAppliedTagValuePairs(store, tx, derivedPairs, file)
+			if err != nil {
+				return fmt.Errorf("%v: could not remove applied tags: %w", path, err)
+			}
+		}
+
+		log.Infof(2, "%v: applying tags from rules and metadata.", path)
+
+		for _, pair := range derivedPairs {
+			if _, err = store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+				return fmt.Errorf("%v: could not apply tags: %w", path, err)
+			}
 		}
 	}
 
 	if recursive && stat.IsDir() {
-		if err = tagRecursively(store, tx, absPath, pairs, explicit, includeHidden, force, followSymlinks, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg, reportDuplicates); err != nil {
+		if err = tagRecursively(store, tx, absPath, pairs, explicit, includeHidden, oneFileSystem, force, followSymlinks, fingerprints, reportDuplicates, rules, extractor, bar); err != nil {
 			return err
 		}
 	}
@@ -418,7 +740,7 @@ func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entitie
 	for _, tagArg := range tagArgs {
 		tagName, valueName := parseTagEqValueName(tagArg)
 
-		tag, err := store.TagByName(tx, tagName)
+		tag, err := store.TagByNameOrAlias(tx, tagName)
 		if err != nil {
 			return nil, warnings, err
 		}
@@ -429,11 +751,16 @@ func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entitie
 					return nil, warnings, err
 				}
 			} else {
-				warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
+				warnings = append(warnings, NoSuchTagError{tagName})
 				continue
 			}
 		}
 
+		valueName, err = store.TagValueName(tx, *tag, valueName)
+		if err != nil {
+			return nil, warnings, err
+		}
+
 		value, err := store.ValueByName(tx, valueName)
 		if err != nil {
 			return nil, warnings, err
@@ -445,7 +772,7 @@ func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entitie
 					return nil, warnings, err
 				}
 			} else {
-				warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
+				warnings = append(warnings, NoSuchValueError{valueName})
 				continue
 			}
 		}
@@ -456,7 +783,7 @@ func parseTagValuePairs(store *storage.Storage, tx *storage.Tx, settings entitie
 	return pairs, warnings, nil
 }
 
-func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includeHidden, explicit, force, followSymlinks bool) (error, warnings) {
+func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks, extractMetadata bool, jobs int) (error, warnings) {
 	reader := bufio.NewReader(os.Stdin)
 
 	warnings := make(warnings, 0, 10)
@@ -474,16 +801,16 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includ
 		words := text.Tokenize(line[0 : len(line)-1])
 
 		if len(words) < 2 {
-			warnings = append(warnings, fmt.Sprintf("too few arguments"))
+			warnings = append(warnings, errTooFewArguments)
 			continue
 		}
 
 		path := words[0]
 		tagArgs := words[1:]
 
-		err, commandWarnings := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, includeHidden, force, followSymlinks)
+		err, commandWarnings := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, extractMetadata, jobs)
 		if err != nil {
-			warnings = append(warnings, err.Error())
+			warnings = append(warnings, err)
 		}
 		if commandWarnings != nil {
 			warnings = append(warnings, commandWarnings...)
@@ -493,26 +820,243 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, includ
 	return nil, warnings
 }
 
-func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, includeHidden, force, followSymlinks bool, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg string, reportDuplicates bool) error {
-	osFile, err := os.Open(path)
+// reads the NUL-terminated items, such as the paths written by 'find -print0',
+// from the reader. A final item lacking its terminator is included and empty
+// items are skipped.
+func readNullTerminated(reader io.Reader) ([]string, error) {
+	bufferedReader := bufio.NewReader(reader)
+
+	items := make([]string, 0, 10)
+	for {
+		item, err := bufferedReader.ReadString('\000')
+		item = strings.TrimSuffix(item, "\000")
+		if item != "" {
+			items = append(items, item)
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return items, nil
+			}
+
+			return nil, err
+		}
+	}
+}
+
+// the maximum number of lines applied in each transaction in batch mode
+const batchChunkSize = 1000
+
+// applies the tab-separated files and tags read from the input, named for the
+// purposes of error messages, reporting the number of lines applied and failed
+// if summarize is specified
+func tagBatch(store *storage.Storage, input io.Reader, inputName string, summarize, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks, extractMetadata bool, jobs int) (error, warnings) {
+	reader := bufio.NewReaderSize(input, 64*1024)
+
+	warnings := make(warnings, 0, 10)
+	lineNumber := 0
+	failed := 0
+
+	for {
+		lines, err := readBatchChunk(reader)
+		if err != nil {
+			return fmt.Errorf("could not read %v: %w", inputName, err), warnings
+		}
+		if len(lines) == 0 {
+			break
+		}
+
+		log.Infof(2, "applying chunk of %v lines", len(lines))
+
+		tx, err := store.Begin()
+		if err != nil {
+			return err, warnings
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			tx.Rollback()
+			return err, warnings
+		}
+
+		settings, err := store.Settings(tx)
+		if err != nil {
+			tx.Rollback()
+			return err, warnings
+		}
+
+		rules, err := loadRules(store, tx, settings)
+		if err != nil {
+			tx.Rollback()
+			return err, warnings
+		}
+
+		extractor := newMetadataExtractor(store, settings, extractMetadata)
+		fingerprints := newFingerprintPool(settings, jobs)
+
+		for _, line := range lines {
+			lineNumber++
+
+			lineWarnings, err := tagBatchLine(store, tx, settings, rules, extractor, fingerprints, line, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks)
+			for _, warning := range lineWarnings {
+				warnings = append(warnings, fmt.Errorf("line %v: %w", lineNumber, warning))
+			}
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("line %v: %w", lineNumber, err))
+			}
+			if err != nil || len(lineWarnings) > 0 {
+				failed++
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit changes: %w", err), warnings
+		}
+	}
+
+	if summarize {
+		fmt.Printf("%v lines applied, %v failed\n", lineNumber-failed, failed)
+	}
+
+	return nil, warnings
+}
+
+// reads lines until the chunk is full or no more input is immediately available
+func readBatchChunk(reader *bufio.Reader) ([]string, error) {
+	lines := make([]string, 0, batchChunkSize)
+
+	for len(lines) < batchChunkSize {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line != "" {
+			lines = append(lines, line)
+		}
+
+		if err == io.EOF || reader.Buffered() == 0 {
+			break
+		}
+	}
+
+	return lines, nil
+}
+
+func tagBatchLine(store *storage.Storage, tx *storage.Tx, settings entities.Settings, rules *ruleSet, extractor *metadataExtractor, fingerprints *fingerprint.Pool, line string, recursive, includeHidden, oneFileSystem, explicit, force, followSymlinks bool) (warnings, error) {
+	parts := strings.SplitN(line, "\t", 2)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("expected FILE<TAB>TAG[=VALUE]...")
+	}
+
+	path := parts[0]
+	tagArgs := text.Tokenize(parts[1])
+	if len(tagArgs) == 0 {
+		return nil, errTooFewArguments
+	}
+
+	pairs, warnings, err := parseTagValuePairs(store, tx, settings, tagArgs, nil)
 	if err != nil {
-		return fmt.Errorf("%v: could not open path: %v", path, err)
+		return warnings, err
+	}
+
+	err = tagPath(store, tx, path, pairs, explicit, recursive, includeHidden, oneFileSystem, force, followSymlinks, fingerprints, settings.ReportDuplicates(), rules, extractor, nil)
+	switch {
+	case err == nil:
+		return warnings, nil
+	case os.IsPermission(err):
+		return append(warnings, PermissionDeniedError{path}), nil
+	case os.IsNotExist(err):
+		return append(warnings, NoSuchFileError{path}), nil
+	default:
+		return warnings, err
 	}
+}
 
-	childNames, err := osFile.Readdirnames(0)
-	osFile.Close()
+func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs []entities.TagIdValueIdPair, explicit, includeHidden, oneFileSystem, force, followSymlinks bool, fingerprints *fingerprint.Pool, reportDuplicates bool, rules *ruleSet, extractor *metadataExtractor, bar *progress.Bar) error {
+	childPaths, err := recursiveChildPaths(path, includeHidden)
 	if err != nil {
-		return fmt.Errorf("%v: could not retrieve directory contents: %v", path, err)
+		return err
+	}
+
+	bar.Expect(uint(len(childPaths)))
+
+	if err := prefetchFingerprints(store, tx, childPaths, fingerprints); err != nil {
+		return err
+	}
+
+	var stat os.FileInfo
+	if oneFileSystem {
+		if stat, err = os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	for _, childPath := range childPaths {
+		// the directories on other file systems are tagged but not descended into
+		crossesFileSystem := oneFileSystem && isOtherFileSystem(stat, childPath, followSymlinks)
+		if crossesFileSystem {
+			log.Warnf("%v: not descending into directory on a different file system", escapeControl(childPath))
+		}
+
+		if err = tagPath(store, tx, childPath, pairs, explicit, !crossesFileSystem, includeHidden, oneFileSystem, force, followSymlinks, fingerprints, reportDuplicates, rules, extractor, bar); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensures, before any file is tagged, that tagging the paths recursively would
+// tag no more files than the limit, unless this is zero, and would not descend
+// into other file systems, unless these are to be skipped
+func checkRecursiveScope(paths []string, includeHidden, oneFileSystem, followSymlinks bool, limit uint) error {
+	count := uint(0)
+
+	var walk func(path string, stat os.FileInfo) error
+	walk = func(path string, stat os.FileInfo) error {
+		childPaths, err := recursiveChildPaths(path, includeHidden)
+		if err != nil {
+			// reported once tagging
+			return nil
+		}
+
+		for _, childPath := range childPaths {
+			count++
+			if limit > 0 && count > limit {
+				return fmt.Errorf("tagging recursively would tag more than %v files: use --force to tag them regardless or change the 'recursiveTagLimit' setting", limit)
+			}
+
+			childStat, err := statForTagging(childPath, followSymlinks)
+			if err != nil || !childStat.IsDir() {
+				continue
+			}
+
+			if isOtherFileSystem(stat, childPath, followSymlinks) {
+				if oneFileSystem {
+					continue
+				}
+
+				return fmt.Errorf("%v: directory is on a different file system: use --one-file-system to skip its contents or --force to tag them regardless", escapeControl(childPath))
+			}
+
+			if err := walk(childPath, childStat); err != nil {
+				return err
+			}
+		}
+
+		return nil
 	}
 
-	for _, childName := range childNames {
-		childPath := filepath.Join(path, childName)
-		if childName[0] == '.' && !includeHidden {
-			log.Infof(2, "%v: skipping hidden file/directory", childPath)
+	for _, path := range paths {
+		count++
+
+		stat, err := statForTagging(path, followSymlinks)
+		if err != nil || !stat.IsDir() {
 			continue
 		}
 
-		if err = tagPath(store, tx, childPath, pairs, explicit, true, includeHidden, force, followSymlinks, fileFingerprintAlg, dirFingerprintAlg, symlinkFingerprintAlg, reportDuplicates); err != nil {
+		if err := walk(path, stat); err != nil {
 			return err
 		}
 	}
@@ -520,19 +1064,76 @@ func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs [
 	return nil
 }
 
+// whether the path is a directory on a different file system to that of the
+// parent directory, where this can be determined
+func isOtherFileSystem(parentStat os.FileInfo, path string, followSymlinks bool) bool {
+	stat, err := statForTagging(path, followSymlinks)
+	if err != nil || !stat.IsDir() {
+		return false
+	}
+
+	parentIdentity := storage.FileIdentityOf(parentStat)
+	identity := storage.FileIdentityOf(stat)
+
+	return parentIdentity != nil && identity != nil && parentIdentity.Device != identity.Device
+}
+
+func statForTagging(path string, followSymlinks bool) (os.FileInfo, error) {
+	if followSymlinks {
+		return os.Stat(path)
+	}
+
+	return os.Lstat(path)
+}
+
+// fingerprints the regular files amongst the paths that are not yet in the
+// database concurrently, ahead of their being added
+func prefetchFingerprints(store *storage.Storage, tx *storage.Tx, paths []string, fingerprints *fingerprint.Pool) error {
+	if fingerprints.Jobs < 2 || len(paths) == 0 {
+		return nil
+	}
+
+	untaggedPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %w", path, err)
+		}
+
+		stat, err := os.Lstat(absPath)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %w", path, err)
+		}
+		if file == nil {
+			untaggedPaths = append(untaggedPaths, absPath)
+		}
+	}
+
+	log.Infof(2, "%v: creating fingerprints of %v files", filepath.Dir(paths[0]), len(untaggedPaths))
+
+	fingerprints.Prefetch(untaggedPaths)
+
+	return nil
+}
+
 func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tx *storage.Tx, pairs []entities.TagIdValueIdPair, file *entities.File) ([]entities.TagIdValueIdPair, error) {
 	log.Infof(2, "%v: determining existing file-tags", file.Path())
 
 	existingFileTags, err := store.FileTagsByFileId(tx, file.Id, false)
 	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine file's tags: %v", file.Path(), err)
+		return nil, fmt.Errorf("%v: could not determine file's tags: %w", file.Path(), err)
 	}
 
 	log.Infof(2, "%v: determining implied tags", file.Path())
 
 	newImplications, err := store.ImplicationsFor(tx, pairs...)
 	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine implied tags: %v", file.Path(), err)
+		return nil, fmt.Errorf("%v: could not determine implied tags: %w", file.Path(), err)
 	}
 
 	log.Infof(2, "%v: revising set of tags to apply", file.Path())
@@ -556,3 +1157,13 @@ func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tx *storage.Tx, p
 
 	return revisedPairs, nil
 }
+
+func detectMimeType(path string) string {
+	mimeType, err := mimetype.Detect(path)
+	if err != nil {
+		log.Infof(2, "%v: could not detect MIME type: %v", path, err)
+		return ""
+	}
+
+	return mimeType
+}
@@ -0,0 +1,257 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"sort"
+)
+
+var TagDefCommand = Command{
+	Name:     "tag-def",
+	Synopsis: "Defines the type and permitted values of a tag's values",
+	Usages: []string{"tmsu tag-def [--type=TYPE] [--values=PATTERN] [--default=VALUE] TAG...",
+		"tmsu tag-def [TAG]..."},
+	Description: `Sets the TYPE of the values that may be applied with each TAG, the PATTERN they must match and the default VALUE applied where none is given, creating the tags if they do not already exist. Only the definitions specified are changed.
+
+When run without any of these options lists the definition of each TAG, or of every tag that has a type or constraint if no tags are specified.
+
+TYPE is one of:
+
+  int       whole numbers, compared numerically
+  date      dates of the form YYYY-MM-DD, compared chronologically
+  string    text, compared alphabetically even where it looks like a number
+  none      removes the type so values are compared numerically if the queried value is a number or alphabetically if not
+
+Values of a typed tag are checked when tagging files, so 'tmsu tag photo.jpg year=twenty' is rejected for an int tag. The values already applied with a tag must be valid for the type given to it.
+
+A date value may be written relative to today, or to another date, using offsets of days (d), weeks (w), months (m) or years (y), e.g. 'today-30d' or '2020-01-01+1y'. Relative dates are converted to YYYY-MM-DD when tagging and compared as such when querying.
+
+PATTERN is a regular expression that must match the whole of each value applied with the tag, such as 'todo|doing|done' to permit only those values or '\d{4}' for four digit years. This keeps the vocabulary of a shared database consistent. Applying the tag without a value applies the default VALUE, if it has one. The values already applied with a tag, and its default value, must match its PATTERN. An empty PATTERN or VALUE removes it.
+
+The constraints are included in the output of 'export' and restored by 'import'.`,
+	Examples: []string{`$ tmsu tag-def --type=int year`,
+		`$ tmsu tag-def --type=date taken`,
+		`$ tmsu tag-def
+taken: date
+year: int`,
+		`$ tmsu tag photo.jpg taken=2020-06-21 year=2020`,
+		`$ tmsu files "taken > today-30d"`,
+		`$ tmsu files "taken >= 2020-01-01 and taken < 2020-01-01+1y"`,
+		`$ tmsu tag-def --type=none year`,
+		`$ tmsu tag-def --values="todo|doing|done" --default=todo status`,
+		`$ tmsu tag task.txt status=finished
+tmsu: invalid value 'finished' for tag 'status': must match 'todo|doing|done'`,
+		`$ tmsu tag-def status
+status: none values=todo|doing|done default=todo`},
+	Options: Options{Option{"--type", "-t", "the type of the tags' values: int, date, string or none", true, ""},
+		Option{"--values", "", "the pattern the tags' values must match", true, ""},
+		Option{"--default", "", "the value applied with the tags where none is given", true, ""}},
+	Exec: tagDefExec,
+}
+
+// unexported
+
+func tagDefExec(options Options, args []string, databasePath string) (error, warnings) {
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	pattern := options.Get("--values")
+	defaultValue := options.Get("--default")
+
+	if options.HasOption("--type") || pattern != nil || defaultValue != nil {
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+
+		var valueType *entities.ValueType
+		if options.HasOption("--type") {
+			parsedType, err := entities.ParseValueType(options.Get("--type").Argument)
+			if err != nil {
+				return err, nil
+			}
+			valueType = &parsedType
+		}
+
+		if pattern != nil {
+			if err := entities.ValidateValuePattern(pattern.Argument); err != nil {
+				return err, nil
+			}
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+
+		return defineTags(store, tx, args, valueType, pattern, defaultValue)
+	}
+
+	if len(args) == 0 {
+		return listTagDefs(store, tx), nil
+	}
+
+	return listTagDefsForTags(store, tx, args)
+}
+
+func listTagDefs(store *storage.Storage, tx *storage.Tx) error {
+	log.Infof(2, "retrieving tag types")
+
+	tagTypes, err := store.TagTypes(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag types: %w", err)
+	}
+
+	log.Infof(2, "retrieving tag constraints")
+
+	tagConstraints, err := store.TagConstraints(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag constraints: %w", err)
+	}
+
+	tagNames := make([]string, 0, len(tagTypes)+len(tagConstraints))
+	valueTypes := make(map[string]entities.ValueType, len(tagTypes))
+	for _, tagType := range tagTypes {
+		tagNames = append(tagNames, tagType.Tag.Name)
+		valueTypes[tagType.Tag.Name] = tagType.Type
+	}
+
+	constraints := make(map[string]*entities.TagConstraint, len(tagConstraints))
+	for _, tagConstraint := range tagConstraints {
+		if _, ok := valueTypes[tagConstraint.Tag.Name]; !ok {
+			tagNames = append(tagNames, tagConstraint.Tag.Name)
+		}
+		constraints[tagConstraint.Tag.Name] = tagConstraint
+	}
+
+	sort.Strings(tagNames)
+
+	for _, tagName := range tagNames {
+		printTagDef(tagName, valueTypes[tagName], constraints[tagName])
+	}
+
+	return nil
+}
+
+func listTagDefsForTags(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, tagArg := range tagArgs {
+		tagName := parseTagOrValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			warnings = append(warnings, NoSuchTagError{tagName})
+			continue
+		}
+
+		valueType, err := store.TagType(tx, tag.Id)
+		if err != nil {
+			return fmt.Errorf("could not retrieve type of tag '%v': %w", tag.Name, err), warnings
+		}
+
+		tagConstraint, err := store.TagConstraint(tx, *tag)
+		if err != nil {
+			return fmt.Errorf("could not retrieve constraint of tag '%v': %w", tag.Name, err), warnings
+		}
+
+		printTagDef(tag.Name, valueType, tagConstraint)
+	}
+
+	return nil, warnings
+}
+
+func printTagDef(tagName string, valueType entities.ValueType, tagConstraint *entities.TagConstraint) {
+	fmt.Printf("%v: %v", escape(tagName, '=', ' '), valueType)
+
+	if tagConstraint != nil {
+		if tagConstraint.Pattern != "" {
+			fmt.Printf(" values=%v", tagConstraint.Pattern)
+		}
+		if tagConstraint.Default != "" {
+			fmt.Printf(" default=%v", tagConstraint.Default)
+		}
+	}
+
+	fmt.Println()
+}
+
+// sets the type and constraint specified, leaving those not specified unchanged
+func defineTags(store *storage.Storage, tx *storage.Tx, tagArgs []string, valueType *entities.ValueType, pattern, defaultValue *Option) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, tagArg := range tagArgs {
+		tagName := parseTagOrValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			tag, err = createTag(store, tx, tagName)
+			if err != nil {
+				return fmt.Errorf("could not create tag '%v': %w", tagName, err), warnings
+			}
+		}
+
+		if valueType != nil {
+			log.Infof(2, "setting type of tag '%v' to '%v'", tag.Name, *valueType)
+
+			if err := store.SetTagType(tx, *tag, *valueType); err != nil {
+				warnings = append(warnings, err)
+				continue
+			}
+		}
+
+		if pattern == nil && defaultValue == nil {
+			continue
+		}
+
+		tagConstraint, err := store.TagConstraint(tx, *tag)
+		if err != nil {
+			return fmt.Errorf("could not retrieve constraint of tag '%v': %w", tag.Name, err), warnings
+		}
+
+		if pattern != nil {
+			tagConstraint.Pattern = pattern.Argument
+		}
+		if defaultValue != nil {
+			tagConstraint.Default = defaultValue.Argument
+		}
+
+		log.Infof(2, "setting constraint of tag '%v'", tag.Name)
+
+		if err := store.SetTagConstraint(tx, *tagConstraint); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return nil, warnings
+}
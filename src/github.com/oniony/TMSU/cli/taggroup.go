@@ -0,0 +1,212 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"strings"
+)
+
+var TagGroupCommand = Command{
+	Name:     "tag-group",
+	Synopsis: "Groups mutually exclusive tags",
+	Usages: []string{"tmsu tag-group set GROUP TAG...",
+		"tmsu tag-group --delete TAG...",
+		"tmsu tag-group [GROUP]..."},
+	Description: `Adds each TAG to the tag GROUP, creating the tags if they do not already exist. At most one tag of a group may be applied to a file: tagging a file with one of them removes whichever other tag of the group it has, e.g. an item moves from 'todo' to 'doing' to 'done'. A tag is in at most one group, so adding it to a group removes it from any other.
+
+A tag cannot be added to a group where files are already tagged with both it and another tag of the group: untag one of them first.
+
+In queries 'GROUP:*' matches the files tagged with any tag of the group, as well as those tagged with any tag of the namespace GROUP, so 'tmsu files "status:*"' lists the files with any status.
+
+With --delete removes each TAG from its group. When run without 'set' or --delete lists the tags of each GROUP, or of every group if no groups are specified.`,
+	Examples: []string{`$ tmsu tag-group set status todo doing done`,
+		`$ tmsu tag report.odt todo
+$ tmsu tag report.odt doing
+$ tmsu tags report.odt
+doing`,
+		`$ tmsu files "status:*"`,
+		`$ tmsu tag-group
+status: doing done todo`,
+		`$ tmsu tag-group --delete done`},
+	Options: Options{Option{"--delete", "-d", "removes the tags from their groups", false, ""}},
+	Exec:    tagGroupExec,
+}
+
+// unexported
+
+func tagGroupExec(options Options, args []string, databasePath string) (error, warnings) {
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--delete") {
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+
+		return deleteTagGroups(store, tx, args)
+	}
+
+	if len(args) > 0 && args[0] == "set" {
+		if len(args) < 3 {
+			return errTooFewArguments, nil
+		}
+
+		if err := entities.ValidateTagGroupName(args[1]); err != nil {
+			return err, nil
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+
+		return setTagGroup(store, tx, args[1], args[2:])
+	}
+
+	return listTagGroups(store, tx, args, asJson)
+}
+
+func listTagGroups(store *storage.Storage, tx *storage.Tx, groupNames []string, asJson bool) (error, warnings) {
+	log.Infof(2, "retrieving tag groups")
+
+	tagGroups, err := store.TagGroups(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag groups: %w", err), nil
+	}
+
+	var warnings warnings
+	if len(groupNames) > 0 {
+		selected := make(entities.TagGroups, 0, len(groupNames))
+		for _, groupName := range groupNames {
+			tagGroup := tagGroups.Named(groupName)
+			if tagGroup == nil {
+				warnings = append(warnings, fmt.Errorf("no such tag group '%v'", groupName))
+				continue
+			}
+
+			selected = append(selected, tagGroup)
+		}
+
+		tagGroups = selected
+	}
+
+	if asJson {
+		jsonTagGroups := make([]jsonTagGroup, len(tagGroups))
+		for index, tagGroup := range tagGroups {
+			tagNames := make([]string, len(tagGroup.Tags))
+			for tagIndex, tag := range tagGroup.Tags {
+				tagNames[tagIndex] = tag.Name
+			}
+
+			jsonTagGroups[index] = jsonTagGroup{tagGroup.Name, tagNames}
+		}
+
+		return printJson(jsonTagGroups), warnings
+	}
+
+	for _, tagGroup := range tagGroups {
+		tagNames := make([]string, len(tagGroup.Tags))
+		for index, tag := range tagGroup.Tags {
+			tagNames[index] = escape(tag.Name, '=', ' ')
+		}
+
+		fmt.Printf("%v: %v\n", tagGroup.Name, strings.Join(tagNames, " "))
+	}
+
+	return nil, warnings
+}
+
+func setTagGroup(store *storage.Storage, tx *storage.Tx, groupName string, tagArgs []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, tagArg := range tagArgs {
+		tagName := parseTagOrValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			tag, err = createTag(store, tx, tagName)
+			if err != nil {
+				return fmt.Errorf("could not create tag '%v': %w", tagName, err), warnings
+			}
+		}
+
+		log.Infof(2, "adding tag '%v' to group '%v'", tag.Name, groupName)
+
+		if err := store.SetTagGroup(tx, *tag, groupName); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return nil, warnings
+}
+
+func deleteTagGroups(store *storage.Storage, tx *storage.Tx, tagArgs []string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+
+	for _, tagArg := range tagArgs {
+		tagName := parseTagOrValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			warnings = append(warnings, NoSuchTagError{tagName})
+			continue
+		}
+
+		groupName, err := store.TagGroupName(tx, tag.Id)
+		if err != nil {
+			return fmt.Errorf("could not retrieve group of tag '%v': %w", tag.Name, err), warnings
+		}
+		if groupName == "" {
+			warnings = append(warnings, fmt.Errorf("tag '%v' is not in a group", tag.Name))
+			continue
+		}
+
+		log.Infof(2, "removing tag '%v' from group '%v'", tag.Name, groupName)
+
+		if err := store.DeleteTagGroup(tx, tag.Id); err != nil {
+			return fmt.Errorf("could not remove tag '%v' from group '%v': %w", tag.Name, groupName, err), warnings
+		}
+	}
+
+	return nil, warnings
+}
@@ -0,0 +1,208 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+)
+
+var TagInfoCommand = Command{
+	Name:     "tag-info",
+	Synopsis: "Describes tags",
+	Usages: []string{"tmsu tag-info set [--description=TEXT] [--color=COLOR] [--icon=ICON] TAG...",
+		"tmsu tag-info [TAG]..."},
+	Description: `Sets the description of each TAG, together with hints as to the color and icon with which graphical frontends may render it, creating the tags if they do not already exist.
+
+When run without 'set' shows the information of each TAG, or of every tag that has any if no tags are specified.
+
+Only the information specified is changed: an empty TEXT, COLOR or ICON removes it. COLOR is either a color name, such as 'blue', or an RGB triplet, such as '#1e90ff'. ICON is the name of an icon, such as 'camera', which TMSU does not interpret.
+
+The information is also listed by 'tags --long', included in the JSON output of 'tags' and exposed by the 'user.tmsu.description', 'user.tmsu.color' and 'user.tmsu.icon' extended attributes of the tag directories of the virtual filesystem.`,
+	Examples: []string{`$ tmsu tag-info set photo --description="Photographs and scans" --color=blue --icon=camera`,
+		`$ tmsu tag-info photo
+photo
+  description: Photographs and scans
+  color: blue
+  icon: camera`,
+		`$ tmsu tag-info set photo --icon=`},
+	Options: Options{Option{"--description", "-d", "the description of the tags", true, ""},
+		Option{"--icon", "-i", "the icon with which to render the tags", true, ""}},
+	Exec: tagInfoExec,
+}
+
+// unexported
+
+func tagInfoExec(options Options, args []string, databasePath string) (error, warnings) {
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if len(args) > 0 && args[0] == "set" {
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			return err, nil
+		}
+
+		return setTagInfos(store, tx, args[1:], options)
+	}
+
+	if len(args) == 0 {
+		tagInfos, err := store.TagInfos(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag information: %w", err), nil
+		}
+
+		return printTagInfos(tagInfos, asJson), nil
+	}
+
+	return listTagInfosForTags(store, tx, args, asJson)
+}
+
+func listTagInfosForTags(store *storage.Storage, tx *storage.Tx, tagArgs []string, asJson bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+	tagInfos := make(entities.TagInfos, 0, len(tagArgs))
+
+	for _, tagArg := range tagArgs {
+		tagName := parseTagOrValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			warnings = append(warnings, NoSuchTagError{tagName})
+			continue
+		}
+
+		tagInfo, err := store.TagInfo(tx, *tag)
+		if err != nil {
+			return fmt.Errorf("could not retrieve information of tag '%v': %w", tag.Name, err), warnings
+		}
+
+		tagInfos = append(tagInfos, tagInfo)
+	}
+
+	return printTagInfos(tagInfos, asJson), warnings
+}
+
+func printTagInfos(tagInfos entities.TagInfos, asJson bool) error {
+	if asJson {
+		jsonTagInfos := make([]jsonTagInfo, len(tagInfos))
+		for index, tagInfo := range tagInfos {
+			jsonTagInfos[index] = jsonTagInfo{tagInfo.Tag.Name, tagInfo.Description, tagInfo.Colour, tagInfo.Icon}
+		}
+
+		return printJson(jsonTagInfos)
+	}
+
+	for _, tagInfo := range tagInfos {
+		fmt.Println(escape(tagInfo.Tag.Name, '=', ' '))
+
+		if tagInfo.Description != "" {
+			fmt.Printf("  description: %v\n", tagInfo.Description)
+		}
+		if tagInfo.Colour != "" {
+			fmt.Printf("  color: %v\n", tagInfo.Colour)
+		}
+		if tagInfo.Icon != "" {
+			fmt.Printf("  icon: %v\n", tagInfo.Icon)
+		}
+	}
+
+	return nil
+}
+
+// sets the information specified by the options, the color being given by the
+// global --color option as this command has no colored output
+func setTagInfos(store *storage.Storage, tx *storage.Tx, tagArgs []string, options Options) (error, warnings) {
+	description := options.Get("--description")
+	colour := options.Get("--color")
+	icon := options.Get("--icon")
+
+	if description == nil && colour == nil && icon == nil {
+		return fmt.Errorf("at least one of --description, --color or --icon must be specified"), nil
+	}
+
+	if colour != nil {
+		switch colour.Argument {
+		case "auto", "always", "never":
+			return fmt.Errorf("invalid color '%v': expected a color name or #RRGGBB", colour.Argument), nil
+		}
+
+		if err := entities.ValidateTagColour(colour.Argument); err != nil {
+			return err, nil
+		}
+	}
+
+	warnings := make(warnings, 0, 10)
+
+	for _, tagArg := range tagArgs {
+		tagName := parseTagOrValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			tag, err = createTag(store, tx, tagName)
+			if err != nil {
+				return fmt.Errorf("could not create tag '%v': %w", tagName, err), warnings
+			}
+		}
+
+		tagInfo, err := store.TagInfo(tx, *tag)
+		if err != nil {
+			return fmt.Errorf("could not retrieve information of tag '%v': %w", tag.Name, err), warnings
+		}
+
+		if description != nil {
+			tagInfo.Description = description.Argument
+		}
+		if colour != nil {
+			tagInfo.Colour = colour.Argument
+		}
+		if icon != nil {
+			tagInfo.Icon = icon.Argument
+		}
+
+		log.Infof(2, "setting information of tag '%v'", tag.Name)
+
+		if err := store.SetTagInfo(tx, *tagInfo); err != nil {
+			warnings = append(warnings, fmt.Errorf("could not set information of tag '%v': %w", tag.Name, err))
+		}
+	}
+
+	return nil, warnings
+}
@@ -19,19 +19,23 @@ import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
 	_path "github.com/oniony/TMSU/common/path"
-	"github.com/oniony/TMSU/common/terminal"
 	"github.com/oniony/TMSU/common/terminal/ansi"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var TagsCommand = Command{
 	Name:     "tags",
 	Synopsis: "List tags",
-	Usages:   []string{"tmsu tags [OPTION]... [FILE]..."},
+	Usages: []string{"tmsu tags [OPTION]... [FILE]...",
+		"tmsu tags [OPTION]... --recursive DIR..."},
 	Description: `Lists the tags applied to FILEs. If no FILE is specified then all tags in the database are listed.
 
 When color is turned on, tags are shown in the following colors:
@@ -40,194 +44,1182 @@ When color is turned on, tags are shown in the following colors:
   'Cyan'    Tag implied by other tags
   'Yellow'  Tag is both explicitly applied and implied by other tags
 
+Tags may be grouped into namespaces by prefixing their names with the namespace and a colon, e.g. 'person:alice'. The --namespace option lists only the tags within NAMESPACE.
+
+The --long option lists each tag on its own line together with its description, color and icon, as set by the 'tag-info' subcommand. With FILEs it instead lists the tags explicitly applied to each FILE together with when and by whom each was applied. Tags are attributed to the current user, or to the identity in TMSU_USER if set: see the built-in 'tagged-by' tag of the 'files' subcommand for querying files by who tagged them.
+
+The --explain option lists one tag per line and shows, for each implied tag, the chain of implications from an explicitly applied tag by which it is implied.
+
+The --chronological option lists the tags explicitly applied to each FILE one per line in the order in which they were applied, each with the time at which and the user by whom it was applied. Tags applied before TMSU recorded these times are listed first, without a time. See the built-in 'tagged-after' and 'tagged-before' tags of the 'files' subcommand for querying files by when they were tagged.
+
+The --intersection option lists only the tags that are applied to every one of the FILEs, whereas the --difference option lists, for each FILE, only the tags that are not applied to every one of them. These are useful before operating upon a selection of files to see which tags the files have in common.
+
+The --recursive option lists the tags applied anywhere at or beneath the DIRs specified: the union of the tags of each DIR and of every tagged file within it, as recorded in the database. A tag is shown as explicit where it is explicitly applied to any of the files. With --breakdown the tags of each of these files are listed separately instead.
+
+The --usage option lists each tag in the database, or within the NAMESPACE, together with the number of files it is explicitly applied to. The --sort option orders the tags by name (the default) or by count, most used first.
+
+The --tree option lists the tags as an indented tree, together with the number of files each is explicitly applied to, so that a large taxonomy can be reviewed at a glance. Each tag is listed beneath its parent in the tag hierarchy, e.g. 'animal/cat' beneath 'animal', and beneath each tag it implies, e.g. 'cat' beneath 'animal' where 'cat' implies 'animal'. A tag that implies several tags is therefore listed several times. The --under option lists only the tree beneath TAG, and implies --tree.
+
+The --prune option deletes the tags that are applied to no files, neither explicitly nor by implication, after listing them and asking for confirmation. Tags that have child tags are not deleted. Specify --yes to delete them without confirmation.
+
 See the 'imply' subcommand for more information on implied tags.`,
 	Examples: []string{"$ tmsu tags\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3 boom.mp3\n./tralala.mp3: mp3 music opera\n./boom.mp3: mp3 music drum-n-bass",
 		"$ tmsu tags --count tralala.mp3",
-		"$ tmsu tags --value 2009 red"},
+		"$ tmsu tags --long\nmp3    MPEG audio (color: green)\nmusic\nopera  Opera recordings (icon: mask)",
+		"$ tmsu tags --long tralala.mp3\nmp3 (applied 2023-06-01 09:15:00 by alice)\nopera (applied 2024-01-05 18:30:12 by bob)",
+		"$ tmsu tags --explain tralala.mp3\nmp3\nmusic (implied by mp3)\nopera",
+		"$ tmsu tags --namespace person holiday.jpg\nperson:alice  person:bob",
+		"$ tmsu tags --chronological tralala.mp3\nmp3 (applied 2023-06-01 09:15:00)\nopera (applied 2024-01-05 18:30:12)",
+		"$ tmsu tags --intersection tralala.mp3 boom.mp3\nmp3  music",
+		"$ tmsu tags --difference tralala.mp3 boom.mp3\n./tralala.mp3: opera\n./boom.mp3: drum-n-bass",
+		"$ tmsu tags --recursive projects/website\ncss  html  javascript  web",
+		"$ tmsu tags --recursive --breakdown projects/website\n./projects/website: web\n./projects/website/index.html: html\n./projects/website/style.css: css",
+		"$ tmsu tags --value 2009 red",
+		"$ tmsu tags --usage --sort count\nmusic  12\nmp3     9\nopera   0",
+		"$ tmsu tags --tree\nmusic (12)\n  mp3 (9)\n  opera (0)",
+		"$ tmsu tags --under animal\nanimal (3)\n  animal/cat (2)\n  dog (1)",
+		"$ tmsu tags --prune\nopera\ndelete these 1 tag(s)? [y/N] y\ntmsu: deleted tag 'opera'"},
 	Options: Options{{"--count", "-c", "lists the number of tags rather than their names", false, ""},
 		{"", "-1", "list one tag per line", false, ""},
 		{"--explicit", "-e", "do not show implied tags", false, ""},
+		{"--long", "-l", "list tags with their descriptions, colors and icons, or when and by whom they were applied to FILEs", false, ""},
+		{"--explain", "-x", "show the implications by which implied tags are applied", false, ""},
+		{"--chronological", "-t", "list explicitly applied tags in the order they were applied", false, ""},
+		{"--intersection", "", "list only the tags applied to every FILE", false, ""},
+		{"--difference", "", "list only the tags not applied to every FILE", false, ""},
 		{"--name", "-n", "when to print the file/value name: auto, always, never", true, ""},
+		{"--namespace", "", "list only the tags within NAMESPACE", true, ""},
+		{"--usage", "", "list the number of files each tag is applied to", false, ""},
+		{"--sort", "-s", "sort tags: name, count", true, ""},
+		{"--recursive", "-r", "list the tags applied at or beneath the DIRs", false, ""},
+		{"--breakdown", "", "with --recursive, list the tags of each file separately", false, ""},
+		{"--tree", "", "list the tags as a tree of their implications and hierarchy", false, ""},
+		{"--under", "", "with --tree, list only the tree beneath TAG", true, ""},
+		{"--prune", "", "delete the tags applied to no files, after confirmation", false, ""},
+		yesOption,
 		{"--no-dereference", "-P", "do not follow symlinks (show tags for symlink itself)", false, ""},
 		{"--value", "-u", "show tags which utilise values", false, ""}},
 	Exec: tagsExec,
 }
 
-// unexported
+// unexported
+
+func tagsExec(options Options, args []string, databasePath string) (error, warnings) {
+	showCount := options.HasOption("--count")
+	onePerLine := options.HasOption("-1")
+	explicitOnly := options.HasOption("--explicit")
+	explain := options.HasOption("--explain")
+	intersection := options.HasOption("--intersection")
+	difference := options.HasOption("--difference")
+	long := options.HasOption("--long")
+	chronological := options.HasOption("--chronological")
+	usage := options.HasOption("--usage")
+	prune := options.HasOption("--prune")
+	tree := options.HasOption("--tree") || options.HasOption("--under")
+	recursive := options.HasOption("--recursive")
+	breakdown := options.HasOption("--breakdown")
+	format, err := newFormatter(options)
+	if err != nil {
+		return err, nil
+	}
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	if intersection || difference {
+		switch {
+		case intersection && difference:
+			return fmt.Errorf("the --intersection and --difference options are mutually exclusive"), nil
+		case len(args) == 0 || options.HasOption("--value"):
+			return fmt.Errorf("the --intersection and --difference options require at least one FILE"), nil
+		case intersection && explain:
+			return fmt.Errorf("the --explain option cannot be used with --intersection"), nil
+		}
+	}
+
+	if chronological {
+		switch {
+		case len(args) == 0 || options.HasOption("--value"):
+			return fmt.Errorf("the --chronological option requires at least one FILE"), nil
+		case intersection || difference || explain || showCount:
+			return fmt.Errorf("the --chronological option cannot be used with --intersection, --difference, --explain or --count"), nil
+		}
+	}
+
+	if long {
+		switch {
+		case options.HasOption("--value") || showCount:
+			return fmt.Errorf("the --long option cannot be used with --value or --count"), nil
+		case len(args) > 0 && (intersection || difference || explain):
+			return fmt.Errorf("the --long option cannot be used with --intersection, --difference or --explain"), nil
+		}
+	}
+
+	if breakdown && !recursive {
+		return fmt.Errorf("the --breakdown option requires --recursive"), nil
+	}
+
+	if recursive {
+		switch {
+		case len(args) == 0 || options.HasOption("--value"):
+			return fmt.Errorf("the --recursive option requires at least one DIR"), nil
+		case intersection || difference || explain || long || chronological:
+			return fmt.Errorf("the --recursive option cannot be used with --intersection, --difference, --explain, --long or --chronological"), nil
+		}
+	}
+
+	sortByCount := false
+	if options.HasOption("--sort") {
+		switch sort := options.Get("--sort").Argument; sort {
+		case "name":
+		case "count":
+			sortByCount = true
+		default:
+			return fmt.Errorf("invalid argument '%v' for '--sort'", sort), nil
+		}
+	}
+
+	if usage || prune || options.HasOption("--sort") {
+		switch {
+		case len(args) > 0 || options.HasOption("--value"):
+			return fmt.Errorf("the --usage, --sort and --prune options cannot be used with FILEs or --value"), nil
+		case long || showCount:
+			return fmt.Errorf("the --usage, --sort and --prune options cannot be used with --long or --count"), nil
+		case prune && (usage || options.HasOption("--sort")):
+			return fmt.Errorf("the --prune option cannot be used with --usage or --sort"), nil
+		}
+	}
+
+	if tree {
+		switch {
+		case len(args) > 0 || options.HasOption("--value"):
+			return fmt.Errorf("the --tree option cannot be used with FILEs or --value"), nil
+		case long || showCount || usage || prune || options.HasOption("--sort"):
+			return fmt.Errorf("the --tree option cannot be used with --long, --count, --usage, --sort or --prune"), nil
+		}
+	}
+
+	printName := "auto"
+	if options.HasOption("--name") {
+		printName = options.Get("--name").Argument
+	}
+
+	namespace := ""
+	if options.HasOption("--namespace") {
+		namespace = options.Get("--namespace").Argument
+
+		if err := entities.ValidateTagNamespace(namespace); err != nil {
+			return err, nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	if err := format.useCollation(store, tx); err != nil {
+		return err, nil
+	}
+
+	if options.HasOption("--value") {
+		return listTagsForValues(store, tx, args, namespace, showCount, onePerLine, format, asJson, printName)
+	}
+
+	if len(args) == 0 {
+		if prune {
+			return pruneTags(store, tx, namespace, options, asJson), nil
+		}
+
+		if tree {
+			under := ""
+			if options.HasOption("--under") {
+				under = options.Get("--under").Argument
+			}
+
+			return listTagTree(store, tx, namespace, under, format, asJson), nil
+		}
+
+		if usage || options.HasOption("--sort") {
+			return listTagUsage(store, tx, namespace, usage, sortByCount, onePerLine, format, asJson), nil
+		}
+
+		if namespace != "" {
+			return listNamespaceTags(store, tx, namespace, showCount, onePerLine, long, format, asJson), nil
+		}
+
+		return listAllTags(store, tx, showCount, onePerLine, long, format, asJson), nil
+	}
+
+	if recursive {
+		return listTagsRecursively(store, tx, args, namespace, showCount, onePerLine, explicitOnly, breakdown, format, asJson, printName)
+	}
+
+	if chronological || long {
+		return listTagApplications(store, tx, args, namespace, format, chronological, followSymlinks, asJson, printName)
+	}
+
+	if intersection {
+		return listSharedTagsForPaths(store, tx, args, namespace, showCount, onePerLine, explicitOnly, format, followSymlinks, asJson)
+	}
+
+	return listTagsForPaths(store, tx, args, namespace, showCount, onePerLine || explain, explicitOnly, explain, difference, format, followSymlinks, asJson, printName)
+}
+
+func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine, long bool, format *formatter, asJson bool) error {
+	log.Info(2, "retrieving all tags.")
+
+	if showCount {
+		count, err := store.TagCount(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag count: %w", err)
+		}
+
+		if asJson {
+			return printJson(count)
+		}
+
+		fmt.Println(count)
+		return nil
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %w", err)
+	}
+
+	if long {
+		return printLongTags(store, tx, tags, asJson)
+	}
+
+	return printTags(tags, onePerLine, format, asJson)
+}
+
+func listNamespaceTags(store *storage.Storage, tx *storage.Tx, namespace string, showCount, onePerLine, long bool, format *formatter, asJson bool) error {
+	log.Infof(2, "retrieving tags within namespace '%v'.", namespace)
+
+	tags, err := store.TagsByNamespace(tx, namespace)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %w", err)
+	}
+
+	if showCount {
+		if asJson {
+			return printJson(len(tags))
+		}
+
+		fmt.Println(len(tags))
+		return nil
+	}
+
+	if long {
+		return printLongTags(store, tx, tags, asJson)
+	}
+
+	return printTags(tags, onePerLine, format, asJson)
+}
+
+// lists the tags, or those within the namespace, with the number of files each
+// is explicitly applied to if usage is specified
+func listTagUsage(store *storage.Storage, tx *storage.Tx, namespace string, usage, sortByCount, onePerLine bool, format *formatter, asJson bool) error {
+	log.Info(2, "retrieving tag usage.")
+
+	tags, err := tagsWithinNamespace(store, tx, namespace)
+	if err != nil {
+		return err
+	}
+
+	counts, err := tagFileCounts(store, tx)
+	if err != nil {
+		return err
+	}
+
+	if sortByCount {
+		sort.SliceStable(tags, func(i, j int) bool {
+			return counts[tags[i].Id] > counts[tags[j].Id]
+		})
+	}
+
+	if !usage {
+		return printTags(tags, onePerLine, format, asJson)
+	}
+
+	if asJson {
+		jsonCounts := make([]jsonTagFileCount, len(tags))
+		for index, tag := range tags {
+			jsonCounts[index] = jsonTagFileCount{tag.Name, counts[tag.Id]}
+		}
+
+		return printJson(jsonCounts)
+	}
+
+	names := make([]string, len(tags))
+	maxLength := 0
+	for index, tag := range tags {
+		names[index] = escape(tag.Name, '=', ' ')
+		if len(names[index]) > maxLength {
+			maxLength = len(names[index])
+		}
+	}
+
+	for index, tag := range tags {
+		count := strconv.FormatUint(uint64(counts[tag.Id]), 10)
+		if format.colour {
+			count = ansi.Yellow(count)
+		}
+
+		fmt.Printf("%*s %v\n", -maxLength, names[index], count)
+	}
+
+	return nil
+}
+
+// lists the tags, or those within the namespace, as a tree in which each tag is
+// beneath its parent and the tags it implies, or only the tree beneath the tag
+// named under
+func listTagTree(store *storage.Storage, tx *storage.Tx, namespace, under string, format *formatter, asJson bool) error {
+	log.Info(2, "retrieving tag tree.")
+
+	tags, err := tagsWithinNamespace(store, tx, namespace)
+	if err != nil {
+		return err
+	}
+
+	counts, err := tagFileCounts(store, tx)
+	if err != nil {
+		return err
+	}
+
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve implications: %w", err)
+	}
+
+	children, isChild := tagTreeChildren(tags, implications)
+
+	roots := make(entities.Tags, 0, len(tags))
+	if under != "" {
+		tag, err := store.TagByName(tx, under)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", under, err)
+		}
+		if tag == nil {
+			return NoSuchTagError{under}
+		}
+
+		roots = append(roots, tag)
+	} else {
+		for _, tag := range tags {
+			if !isChild[tag.Id] {
+				roots = append(roots, tag)
+			}
+		}
+	}
+
+	if asJson {
+		nodes := make([]jsonTagTreeNode, 0, len(roots))
+		for _, tag := range roots {
+			nodes = append(nodes, jsonTagTree(tag, children, counts, map[entities.TagId]bool{}))
+		}
+
+		return printJson(nodes)
+	}
+
+	for _, tag := range roots {
+		printTagTree(tag, 0, children, counts, map[entities.TagId]bool{}, format)
+	}
+
+	return nil
+}
+
+// the tags beneath each tag within the tree, by name, and whether each tag is
+// beneath another
+func tagTreeChildren(tags entities.Tags, implications entities.Implications) (map[entities.TagId]entities.Tags, map[entities.TagId]bool) {
+	tagsById := make(map[entities.TagId]*entities.Tag, len(tags))
+	tagsByName := make(map[string]*entities.Tag, len(tags))
+	for _, tag := range tags {
+		tagsById[tag.Id] = tag
+		tagsByName[tag.Name] = tag
+	}
+
+	children := make(map[entities.TagId]entities.Tags)
+	isChild := make(map[entities.TagId]bool)
+	addChild := func(parentId entities.TagId, child *entities.Tag) {
+		if parentId == child.Id || children[parentId].Contains(child) {
+			return
+		}
+
+		children[parentId] = append(children[parentId], child)
+		isChild[child.Id] = isChild[child.Id] || tagsById[parentId] != nil
+	}
+
+	for _, tag := range tags {
+		if parent, ok := tagsByName[entities.ParentTagName(tag.Name)]; ok {
+			addChild(parent.Id, tag)
+		}
+	}
+
+	// implications involving built-in tags, or tags outside the namespace, are omitted
+	for _, implication := range implications {
+		if implying := tagsById[implication.ImplyingTag.Id]; implying != nil {
+			addChild(implication.ImpliedTag.Id, implying)
+		}
+	}
+
+	for _, tags := range children {
+		sort.Sort(tags)
+	}
+
+	return children, isChild
+}
+
+func printTagTree(tag *entities.Tag, depth int, children map[entities.TagId]entities.Tags, counts map[entities.TagId]uint, ancestors map[entities.TagId]bool, format *formatter) {
+	count := strconv.FormatUint(uint64(counts[tag.Id]), 10)
+	if format.colour {
+		count = ansi.Yellow(count)
+	}
+
+	fmt.Printf("%v%v (%v)\n", strings.Repeat("  ", depth), escape(tag.Name, '=', ' '), count)
+
+	// a tag beneath a tag it is itself above, as when a tag implies its own
+	// child, is not descended into again
+	ancestors[tag.Id] = true
+	defer delete(ancestors, tag.Id)
+
+	for _, child := range children[tag.Id] {
+		if !ancestors[child.Id] {
+			printTagTree(child, depth+1, children, counts, ancestors, format)
+		}
+	}
+}
+
+func jsonTagTree(tag *entities.Tag, children map[entities.TagId]entities.Tags, counts map[entities.TagId]uint, ancestors map[entities.TagId]bool) jsonTagTreeNode {
+	ancestors[tag.Id] = true
+	defer delete(ancestors, tag.Id)
+
+	node := jsonTagTreeNode{tag.Name, counts[tag.Id], make([]jsonTagTreeNode, 0, len(children[tag.Id]))}
+	for _, child := range children[tag.Id] {
+		if !ancestors[child.Id] {
+			node.Children = append(node.Children, jsonTagTree(child, children, counts, ancestors))
+		}
+	}
+
+	return node
+}
+
+// deletes the tags, or those within the namespace, that are applied to no files,
+// once confirmed
+func pruneTags(store *storage.Storage, tx *storage.Tx, namespace string, options Options, asJson bool) error {
+	log.Info(2, "identifying unused tags.")
+
+	unused, err := unusedTags(store, tx, namespace)
+	if err != nil {
+		return err
+	}
+
+	if len(unused) > 0 {
+		names := make([]string, len(unused))
+		for index, tag := range unused {
+			names[index] = escape(tag.Name, '=', ' ')
+		}
+
+		confirmed, err := confirm(options, names, fmt.Sprintf("delete these %v tag(s)?", len(unused)))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			unused = nil
+		}
+	}
+
+	tagNames := make([]string, 0, len(unused))
+	if len(unused) > 0 {
+		if err := backupBeforeChange(store, tx); err != nil {
+			return err
+		}
+
+		if err := beginOperation(store, tx); err != nil {
+			return err
+		}
+
+		for _, tag := range unused {
+			if err := store.DeleteTag(tx, tag.Id); err != nil {
+				return fmt.Errorf("could not delete tag '%v': %w", tag.Name, err)
+			}
+
+			if !asJson {
+				log.Warnf("deleted tag '%v'", tag.Name)
+			}
+			tagNames = append(tagNames, tag.Name)
+		}
+	}
+
+	if asJson {
+		return printJson(tagNames)
+	}
+
+	return nil
+}
+
+// the tags, or those within the namespace, that are applied to no files either
+// explicitly or by implication, other than those with child tags
+func unusedTags(store *storage.Storage, tx *storage.Tx, namespace string) (entities.Tags, error) {
+	tags, err := tagsWithinNamespace(store, tx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := tagFileCounts(store, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	unused := make(entities.Tags, 0, 10)
+	for _, tag := range tags {
+		if counts[tag.Id] > 0 {
+			continue
+		}
+
+		fileCount, err := store.FileCountForQuery(tx, query.TagExpression{tag.Name}, nil, "", false, false)
+		if err != nil {
+			return nil, fmt.Errorf("could not count files tagged '%v': %w", tag.Name, err)
+		}
+		if fileCount > 0 {
+			continue
+		}
+
+		childCount, err := store.ChildTagCount(tx, tag.Id)
+		if err != nil {
+			return nil, fmt.Errorf("could not count child tags of '%v': %w", tag.Name, err)
+		}
+		if childCount > 0 {
+			continue
+		}
+
+		unused = append(unused, tag)
+	}
+
+	return unused, nil
+}
+
+func tagsWithinNamespace(store *storage.Storage, tx *storage.Tx, namespace string) (entities.Tags, error) {
+	var tags entities.Tags
+	var err error
+	if namespace != "" {
+		tags, err = store.TagsByNamespace(tx, namespace)
+	} else {
+		tags, err = store.Tags(tx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// the number of files each tag is explicitly applied to, keyed by tag ID
+func tagFileCounts(store *storage.Storage, tx *storage.Tx) (map[entities.TagId]uint, error) {
+	usages, err := store.TopTagUsage(tx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag usage: %w", err)
+	}
+
+	counts := make(map[entities.TagId]uint, len(usages))
+	for _, usage := range usages {
+		counts[usage.Id] = usage.FileCount
+	}
+
+	return counts, nil
+}
+
+func printTags(tags entities.Tags, onePerLine bool, format *formatter, asJson bool) error {
+	switch {
+	case asJson:
+		tagNames := make([]string, len(tags))
+		for index, tag := range tags {
+			tagNames[index] = tag.Name
+		}
+
+		return printJson(tagNames)
+	case onePerLine:
+		for _, tag := range tags {
+			fmt.Println(escape(tag.Name, '=', ' '))
+		}
+	default:
+		tagNames := make([]string, len(tags))
+		for index, tag := range tags {
+			tagNames[index] = escape(tag.Name, '=', ' ')
+		}
+
+		format.printColumns(tagNames)
+	}
+
+	return nil
+}
+
+func printLongTags(store *storage.Storage, tx *storage.Tx, tags entities.Tags, asJson bool) error {
+	tagInfos := make(entities.TagInfos, len(tags))
+	for index, tag := range tags {
+		tagInfo, err := store.TagInfo(tx, *tag)
+		if err != nil {
+			return fmt.Errorf("could not retrieve information of tag '%v': %w", tag.Name, err)
+		}
+
+		tagInfos[index] = tagInfo
+	}
+
+	if asJson {
+		jsonTagInfos := make([]jsonTagInfo, len(tagInfos))
+		for index, tagInfo := range tagInfos {
+			jsonTagInfos[index] = jsonTagInfo{tagInfo.Tag.Name, tagInfo.Description, tagInfo.Colour, tagInfo.Icon}
+		}
+
+		return printJson(jsonTagInfos)
+	}
+
+	width := 0
+	for _, tagInfo := range tagInfos {
+		if name := escape(tagInfo.Tag.Name, '=', ' '); !tagInfo.IsEmpty() && len(name) > width {
+			width = len(name)
+		}
+	}
+
+	for _, tagInfo := range tagInfos {
+		name := escape(tagInfo.Tag.Name, '=', ' ')
+		if tagInfo.IsEmpty() {
+			fmt.Println(name)
+			continue
+		}
+
+		hints := make([]string, 0, 2)
+		if tagInfo.Colour != "" {
+			hints = append(hints, "color: "+tagInfo.Colour)
+		}
+		if tagInfo.Icon != "" {
+			hints = append(hints, "icon: "+tagInfo.Icon)
+		}
+
+		details := make([]string, 0, 2)
+		if tagInfo.Description != "" {
+			details = append(details, tagInfo.Description)
+		}
+		if len(hints) > 0 {
+			details = append(details, "("+strings.Join(hints, ", ")+")")
+		}
+
+		fmt.Printf("%-*v  %v\n", width, name, strings.Join(details, " "))
+	}
+
+	return nil
+}
+
+func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, namespace string, showCount, onePerLine, explicitOnly, explain, difference bool, format *formatter, followSymlinks, asJson bool, printPathWhen string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+	jsonFiles := make([]jsonFileTags, 0, len(paths))
+	jsonCounts := make([]jsonFileTagCount, 0, len(paths))
+
+	printPath := printPathWhen != "never" && (printPathWhen == "always" || len(paths) > 1 || !stdoutIsCharDevice())
+
+	var excluded entities.TagIdValueIdPairs
+	if difference {
+		shared, _, sharedWarnings, err := sharedTagsForPaths(store, tx, paths, explicitOnly, followSymlinks)
+		if err != nil {
+			return err, sharedWarnings
+		}
+
+		excluded = shared
+	}
+
+	for index, path := range paths {
+		file, warning, err := fileForTagsPath(store, tx, path, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if warning != nil {
+			warnings = append(warnings, warning)
+			continue
+		}
+
+		var tagNames []string
+		var jsonTags []jsonTag
+		if file != nil {
+			tagNames, err = tagNamesForFile(store, tx, file.Id, namespace, explicitOnly, explain, format.colour, excluded)
+			if err != nil {
+				return err, warnings
+			}
+
+			if asJson {
+				jsonTags, err = jsonTagsForFile(store, tx, file.Id, namespace, explicitOnly, explain, excluded)
+				if err != nil {
+					return err, warnings
+				}
+			}
+		}
+
+		escapedPath := escapeControl(escape(path, '\\', ':'))
+		switch {
+		case asJson && showCount:
+			jsonCounts = append(jsonCounts, jsonFileTagCount{path, len(tagNames)})
+		case asJson:
+			if jsonTags == nil {
+				jsonTags = []jsonTag{}
+			}
+
+			jsonFiles = append(jsonFiles, jsonFileTags{path, jsonTags})
+		case showCount:
+			if printPath {
+				fmt.Print(escapedPath + ": ")
+			}
+
+			fmt.Println(strconv.Itoa(len(tagNames)))
+		case onePerLine:
+			if index > 0 {
+				fmt.Println()
+			}
+
+			if printPath {
+				fmt.Println(escapedPath + ":")
+			}
+
+			for _, tagName := range tagNames {
+				fmt.Println(tagName)
+			}
+		default:
+			if printPath {
+				fmt.Print(escapedPath + ":")
+
+				for _, tagName := range tagNames {
+					fmt.Print(" " + tagName)
+				}
+
+				fmt.Println()
+			} else {
+				format.printColumns(tagNames)
+			}
+		}
+	}
+
+	switch {
+	case asJson && showCount:
+		return printJson(jsonCounts), warnings
+	case asJson:
+		return printJson(jsonFiles), warnings
+	}
+
+	return nil, warnings
+}
+
+// lists the tags explicitly applied to each of the files together with when and by whom
+// they were applied, in the order they were applied if chronological or else by name
+func listTagApplications(store *storage.Storage, tx *storage.Tx, paths []string, namespace string, format *formatter, chronological, followSymlinks, asJson bool, printPathWhen string) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+	jsonFiles := make([]jsonFileTags, 0, len(paths))
+
+	printPath := printPathWhen != "never" && (printPathWhen == "always" || len(paths) > 1 || !stdoutIsCharDevice())
+
+	for index, path := range paths {
+		file, warning, err := fileForTagsPath(store, tx, path, followSymlinks)
+		if err != nil {
+			return err, warnings
+		}
+		if warning != nil {
+			warnings = append(warnings, warning)
+			continue
+		}
+
+		var fileTags entities.FileTags
+		if file != nil {
+			// implied tags are never applied so only the explicit tags have times and users
+			fileTags, err = store.FileTagsByFileId(tx, file.Id, true)
+			if err != nil {
+				return fmt.Errorf("could not retrieve file-tags for file '%v': %w", file.Id, err), warnings
+			}
+		}
+
+		if chronological {
+			// tags applied at unknown times have a zero time and so sort first
+			sort.SliceStable(fileTags, func(i, j int) bool {
+				return fileTags[i].Applied.Before(fileTags[j].Applied)
+			})
+		}
+
+		if asJson {
+			jsonTags := make([]jsonTag, 0, len(fileTags))
+			for _, fileTag := range fileTags {
+				fileJsonTags, err := jsonTagsForFileTags(store, tx, entities.FileTags{fileTag}, namespace, nil)
+				if err != nil {
+					return err, warnings
+				}
+				if len(fileJsonTags) == 0 {
+					continue
+				}
+
+				if !fileTag.Applied.IsZero() {
+					fileJsonTags[0].Applied = &fileTag.Applied
+				}
+				fileJsonTags[0].AppliedBy = fileTag.AppliedBy
+
+				jsonTags = append(jsonTags, fileJsonTags[0])
+			}
+
+			if !chronological {
+				collator, err := store.Collator(tx)
+				if err != nil {
+					return fmt.Errorf("could not retrieve collation: %w", err), warnings
+				}
+
+				sort.SliceStable(jsonTags, func(i, j int) bool {
+					if jsonTags[i].Name != jsonTags[j].Name {
+						return collator.Less(jsonTags[i].Name, jsonTags[j].Name)
+					}
+					return collator.Less(jsonTags[i].Value, jsonTags[j].Value)
+				})
+			}
+
+			jsonFiles = append(jsonFiles, jsonFileTags{path, jsonTags})
+			continue
+		}
+
+		lines := make([]string, 0, len(fileTags))
+		for _, fileTag := range fileTags {
+			taggings, err := tagNamesForFileTags(store, tx, entities.FileTags{fileTag}, namespace, nil, format.colour)
+			if err != nil {
+				return err, warnings
+			}
+			if len(taggings) == 0 {
+				continue
+			}
+
+			if application := describeApplication(fileTag); application != "" {
+				lines = append(lines, taggings[0]+" ("+application+")")
+			} else {
+				lines = append(lines, taggings[0])
+			}
+		}
+
+		if !chronological {
+			if err := sortTaggings(store, tx, lines); err != nil {
+				return err, warnings
+			}
+		}
+
+		if index > 0 {
+			fmt.Println()
+		}
+
+		if printPath {
+			fmt.Println(escapeControl(escape(path, '\\', ':')) + ":")
+		}
+
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+
+	if asJson {
+		return printJson(jsonFiles), warnings
+	}
+
+	return nil, warnings
+}
+
+// describes when and by whom the file tag was applied, so far as is known
+func describeApplication(fileTag *entities.FileTag) string {
+	switch {
+	case fileTag.Applied.IsZero() && fileTag.AppliedBy == "":
+		return ""
+	case fileTag.Applied.IsZero():
+		return "applied by " + fileTag.AppliedBy
+	case fileTag.AppliedBy == "":
+		return "applied " + fileTag.Applied.Local().Format("2006-01-02 15:04:05")
+	default:
+		return "applied " + fileTag.Applied.Local().Format("2006-01-02 15:04:05") + " by " + fileTag.AppliedBy
+	}
+}
+
+func listSharedTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, namespace string, showCount, onePerLine, explicitOnly bool, format *formatter, followSymlinks, asJson bool) (error, warnings) {
+	shared, fileIds, warnings, err := sharedTagsForPaths(store, tx, paths, explicitOnly, followSymlinks)
+	if err != nil {
+		return err, warnings
+	}
+
+	// a shared tag is shown as explicit only where it is explicitly applied to every file
+	sharedFileTags := make(entities.FileTags, len(shared))
+	for index, pair := range shared {
+		sharedFileTags[index] = &entities.FileTag{0, pair.TagId, pair.ValueId, true, false, time.Time{}, ""}
+	}
+
+	for _, fileId := range fileIds {
+		fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file-tags for file '%v': %w", fileId, err), warnings
+		}
 
-func tagsExec(options Options, args []string, databasePath string) (error, warnings) {
-	showCount := options.HasOption("--count")
-	onePerLine := options.HasOption("-1")
-	explicitOnly := options.HasOption("--explicit")
-	followSymlinks := !options.HasOption("--no-dereference")
-	colour, err := useColour(options)
-	if err != nil {
-		return err, nil
+		for _, sharedFileTag := range sharedFileTags {
+			for _, fileTag := range fileTags {
+				if fileTag.ToTagIdValueIdPair() == sharedFileTag.ToTagIdValueIdPair() {
+					sharedFileTag.Explicit = sharedFileTag.Explicit && fileTag.Explicit
+					sharedFileTag.Implicit = sharedFileTag.Implicit || fileTag.Implicit
+				}
+			}
+		}
 	}
 
-	printName := "auto"
-	if options.HasOption("--name") {
-		printName = options.Get("--name").Argument
+	if asJson {
+		jsonTags, err := jsonTagsForFileTags(store, tx, sharedFileTags, namespace, nil)
+		if err != nil {
+			return err, warnings
+		}
+
+		if showCount {
+			return printJson(len(jsonTags)), warnings
+		}
+
+		return printJson(jsonTags), warnings
 	}
 
-	store, err := openDatabase(databasePath)
+	tagNames, err := tagNamesForFileTags(store, tx, sharedFileTags, namespace, nil, format.colour)
 	if err != nil {
-		return err, nil
+		return err, warnings
 	}
-	defer store.Close()
 
-	tx, err := store.Begin()
+	switch {
+	case showCount:
+		fmt.Println(strconv.Itoa(len(tagNames)))
+	case onePerLine:
+		for _, tagName := range tagNames {
+			fmt.Println(tagName)
+		}
+	default:
+		format.printColumns(tagNames)
+	}
+
+	return nil, warnings
+}
+
+// lists the tags applied to the directories and the files within them, either
+// combined or, with breakdown, file by file
+func listTagsRecursively(store *storage.Storage, tx *storage.Tx, dirs []string, namespace string, showCount, onePerLine, explicitOnly, breakdown bool, format *formatter, asJson bool, printPathWhen string) (error, warnings) {
+	files, err := filesAtOrBeneath(store, tx, dirs)
 	if err != nil {
 		return err, nil
 	}
-	defer tx.Commit()
 
-	if options.HasOption("--value") {
-		return listTagsForValues(store, tx, args, showCount, onePerLine, colour, printName)
-	}
+	if breakdown {
+		paths := make([]string, len(files))
+		for index, file := range files {
+			paths[index] = displayPath(file.Path())
+		}
 
-	if len(args) == 0 {
-		return listAllTags(store, tx, showCount, onePerLine), nil
+		if len(paths) == 0 {
+			return nil, nil
+		}
+
+		return listTagsForPaths(store, tx, paths, namespace, showCount, onePerLine, explicitOnly, false, false, format, false, asJson, printPathWhen)
 	}
 
-	return listTagsForPaths(store, tx, args, showCount, onePerLine, explicitOnly, colour, followSymlinks, printName)
-}
+	// a tag is shown as explicit where it is explicitly applied to any file
+	merged := make(map[entities.TagIdValueIdPair]*entities.FileTag)
+	unionFileTags := make(entities.FileTags, 0, 10)
+	for _, file := range files {
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, explicitOnly)
+		if err != nil {
+			return fmt.Errorf("could not retrieve file-tags for file '%v': %w", file.Id, err), nil
+		}
 
-func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool) error {
-	log.Info(2, "retrieving all tags.")
+		for _, fileTag := range fileTags {
+			pair := fileTag.ToTagIdValueIdPair()
 
-	if showCount {
-		count, err := store.TagCount(tx)
-		if err != nil {
-			return fmt.Errorf("could not retrieve tag count: %v", err)
+			unionFileTag, ok := merged[pair]
+			if !ok {
+				unionFileTag = &entities.FileTag{0, pair.TagId, pair.ValueId, false, false, time.Time{}, ""}
+				merged[pair] = unionFileTag
+				unionFileTags = append(unionFileTags, unionFileTag)
+			}
+
+			unionFileTag.Explicit = unionFileTag.Explicit || fileTag.Explicit
+			unionFileTag.Implicit = unionFileTag.Implicit || fileTag.Implicit
 		}
+	}
 
-		fmt.Println(count)
-	} else {
-		tags, err := store.Tags(tx)
+	if asJson {
+		jsonTags, err := jsonTagsForFileTags(store, tx, unionFileTags, namespace, nil)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tags: %v", err)
+			return err, nil
 		}
 
-		if onePerLine {
-			for _, tag := range tags {
-				fmt.Println(escape(tag.Name, '=', ' '))
-			}
-		} else {
-			tagNames := make([]string, len(tags))
-			for index, tag := range tags {
-				tagNames[index] = escape(tag.Name, '=', ' ')
-			}
+		if showCount {
+			return printJson(len(jsonTags)), nil
+		}
+
+		return printJson(jsonTags), nil
+	}
 
-			terminal.PrintColumns(tagNames)
+	tagNames, err := tagNamesForFileTags(store, tx, unionFileTags, namespace, nil, format.colour)
+	if err != nil {
+		return err, nil
+	}
+
+	switch {
+	case showCount:
+		fmt.Println(strconv.Itoa(len(tagNames)))
+	case onePerLine:
+		for _, tagName := range tagNames {
+			fmt.Println(tagName)
 		}
+	default:
+		format.printColumns(tagNames)
 	}
 
-	return nil
+	return nil, nil
 }
 
-func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, colour, followSymlinks bool, printPathWhen string) (error, warnings) {
-	warnings := make(warnings, 0, 10)
-
-	printPath := printPathWhen != "never" && (printPathWhen == "always" || len(paths) > 1 || !stdoutIsCharDevice())
+// the files in the database at or beneath the directories, each once and
+// ordered by path
+func filesAtOrBeneath(store *storage.Storage, tx *storage.Tx, dirs []string) (entities.Files, error) {
+	seen := make(map[entities.FileId]bool)
+	files := make(entities.Files, 0, 10)
 
-	for index, path := range paths {
-		absPath, err := filepath.Abs(path)
+	for _, dir := range dirs {
+		absPath, err := filepath.Abs(dir)
 		if err != nil {
-			return err, warnings
+			return nil, fmt.Errorf("%v: could not get absolute path: %w", dir, err)
 		}
 
-		log.Infof(2, "%v: resolving path", absPath)
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file: %w", dir, err)
+		}
 
-		stat, err := os.Lstat(absPath)
+		dirFiles, err := store.FilesByDirectory(tx, absPath)
 		if err != nil {
-			switch {
-			case os.IsNotExist(err), os.IsPermission(err):
-				stat = emptyStat{}
-			default:
-				warnings = append(warnings, err.Error())
-				continue
-			}
-		} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-			absPath, err = _path.Dereference(absPath)
-			if err != nil {
-				warnings = append(warnings, err.Error())
-				continue
+			return nil, fmt.Errorf("%v: could not retrieve files for directory: %w", dir, err)
+		}
+
+		if file != nil {
+			dirFiles = append(entities.Files{file}, dirFiles...)
+		}
+
+		for _, dirFile := range dirFiles {
+			if !seen[dirFile.Id] {
+				seen[dirFile.Id] = true
+				files = append(files, dirFile)
 			}
 		}
+	}
 
-		log.Infof(2, "%v: retrieving tags", absPath)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Path() < files[j].Path()
+	})
 
-		file, err := store.FileByPath(tx, absPath)
+	return files, nil
+}
+
+// Determines the tags applied to every one of the files at the paths, together
+// with the IDs of the files. None are shared where any of the files is not in
+// the database.
+func sharedTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, explicitOnly, followSymlinks bool) (entities.TagIdValueIdPairs, entities.FileIds, warnings, error) {
+	warnings := make(warnings, 0, 10)
+	fileIds := make(entities.FileIds, 0, len(paths))
+	untagged := false
+
+	for _, path := range paths {
+		file, warning, err := fileForTagsPath(store, tx, path, followSymlinks)
 		if err != nil {
-			warnings = append(warnings, err.Error())
+			return nil, nil, warnings, err
+		}
+		if warning != nil {
+			warnings = append(warnings, warning)
 			continue
 		}
 
-		var tagNames []string
-		if file != nil {
-			tagNames, err = tagNamesForFile(store, tx, file.Id, explicitOnly, colour)
-			if err != nil {
-				return err, warnings
-			}
+		if file == nil {
+			untagged = true
 		} else {
-			_, err := os.Stat(absPath)
-			if err != nil {
-				switch {
-				case os.IsPermission(err):
-					warnings = append(warnings, fmt.Sprintf("%v: permission denied", absPath))
-					continue
-				case os.IsNotExist(err):
-					warnings = append(warnings, fmt.Sprintf("%v: no such file", absPath))
-					continue
-				default:
-					return fmt.Errorf("%v: could not stat file: %v", absPath, err), warnings
-				}
-			}
+			fileIds = append(fileIds, file.Id)
 		}
+	}
 
-		escapedPath := escape(path, '\\', ':')
-		switch {
-		case showCount:
-			if printPath {
-				fmt.Print(escapedPath + ": ")
-			}
+	if untagged || len(fileIds) == 0 {
+		return entities.TagIdValueIdPairs{}, nil, warnings, nil
+	}
 
-			fmt.Println(strconv.Itoa(len(tagNames)))
-		case onePerLine:
-			if index > 0 {
-				fmt.Println()
-			}
+	shared, err := store.SharedTagIdValueIdPairs(tx, fileIds, explicitOnly)
+	if err != nil {
+		return nil, nil, warnings, fmt.Errorf("could not determine shared tags: %w", err)
+	}
 
-			if printPath {
-				fmt.Println(escapedPath + ":")
-			}
+	return shared, fileIds, warnings, nil
+}
 
-			for _, tagName := range tagNames {
-				fmt.Println(tagName)
-			}
+// Looks up the file at the path, which is nil where the file exists but is not
+// in the database. A path that cannot be listed results in a warning.
+func fileForTagsPath(store *storage.Storage, tx *storage.Tx, path string, followSymlinks bool) (*entities.File, error, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Infof(2, "%v: resolving path", absPath)
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err), os.IsPermission(err):
+			stat = emptyStat{}
 		default:
-			if printPath {
-				fmt.Print(escapedPath + ":")
+			return nil, err, nil
+		}
+	} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return nil, err, nil
+		}
+	}
 
-				for _, tagName := range tagNames {
-					fmt.Print(" " + tagName)
-				}
+	log.Infof(2, "%v: retrieving tags", absPath)
 
-				fmt.Println()
-			} else {
-				terminal.PrintColumns(tagNames)
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, err, nil
+	}
+
+	if file == nil {
+		_, err := os.Stat(absPath)
+		if err != nil {
+			switch {
+			case os.IsPermission(err):
+				return nil, PermissionDeniedError{absPath}, nil
+			case os.IsNotExist(err):
+				return nil, NoSuchFileError{absPath}, nil
+			default:
+				return nil, nil, fmt.Errorf("%v: could not stat file: %w", absPath, err)
 			}
 		}
 	}
 
-	return nil, warnings
+	return file, nil, nil
 }
 
-func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []string, showCount, onePerLine, colour bool, printTagWhen string) (error, warnings) {
+func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []string, namespace string, showCount, onePerLine bool, format *formatter, asJson bool, printTagWhen string) (error, warnings) {
 	warnings := make(warnings, 0, 10)
+	jsonValues := make([]jsonValueTags, 0, len(valueNames))
+	jsonCounts := make([]jsonValueTagCount, 0, len(valueNames))
 
 	printTag := printTagWhen != "never" && (printTagWhen == "always" || len(valueNames) > 1 || !stdoutIsCharDevice())
 
@@ -239,7 +1231,7 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 			return err, warnings
 		}
 		if value == nil {
-			warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
+			warnings = append(warnings, NoSuchValueError{valueName})
 			continue
 		}
 
@@ -247,16 +1239,20 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 
 		var tagNames []string
 		if value != nil {
-			tagNames, err = tagNamesForValue(store, tx, value.Id)
+			tagNames, err = tagNamesForValue(store, tx, value.Id, namespace)
 			if err != nil {
 				return err, warnings
 			}
 		} else {
-			warnings = append(warnings, fmt.Sprintf("value '%v' does not exist", valueName))
+			warnings = append(warnings, fmt.Errorf("value '%v' does not exist", valueName))
 			continue
 		}
 
 		switch {
+		case asJson && showCount:
+			jsonCounts = append(jsonCounts, jsonValueTagCount{valueName, len(tagNames)})
+		case asJson:
+			jsonValues = append(jsonValues, jsonValueTags{valueName, tagNames})
 		case showCount:
 			if printTag {
 				fmt.Println(valueName + ":")
@@ -285,30 +1281,53 @@ func listTagsForValues(store *storage.Storage, tx *storage.Tx, valueNames []stri
 
 				fmt.Println()
 			} else {
-				terminal.PrintColumns(tagNames)
+				format.printColumns(tagNames)
 			}
 		}
 	}
 
+	switch {
+	case asJson && showCount:
+		return printJson(jsonCounts), warnings
+	case asJson:
+		return printJson(jsonValues), warnings
+	}
+
 	return nil, warnings
 }
 
-func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, explicitOnly, colour bool) ([]string, error) {
+func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, namespace string, explicitOnly, explain, colour bool, excluded entities.TagIdValueIdPairs) ([]string, error) {
 	fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", fileId, err)
+		return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %w", fileId, err)
 	}
 
-	taggings := make([]string, len(fileTags))
+	var chains map[entities.TagIdValueIdPair][]string
+	if explain {
+		if chains, err = implicationChains(store, tx, fileId, fileTags); err != nil {
+			return nil, err
+		}
+	}
+
+	fileTags = fileTags.Where(func(fileTag entities.FileTag) bool { return !excluded.Contains(fileTag.ToTagIdValueIdPair()) })
+
+	return tagNamesForFileTags(store, tx, fileTags, namespace, chains, colour)
+}
+
+func tagNamesForFileTags(store *storage.Storage, tx *storage.Tx, fileTags entities.FileTags, namespace string, chains map[entities.TagIdValueIdPair][]string, colour bool) ([]string, error) {
+	taggings := make([]string, 0, len(fileTags))
 
-	for index, fileTag := range fileTags {
+	for _, fileTag := range fileTags {
 		tag, err := store.Tag(tx, fileTag.TagId)
 		if err != nil {
-			return nil, fmt.Errorf("could not lookup tag: %v", err)
+			return nil, fmt.Errorf("could not lookup tag: %w", err)
 		}
 		if tag == nil {
 			return nil, fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
 		}
+		if !inNamespace(tag, namespace) {
+			continue
+		}
 
 		var tagging string
 		if fileTag.ValueId == 0 {
@@ -316,7 +1335,7 @@ func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.Fil
 		} else {
 			value, err := store.Value(tx, fileTag.ValueId)
 			if err != nil {
-				return nil, fmt.Errorf("could not lookup value: %v", err)
+				return nil, fmt.Errorf("could not lookup value: %w", err)
 			}
 			if value == nil {
 				return nil, fmt.Errorf("value '%v' does not exist", fileTag.ValueId)
@@ -325,18 +1344,203 @@ func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.Fil
 			tagging = formatTagValueName(tag.Name, value.Name, colour, fileTag.Implicit, fileTag.Explicit)
 		}
 
-		taggings[index] = tagging
+		if chain, ok := chains[fileTag.ToTagIdValueIdPair()]; ok {
+			tagging += " (implied by " + strings.Join(chain, " -> ") + ")"
+		}
+
+		taggings = append(taggings, tagging)
 	}
 
-	ansi.Sort(taggings)
+	if err := sortTaggings(store, tx, taggings); err != nil {
+		return nil, err
+	}
 
 	return taggings, nil
 }
 
-func tagNamesForValue(store *storage.Storage, tx *storage.Tx, valueId entities.ValueId) ([]string, error) {
+// sorts the formatted tags with the configured collation
+func sortTaggings(store *storage.Storage, tx *storage.Tx, taggings []string) error {
+	collator, err := store.Collator(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve collation: %w", err)
+	}
+
+	ansi.SortBy(taggings, collator.Less)
+
+	return nil
+}
+
+func jsonTagsForFile(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, namespace string, explicitOnly, explain bool, excluded entities.TagIdValueIdPairs) ([]jsonTag, error) {
+	fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %w", fileId, err)
+	}
+
+	var chains map[entities.TagIdValueIdPair][]string
+	if explain {
+		if chains, err = implicationChains(store, tx, fileId, fileTags); err != nil {
+			return nil, err
+		}
+	}
+
+	fileTags = fileTags.Where(func(fileTag entities.FileTag) bool { return !excluded.Contains(fileTag.ToTagIdValueIdPair()) })
+
+	return jsonTagsForFileTags(store, tx, fileTags, namespace, chains)
+}
+
+func jsonTagsForFileTags(store *storage.Storage, tx *storage.Tx, fileTags entities.FileTags, namespace string, chains map[entities.TagIdValueIdPair][]string) ([]jsonTag, error) {
+	jsonTags := make([]jsonTag, 0, len(fileTags))
+
+	for _, fileTag := range fileTags {
+		tag, err := store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not lookup tag: %w", err)
+		}
+		if tag == nil {
+			return nil, fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
+		}
+		if !inNamespace(tag, namespace) {
+			continue
+		}
+
+		value, err := store.Value(tx, fileTag.ValueId)
+		if err != nil {
+			return nil, fmt.Errorf("could not lookup value: %w", err)
+		}
+
+		var valueName string
+		if value != nil {
+			valueName = value.Name
+		}
+
+		tagInfo, err := store.TagInfo(tx, *tag)
+		if err != nil {
+			return nil, fmt.Errorf("could not lookup information of tag '%v': %w", tag.Name, err)
+		}
+
+		jsonTags = append(jsonTags, jsonTag{tag.Name, valueName, fileTag.Explicit, fileTag.Implicit, chains[fileTag.ToTagIdValueIdPair()], tagInfo.Description, tagInfo.Colour, tagInfo.Icon, nil, ""})
+	}
+
+	collator, err := store.Collator(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve collation: %w", err)
+	}
+
+	sort.Slice(jsonTags, func(i, j int) bool {
+		if jsonTags[i].Name == jsonTags[j].Name {
+			return collator.Less(jsonTags[i].Value, jsonTags[j].Value)
+		}
+
+		return collator.Less(jsonTags[i].Name, jsonTags[j].Name)
+	})
+
+	return jsonTags, nil
+}
+
+// Determines, for each implied tag of a file, the chain of tags by which it is
+// implied, beginning with an explicitly applied tag. Tags that are applied
+// explicitly have no chain.
+func implicationChains(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, fileTags entities.FileTags) (map[entities.TagIdValueIdPair][]string, error) {
+	implications, err := store.Implications(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %w", err)
+	}
+
+	names := make(map[entities.TagIdValueIdPair]string, len(fileTags))
+	parents := make(map[entities.TagIdValueIdPair]entities.TagIdValueIdPair, len(fileTags))
+	pending := make(entities.TagIdValueIdPairs, 0, len(fileTags))
+
+	for _, fileTag := range fileTags {
+		if !fileTag.Explicit {
+			continue
+		}
+
+		pair := fileTag.ToTagIdValueIdPair()
+
+		tag, err := store.Tag(tx, pair.TagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not lookup tag: %w", err)
+		}
+		if tag == nil {
+			return nil, fmt.Errorf("tag '%v' does not exist", pair.TagId)
+		}
+
+		valueName := ""
+		if pair.ValueId != 0 {
+			value, err := store.Value(tx, pair.ValueId)
+			if err != nil {
+				return nil, fmt.Errorf("could not lookup value: %w", err)
+			}
+			if value == nil {
+				return nil, fmt.Errorf("value '%v' does not exist", pair.ValueId)
+			}
+
+			valueName = value.Name
+		}
+
+		names[pair] = formatTagValueName(tag.Name, valueName, false, false, false)
+		pending = append(pending, pair)
+	}
+
+	file, err := store.File(tx, fileId)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file '%v': %w", fileId, err)
+	}
+	if file != nil {
+		attributeImplications, err := store.AttributeImplicationsFor(tx, file)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve implications: %w", err)
+		}
+
+		for _, implication := range attributeImplications {
+			pair := implication.ImplyingTagValuePair()
+			if _, seen := names[pair]; seen {
+				continue
+			}
+
+			names[pair] = formatTagValueName(implication.ImplyingTag.Name, implication.ImplyingValue.Name, false, false, false)
+			pending = append(pending, pair)
+		}
+	}
+
+	// breadth-first so that the shortest chain is found
+	for len(pending) > 0 {
+		pair := pending[0]
+		pending = pending[1:]
+
+		for _, implication := range implications {
+			if implication.ImplyingTag.Id != pair.TagId || (implication.ImplyingValue.Id != 0 && implication.ImplyingValue.Id != pair.ValueId) {
+				continue
+			}
+
+			impliedPair := implication.ImpliedTagValuePair()
+			if _, seen := names[impliedPair]; seen {
+				continue
+			}
+
+			names[impliedPair] = formatTagValueName(implication.ImpliedTag.Name, implication.ImpliedValue.Name, false, false, false)
+			parents[impliedPair] = pair
+			pending = append(pending, impliedPair)
+		}
+	}
+
+	chains := make(map[entities.TagIdValueIdPair][]string, len(parents))
+	for impliedPair := range parents {
+		chain := make([]string, 0, 2)
+		for pair, ok := parents[impliedPair]; ok; pair, ok = parents[pair] {
+			chain = append([]string{names[pair]}, chain...)
+		}
+
+		chains[impliedPair] = chain
+	}
+
+	return chains, nil
+}
+
+func tagNamesForValue(store *storage.Storage, tx *storage.Tx, valueId entities.ValueId, namespace string) ([]string, error) {
 	fileTags, err := store.FileTagsByValueId(tx, valueId)
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve file-tags for value '%v': %v", valueId, err)
+		return nil, fmt.Errorf("could not retrieve file-tags for value '%v': %w", valueId, err)
 	}
 
 	tagNames := make([]string, 0, 10)
@@ -344,22 +1548,29 @@ func tagNamesForValue(store *storage.Storage, tx *storage.Tx, valueId entities.V
 	for _, fileTag := range fileTags {
 		tag, err := store.Tag(tx, fileTag.TagId)
 		if err != nil {
-			return nil, fmt.Errorf("could not lookup tag: %v", err)
+			return nil, fmt.Errorf("could not lookup tag: %w", err)
 		}
 		if tag == nil {
 			return nil, fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
 		}
 
-		if !containsTagName(tagNames, tag.Name) {
+		if inNamespace(tag, namespace) && !containsTagName(tagNames, tag.Name) {
 			tagNames = append(tagNames, tag.Name)
 		}
 	}
 
-	ansi.Sort(tagNames)
+	if err := sortTaggings(store, tx, tagNames); err != nil {
+		return nil, err
+	}
 
 	return tagNames, nil
 }
 
+// whether the tag is within the namespace, or true if no namespace is specified
+func inNamespace(tag *entities.Tag, namespace string) bool {
+	return namespace == "" || entities.TagNamespace(tag.Name) == namespace
+}
+
 func containsTagName(tagNames []string, search string) bool {
 	for _, tagName := range tagNames {
 		if tagName == search {
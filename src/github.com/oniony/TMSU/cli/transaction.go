@@ -0,0 +1,302 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/storage"
+	"io"
+	"os"
+	"strings"
+)
+
+var TransactionCommand = Command{
+	Name:     "transaction",
+	Synopsis: "Run several commands atomically",
+	Usages:   []string{"tmsu transaction [FILE]"},
+	Description: `Runs the commands read from FILE, or from standard input if no FILE is specified, committing their changes only if every command succeeds.
+
+Each line holds a command and its arguments, without the leading 'tmsu', quoted as they would be for the shell. Blank lines and lines beginning with '#' are ignored.
+
+Should a command fail or report a problem then the remaining commands are not run and the changes made by the earlier commands are rolled back. Each command may be undone separately once the transaction is committed.
+
+The global --atomic option runs the commands given on the command-line, separated by ';' arguments, in the same way.`,
+	Examples: []string{"$ tmsu transaction restructure.txt",
+		`$ printf 'rename colour color\nmerge hue color\n' | tmsu transaction`,
+		`$ tmsu --atomic tag song.mp3 music \; untag song.mp3 unsorted`},
+	Options: Options{},
+	Exec:    transactionExec,
+}
+
+// unexported
+
+// a command to be run atomically with others
+type atomicStep struct {
+	command   *Command
+	options   Options
+	arguments []string
+	args      []string
+}
+
+var atomicCommands []*Command
+
+// the storage shared by the commands being run atomically, along with the path of its database
+var atomicStore *storage.Storage
+var atomicDatabasePath string
+
+// the command-line of the command being run atomically
+var atomicArgs []string
+
+// the separator between the commands run with --atomic
+const atomicSeparator = ";"
+
+func transactionExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 1 {
+		return errTooManyArguments, nil
+	}
+
+	reader := io.Reader(os.Stdin)
+	if len(args) == 1 {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("could not open '%v': %w", args[0], err), nil
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	lines, err := readAtomicLines(reader)
+	if err != nil {
+		return fmt.Errorf("could not read commands: %w", err), nil
+	}
+
+	steps, err := parseAtomicSteps(lines, options)
+	if err != nil {
+		return err, nil
+	}
+
+	return runAtomically(steps, databasePath)
+}
+
+// runs the command parsed from the first line of the command-line atomically
+// with those of the remaining lines
+func runAtomicArgs(command *Command, options Options, arguments []string, lines [][]string, databasePath string) (error, warnings) {
+	steps, err := parseAtomicSteps(lines[1:], options)
+	if err != nil {
+		return err, nil
+	}
+
+	first := atomicStep{command, options, arguments, lines[0]}
+
+	return runAtomically(append([]atomicStep{first}, steps...), databasePath)
+}
+
+// the command-line arguments split at each separator
+func splitAtomicArgs(args []string) [][]string {
+	lines := [][]string{}
+
+	start := 0
+	for index, arg := range args {
+		if arg == atomicSeparator {
+			lines = append(lines, args[start:index])
+			start = index + 1
+		}
+	}
+
+	return append(lines, args[start:])
+}
+
+// the commands read one per line, skipping blank lines and comments
+func readAtomicLines(reader io.Reader) ([][]string, error) {
+	lines := [][]string{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, text.Tokenize(line))
+	}
+
+	return lines, scanner.Err()
+}
+
+// parses the command of each line, which inherits the global options specified
+func parseAtomicSteps(lines [][]string, options Options) ([]atomicStep, error) {
+	inherited := inheritedOptions(options)
+	parser := NewOptionParser(globalOptions, atomicCommands)
+
+	steps := make([]atomicStep, 0, len(lines))
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+
+		step, err := parseAtomicStep(parser, line, inherited)
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, *step)
+	}
+
+	return steps, nil
+}
+
+// the global options specified that the commands run atomically inherit
+func inheritedOptions(options Options) Options {
+	inherited := make(Options, 0, len(options))
+	for _, option := range options {
+		if option.LongName != "--atomic" && lookupOption(globalOptions, option.LongName) != nil {
+			inherited = append(inherited, option)
+		}
+	}
+
+	return inherited
+}
+
+// parses the command of a line, refusing those that cannot be run atomically
+func parseAtomicStep(parser *OptionParser, line []string, inherited Options) (*atomicStep, error) {
+	command, stepOptions, arguments, err := parser.Parse(line...)
+	if err != nil {
+		return nil, UsageError{fmt.Sprintf("%v: %v", strings.Join(line, " "), err)}
+	}
+	if command == nil {
+		return nil, UsageError{fmt.Sprintf("%v: no subcommand specified", strings.Join(line, " "))}
+	}
+
+	switch {
+	case command.Name == "transaction", command.Name == "script", stepOptions.HasOption("--atomic"):
+		return nil, UsageError{fmt.Sprintf("%v: transactions cannot be nested", strings.Join(line, " "))}
+	case stepOptions.HasOption("--dry-run"):
+		return nil, UsageError{fmt.Sprintf("%v: --dry-run cannot be used within a transaction", strings.Join(line, " "))}
+	case stepOptions.HasOption("--database"):
+		return nil, UsageError{fmt.Sprintf("%v: the database cannot be changed within a transaction", strings.Join(line, " "))}
+	}
+
+	stepOptions = append(append(Options{}, inherited...), stepOptions...)
+
+	return &atomicStep{command, stepOptions, arguments, line}, nil
+}
+
+// runs the commands against the one database transaction, committing it only
+// if every command succeeds
+func runAtomically(steps []atomicStep, databasePath string) (error, warnings) {
+	run, err := beginAtomically(databasePath)
+	if err != nil {
+		return err, nil
+	}
+
+	for _, step := range steps {
+		if err, warnings := run.exec(step); err != nil {
+			return err, warnings
+		}
+	}
+
+	return run.end()
+}
+
+// the commands being run against the one database transaction along with the
+// post-command hooks to run once it is committed
+type atomicRun struct {
+	store     *storage.Storage
+	postHooks []*pendingHook
+}
+
+// opens the database and begins the transaction that the commands subsequently
+// run by exec share
+func beginAtomically(databasePath string) (*atomicRun, error) {
+	if atomicStore != nil {
+		return nil, UsageError{"transactions cannot be nested"}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.BeginBatch(); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	atomicStore, atomicDatabasePath = store, databasePath
+
+	return &atomicRun{store, make([]*pendingHook, 0, 10)}, nil
+}
+
+// runs the command, rolling back the transaction should it fail or report a
+// problem
+func (run *atomicRun) exec(step atomicStep) (error, warnings) {
+	log.Infof(2, "running '%v'.", strings.Join(step.args, " "))
+
+	atomicArgs = step.args
+	postHook, err, warnings := execBeforeHook(step.command, step.options, step.arguments, atomicDatabasePath)
+	if err == nil && len(warnings) == 0 {
+		if postHook != nil {
+			run.postHooks = append(run.postHooks, postHook)
+		}
+
+		return nil, nil
+	}
+
+	if err != nil {
+		warnings = append(warnings, err)
+	}
+
+	return run.abort(TransactionRolledBackError{strings.Join(step.args, " "), warnings[0]}, warnings)
+}
+
+// rolls back the transaction, returning the error that caused it
+func (run *atomicRun) abort(reason error, warnings warnings) (error, warnings) {
+	if err := run.finish(false); err != nil {
+		return fmt.Errorf("could not roll back transaction: %w", err), warnings
+	}
+
+	return reason, warnings
+}
+
+// commits the transaction and then runs the post-command hooks
+func (run *atomicRun) end() (error, warnings) {
+	databasePath := atomicDatabasePath
+
+	if err := run.finish(true); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err), nil
+	}
+
+	// the post-command hooks are run only once the changes are committed
+	warnings := make(warnings, 0, len(run.postHooks))
+	for _, postHook := range run.postHooks {
+		if err := postHook.run(databasePath); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return nil, warnings
+}
+
+func (run *atomicRun) finish(commit bool) error {
+	atomicStore, atomicDatabasePath, atomicArgs = nil, "", nil
+	defer run.store.Close()
+
+	return run.store.EndBatch(commit)
+}
@@ -0,0 +1,101 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"strconv"
+)
+
+var UndoCommand = Command{
+	Name:     "undo",
+	Synopsis: "Undo recent changes",
+	Usages:   []string{"tmsu undo [N]"},
+	Description: `Reverts the changes made by the last N operations, or the last operation if N is not specified.
+
+The changes made by the 'tag', 'untag', 'copy-tags', 'delete', 'merge' and 'rename' subcommands are recorded in a journal within the database. The journal holds the most recent 100 operations.`,
+	Examples: []string{"$ tmsu untag --all song.mp3\n$ tmsu undo\nundid 'tmsu untag --all song.mp3'",
+		"$ tmsu undo 3"},
+	Options: Options{},
+	Exec:    undoExec,
+}
+
+// unexported
+
+func undoExec(options Options, args []string, databasePath string) (error, warnings) {
+	if len(args) > 1 {
+		return errTooManyArguments, nil
+	}
+
+	count := uint64(1)
+	if len(args) == 1 {
+		var err error
+		count, err = strconv.ParseUint(args[0], 10, 0)
+		if err != nil || count == 0 {
+			return fmt.Errorf("invalid number of operations '%v'", args[0]), nil
+		}
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+
+	operations, err := store.LatestOperations(tx, uint(count))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not retrieve operations: %w", err), nil
+	}
+	if len(operations) == 0 {
+		tx.Rollback()
+		return fmt.Errorf("nothing to undo"), nil
+	}
+
+	for _, operation := range operations {
+		log.Infof(2, "undoing operation #%v.", operation.Id)
+
+		if err := store.UndoOperation(tx, operation.Id, commandLine()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not undo '%v': %w", operation.Command, err), nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit changes: %w", err), nil
+	}
+
+	for _, operation := range operations {
+		fmt.Printf("undid '%v'\n", operation.Command)
+	}
+
+	var warnings warnings
+	if uint64(len(operations)) < count {
+		warnings = append(warnings, fmt.Errorf("only %v operation(s) could be undone", len(operations)))
+	}
+
+	return nil, warnings
+}
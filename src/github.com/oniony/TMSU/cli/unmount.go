@@ -23,6 +23,7 @@ import (
 	"github.com/oniony/TMSU/vfs"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 var UnmountCommand = Command{
@@ -31,45 +32,53 @@ var UnmountCommand = Command{
 	Synopsis: "Unmount the virtual filesystem",
 	Usages: []string{"tmsu unmount MOUNTPOINT",
 		"tmsu unmount --all"},
-	Description: "Unmounts the virtual file-system at MOUNTPOINT.",
-	Options:     Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""}},
-	Exec:        unmountExec,
+	Description: `Unmounts the virtual file-system at MOUNTPOINT.
+
+With --all, every mounted virtual file-system is unmounted, including those left behind by a virtual file-system process that has exited. A failure to unmount one does not prevent the others being unmounted.
+
+The 'mounts' subcommand lists the mounted virtual file-systems.`,
+	Examples: []string{"$ tmsu unmount mp",
+		"$ tmsu unmount --all"},
+	Options: Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""}},
+	Exec:    unmountExec,
 }
 
 // unexported
 
 func unmountExec(options Options, args []string, databasePath string) (error, warnings) {
 	if options.HasOption("--all") {
-		return unmountAll(), nil
+		return unmountAll()
 	}
 
 	if len(args) < 1 {
-		return fmt.Errorf("too few arguments"), nil
+		return errTooFewArguments, nil
 	}
 
 	return unmount(args[0]), nil
 }
 
 func unmount(path string) error {
-	log.Info(2, "searching path for fusermount.")
+	program, args := unmountCommandLine(path)
 
-	fusermountPath, err := exec.LookPath("fusermount")
+	log.Infof(2, "searching path for %v.", program)
+
+	programPath, err := exec.LookPath(program)
 	if err != nil {
-		return fmt.Errorf("could not find 'fusermount': ensure fuse is installed: %v", err)
+		return fmt.Errorf("could not find '%v': ensure fuse is installed: %w", program, err)
 	}
 
-	log.Infof(2, "running: %v -u %v.", fusermountPath, path)
+	log.Infof(2, "running: %v %v.", programPath, strings.Join(args, " "))
 
-	process, err := os.StartProcess(fusermountPath, []string{fusermountPath, "-u", path}, &os.ProcAttr{})
+	process, err := os.StartProcess(programPath, append([]string{programPath}, args...), &os.ProcAttr{})
 	if err != nil {
-		return fmt.Errorf("could not start 'fusermount': %v", err)
+		return fmt.Errorf("could not start '%v': %w", program, err)
 	}
 
 	log.Info(2, "waiting for process to exit.")
 
 	processState, err := process.Wait()
 	if err != nil {
-		return fmt.Errorf("error waiting for process to exit: %v", err)
+		return fmt.Errorf("error waiting for process to exit: %w", err)
 	}
 	if !processState.Success() {
 		return fmt.Errorf("could not unmount virtual filesystem")
@@ -78,24 +87,25 @@ func unmount(path string) error {
 	return nil
 }
 
-func unmountAll() error {
+// unmounts every mounted virtual filesystem, carrying on past any that cannot be
+func unmountAll() (error, warnings) {
 	log.Info(2, "retrieving mount table.")
 
 	mt, err := vfs.GetMountTable()
 	if err != nil {
-		return fmt.Errorf("could not get mount table: %v", err)
+		return fmt.Errorf("could not get mount table: %w", err), nil
 	}
 
 	if len(mt) == 0 {
 		log.Info(2, "mount table is empty.")
 	}
 
+	warnings := make(warnings, 0, 10)
 	for _, mount := range mt {
-		err = unmount(mount.MountPath)
-		if err != nil {
-			return err
+		if err := unmount(mount.MountPath); err != nil {
+			warnings = append(warnings, fmt.Errorf("%v: %w", mount.MountPath, err))
 		}
 	}
 
-	return nil
+	return nil, warnings
 }
@@ -21,9 +21,11 @@ import (
 	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var UntagCommand = Command{
@@ -31,14 +33,29 @@ var UntagCommand = Command{
 	Synopsis: "Remove tags from files",
 	Usages: []string{"tmsu untag [OPTION]... FILE TAG[=VALUE]...",
 		"tmsu untag [OPTION]... --all FILE...",
-		`tmsu untag [OPTION]... --tags="TAG[=VALUE]..." FILE...`},
-	Description: "Disassociates FILE with the TAGs specified.",
+		`tmsu untag [OPTION]... --tags="TAG[=VALUE]..." FILE...`,
+		"tmsu untag [OPTION]... --where=QUERY TAG[=VALUE]..."},
+	Description: `Disassociates FILE with the TAGs specified.
+
+When --where is specified the TAGs are removed from every file matching QUERY (see the 'files' subcommand for the query syntax). Files matching the query that are not explicitly tagged with a TAG are skipped. With --pretend each tag that would be removed is listed rather than removed.
+
+Where a file has been tagged with several VALUEs of a TAG, specifying TAG=VALUE removes just that value whereas specifying the TAG alone removes the tag along with all of its values.
+
+When untagging recursively, hidden files and directories are skipped unless --include-hidden is specified, as are those excluded by a '.tmsuignore' file, as when tagging recursively. See the 'tag' subcommand for more information.
+
+The 'pre-untag' and 'post-untag' hooks, if present, are run before and after untagging. See the 'tag' subcommand for more information.`,
 	Examples: []string{"$ tmsu untag mountain.jpg hill county=germany",
+		"$ tmsu untag book.pdf author",
 		"$ tmsu untag --all mountain-copy.jpg",
-		`$ tmsu untag --tags="river underwater year=2017" forest.jpg desert.jpg`},
+		`$ tmsu untag --tags="river underwater year=2017" forest.jpg desert.jpg`,
+		`$ tmsu untag --where="temp and mtime-before=2022" temp`,
+		"$ tmsu untag --where=holiday --pretend draft\n/home/bob/beach.jpg: draft"},
 	Options: Options{{"--all", "-a", "strip each file of all tags", false, ""},
 		{"--tags", "-t", "the set of tags to remove", true, ""},
+		{"--where", "-w", "untags files matching QUERY", true, ""},
+		{"--pretend", "", "list the tags that would be removed by --where rather than removing them", false, ""},
 		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""},
+		{"--include-hidden", "-H", "don't skip hidden files/directories when untagging recursively", false, ""},
 		{"--no-dereference", "-P", "do not follow symbolic links (untag the link itself)", false, ""}},
 	Exec: untagExec,
 }
@@ -47,11 +64,11 @@ var UntagCommand = Command{
 
 func untagExec(options Options, args []string, databasePath string) (error, warnings) {
 	if len(args) < 1 {
-		return fmt.Errorf("too few arguments"), nil
+		return errTooFewArguments, nil
 	}
 
 	recursive := options.HasOption("--recursive")
-	followSymlinks := !options.HasOption("--no-dereference")
+	includeHidden := options.HasOption("--include-hidden")
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -59,20 +76,45 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 	}
 	defer store.Close()
 
+	followSymlinks, err := followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
 	}
 	defer tx.Commit()
 
-	if options.HasOption("--all") {
+	if isBulkUntag(options, args) {
+		if err := backupBeforeChange(store, tx); err != nil {
+			return err, nil
+		}
+	}
+
+	if err := beginOperation(store, tx); err != nil {
+		return err, nil
+	}
+
+	if options.HasOption("--where") {
+		if options.HasOption("--all") || options.HasOption("--tags") {
+			return fmt.Errorf("--where cannot be combined with --all or --tags"), nil
+		}
+
+		queryText := options.Get("--where").Argument
+
+		return untagWhere(store, tx, queryText, args, options.HasOption("--pretend"))
+	} else if options.HasOption("--pretend") {
+		return fmt.Errorf("--pretend requires --where"), nil
+	} else if options.HasOption("--all") {
 		if len(args) < 1 {
 			return fmt.Errorf("files to untag must be specified"), nil
 		}
 
 		paths := args
 
-		return untagPathsAll(store, tx, paths, recursive, followSymlinks)
+		return untagPathsAll(store, tx, paths, recursive, includeHidden, followSymlinks)
 	} else if options.HasOption("--tags") {
 		tagArgs := text.Tokenize(options.Get("--tags").Argument)
 		if len(tagArgs) == 0 {
@@ -84,7 +126,7 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 			return fmt.Errorf("at least one file to untag must be specified"), nil
 		}
 
-		return untagPaths(store, tx, paths, tagArgs, recursive, followSymlinks)
+		return untagPaths(store, tx, paths, tagArgs, recursive, includeHidden, followSymlinks)
 	} else {
 		if len(args) < 2 {
 			return fmt.Errorf("tags to remove and files to untag must be specified"), nil
@@ -93,60 +135,212 @@ func untagExec(options Options, args []string, databasePath string) (error, warn
 		paths := args[0:1]
 		tagArgs := args[1:]
 
-		return untagPaths(store, tx, paths, tagArgs, recursive, followSymlinks)
+		return untagPaths(store, tx, paths, tagArgs, recursive, includeHidden, followSymlinks)
+	}
+}
+
+// whether the files to untag are many, being those matching a query, those
+// beneath directories or several files
+func isBulkUntag(options Options, args []string) bool {
+	switch {
+	case options.HasOption("--where"):
+		return !options.HasOption("--pretend")
+	case options.HasOption("--recursive"):
+		return true
+	case options.HasOption("--all"), options.HasOption("--tags"):
+		return len(args) > 1
+	}
+
+	return false
+}
+
+func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recursive, includeHidden, followSymlinks bool) (error, warnings) {
+	files, warnings, err := resolveFilesToUntag(store, tx, paths, recursive, includeHidden, followSymlinks)
+	if err != nil {
+		return err, warnings
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %w", err), warnings
+	}
+
+	for _, file := range files {
+		log.Infof(2, "%v: removing all tags.", file.Path())
+
+		if settings.TagByContent() {
+			// each tag is removed individually so as to be removed from the file's content too
+			if err := untagFileContent(store, tx, file); err != nil {
+				return fmt.Errorf("%v: could not remove file's tags: %w", file.Path(), err), warnings
+			}
+
+			continue
+		}
+
+		if err := store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
+			return fmt.Errorf("%v: could not remove file's tags: %w", file.Path(), err), warnings
+		}
 	}
+
+	return nil, warnings
 }
 
-func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool) (error, warnings) {
+func untagWhere(store *storage.Storage, tx *storage.Tx, queryText string, tagArgs []string, pretend bool) (error, warnings) {
 	warnings := make(warnings, 0, 10)
 
-	for _, path := range paths {
-		absPath, err := filepath.Abs(path)
+	log.Info(2, "parsing query")
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return fmt.Errorf("could not parse query: %w", err), warnings
+	}
+
+	log.Info(2, "querying files")
+
+	files, err := store.FilesForQuery(tx, expression, nil, "", false, false, "name", false, 0)
+	if err != nil {
+		return fmt.Errorf("could not query files: %w", err), warnings
+	}
+
+	for _, tagArg := range tagArgs {
+		tagName, valueName := parseTagEqValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
 		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", path, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			warnings = append(warnings, NoSuchTagError{tagName})
+			continue
 		}
 
-		log.Infof(2, "%v: resolving path", path)
-
-		stat, err := os.Lstat(absPath)
+		value, err := store.ValueByName(tx, valueName)
 		if err != nil {
-			switch {
-			case os.IsNotExist(err), os.IsPermission(err):
-				// ignore
-			default:
-				return err, nil
-			}
-		} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-			absPath, err = _path.Dereference(absPath)
+			return fmt.Errorf("could not retrieve value '%v': %w", valueName, err), warnings
+		}
+		if value == nil {
+			warnings = append(warnings, NoSuchValueError{valueName})
+			continue
+		}
+
+		log.Infof(2, "removing tag '%v' from %v files", tag.Name, len(files))
+
+		for _, file := range files {
+			valueIds, err := valueIdsToUntag(store, tx, file.Id, tag.Id, value.Id)
 			if err != nil {
-				return err, nil
+				return fmt.Errorf("%v: could not retrieve tags: %w", file.Path(), err), warnings
+			}
+
+			for _, valueId := range valueIds {
+				exists, err := store.FileTagExists(tx, file.Id, tag.Id, valueId, true)
+				if err != nil {
+					return fmt.Errorf("could not check if tag exists: %w", err), warnings
+				}
+				if !exists {
+					continue
+				}
+
+				if pretend {
+					valueName := ""
+					if valueId != 0 {
+						value, err := store.Value(tx, valueId)
+						if err != nil {
+							return fmt.Errorf("could not retrieve value #%v: %w", valueId, err), warnings
+						}
+						if value == nil {
+							return fmt.Errorf("value '%v' does not exist", valueId), warnings
+						}
+
+						valueName = value.Name
+					}
+
+					fmt.Printf("%v: %v\n", displayPath(file.Path()), formatTagValueName(tag.Name, valueName, false, false, false))
+					continue
+				}
+
+				if err := store.DeleteFileTag(tx, file.Id, tag.Id, valueId); err != nil {
+					return fmt.Errorf("%v: could not remove tag '%v': %w", file.Path(), tag.Name, err), warnings
+				}
 			}
 		}
+	}
 
-		file, err := store.FileByPath(tx, absPath)
+	return nil, warnings
+}
+
+func untagFileContent(store *storage.Storage, tx *storage.Tx, file *entities.File) error {
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return err
+	}
+
+	for _, fileTag := range fileTags {
+		if err := store.DeleteFileTag(tx, file.Id, fileTag.TagId, fileTag.ValueId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string, recursive, includeHidden, followSymlinks bool) (error, warnings) {
+	files, warnings, err := resolveFilesToUntag(store, tx, paths, recursive, includeHidden, followSymlinks)
+	if err != nil {
+		return err, warnings
+	}
+
+	for _, tagArg := range tagArgs {
+		tagName, valueName := parseTagEqValueName(tagArg)
+
+		tag, err := store.TagByNameOrAlias(tx, tagName)
 		if err != nil {
-			return fmt.Errorf("%v: could not retrieve file: %v", path, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
 		}
-		if file == nil {
-			warnings = append(warnings, fmt.Sprintf("%v: file is not tagged.", path))
+		if tag == nil {
+			warnings = append(warnings, NoSuchTagError{tagName})
 			continue
 		}
 
-		log.Infof(2, "%v: removing all tags.", path)
-
-		if err := store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
-			return fmt.Errorf("%v: could not remove file's tags: %v", path, err), warnings
+		value, err := store.ValueByName(tx, valueName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve value '%v': %w", valueName, err), warnings
+		}
+		if value == nil {
+			warnings = append(warnings, NoSuchValueError{valueName})
+			continue
 		}
 
-		if recursive {
-			childFiles, err := store.FilesByDirectory(tx, file.Path())
+		for _, file := range files {
+			valueIds, err := valueIdsToUntag(store, tx, file.Id, tag.Id, value.Id)
 			if err != nil {
-				return fmt.Errorf("%v: could not retrieve files for directory: %v", path, err), warnings
+				return fmt.Errorf("%v: could not retrieve tags: %w", file.Path(), err), warnings
 			}
 
-			for _, childFile := range childFiles {
-				if err := store.DeleteFileTagsByFileId(tx, childFile.Id); err != nil {
-					return fmt.Errorf("%v: could not remove file's tags: %v", childFile.Path(), err), warnings
+			for _, valueId := range valueIds {
+				if err := store.DeleteFileTag(tx, file.Id, tag.Id, valueId); err != nil {
+					switch err.(type) {
+					case storage.FileTagDoesNotExist:
+						exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, false)
+						if err != nil {
+							return fmt.Errorf("could not check if tag exists: %w", err), warnings
+						}
+
+						if exists {
+							if value.Id != 0 {
+								warnings = append(warnings, fmt.Errorf("%v: cannot remove '%v=%v': delete implication  to remove this tag.", file.Path(), tag.Name, value.Name))
+							} else {
+								warnings = append(warnings, fmt.Errorf("%v: cannot remove '%v': delete implication to remove this tag.", file.Path(), tag.Name))
+							}
+						} else {
+							if value.Id != 0 {
+								warnings = append(warnings, fmt.Errorf("%v: file is not tagged '%v=%v'.", file.Path(), tag.Name, value.Name))
+							} else {
+								warnings = append(warnings, fmt.Errorf("%v: file is not tagged '%v'.", file.Path(), tag.Name))
+							}
+						}
+					default:
+						return fmt.Errorf("%v: could not remove tag '%v', value '%v': %w", file.Path(), tag.Name, value.Name, err), warnings
+					}
 				}
 			}
 		}
@@ -155,103 +349,177 @@ func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recur
 	return nil, warnings
 }
 
-func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string, recursive, followSymlinks bool) (error, warnings) {
-	warnings := make(warnings, 0, 10)
+// the values of the tag to remove from the file: just the value specified or, if
+// no value is specified, every value with which the file is explicitly tagged
+func valueIdsToUntag(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (entities.ValueIds, error) {
+	if valueId != 0 {
+		return entities.ValueIds{valueId}, nil
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, fileId, true)
+	if err != nil {
+		return nil, err
+	}
+
+	valueIds := fileTags.Where(func(fileTag entities.FileTag) bool { return fileTag.TagId == tagId }).ValueIds()
+	if len(valueIds) == 0 {
+		return entities.ValueIds{0}, nil
+	}
 
+	return valueIds, nil
+}
+
+func resolveFilesToUntag(store *storage.Storage, tx *storage.Tx, paths []string, recursive, includeHidden, followSymlinks bool) (entities.Files, warnings, error) {
+	warnings := make(warnings, 0, 10)
 	files := make(entities.Files, 0, len(paths))
+
 	for _, path := range paths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", path, err), warnings
+			return nil, warnings, fmt.Errorf("%v: could not get absolute path: %w", path, err)
 		}
 
 		log.Infof(2, "%v: resolving path", path)
 
-		stat, err := os.Lstat(absPath)
+		absPath, stat, err := resolveUntagPath(absPath, followSymlinks)
 		if err != nil {
-			switch {
-			case os.IsNotExist(err), os.IsPermission(err):
-				// ignore
-			default:
-				return err, nil
-			}
-		} else if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
-			absPath, err = _path.Dereference(absPath)
-			if err != nil {
-				return err, nil
-			}
+			return nil, warnings, err
 		}
 
+		isDir := stat != nil && stat.IsDir()
+
 		file, err := store.FileByPath(tx, absPath)
 		if err != nil {
-			return fmt.Errorf("%v: could not retrieve file: %v", path, err), warnings
+			return nil, warnings, fmt.Errorf("%v: could not retrieve file: %w", path, err)
 		}
-		if file == nil {
-			warnings = append(warnings, fmt.Sprintf("%v: file is not tagged", path))
+		if file != nil {
+			files = append(files, file)
+		} else if !recursive || !isDir {
+			warnings = append(warnings, fmt.Errorf("%v: file is not tagged", path))
 			continue
 		}
 
-		files = append(files, file)
-
 		if recursive {
-			childFiles, err := store.FilesByDirectory(tx, file.Path())
+			if isDir {
+				if files, err = untagRecursively(store, tx, absPath, includeHidden, followSymlinks, files); err != nil {
+					return nil, warnings, err
+				}
+			}
+
+			// files no longer on disk cannot be found by walking the directory
+			childFiles, err := store.FilesByDirectory(tx, absPath)
 			if err != nil {
-				return fmt.Errorf("%v: could not retrieve files for directory: %v", file.Path(), err), warnings
+				return nil, warnings, fmt.Errorf("%v: could not retrieve files for directory: %w", path, err)
 			}
 
-			files = append(files, childFiles...)
+			for _, childFile := range childFiles {
+				if !includeHidden && isHiddenUnder(absPath, childFile.Path()) {
+					continue
+				}
+				if isIgnored(childFile.Path(), childFile.IsDir) {
+					continue
+				}
+
+				if _, err := os.Lstat(childFile.Path()); err == nil || !os.IsNotExist(err) {
+					continue
+				}
+
+				files = append(files, childFile)
+			}
 		}
 	}
 
-	for _, tagArg := range tagArgs {
-		tagName, valueName := parseTagEqValueName(tagArg)
+	return uniqueFiles(files), warnings, nil
+}
 
-		tag, err := store.TagByName(tx, tagName)
+func untagRecursively(store *storage.Storage, tx *storage.Tx, path string, includeHidden, followSymlinks bool, files entities.Files) (entities.Files, error) {
+	childPaths, err := recursiveChildPaths(path, includeHidden)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, childPath := range childPaths {
+		childPath, stat, err := resolveUntagPath(childPath, followSymlinks)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), warnings
-		}
-		if tag == nil {
-			warnings = append(warnings, fmt.Sprintf("no such tag '%v'", tagName))
-			continue
+			return nil, err
 		}
 
-		value, err := store.ValueByName(tx, valueName)
+		file, err := store.FileByPath(tx, childPath)
 		if err != nil {
-			return fmt.Errorf("could not retrieve value '%v': %v", valueName, err), warnings
+			return nil, fmt.Errorf("%v: could not retrieve file: %w", childPath, err)
 		}
-		if value == nil {
-			warnings = append(warnings, fmt.Sprintf("no such value '%v'", valueName))
-			continue
+		if file != nil {
+			files = append(files, file)
 		}
 
-		for _, file := range files {
-			if err := store.DeleteFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
-				switch err.(type) {
-				case storage.FileTagDoesNotExist:
-					exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, false)
-					if err != nil {
-						return fmt.Errorf("could not check if tag exists: %v", err), warnings
-					}
+		if stat != nil && stat.IsDir() {
+			if files, err = untagRecursively(store, tx, childPath, includeHidden, followSymlinks, files); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-					if exists {
-						if value.Id != 0 {
-							warnings = append(warnings, fmt.Sprintf("%v: cannot remove '%v=%v': delete implication  to remove this tag.", file.Path(), tag.Name, value.Name))
-						} else {
-							warnings = append(warnings, fmt.Sprintf("%v: cannot remove '%v': delete implication to remove this tag.", file.Path(), tag.Name))
-						}
-					} else {
-						if value.Id != 0 {
-							warnings = append(warnings, fmt.Sprintf("%v: file is not tagged '%v=%v'.", file.Path(), tag.Name, value.Name))
-						} else {
-							warnings = append(warnings, fmt.Sprintf("%v: file is not tagged '%v'.", file.Path(), tag.Name))
-						}
-					}
-				default:
-					return fmt.Errorf("%v: could not remove tag '%v', value '%v': %v", file.Path(), tag.Name, value.Name, err), warnings
-				}
+	return files, nil
+}
+
+func resolveUntagPath(absPath string, followSymlinks bool) (string, os.FileInfo, error) {
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err), os.IsPermission(err):
+			return absPath, nil, nil
+		default:
+			return "", nil, err
+		}
+	}
+
+	if stat.Mode()&os.ModeSymlink != 0 && followSymlinks {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return "", nil, err
+		}
+
+		stat, err = os.Lstat(absPath)
+		if err != nil {
+			switch {
+			case os.IsNotExist(err), os.IsPermission(err):
+				return absPath, nil, nil
+			default:
+				return "", nil, err
 			}
 		}
 	}
 
-	return nil, warnings
+	return absPath, stat, nil
+}
+
+func isHiddenUnder(root, path string) bool {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	for _, name := range strings.Split(relPath, string(filepath.Separator)) {
+		if len(name) > 1 && name[0] == '.' && name != ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+func uniqueFiles(files entities.Files) entities.Files {
+	seen := make(map[entities.FileId]bool, len(files))
+	result := make(entities.Files, 0, len(files))
+
+	for _, file := range files {
+		if seen[file.Id] {
+			continue
+		}
+
+		seen[file.Id] = true
+		result = append(result, file)
+	}
+
+	return result
 }
@@ -22,6 +22,8 @@ import (
 	"github.com/oniony/TMSU/storage"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 var UntaggedCommand = Command{
@@ -30,29 +32,93 @@ var UntaggedCommand = Command{
 	Usages:   []string{"tmsu untagged [OPTION]... [PATH]..."},
 	Description: `Identify untagged files in the filesystem.  
 
-Where PATHs are not specified, untagged items under the current working directory are shown.`,
+Where PATHs are not specified, untagged items under the current working directory are shown.
+
+The --mindepth and --maxdepth options limit the items shown to those at least and at most a number of levels beneath the PATHs, which are themselves at depth zero. Where no PATHs are specified, the entries of the working directory are at depth one.
+
+Items matching an --ignore PATTERN are neither shown nor descended into. A PATTERN containing a slash is matched against the absolute path, otherwise against the file name. The option may be specified more than once. Items excluded by a '.tmsuignore' file are likewise skipped: see the 'tag' subcommand for more information. The database and the files kept beside it, such as its write-ahead log ('db-wal'), shared memory index ('db-shm') and lock, are never shown.
+
+Control characters within the names listed, such as newlines, are shown as escape sequences like '\n'. With --print0 the names are instead listed verbatim, each terminated by a NUL character, for use with 'xargs -0' or 'tmsu tag --null-stdin'.`,
 	Examples: []string{"$ tmsu untagged",
-		"$ tmsu untagged /home/fred/drawings"},
+		"$ tmsu untagged /home/fred/drawings",
+		"$ tmsu untagged --count --maxdepth=1 ~/photos",
+		"$ tmsu untagged --ignore='*.tmp' --ignore=.git ~/projects",
+		"$ tmsu untagged -0 ~/inbox | tmsu tag --null-stdin unsorted"},
 	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""},
 		Option{"--count", "-c", "list the number of files rather than their names", false, ""},
-		Option{"--no-dereference", "-P", "do not dereference symbolic links", false, ""}},
+		Option{"--no-dereference", "-P", "do not dereference symbolic links", false, ""},
+		Option{"--mindepth", "", "do not list items less than DEPTH levels beneath the PATHs", true, ""},
+		Option{"--maxdepth", "", "do not descend more than DEPTH levels beneath the PATHs", true, ""},
+		Option{"--ignore", "-i", "skip items matching PATTERN", true, ""},
+		Option{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""}},
 	Exec: untaggedExec,
 }
 
 // unexported
 
+// the limits upon the items examined when looking for untagged items
+type untaggedWalk struct {
+	followSymlinks bool
+	minDepth       uint
+	maxDepth       int // negative where unlimited
+	ignorePatterns []string
+}
+
 func untaggedExec(options Options, args []string, databasePath string) (error, warnings) {
-	recursive := !options.HasOption("--directory")
 	count := options.HasOption("--count")
-	followSymlinks := !options.HasOption("--no-dereference")
+	print0 := options.HasOption("--print0")
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
+
+	walk := untaggedWalk{maxDepth: -1}
+	if options.HasOption("--directory") {
+		walk.maxDepth = 0
+	}
+
+	if options.HasOption("--mindepth") {
+		text := options.Get("--mindepth").Argument
+
+		value, err := strconv.ParseUint(text, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid argument '%v' for '--mindepth'", text), nil
+		}
+
+		walk.minDepth = uint(value)
+	}
+
+	if options.HasOption("--maxdepth") {
+		text := options.Get("--maxdepth").Argument
+
+		value, err := strconv.ParseUint(text, 10, 31)
+		if err != nil {
+			return fmt.Errorf("invalid argument '%v' for '--maxdepth'", text), nil
+		}
+
+		if walk.maxDepth < 0 || int(value) < walk.maxDepth {
+			walk.maxDepth = int(value)
+		}
+	}
+
+	for _, pattern := range options.Arguments("--ignore") {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid argument '%v' for '--ignore'", pattern), nil
+		}
+
+		walk.ignorePatterns = append(walk.ignorePatterns, pattern)
+	}
 
 	paths := args
+	depth := uint(0)
 	if len(paths) == 0 {
 		var err error
 		paths, err = directoryEntries(".")
 		if err != nil {
 			return err, nil
 		}
+
+		depth = 1
 	}
 
 	store, err := openDatabase(databasePath)
@@ -61,21 +127,35 @@ func untaggedExec(options Options, args []string, databasePath string) (error, w
 	}
 	defer store.Close()
 
+	walk.followSymlinks, err = followSymlinksPolicy(store, options)
+	if err != nil {
+		return err, nil
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err, nil
 	}
 	defer tx.Commit()
 
-	if count {
-		count, err := findUntaggedCount(store, tx, paths, recursive, followSymlinks)
+	switch {
+	case count:
+		count, err := findUntaggedCount(store, tx, paths, depth, walk)
 		if err != nil {
 			return err, nil
 		}
 
+		if asJson {
+			return printJson(count), nil
+		}
+
 		fmt.Println(count)
-	} else {
-		if err := findUntagged(store, tx, paths, recursive, followSymlinks); err != nil {
+	case asJson:
+		if err := findUntaggedJson(store, tx, paths, depth, walk); err != nil {
+			return err, nil
+		}
+	default:
+		if err := findUntagged(store, tx, paths, depth, walk, print0); err != nil {
 			return err, nil
 		}
 	}
@@ -83,65 +163,128 @@ func untaggedExec(options Options, args []string, databasePath string) (error, w
 	return nil, nil
 }
 
-func findUntagged(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool) error {
+func findUntagged(store *storage.Storage, tx *storage.Tx, paths []string, depth uint, walk untaggedWalk, print0 bool) error {
 	var action = func(absPath string) {
-		relPath := _path.Rel(absPath)
-		fmt.Println(relPath)
+		relPath := displayPath(absPath)
+		if print0 {
+			fmt.Printf("%v\000", relPath)
+		} else {
+			fmt.Println(escapeControl(relPath))
+		}
 	}
 
-	return findUntaggedFunc(store, tx, paths, recursive, followSymlinks, action)
+	return findUntaggedFunc(store, tx, paths, depth, walk, action)
 }
 
-func findUntaggedCount(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool) (uint, error) {
+func findUntaggedJson(store *storage.Storage, tx *storage.Tx, paths []string, depth uint, walk untaggedWalk) error {
+	jsonPaths := newJsonArrayPrinter(os.Stdout)
+
+	var printErr error
+	var action = func(absPath string) {
+		if printErr == nil {
+			printErr = jsonPaths.print(displayPath(absPath))
+		}
+	}
+
+	if err := findUntaggedFunc(store, tx, paths, depth, walk, action); err != nil {
+		return err
+	}
+	if printErr != nil {
+		return printErr
+	}
+
+	jsonPaths.close()
+
+	return nil
+}
+
+func findUntaggedCount(store *storage.Storage, tx *storage.Tx, paths []string, depth uint, walk untaggedWalk) (uint, error) {
 	var count uint
 
 	var action = func(absPath string) {
 		count++
 	}
 
-	err := findUntaggedFunc(store, tx, paths, recursive, followSymlinks, action)
+	err := findUntaggedFunc(store, tx, paths, depth, walk, action)
 
 	return count, err
 }
 
-func findUntaggedFunc(store *storage.Storage, tx *storage.Tx, paths []string, recursive, followSymlinks bool, action func(absPath string)) error {
+func findUntaggedFunc(store *storage.Storage, tx *storage.Tx, paths []string, depth uint, walk untaggedWalk, action func(absPath string)) error {
 	for _, path := range paths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+			return fmt.Errorf("%v: could not get absolute path: %w", path, err)
+		}
+
+		if walk.ignores(absPath) || (depth > 0 && isIgnoredPath(absPath)) {
+			log.Infof(2, "%v: ignoring", path)
+			continue
+		}
+
+		if store.IsDatabaseFile(absPath) {
+			log.Infof(2, "%v: skipping database file", path)
+			continue
 		}
 
-		if followSymlinks {
+		if walk.followSymlinks {
 			log.Infof(2, "%v: resolving path", path)
 
 			absPath, err = _path.Dereference(absPath)
 			if err != nil {
-				return fmt.Errorf("%v: could not dereference path: %v", path, err)
+				return fmt.Errorf("%v: could not dereference path: %w", path, err)
 			}
 		}
 
-		//TODO PERF no need to retrieve file: we merely need to know it exists
-		file, err := store.FileByPath(tx, absPath)
-		if err != nil {
-			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
-		}
-		if file == nil {
-			action(absPath)
+		if depth >= walk.minDepth {
+			//TODO PERF no need to retrieve file: we merely need to know it exists
+			file, err := store.FileByPath(tx, absPath)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %w", path, err)
+			}
+			if file == nil {
+				action(absPath)
+			}
 		}
 
-		if recursive {
+		if walk.maxDepth < 0 || int(depth) < walk.maxDepth {
+			if !walk.followSymlinks {
+				if stat, err := os.Lstat(path); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+					continue
+				}
+			}
+
 			entries, err := directoryEntries(path)
 			if err != nil {
 				return err
 			}
 
-			findUntaggedFunc(store, tx, entries, true, followSymlinks, action)
+			if err := findUntaggedFunc(store, tx, entries, depth+1, walk, action); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// whether the path matches any of the ignore patterns: the file name is
+// matched or, where the pattern contains a separator, the absolute path
+func (walk untaggedWalk) ignores(absPath string) bool {
+	for _, pattern := range walk.ignorePatterns {
+		name := filepath.Base(absPath)
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			name = absPath
+		}
+
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
 func directoryEntries(path string) ([]string, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
@@ -155,7 +298,7 @@ func directoryEntries(path string) ([]string, error) {
 			log.Warnf("%v: permission denied", path)
 			return []string{}, nil
 		default:
-			return nil, fmt.Errorf("%v: could not stat: %v", path, err)
+			return nil, fmt.Errorf("%v: could not stat: %w", path, err)
 		}
 	}
 
@@ -165,13 +308,13 @@ func directoryEntries(path string) ([]string, error) {
 
 	dir, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("%v could not open directory: %v", path, err)
+		return nil, fmt.Errorf("%v could not open directory: %w", path, err)
 	}
 
 	names, err := dir.Readdirnames(0)
 	dir.Close()
 	if err != nil {
-		return nil, fmt.Errorf("%v: could not read directory entries: %v", path, err)
+		return nil, fmt.Errorf("%v: could not read directory entries: %w", path, err)
 	}
 
 	entries := make([]string, len(names))
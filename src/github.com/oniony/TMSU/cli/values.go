@@ -18,7 +18,6 @@ package cli
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
-	"github.com/oniony/TMSU/common/terminal"
 	"github.com/oniony/TMSU/storage"
 	"strings"
 )
@@ -41,6 +40,14 @@ var ValuesCommand = Command{
 func valuesExec(options Options, args []string, databasePath string) (error, warnings) {
 	showCount := options.HasOption("--count")
 	onePerLine := options.HasOption("-1")
+	format, err := newFormatter(options)
+	if err != nil {
+		return err, nil
+	}
+	asJson, err := useJson(options)
+	if err != nil {
+		return err, nil
+	}
 
 	store, err := openDatabase(databasePath)
 	if err != nil {
@@ -54,66 +61,125 @@ func valuesExec(options Options, args []string, databasePath string) (error, war
 	}
 	defer tx.Commit()
 
+	if err := format.useCollation(store, tx); err != nil {
+		return err, nil
+	}
+
 	if len(args) == 0 {
-		return listAllValues(store, tx, showCount, onePerLine), nil
+		return listAllValues(store, tx, showCount, onePerLine, format, asJson), nil
 	}
 
-	return listValues(store, tx, args, showCount, onePerLine)
+	return listValues(store, tx, args, showCount, onePerLine, format, asJson)
 }
 
-func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool) error {
+func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine bool, format *formatter, asJson bool) error {
 	log.Info(2, "retrieving all values.")
 
 	if showCount {
 		count, err := store.ValueCount(tx)
 		if err != nil {
-			return fmt.Errorf("could not retrieve value count: %v", err)
+			return fmt.Errorf("could not retrieve value count: %w", err)
+		}
+
+		if asJson {
+			return printJson(count)
 		}
 
 		fmt.Println(count)
 	} else {
 		values, err := store.Values(tx)
 		if err != nil {
-			return fmt.Errorf("could not retrieve values: %v", err)
+			return fmt.Errorf("could not retrieve values: %w", err)
 		}
 
-		if onePerLine {
+		switch {
+		case asJson:
+			valueNames := make([]string, len(values))
+			for index, value := range values {
+				valueNames[index] = value.Name
+			}
+
+			return printJson(valueNames)
+		case onePerLine:
 			for _, value := range values {
-				fmt.Println(escape(value.Name))
+				fmt.Println(escape(value.Name, '=', ' '))
 			}
-		} else {
+		default:
 			valueNames := make([]string, len(values))
 			for index, value := range values {
-				valueNames[index] = escape(value.Name)
+				valueNames[index] = escape(value.Name, '=', ' ')
 			}
 
-			terminal.PrintColumns(valueNames)
+			format.printColumns(valueNames)
 		}
 	}
 
 	return nil
 }
 
-func listValues(store *storage.Storage, tx *storage.Tx, args []string, showCount, onePerLine bool) (error, warnings) {
+func listValues(store *storage.Storage, tx *storage.Tx, args []string, showCount, onePerLine bool, format *formatter, asJson bool) (error, warnings) {
 	tagNames := make([]string, len(args))
 	for index, arg := range args {
 		tagNames[index] = parseTagOrValueName(arg)
 	}
 
-	switch len(tagNames) {
-	case 0:
+	switch {
+	case len(tagNames) == 0:
 		return fmt.Errorf("at least one tag must be specified"), nil
-	case 1:
-		return listValuesForTag(store, tx, tagNames[0], showCount, onePerLine), nil
+	case asJson:
+		return listValuesForTagsAsJson(store, tx, tagNames, showCount)
+	case len(tagNames) == 1:
+		return listValuesForTag(store, tx, tagNames[0], showCount, onePerLine, format), nil
 	default:
 		return listValuesForTags(store, tx, tagNames, showCount, onePerLine)
 	}
 }
 
-func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, showCount, onePerLine bool) error {
-	tag, err := store.TagByName(tx, tagName)
+func listValuesForTagsAsJson(store *storage.Storage, tx *storage.Tx, tagNames []string, showCount bool) (error, warnings) {
+	warnings := make(warnings, 0, 10)
+	jsonValues := make([]jsonTagValues, 0, len(tagNames))
+	jsonCounts := make([]jsonTagValueCount, 0, len(tagNames))
+
+	for _, tagName := range tagNames {
+		tag, err := store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
+		}
+		if tag == nil {
+			warnings = append(warnings, NoSuchTagError{tagName})
+			continue
+		}
+
+		log.Infof(2, "retrieving values for tag '%v'.", tagName)
+
+		values, err := store.ValuesByTag(tx, tag.Id)
+		if err != nil {
+			return fmt.Errorf("could not retrieve values for tag '%v': %w", tagName, err), warnings
+		}
+
+		if showCount {
+			jsonCounts = append(jsonCounts, jsonTagValueCount{tagName, len(values)})
+		} else {
+			valueNames := make([]string, len(values))
+			for index, value := range values {
+				valueNames[index] = value.Name
+			}
+
+			jsonValues = append(jsonValues, jsonTagValues{tagName, valueNames})
+		}
+	}
+
+	if showCount {
+		return printJson(jsonCounts), warnings
+	}
+
+	return printJson(jsonValues), warnings
+}
+
+func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, showCount, onePerLine bool, format *formatter) error {
+	tag, err := store.TagByNameOrAlias(tx, tagName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err)
 	}
 	if tag == nil {
 		return fmt.Errorf("no such tag, '%v'", tagName)
@@ -123,7 +189,7 @@ func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, sh
 
 	values, err := store.ValuesByTag(tx, tag.Id)
 	if err != nil {
-		return fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err)
+		return fmt.Errorf("could not retrieve values for tag '%v': %w", tagName, err)
 	}
 
 	if showCount {
@@ -139,7 +205,7 @@ func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, sh
 				valueNames[index] = escape(value.Name, '=', ' ')
 			}
 
-			terminal.PrintColumns(valueNames)
+			format.printColumns(valueNames)
 		}
 	}
 
@@ -150,12 +216,12 @@ func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string
 	warnings := make(warnings, 0, 10)
 
 	for _, tagName := range tagNames {
-		tag, err := store.TagByName(tx, tagName)
+		tag, err := store.TagByNameOrAlias(tx, tagName)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err), warnings
+			return fmt.Errorf("could not retrieve tag '%v': %w", tagName, err), warnings
 		}
 		if tag == nil {
-			warnings = append(warnings, fmt.Sprintf("no such tag, '%v'.", tagName))
+			warnings = append(warnings, NoSuchTagError{tagName})
 			continue
 		}
 
@@ -163,7 +229,7 @@ func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string
 
 		values, err := store.ValuesByTag(tx, tag.Id)
 		if err != nil {
-			return fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err), warnings
+			return fmt.Errorf("could not retrieve values for tag '%v': %w", tagName, err), warnings
 		}
 
 		if showCount {
@@ -0,0 +1,192 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/progress"
+	"github.com/oniony/TMSU/entities"
+	"os"
+)
+
+var VerifyCommand = Command{
+	Name:     "verify",
+	Synopsis: "Verify file contents against their fingerprints",
+	Usages: []string{"tmsu verify [OPTION]... [PATH]...",
+		"tmsu verify [OPTION]... --query QUERY"},
+	Description: `Recalculates the fingerprints of the files in the database and reports any whose contents have changed although their size and modification time have not, which indicates likely corruption such as bit rot.
+
+Where PATHs are specified only the files at or under these paths are verified, and with --query only the files matching QUERY. Otherwise every file in the database is verified.
+
+Files whose size or modification time has changed have been modified legitimately and are not reported: use the 'repair' subcommand to update their fingerprints. Missing files and those that cannot be read are reported. Directories, and files without a fingerprint, are not verified.
+
+The fingerprints are recalculated with the current fingerprint algorithm, so files fingerprinted before the algorithm was changed must first be refingerprinted (see the 'refingerprint' subcommand). The 'dynamic:' and 'sparse:' algorithms cover only parts of larger files, so corruption elsewhere within these files is not detected.
+
+With --report the status of every file verified, one of 'ok', 'corrupt', 'modified', 'missing' or 'unreadable', is written to FILE.
+
+Nothing is written to standard output so that the command may be run from cron, which reports only commands that write output. The exit status is 11 if any file is likely corrupt, otherwise that of any other problem reported.
+
+The database is never changed.`,
+	Examples: []string{"$ tmsu verify",
+		"$ tmsu verify /mnt/photos",
+		"$ tmsu verify --query 'year < 2010'",
+		"$ tmsu verify --quiet --report /var/log/tmsu-verify.log"},
+	Options: Options{{"--query", "-q", "verify the files matching QUERY", true, ""},
+		{"--report", "", "write the status of every file verified to FILE", true, ""},
+		{"--jobs", "-j", "fingerprint up to N files concurrently", true, ""}},
+	Exec: verifyExec,
+}
+
+// unexported
+
+func verifyExec(options Options, args []string, databasePath string) (error, warnings) {
+	if options.HasOption("--query") && len(args) > 0 {
+		return fmt.Errorf("PATHs cannot be combined with --query"), nil
+	}
+
+	jobs, err := fingerprintJobs(options)
+	if err != nil {
+		return err, nil
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	var files entities.Files
+	var warnings warnings
+	if options.HasOption("--query") {
+		files, warnings, err = queryFiles(store, tx, options.Get("--query").Argument, nil, "", false, false, false, "name", false, 0)
+	} else {
+		files, err = refingerprintFiles(store, tx, args)
+	}
+	if err != nil {
+		return err, warnings
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %w", err), warnings
+	}
+
+	var report *bufio.Writer
+	if options.HasOption("--report") {
+		reportFile, err := os.Create(options.Get("--report").Argument)
+		if err != nil {
+			return fmt.Errorf("could not create report: %w", err), warnings
+		}
+		defer reportFile.Close()
+
+		report = bufio.NewWriter(reportFile)
+	}
+
+	statuses, problems := verifyFiles(files, newFingerprintPool(settings, jobs))
+
+	if report != nil {
+		for index, file := range files {
+			if statuses[index] != "" {
+				fmt.Fprintf(report, "%v: %v\n", file.Path(), statuses[index])
+			}
+		}
+
+		if err := report.Flush(); err != nil {
+			return fmt.Errorf("could not write report: %w", err), append(warnings, problems...)
+		}
+	}
+
+	return nil, append(warnings, problems...)
+}
+
+// determines the status of each file, or the empty string for those not
+// verified. The problems found are returned, those with possibly corrupt files
+// first.
+func verifyFiles(files entities.Files, fingerprints *fingerprint.Pool) ([]string, warnings) {
+	statuses := make([]string, len(files))
+
+	// only regular files whose size and modification time are unchanged
+	indices := make([]int, 0, len(files))
+	paths := make([]string, 0, len(files))
+	otherProblems := make(warnings, 0, 10)
+
+	for index, file := range files {
+		if file.IsDir || file.Fingerprint == fingerprint.Empty {
+			continue
+		}
+
+		path := file.Path()
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				statuses[index] = "missing"
+				otherProblems = append(otherProblems, NoSuchFileError{path})
+			} else {
+				statuses[index] = "unreadable"
+				otherProblems = append(otherProblems, fmt.Errorf("%v: could not stat file: %w", path, err))
+			}
+
+			continue
+		}
+
+		if !file.ModTime.Equal(stat.ModTime().UTC()) || file.Size != stat.Size() {
+			log.Infof(2, "%v: modified", path)
+			statuses[index] = "modified"
+			continue
+		}
+
+		indices = append(indices, index)
+		paths = append(paths, path)
+	}
+
+	bar := progress.Start("verifying", uint(len(paths)))
+	defer bar.Finish()
+
+	corrupt := make(warnings, 0, 10)
+
+	fingerprints.CreateEach(paths, func(pathIndex int, fingerprint fingerprint.Fingerprint, err error) error {
+		bar.Add(1)
+
+		index := indices[pathIndex]
+		file := files[index]
+
+		switch {
+		case err != nil:
+			statuses[index] = "unreadable"
+			otherProblems = append(otherProblems, fmt.Errorf("%v: could not create fingerprint: %w", file.Path(), err))
+		case fingerprint != file.Fingerprint:
+			statuses[index] = "corrupt"
+			corrupt = append(corrupt, CorruptFileError{file.Path()})
+		default:
+			log.Infof(2, "%v: verified", file.Path())
+			statuses[index] = "ok"
+		}
+
+		return nil
+	})
+
+	return statuses, append(corrupt, otherProblems...)
+}
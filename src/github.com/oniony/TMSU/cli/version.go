@@ -26,6 +26,7 @@ var VersionCommand = Command{
 	Synopsis:    "Display the version",
 	Usages:      []string{"tmsu version"},
 	Description: "Displays version and copyright information.",
+	Examples:    []string{"$ tmsu version"},
 	Options:     Options{},
 	Exec:        versionExec,
 	Hidden:      true,
@@ -19,6 +19,7 @@ package cli
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/trash"
 	"github.com/oniony/TMSU/vfs"
 	"strings"
 )
@@ -30,9 +31,13 @@ var VfsCommand = Command{
 	Description: `This subcommand is the foreground process which hosts the virtual filesystem. It is run automatically when a virtual filesystem is mounted using the 'mount' subcommand and terminated when the virtual filesystem is unmounted.
 
 It is not normally necessary to issue this subcommand manually unless debugging the virtual filesystem. For debug output use the --verbose option.`,
-	Options: Options{{"--options", "-o", "mount options", true, ""}},
-	Exec:    vfsExec,
-	Hidden:  true,
+	Examples: []string{"$ tmsu --verbose vfs mp"},
+	Options: Options{{"--options", "-o", "mount options", true, ""},
+		{"--delete-policy", "", "what deleting a file does: " + strings.Join(trash.PolicyNames, ", "), true, "untag"},
+		{"--previews", "", "show thumbnails of the images and videos within each query directory", false, ""},
+		{"--inbox", "", "add the files linked into the 'inbox' directory to the database", false, ""}},
+	Exec:   vfsExec,
+	Hidden: true,
 }
 
 // unexported
@@ -47,6 +52,14 @@ func vfsExec(options Options, args []string, databasePath string) (error, warnin
 		mountOptions = strings.Split(options.Get("--options").Argument, ",")
 	}
 
+	deletePolicy := trash.UntagOnly
+	if options.HasOption("--delete-policy") {
+		var err error
+		if deletePolicy, err = trash.ParsePolicy(options.Get("--delete-policy").Argument); err != nil {
+			return UsageError{err.Error()}, nil
+		}
+	}
+
 	mountPath := args[0]
 
 	store, err := openDatabase(databasePath)
@@ -55,9 +68,14 @@ func vfsExec(options Options, args []string, databasePath string) (error, warnin
 	}
 	defer store.Close()
 
-	vfs, err := vfs.MountVfs(store, mountPath, mountOptions)
+	// the kernel then refuses changes rather than each failing in turn
+	if store.ReadOnly() {
+		mountOptions = append(mountOptions, "ro")
+	}
+
+	vfs, err := vfs.MountVfs(store, mountPath, mountOptions, deletePolicy, options.HasOption("--previews"), options.HasOption("--inbox"))
 	if err != nil {
-		return fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err), nil
+		return fmt.Errorf("could not mount virtual filesystem at '%v': %w", mountPath, err), nil
 	}
 	defer vfs.Unmount()
 
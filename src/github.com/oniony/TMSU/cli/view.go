@@ -0,0 +1,162 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage"
+	"strings"
+)
+
+var ViewCommand = Command{
+	Name:     "view",
+	Synopsis: "Manage saved queries",
+	Usages: []string{"tmsu view add VIEW QUERY",
+		"tmsu view delete VIEW...",
+		"tmsu view [list]"},
+	Description: `Manages views: queries saved in the database, each under the name VIEW.
+
+The files matching a view are listed with 'tmsu files --view VIEW' and appear within the directory of that name under 'views' in the virtual filesystem. A view may also be saved from the virtual filesystem, such as by a file manager, by creating a symbolic link within 'views' named VIEW whose target is the QUERY, and deleted by removing its directory there. A view's query is evaluated each time it is used so the files listed reflect the current tagging. A QUERY may refer to other views as 'view:VIEW' but only to those that exist and not, directly or through them, to the view being added.
+
+When run without arguments, or with 'list', lists the views.`,
+	Examples: []string{`$ tmsu view add recent-photos "photo and year=2024"`,
+		`$ tmsu files --view recent-photos`,
+		`$ tmsu view
+recent-photos: photo and year=2024`,
+		"$ tmsu view delete recent-photos"},
+	Options: Options{},
+	Exec:    viewExec,
+}
+
+// unexported
+
+func viewExec(options Options, args []string, databasePath string) (error, warnings) {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:]
+	}
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err, nil
+	}
+	defer tx.Commit()
+
+	switch action {
+	case "list":
+		if len(args) > 0 {
+			return errTooManyArguments, nil
+		}
+
+		asJson, err := useJson(options)
+		if err != nil {
+			return err, nil
+		}
+
+		return listViews(store, tx, asJson), nil
+	case "add":
+		if len(args) < 2 {
+			return errTooFewArguments, nil
+		}
+
+		return addView(store, tx, args[0], strings.Join(args[1:], " ")), nil
+	case "delete":
+		if len(args) < 1 {
+			return errTooFewArguments, nil
+		}
+
+		if err := refuseIfStoreReadOnly(store); err != nil {
+			return err, nil
+		}
+
+		return nil, deleteViews(store, tx, args)
+	}
+
+	return fmt.Errorf("invalid action '%v': expected add, delete or list", action), nil
+}
+
+func listViews(store *storage.Storage, tx *storage.Tx, asJson bool) error {
+	log.Info(2, "retrieving views")
+
+	views, err := store.Views(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve views: %w", err)
+	}
+
+	if asJson {
+		jsonViews := make([]jsonView, len(views))
+		for index, view := range views {
+			jsonViews[index] = jsonView{view.Name, view.Query}
+		}
+
+		return printJson(jsonViews)
+	}
+
+	for _, view := range views {
+		fmt.Printf("%v: %v\n", view.Name, view.Query)
+	}
+
+	return nil
+}
+
+func addView(store *storage.Storage, tx *storage.Tx, name, queryText string) error {
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err
+	}
+
+	log.Infof(2, "adding view '%v'", name)
+
+	if _, err := store.AddView(tx, name, queryText); err != nil {
+		return fmt.Errorf("could not add view '%v': %w", name, err)
+	}
+
+	return nil
+}
+
+func deleteViews(store *storage.Storage, tx *storage.Tx, names []string) warnings {
+	warnings := make(warnings, 0, 10)
+
+	for _, name := range names {
+		log.Infof(2, "deleting view '%v'", name)
+
+		if err := store.DeleteView(tx, name); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return warnings
+}
+
+// the query saved as the named view
+func viewQuery(store *storage.Storage, tx *storage.Tx, name string) (string, error) {
+	view, err := store.ViewByName(tx, name)
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve view '%v': %w", name, err)
+	}
+	if view == nil {
+		return "", NoSuchViewError{name}
+	}
+
+	return view.Query, nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/common/watch"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"path/filepath"
+	"strings"
+)
+
+var WatchCommand = Command{
+	Name:     "watch",
+	Synopsis: "Watch tagged files for moves and deletions",
+	Usages:   []string{"tmsu watch [OPTION]... [DIR]..."},
+	Description: `Monitors the file system and keeps the database up to date as tagged files are moved, renamed or deleted, removing the need to run 'repair' after reorganizing directories.
+
+If no DIRs are specified then the directories containing the tagged files in the database are watched. Otherwise each DIR, and all of the directories beneath it, is watched.
+
+Files that are moved or renamed within the watched directories have their paths updated in the database. Files that are deleted, or moved outside of the watched directories, are reported as missing or, with --remove, are removed from the database.
+
+Directories excluded by a '.tmsuignore' file are not watched. See the 'tag' subcommand for more information.
+
+The command runs in the foreground until it is interrupted: it does not detach itself or run as part of the 'daemon' subcommand, so changes made whilst it is not running still require 'repair'. To watch continuously, start it in the background from a login script or with a service manager, e.g. as a systemd user service.`,
+	Examples: []string{"$ tmsu watch",
+		"$ tmsu watch ~/music ~/photos",
+		"$ tmsu watch --remove ~/downloads",
+		"$ tmsu watch ~/photos &"},
+	Options: Options{{"--remove", "-R", "remove deleted files from the database", false, ""}},
+	Exec:    watchExec,
+}
+
+// unexported
+
+func watchExec(options Options, args []string, databasePath string) (error, warnings) {
+	removeMissing := options.HasOption("--remove")
+
+	store, err := openDatabase(databasePath)
+	if err != nil {
+		return err, nil
+	}
+	defer store.Close()
+
+	if err := refuseIfStoreReadOnly(store); err != nil {
+		return err, nil
+	}
+
+	watcher, err := watch.NewWatcher()
+	if err != nil {
+		return err, nil
+	}
+	defer watcher.Close()
+
+	var warnings warnings
+	if len(args) == 0 {
+		warnings, err = watchDatabase(store, watcher)
+	} else {
+		warnings, err = watchPaths(watcher, args)
+	}
+	if err != nil {
+		return err, warnings
+	}
+
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+
+	for {
+		events, err := watcher.Next()
+		if err != nil {
+			return err, nil
+		}
+
+		for _, event := range events {
+			if err := handleWatchEvent(store, event, removeMissing); err != nil {
+				log.Warn(err)
+			}
+		}
+	}
+}
+
+func watchDatabase(store *storage.Storage, watcher *watch.Watcher) (warnings, error) {
+	tx, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Commit()
+
+	log.Info(2, "retrieving all files from database.")
+
+	files, err := store.Files(tx, "name")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %w", err)
+	}
+
+	tree := _path.NewTree()
+	for _, file := range files {
+		if file.IsDir {
+			tree.Add(file.Path(), true)
+		}
+	}
+	dirPaths := tree.TopLevel().Paths()
+
+	warnings, err := watchPaths(watcher, dirPaths)
+	if err != nil {
+		return warnings, err
+	}
+
+	// parent directories are watched so that moves of the tagged files and
+	// directories themselves are seen
+	parentPaths := make(map[string]bool)
+	for _, file := range files {
+		if file.IsDir && !isTopLevel(file.Path(), dirPaths) {
+			continue
+		}
+
+		parentPath := filepath.Dir(file.Path())
+		if parentPaths[parentPath] || isUnderAny(parentPath, dirPaths) {
+			continue
+		}
+		parentPaths[parentPath] = true
+
+		if err := watcher.Watch(parentPath, false); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return warnings, nil
+}
+
+func watchPaths(watcher *watch.Watcher, paths []string) (warnings, error) {
+	warnings := make(warnings, 0, 10)
+
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return warnings, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+		}
+
+		if err := watcher.Watch(absPath, true); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return warnings, nil
+}
+
+func isTopLevel(path string, dirPaths []string) bool {
+	for _, dirPath := range dirPaths {
+		if path == dirPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isUnderAny(path string, dirPaths []string) bool {
+	for _, dirPath := range dirPaths {
+		if path == dirPath || strings.HasPrefix(path, dirPath+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func handleWatchEvent(store *storage.Storage, event watch.Event, removeMissing bool) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	files, err := watchedFiles(store, tx, event.Path)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	switch event.Type {
+	case watch.Moved:
+		fmt.Printf("%v: moved to %v\n", displayPath(event.Path), displayPath(event.NewPath))
+
+		return manualRepair(store, tx, event.Path, event.NewPath, false)
+	case watch.Removed:
+		if err := repairMissing(store, tx, files, false, removeMissing); err != nil {
+			return err
+		}
+
+		if removeMissing {
+			return deleteUntaggedFiles(store, tx, files)
+		}
+	}
+
+	return nil
+}
+
+func watchedFiles(store *storage.Storage, tx *storage.Tx, path string) (entities.Files, error) {
+	files, err := store.FilesByDirectory(tx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve files from storage: %w", path, err)
+	}
+
+	file, err := store.FileByPath(tx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+
+	if file != nil {
+		files = append(entities.Files{file}, files...)
+	}
+
+	return files, nil
+}
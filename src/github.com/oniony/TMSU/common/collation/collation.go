@@ -0,0 +1,255 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package collation
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Orders text as per the conventions of a language, so that letters with
+// accents sort with the letters they are based upon, 'é' with 'e', and the
+// case of letters only breaks ties.
+type Collator struct {
+	// the name of the collation, e.g. 'sv', or 'und' for the Unicode ordering
+	// or 'binary' for the order of the characters' code points
+	Name      string
+	tailoring map[rune]int
+}
+
+// Text is ordered by the code points of its characters.
+var Binary = &Collator{Name: "binary"}
+
+// The languages whose alphabets order letters other than as in the Unicode
+// ordering. Text in any other language is ordered as per the Unicode ordering.
+var TailoredLanguages = []string{"da", "es", "fi", "nb", "nn", "no", "sv"}
+
+// Validates a collation name, which is 'binary', 'unicode', 'system' or a
+// language code, such as 'sv' or 'pt_BR'.
+func Validate(name string) error {
+	switch name {
+	case "binary", "unicode", "system":
+		return nil
+	}
+
+	if !languagePattern.MatchString(name) {
+		return fmt.Errorf("invalid collation '%v': must be 'binary', 'unicode', 'system' or a language code such as 'sv'", name)
+	}
+
+	return nil
+}
+
+// Retrieves the collator of the specified name, where 'system' denotes the
+// language of the LC_ALL, LC_COLLATE or LANG environment variable, or binary
+// order where none is set.
+func New(name string) (*Collator, error) {
+	if err := Validate(name); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "binary":
+		return Binary, nil
+	case "unicode":
+		return forLanguage("und"), nil
+	case "system":
+		language := systemLanguage()
+		if language == "" {
+			return Binary, nil
+		}
+
+		return forLanguage(language), nil
+	}
+
+	return forLanguage(strings.ToLower(languagePattern.FindStringSubmatch(name)[1])), nil
+}
+
+// Retrieves the collators that may be used by name, each tailored language
+// together with the Unicode ordering.
+func Collators() []*Collator {
+	collators := make([]*Collator, 0, len(TailoredLanguages)+1)
+	collators = append(collators, forLanguage("und"))
+
+	for _, language := range TailoredLanguages {
+		collators = append(collators, forLanguage(language))
+	}
+
+	return collators
+}
+
+// Compares two strings, returning a negative number if the first sorts
+// before the second, a positive number if after or zero only if they are equal.
+func (collator *Collator) Compare(a, b string) int {
+	if collator.Name == "binary" || a == b {
+		return strings.Compare(a, b)
+	}
+
+	aKeys := collator.keys(a)
+	bKeys := collator.keys(b)
+
+	for level := range aKeys {
+		if result := compareWeights(aKeys[level], bKeys[level]); result != 0 {
+			return result
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Determines whether the first string sorts before the second.
+func (collator *Collator) Less(a, b string) bool {
+	return collator.Compare(a, b) < 0
+}
+
+// unexported
+
+var languagePattern = regexp.MustCompile(`^([a-zA-Z]{2,3})(?:[-_][a-zA-Z0-9]+)?(?:\.[-a-zA-Z0-9]+)?(?:@[a-zA-Z0-9]+)?$`)
+
+// the primary weight of each character is four times its code point, leaving
+// room to order the tailored letters of a language after another
+const weightSpacing = 4
+
+// letters that precede their accented forms in the Unicode ordering but are
+// sorted as separate letters of the alphabets of these languages
+var tailorings = map[string]map[rune]int{
+	"da": afterZ('æ', 'ø', 'å'),
+	"es": {'ñ': 'n'*weightSpacing + 1},
+	"fi": afterZ('å', 'ä', 'ö'),
+	"nb": afterZ('æ', 'ø', 'å'),
+	"nn": afterZ('æ', 'ø', 'å'),
+	"no": afterZ('æ', 'ø', 'å'),
+	"sv": afterZ('å', 'ä', 'ö'),
+}
+
+// letters that are written as more than one letter in the Unicode ordering
+var expansions = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'œ': "oe",
+	'ø': "o",
+	'đ': "d",
+	'ł': "l",
+	'þ': "th",
+}
+
+func afterZ(letters ...rune) map[rune]int {
+	tailoring := make(map[rune]int, len(letters))
+	for index, letter := range letters {
+		tailoring[letter] = 'z'*weightSpacing + index + 1
+	}
+
+	// the letters are also sorted with their equivalents of the neighbouring alphabets
+	switch letters[0] {
+	case 'æ':
+		tailoring['ä'] = tailoring['æ']
+		tailoring['ö'] = tailoring['ø']
+	case 'å':
+		tailoring['æ'] = tailoring['ä']
+		tailoring['ø'] = tailoring['ö']
+	}
+
+	return tailoring
+}
+
+func forLanguage(language string) *Collator {
+	if tailoring, ok := tailorings[language]; ok {
+		return &Collator{language, tailoring}
+	}
+
+	return &Collator{"und", nil}
+}
+
+// the language of the first locale environment variable set, or empty for the
+// 'C' or 'POSIX' locale, which order text by its code points
+func systemLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if value == "C" || value == "POSIX" || strings.HasPrefix(value, "C.") {
+			return ""
+		}
+
+		match := languagePattern.FindStringSubmatch(value)
+		if match == nil {
+			break
+		}
+
+		return strings.ToLower(match[1])
+	}
+
+	return ""
+}
+
+// The weights by which text is compared: firstly the letters regardless of
+// accents and case, then their accents and finally their case.
+func (collator *Collator) keys(text string) [3][]int {
+	var keys [3][]int
+
+	for _, char := range norm.NFC.String(text) {
+		lower := unicode.ToLower(char)
+
+		caseWeight := 0
+		if lower != char {
+			caseWeight = 1
+		}
+
+		if weight, ok := collator.tailoring[lower]; ok {
+			keys[0] = append(keys[0], weight)
+			keys[1] = append(keys[1], 0)
+			keys[2] = append(keys[2], caseWeight)
+			continue
+		}
+
+		decomposed := norm.NFKD.String(string(lower))
+		if expansion, ok := expansions[lower]; ok {
+			decomposed = expansion
+		}
+
+		for _, part := range decomposed {
+			if unicode.Is(unicode.Mn, part) && len(keys[1]) > 0 {
+				// the accent distinguishes the letter it follows
+				keys[1][len(keys[1])-1] = keys[1][len(keys[1])-1]*0x10000 + int(part)
+				continue
+			}
+
+			keys[0] = append(keys[0], int(part)*weightSpacing)
+			keys[1] = append(keys[1], 0)
+			keys[2] = append(keys[2], caseWeight)
+		}
+	}
+
+	return keys
+}
+
+func compareWeights(a, b []int) int {
+	for index := 0; index < len(a) && index < len(b); index++ {
+		switch {
+		case a[index] < b[index]:
+			return -1
+		case a[index] > b[index]:
+			return 1
+		}
+	}
+
+	return len(a) - len(b)
+}
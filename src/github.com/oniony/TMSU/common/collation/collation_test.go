@@ -0,0 +1,115 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package collation
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollatorOrder(test *testing.T) {
+	cases := []struct {
+		name     string
+		expected []string
+	}{{"binary", []string{"Zebra", "apple", "zoo", "Ångström", "élan", "ñu"}},
+		{"unicode", []string{"Ångström", "apple", "élan", "ñu", "Zebra", "zoo"}},
+		{"sv", []string{"apple", "élan", "ñu", "Zebra", "zoo", "Ångström"}},
+		{"es", []string{"Ångström", "apple", "élan", "ñu", "Zebra", "zoo"}}}
+
+	for _, c := range cases {
+		collator, err := New(c.name)
+		if err != nil {
+			test.Fatalf("could not create collator '%v': %v", c.name, err)
+		}
+
+		names := []string{"zoo", "ñu", "élan", "Ångström", "apple", "Zebra"}
+		sort.Slice(names, func(i, j int) bool { return collator.Less(names[i], names[j]) })
+
+		if !reflect.DeepEqual(names, c.expected) {
+			test.Fatalf("collation '%v' ordered names %v, expected %v", c.name, names, c.expected)
+		}
+	}
+}
+
+func TestCollatorTies(test *testing.T) {
+	collator, _ := New("unicode")
+
+	cases := []struct {
+		a, b string
+	}{{"cote", "côte"},
+		{"resume", "Resume"},
+		{"Resume", "résumé"},
+		{"strasse", "straße"},
+		{"straße", "strassen"},
+		{"n", "ñ"},
+		{"ña", "nb"}}
+
+	for _, c := range cases {
+		if !collator.Less(c.a, c.b) || collator.Less(c.b, c.a) {
+			test.Fatalf("expected '%v' to sort before '%v'", c.a, c.b)
+		}
+	}
+
+	if collator.Compare("tag", "tag") != 0 {
+		test.Fatalf("expected identical names to be equal")
+	}
+}
+
+func TestSpanishTailoring(test *testing.T) {
+	collator, _ := New("es_ES.UTF-8")
+
+	if collator.Name != "es" {
+		test.Fatalf("collator was '%v', expected 'es'", collator.Name)
+	}
+	if !collator.Less("nz", "ña") {
+		test.Fatalf("expected 'nz' to sort before 'ña'")
+	}
+}
+
+func TestSystemCollation(test *testing.T) {
+	defer os.Setenv("LC_ALL", os.Getenv("LC_ALL"))
+
+	os.Setenv("LC_ALL", "da_DK.UTF-8")
+	if collator, _ := New("system"); collator.Name != "da" {
+		test.Fatalf("system collator was '%v', expected 'da'", collator.Name)
+	}
+
+	os.Setenv("LC_ALL", "en_GB.UTF-8")
+	if collator, _ := New("system"); collator.Name != "und" {
+		test.Fatalf("system collator was '%v', expected 'und'", collator.Name)
+	}
+
+	os.Setenv("LC_ALL", "C")
+	if collator, _ := New("system"); collator != Binary {
+		test.Fatalf("system collator was '%v', expected 'binary'", collator.Name)
+	}
+}
+
+func TestValidate(test *testing.T) {
+	for _, name := range []string{"binary", "unicode", "system", "sv", "pt_BR", "de-DE"} {
+		if err := Validate(name); err != nil {
+			test.Fatalf("expected '%v' to be valid: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "nocase", "s", "sv/SE"} {
+		if err := Validate(name); err == nil {
+			test.Fatalf("expected '%v' to be invalid", name)
+		}
+	}
+}
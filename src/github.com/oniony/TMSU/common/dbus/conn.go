@@ -0,0 +1,239 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package dbus implements the parts of the D-Bus protocol needed to offer a
+// service on the session bus.
+package dbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A connection to a message bus.
+type Conn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	serial     uint32
+	UniqueName string
+	pending    []*Message
+}
+
+// Connects to the session bus given by the DBUS_SESSION_BUS_ADDRESS environment
+// variable.
+func SessionBus() (*Conn, error) {
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if address == "" {
+		return nil, fmt.Errorf("the session bus address is not set: DBUS_SESSION_BUS_ADDRESS is not defined")
+	}
+
+	return Dial(address)
+}
+
+// Connects to the bus at the address, which is in the semicolon-separated form
+// used by the bus address environment variables.
+func Dial(address string) (*Conn, error) {
+	var lastErr error = fmt.Errorf("no supported transport in bus address '%v'", address)
+
+	for _, entry := range strings.Split(address, ";") {
+		socketPath, err := socketPath(entry)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		netConn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		conn := &Conn{conn: netConn, reader: bufio.NewReader(netConn)}
+		if err := conn.authenticate(); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("could not authenticate with bus: %w", err)
+		}
+
+		values, err := conn.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "")
+		if err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("could not register with bus: %w", err)
+		}
+		conn.UniqueName, _ = values[0].(string)
+
+		return conn, nil
+	}
+
+	return nil, lastErr
+}
+
+// Requests ownership of the well-known bus name.
+func (conn *Conn) RequestName(name string) error {
+	const doNotQueue uint32 = 0x4
+	const primaryOwner uint32 = 1
+	const alreadyOwner uint32 = 4
+
+	values, err := conn.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "RequestName", "su", name, doNotQueue)
+	if err != nil {
+		return err
+	}
+
+	switch values[0] {
+	case primaryOwner, alreadyOwner:
+		return nil
+	}
+
+	return fmt.Errorf("the name '%v' is owned by another connection", name)
+}
+
+// Calls a method and waits for its reply, returning the values within it.
+func (conn *Conn) Call(destination string, path ObjectPath, iface, member string, signature Signature, args ...interface{}) ([]interface{}, error) {
+	call := &Message{Type: MethodCall, Path: path, Interface: iface, Member: member, Destination: destination, Signature: signature, Body: args}
+	if err := conn.send(call); err != nil {
+		return nil, err
+	}
+
+	for {
+		message, err := readMessage(conn.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if message.ReplySerial != call.Serial {
+			// kept for ReadMessage
+			conn.pending = append(conn.pending, message)
+			continue
+		}
+
+		switch message.Type {
+		case MethodReturn:
+			return message.Body, nil
+		case Error:
+			return nil, replyError(message)
+		}
+	}
+}
+
+// Reads the next message sent to the connection.
+func (conn *Conn) ReadMessage() (*Message, error) {
+	if len(conn.pending) > 0 {
+		message := conn.pending[0]
+		conn.pending = conn.pending[1:]
+		return message, nil
+	}
+
+	return readMessage(conn.reader)
+}
+
+// Replies to a method call with the values, unless the caller expects no reply.
+func (conn *Conn) Reply(call *Message, signature Signature, values ...interface{}) error {
+	if call.Flags&NoReplyExpected != 0 {
+		return nil
+	}
+
+	return conn.send(&Message{Type: MethodReturn, ReplySerial: call.Serial, Destination: call.Sender, Signature: signature, Body: values})
+}
+
+// Replies to a method call with an error, unless the caller expects no reply.
+func (conn *Conn) ReplyError(call *Message, name, text string) error {
+	if call.Flags&NoReplyExpected != 0 {
+		return nil
+	}
+
+	return conn.send(&Message{Type: Error, ErrorName: name, ReplySerial: call.Serial, Destination: call.Sender, Signature: "s", Body: []interface{}{text}})
+}
+
+// Closes the connection.
+func (conn *Conn) Close() error {
+	return conn.conn.Close()
+}
+
+// unexported
+
+func (conn *Conn) send(message *Message) error {
+	conn.serial++
+	message.Serial = conn.serial
+
+	data, err := message.marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.conn.Write(data)
+	return err
+}
+
+// authenticates as the user running the process with the EXTERNAL mechanism
+func (conn *Conn) authenticate() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := conn.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+
+	line, err := conn.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("authentication was rejected: %v", strings.TrimSpace(line))
+	}
+
+	_, err = conn.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+func socketPath(address string) (string, error) {
+	colon := strings.Index(address, ":")
+	if colon == -1 || address[:colon] != "unix" {
+		return "", fmt.Errorf("unsupported bus address '%v'", address)
+	}
+
+	for _, pair := range strings.Split(address[colon+1:], ",") {
+		equals := strings.Index(pair, "=")
+		if equals == -1 {
+			continue
+		}
+
+		value, err := url.PathUnescape(pair[equals+1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid bus address '%v': %w", address, err)
+		}
+
+		switch pair[:equals] {
+		case "path":
+			return value, nil
+		case "abstract":
+			return "@" + value, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported bus address '%v'", address)
+}
+
+func replyError(message *Message) error {
+	if len(message.Body) > 0 {
+		if text, ok := message.Body[0].(string); ok {
+			return fmt.Errorf("%v: %v", message.ErrorName, text)
+		}
+	}
+
+	return fmt.Errorf("%v", message.ErrorName)
+}
@@ -0,0 +1,93 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dbus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMessageRoundTrip(test *testing.T) {
+	message := &Message{Type: MethodCall,
+		Serial:      7,
+		Path:        "/org/tmsu/Tmsu",
+		Interface:   "org.tmsu.Tmsu",
+		Member:      "Tag",
+		Destination: "org.tmsu.Tmsu",
+		Signature:   "sasu(yv)",
+		Body:        []interface{}{"/some/path", []string{"cat", "year=2019"}, uint32(3), []interface{}{byte(1), Variant{"s", "x"}}}}
+
+	data, err := message.marshal()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	actual, err := readMessage(bytes.NewReader(data))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(actual, message) {
+		test.Fatalf("Expected %+v but was %+v", message, actual)
+	}
+}
+
+func TestSplitSignature(test *testing.T) {
+	assertSplitSignature("sas", []string{"s", "as"}, test)
+	assertSplitSignature("a(yv)u", []string{"a(yv)", "u"}, test)
+	assertSplitSignature("a{sv}", []string{"a{sv}"}, test)
+
+	for _, signature := range []string{"a", "(", "()", "z"} {
+		if _, err := splitSignature(signature); err == nil {
+			test.Fatalf("Expected signature '%v' to be invalid", signature)
+		}
+	}
+}
+
+func TestSocketPath(test *testing.T) {
+	paths := map[string]string{
+		"unix:path=/run/user/1000/bus":          "/run/user/1000/bus",
+		"unix:abstract=/tmp/dbus-x,guid=abc123": "@/tmp/dbus-x",
+		"unix:guid=abc,path=/tmp/a%20b":         "/tmp/a b"}
+
+	for address, expected := range paths {
+		actual, err := socketPath(address)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if actual != expected {
+			test.Fatalf("Expected socket path for '%v' to be '%v' but was '%v'", address, expected, actual)
+		}
+	}
+
+	if _, err := socketPath("tcp:host=localhost,port=1"); err == nil {
+		test.Fatalf("Expected TCP address to be unsupported")
+	}
+}
+
+// unexported
+
+func assertSplitSignature(signature string, expected []string, test *testing.T) {
+	actual, err := splitSignature(signature)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		test.Fatalf("Expected '%v' to split into %v but was %v", signature, expected, actual)
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// A D-Bus object path.
+type ObjectPath string
+
+// A D-Bus type signature.
+type Signature string
+
+// A value whose type is carried with it.
+type Variant struct {
+	Signature Signature
+	Value     interface{}
+}
+
+// unexported
+
+type encoder struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newEncoder() *encoder {
+	return &encoder{make([]byte, 0, 64), binary.LittleEndian}
+}
+
+func (enc *encoder) align(alignment int) {
+	for len(enc.data)%alignment != 0 {
+		enc.data = append(enc.data, 0)
+	}
+}
+
+func (enc *encoder) uint32(value uint32) {
+	enc.align(4)
+	var bytes [4]byte
+	enc.order.PutUint32(bytes[:], value)
+	enc.data = append(enc.data, bytes[:]...)
+}
+
+func (enc *encoder) string(value string) {
+	enc.uint32(uint32(len(value)))
+	enc.data = append(enc.data, value...)
+	enc.data = append(enc.data, 0)
+}
+
+func (enc *encoder) signature(value string) {
+	enc.data = append(enc.data, byte(len(value)))
+	enc.data = append(enc.data, value...)
+	enc.data = append(enc.data, 0)
+}
+
+// encodes the values according to the signature
+func (enc *encoder) encode(signature string, values ...interface{}) error {
+	types, err := splitSignature(signature)
+	if err != nil {
+		return err
+	}
+	if len(types) != len(values) {
+		return fmt.Errorf("signature '%v' does not describe %v values", signature, len(values))
+	}
+
+	for index, typ := range types {
+		if err := enc.value(typ, values[index]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (enc *encoder) value(typ string, value interface{}) error {
+	mismatch := fmt.Errorf("cannot encode %T as '%v'", value, typ)
+
+	switch typ[0] {
+	case 'y':
+		byteValue, ok := value.(byte)
+		if !ok {
+			return mismatch
+		}
+		enc.data = append(enc.data, byteValue)
+	case 'b':
+		boolValue, ok := value.(bool)
+		if !ok {
+			return mismatch
+		}
+		if boolValue {
+			enc.uint32(1)
+		} else {
+			enc.uint32(0)
+		}
+	case 'i':
+		intValue, ok := value.(int32)
+		if !ok {
+			return mismatch
+		}
+		enc.uint32(uint32(intValue))
+	case 'u':
+		uintValue, ok := value.(uint32)
+		if !ok {
+			return mismatch
+		}
+		enc.uint32(uintValue)
+	case 's':
+		stringValue, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		enc.string(stringValue)
+	case 'o':
+		pathValue, ok := value.(ObjectPath)
+		if !ok {
+			return mismatch
+		}
+		enc.string(string(pathValue))
+	case 'g':
+		signatureValue, ok := value.(Signature)
+		if !ok {
+			return mismatch
+		}
+		enc.signature(string(signatureValue))
+	case 'v':
+		variant, ok := value.(Variant)
+		if !ok {
+			return mismatch
+		}
+		enc.signature(string(variant.Signature))
+		return enc.value(string(variant.Signature), variant.Value)
+	case 'a':
+		return enc.array(typ[1:], value, mismatch)
+	case '(':
+		fields, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		enc.align(8)
+		return enc.encode(typ[1:len(typ)-1], fields...)
+	default:
+		return fmt.Errorf("unsupported type '%v'", typ)
+	}
+
+	return nil
+}
+
+func (enc *encoder) array(elementType string, value interface{}, mismatch error) error {
+	var elements []interface{}
+	switch typedValue := value.(type) {
+	case []string:
+		for _, element := range typedValue {
+			elements = append(elements, element)
+		}
+	case []interface{}:
+		elements = typedValue
+	default:
+		return mismatch
+	}
+
+	enc.uint32(0)
+	lengthOffset := len(enc.data) - 4
+
+	// the length excludes the padding before the first element
+	enc.align(alignment(elementType))
+	start := len(enc.data)
+
+	for _, element := range elements {
+		if err := enc.value(elementType, element); err != nil {
+			return err
+		}
+	}
+
+	enc.order.PutUint32(enc.data[lengthOffset:], uint32(len(enc.data)-start))
+
+	return nil
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (dec *decoder) align(alignment int) error {
+	for dec.pos%alignment != 0 {
+		dec.pos++
+	}
+	if dec.pos > len(dec.data) {
+		return fmt.Errorf("message is truncated")
+	}
+
+	return nil
+}
+
+func (dec *decoder) bytes(count int) ([]byte, error) {
+	if dec.pos+count > len(dec.data) {
+		return nil, fmt.Errorf("message is truncated")
+	}
+
+	bytes := dec.data[dec.pos : dec.pos+count]
+	dec.pos += count
+
+	return bytes, nil
+}
+
+func (dec *decoder) uint32() (uint32, error) {
+	if err := dec.align(4); err != nil {
+		return 0, err
+	}
+
+	bytes, err := dec.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return dec.order.Uint32(bytes), nil
+}
+
+func (dec *decoder) string() (string, error) {
+	length, err := dec.uint32()
+	if err != nil {
+		return "", err
+	}
+	if length > math.MaxInt32 {
+		return "", fmt.Errorf("string is too long")
+	}
+
+	bytes, err := dec.bytes(int(length) + 1)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes[:length]), nil
+}
+
+func (dec *decoder) signature() (string, error) {
+	lengthBytes, err := dec.bytes(1)
+	if err != nil {
+		return "", err
+	}
+
+	bytes, err := dec.bytes(int(lengthBytes[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes[:lengthBytes[0]]), nil
+}
+
+// decodes the values described by the signature: arrays of strings are
+// decoded as []string and other arrays and structures as []interface{}
+func (dec *decoder) decode(signature string) ([]interface{}, error) {
+	types, err := splitSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(types))
+	for _, typ := range types {
+		value, err := dec.value(typ)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (dec *decoder) value(typ string) (interface{}, error) {
+	switch typ[0] {
+	case 'y':
+		bytes, err := dec.bytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return bytes[0], nil
+	case 'b':
+		value, err := dec.uint32()
+		return value != 0, err
+	case 'i':
+		value, err := dec.uint32()
+		return int32(value), err
+	case 'u':
+		return dec.uint32()
+	case 's':
+		return dec.string()
+	case 'o':
+		value, err := dec.string()
+		return ObjectPath(value), err
+	case 'g':
+		value, err := dec.signature()
+		return Signature(value), err
+	case 'v':
+		signature, err := dec.signature()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := splitSignature(signature); err != nil {
+			return nil, err
+		}
+		value, err := dec.value(signature)
+		return Variant{Signature(signature), value}, err
+	case 'a':
+		return dec.array(typ[1:])
+	case '(', '{':
+		if err := dec.align(8); err != nil {
+			return nil, err
+		}
+		return dec.decode(typ[1 : len(typ)-1])
+	}
+
+	return nil, fmt.Errorf("unsupported type '%v'", typ)
+}
+
+func (dec *decoder) array(elementType string) (interface{}, error) {
+	length, err := dec.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dec.align(alignment(elementType)); err != nil {
+		return nil, err
+	}
+
+	end := dec.pos + int(length)
+	if length > math.MaxInt32 || end > len(dec.data) {
+		return nil, fmt.Errorf("message is truncated")
+	}
+
+	if elementType == "s" {
+		elements := make([]string, 0, 10)
+		for dec.pos < end {
+			element, err := dec.string()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return elements, nil
+	}
+
+	elements := make([]interface{}, 0, 10)
+	for dec.pos < end {
+		element, err := dec.value(elementType)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	return elements, nil
+}
+
+func alignment(typ string) int {
+	switch typ[0] {
+	case 'y', 'g', 'v':
+		return 1
+	case '(', '{', 'x', 't', 'd':
+		return 8
+	}
+
+	return 4
+}
+
+// splits the signature into its complete types
+func splitSignature(signature string) ([]string, error) {
+	types := make([]string, 0, 4)
+
+	for len(signature) > 0 {
+		length, err := completeTypeLength(signature)
+		if err != nil {
+			return nil, err
+		}
+
+		types = append(types, signature[:length])
+		signature = signature[length:]
+	}
+
+	return types, nil
+}
+
+func completeTypeLength(signature string) (int, error) {
+	invalid := fmt.Errorf("invalid signature '%v'", signature)
+
+	if len(signature) == 0 {
+		return 0, invalid
+	}
+
+	switch signature[0] {
+	case 'a':
+		length, err := completeTypeLength(signature[1:])
+		return length + 1, err
+	case '(', '{':
+		closing := byte(')')
+		if signature[0] == '{' {
+			closing = '}'
+		}
+
+		index := 1
+		for index < len(signature) && signature[index] != closing {
+			length, err := completeTypeLength(signature[index:])
+			if err != nil {
+				return 0, err
+			}
+			index += length
+		}
+		if index >= len(signature) || index == 1 {
+			return 0, invalid
+		}
+
+		return index + 1, nil
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v', 'h':
+		return 1, nil
+	}
+
+	return 0, invalid
+}
@@ -0,0 +1,185 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type MessageType byte
+
+const (
+	MethodCall MessageType = iota + 1
+	MethodReturn
+	Error
+	Signal
+)
+
+// The flag of a method call whose caller does not want a reply.
+const NoReplyExpected byte = 0x1
+
+// A D-Bus message.
+type Message struct {
+	Type        MessageType
+	Flags       byte
+	Serial      uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   Signature
+	Body        []interface{}
+}
+
+// unexported
+
+const (
+	pathField byte = iota + 1
+	interfaceField
+	memberField
+	errorNameField
+	replySerialField
+	destinationField
+	senderField
+	signatureField
+)
+
+const protocolVersion = 1
+
+// the maximum length of a message permitted by the specification
+const maxMessageLength = 1 << 27
+
+func (message *Message) marshal() ([]byte, error) {
+	body := newEncoder()
+	if err := body.encode(string(message.Signature), message.Body...); err != nil {
+		return nil, err
+	}
+
+	fields := make([]interface{}, 0, 8)
+	addField := func(code byte, signature Signature, value interface{}) {
+		fields = append(fields, []interface{}{code, Variant{signature, value}})
+	}
+	if message.Path != "" {
+		addField(pathField, "o", message.Path)
+	}
+	if message.Interface != "" {
+		addField(interfaceField, "s", message.Interface)
+	}
+	if message.Member != "" {
+		addField(memberField, "s", message.Member)
+	}
+	if message.ErrorName != "" {
+		addField(errorNameField, "s", message.ErrorName)
+	}
+	if message.ReplySerial != 0 {
+		addField(replySerialField, "u", message.ReplySerial)
+	}
+	if message.Destination != "" {
+		addField(destinationField, "s", message.Destination)
+	}
+	if message.Signature != "" {
+		addField(signatureField, "g", message.Signature)
+	}
+
+	header := newEncoder()
+	header.data = append(header.data, 'l', byte(message.Type), message.Flags, protocolVersion)
+	header.uint32(uint32(len(body.data)))
+	header.uint32(message.Serial)
+	if err := header.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	header.align(8)
+
+	return append(header.data, body.data...), nil
+}
+
+func readMessage(reader io.Reader) (*Message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid byte order '%c'", fixed[0])
+	}
+
+	bodyLength := order.Uint32(fixed[4:8])
+	fieldsLength := order.Uint32(fixed[12:16])
+	if bodyLength > maxMessageLength || fieldsLength > maxMessageLength {
+		return nil, fmt.Errorf("message is too long")
+	}
+
+	headerLength := 16 + int(fieldsLength)
+	padding := (8 - headerLength%8) % 8
+
+	data := make([]byte, headerLength+padding+int(bodyLength))
+	copy(data, fixed)
+	if _, err := io.ReadFull(reader, data[16:]); err != nil {
+		return nil, err
+	}
+
+	message := &Message{Type: MessageType(fixed[1]), Flags: fixed[2], Serial: order.Uint32(fixed[8:12])}
+
+	header := &decoder{data[:headerLength], 12, order}
+	values, err := header.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range values[0].([]interface{}) {
+		fieldValues := field.([]interface{})
+		code := fieldValues[0].(byte)
+		value := fieldValues[1].(Variant).Value
+
+		switch code {
+		case pathField:
+			message.Path, _ = value.(ObjectPath)
+		case interfaceField:
+			message.Interface, _ = value.(string)
+		case memberField:
+			message.Member, _ = value.(string)
+		case errorNameField:
+			message.ErrorName, _ = value.(string)
+		case replySerialField:
+			message.ReplySerial, _ = value.(uint32)
+		case destinationField:
+			message.Destination, _ = value.(string)
+		case senderField:
+			message.Sender, _ = value.(string)
+		case signatureField:
+			message.Signature, _ = value.(Signature)
+		}
+	}
+
+	body := &decoder{data[headerLength+padding:], 0, order}
+	message.Body, err = body.decode(string(message.Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exif
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The EXIF fields of an image, keyed by field name.
+type Fields map[string]string
+
+// Reads the EXIF fields of the specified JPEG or TIFF file. Files of other
+// types have no fields.
+func ReadFile(path string) (Fields, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Reads the EXIF fields of a JPEG or TIFF image.
+func Read(reader io.ReaderAt) (Fields, error) {
+	header := make([]byte, 4)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return Fields{}, nil
+		}
+
+		return nil, err
+	}
+
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		return readJpeg(reader)
+	case string(header) == "II*\x00", string(header) == "MM\x00*":
+		return readTiff(reader)
+	}
+
+	return Fields{}, nil
+}
+
+// unexported
+
+var errInvalid = errors.New("invalid EXIF data")
+
+const (
+	asciiType    = 2
+	shortType    = 3
+	longType     = 4
+	rationalType = 5
+)
+
+const exifIfdPointer = 0x8769
+
+// values longer than this are not read
+const maximumValueLength = 1024
+
+var fieldNames = map[uint16]string{
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x920A: "FocalLength",
+	0xA002: "PixelXDimension",
+	0xA003: "PixelYDimension",
+	0xA433: "LensMake",
+	0xA434: "LensModel",
+}
+
+func readJpeg(reader io.ReaderAt) (Fields, error) {
+	offset := int64(2)
+	segment := make([]byte, 4)
+
+	for {
+		if _, err := reader.ReadAt(segment, offset); err != nil {
+			if err == io.EOF {
+				return Fields{}, nil
+			}
+
+			return nil, err
+		}
+		if segment[0] != 0xFF {
+			return nil, errInvalid
+		}
+
+		length := int64(binary.BigEndian.Uint16(segment[2:]))
+
+		switch segment[1] {
+		case 0xE1: // APP1
+			identifier := make([]byte, 6)
+			if _, err := reader.ReadAt(identifier, offset+4); err != nil {
+				return nil, errInvalid
+			}
+
+			if string(identifier) == "Exif\x00\x00" {
+				return readTiff(io.NewSectionReader(reader, offset+10, length-8))
+			}
+		case 0xDA, 0xD9: // start of scan, end of image
+			return Fields{}, nil
+		}
+
+		offset += 2 + length
+	}
+}
+
+func readTiff(reader io.ReaderAt) (Fields, error) {
+	header := make([]byte, 8)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		return nil, errInvalid
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errInvalid
+	}
+
+	fields := make(Fields)
+
+	exifOffset, err := readIfd(reader, order, int64(order.Uint32(header[4:])), fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if exifOffset != 0 {
+		if _, err := readIfd(reader, order, exifOffset, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+// reads the fields of an image file directory, returning the offset of the
+// EXIF directory, if it refers to one
+func readIfd(reader io.ReaderAt, order binary.ByteOrder, offset int64, fields Fields) (int64, error) {
+	countBytes := make([]byte, 2)
+	if _, err := reader.ReadAt(countBytes, offset); err != nil {
+		return 0, errInvalid
+	}
+
+	count := int(order.Uint16(countBytes))
+	entries := make([]byte, count*12)
+	if _, err := reader.ReadAt(entries, offset+2); err != nil {
+		return 0, errInvalid
+	}
+
+	var exifOffset int64
+	for index := 0; index < count; index++ {
+		entry := entries[index*12 : (index+1)*12]
+		id := order.Uint16(entry[0:])
+
+		if id == exifIfdPointer {
+			exifOffset = int64(order.Uint32(entry[8:]))
+			continue
+		}
+
+		name, ok := fieldNames[id]
+		if !ok {
+			continue
+		}
+
+		value, err := readValue(reader, order, order.Uint16(entry[2:]), order.Uint32(entry[4:]), entry[8:])
+		if err != nil {
+			return 0, err
+		}
+		if value != "" {
+			fields[name] = value
+		}
+	}
+
+	return exifOffset, nil
+}
+
+func readValue(reader io.ReaderAt, order binary.ByteOrder, valueType uint16, count uint32, data []byte) (string, error) {
+	var size uint32
+	switch valueType {
+	case asciiType:
+		size = 1
+	case shortType:
+		size = 2
+	case longType:
+		size = 4
+	case rationalType:
+		size = 8
+	default:
+		return "", nil
+	}
+
+	length := size * count
+	if count == 0 || length > maximumValueLength {
+		return "", nil
+	}
+
+	// values of more than four bytes are stored elsewhere
+	if length > 4 {
+		offset := int64(order.Uint32(data))
+		data = make([]byte, length)
+		if _, err := reader.ReadAt(data, offset); err != nil {
+			return "", errInvalid
+		}
+	}
+
+	switch valueType {
+	case asciiType:
+		return strings.TrimRight(string(data[:length]), "\x00 "), nil
+	case shortType:
+		return strconv.FormatUint(uint64(order.Uint16(data)), 10), nil
+	case longType:
+		return strconv.FormatUint(uint64(order.Uint32(data)), 10), nil
+	default:
+		numerator := strconv.FormatUint(uint64(order.Uint32(data)), 10)
+		denominator := strconv.FormatUint(uint64(order.Uint32(data[4:])), 10)
+		if denominator == "1" {
+			return numerator, nil
+		}
+
+		return numerator + "/" + denominator, nil
+	}
+}
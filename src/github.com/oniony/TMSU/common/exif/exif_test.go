@@ -0,0 +1,100 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadTiff(test *testing.T) {
+	fields, err := Read(bytes.NewReader(tiffImage()))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	assertFields(test, fields)
+}
+
+func TestReadJpeg(test *testing.T) {
+	tiff := tiffImage()
+
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(jpeg[4:], uint16(2+6+len(tiff)))
+	jpeg = append(jpeg, "Exif\x00\x00"...)
+	jpeg = append(jpeg, tiff...)
+	jpeg = append(jpeg, 0xFF, 0xD9)
+
+	fields, err := Read(bytes.NewReader(jpeg))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	assertFields(test, fields)
+}
+
+func TestReadOther(test *testing.T) {
+	fields, err := Read(bytes.NewReader([]byte("fLaC and other content")))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(fields) != 0 {
+		test.Fatalf("expected no fields but got %v", fields)
+	}
+}
+
+// unexported
+
+func assertFields(test *testing.T, fields Fields) {
+	if len(fields) != 2 {
+		test.Fatalf("expected 2 fields but got %v", fields)
+	}
+	if fields["Make"] != "Canon" {
+		test.Fatalf("expected Make of 'Canon' but got '%v'", fields["Make"])
+	}
+	if fields["ISOSpeedRatings"] != "100" {
+		test.Fatalf("expected ISOSpeedRatings of '100' but got '%v'", fields["ISOSpeedRatings"])
+	}
+}
+
+// builds a little-endian TIFF with a Make field, stored outside of the
+// directory, and an EXIF directory holding an ISOSpeedRatings field
+func tiffImage() []byte {
+	order := binary.LittleEndian
+	image := make([]byte, 62)
+
+	copy(image, "II*\x00")
+	order.PutUint32(image[4:], 8)
+
+	order.PutUint16(image[8:], 2)
+	putEntry(image[10:], 0x010F, asciiType, 6, 38)
+	putEntry(image[22:], exifIfdPointer, longType, 1, 44)
+	copy(image[38:], "Canon\x00")
+
+	order.PutUint16(image[44:], 1)
+	putEntry(image[46:], 0x8827, shortType, 1, 100)
+
+	return image
+}
+
+func putEntry(entry []byte, id, valueType uint16, count, value uint32) {
+	binary.LittleEndian.PutUint16(entry[0:], id)
+	binary.LittleEndian.PutUint16(entry[2:], valueType)
+	binary.LittleEndian.PutUint32(entry[4:], count)
+	binary.LittleEndian.PutUint32(entry[8:], value)
+}
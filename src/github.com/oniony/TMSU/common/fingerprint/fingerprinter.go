@@ -19,20 +19,127 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"hash/fnv"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/oniony/TMSU/common/text"
 	"golang.org/x/crypto/blake2b"
 )
 
 const sparseFingerprintThreshold = 5 * 1024 * 1024
 const sparseFingerprintSize = 512 * 1024
 
+// The supported file fingerprint algorithms.
+var FileAlgorithms = []string{"dynamic:SHA256", "dynamic:SHA1", "dynamic:MD5", "dynamic:BLAKE2b", "dynamic:FNV1a",
+	"SHA256", "SHA1", "MD5", "BLAKE2b", "FNV1a", "command", "none"}
+
+// The supported directory fingerprint algorithms.
+var DirectoryAlgorithms = []string{"contents", "dynamic:sumSizes", "sumSizes", "none"}
+
+// The placeholder within a fingerprint command that is replaced with the path
+// of the file to fingerprint.
+const CommandPathPlaceholder = "%path"
+
+// The number of megabytes read from each end of a file by the 'sparse:' algorithms
+// unless otherwise specified.
+const defaultSparseMegabytes = 16
+
+// Validates a file fingerprint algorithm name.
+func ValidateFileAlgorithm(algorithm string) error {
+	if strings.HasPrefix(algorithm, "sparse:") {
+		_, _, err := parseSparseAlgorithm(algorithm)
+		return err
+	}
+
+	for _, fileAlgorithm := range FileAlgorithms {
+		if algorithm == fileAlgorithm {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported file fingerprint algorithm '%v': supported algorithms are %v, sparse:HASH[:MB]", algorithm, strings.Join(FileAlgorithms, ", "))
+}
+
+// Validates the command line of an external fingerprint command.
+func ValidateCommand(commandLine string) error {
+	if len(text.Tokenize(commandLine)) == 0 {
+		return fmt.Errorf("fingerprint command must specify a program")
+	}
+
+	return nil
+}
+
+// Validates a directory fingerprint algorithm name.
+func ValidateDirectoryAlgorithm(algorithm string) error {
+	for _, directoryAlgorithm := range DirectoryAlgorithms {
+		if algorithm == directoryAlgorithm {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported directory fingerprint algorithm '%v': supported algorithms are %v", algorithm, strings.Join(DirectoryAlgorithms, ", "))
+}
+
+// Determines whether the fingerprint calculated by the algorithm for a file of
+// the specified size is based upon only part of the file's contents.
+func IsPartial(algorithm string, fileSize int64) bool {
+	switch {
+	case algorithm == "", strings.HasPrefix(algorithm, "dynamic:"):
+		return fileSize > sparseFingerprintThreshold
+	case strings.HasPrefix(algorithm, "sparse:"):
+		_, sparseSize, err := parseSparseAlgorithm(algorithm)
+		return err == nil && fileSize > 2*sparseSize
+	}
+
+	return false
+}
+
+// Creates a fingerprint of the whole of a file's contents using the hash
+// underlying the specified file fingerprint algorithm.
+func CreateExact(path, algorithm string) (Fingerprint, error) {
+	h, err := exactHash(algorithm)
+	if err != nil {
+		return Empty, err
+	}
+
+	return calculateRegularFingerprint(path, h)
+}
+
+// The number of bytes at the start of a file fingerprinted by CreateHead.
+const HeadSize = 4 * 1024
+
+// Creates a fingerprint of the first HeadSize bytes of a file's contents using
+// the hash underlying the specified file fingerprint algorithm. Files whose
+// head fingerprints differ cannot be duplicates.
+func CreateHead(path, algorithm string) (Fingerprint, error) {
+	h, err := exactHash(algorithm)
+	if err != nil {
+		return Empty, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, io.LimitReader(file, HeadSize)); err != nil {
+		return Empty, err
+	}
+
+	return Fingerprint(hex.EncodeToString(h.Sum(make([]byte, 0, 64)))), nil
+}
+
 func Create(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string) (Fingerprint, error) {
 	stat, err := os.Lstat(path)
 	if err != nil {
@@ -52,7 +159,7 @@ func Create(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string) (F
 
 	switch {
 	case stat.Mode().IsDir():
-		return createDirectoryFingerprint(path, directoryAlgorithm)
+		return createDirectoryFingerprint(path, fileAlgorithm, directoryAlgorithm)
 	case stat.Mode().IsRegular():
 		return createFileFingerprint(path, fileAlgorithm, stat)
 	default:
@@ -63,42 +170,107 @@ func Create(path, fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string) (F
 // unexported
 
 func createFileFingerprint(path, algorithm string, stat os.FileInfo) (Fingerprint, error) {
-	switch algorithm {
-	case "dynamic:SHA256", "":
+	switch {
+	case algorithm == "":
 		return dynamicFingerprint(path, sha256.New(), stat.Size())
-	case "dynamic:SHA1":
-		return dynamicFingerprint(path, sha1.New(), stat.Size())
-	case "dynamic:MD5":
-		return dynamicFingerprint(path, md5.New(), stat.Size())
-	case "dynamic:BLAKE2b":
-		hash, err := blake2b.New256(nil)
+	case algorithm == "none":
+		return Empty, nil
+	case algorithm == "command":
+		return Empty, fmt.Errorf("the 'fingerprintCommand' setting must be set to use the 'command' file fingerprint algorithm")
+	case strings.HasPrefix(algorithm, "command:"):
+		return commandFingerprint(path, algorithm[len("command:"):])
+	case strings.HasPrefix(algorithm, "dynamic:"):
+		h, err := newHash(algorithm[len("dynamic:"):])
+		if err != nil {
+			return "", fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+		}
+		return dynamicFingerprint(path, h, stat.Size())
+	case strings.HasPrefix(algorithm, "sparse:"):
+		hashName, sparseSize, err := parseSparseAlgorithm(algorithm)
 		if err != nil {
-			// Should never happen actually.
 			return "", err
 		}
-		return dynamicFingerprint(path, hash, stat.Size())
+		h, _ := newHash(hashName)
+		return sparseFingerprint(path, h, stat.Size(), sparseSize)
+	default:
+		h, err := newHash(algorithm)
+		if err != nil {
+			return "", fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+		}
+		return regularFingerprint(path, h)
+	}
+}
+
+// the hash with which the entire contents of files are fingerprinted for the file fingerprint algorithm
+func exactHash(algorithm string) (hash.Hash, error) {
+	hashName := algorithm
+	switch {
+	case algorithm == "", algorithm == "none":
+		hashName = "SHA256"
+	case strings.HasPrefix(algorithm, "dynamic:"):
+		hashName = algorithm[len("dynamic:"):]
+	case algorithm == "command", strings.HasPrefix(algorithm, "command:"):
+		hashName = "SHA256"
+	case strings.HasPrefix(algorithm, "sparse:"):
+		var err error
+		if hashName, _, err = parseSparseAlgorithm(algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	h, err := newHash(hashName)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+	}
+
+	return h, nil
+}
+
+func newHash(name string) (hash.Hash, error) {
+	switch name {
 	case "SHA256":
-		return regularFingerprint(path, sha256.New())
+		return sha256.New(), nil
 	case "SHA1":
-		return regularFingerprint(path, sha1.New())
+		return sha1.New(), nil
 	case "MD5":
-		return regularFingerprint(path, md5.New())
+		return md5.New(), nil
 	case "BLAKE2b":
-		hash, err := blake2b.New256(nil)
-		if err != nil {
-			// Should never happen actually.
-			return "", err
-		}
-		return regularFingerprint(path, hash)
-	case "none":
-		return Empty, nil
+		return blake2b.New256(nil)
+	case "FNV1a":
+		return fnv.New64a(), nil
 	default:
-		return "", fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+		return nil, fmt.Errorf("unsupported hash '%v'", name)
+	}
+}
+
+// Parses a 'sparse:HASH[:MB]' algorithm into the hash name and the number of
+// bytes to read from each end of the file.
+func parseSparseAlgorithm(algorithm string) (string, int64, error) {
+	parts := strings.Split(algorithm, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "sparse" {
+		return "", 0, fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+	}
+
+	if _, err := newHash(parts[1]); err != nil {
+		return "", 0, fmt.Errorf("unsupported file fingerprint algorithm '%v'", algorithm)
+	}
+
+	var megabytes uint64 = defaultSparseMegabytes
+	if len(parts) == 3 {
+		var err error
+		megabytes, err = strconv.ParseUint(parts[2], 10, 16)
+		if err != nil || megabytes == 0 {
+			return "", 0, fmt.Errorf("invalid size '%v' in file fingerprint algorithm '%v'", parts[2], algorithm)
+		}
 	}
+
+	return parts[1], int64(megabytes) * 1024 * 1024, nil
 }
 
-func createDirectoryFingerprint(path, algorithm string) (Fingerprint, error) {
+func createDirectoryFingerprint(path, fileAlgorithm, algorithm string) (Fingerprint, error) {
 	switch algorithm {
+	case "contents":
+		return contentsFingerprint(path, fileAlgorithm)
 	case "sumSizes":
 		return sumSizesFingerprint(path, 0)
 	case "dynamic:sumSizes", "":
@@ -136,6 +308,47 @@ func dynamicFingerprint(path string, h hash.Hash, fileSize int64) (Fingerprint,
 }
 
 // Uses the symbolic target's filename as the fingerprint
+// runs the external fingerprint command, substituting the file's path for the
+// placeholder or else appending it, and prefixes its output with the program
+// name so that fingerprints from different commands never coincide
+func commandFingerprint(path, commandLine string) (Fingerprint, error) {
+	words := text.Tokenize(commandLine)
+	if len(words) == 0 {
+		return Empty, fmt.Errorf("fingerprint command must specify a program")
+	}
+
+	substituted := false
+	for index, word := range words[1:] {
+		if strings.Contains(word, CommandPathPlaceholder) {
+			words[index+1] = strings.Replace(word, CommandPathPlaceholder, path, -1)
+			substituted = true
+		}
+	}
+	if !substituted {
+		words = append(words, path)
+	}
+
+	command := exec.Command(words[0], words[1:]...)
+	var stderr strings.Builder
+	command.Stderr = &stderr
+
+	output, err := command.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return Empty, fmt.Errorf("fingerprint command '%v' failed for '%v': %w", words[0], path, err)
+		}
+		return Empty, fmt.Errorf("fingerprint command '%v' failed for '%v': %v", words[0], path, message)
+	}
+
+	value := strings.TrimSpace(string(output))
+	if value == "" {
+		return Empty, fmt.Errorf("fingerprint command '%v' produced no fingerprint for '%v'", words[0], path)
+	}
+
+	return Fingerprint(filepath.Base(words[0]) + ":" + value), nil
+}
+
 func symlinkTargetNameFingerprint(path string, includeExtension bool) (Fingerprint, error) {
 	target, err := os.Readlink(path)
 	if err != nil {
@@ -186,6 +399,68 @@ out:
 	return Fingerprint(strconv.FormatInt(totalSize, 16)), nil
 }
 
+// Creates a composite directory fingerprint by hashing the names, types and
+// fingerprints of the directory's entries, recursively, such that directories
+// have the same fingerprint only where their entire trees match. Symbolic links
+// within the directory contribute only their target.
+func contentsFingerprint(path, fileAlgorithm string) (Fingerprint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	names, err := file.Readdirnames(0)
+	file.Close()
+	if err != nil {
+		return Empty, err
+	}
+
+	if len(names) == 0 {
+		return Empty, nil
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		childPath := filepath.Join(path, name)
+
+		stat, err := os.Lstat(childPath)
+		if err != nil {
+			return Empty, err
+		}
+
+		var kind string
+		var fingerprint Fingerprint
+
+		switch {
+		case stat.Mode()&os.ModeSymlink != 0:
+			kind = "l"
+			target, err := os.Readlink(childPath)
+			if err != nil {
+				return Empty, err
+			}
+			fingerprint = Fingerprint(target)
+		case stat.IsDir():
+			kind = "d"
+			if fingerprint, err = contentsFingerprint(childPath, fileAlgorithm); err != nil {
+				return Empty, err
+			}
+		case stat.Mode().IsRegular():
+			kind = "f:" + strconv.FormatInt(stat.Size(), 16)
+			if fingerprint, err = createFileFingerprint(childPath, fileAlgorithm, stat); err != nil {
+				return Empty, err
+			}
+		default:
+			continue
+		}
+
+		fmt.Fprintf(h, "%v\x00%v\x00%v\n", kind, name, fingerprint)
+	}
+
+	sum := h.Sum(make([]byte, 0, 64))
+	return Fingerprint(hex.EncodeToString(sum)), nil
+}
+
 func stats(path string) []os.FileInfo {
 	file, err := os.Open(path)
 	if err != nil {
@@ -247,6 +522,35 @@ func calculateSparseFingerprint(path string, fileSize int64, h hash.Hash) (Finge
 	return Fingerprint(fingerprint), nil
 }
 
+// Hashes the first and last sparseSize bytes of the file together with its size
+func sparseFingerprint(path string, h hash.Hash, fileSize, sparseSize int64) (Fingerprint, error) {
+	if fileSize <= 2*sparseSize {
+		return calculateRegularFingerprint(path, h)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, sparseSize)); err != nil {
+		return Empty, err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(file, fileSize-sparseSize, sparseSize)); err != nil {
+		return Empty, err
+	}
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(fileSize))
+	h.Write(size)
+
+	sum := h.Sum(make([]byte, 0, 64))
+	fingerprint := hex.EncodeToString(sum)
+
+	return Fingerprint(fingerprint), nil
+}
+
 func calculateRegularFingerprint(path string, h hash.Hash) (Fingerprint, error) {
 	file, err := os.Open(path)
 	if err != nil {
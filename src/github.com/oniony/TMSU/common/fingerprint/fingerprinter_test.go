@@ -16,6 +16,7 @@
 package fingerprint
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -46,6 +47,11 @@ func TestBLAKE2bGeneration(test *testing.T) {
 	testCreateForLargeFile(test, "BLAKE2b", "fdc4dc9cebbd6f162b3dad4d196646df430dbae8c547df01447285da55247087")
 }
 
+func TestFNV1aGeneration(test *testing.T) {
+	testCreateForSmallFile(test, "FNV1a", "7ab6c028b6a257d2")
+	testCreateForLargeFile(test, "FNV1a", "467a88b11ba257d2")
+}
+
 func TestDynamicMD5Generation(test *testing.T) {
 	testCreateForSmallFile(test, "dynamic:MD5", "a758071b3c2fe43c9a9b91db5077cd12")
 	testCreateForLargeFile(test, "dynamic:MD5", "668a4b622482b9fd30b1ad0eac4ab8f1")
@@ -66,13 +72,183 @@ func TestDynamicBLAKE2bGeneration(test *testing.T) {
 	testCreateForLargeFile(test, "dynamic:BLAKE2b", "137c5b1e9e8107c176de7fb7a38f7670bb31364fadb2b5b883737c8732c78327")
 }
 
+func TestDynamicFNV1aGeneration(test *testing.T) {
+	testCreateForSmallFile(test, "dynamic:FNV1a", "7ab6c028b6a257d2")
+	testCreateForLargeFile(test, "dynamic:FNV1a", "5393e117aa0257d2")
+}
+
+func TestSparseSHA256Generation(test *testing.T) {
+	testCreateForSmallFile(test, "sparse:SHA256:1", "cdf701ac9e4258a8efec453930c73d698d12d7e83c38a049a1f1a64375fbf776")
+	testCreateForLargeFile(test, "sparse:SHA256:1", "d038973aa8a284e573a89d5a0953d0c90a03842f0542a72214fae4258fea1806")
+}
+
+func TestSparseValidation(test *testing.T) {
+	for _, algorithm := range []string{"sparse:SHA256", "sparse:BLAKE2b:64", "sparse:FNV1a:1"} {
+		if err := ValidateFileAlgorithm(algorithm); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	for _, algorithm := range []string{"sparse:", "sparse:CRC32", "sparse:SHA256:0", "sparse:SHA256:x", "sparse:SHA256:1:2"} {
+		if err := ValidateFileAlgorithm(algorithm); err == nil {
+			test.Fatalf("Expected '%v' to be rejected.", algorithm)
+		}
+	}
+}
+
+func TestIsPartial(test *testing.T) {
+	if !IsPartial("dynamic:SHA256", 6*1024*1024) || IsPartial("dynamic:SHA256", 2*1024*1024) {
+		test.Fatal("Expected dynamic fingerprints to be partial only for large files.")
+	}
+
+	if !IsPartial("sparse:SHA256:1", 3*1024*1024) || IsPartial("sparse:SHA256:1", 2*1024*1024) {
+		test.Fatal("Expected sparse fingerprints to be partial only for files larger than both ends.")
+	}
+
+	if IsPartial("SHA256", 6*1024*1024) {
+		test.Fatal("Expected regular fingerprints never to be partial.")
+	}
+}
+
+func TestCreateExact(test *testing.T) {
+	tempFilePath := filepath.Join(os.TempDir(), "tmsu-fingerprint")
+	file, err := os.Create(tempFilePath)
+	if err != nil {
+		test.Fatal(err.Error())
+	}
+	defer os.Remove(tempFilePath)
+
+	if _, err = file.WriteAt([]byte("!"), 6*1024*1024-1); err != nil {
+		test.Fatal(err.Error())
+	}
+
+	for _, algorithm := range []string{"dynamic:SHA256", "sparse:SHA256:1", "SHA256"} {
+		fingerprint, err := CreateExact(tempFilePath, algorithm)
+		if err != nil {
+			test.Fatal(err.Error())
+		}
+
+		if fingerprint != "a4bd6407e40326c126f10412e245e4491c511636dbeddc3d2b16b41700017bc9" {
+			test.Fatalf("Exact fingerprint for '%v' incorrect: was '%v'", algorithm, fingerprint)
+		}
+	}
+}
+
+func TestCreateHead(test *testing.T) {
+	tempPath, err := ioutil.TempDir("", "tmsu-fingerprint")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(tempPath)
+
+	head := string(make([]byte, HeadSize))
+	writeFile(test, filepath.Join(tempPath, "a"), head+"apple")
+	writeFile(test, filepath.Join(tempPath, "b"), head+"pears")
+	writeFile(test, filepath.Join(tempPath, "c"), "apple")
+
+	fingerprints := make(map[string]Fingerprint, 3)
+	for _, name := range []string{"a", "b", "c"} {
+		fingerprint, err := CreateHead(filepath.Join(tempPath, name), "dynamic:SHA256")
+		if err != nil {
+			test.Fatal(err)
+		}
+		fingerprints[name] = fingerprint
+	}
+
+	if fingerprints["a"] == Empty || fingerprints["a"] != fingerprints["b"] {
+		test.Fatalf("Expected files with the same start to have the same head fingerprint: '%v' and '%v'.", fingerprints["a"], fingerprints["b"])
+	}
+
+	if fingerprints["a"] == fingerprints["c"] {
+		test.Fatal("Expected files with different starts to have different head fingerprints.")
+	}
+}
+
 func TestNoneGeneration(test *testing.T) {
 	testCreateForSmallFile(test, "none", "")
 	testCreateForLargeFile(test, "none", "")
 }
 
+func TestFileAlgorithms(test *testing.T) {
+	for _, algorithm := range FileAlgorithms {
+		if err := ValidateFileAlgorithm(algorithm); err != nil {
+			test.Fatal(err)
+		}
+
+		if algorithm == "command" {
+			// requires the command itself: see TestCommandGeneration
+			continue
+		}
+
+		if _, err := Create("fingerprinter.go", algorithm, "none", "none"); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := ValidateFileAlgorithm("CRC32"); err == nil {
+		test.Fatal("Expected 'CRC32' to be rejected.")
+	}
+}
+
+func TestContentsGeneration(test *testing.T) {
+	tempPath, err := ioutil.TempDir("", "tmsu-fingerprint")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(tempPath)
+
+	for _, dir := range []string{"a", "b", "c"} {
+		writeFile(test, filepath.Join(tempPath, dir, "sub", "file"), "hello")
+		writeFile(test, filepath.Join(tempPath, dir, "other"), "world")
+	}
+	writeFile(test, filepath.Join(tempPath, "c", "sub", "another"), "")
+
+	fingerprints := make(map[string]Fingerprint, 3)
+	for _, dir := range []string{"a", "b", "c"} {
+		fingerprint, err := Create(filepath.Join(tempPath, dir), "SHA256", "contents", "none")
+		if err != nil {
+			test.Fatal(err)
+		}
+		fingerprints[dir] = fingerprint
+	}
+
+	if fingerprints["a"] == Empty || fingerprints["a"] != fingerprints["b"] {
+		test.Fatalf("Expected directories with identical trees to have the same fingerprint: '%v' and '%v'.", fingerprints["a"], fingerprints["b"])
+	}
+
+	if fingerprints["a"] == fingerprints["c"] {
+		test.Fatal("Expected directories with different trees to have different fingerprints.")
+	}
+}
+
+func TestDirectoryAlgorithms(test *testing.T) {
+	for _, algorithm := range DirectoryAlgorithms {
+		if err := ValidateDirectoryAlgorithm(algorithm); err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := Create(".", "SHA256", algorithm, "none"); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := ValidateDirectoryAlgorithm("sumNames"); err == nil {
+		test.Fatal("Expected 'sumNames' to be rejected.")
+	}
+}
+
 // unexported
 
+func writeFile(test *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		test.Fatal(err)
+	}
+}
+
 func testCreateForSmallFile(test *testing.T, algorithm string, expectedFingerprint Fingerprint) {
 	testCreateForFile(test, algorithm, 2*1024*1024, expectedFingerprint)
 }
@@ -103,3 +279,31 @@ func testCreateForFile(test *testing.T, algorithm string, size uint, expectedFin
 		test.Fatalf("Fingerprint incorrect: expected '%v' but was '%v'", expectedFingerprint, fingerprint)
 	}
 }
+
+func TestCommandGeneration(test *testing.T) {
+	tempFilePath := filepath.Join(os.TempDir(), "tmsu-fingerprint")
+	writeFile(test, tempFilePath, "apple\n")
+	defer os.Remove(tempFilePath)
+
+	for algorithm, expectedFingerprint := range map[string]Fingerprint{
+		"command:head -c 3 %path": "head:app",
+		"command:cat":             "cat:apple",
+	} {
+		fingerprint, err := Create(tempFilePath, algorithm, "none", "none")
+		if err != nil {
+			test.Fatal(err.Error())
+		}
+
+		if fingerprint != expectedFingerprint {
+			test.Fatalf("Fingerprint for '%v' incorrect: expected '%v' but was '%v'", algorithm, expectedFingerprint, fingerprint)
+		}
+	}
+
+	if _, err := Create(tempFilePath, "command", "none", "none"); err == nil {
+		test.Fatal("Expected the 'command' algorithm without a command to be rejected.")
+	}
+
+	if _, err := Create(tempFilePath, "command:false", "none", "none"); err == nil {
+		test.Fatal("Expected a failing fingerprint command to be rejected.")
+	}
+}
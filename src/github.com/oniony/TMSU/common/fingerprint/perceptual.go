@@ -0,0 +1,142 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"strconv"
+)
+
+// The number of bits in a perceptual hash and so the greatest distance between
+// two of them.
+const PerceptualHashBits = 64
+
+// Creates a perceptual hash of the image at the path, such that visually
+// similar images, even if of different encodings or resolutions, have hashes
+// that differ in few bits. The empty fingerprint is returned for files that
+// are not images of a supported format: JPEG, PNG or GIF.
+func CreatePerceptual(path string) (Fingerprint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(bufio.NewReader(file))
+	if err == image.ErrFormat {
+		return Empty, nil
+	}
+	if err != nil {
+		return Empty, fmt.Errorf("could not decode image: %w", err)
+	}
+
+	return Fingerprint(fmt.Sprintf("%016x", differenceHash(img))), nil
+}
+
+// The number of bits in which two perceptual hashes differ.
+func PerceptualDistance(a, b Fingerprint) int {
+	x, err := strconv.ParseUint(string(a), 16, 64)
+	if err != nil {
+		return PerceptualHashBits + 1
+	}
+
+	y, err := strconv.ParseUint(string(b), 16, 64)
+	if err != nil {
+		return PerceptualHashBits + 1
+	}
+
+	return bits.OnesCount64(x ^ y)
+}
+
+// unexported
+
+const hashWidth, hashHeight = 9, 8
+
+// the number of pixels sampled along each side of the area averaged for each
+// pixel of the reduced image, so that large images are hashed quickly
+const maximumSamples = 32
+
+// reduces the image to 9x8 grey pixels and records, for each, whether it is
+// brighter than its neighbour to the right
+func differenceHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+
+	var grey [hashHeight][hashWidth]float64
+	for row := 0; row < hashHeight; row++ {
+		top, bottom := span(bounds.Min.Y, bounds.Dy(), row, hashHeight)
+
+		for column := 0; column < hashWidth; column++ {
+			left, right := span(bounds.Min.X, bounds.Dx(), column, hashWidth)
+
+			grey[row][column] = averageLuminance(img, left, top, right, bottom)
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < hashHeight; row++ {
+		for column := 0; column < hashWidth-1; column++ {
+			hash <<= 1
+			if grey[row][column] > grey[row][column+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// the range of source pixels corresponding to one of the pixels of the reduced image
+func span(start, length, index, count int) (int, int) {
+	from := start + index*length/count
+	to := start + (index+1)*length/count
+	if to <= from {
+		to = from + 1
+	}
+
+	return from, to
+}
+
+func averageLuminance(img image.Image, left, top, right, bottom int) float64 {
+	xStep := stride(right - left)
+	yStep := stride(bottom - top)
+
+	total := 0.0
+	count := 0
+	for y := top; y < bottom; y += yStep {
+		for x := left; x < right; x += xStep {
+			r, g, b, _ := img.At(x, y).RGBA()
+			total += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count++
+		}
+	}
+
+	return total / float64(count)
+}
+
+func stride(length int) int {
+	if length <= maximumSamples {
+		return 1
+	}
+
+	return length / maximumSamples
+}
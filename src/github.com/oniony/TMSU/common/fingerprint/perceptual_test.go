@@ -0,0 +1,121 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPerceptualHashOfSimilarImages(test *testing.T) {
+	tempPath, err := ioutil.TempDir("", "tmsu-perceptual")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(tempPath)
+
+	originalPath := filepath.Join(tempPath, "original.png")
+	writePng(test, originalPath, pattern(96, 64, math.Sin, math.Cos))
+
+	smallerPath := filepath.Join(tempPath, "copy.jpg")
+	writeJpeg(test, smallerPath, pattern(48, 32, math.Sin, math.Cos))
+
+	otherPath := filepath.Join(tempPath, "other.png")
+	writePng(test, otherPath, pattern(96, 64, math.Cos, math.Sin))
+
+	original := createPerceptual(test, originalPath)
+	smaller := createPerceptual(test, smallerPath)
+	other := createPerceptual(test, otherPath)
+
+	if distance := PerceptualDistance(original, smaller); distance > 4 {
+		test.Fatalf("Expected the re-encoded, smaller copy to be similar: hashes '%v' and '%v' differ in %v bits.", original, smaller, distance)
+	}
+
+	if distance := PerceptualDistance(original, other); distance <= 10 {
+		test.Fatalf("Expected the different image to be dissimilar: hashes '%v' and '%v' differ in only %v bits.", original, other, distance)
+	}
+}
+
+func TestPerceptualHashOfNonImage(test *testing.T) {
+	hash := createPerceptual(test, "perceptual.go")
+	if hash != Empty {
+		test.Fatalf("Expected no perceptual hash for a file that is not an image but was '%v'.", hash)
+	}
+}
+
+func TestPerceptualDistance(test *testing.T) {
+	if distance := PerceptualDistance("00000000000000ff", "000000000000000f"); distance != 4 {
+		test.Fatalf("Expected a distance of 4 but was %v.", distance)
+	}
+
+	if distance := PerceptualDistance("", "000000000000000f"); distance <= PerceptualHashBits {
+		test.Fatalf("Expected an invalid hash to be beyond any threshold but was %v.", distance)
+	}
+}
+
+// unexported
+
+func pattern(width, height int, horizontal, vertical func(float64) float64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := 128 + 100*horizontal(6*float64(x)/float64(width))*vertical(4*float64(y)/float64(height))
+			img.SetGray(x, y, color.Gray{uint8(value)})
+		}
+	}
+
+	return img
+}
+
+func writePng(test *testing.T, path string, img image.Image) {
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func writeJpeg(test *testing.T, path string, img image.Image) {
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 50}); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func createPerceptual(test *testing.T, path string) Fingerprint {
+	hash, err := CreatePerceptual(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return hash
+}
@@ -0,0 +1,159 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"runtime"
+	"sync"
+)
+
+// The number of fingerprints calculated concurrently unless otherwise specified.
+var DefaultJobs = runtime.NumCPU()
+
+// Calculates fingerprints with the configured algorithms, hashing several files
+// concurrently where the fingerprints of many files are wanted.
+type Pool struct {
+	FileAlgorithm      string
+	DirectoryAlgorithm string
+	SymlinkAlgorithm   string
+	Jobs               int
+	prefetched         map[string]result
+}
+
+func NewPool(fileAlgorithm, directoryAlgorithm, symlinkAlgorithm string, jobs int) *Pool {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	return &Pool{fileAlgorithm, directoryAlgorithm, symlinkAlgorithm, jobs, make(map[string]result)}
+}
+
+// Creates the fingerprint of the path, using the fingerprint calculated by an
+// earlier Prefetch where there is one.
+func (pool *Pool) Create(path string) (Fingerprint, error) {
+	if result, ok := pool.prefetched[path]; ok {
+		delete(pool.prefetched, path)
+		return result.fingerprint, result.err
+	}
+
+	return Create(path, pool.FileAlgorithm, pool.DirectoryAlgorithm, pool.SymlinkAlgorithm)
+}
+
+// Calculates the fingerprints of the paths concurrently, ahead of their
+// retrieval with Create.
+func (pool *Pool) Prefetch(paths []string) {
+	if len(paths) < 2 || pool.Jobs < 2 {
+		return
+	}
+
+	pool.CreateEach(paths, func(index int, fingerprint Fingerprint, err error) error {
+		pool.prefetched[paths[index]] = result{fingerprint, err}
+		return nil
+	})
+}
+
+// Calculates the fingerprints of the paths concurrently, calling the action
+// with each in the order of the paths. The action is called upon the calling
+// goroutine so need not be safe for concurrent use. If it returns an error then
+// no further fingerprints are calculated and the error is returned.
+func (pool *Pool) CreateEach(paths []string, action func(index int, fingerprint Fingerprint, err error) error) error {
+	return pool.each(paths, func(path string) (Fingerprint, error) {
+		return Create(path, pool.FileAlgorithm, pool.DirectoryAlgorithm, pool.SymlinkAlgorithm)
+	}, action)
+}
+
+// Calculates the fingerprints of the entire contents of the files concurrently,
+// as per CreateExact, calling the action with each in the order of the paths.
+func (pool *Pool) CreateExactEach(paths []string, action func(index int, fingerprint Fingerprint, err error) error) error {
+	return pool.each(paths, func(path string) (Fingerprint, error) {
+		return CreateExact(path, pool.FileAlgorithm)
+	}, action)
+}
+
+// Calculates the fingerprints of the first HeadSize bytes of the files
+// concurrently, as per CreateHead, calling the action with each in the order of
+// the paths.
+func (pool *Pool) CreateHeadEach(paths []string, action func(index int, fingerprint Fingerprint, err error) error) error {
+	return pool.each(paths, func(path string) (Fingerprint, error) {
+		return CreateHead(path, pool.FileAlgorithm)
+	}, action)
+}
+
+// Calculates the perceptual hashes of the images concurrently, as per
+// CreatePerceptual, calling the action with each in the order of the paths.
+func (pool *Pool) CreatePerceptualEach(paths []string, action func(index int, fingerprint Fingerprint, err error) error) error {
+	return pool.each(paths, CreatePerceptual, action)
+}
+
+// unexported
+
+type result struct {
+	fingerprint Fingerprint
+	err         error
+}
+
+func (pool *Pool) each(paths []string, create func(path string) (Fingerprint, error), action func(index int, fingerprint Fingerprint, err error) error) error {
+	results := make([]result, len(paths))
+	ready := make([]chan struct{}, len(paths))
+	for index := range ready {
+		ready[index] = make(chan struct{})
+	}
+
+	indices := make(chan int)
+	stop := make(chan struct{})
+	var waitGroup sync.WaitGroup
+
+	for worker := 0; worker < pool.Jobs && worker < len(paths); worker++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for index := range indices {
+				fingerprint, err := create(paths[index])
+				results[index] = result{fingerprint, err}
+				close(ready[index])
+			}
+		}()
+	}
+
+	// the paths are handed out in order so that the action is rarely kept waiting
+	go func() {
+		defer close(indices)
+
+		for index := range paths {
+			select {
+			case indices <- index:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var err error
+	for index := range paths {
+		<-ready[index]
+
+		if err = action(index, results[index].fingerprint, results[index].err); err != nil {
+			break
+		}
+	}
+
+	close(stop)
+	waitGroup.Wait()
+
+	return err
+}
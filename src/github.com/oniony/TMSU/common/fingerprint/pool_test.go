@@ -0,0 +1,128 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCreateEachInOrder(test *testing.T) {
+	dir, paths := createTestFiles(test, 20)
+	defer os.RemoveAll(dir)
+
+	pool := NewPool("SHA256", "none", "none", 4)
+
+	count := 0
+	err := pool.CreateEach(paths, func(index int, fingerprint Fingerprint, err error) error {
+		if err != nil {
+			test.Fatal(err)
+		}
+		if index != count {
+			test.Fatalf("Expected fingerprint %v but was %v.", count, index)
+		}
+
+		expected, err := Create(paths[index], "SHA256", "none", "none")
+		if err != nil {
+			test.Fatal(err)
+		}
+		if fingerprint != expected {
+			test.Fatalf("Expected fingerprint '%v' for '%v' but was '%v'.", expected, paths[index], fingerprint)
+		}
+
+		count++
+		return nil
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != len(paths) {
+		test.Fatalf("Expected %v fingerprints but were %v.", len(paths), count)
+	}
+}
+
+func TestCreateEachStopsOnError(test *testing.T) {
+	dir, paths := createTestFiles(test, 20)
+	defer os.RemoveAll(dir)
+
+	pool := NewPool("SHA256", "none", "none", 4)
+
+	stop := errors.New("stop")
+	count := 0
+	err := pool.CreateEach(paths, func(index int, fingerprint Fingerprint, err error) error {
+		count++
+		if index == 2 {
+			return stop
+		}
+
+		return nil
+	})
+	if err != stop {
+		test.Fatalf("Expected error '%v' but was '%v'.", stop, err)
+	}
+	if count != 3 {
+		test.Fatalf("Expected 3 fingerprints but were %v.", count)
+	}
+}
+
+func TestPrefetch(test *testing.T) {
+	dir, paths := createTestFiles(test, 3)
+	defer os.RemoveAll(dir)
+
+	pool := NewPool("SHA256", "none", "none", 2)
+	pool.Prefetch(paths)
+
+	expected, err := pool.Create(paths[1])
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(paths[1], []byte("changed"), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	// the prefetched fingerprint is used once only
+	actual, err := pool.Create(paths[1])
+	if err != nil {
+		test.Fatal(err)
+	}
+	if actual == expected {
+		test.Fatal("Expected fingerprint to be recalculated.")
+	}
+}
+
+// unexported
+
+func createTestFiles(test *testing.T, count int) (string, []string) {
+	dir, err := ioutil.TempDir("", "tmsu-fingerprint-pool")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	paths := make([]string, count)
+	for index := range paths {
+		paths[index] = filepath.Join(dir, "file"+strconv.Itoa(index))
+		if err := ioutil.WriteFile(paths[index], []byte(strconv.Itoa(index)), 0644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	return dir, paths
+}
@@ -0,0 +1,282 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// The ID3 fields of an audio file, keyed by field name.
+type Fields map[string]string
+
+// Reads the ID3 fields of the specified file. Files without ID3 tags have no
+// fields.
+func ReadFile(path string) (Fields, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Read(file, stat.Size())
+}
+
+// Reads the ID3v2 fields from the start of the data, falling back to an ID3v1
+// tag at the end.
+func Read(reader io.ReaderAt, size int64) (Fields, error) {
+	fields, err := readV2(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		return fields, nil
+	}
+
+	return readV1(reader, size)
+}
+
+// unexported
+
+var errInvalid = errors.New("invalid ID3 data")
+
+// the v2.3 and v2.4 text frames of interest
+var frameNames = map[string]string{
+	"TIT2": "Title",
+	"TPE1": "Artist",
+	"TALB": "Album",
+	"TYER": "Year",
+	"TDRC": "Year",
+	"TCON": "Genre",
+	"TRCK": "Track",
+}
+
+// the v2.2 equivalents, which have three character identifiers
+var shortFrameNames = map[string]string{
+	"TT2": "Title",
+	"TP1": "Artist",
+	"TAL": "Album",
+	"TYE": "Year",
+	"TCO": "Genre",
+	"TRK": "Track",
+}
+
+func readV2(reader io.ReaderAt) (Fields, error) {
+	header := make([]byte, 10)
+	if _, err := reader.ReadAt(header, 0); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return Fields{}, nil
+		}
+
+		return nil, err
+	}
+	if string(header[0:3]) != "ID3" {
+		return Fields{}, nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	tagSize := syncsafe(header[6:10])
+
+	if version < 2 || version > 4 {
+		return Fields{}, nil
+	}
+	if flags&0x80 != 0 {
+		// unsynchronised tags are rare and not supported
+		return Fields{}, nil
+	}
+
+	data := make([]byte, tagSize)
+	if _, err := reader.ReadAt(data, 10); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if flags&0x40 != 0 && version >= 3 {
+		// skip the extended header
+		if len(data) < 4 {
+			return nil, errInvalid
+		}
+
+		var extendedSize int
+		if version == 3 {
+			extendedSize = int(binary.BigEndian.Uint32(data)) + 4
+		} else {
+			extendedSize = syncsafe(data[0:4])
+		}
+		if extendedSize > len(data) {
+			return nil, errInvalid
+		}
+
+		data = data[extendedSize:]
+	}
+
+	idLength, headerLength := 4, 10
+	names := frameNames
+	if version == 2 {
+		idLength, headerLength = 3, 6
+		names = shortFrameNames
+	}
+
+	fields := Fields{}
+
+	for len(data) >= headerLength {
+		id := string(data[0:idLength])
+		if data[0] == 0 {
+			// reached the padding
+			break
+		}
+
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(data[4:8]))
+		case 4:
+			frameSize = syncsafe(data[4:8])
+		}
+
+		if frameSize < 0 || headerLength+frameSize > len(data) {
+			return nil, errInvalid
+		}
+
+		frame := data[headerLength : headerLength+frameSize]
+		data = data[headerLength+frameSize:]
+
+		name, ok := names[id]
+		if !ok || len(frame) == 0 {
+			continue
+		}
+		if _, exists := fields[name]; exists {
+			continue
+		}
+
+		if text := decodeText(frame[0], frame[1:]); text != "" {
+			fields[name] = text
+		}
+	}
+
+	return fields, nil
+}
+
+func readV1(reader io.ReaderAt, size int64) (Fields, error) {
+	if size < 128 {
+		return Fields{}, nil
+	}
+
+	tag := make([]byte, 128)
+	if _, err := reader.ReadAt(tag, size-128); err != nil {
+		return nil, err
+	}
+	if string(tag[0:3]) != "TAG" {
+		return Fields{}, nil
+	}
+
+	fields := Fields{}
+	for _, field := range []struct {
+		name       string
+		start, end int
+	}{
+		{"Title", 3, 33},
+		{"Artist", 33, 63},
+		{"Album", 63, 93},
+		{"Year", 93, 97},
+	} {
+		if text := latin1(trimNul(tag[field.start:field.end])); text != "" {
+			fields[field.name] = text
+		}
+	}
+
+	return fields, nil
+}
+
+// decodes a text frame, keeping only the first of any null-separated strings
+func decodeText(encoding byte, data []byte) string {
+	var text string
+
+	switch encoding {
+	case 0:
+		text = latin1(trimNul(data))
+	case 1, 2:
+		text = utf16Text(data, encoding == 2)
+	case 3:
+		text = string(trimNul(data))
+	}
+
+	return strings.TrimSpace(text)
+}
+
+func utf16Text(data []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+
+	if len(data) >= 2 {
+		switch {
+		case data[0] == 0xFF && data[1] == 0xFE:
+			order = binary.LittleEndian
+			data = data[2:]
+		case data[0] == 0xFE && data[1] == 0xFF:
+			order = binary.BigEndian
+			data = data[2:]
+		}
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for index := 0; index+1 < len(data); index += 2 {
+		unit := order.Uint16(data[index:])
+		if unit == 0 {
+			break
+		}
+
+		units = append(units, unit)
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for index, b := range data {
+		runes[index] = rune(b)
+	}
+
+	return strings.TrimSpace(string(runes))
+}
+
+func trimNul(data []byte) []byte {
+	if index := bytes.IndexByte(data, 0); index != -1 {
+		return data[:index]
+	}
+
+	return data
+}
+
+// decodes a 28-bit integer stored in four bytes of seven bits each
+func syncsafe(data []byte) int {
+	return int(data[0]&0x7F)<<21 | int(data[1]&0x7F)<<14 | int(data[2]&0x7F)<<7 | int(data[3]&0x7F)
+}
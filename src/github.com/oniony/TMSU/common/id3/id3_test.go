@@ -0,0 +1,96 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package id3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadV23(test *testing.T) {
+	tag := []byte{}
+	tag = append(tag, frame("TPE1", "\x03Boards of Canada")...)
+	tag = append(tag, frame("TALB", "\x01\xFF\xFEG\x00e\x00o\x00g\x00a\x00d\x00d\x00i\x00\x00\x00")...)
+	tag = append(tag, frame("TYER", "\x001998")...)
+	tag = append(tag, make([]byte, 16)...) // padding
+
+	data := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(tag))}, tag...)
+	data = append(data, "audio"...)
+
+	fields, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	assertField(test, fields, "Artist", "Boards of Canada")
+	assertField(test, fields, "Album", "Geogaddi")
+	assertField(test, fields, "Year", "1998")
+
+	if len(fields) != 3 {
+		test.Fatalf("expected 3 fields but got %v", fields)
+	}
+}
+
+func TestReadV1(test *testing.T) {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:], "Roygbiv")
+	copy(tag[33:], "Boards of Canada")
+	copy(tag[93:], "1998")
+
+	data := append([]byte("audio"), tag...)
+
+	fields, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	assertField(test, fields, "Title", "Roygbiv")
+	assertField(test, fields, "Artist", "Boards of Canada")
+	assertField(test, fields, "Year", "1998")
+
+	if len(fields) != 3 {
+		test.Fatalf("expected 3 fields but got %v", fields)
+	}
+}
+
+func TestReadOther(test *testing.T) {
+	data := []byte("fLaC and other content")
+
+	fields, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(fields) != 0 {
+		test.Fatalf("expected no fields but got %v", fields)
+	}
+}
+
+// unexported
+
+func frame(id, content string) []byte {
+	size := len(content)
+	header := []byte{id[0], id[1], id[2], id[3], byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size), 0, 0}
+
+	return append(header, content...)
+}
+
+func assertField(test *testing.T, fields Fields, name, expected string) {
+	if fields[name] != expected {
+		test.Fatalf("expected %v of '%v' but got '%v'", name, expected, fields[name])
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The name of the files listing the paths, within the directory containing
+// the file and beneath, that are not considered when walking directory trees.
+const FileName = ".tmsuignore"
+
+// A pattern from an ignore file, in gitignore syntax.
+type Pattern struct {
+	Text       string
+	expression *regexp.Regexp
+	negated    bool
+	dirOnly    bool
+}
+
+type Patterns []Pattern
+
+// Parses the patterns of an ignore file. Blank lines and lines beginning with
+// '#' are skipped, a leading '!' re-includes paths excluded by an earlier
+// pattern and a trailing '/' matches only directories. A pattern containing a
+// slash, other than a trailing one, is matched against the path relative to
+// the directory containing the file; otherwise against the name of a file at
+// any depth beneath it. '*' and '?' match any characters but a slash, and '**'
+// matches any number of directories.
+func Parse(reader io.Reader) (Patterns, error) {
+	patterns := make(Patterns, 0, 10)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := trimTrailingSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, *pattern)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+// Parses a single pattern in gitignore syntax.
+func ParsePattern(text string) (*Pattern, error) {
+	pattern := Pattern{Text: text}
+
+	if strings.HasPrefix(text, "!") {
+		pattern.negated = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, `\!`) || strings.HasPrefix(text, `\#`) {
+		text = text[1:]
+	}
+
+	if strings.HasSuffix(text, "/") {
+		pattern.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+
+	if text == "" {
+		return nil, fmt.Errorf("invalid ignore pattern '%v'", pattern.Text)
+	}
+
+	anchored := strings.Contains(text, "/")
+	text = strings.TrimPrefix(text, "/")
+
+	expression := "^"
+	if !anchored {
+		expression += "(?:.*/)?"
+	}
+
+	translated, err := translate(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore pattern '%v': %v", pattern.Text, err)
+	}
+	expression += translated + "$"
+
+	pattern.expression, err = regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore pattern '%v': %v", pattern.Text, err)
+	}
+
+	return &pattern, nil
+}
+
+// Whether the pattern matches the slash-separated path relative to the
+// directory containing the ignore file.
+func (pattern Pattern) Matches(relPath string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+
+	return pattern.expression.MatchString(relPath)
+}
+
+// Identifies the paths excluded by the ignore files in their ancestor
+// directories, loading each ignore file once.
+type Matcher struct {
+	patternsByDir map[string]Patterns
+	ignoredDirs   map[string]bool
+}
+
+func NewMatcher() *Matcher {
+	return &Matcher{make(map[string]Patterns), make(map[string]bool)}
+}
+
+// Whether the absolute path, or any of its parent directories, is excluded by
+// an ignore file. Where several patterns match the last one applies, with the
+// patterns of the files in deeper directories applying after those above.
+func (matcher *Matcher) Ignored(absPath string, isDir bool) bool {
+	absPath = filepath.Clean(absPath)
+
+	parentPath := filepath.Dir(absPath)
+	if parentPath == absPath {
+		return false
+	}
+
+	if isDir {
+		if ignored, ok := matcher.ignoredDirs[absPath]; ok {
+			return ignored
+		}
+	}
+
+	ignored := matcher.Ignored(parentPath, true)
+	if !ignored {
+		for _, dirPath := range ancestors(parentPath) {
+			relPath, err := filepath.Rel(dirPath, absPath)
+			if err != nil {
+				continue
+			}
+			relPath = filepath.ToSlash(relPath)
+
+			for _, pattern := range matcher.patterns(dirPath) {
+				if pattern.Matches(relPath, isDir) {
+					ignored = !pattern.negated
+				}
+			}
+		}
+	}
+
+	if isDir {
+		matcher.ignoredDirs[absPath] = ignored
+	}
+
+	return ignored
+}
+
+// unexported
+
+// the patterns of the ignore file within the directory, if any
+func (matcher *Matcher) patterns(dirPath string) Patterns {
+	if patterns, ok := matcher.patternsByDir[dirPath]; ok {
+		return patterns
+	}
+
+	patterns, err := readPatterns(filepath.Join(dirPath, FileName))
+	if err != nil {
+		log.Warn(err)
+	}
+
+	matcher.patternsByDir[dirPath] = patterns
+
+	return patterns
+}
+
+func readPatterns(path string) (Patterns, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%v: could not open ignore file: %v", path, err)
+	}
+	defer file.Close()
+
+	patterns, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return patterns, nil
+}
+
+// the directory and its ancestors, outermost first
+func ancestors(dirPath string) []string {
+	dirPaths := []string{dirPath}
+	for {
+		parentPath := filepath.Dir(dirPath)
+		if parentPath == dirPath {
+			break
+		}
+
+		dirPaths = append([]string{parentPath}, dirPaths...)
+		dirPath = parentPath
+	}
+
+	return dirPaths
+}
+
+// translates a glob into a regular expression, where '*' and '?' do not match
+// a slash and '**' matches across directories
+func translate(glob string) (string, error) {
+	var builder strings.Builder
+
+	for index := 0; index < len(glob); index++ {
+		char := glob[index]
+
+		switch char {
+		case '*':
+			if strings.HasPrefix(glob[index:], "**") {
+				atStart := index == 0 || glob[index-1] == '/'
+				rest := glob[index+2:]
+
+				switch {
+				case atStart && strings.HasPrefix(rest, "/"):
+					builder.WriteString("(?:.*/)?")
+					index += 2
+					continue
+				case atStart && rest == "":
+					builder.WriteString(".*")
+					index++
+					continue
+				}
+			}
+
+			builder.WriteString("[^/]*")
+		case '?':
+			builder.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[index+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			if end == 0 {
+				// a leading ']' is part of the class
+				next := strings.IndexByte(glob[index+2:], ']')
+				if next < 0 {
+					return "", fmt.Errorf("unterminated character class")
+				}
+				end = next + 1
+			}
+
+			class := glob[index+1 : index+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			builder.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			index += end + 1
+		case '\\':
+			if index+1 < len(glob) {
+				index++
+				char = glob[index]
+			}
+
+			builder.WriteString(regexp.QuoteMeta(string(char)))
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// removes trailing spaces unless escaped with a backslash
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+
+	if strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-2] + " "
+	}
+
+	return line
+}
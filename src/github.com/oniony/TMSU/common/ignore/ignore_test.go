@@ -0,0 +1,128 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatternMatches(test *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"*.tmp", "file.tmp", false, true},
+		{"*.tmp", "some/dir/file.tmp", false, true},
+		{"*.tmp", "file.tmp.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "build", false, true},
+		{"/build", "src/build", false, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/sub/notes.txt", false, false},
+		{"**/cache", "cache", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"logs/**", "logs/2019/app.log", false, true},
+		{"file?.txt", "file1.txt", false, true},
+		{"file[0-9].txt", "file5.txt", false, true},
+		{"file[!0-9].txt", "file5.txt", false, false},
+		{`\#notes`, "#notes", false, true},
+		{`\!important`, "!important", false, true},
+	}
+
+	for _, c := range cases {
+		pattern, err := ParsePattern(c.pattern)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if actual := pattern.Matches(c.path, c.isDir); actual != c.matches {
+			test.Errorf("Expected pattern '%v' matching '%v' to be %v but was %v.", c.pattern, c.path, c.matches, actual)
+		}
+	}
+}
+
+func TestParse(test *testing.T) {
+	patterns, err := Parse(strings.NewReader("# comment\n\n*.tmp  \n!keep.tmp\n"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(patterns) != 2 {
+		test.Fatalf("Expected 2 patterns but were %v.", len(patterns))
+	}
+	if patterns[0].Text != "*.tmp" {
+		test.Fatalf("Expected pattern '*.tmp' but was '%v'.", patterns[0].Text)
+	}
+	if !patterns[1].negated {
+		test.Fatal("Expected second pattern to be negated.")
+	}
+}
+
+func TestInvalidPattern(test *testing.T) {
+	if _, err := ParsePattern("file[0-9"); err == nil {
+		test.Fatal("Expected unterminated character class to be rejected.")
+	}
+}
+
+func TestMatcherIgnored(test *testing.T) {
+	root, err := ioutil.TempDir("", "tmsu-ignore")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFile(test, filepath.Join(root, FileName), "*.tmp\nbuild/\n")
+	writeFile(test, filepath.Join(root, "sub", FileName), "!keep.tmp\n")
+
+	cases := map[string]bool{
+		"file.txt":           false,
+		"file.tmp":           true,
+		"sub/file.tmp":       true,
+		"sub/keep.tmp":       false,
+		"keep.tmp":           true,
+		"build/output.txt":   true,
+		"sub/build/keep.tmp": true,
+	}
+
+	matcher := NewMatcher()
+	for path, expected := range cases {
+		if actual := matcher.Ignored(filepath.Join(root, path), false); actual != expected {
+			test.Errorf("Expected '%v' ignored to be %v but was %v.", path, expected, actual)
+		}
+	}
+}
+
+// unexported
+
+func writeFile(test *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		test.Fatal(err)
+	}
+}
@@ -17,6 +17,7 @@ package log
 
 import (
 	"fmt"
+	"github.com/oniony/TMSU/common/progress"
 	"io"
 	"os"
 	"time"
@@ -61,6 +62,8 @@ func Infof(verbosity uint, format string, values ...interface{}) {
 // unexported
 
 func log(dest io.Writer, values ...interface{}) {
+	progress.Clear()
+
 	if Verbosity > 1 {
 		fmt.Fprintf(dest, "%v: ", time.Now())
 	}
@@ -70,6 +73,8 @@ func log(dest io.Writer, values ...interface{}) {
 }
 
 func logf(dest io.Writer, format string, values ...interface{}) {
+	progress.Clear()
+
 	if Verbosity > 1 {
 		fmt.Printf("%v: ", time.Now())
 	}
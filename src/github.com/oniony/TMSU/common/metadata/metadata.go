@@ -0,0 +1,141 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"github.com/oniony/TMSU/common/exif"
+	"github.com/oniony/TMSU/common/id3"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A tag and value taken from the metadata of a file, e.g. camera=X100.
+type Field struct {
+	Tag   string
+	Value string
+}
+
+type Fields []Field
+
+// Extracts the metadata fields of a file.
+type Extractor func(path string) (Fields, error)
+
+// Registers an extractor for files of the specified MIME type, which may be a
+// pattern such as 'image/*'.
+func Register(mimeType string, extractor Extractor) {
+	extractors = append(extractors, registration{mimeType, extractor})
+}
+
+// Extracts the metadata of a file using the extractors registered for its
+// MIME type. Where several extractors provide the same tag, the value from the
+// earliest registered is used.
+func Extract(filePath, mimeType string) (Fields, error) {
+	fields := make(Fields, 0, 10)
+	if mimeType == "" {
+		return fields, nil
+	}
+
+	seen := make(map[string]bool)
+
+	for _, registration := range extractors {
+		if matched, _ := path.Match(registration.mimeType, mimeType); !matched {
+			continue
+		}
+
+		extracted, err := registration.extractor(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, field := range extracted {
+			field.Value = strings.TrimSpace(field.Value)
+			if field.Value == "" || seen[field.Tag] {
+				continue
+			}
+
+			seen[field.Tag] = true
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// unexported
+
+type registration struct {
+	mimeType  string
+	extractor Extractor
+}
+
+var extractors []registration
+
+func init() {
+	Register("image/jpeg", extractExif)
+	Register("image/tiff", extractExif)
+	Register("audio/mpeg", extractId3)
+}
+
+func extractExif(path string) (Fields, error) {
+	exifFields, err := exif.ReadFile(path)
+	if err != nil {
+		// not an image that can be examined
+		return nil, nil
+	}
+
+	date := exifFields["DateTimeOriginal"]
+	if date == "" {
+		date = exifFields["DateTime"]
+	}
+
+	return Fields{{"camera", exifFields["Model"]},
+		{"lens", exifFields["LensModel"]},
+		{"year", year(date)}}, nil
+}
+
+func extractId3(path string) (Fields, error) {
+	id3Fields, err := id3.ReadFile(path)
+	if err != nil {
+		// not a file that can be examined
+		return nil, nil
+	}
+
+	return Fields{{"artist", id3Fields["Artist"]},
+		{"album", id3Fields["Album"]},
+		{"year", year(id3Fields["Year"])},
+		{"genre", genre(id3Fields["Genre"])}}, nil
+}
+
+var yearPattern = regexp.MustCompile(`^\d{4}`)
+
+// the year from a date such as '2019:05:01 12:00:00' or '2019-05-01'
+func year(date string) string {
+	return yearPattern.FindString(strings.TrimSpace(date))
+}
+
+var genreReferencePattern = regexp.MustCompile(`^\((\d+)\)`)
+
+// the genre name without any numeric references to the ID3v1 genre list,
+// e.g. '(17)Rock'
+func genre(text string) string {
+	text = genreReferencePattern.ReplaceAllString(text, "")
+	if strings.Trim(text, "0123456789") == "" {
+		return ""
+	}
+
+	return text
+}
@@ -0,0 +1,86 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package metadata
+
+import (
+	"testing"
+)
+
+func TestExtractUsesMatchingExtractors(test *testing.T) {
+	defer restoreExtractors(extractors)
+
+	extractors = nil
+	Register("text/*", func(path string) (Fields, error) {
+		return Fields{{"language", " english "}, {"author", ""}}, nil
+	})
+	Register("text/plain", func(path string) (Fields, error) {
+		return Fields{{"language", "french"}, {"encoding", "utf-8"}}, nil
+	})
+	Register("image/*", func(path string) (Fields, error) {
+		return Fields{{"camera", "X100"}}, nil
+	})
+
+	fields, err := Extract("/some/file.txt", "text/plain")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := Fields{{"language", "english"}, {"encoding", "utf-8"}}
+	if len(fields) != len(expected) {
+		test.Fatalf("expected %v but got %v", expected, fields)
+	}
+	for index := range expected {
+		if fields[index] != expected[index] {
+			test.Fatalf("expected %v but got %v", expected, fields)
+		}
+	}
+}
+
+func TestExtractWithoutMimeType(test *testing.T) {
+	fields, err := Extract("/some/file", "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(fields) != 0 {
+		test.Fatalf("expected no fields but got %v", fields)
+	}
+}
+
+func TestYear(test *testing.T) {
+	assertEqual(test, "2019", year("2019:05:01 12:00:00"))
+	assertEqual(test, "1998", year("1998-02-11"))
+	assertEqual(test, "", year("May 2019"))
+}
+
+func TestGenre(test *testing.T) {
+	assertEqual(test, "Rock", genre("(17)Rock"))
+	assertEqual(test, "", genre("(17)"))
+	assertEqual(test, "", genre("17"))
+	assertEqual(test, "Electronic", genre("Electronic"))
+}
+
+// unexported
+
+func restoreExtractors(registrations []registration) {
+	extractors = registrations
+}
+
+func assertEqual(test *testing.T, expected, actual string) {
+	if actual != expected {
+		test.Fatalf("expected '%v' but got '%v'", expected, actual)
+	}
+}
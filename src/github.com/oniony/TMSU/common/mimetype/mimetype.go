@@ -0,0 +1,90 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mimetype
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Identifies the MIME type of a file by its extension or else its content.
+// An empty string is returned for directories and other non-regular files and
+// for files whose type cannot be determined.
+func Detect(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !stat.Mode().IsRegular() {
+		return "", nil
+	}
+
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		mediaType, _, err := mime.ParseMediaType(mimeType)
+		if err == nil {
+			return mediaType, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 16)
+	count, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:count]
+
+	for _, signature := range signatures {
+		end := signature.offset + len(signature.magic)
+		if end <= len(header) && bytes.Equal(header[signature.offset:end], []byte(signature.magic)) {
+			return signature.mimeType, nil
+		}
+	}
+
+	return "", nil
+}
+
+// unexported
+
+// content signatures of common types, used for files whose extension is not
+// recognised
+var signatures = []struct {
+	offset   int
+	magic    string
+	mimeType string
+}{
+	{0, "\xFF\xD8\xFF", "image/jpeg"},
+	{0, "\x89PNG\r\n\x1A\n", "image/png"},
+	{0, "GIF8", "image/gif"},
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+	{0, "%PDF-", "application/pdf"},
+	{0, "fLaC", "audio/flac"},
+	{0, "OggS", "audio/ogg"},
+	{0, "ID3", "audio/mpeg"},
+	{8, "WAVE", "audio/wav"},
+	{8, "WEBP", "image/webp"},
+	{4, "ftyp", "video/mp4"},
+	{0, "PK\x03\x04", "application/zip"},
+}
@@ -33,6 +33,12 @@ func IsRoot(path string) bool {
 	return filepath.Dir(path) == path
 }
 
+// The root of the volume holding the path: the separator or, on Windows, the
+// drive or share followed by the separator
+func VolumeRoot(path string) string {
+	return filepath.VolumeName(path) + string(filepath.Separator)
+}
+
 func Rel(path string) string {
 	workingDirectory, err := os.Getwd()
 	if err != nil {
@@ -109,6 +115,10 @@ func Dereference(path string) (string, error) {
 
 var octalEscapePattern = regexp.MustCompile(`\\[0-7]{3}`)
 
+func isDotFile(name string) bool {
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
 func trailingSeparator(path string) string {
 	if path[len(path)-1] == filepath.Separator {
 		return path
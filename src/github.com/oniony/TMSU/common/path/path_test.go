@@ -43,3 +43,21 @@ func TestRelTo(test *testing.T) {
 		}
 	}
 }
+
+func TestIsHidden(test *testing.T) {
+	paths := map[string]bool{
+		"/some/.hidden":  true,
+		".hidden":        true,
+		"/some/visible":  false,
+		"/some/.":        false,
+		"/some/..":       false,
+		"/some/.hidden/": true}
+
+	for path, expected := range paths {
+		actual := IsHidden(path)
+
+		if actual != expected {
+			test.Fatalf("Expected '%v' hidden to be %v but was %v", path, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package path
+
+import (
+	"path/filepath"
+	"runtime"
+)
+
+// Whether paths differing only by case identify different files
+var CaseSensitive = runtime.GOOS != "darwin"
+
+// Whether the file is hidden, i.e. its name begins with a dot
+func IsHidden(path string) bool {
+	return isDotFile(filepath.Base(path))
+}
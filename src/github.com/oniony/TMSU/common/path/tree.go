@@ -26,7 +26,7 @@ type Tree struct {
 }
 
 func NewTree() *Tree {
-	return &Tree{newNode("/", false, true)}
+	return &Tree{newNode("", false, true)}
 }
 
 // Adds a path to the tree
@@ -38,8 +38,8 @@ func (tree *Tree) Add(path string, isDir bool) {
 	for index, pathPart := range pathParts {
 		isReal := index == partCount-1
 
-		if pathPart == "" {
-			pathPart = "/"
+		if index == 0 {
+			pathPart = rootPart(pathPart)
 		}
 
 		node, found := currentNode.nodes[pathPart]
@@ -100,6 +100,16 @@ func (tree *Tree) Directories() *Tree {
 	return resultTree
 }
 
+// the leading part of an absolute path names its root: the separator or, on
+// Windows, the volume
+func rootPart(pathPart string) string {
+	if pathPart == "" || filepath.VolumeName(pathPart) == pathPart {
+		return pathPart + string(filepath.Separator)
+	}
+
+	return pathPart
+}
+
 type node struct {
 	name   string
 	nodes  map[string]*node
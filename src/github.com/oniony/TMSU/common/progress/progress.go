@@ -0,0 +1,184 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Whether progress is shown at all: progress is only ever shown upon a terminal.
+var Enabled = true
+
+// A live indicator, upon standard error, of the progress of a long operation.
+type Bar struct {
+	label   string
+	count   uint
+	total   uint // zero where unknown
+	started time.Time
+	drawn   time.Time
+	visible bool
+	writer  io.Writer
+}
+
+// Starts showing the progress of an operation upon the expected total number
+// of items, which may be zero if not known. Nothing is shown until the
+// operation has run for a moment, so quick operations remain silent.
+func Start(label string, total uint) *Bar {
+	bar := &Bar{label: label, total: total, started: time.Now()}
+
+	if Enabled && stderrIsTerminal() {
+		bar.writer = os.Stderr
+		current = bar
+	}
+
+	return bar
+}
+
+// Records the completion of a number of items. As with the other methods, a
+// nil bar may be used for an operation whose progress is not shown.
+func (bar *Bar) Add(count uint) {
+	if bar == nil {
+		return
+	}
+
+	bar.count += count
+	bar.draw(false)
+}
+
+// Adds to the total number of items expected, for operations that discover
+// the items as they run.
+func (bar *Bar) Expect(count uint) {
+	if bar == nil {
+		return
+	}
+
+	bar.total += count
+	bar.draw(false)
+}
+
+// Removes the progress indicator once the operation is complete.
+func (bar *Bar) Finish() {
+	if bar == nil {
+		return
+	}
+
+	bar.clear()
+	bar.writer = nil
+
+	if current == bar {
+		current = nil
+	}
+}
+
+// Clears any progress indicator shown so that other output can be written.
+// The indicator is redrawn as progress is next made.
+func Clear() {
+	if current != nil {
+		current.clear()
+	}
+}
+
+// Writes to standard output, first clearing any progress indicator.
+func Printf(format string, values ...interface{}) {
+	Clear()
+	fmt.Printf(format, values...)
+}
+
+// unexported
+
+// the progress indicator shown, if any
+var current *Bar
+
+// the delay before the progress of an operation is first shown
+const startDelay = 500 * time.Millisecond
+
+// the minimum interval between updates of the indicator
+const drawInterval = 100 * time.Millisecond
+
+// the width of the bar itself
+const barWidth = 30
+
+func (bar *Bar) draw(force bool) {
+	if bar.writer == nil {
+		return
+	}
+
+	now := time.Now()
+	if !force && (now.Sub(bar.started) < startDelay || now.Sub(bar.drawn) < drawInterval) {
+		return
+	}
+
+	bar.drawn = now
+	bar.visible = true
+
+	fmt.Fprintf(bar.writer, "\r\x1b[K%v", bar.describe(now.Sub(bar.started)))
+}
+
+func (bar *Bar) clear() {
+	if bar.writer == nil || !bar.visible {
+		return
+	}
+
+	fmt.Fprint(bar.writer, "\r\x1b[K")
+	bar.visible = false
+}
+
+// the text of the indicator after the elapsed duration
+func (bar *Bar) describe(elapsed time.Duration) string {
+	if bar.total == 0 {
+		return fmt.Sprintf("%v: %v items", bar.label, bar.count)
+	}
+
+	count := bar.count
+	if count > bar.total {
+		count = bar.total
+	}
+
+	filled := int(uint64(count) * barWidth / uint64(bar.total))
+	percent := uint64(count) * 100 / uint64(bar.total)
+	text := fmt.Sprintf("%v: [%v%v] %3v%% %v/%v", bar.label, strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), percent, count, bar.total)
+
+	if count > 0 && count < bar.total {
+		remaining := time.Duration(float64(elapsed) * float64(bar.total-count) / float64(count))
+		text += " ETA " + formatDuration(remaining)
+	}
+
+	return text
+}
+
+// formats the duration as minutes and seconds, or hours, minutes and seconds
+func formatDuration(duration time.Duration) string {
+	seconds := int64(duration.Round(time.Second) / time.Second)
+
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func stderrIsTerminal() bool {
+	stat, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
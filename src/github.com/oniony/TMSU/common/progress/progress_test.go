@@ -0,0 +1,66 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package progress
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribeWithTotal(test *testing.T) {
+	bar := Bar{label: "tagging", count: 25, total: 100}
+
+	actual := bar.describe(10 * time.Second)
+	expected := "tagging: [#######-----------------------]  25% 25/100 ETA 0:30"
+	if actual != expected {
+		test.Fatalf("Expected '%v' but was '%v'.", expected, actual)
+	}
+}
+
+func TestDescribeWithoutTotal(test *testing.T) {
+	bar := Bar{label: "tagging", count: 42}
+
+	actual := bar.describe(time.Second)
+	expected := "tagging: 42 items"
+	if actual != expected {
+		test.Fatalf("Expected '%v' but was '%v'.", expected, actual)
+	}
+}
+
+func TestFormatDuration(test *testing.T) {
+	durations := map[time.Duration]string{
+		0:                "0:00",
+		59 * time.Second: "0:59",
+		61 * time.Second: "1:01",
+		time.Hour + 2*time.Minute + 3*time.Second: "1:02:03",
+	}
+
+	for duration, expected := range durations {
+		if actual := formatDuration(duration); actual != expected {
+			test.Errorf("Expected '%v' for %v but was '%v'.", expected, duration, actual)
+		}
+	}
+}
+
+func TestStartWithoutTerminal(test *testing.T) {
+	bar := Start("tagging", 10)
+	bar.Add(1)
+	bar.Finish()
+
+	if bar.visible {
+		test.Fatal("Expected progress not to be shown.")
+	}
+}
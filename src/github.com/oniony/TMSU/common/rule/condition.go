@@ -0,0 +1,148 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rule
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/exif"
+	"github.com/oniony/TMSU/common/mimetype"
+	"os"
+	_path "path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Identifies the files a rule applies to.
+type Condition interface {
+	Matches(path string) (bool, error)
+}
+
+// Parses a condition of the form KIND:PATTERN, where KIND is one of 'glob',
+// 'regex', 'mime' or 'exif'.
+func ParseCondition(text string) (Condition, error) {
+	parts := strings.SplitN(text, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid condition '%v': expected KIND:PATTERN", text)
+	}
+
+	kind, pattern := parts[0], parts[1]
+
+	switch kind {
+	case "glob":
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob '%v': %v", pattern, err)
+		}
+
+		return globCondition{pattern}, nil
+	case "regex":
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%v': %v", pattern, err)
+		}
+
+		return regexCondition{expression}, nil
+	case "mime":
+		if _, err := _path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid MIME type '%v': %v", pattern, err)
+		}
+
+		return mimeCondition{pattern}, nil
+	case "exif":
+		fieldParts := strings.SplitN(pattern, "=", 2)
+		if len(fieldParts) != 2 || fieldParts[0] == "" {
+			return nil, fmt.Errorf("invalid EXIF condition '%v': expected FIELD=VALUE", pattern)
+		}
+		if _, err := filepath.Match(fieldParts[1], ""); err != nil {
+			return nil, fmt.Errorf("invalid EXIF value '%v': %v", fieldParts[1], err)
+		}
+
+		return exifCondition{fieldParts[0], fieldParts[1]}, nil
+	}
+
+	return nil, fmt.Errorf("invalid condition kind '%v': expected glob, regex, mime or exif", kind)
+}
+
+// unexported
+
+// matches the file name or, where the pattern contains a separator, the
+// absolute path
+type globCondition struct {
+	pattern string
+}
+
+func (condition globCondition) Matches(path string) (bool, error) {
+	if strings.ContainsRune(condition.pattern, filepath.Separator) {
+		return filepath.Match(condition.pattern, path)
+	}
+
+	return filepath.Match(condition.pattern, filepath.Base(path))
+}
+
+// matches anywhere within the absolute path
+type regexCondition struct {
+	expression *regexp.Regexp
+}
+
+func (condition regexCondition) Matches(path string) (bool, error) {
+	return condition.expression.MatchString(path), nil
+}
+
+type mimeCondition struct {
+	pattern string
+}
+
+func (condition mimeCondition) Matches(path string) (bool, error) {
+	if !isRegular(path) {
+		return false, nil
+	}
+
+	mimeType, err := mimetype.Detect(path)
+	if err != nil || mimeType == "" {
+		return false, err
+	}
+
+	return _path.Match(condition.pattern, mimeType)
+}
+
+type exifCondition struct {
+	field   string
+	pattern string
+}
+
+func (condition exifCondition) Matches(path string) (bool, error) {
+	if !isRegular(path) {
+		return false, nil
+	}
+
+	fields, err := exif.ReadFile(path)
+	if err != nil {
+		// not an image that can be examined
+		return false, nil
+	}
+
+	value, ok := fields[condition.field]
+	if !ok {
+		return false, nil
+	}
+
+	return filepath.Match(condition.pattern, value)
+}
+
+func isRegular(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode().IsRegular()
+}
@@ -0,0 +1,81 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobConditionMatchesName(test *testing.T) {
+	assertMatches(test, "glob:*.flac", "/music/album/track.flac", true)
+	assertMatches(test, "glob:*.flac", "/music/album/track.mp3", false)
+}
+
+func TestGlobConditionMatchesPath(test *testing.T) {
+	assertMatches(test, "glob:/music/*/*.flac", "/music/album/track.flac", true)
+	assertMatches(test, "glob:/music/*.flac", "/music/album/track.flac", false)
+}
+
+func TestRegexCondition(test *testing.T) {
+	assertMatches(test, "regex:/album/.*\\.(flac|mp3)$", "/music/album/track.mp3", true)
+	assertMatches(test, "regex:^/photos/", "/music/album/track.mp3", false)
+}
+
+func TestMimeCondition(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu-rule")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "track")
+	if err := ioutil.WriteFile(path, []byte("fLaC\x00\x00\x00\x22"), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	assertMatches(test, "mime:audio/*", path, true)
+	assertMatches(test, "mime:audio/flac", path, true)
+	assertMatches(test, "mime:image/*", path, false)
+	assertMatches(test, "mime:audio/*", dir, false)
+}
+
+func TestInvalidConditions(test *testing.T) {
+	for _, text := range []string{"*.flac", "glob:", "glob:[", "regex:(", "exif:Make", "colour:red"} {
+		if _, err := ParseCondition(text); err == nil {
+			test.Fatalf("expected condition '%v' to be rejected", text)
+		}
+	}
+}
+
+// unexported
+
+func assertMatches(test *testing.T, text, path string, expected bool) {
+	condition, err := ParseCondition(text)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	matches, err := condition.Matches(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if matches != expected {
+		test.Fatalf("expected condition '%v' matching '%v' to be %v", text, path, expected)
+	}
+}
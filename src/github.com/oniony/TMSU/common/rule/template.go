@@ -0,0 +1,160 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rule
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A template that extracts tags from the directory names and file name of a
+// path, such as 'Photos/{year}/{event}/*'.
+//
+// Within each component of the template, a {NAME} placeholder captures the
+// value of the tag NAME and an empty {} placeholder captures the name of a tag,
+// '*' matches any text, '?' matches any one character and a component of '**'
+// matches any number of directories. A template beginning with a slash is
+// matched against the whole of the absolute path, otherwise against its final
+// components.
+type PathTemplate struct {
+	text       string
+	expression *regexp.Regexp
+	tagNames   []string
+}
+
+// A tag extracted from a path by a template, with an empty value name where
+// the template captured the tag name itself.
+type PathTag struct {
+	TagName   string
+	ValueName string
+}
+
+func ParsePathTemplate(text string) (*PathTemplate, error) {
+	if strings.Trim(text, "/") == "" {
+		return nil, fmt.Errorf("path template must not be empty")
+	}
+
+	pattern := "(?:^|/)"
+	if strings.HasPrefix(text, "/") {
+		pattern = "^/"
+	}
+
+	tagNames := make([]string, 0, 5)
+	components := strings.Split(strings.Trim(text, "/"), "/")
+	for index, component := range components {
+		if component == "**" {
+			pattern += "(?:[^/]+/)*"
+			continue
+		}
+
+		componentPattern, names, err := parseTemplateComponent(component)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path template '%v': %w", text, err)
+		}
+
+		pattern += componentPattern
+		if index < len(components)-1 {
+			pattern += "/"
+		}
+		tagNames = append(tagNames, names...)
+	}
+
+	if components[len(components)-1] == "**" {
+		// a trailing '**' matches everything beneath the directory
+		pattern = strings.TrimSuffix(pattern, "(?:[^/]+/)*") + "(?:[^/]+/)*[^/]+"
+	}
+
+	expression, err := regexp.Compile(pattern + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template '%v': %w", text, err)
+	}
+
+	return &PathTemplate{text, expression, tagNames}, nil
+}
+
+func (template PathTemplate) String() string {
+	return template.text
+}
+
+// The tags extracted from the path or false if the path does not match the
+// template.
+func (template PathTemplate) Extract(path string) ([]PathTag, bool) {
+	matches := template.expression.FindStringSubmatch(filepath.ToSlash(path))
+	if matches == nil {
+		return nil, false
+	}
+
+	pathTags := make([]PathTag, len(template.tagNames))
+	for index, tagName := range template.tagNames {
+		if tagName == "" {
+			pathTags[index] = PathTag{matches[index+1], ""}
+		} else {
+			pathTags[index] = PathTag{tagName, matches[index+1]}
+		}
+	}
+
+	return pathTags, true
+}
+
+// unexported
+
+// the regular expression for a single component of a template along with the
+// names of the tags, or empty strings for captured tag names, it captures
+func parseTemplateComponent(component string) (string, []string, error) {
+	if component == "" {
+		return "", nil, fmt.Errorf("empty directory name")
+	}
+
+	pattern := ""
+	tagNames := make([]string, 0, 1)
+	for remaining := component; remaining != ""; {
+		index := strings.IndexAny(remaining, "{}*?")
+		if index == -1 {
+			pattern += regexp.QuoteMeta(remaining)
+			break
+		}
+
+		pattern += regexp.QuoteMeta(remaining[:index])
+
+		switch remaining[index] {
+		case '*':
+			if strings.HasPrefix(remaining[index:], "**") {
+				return "", nil, fmt.Errorf("'**' must be a directory name by itself")
+			}
+
+			pattern += "[^/]*"
+			remaining = remaining[index+1:]
+		case '?':
+			pattern += "[^/]"
+			remaining = remaining[index+1:]
+		case '}':
+			return "", nil, fmt.Errorf("unexpected '}'")
+		case '{':
+			end := strings.IndexAny(remaining[index+1:], "{}")
+			if end == -1 || remaining[index+1+end] == '{' {
+				return "", nil, fmt.Errorf("unterminated placeholder")
+			}
+
+			pattern += "([^/]+?)"
+			tagNames = append(tagNames, remaining[index+1:index+1+end])
+			remaining = remaining[index+end+2:]
+		}
+	}
+
+	return pattern, tagNames, nil
+}
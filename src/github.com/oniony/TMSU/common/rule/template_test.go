@@ -0,0 +1,68 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathTemplateExtractsValues(test *testing.T) {
+	assertExtracts(test, "Photos/{year}/{event}/*", "/home/alice/Photos/2019/Paris/louvre.jpg",
+		[]PathTag{{"year", "2019"}, {"event", "Paris"}})
+	assertExtracts(test, "Photos/{year}/{event}/*", "/home/alice/Photos/2019/louvre.jpg", nil)
+	assertExtracts(test, "Photos/{year}/{event}/*", "/home/alice/Pictures/2019/Paris/louvre.jpg", nil)
+}
+
+func TestPathTemplateExtractsTagNames(test *testing.T) {
+	assertExtracts(test, "music/{}/{artist} - {album}/*.flac", "/music/jazz/Miles Davis - Kind of Blue/01.flac",
+		[]PathTag{{"jazz", ""}, {"artist", "Miles Davis"}, {"album", "Kind of Blue"}})
+	assertExtracts(test, "music/{}/{artist} - {album}/*.flac", "/music/jazz/Miles Davis - Kind of Blue/01.mp3", nil)
+}
+
+func TestPathTemplateWithAnyDirectories(test *testing.T) {
+	assertExtracts(test, "/archive/{year}/**/*.pdf", "/archive/2020/tax/receipts/march.pdf",
+		[]PathTag{{"year", "2020"}})
+	assertExtracts(test, "/archive/{year}/**/*.pdf", "/archive/2020/march.pdf",
+		[]PathTag{{"year", "2020"}})
+	assertExtracts(test, "/archive/{year}/**/*.pdf", "/home/archive/2020/march.pdf", nil)
+	assertExtracts(test, "{}/**", "/projects/tmsu/src/main.go", []PathTag{{"projects", ""}})
+}
+
+func TestInvalidPathTemplates(test *testing.T) {
+	for _, text := range []string{"", "/", "Photos//*", "{year", "year}", "{a{b}}", "Photos/**.jpg"} {
+		if _, err := ParsePathTemplate(text); err == nil {
+			test.Fatalf("expected path template '%v' to be rejected", text)
+		}
+	}
+}
+
+// unexported
+
+func assertExtracts(test *testing.T, text, path string, expected []PathTag) {
+	template, err := ParsePathTemplate(text)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	pathTags, matches := template.Extract(path)
+	if matches != (expected != nil) {
+		test.Fatalf("expected path template '%v' matching '%v' to be %v", text, path, expected != nil)
+	}
+	if matches && !reflect.DeepEqual(pathTags, expected) {
+		test.Fatalf("expected path template '%v' to extract %v from '%v' but got %v", text, expected, path, pathTags)
+	}
+}
@@ -84,6 +84,13 @@ func Sort(items []string) {
 	sort.Sort(ansiStrings(items))
 }
 
+// Sorts the items by their text, ignoring any formatting, as ordered by less.
+func SortBy(items []string, less func(a, b string) bool) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(Strip(items[i]), Strip(items[j]))
+	})
+}
+
 // unexported
 
 var formatting = regexp.MustCompile(`\x1b\[[0-9]*(;[0-9]*)*m`)
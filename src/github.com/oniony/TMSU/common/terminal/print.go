@@ -29,7 +29,10 @@ func PrintColumns(items []string) {
 
 func PrintColumnsWidth(items []string, width int) {
 	ansi.Sort(items)
+	PrintColumnsInOrder(items, width)
+}
 
+func PrintColumnsInOrder(items []string, width int) {
 	padding := 2 // minimum column padding
 
 	var colWidths []int
@@ -91,7 +94,7 @@ func PrintColumnsWidth(items []string, width int) {
 
 			fmt.Print(item)
 
-			if columnIndex < cols-1 {
+			if columnIndex < cols-1 && itemIndex+rows < len(items) {
 				itemLength := len(ansi.Strip(item))
 				padding := (colWidths[columnIndex] + padding) - itemLength
 				fmt.Print(strings.Repeat(" ", padding))
@@ -0,0 +1,55 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+// Calculates the Levenshtein distance between two strings: the number of
+// single character insertions, deletions and substitutions by which one may be
+// turned into the other.
+func Distance(a, b string) int {
+	source := []rune(a)
+	target := []rune(b)
+
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for index := range previous {
+		previous[index] = index
+	}
+
+	for i, sourceChar := range source {
+		current[0] = i + 1
+
+		for j, targetChar := range target {
+			cost := 1
+			if sourceChar == targetChar {
+				cost = 0
+			}
+
+			distance := previous[j] + cost
+			if previous[j+1]+1 < distance {
+				distance = previous[j+1] + 1
+			}
+			if current[j]+1 < distance {
+				distance = current[j] + 1
+			}
+
+			current[j+1] = distance
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(target)]
+}
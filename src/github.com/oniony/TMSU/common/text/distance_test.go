@@ -0,0 +1,41 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+import (
+	"testing"
+)
+
+func TestDistance(test *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{{"", "", 0},
+		{"photo", "photo", 0},
+		{"photo", "", 5},
+		{"", "photo", 5},
+		{"phto", "photo", 1},
+		{"photos", "photo", 1},
+		{"fotos", "photo", 3},
+		{"kitten", "sitting", 3},
+		{"café", "cafe", 1}}
+
+	for _, c := range cases {
+		if distance := Distance(c.a, c.b); distance != c.distance {
+			test.Fatalf("distance between '%v' and '%v' was %v, expected %v", c.a, c.b, distance, c.distance)
+		}
+	}
+}
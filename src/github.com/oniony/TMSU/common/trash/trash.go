@@ -0,0 +1,68 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package trash
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// What becomes of a file on disk when it is deleted through TMSU.
+type Policy int
+
+const (
+	// the file is untagged but left untouched on disk
+	UntagOnly Policy = iota
+
+	// the file is moved to the user's trash
+	MoveToTrash
+
+	// the file is deleted outright
+	Delete
+)
+
+// The names by which the policies are specified.
+var PolicyNames = []string{"untag", "trash", "delete"}
+
+func ParsePolicy(name string) (Policy, error) {
+	for index, policyName := range PolicyNames {
+		if strings.EqualFold(name, policyName) {
+			return Policy(index), nil
+		}
+	}
+
+	return UntagOnly, fmt.Errorf("invalid delete policy '%v': expected %v", name, strings.Join(PolicyNames, ", "))
+}
+
+func (policy Policy) String() string {
+	return PolicyNames[policy]
+}
+
+// Applies the policy to the file at the path: moving it to the trash, deleting
+// it or, for UntagOnly, leaving it be. A directory is deleted along with its
+// contents.
+func Remove(path string, policy Policy) error {
+	switch policy {
+	case MoveToTrash:
+		_, err := Trash(path)
+		return err
+	case Delete:
+		return os.RemoveAll(path)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package trash
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Moves the file at the path to the user's trash, as described by the
+// FreeDesktop.org trash specification, and returns its path within the trash.
+// Files on the filesystem of the home directory are moved to the home trash,
+// those on other filesystems to the '.Trash-UID' directory at the top of
+// theirs.
+func Trash(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	trashPath, err := homeTrashPath()
+	if err != nil {
+		return "", err
+	}
+
+	// the home trash is created only if needed, so its parent is compared
+	infoPath := absPath
+	sameDevice, err := onDevice(filepath.Dir(trashPath), stat)
+	if err != nil {
+		return "", err
+	}
+	if !sameDevice {
+		topPath, err := topDirectory(absPath, stat)
+		if err != nil {
+			return "", err
+		}
+
+		trashPath = filepath.Join(topPath, ".Trash-"+strconv.Itoa(os.Getuid()))
+		if infoPath, err = filepath.Rel(topPath, absPath); err != nil {
+			return "", err
+		}
+	}
+
+	for _, dir := range []string{filepath.Join(trashPath, "files"), filepath.Join(trashPath, "info")} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("could not create trash directory '%v': %w", dir, err)
+		}
+	}
+
+	name, err := reserveName(trashPath, filepath.Base(absPath), infoPath)
+	if err != nil {
+		return "", err
+	}
+
+	trashedPath := filepath.Join(trashPath, "files", name)
+	if err := os.Rename(absPath, trashedPath); err != nil {
+		os.Remove(filepath.Join(trashPath, "info", name+".trashinfo"))
+		return "", fmt.Errorf("%v: could not move to trash: %w", path, err)
+	}
+
+	return trashedPath, nil
+}
+
+// unexported
+
+func homeTrashPath() (string, error) {
+	dataPath := os.Getenv("XDG_DATA_HOME")
+	if dataPath == "" {
+		homePath, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not identify home directory: %w", err)
+		}
+
+		dataPath = filepath.Join(homePath, ".local", "share")
+	}
+
+	return filepath.Join(dataPath, "Trash"), nil
+}
+
+// whether the nearest existing directory at or above the path is on the same
+// device as the file
+func onDevice(path string, file os.FileInfo) (bool, error) {
+	for {
+		stat, err := os.Stat(path)
+		switch {
+		case err == nil:
+			return device(stat) == device(file), nil
+		case !os.IsNotExist(err):
+			return false, err
+		}
+
+		parentPath := filepath.Dir(path)
+		if parentPath == path {
+			return false, nil
+		}
+		path = parentPath
+	}
+}
+
+// the top directory of the filesystem containing the file
+func topDirectory(path string, file os.FileInfo) (string, error) {
+	for {
+		parentPath := filepath.Dir(path)
+		if parentPath == path {
+			return path, nil
+		}
+
+		stat, err := os.Stat(parentPath)
+		if err != nil {
+			return "", err
+		}
+		if device(stat) != device(file) {
+			return path, nil
+		}
+
+		path = parentPath
+	}
+}
+
+func device(stat os.FileInfo) uint64 {
+	return uint64(stat.Sys().(*syscall.Stat_t).Dev)
+}
+
+// reserves a name within the trash not already in use, by creating the file
+// recording where the file came from, and returns it
+func reserveName(trashPath, name, originalPath string) (string, error) {
+	extension := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, extension)
+	if stem == "" {
+		stem, extension = name, ""
+	}
+
+	info := fmt.Sprintf("[Trash Info]\nPath=%v\nDeletionDate=%v\n",
+		(&url.URL{Path: originalPath}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+
+	for number := 1; ; number++ {
+		candidate := name
+		if number > 1 {
+			candidate = stem + "." + strconv.Itoa(number) + extension
+		}
+
+		infoPath := filepath.Join(trashPath, "info", candidate+".trashinfo")
+
+		infoFile, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not record file in trash: %w", err)
+		}
+
+		_, err = infoFile.WriteString(info)
+		if closeErr := infoFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not record file in trash: %w", err)
+		}
+
+		// a file left in the trash without its information is not overwritten
+		if _, err := os.Lstat(filepath.Join(trashPath, "files", candidate)); err == nil {
+			os.Remove(infoPath)
+			continue
+		}
+
+		return candidate, nil
+	}
+}
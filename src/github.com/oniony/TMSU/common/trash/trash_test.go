@@ -0,0 +1,84 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package trash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrash(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu-trash-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	defer os.Unsetenv("XDG_DATA_HOME")
+
+	trashPath := filepath.Join(dir, "data", "Trash")
+
+	for _, expectedName := range []string{"holiday photo.jpg", "holiday photo.2.jpg"} {
+		path := filepath.Join(dir, "holiday photo.jpg")
+		if err := ioutil.WriteFile(path, []byte("photo"), 0600); err != nil {
+			test.Fatal(err)
+		}
+
+		trashedPath, err := Trash(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if trashedPath != filepath.Join(trashPath, "files", expectedName) {
+			test.Fatalf("expected file to be trashed as '%v' but was '%v'", expectedName, trashedPath)
+		}
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			test.Fatalf("expected '%v' to have been moved", path)
+		}
+
+		info, err := ioutil.ReadFile(filepath.Join(trashPath, "info", expectedName+".trashinfo"))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		expectedPath := "Path=" + strings.Replace(path, " ", "%20", -1) + "\n"
+		if !strings.HasPrefix(string(info), "[Trash Info]\n") || !strings.Contains(string(info), expectedPath) {
+			test.Fatalf("unexpected trash info: %v", string(info))
+		}
+	}
+}
+
+func TestParsePolicy(test *testing.T) {
+	for _, name := range []string{"untag", "trash", "delete"} {
+		policy, err := ParsePolicy(name)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if policy.String() != name {
+			test.Fatalf("expected policy '%v' but was '%v'", name, policy)
+		}
+	}
+
+	if _, err := ParsePolicy("shred"); err == nil {
+		test.Fatal("expected invalid policy to be rejected")
+	}
+}
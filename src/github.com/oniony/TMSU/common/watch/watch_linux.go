@@ -0,0 +1,290 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/common/ignore"
+	"github.com/oniony/TMSU/common/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+type Watcher struct {
+	fd            int
+	pathsByWatch  map[int32]string
+	watchesByPath map[string]int32
+	shallow       map[int32]bool
+	ignored       *ignore.Matcher
+	buffer        []byte
+}
+
+func NewWatcher() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize inotify: %v", err)
+	}
+
+	return &Watcher{fd, make(map[int32]string), make(map[string]int32), make(map[int32]bool), ignore.NewMatcher(), make([]byte, bufferSize)}, nil
+}
+
+func (watcher *Watcher) Watch(path string, recursive bool) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not stat: %v", path, err)
+	}
+
+	if !stat.IsDir() {
+		return fmt.Errorf("%v: not a directory", path)
+	}
+
+	if !recursive {
+		watch, err := watcher.addWatch(path)
+		if err != nil {
+			return err
+		}
+
+		if watch >= 0 {
+			watcher.shallow[watch] = true
+		}
+
+		return nil
+	}
+
+	return watcher.watchRecursive(path)
+}
+
+func (watcher *Watcher) Next() (Events, error) {
+	for {
+		count, err := syscall.Read(watcher.fd, watcher.buffer)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+
+			return nil, fmt.Errorf("could not read file system events: %v", err)
+		}
+
+		if count < syscall.SizeofInotifyEvent {
+			return nil, errors.New("could not read file system events: short read")
+		}
+
+		events := watcher.parse(watcher.buffer[:count])
+		if len(events) > 0 {
+			return events, nil
+		}
+	}
+}
+
+func (watcher *Watcher) Close() error {
+	return syscall.Close(watcher.fd)
+}
+
+// unexported
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+const bufferSize = (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1) * 256
+
+func (watcher *Watcher) watchRecursive(path string) error {
+	if _, err := watcher.addWatch(path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return nil
+		case os.IsPermission(err):
+			log.Warnf("%v: permission denied", path)
+			return nil
+		default:
+			return fmt.Errorf("%v: could not open directory: %v", path, err)
+		}
+	}
+
+	entries, err := dir.Readdir(0)
+	dir.Close()
+	if err != nil {
+		return fmt.Errorf("%v: could not read directory entries: %v", path, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == ".tmsu" {
+			continue
+		}
+
+		entryPath := filepath.Join(path, entry.Name())
+		if watcher.ignored.Ignored(entryPath, true) {
+			log.Infof(2, "%v: skipping ignored directory", entryPath)
+			continue
+		}
+
+		if err := watcher.watchRecursive(entryPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (watcher *Watcher) addWatch(path string) (int32, error) {
+	log.Infof(2, "%v: watching directory", path)
+
+	watch, err := syscall.InotifyAddWatch(watcher.fd, path, watchMask)
+	if err != nil {
+		switch err {
+		case syscall.ENOENT:
+			return -1, nil
+		case syscall.EACCES:
+			log.Warnf("%v: permission denied", path)
+			return -1, nil
+		case syscall.ENOSPC:
+			return -1, fmt.Errorf("%v: could not watch directory: inotify watch limit reached (see fs.inotify.max_user_watches)", path)
+		default:
+			return -1, fmt.Errorf("%v: could not watch directory: %v", path, err)
+		}
+	}
+
+	watcher.pathsByWatch[int32(watch)] = path
+	watcher.watchesByPath[path] = int32(watch)
+
+	return int32(watch), nil
+}
+
+func (watcher *Watcher) parse(buffer []byte) Events {
+	events := make(Events, 0, 10)
+	movesByCookie := make(map[uint32]int)
+
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buffer); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		nameEnd := nameStart + int(raw.Len)
+		if nameEnd > len(buffer) {
+			break
+		}
+		name := strings.TrimRight(string(buffer[nameStart:nameEnd]), "\x00")
+		offset = nameEnd
+
+		if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			log.Warnf("file system event queue overflowed: some changes may have been missed")
+			continue
+		}
+
+		if raw.Mask&syscall.IN_IGNORED != 0 {
+			watcher.forget(raw.Wd)
+			continue
+		}
+
+		dir, ok := watcher.pathsByWatch[raw.Wd]
+		if !ok {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		isDir := raw.Mask&syscall.IN_ISDIR != 0
+
+		switch {
+		case raw.Mask&syscall.IN_MOVED_FROM != 0:
+			movesByCookie[raw.Cookie] = len(events)
+			events = append(events, Event{Removed, path, "", isDir})
+		case raw.Mask&syscall.IN_MOVED_TO != 0:
+			if index, ok := movesByCookie[raw.Cookie]; ok {
+				delete(movesByCookie, raw.Cookie)
+
+				events[index].Type = Moved
+				events[index].NewPath = path
+
+				if isDir {
+					watcher.rename(events[index].Path, path)
+				}
+			} else if isDir && !watcher.shallow[raw.Wd] {
+				watcher.watchNew(path)
+			}
+		case raw.Mask&syscall.IN_CREATE != 0:
+			if isDir && !watcher.shallow[raw.Wd] {
+				watcher.watchNew(path)
+			}
+		case raw.Mask&syscall.IN_DELETE != 0:
+			events = append(events, Event{Removed, path, "", isDir})
+		}
+	}
+
+	// directories moved outside of the watched tree are no longer of interest
+	for _, index := range movesByCookie {
+		if events[index].IsDir {
+			watcher.unwatch(events[index].Path)
+		}
+	}
+
+	return events
+}
+
+func (watcher *Watcher) watchNew(path string) {
+	if filepath.Base(path) == ".tmsu" || watcher.ignored.Ignored(path, true) {
+		return
+	}
+
+	if err := watcher.watchRecursive(path); err != nil {
+		log.Warn(err)
+	}
+}
+
+func (watcher *Watcher) rename(fromPath, toPath string) {
+	for watch, path := range watcher.pathsByWatch {
+		if path != fromPath && !strings.HasPrefix(path, fromPath+string(filepath.Separator)) {
+			continue
+		}
+
+		newPath := toPath + path[len(fromPath):]
+
+		delete(watcher.watchesByPath, path)
+		watcher.pathsByWatch[watch] = newPath
+		watcher.watchesByPath[newPath] = watch
+	}
+}
+
+func (watcher *Watcher) unwatch(dirPath string) {
+	for watch, path := range watcher.pathsByWatch {
+		if path != dirPath && !strings.HasPrefix(path, dirPath+string(filepath.Separator)) {
+			continue
+		}
+
+		log.Infof(2, "%v: no longer watching directory", path)
+
+		syscall.InotifyRmWatch(watcher.fd, uint32(watch))
+		watcher.forget(watch)
+	}
+}
+
+func (watcher *Watcher) forget(watch int32) {
+	path, ok := watcher.pathsByWatch[watch]
+	if !ok {
+		return
+	}
+
+	delete(watcher.pathsByWatch, watch)
+	delete(watcher.shallow, watch)
+	if watcher.watchesByPath[path] == watch {
+		delete(watcher.watchesByPath, path)
+	}
+}
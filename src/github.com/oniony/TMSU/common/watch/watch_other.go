@@ -0,0 +1,40 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux
+
+package watch
+
+import (
+	"errors"
+)
+
+type Watcher struct{}
+
+func NewWatcher() (*Watcher, error) {
+	return nil, errors.New("file system watching is not supported on this platform")
+}
+
+func (watcher *Watcher) Watch(path string, recursive bool) error {
+	return errors.New("file system watching is not supported on this platform")
+}
+
+func (watcher *Watcher) Next() (Events, error) {
+	return nil, errors.New("file system watching is not supported on this platform")
+}
+
+func (watcher *Watcher) Close() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package xattr
+
+import (
+	"errors"
+	"strings"
+)
+
+// The freedesktop.org extended attribute listing a file's tags.
+const TagsName = "user.xdg.tags"
+
+var ErrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// Splits a comma-separated attribute value into its items. Commas preceded by
+// a backslash do not separate items; the escapes are left for the caller.
+func ParseList(value string) []string {
+	items := make([]string, 0, 10)
+
+	start := 0
+	escaped := false
+	for index, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			items = appendItem(items, value[start:index])
+			start = index + 1
+		}
+	}
+	items = appendItem(items, value[start:])
+
+	return items
+}
+
+// Joins items, whose commas must already be escaped, into an attribute value.
+func FormatList(items []string) string {
+	return strings.Join(items, ",")
+}
+
+// unexported
+
+func appendItem(items []string, item string) []string {
+	item = strings.TrimSpace(item)
+	if item == "" {
+		return items
+	}
+
+	return append(items, item)
+}
@@ -0,0 +1,72 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build linux
+
+package xattr
+
+import (
+	"syscall"
+)
+
+// Retrieves the value of the file's extended attribute, or the empty string if
+// it is not set.
+func Get(path, name string) (string, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return "", attributeError(err)
+		}
+		if size == 0 {
+			return "", nil
+		}
+
+		buffer := make([]byte, size)
+		size, err = syscall.Getxattr(path, name, buffer)
+		if err == syscall.ERANGE {
+			// the attribute grew in the meantime
+			continue
+		}
+		if err != nil {
+			return "", attributeError(err)
+		}
+
+		return string(buffer[:size]), nil
+	}
+}
+
+// Sets the value of the file's extended attribute.
+func Set(path, name, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
+
+// Removes the file's extended attribute, if it is set.
+func Remove(path, name string) error {
+	if err := syscall.Removexattr(path, name); err != nil && err != syscall.ENODATA {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func attributeError(err error) error {
+	if err == syscall.ENODATA {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,49 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package xattr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(test *testing.T) {
+	values := map[string][]string{
+		"":                      []string{},
+		"aubergine":             []string{"aubergine"},
+		"aubergine,banana":      []string{"aubergine", "banana"},
+		" aubergine , banana ,": []string{"aubergine", "banana"},
+		`fruit\,veg,year=2017`:  []string{`fruit\,veg`, "year=2017"},
+		`back\\,slash`:          []string{`back\\`, "slash"},
+		",,aubergine,,":         []string{"aubergine"}}
+
+	for value, expected := range values {
+		actual := ParseList(value)
+
+		if !reflect.DeepEqual(actual, expected) {
+			test.Fatalf("Expected '%v' to parse as %v but was %v", value, expected, actual)
+		}
+	}
+}
+
+func TestFormatList(test *testing.T) {
+	actual := FormatList([]string{"aubergine", `fruit\,veg`, "year=2017"})
+	expected := `aubergine,fruit\,veg,year=2017`
+
+	if actual != expected {
+		test.Fatalf("Expected '%v' but was '%v'", expected, actual)
+	}
+}
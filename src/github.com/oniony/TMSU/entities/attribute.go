@@ -0,0 +1,165 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The names of the built-in tags by which files can be queried on the
+// attributes recorded when they were tagged or repaired, e.g. 'size > 10M',
+// 'ext=mp4', 'name~/^IMG_/' or 'mtime-after=2023-06-01', or on when their tags
+// were applied, e.g. 'tagged-after=2024-01-01', or by whom, e.g. 'tagged-by=alice'.
+const (
+	NameTagName          = "name"
+	SizeTagName          = "size"
+	ExtensionTagName     = "ext"
+	ModTimeTagName       = "mtime"
+	ModTimeAfterTagName  = "mtime-after"
+	ModTimeBeforeTagName = "mtime-before"
+	TaggedAfterTagName   = "tagged-after"
+	TaggedBeforeTagName  = "tagged-before"
+	TaggedByTagName      = "tagged-by"
+)
+
+// The names of all of the built-in tags. The 'name' tag is excluded as it is
+// commonly a tag in its own right, so is only treated as an attribute in queries.
+var BuiltInTagNames = []string{MimeTypeTagName, SizeTagName, ExtensionTagName, ModTimeTagName, ModTimeAfterTagName, ModTimeBeforeTagName, TaggedAfterTagName, TaggedBeforeTagName, TaggedByTagName}
+
+// Determines whether the name is that of a built-in tag.
+func IsBuiltInTagName(name string) bool {
+	for _, builtInTagName := range BuiltInTagNames {
+		if name == builtInTagName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validates a value compared against a built-in tag.
+func ValidateAttributeValue(tagName, valueName string) error {
+	var err error
+
+	switch tagName {
+	case SizeTagName:
+		_, err = ParseFileSize(valueName)
+	case ModTimeTagName, ModTimeAfterTagName, ModTimeBeforeTagName:
+		_, err = ParseModTime(valueName)
+	case TaggedAfterTagName, TaggedBeforeTagName:
+		_, err = ParseTaggedTime(valueName)
+	}
+
+	return err
+}
+
+// Determines whether the file's attributes satisfy the value of a built-in tag,
+// as when it is the condition of an implication such as 'ext=raw -> photo'.
+func AttributeMatches(file File, tagName, valueName string) bool {
+	switch tagName {
+	case MimeTypeTagName:
+		return file.MimeType == valueName
+	case ExtensionTagName:
+		index := strings.LastIndex(file.Name, ".")
+		if index == -1 {
+			return valueName == ""
+		}
+
+		return file.Name[index+1:] == valueName
+	case ModTimeTagName, ModTimeAfterTagName, ModTimeBeforeTagName:
+		modTime, err := ParseModTime(valueName)
+		if err != nil {
+			return false
+		}
+
+		fileModTime := file.ModTime.Format("2006-01-02 15:04:05")
+		if len(modTime) < len(fileModTime) {
+			fileModTime = fileModTime[:len(modTime)]
+		}
+
+		switch tagName {
+		case ModTimeAfterTagName:
+			return fileModTime >= modTime
+		case ModTimeBeforeTagName:
+			return fileModTime < modTime
+		default:
+			return fileModTime == modTime
+		}
+	}
+
+	return false
+}
+
+// Parses a file size in bytes, optionally with a K, M, G or T suffix for
+// kibibytes, mebibytes, gibibytes or tebibytes, e.g. '512', '10M' or '1.5G'.
+func ParseFileSize(text string) (int64, error) {
+	multiplier := 1.0
+	number := text
+
+	if len(text) > 0 {
+		switch text[len(text)-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		case 't', 'T':
+			multiplier = 1 << 40
+		}
+
+		if multiplier != 1 {
+			number = text[:len(text)-1]
+		}
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid file size '%v': expected a number of bytes optionally followed by K, M, G or T", text)
+	}
+
+	return int64(size * multiplier), nil
+}
+
+// Parses a modification time, which may be as coarse as a year or as fine as a
+// second, e.g. '2023', '2023-06', '2023-06-01' or '2023-06-01T12:30', into the
+// form in which the times are stored so that they compare by prefix.
+func ParseModTime(text string) (string, error) {
+	return parseTimePrefix(text, "modification time")
+}
+
+// Parses the time at which tags were applied, in the same forms as a
+// modification time.
+func ParseTaggedTime(text string) (string, error) {
+	return parseTimePrefix(text, "tagging time")
+}
+
+// unexported
+
+func parseTimePrefix(text, description string) (string, error) {
+	text = strings.Replace(text, "T", " ", 1)
+
+	for _, layout := range []string{"2006", "2006-01", "2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if _, err := time.Parse(layout, text); err == nil {
+			return text, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid %v '%v': expected YYYY[-MM[-DD[THH:MM[:SS]]]]", description, text)
+}
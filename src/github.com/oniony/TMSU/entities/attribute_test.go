@@ -0,0 +1,77 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFileSize(test *testing.T) {
+	expected := map[string]int64{"0": 0, "512": 512, "10K": 10240, "10M": 10485760, "1.5g": 1610612736, "2T": 2199023255552}
+
+	for text, expectedSize := range expected {
+		size, err := ParseFileSize(text)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if size != expectedSize {
+			test.Fatalf("Size of '%v' incorrect: expected %v but was %v", text, expectedSize, size)
+		}
+	}
+
+	for _, text := range []string{"", "M", "10Q", "-1K", "ten"} {
+		if _, err := ParseFileSize(text); err == nil {
+			test.Fatalf("Expected '%v' to be rejected.", text)
+		}
+	}
+}
+
+func TestParseModTime(test *testing.T) {
+	expected := map[string]string{"2023": "2023", "2023-06": "2023-06", "2023-06-01": "2023-06-01", "2023-06-01T12:30": "2023-06-01 12:30", "2023-06-01 12:30:45": "2023-06-01 12:30:45"}
+
+	for text, expectedModTime := range expected {
+		modTime, err := ParseModTime(text)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if modTime != expectedModTime {
+			test.Fatalf("Modification time '%v' incorrect: expected '%v' but was '%v'", text, expectedModTime, modTime)
+		}
+	}
+
+	for _, text := range []string{"", "06-01", "2023-13-01", "2023-06-01T25:00", "yesterday"} {
+		if _, err := ParseModTime(text); err == nil {
+			test.Fatalf("Expected '%v' to be rejected.", text)
+		}
+	}
+}
+
+func TestAttributeMatches(test *testing.T) {
+	file := File{Name: "holiday.tar.raw", ModTime: time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC), Size: 1024, MimeType: "image/x-raw"}
+
+	for _, condition := range [][2]string{{"ext", "raw"}, {"mime", "image/x-raw"}, {"mtime", "2023-06"}, {"mtime-after", "2023-06-01"}, {"mtime-before", "2024"}} {
+		if !AttributeMatches(file, condition[0], condition[1]) {
+			test.Fatalf("Expected file to match %v=%v.", condition[0], condition[1])
+		}
+	}
+
+	for _, condition := range [][2]string{{"ext", "tar"}, {"mime", "image/jpeg"}, {"mtime", "2023-07"}, {"mtime-after", "2023-06-02"}, {"mtime-before", "2023"}, {"size", "1K"}, {"colour", "red"}} {
+		if AttributeMatches(file, condition[0], condition[1]) {
+			test.Fatalf("Expected file not to match %v=%v.", condition[0], condition[1])
+		}
+	}
+}
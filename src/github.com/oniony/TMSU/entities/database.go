@@ -0,0 +1,41 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"time"
+)
+
+// A table or index within the database
+type DatabaseObject struct {
+	Name  string
+	Type  string // 'table' or 'index'
+	Table string // the table an index belongs to
+	Rows  uint   // the number of rows of a table
+	Size  int64  // the bytes used, or -1 if SQLite cannot report them
+}
+
+type DatabaseObjects []*DatabaseObject
+
+// A change to the database schema
+type Migration struct {
+	Version     string
+	Description string
+	Applied     bool
+	Time        time.Time // when the migration was applied, if recorded
+}
+
+type Migrations []*Migration
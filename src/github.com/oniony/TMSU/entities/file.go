@@ -22,6 +22,10 @@ import (
 	"time"
 )
 
+// The name of the built-in tag by which files can be queried on their detected
+// MIME type, e.g. 'mime=image/jpeg'.
+const MimeTypeTagName = "mime"
+
 type FileId uint
 
 type FileIds []FileId
@@ -65,6 +69,7 @@ type File struct {
 	ModTime     time.Time
 	Size        int64
 	IsDir       bool
+	MimeType    string
 }
 
 func (file File) Path() string {
@@ -85,6 +90,16 @@ func (files Files) Where(predicate func(*File) bool) Files {
 	return result
 }
 
+func (files Files) Paths() []string {
+	paths := make([]string, len(files))
+
+	for index, file := range files {
+		paths[index] = file.Path()
+	}
+
+	return paths
+}
+
 type FileTagCount struct {
 	FileId    FileId
 	Directory string
@@ -0,0 +1,29 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+// The identity of a file on the file system, which persists when the file is
+// renamed or moved within the same file system.
+type FileIdentity struct {
+	FileId FileId
+	Device uint64
+	Inode  uint64
+}
+
+// Whether the identities are of the same file on the file system.
+func (identity FileIdentity) SameFile(other FileIdentity) bool {
+	return identity.Device == other.Device && identity.Inode == other.Inode
+}
@@ -15,12 +15,18 @@
 
 package entities
 
+import (
+	"time"
+)
+
 type FileTag struct {
-	FileId   FileId
-	TagId    TagId
-	ValueId  ValueId
-	Explicit bool
-	Implicit bool
+	FileId    FileId
+	TagId     TagId
+	ValueId   ValueId
+	Explicit  bool
+	Implicit  bool
+	Applied   time.Time // when explicitly applied, or zero if not known
+	AppliedBy string    // who explicitly applied it, or empty if not known
 }
 
 func (fileTag FileTag) ToTagIdValueIdPair() TagIdValueIdPair {
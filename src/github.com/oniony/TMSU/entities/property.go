@@ -0,0 +1,61 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The prefix that distinguishes a property from a tag within a query, e.g.
+// 'prop:source-url like %flickr%'.
+const PropertyTagPrefix = "prop:"
+
+type Property struct {
+	FileId FileId
+	Name   string
+	Value  string
+}
+
+type Properties []*Property
+
+// Determines whether a tag name within a query refers to a property.
+func IsPropertyTagName(tagName string) bool {
+	return len(tagName) > len(PropertyTagPrefix) && strings.HasPrefix(tagName, PropertyTagPrefix)
+}
+
+// The name of the property to which a tag name within a query refers.
+func PropertyName(tagName string) string {
+	return strings.TrimPrefix(tagName, PropertyTagPrefix)
+}
+
+func ValidatePropertyName(name string) error {
+	if name == "" {
+		return fmt.Errorf("property name cannot be empty")
+	}
+
+	for _, ch := range name {
+		if unicode.IsSpace(ch) {
+			return fmt.Errorf("property names cannot contain whitespace")
+		}
+		if !unicode.IsPrint(ch) {
+			return fmt.Errorf("property names cannot contain %U", ch)
+		}
+	}
+
+	return nil
+}
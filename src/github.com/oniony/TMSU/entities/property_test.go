@@ -0,0 +1,56 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestValidatePropertyName(test *testing.T) {
+	// test
+
+	for _, name := range []string{"source-url", "licence", "sha256", "dc:creator"} {
+		if err := ValidatePropertyName(name); err != nil {
+			test.Fatalf("Property name '%v' should be valid: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "source url", "tab\there", "bell\a"} {
+		if err := ValidatePropertyName(name); err == nil {
+			test.Fatalf("Property name '%v' should be invalid", name)
+		}
+	}
+}
+
+func TestIsPropertyTagName(test *testing.T) {
+	// test
+
+	if !IsPropertyTagName("prop:source-url") {
+		test.Fatalf("'prop:source-url' should refer to a property")
+	}
+
+	for _, tagName := range []string{"prop:", "prop", "source-url", "photo:prop"} {
+		if IsPropertyTagName(tagName) {
+			test.Fatalf("'%v' should not refer to a property", tagName)
+		}
+	}
+
+	// validate
+
+	if name := PropertyName("prop:source-url"); name != "source-url" {
+		test.Fatalf("Expected property name 'source-url' but was '%v'", name)
+	}
+}
@@ -20,3 +20,17 @@ type Query struct {
 }
 
 type Queries []*Query
+
+// The SQL generated for a query, together with SQLite's plan for running it
+type QueryPlan struct {
+	Sql    string
+	Params []interface{}
+	Steps  []QueryPlanStep
+}
+
+// A step of a query plan, which lies beneath the step identified by Parent
+type QueryPlanStep struct {
+	Id     int
+	Parent int
+	Detail string
+}
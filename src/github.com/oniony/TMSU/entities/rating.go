@@ -0,0 +1,43 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The name of the tag with which files are rated.
+const RatingTagName = "rating"
+
+// The highest rating a file may be given.
+const MaxRating = 5
+
+// The lowest rating of the files that are favorites.
+const FavoriteRating = 4
+
+// The query matching the files that are favorites.
+var FavoritesQuery = fmt.Sprintf("%v >= %v", RatingTagName, FavoriteRating)
+
+// Parses a rating of between one and the maximum rating.
+func ParseRating(text string) (uint, error) {
+	rating, err := strconv.ParseUint(text, 10, 0)
+	if err != nil || rating < 1 || rating > MaxRating {
+		return 0, fmt.Errorf("invalid rating '%v': must be a whole number from 1 to %v", text, MaxRating)
+	}
+
+	return uint(rating), nil
+}
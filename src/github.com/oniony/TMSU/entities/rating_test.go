@@ -0,0 +1,38 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestParseRating(test *testing.T) {
+	rating, err := ParseRating("4")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if rating != 4 {
+		test.Fatalf("Expected rating 4 but was %v", rating)
+	}
+}
+
+func TestParseInvalidRating(test *testing.T) {
+	for _, text := range []string{"", "0", "6", "-1", "3.5", "four"} {
+		if _, err := ParseRating(text); err == nil {
+			test.Fatalf("Expected '%v' not to parse as a rating", text)
+		}
+	}
+}
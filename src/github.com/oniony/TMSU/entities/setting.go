@@ -15,6 +15,11 @@
 
 package entities
 
+import (
+	"strconv"
+	"time"
+)
+
 type Setting struct {
 	Name  string
 	Value string
@@ -34,6 +39,10 @@ func (settings Settings) Swap(i, j int) {
 	settings[i], settings[j] = settings[j], settings[i]
 }
 
+func (settings Settings) AuditLog() bool {
+	return settings.BoolValue("auditLog")
+}
+
 func (settings Settings) AutoCreateTags() bool {
 	return settings.BoolValue("autoCreateTags")
 }
@@ -42,8 +51,49 @@ func (settings Settings) AutoCreateValues() bool {
 	return settings.BoolValue("autoCreateValues")
 }
 
+func (settings Settings) BackupInterval() time.Duration {
+	interval, err := time.ParseDuration(settings.Value("backupInterval"))
+	if err != nil {
+		return 0
+	}
+
+	return interval
+}
+
+func (settings Settings) BackupRetention() uint {
+	retention, err := strconv.ParseUint(settings.Value("backupRetention"), 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(retention)
+}
+
+func (settings Settings) CanonicalPaths() bool {
+	return settings.BoolValue("canonicalPaths")
+}
+
+func (settings Settings) Collation() string {
+	return settings.Value("collation")
+}
+
+func (settings Settings) DefaultSort() string {
+	return settings.Value("defaultSort")
+}
+
 func (settings Settings) FileFingerprintAlgorithm() string {
-	return settings.Value("fileFingerprintAlgorithm")
+	algorithm := settings.Value("fileFingerprintAlgorithm")
+	if algorithm == "command" {
+		if commandLine := settings.FingerprintCommand(); commandLine != "" {
+			return "command:" + commandLine
+		}
+	}
+
+	return algorithm
+}
+
+func (settings Settings) FingerprintCommand() string {
+	return settings.Value("fingerprintCommand")
 }
 
 func (settings Settings) DirectoryFingerprintAlgorithm() string {
@@ -54,10 +104,72 @@ func (settings Settings) SymlinkFingerprintAlgorithm() string {
 	return settings.Value("symlinkFingerprintAlgorithm")
 }
 
+func (settings Settings) FollowSymlinks() bool {
+	return settings.BoolValue("followSymlinks")
+}
+
+func (settings Settings) IgnoreTagCase() bool {
+	return settings.BoolValue("ignoreTagCase")
+}
+
+func (settings Settings) NormalizeTagNames() bool {
+	return settings.BoolValue("normalizeTagNames")
+}
+
+func (settings Settings) OpenHandlers() string {
+	return settings.Value("openHandlers")
+}
+
+func (settings Settings) RecursiveTagLimit() uint {
+	limit, err := strconv.ParseUint(settings.Value("recursiveTagLimit"), 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(limit)
+}
+
+func (settings Settings) RelativePaths() bool {
+	return settings.BoolValue("relativePaths")
+}
+
 func (settings Settings) ReportDuplicates() bool {
 	return settings.BoolValue("reportDuplicates")
 }
 
+func (settings Settings) Sidecars() string {
+	return settings.Value("sidecars")
+}
+
+func (settings Settings) ReadOnly() bool {
+	return settings.BoolValue("readOnly")
+}
+
+func (settings Settings) TagByContent() bool {
+	return settings.BoolValue("tagByContent")
+}
+
+func (settings Settings) TrackInodes() bool {
+	return settings.BoolValue("trackInodes")
+}
+
+func (settings Settings) VfsFileNameTemplate() string {
+	return settings.Value("vfsFileNameTemplate")
+}
+
+func (settings Settings) VfsInboxTags() string {
+	return settings.Value("vfsInboxTags")
+}
+
+func (settings Settings) VfsRecentDays() uint {
+	days, err := strconv.ParseUint(settings.Value("vfsRecentDays"), 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(days)
+}
+
 func (settings Settings) ContainsName(name string) bool {
 	for _, setting := range settings {
 		if setting.Name == name {
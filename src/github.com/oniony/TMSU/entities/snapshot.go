@@ -0,0 +1,51 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+type SnapshotId uint
+
+// A snapshot records the files that matched a query, and their tags, at a point
+// in time.
+type Snapshot struct {
+	Id    SnapshotId
+	Name  string
+	Query string
+	Time  time.Time
+}
+
+type Snapshots []*Snapshot
+
+// A file as it was recorded by a snapshot.
+type SnapshotFile struct {
+	FileId FileId
+	Path   string
+	Tags   []string // the explicit tags, formatted as TAG or TAG=VALUE
+}
+
+type SnapshotFiles []*SnapshotFile
+
+func ValidateSnapshotName(snapshotName string) error {
+	if snapshotName == "" {
+		return fmt.Errorf("snapshot name cannot be empty")
+	}
+
+	return nil
+}
@@ -17,6 +17,7 @@ package entities
 
 import (
 	"fmt"
+	"golang.org/x/text/unicode/norm"
 	"sort"
 	"strings"
 	"unicode"
@@ -38,6 +39,16 @@ func (tagIds TagIds) Swap(i, j int) {
 	tagIds[i], tagIds[j] = tagIds[j], tagIds[i]
 }
 
+func (tagIds TagIds) Contains(searchTagId TagId) bool {
+	for _, tagId := range tagIds {
+		if tagId == searchTagId {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (tagIds TagIds) Uniq() TagIds {
 	if len(tagIds) == 0 {
 		return tagIds
@@ -121,6 +132,79 @@ type TagFileCount struct {
 	FileCount uint
 }
 
+// The number of files to which a pair of tags are both applied
+type TagPairFileCount struct {
+	TagId        TagId
+	TagName      string
+	OtherTagId   TagId
+	OtherTagName string
+	FileCount    uint
+}
+
+// The separator between the levels of a hierarchical tag name
+const TagNameSeparator = "/"
+
+// The name of the parent of a hierarchical tag, or an empty string for a top-level tag
+func ParentTagName(tagName string) string {
+	index := strings.LastIndex(tagName, TagNameSeparator)
+	if index == -1 {
+		return ""
+	}
+
+	return tagName[:index]
+}
+
+// The separator between the namespace of a tag and the remainder of its name
+const TagNamespaceSeparator = ":"
+
+// The namespace of a tag, e.g. 'person' for the tag 'person:alice', or an empty string for a tag without a namespace
+func TagNamespace(tagName string) string {
+	index := strings.Index(tagName, TagNamespaceSeparator)
+	if index <= 0 || index == len(tagName)-len(TagNamespaceSeparator) {
+		return ""
+	}
+
+	namespace := tagName[:index]
+	if strings.Contains(namespace, TagNameSeparator) {
+		// only a top-level tag name can have a namespace
+		return ""
+	}
+
+	return namespace
+}
+
+// The tag name with its namespace, if any, replaced by the specified namespace
+func WithTagNamespace(tagName, namespace string) string {
+	if current := TagNamespace(tagName); current != "" {
+		tagName = tagName[len(current)+len(TagNamespaceSeparator):]
+	}
+
+	if namespace == "" {
+		return tagName
+	}
+
+	return namespace + TagNamespaceSeparator + tagName
+}
+
+// The form of a tag name that is compared when matching it against other tag names: composed to Unicode
+// normalization form C when normalizing and converted to lower case when ignoring case
+func TagNameKey(tagName string, ignoreCase, normalize bool) string {
+	if normalize {
+		tagName = norm.NFC.String(tagName)
+	}
+
+	if ignoreCase {
+		tagName = strings.ToLower(tagName)
+	}
+
+	return tagName
+}
+
+// The tag name composed to Unicode normalization form C
+func NormalizeTagName(tagName string) string {
+	return norm.NFC.String(tagName)
+}
+
 func ValidateTagName(tagName string) error {
 	switch tagName {
 	case "":
@@ -131,6 +215,25 @@ func ValidateTagName(tagName string) error {
 		return fmt.Errorf("tag name cannot be a logical operator: 'and', 'or' or 'not'") // used in query language
 	case "eq", "EQ", "ne", "NE", "lt", "LT", "gt", "GT", "le", "LE", "ge", "GE":
 		return fmt.Errorf("tag name cannot be a comparison operator: 'eq', 'ne', 'gt', 'lt', 'ge' or 'le'") // used in query language
+	case "in", "IN":
+		return fmt.Errorf("tag name cannot be the 'in' operator") // used in query language
+	case "like", "LIKE":
+		return fmt.Errorf("tag name cannot be the 'like' operator") // used in query language
+	}
+
+	if strings.HasPrefix(tagName, TagNameSeparator) || strings.HasSuffix(tagName, TagNameSeparator) {
+		return fmt.Errorf("tag name cannot begin or end with '%v'", TagNameSeparator) // used for tag hierarchies
+	}
+
+	if strings.Contains(tagName, TagNameSeparator) {
+		for _, component := range strings.Split(tagName, TagNameSeparator) {
+			switch component {
+			case "":
+				return fmt.Errorf("tag name cannot contain an empty hierarchy level")
+			case ".", "..":
+				return fmt.Errorf("tag name hierarchy levels cannot be '.' or '..'")
+			}
+		}
 	}
 
 	for _, ch := range tagName {
@@ -146,6 +249,18 @@ func ValidateTagName(tagName string) error {
 	return nil
 }
 
+func ValidateTagNamespace(namespace string) error {
+	if namespace == "" {
+		return fmt.Errorf("namespace cannot be empty")
+	}
+
+	if strings.Contains(namespace, TagNamespaceSeparator) || strings.Contains(namespace, TagNameSeparator) {
+		return fmt.Errorf("namespace cannot contain '%v' or '%v'", TagNamespaceSeparator, TagNameSeparator)
+	}
+
+	return ValidateTagName(namespace + TagNamespaceSeparator + "tag")
+}
+
 // unexported
 
 var validTagChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol, unicode.Space}
@@ -34,3 +34,99 @@ func TestUniqueTagIds(test *testing.T) {
 		test.Fatalf("Unexpected unique set: %v", uniq)
 	}
 }
+
+func TestParentTagName(test *testing.T) {
+	// test
+
+	parent := ParentTagName("animal/mammal/dog")
+	root := ParentTagName("animal")
+
+	// validate
+
+	if parent != "animal/mammal" {
+		test.Fatalf("Unexpected parent tag name: %v", parent)
+	}
+
+	if root != "" {
+		test.Fatalf("Unexpected parent tag name: %v", root)
+	}
+}
+
+func TestValidateHierarchicalTagName(test *testing.T) {
+	// test
+
+	valid := ValidateTagName("animal/mammal/dog")
+	leading := ValidateTagName("/animal")
+	trailing := ValidateTagName("animal/")
+	empty := ValidateTagName("animal//dog")
+	dots := ValidateTagName("animal/../dog")
+
+	// validate
+
+	if valid != nil {
+		test.Fatalf("Unexpected error: %v", valid)
+	}
+
+	if leading == nil || trailing == nil || empty == nil || dots == nil {
+		test.Fatalf("Expected invalid hierarchical tag names to be rejected")
+	}
+}
+
+func TestTagNamespace(test *testing.T) {
+	// test
+
+	namespace := TagNamespace("person:alice")
+	hierarchical := TagNamespace("person:alice/work")
+	none := TagNamespace("alice")
+	empty := TagNamespace(":alice")
+	unnamed := TagNamespace("person:")
+	nested := TagNamespace("people/person:alice")
+
+	// validate
+
+	if namespace != "person" || hierarchical != "person" {
+		test.Fatalf("Unexpected namespaces: '%v', '%v'", namespace, hierarchical)
+	}
+
+	if none != "" || empty != "" || unnamed != "" || nested != "" {
+		test.Fatalf("Unexpected namespaces: '%v', '%v', '%v', '%v'", none, empty, unnamed, nested)
+	}
+}
+
+func TestWithTagNamespace(test *testing.T) {
+	// test
+
+	moved := WithTagNamespace("person:alice/work", "contact")
+	added := WithTagNamespace("alice", "person")
+	removed := WithTagNamespace("person:alice", "")
+
+	// validate
+
+	if moved != "contact:alice/work" || added != "person:alice" || removed != "alice" {
+		test.Fatalf("Unexpected tag names: '%v', '%v', '%v'", moved, added, removed)
+	}
+}
+
+func TestTagNameKey(test *testing.T) {
+	// set-up
+
+	composed := "caf\u00e9"
+	decomposed := "cafe\u0301"
+
+	// test
+
+	exact := TagNameKey("Café", false, false)
+	folded := TagNameKey("Café", true, false)
+	normalized := TagNameKey(decomposed, false, true)
+	both := TagNameKey("Café", true, true)
+
+	// validate
+
+	if exact != "Café" || folded != composed || normalized != composed || both != composed {
+		test.Fatalf("Unexpected tag name keys: '%v', '%v', '%v', '%v'", exact, folded, normalized, both)
+	}
+
+	if TagNameKey(decomposed, true, false) == composed {
+		test.Fatalf("Decomposed tag name should not match without normalization")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The values that may be applied with a tag, given as a regular expression
+// that must match the whole value, and the value applied where none is given.
+type TagConstraint struct {
+	Tag     Tag
+	Pattern string
+	Default string
+}
+
+// Determines whether the tag's values are unconstrained.
+func (tagConstraint TagConstraint) IsEmpty() bool {
+	return tagConstraint.Pattern == "" && tagConstraint.Default == ""
+}
+
+// Determines whether the value may be applied with the tag.
+func (tagConstraint TagConstraint) Allows(valueName string) bool {
+	if tagConstraint.Pattern == "" {
+		return true
+	}
+
+	expression, err := compileValuePattern(tagConstraint.Pattern)
+	if err != nil {
+		return false
+	}
+
+	return expression.MatchString(valueName)
+}
+
+type TagConstraints []*TagConstraint
+
+// Validates a value pattern, which is a regular expression such as
+// 'todo|doing|done' or '\d{4}' that must match the whole of a value.
+func ValidateValuePattern(pattern string) error {
+	if _, err := compileValuePattern(pattern); err != nil {
+		return fmt.Errorf("invalid value pattern '%v': %w", pattern, err)
+	}
+
+	return nil
+}
+
+// unexported
+
+func compileValuePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
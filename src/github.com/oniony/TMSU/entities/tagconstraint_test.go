@@ -0,0 +1,61 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestTagConstraintAllows(test *testing.T) {
+	// set-up
+
+	status := TagConstraint{Tag: Tag{1, "status"}, Pattern: "todo|doing|done"}
+	year := TagConstraint{Tag: Tag{2, "year"}, Pattern: `\d{4}`}
+
+	// validate
+
+	for _, valueName := range []string{"todo", "doing", "done"} {
+		if !status.Allows(valueName) {
+			test.Fatalf("Value '%v' should be allowed", valueName)
+		}
+	}
+
+	for _, valueName := range []string{"", "to", "todone", "done!"} {
+		if status.Allows(valueName) {
+			test.Fatalf("Value '%v' should not be allowed", valueName)
+		}
+	}
+
+	if !year.Allows("2020") || year.Allows("20201") || year.Allows("MMXX") {
+		test.Fatalf("Only four digit years should be allowed")
+	}
+
+	if !(TagConstraint{Tag: Tag{3, "any"}}).Allows("anything") {
+		test.Fatalf("Every value should be allowed without a pattern")
+	}
+}
+
+func TestValidateValuePattern(test *testing.T) {
+	// validate
+
+	if err := ValidateValuePattern(`todo|doing|done`); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ValidateValuePattern(`(todo`); err == nil {
+		test.Fatalf("Pattern '(todo' should be invalid")
+	}
+}
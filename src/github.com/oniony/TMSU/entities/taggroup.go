@@ -0,0 +1,64 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A set of tags of which at most one may be applied to any file.
+type TagGroup struct {
+	Name string
+	Tags Tags
+}
+
+type TagGroups []*TagGroup
+
+func (tagGroups TagGroups) Len() int {
+	return len(tagGroups)
+}
+
+func (tagGroups TagGroups) Swap(i, j int) {
+	tagGroups[i], tagGroups[j] = tagGroups[j], tagGroups[i]
+}
+
+func (tagGroups TagGroups) Less(i, j int) bool {
+	return tagGroups[i].Name < tagGroups[j].Name
+}
+
+// Retrieves the group with the specified name, or nil if there is none.
+func (tagGroups TagGroups) Named(name string) *TagGroup {
+	for _, tagGroup := range tagGroups {
+		if tagGroup.Name == name {
+			return tagGroup
+		}
+	}
+
+	return nil
+}
+
+func ValidateTagGroupName(name string) error {
+	if name == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+
+	if strings.Contains(name, TagNamespaceSeparator) || strings.Contains(name, TagNameSeparator) {
+		return fmt.Errorf("group name cannot contain '%v' or '%v'", TagNamespaceSeparator, TagNameSeparator) // used in queries
+	}
+
+	return ValidateTagName(name)
+}
@@ -0,0 +1,49 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The description of a tag, together with hints as to the color and icon with
+// which frontends may render it.
+type TagInfo struct {
+	Tag         Tag
+	Description string
+	Colour      string
+	Icon        string
+}
+
+// Determines whether none of the tag's information is set.
+func (tagInfo TagInfo) IsEmpty() bool {
+	return tagInfo.Description == "" && tagInfo.Colour == "" && tagInfo.Icon == ""
+}
+
+type TagInfos []*TagInfo
+
+var colourPattern = regexp.MustCompile(`^([a-zA-Z]+|#[0-9a-fA-F]{6})$`)
+
+// Validates a tag color, which is either a color name, such as 'blue', or an
+// RGB triplet, such as '#1e90ff'.
+func ValidateTagColour(colour string) error {
+	if colour != "" && !colourPattern.MatchString(colour) {
+		return fmt.Errorf("invalid color '%v': expected a color name or #RRGGBB", colour)
+	}
+
+	return nil
+}
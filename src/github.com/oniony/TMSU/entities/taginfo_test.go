@@ -0,0 +1,48 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestValidateTagColour(test *testing.T) {
+	// test
+
+	for _, colour := range []string{"", "blue", "DarkGreen", "#1e90ff", "#ABCDEF"} {
+		if err := ValidateTagColour(colour); err != nil {
+			test.Fatalf("Color '%v' should be valid: %v", colour, err)
+		}
+	}
+
+	for _, colour := range []string{"dark green", "#12345", "#1234567", "#ggggggg", "1e90ff", "red!"} {
+		if err := ValidateTagColour(colour); err == nil {
+			test.Fatalf("Color '%v' should be invalid", colour)
+		}
+	}
+}
+
+func TestTagInfoIsEmpty(test *testing.T) {
+	// validate
+
+	if !(TagInfo{Tag: Tag{1, "photo"}}).IsEmpty() {
+		test.Fatalf("Tag information without any fields should be empty")
+	}
+
+	if (TagInfo{Tag: Tag{1, "photo"}, Icon: "camera"}).IsEmpty() {
+		test.Fatalf("Tag information with an icon should not be empty")
+	}
+}
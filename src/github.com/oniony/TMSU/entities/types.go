@@ -29,3 +29,39 @@ func (pair TagIdValueIdPair) String() string {
 }
 
 type TagIdValueIdPairs []TagIdValueIdPair
+
+func (pairs TagIdValueIdPairs) Contains(pair TagIdValueIdPair) bool {
+	for _, p := range pairs {
+		if p == pair {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The pairs that are also within the other set.
+func (pairs TagIdValueIdPairs) Intersection(other TagIdValueIdPairs) TagIdValueIdPairs {
+	result := make(TagIdValueIdPairs, 0, len(pairs))
+
+	for _, pair := range pairs {
+		if other.Contains(pair) && !result.Contains(pair) {
+			result = append(result, pair)
+		}
+	}
+
+	return result
+}
+
+// The pairs that are not within the other set.
+func (pairs TagIdValueIdPairs) Difference(other TagIdValueIdPairs) TagIdValueIdPairs {
+	result := make(TagIdValueIdPairs, 0, len(pairs))
+
+	for _, pair := range pairs {
+		if !other.Contains(pair) && !result.Contains(pair) {
+			result = append(result, pair)
+		}
+	}
+
+	return result
+}
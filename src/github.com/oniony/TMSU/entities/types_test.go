@@ -0,0 +1,54 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestTagIdValueIdPairsIntersection(test *testing.T) {
+	// set-up
+
+	pairs := TagIdValueIdPairs{{1, 0}, {2, 3}, {4, 0}, {2, 3}}
+	other := TagIdValueIdPairs{{4, 0}, {2, 3}, {2, 0}}
+
+	// test
+
+	intersection := pairs.Intersection(other)
+
+	// validate
+
+	if len(intersection) != 2 || intersection[0] != (TagIdValueIdPair{2, 3}) || intersection[1] != (TagIdValueIdPair{4, 0}) {
+		test.Fatalf("Unexpected intersection: %v", intersection)
+	}
+}
+
+func TestTagIdValueIdPairsDifference(test *testing.T) {
+	// set-up
+
+	pairs := TagIdValueIdPairs{{1, 0}, {2, 3}, {4, 0}, {1, 0}}
+	other := TagIdValueIdPairs{{4, 0}, {2, 0}}
+
+	// test
+
+	difference := pairs.Difference(other)
+
+	// validate
+
+	if len(difference) != 2 || difference[0] != (TagIdValueIdPair{1, 0}) || difference[1] != (TagIdValueIdPair{2, 3}) {
+		test.Fatalf("Unexpected difference: %v", difference)
+	}
+}
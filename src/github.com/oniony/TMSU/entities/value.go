@@ -64,6 +64,13 @@ type Value struct {
 
 type Values []*Value
 
+// The number of files to which a value of a tag is applied
+type ValueFileCount struct {
+	Id        ValueId
+	Name      string
+	FileCount uint
+}
+
 func (values Values) Len() int {
 	return len(values)
 }
@@ -105,6 +112,16 @@ func (values Values) ContainsCasedName(name string, ignoreCase bool) bool {
 	return false
 }
 
+func (values Values) Find(name string) *Value {
+	for _, value := range values {
+		if value.Name == name {
+			return value
+		}
+	}
+
+	return nil
+}
+
 func (values Values) Any(predicate func(*Value) bool) bool {
 	for _, value := range values {
 		if predicate(value) {
@@ -125,6 +142,10 @@ func ValidateValueName(valueName string) error {
 		return fmt.Errorf("tag value cannot be a logical operator: 'and', 'or' or 'not'") // used in query language
 	case "eq", "EQ", "ne", "NE", "lt", "LT", "gt", "GT", "le", "LE", "ge", "GE":
 		return fmt.Errorf("tag value cannot be a comparison operator: 'eq', 'ne', 'lt', 'gt', 'le' or 'ge'") // used in query language
+	case "in", "IN":
+		return fmt.Errorf("tag value cannot be the 'in' operator") // used in query language
+	case "like", "LIKE":
+		return fmt.Errorf("tag value cannot be the 'like' operator") // used in query language
 	}
 
 	for _, ch := range valueName {
@@ -0,0 +1,151 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// The type of the values that may be applied with a tag.
+type ValueType string
+
+const (
+	UntypedValues ValueType = ""
+	StringValues  ValueType = "string"
+	IntegerValues ValueType = "int"
+	DateValues    ValueType = "date"
+)
+
+// The layout in which date values are stored.
+const DateLayout = "2006-01-02"
+
+type TagType struct {
+	Tag  Tag
+	Type ValueType
+}
+
+type TagTypes []*TagType
+
+func (tagTypes TagTypes) Len() int {
+	return len(tagTypes)
+}
+
+func (tagTypes TagTypes) Swap(i, j int) {
+	tagTypes[i], tagTypes[j] = tagTypes[j], tagTypes[i]
+}
+
+func (tagTypes TagTypes) Less(i, j int) bool {
+	return tagTypes[i].Tag.Name < tagTypes[j].Tag.Name
+}
+
+// Parses a value type name, where 'none' denotes untyped values.
+func ParseValueType(name string) (ValueType, error) {
+	switch name {
+	case "none":
+		return UntypedValues, nil
+	case "string":
+		return StringValues, nil
+	case "int", "integer":
+		return IntegerValues, nil
+	case "date":
+		return DateValues, nil
+	}
+
+	return UntypedValues, fmt.Errorf("invalid value type '%v': must be one of 'int', 'date', 'string' or 'none'", name)
+}
+
+func (valueType ValueType) String() string {
+	if valueType == UntypedValues {
+		return "none"
+	}
+
+	return string(valueType)
+}
+
+// Checks that a value is valid for the type, returning the value in its stored form.
+// Dates may be written relative to today, e.g. 'today-30d' (see ParseDate).
+func (valueType ValueType) Normalize(valueName string) (string, error) {
+	return valueType.normalize(valueName, time.Now())
+}
+
+// Parses a date of the form YYYY-MM-DD or 'today', optionally followed by
+// one or more offsets in days, weeks, months or years, e.g. '2020-01-01+1y'.
+func ParseDate(text string, today time.Time) (time.Time, error) {
+	match := dateRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("'%v' is not a date of the form YYYY-MM-DD", text)
+	}
+
+	var date time.Time
+	if match[1] == "today" {
+		date = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	} else {
+		var err error
+		date, err = time.Parse(DateLayout, match[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%v' is not a valid date", match[1])
+		}
+	}
+
+	for _, offset := range offsetRegexp.FindAllStringSubmatch(match[2], -1) {
+		count, err := strconv.Atoi(offset[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date offset '%v'", offset[0])
+		}
+
+		switch offset[2] {
+		case "d":
+			date = date.AddDate(0, 0, count)
+		case "w":
+			date = date.AddDate(0, 0, count*7)
+		case "m":
+			date = date.AddDate(0, count, 0)
+		case "y":
+			date = date.AddDate(count, 0, 0)
+		}
+	}
+
+	return date, nil
+}
+
+// unexported
+
+var dateRegexp = regexp.MustCompile(`^(today|\d{4}-\d{2}-\d{2})((?:[+-]\d+[dwmy])*)$`)
+var offsetRegexp = regexp.MustCompile(`([+-]\d+)([dwmy])`)
+
+func (valueType ValueType) normalize(valueName string, today time.Time) (string, error) {
+	switch valueType {
+	case IntegerValues:
+		number, err := strconv.ParseInt(valueName, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("'%v' is not an integer", valueName)
+		}
+
+		return strconv.FormatInt(number, 10), nil
+	case DateValues:
+		date, err := ParseDate(valueName, today)
+		if err != nil {
+			return "", err
+		}
+
+		return date.Format(DateLayout), nil
+	}
+
+	return valueName, nil
+}
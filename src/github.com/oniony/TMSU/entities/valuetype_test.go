@@ -0,0 +1,97 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(test *testing.T) {
+	today := time.Date(2020, time.March, 15, 13, 45, 0, 0, time.UTC)
+
+	assertDate("2019-12-31", "2019-12-31", today, test)
+	assertDate("today", "2020-03-15", today, test)
+	assertDate("today-30d", "2020-02-14", today, test)
+	assertDate("today+2w", "2020-03-29", today, test)
+	assertDate("2020-01-01+1y", "2021-01-01", today, test)
+	assertDate("2020-01-31+1m-1d", "2020-03-01", today, test)
+}
+
+func TestParseInvalidDate(test *testing.T) {
+	today := time.Now()
+
+	for _, text := range []string{"", "yesterday", "2020-1-1", "2020-13-01", "2020-01-01+1h", "01/01/2020"} {
+		if _, err := ParseDate(text, today); err == nil {
+			test.Fatalf("Expected '%v' not to parse as a date", text)
+		}
+	}
+}
+
+func TestNormalizeIntegerValue(test *testing.T) {
+	today := time.Now()
+
+	value, err := IntegerValues.normalize("+042", today)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if value != "42" {
+		test.Fatalf("Expected '42' but was '%v'", value)
+	}
+
+	if _, err := IntegerValues.normalize("4.2", today); err == nil {
+		test.Fatal("Expected '4.2' not to be an integer")
+	}
+}
+
+func TestNormalizeUntypedValue(test *testing.T) {
+	value, err := UntypedValues.normalize("today", time.Now())
+	if err != nil {
+		test.Fatal(err)
+	}
+	if value != "today" {
+		test.Fatalf("Expected 'today' but was '%v'", value)
+	}
+}
+
+func TestParseValueType(test *testing.T) {
+	for name, expected := range map[string]ValueType{"int": IntegerValues, "date": DateValues, "string": StringValues, "none": UntypedValues} {
+		valueType, err := ParseValueType(name)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if valueType != expected {
+			test.Fatalf("Expected '%v' but was '%v'", expected, valueType)
+		}
+	}
+
+	if _, err := ParseValueType("float"); err == nil {
+		test.Fatal("Expected 'float' not to be a value type")
+	}
+}
+
+// unexported
+
+func assertDate(text, expected string, today time.Time, test *testing.T) {
+	date, err := ParseDate(text, today)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if actual := date.Format(DateLayout); actual != expected {
+		test.Fatalf("Expected '%v' to be '%v' but was '%v'", text, expected, actual)
+	}
+}
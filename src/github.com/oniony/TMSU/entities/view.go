@@ -0,0 +1,44 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A view is a query saved under a name.
+type View struct {
+	Name  string
+	Query string
+}
+
+type Views []*View
+
+func ValidateViewName(viewName string) error {
+	switch viewName {
+	case "":
+		return fmt.Errorf("view name cannot be empty")
+	case ".", "..":
+		return fmt.Errorf("view name cannot be '.' or '..'") // cannot be used in the VFS
+	}
+
+	if strings.ContainsRune(viewName, '/') {
+		return fmt.Errorf("view names cannot contain '/'") // cannot be used in the VFS
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package libtmsu is the interface through which other Go programs may use TMSU
+// databases directly, rather than by running the 'tmsu' program.
+package libtmsu
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/storage"
+)
+
+// A TMSU database.
+type Database struct {
+	store *storage.Storage
+}
+
+// A tag, with an optional value, as applied to a file.
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Creates a new database at the specified path.
+func CreateDatabase(path string) error {
+	if err := storage.CreateAt(path); err != nil {
+		return fmt.Errorf("could not create database at '%v': %w", path, err)
+	}
+
+	return nil
+}
+
+// Opens the database at the specified path.
+func OpenDatabase(path string) (*Database, error) {
+	store, err := storage.OpenAt(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database at '%v': %w", path, err)
+	}
+
+	return &Database{store}, nil
+}
+
+// The database held by the storage, which remains open until the database is
+// closed.
+func FromStorage(store *storage.Storage) *Database {
+	return &Database{store}
+}
+
+// The path of the database.
+func (db *Database) Path() string {
+	return db.store.DbPath
+}
+
+// The path relative to which files are stored in the database.
+func (db *Database) RootPath() string {
+	return db.store.RootPath
+}
+
+// Attributes the tags subsequently applied to the specified user, who is
+// otherwise not recorded.
+func (db *Database) SetUser(user string) {
+	db.store.SetUser(user)
+}
+
+// Closes the database.
+func (db *Database) Close() error {
+	return db.store.Close()
+}
+
+// unexported
+
+// runs the function within a transaction that is committed if it succeeds
+func (db *Database) update(fn func(tx *storage.Tx) error) error {
+	tx, err := db.store.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// runs the function within a transaction that is rolled back afterwards
+func (db *Database) view(fn func(tx *storage.Tx) error) error {
+	tx, err := db.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return fn(tx)
+}
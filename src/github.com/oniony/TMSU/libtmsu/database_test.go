@@ -0,0 +1,96 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package libtmsu
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTagAndQueryFiles(test *testing.T) {
+	dir, err := ioutil.TempDir("", "libtmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+	if err := CreateDatabase(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	db, err := OpenDatabase(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	beach := createFile(dir, "beach.jpg", "sand", test)
+	harbour := createFile(dir, "harbour.jpg", "boats", test)
+
+	if err := db.TagFile(beach, Tag{"photo", ""}, Tag{"year", "2019"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.TagFile(harbour, Tag{"photo", ""}, Tag{"year", "2021"}); err != nil {
+		test.Fatal(err)
+	}
+
+	assertQueryFiles(db, "photo", []string{beach, harbour}, test)
+	assertQueryFiles(db, "photo and year < 2020", []string{beach}, test)
+
+	tags, err := db.FileTags(harbour)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if expected := []Tag{{"photo", ""}, {"year", "2021"}}; !reflect.DeepEqual(tags, expected) {
+		test.Fatalf("Expected tags %v but were %v", expected, tags)
+	}
+
+	if err := db.UntagFile(harbour, Tag{"photo", ""}); err != nil {
+		test.Fatal(err)
+	}
+
+	assertQueryFiles(db, "photo", []string{beach}, test)
+
+	if err := db.UntagFile(harbour, Tag{"cheese", ""}); err != (NoSuchTagError{"cheese"}) {
+		test.Fatalf("Expected no such tag error but was %v", err)
+	}
+}
+
+// unexported
+
+func createFile(dir, name, content string, test *testing.T) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	return path
+}
+
+func assertQueryFiles(db *Database, queryText string, expected []string, test *testing.T) {
+	paths, err := db.QueryFiles(queryText)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(paths, expected) {
+		test.Fatalf("Expected '%v' to match %v but matched %v", queryText, expected, paths)
+	}
+}
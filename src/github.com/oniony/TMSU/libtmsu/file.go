@@ -0,0 +1,185 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package libtmsu
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/common/mimetype"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"os"
+	"path/filepath"
+)
+
+// Applies the tags to the file at the specified path, adding the file to the
+// database if it is not yet tracked. Tags and values that do not exist are
+// created unless the 'autoCreateTags' or 'autoCreateValues' setting is
+// disabled.
+func (db *Database) TagFile(path string, tags ...Tag) error {
+	return db.update(func(tx *storage.Tx) error {
+		settings, err := db.store.Settings(tx)
+		if err != nil {
+			return err
+		}
+
+		pairs, err := db.tagValuePairs(tx, settings, tags, true)
+		if err != nil {
+			return err
+		}
+
+		file, err := db.addFile(tx, settings, path)
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range pairs {
+			exists, err := db.store.FileTagExists(tx, file.Id, pair.TagId, pair.ValueId, true)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+
+			if _, err := db.store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+				return fmt.Errorf("%v: could not apply tags: %w", path, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Removes the tags from the file at the specified path.
+func (db *Database) UntagFile(path string, tags ...Tag) error {
+	return db.update(func(tx *storage.Tx) error {
+		settings, err := db.store.Settings(tx)
+		if err != nil {
+			return err
+		}
+
+		file, err := db.fileByPath(tx, path)
+		if err != nil {
+			return err
+		}
+
+		pairs, err := db.tagValuePairs(tx, settings, tags, false)
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range pairs {
+			if err := db.store.DeleteFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+				return fmt.Errorf("%v: could not remove tags: %w", path, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// The tags applied to the file at the specified path, including those implied
+// by other tags, ordered by name.
+func (db *Database) FileTags(path string) ([]Tag, error) {
+	var tags []Tag
+
+	err := db.view(func(tx *storage.Tx) error {
+		file, err := db.fileByPath(tx, path)
+		if err != nil {
+			return err
+		}
+
+		fileTags, err := db.store.FileTagsByFileId(tx, file.Id, false)
+		if err != nil {
+			return err
+		}
+
+		tags, err = db.namedTags(tx, fileTags)
+		return err
+	})
+
+	return tags, err
+}
+
+// unexported
+
+func (db *Database) fileByPath(tx *storage.Tx, path string) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	file, err := db.store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+	if file == nil {
+		return nil, NoSuchFileError{path}
+	}
+
+	return file, nil
+}
+
+// retrieves the file at the path, adding it to the database if it is not yet tracked
+func (db *Database) addFile(tx *storage.Tx, settings entities.Settings, path string) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %w", path, err)
+	}
+
+	stat, err := os.Lstat(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Mode()&os.ModeSymlink != 0 && settings.FollowSymlinks() {
+		absPath, err = _path.Dereference(absPath)
+		if err != nil {
+			return nil, err
+		}
+
+		stat, err = os.Lstat(absPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := db.store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %w", path, err)
+	}
+	if file != nil {
+		return file, nil
+	}
+
+	fp, err := fingerprint.Create(absPath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not create fingerprint: %w", path, err)
+	}
+
+	mimeType, err := mimetype.Detect(absPath)
+	if err != nil {
+		mimeType = ""
+	}
+
+	file, err = db.store.AddFile(tx, absPath, fp, stat.ModTime(), stat.Size(), stat.IsDir(), mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not add file to database: %w", path, err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package libtmsu
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage"
+)
+
+// The paths of the files matching the query, which has the syntax of the
+// 'tmsu files' subcommand's, e.g. "photo and year > 2017". Files are ordered
+// according to the 'defaultSort' setting.
+func (db *Database) QueryFiles(queryText string) ([]string, error) {
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query: %w", err)
+	}
+
+	var paths []string
+
+	err = db.view(func(tx *storage.Tx) error {
+		settings, err := db.store.Settings(tx)
+		if err != nil {
+			return err
+		}
+
+		files, err := db.store.FilesForQuery(tx, expression, nil, "", false, settings.IgnoreTagCase(), settings.DefaultSort(), false, 0)
+		if err != nil {
+			return fmt.Errorf("could not query files: %w", err)
+		}
+
+		paths = make([]string, len(files))
+		for index, file := range files {
+			paths[index] = file.Path()
+		}
+
+		return nil
+	})
+
+	return paths, err
+}
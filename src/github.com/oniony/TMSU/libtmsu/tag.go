@@ -0,0 +1,186 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package libtmsu
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"sort"
+)
+
+// The names of the tags in the database, ordered by name.
+func (db *Database) Tags() ([]string, error) {
+	var names []string
+
+	err := db.view(func(tx *storage.Tx) error {
+		tags, err := db.store.Tags(tx)
+		if err != nil {
+			return err
+		}
+
+		names = make([]string, len(tags))
+		for index, tag := range tags {
+			names[index] = tag.Name
+		}
+
+		return nil
+	})
+
+	return names, err
+}
+
+// The names of the values applied with the specified tag, ordered by name.
+func (db *Database) Values(tagName string) ([]string, error) {
+	var names []string
+
+	err := db.view(func(tx *storage.Tx) error {
+		tag, err := db.store.TagByNameOrAlias(tx, tagName)
+		if err != nil {
+			return err
+		}
+		if tag == nil {
+			return NoSuchTagError{tagName}
+		}
+
+		values, err := db.store.ValuesByTag(tx, tag.Id)
+		if err != nil {
+			return err
+		}
+
+		names = make([]string, len(values))
+		for index, value := range values {
+			names[index] = value.Name
+		}
+
+		return nil
+	})
+
+	return names, err
+}
+
+// Creates a tag.
+func (db *Database) CreateTag(name string) error {
+	return db.update(func(tx *storage.Tx) error {
+		if _, err := db.store.AddTag(tx, name); err != nil {
+			return fmt.Errorf("could not create tag '%v': %w", name, err)
+		}
+
+		return nil
+	})
+}
+
+// Deletes a tag, removing it from every file to which it is applied.
+func (db *Database) DeleteTag(name string) error {
+	return db.update(func(tx *storage.Tx) error {
+		tag, err := db.store.TagByName(tx, name)
+		if err != nil {
+			return err
+		}
+		if tag == nil {
+			return NoSuchTagError{name}
+		}
+
+		return db.store.DeleteTag(tx, tag.Id)
+	})
+}
+
+// unexported
+
+// looks up the tags and values, creating those that do not exist if create is
+// specified and the settings permit it
+func (db *Database) tagValuePairs(tx *storage.Tx, settings entities.Settings, tags []Tag, create bool) (entities.TagIdValueIdPairs, error) {
+	pairs := make(entities.TagIdValueIdPairs, 0, len(tags))
+
+	for _, tag := range tags {
+		storedTag, err := db.store.TagByNameOrAlias(tx, tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		if storedTag == nil {
+			if !create || !settings.AutoCreateTags() {
+				return nil, NoSuchTagError{tag.Name}
+			}
+
+			storedTag, err = db.store.AddTag(tx, tag.Name)
+			if err != nil {
+				return nil, fmt.Errorf("could not create tag '%v': %w", tag.Name, err)
+			}
+		}
+
+		// the tag's default value is applied only when tagging
+		valueName := tag.Value
+		if create || valueName != "" {
+			valueName, err = db.store.TagValueName(tx, *storedTag, valueName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := db.store.ValueByName(tx, valueName)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			if !create || !settings.AutoCreateValues() {
+				return nil, NoSuchValueError{valueName}
+			}
+
+			value, err = db.store.AddValue(tx, valueName)
+			if err != nil {
+				return nil, fmt.Errorf("could not create value '%v': %w", valueName, err)
+			}
+		}
+
+		pairs = append(pairs, entities.TagIdValueIdPair{storedTag.Id, value.Id})
+	}
+
+	return pairs, nil
+}
+
+// names the tags and values of the file tags
+func (db *Database) namedTags(tx *storage.Tx, fileTags entities.FileTags) ([]Tag, error) {
+	tags := make([]Tag, 0, len(fileTags))
+
+	for _, fileTag := range fileTags {
+		tag, err := db.store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			return nil, err
+		}
+
+		valueName := ""
+		if fileTag.ValueId != 0 {
+			value, err := db.store.Value(tx, fileTag.ValueId)
+			if err != nil {
+				return nil, err
+			}
+
+			valueName = value.Name
+		}
+
+		tags = append(tags, Tag{tag.Name, valueName})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+
+		return tags[i].Value < tags[j].Value
+	})
+
+	return tags, nil
+}
@@ -17,6 +17,8 @@ package query
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 )
 
 type Parser struct {
@@ -53,6 +55,18 @@ type ComparisonExpression struct {
 	Value    ValueExpression
 }
 
+// Whether the comparison matches values against a regular expression, which is
+// the case for the '~' and '!~' operators.
+func (comparison ComparisonExpression) IsPatternMatch() bool {
+	return comparison.Operator == "~" || comparison.Operator == "!~"
+}
+
+// Whether the comparison matches values as text against a pattern, which is the
+// case for the regular expression operators and 'like'.
+func (comparison ComparisonExpression) IsTextMatch() bool {
+	return comparison.IsPatternMatch() || comparison.Operator == "like"
+}
+
 type NotExpression struct {
 	Operand Expression
 }
@@ -63,6 +77,13 @@ type TagExpression struct {
 
 type ValueExpression struct {
 	Name string
+	Type string // the type of the compared tag's values, if it has one
+}
+
+// Whether the value is a number, in which case it is compared numerically.
+func (value ValueExpression) IsNumeric() bool {
+	_, err := strconv.ParseFloat(value.Name, 64)
+	return err == nil
 }
 
 // unexported
@@ -221,19 +242,75 @@ func (parser Parser) comparison() (Expression, error) {
 
 	switch typedToken := token.(type) {
 	case ComparisonOperatorToken:
-		parser.scanner.Next()
+		if _, err := parser.scanner.Next(); err != nil {
+			return nil, err
+		}
 
 		value, err := parser.value()
 		if err != nil {
 			return nil, err
 		}
 
-		return ComparisonExpression{tag, typedToken.operator, value}, nil
+		comparison := ComparisonExpression{tag, typedToken.operator, value}
+		if comparison.IsPatternMatch() {
+			if _, err := regexp.Compile(value.Name); err != nil {
+				return nil, fmt.Errorf("invalid regular expression '%v': %v", value.Name, err)
+			}
+		}
+
+		return comparison, nil
+	case InOperatorToken:
+		parser.scanner.Next()
+
+		return parser.in(tag)
 	}
 
 	return tag, nil
 }
 
+// parses the parenthesized list of values following 'in', which matches any of them
+func (parser Parser) in(tag TagExpression) (Expression, error) {
+	token, err := parser.scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token.(type) {
+	case OpenParenToken:
+	default:
+		return nil, fmt.Errorf("unexpected token: %v", Type(token))
+	}
+
+	var expression Expression
+	for {
+		value, err := parser.value()
+		if err != nil {
+			return nil, err
+		}
+
+		comparison := ComparisonExpression{tag, "=", value}
+		if expression == nil {
+			expression = comparison
+		} else {
+			expression = OrExpression{expression, comparison}
+		}
+
+		token, err := parser.scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.(type) {
+		case CommaToken:
+			continue
+		case CloseParenToken:
+			return expression, nil
+		default:
+			return nil, fmt.Errorf("unexpected token: %v", Type(token))
+		}
+	}
+}
+
 func (parser Parser) tag() (TagExpression, error) {
 	token, err := parser.scanner.Next()
 	if err != nil {
@@ -256,7 +333,7 @@ func (parser Parser) value() (ValueExpression, error) {
 
 	switch typedToken := token.(type) {
 	case SymbolToken:
-		return ValueExpression{typedToken.name}, nil
+		return ValueExpression{Name: typedToken.name}, nil
 	default:
 		return ValueExpression{}, fmt.Errorf("unexpected token: %v", Type(token))
 	}
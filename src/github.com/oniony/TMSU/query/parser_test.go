@@ -377,6 +377,94 @@ func TestAndParenOrParsing(test *testing.T) {
 	validateTag(or.RightOperand, "sweetcorn", test)
 }
 
+func TestNotParenAndNotParsing(test *testing.T) {
+	scanner := NewScanner("not (cheese and not (tomato or sweetcorn))")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	not := validateNot(expression)
+	and := validateAnd(not.Operand)
+	validateTag(and.LeftOperand, "cheese", test)
+	innerNot := validateNot(and.RightOperand)
+	or := validateOr(innerNot.Operand)
+	validateTag(or.LeftOperand, "tomato", test)
+	validateTag(or.RightOperand, "sweetcorn", test)
+}
+
+func TestInParsing(test *testing.T) {
+	scanner := NewScanner("year in (2019, 2020,2021)")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	or := validateOr(expression)
+	innerOr := validateOr(or.LeftOperand)
+	for index, operand := range []Expression{innerOr.LeftOperand, innerOr.RightOperand, or.RightOperand} {
+		comparison := validateComparison(operand, "=", test)
+		validateTag(comparison.Tag, "year", test)
+		validateValue(comparison.Value, []string{"2019", "2020", "2021"}[index], test)
+	}
+}
+
+func TestInWithoutListParsing(test *testing.T) {
+	for _, text := range []string{"year in 2019", "year in ()", "year in (2019", "year in (2019 2020)"} {
+		if _, err := NewParser(NewScanner(text)).Parse(); err == nil {
+			test.Fatalf("Expected '%v' not to parse.", text)
+		}
+	}
+}
+
+func TestPatternMatchParsing(test *testing.T) {
+	scanner := NewScanner(`name~/^IMG_\d+/ and photo`)
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	and := validateAnd(expression)
+	comparison := validateComparison(and.LeftOperand, "~", test)
+	validateTag(comparison.Tag, "name", test)
+	validateValue(comparison.Value, `^IMG_\d+`, test)
+	validateTag(and.RightOperand, "photo", test)
+
+	if !comparison.IsPatternMatch() {
+		test.Fatal("Expected comparison to be a pattern match.")
+	}
+}
+
+func TestInvalidPatternParsing(test *testing.T) {
+	if _, err := NewParser(NewScanner("name~/[a/")).Parse(); err == nil {
+		test.Fatal("Expected invalid regular expression not to parse.")
+	}
+}
+
+func TestNumericValue(test *testing.T) {
+	for _, name := range []string{"2000", "-1", "2.5", "1e3"} {
+		if !(ValueExpression{Name: name}).IsNumeric() {
+			test.Fatalf("Expected '%v' to be numeric.", name)
+		}
+	}
+
+	for _, name := range []string{"", "abc", "2000s", "1.2.3"} {
+		if (ValueExpression{Name: name}).IsNumeric() {
+			test.Fatalf("Expected '%v' not to be numeric.", name)
+		}
+	}
+}
+
 // unexported
 
 func validateNot(expression Expression) NotExpression {
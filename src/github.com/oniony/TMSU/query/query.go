@@ -17,8 +17,12 @@ package query
 
 import (
 	"fmt"
+	"strings"
 )
 
+// The prefix of a tag name by which a query refers to a saved view, e.g. 'view:recent-photos'
+const ViewPrefix = "view:"
+
 func Parse(query string) (Expression, error) {
 	scanner := NewScanner(query)
 	parser := NewParser(scanner)
@@ -48,14 +52,194 @@ func TagNames(expression Expression) ([]string, error) {
 }
 
 // Retrieves the set of value names from an expression where the name is matched on exactly
+// (numeric values are compared numerically and so are excluded)
 func ExactValueNames(expression Expression) ([]string, error) {
 	names := make([]string, 0, 10)
 
 	return exactValueNames(expression, names)
 }
 
+// Retrieves the value names compared against the specified tag within an expression
+func ComparedValueNames(expression Expression, tagName string) []string {
+	switch exp := expression.(type) {
+	case NotExpression:
+		return ComparedValueNames(exp.Operand, tagName)
+	case AndExpression:
+		return append(ComparedValueNames(exp.LeftOperand, tagName), ComparedValueNames(exp.RightOperand, tagName)...)
+	case OrExpression:
+		return append(ComparedValueNames(exp.LeftOperand, tagName), ComparedValueNames(exp.RightOperand, tagName)...)
+	case ComparisonExpression:
+		if exp.Tag.Name == tagName {
+			return []string{exp.Value.Name}
+		}
+	}
+
+	return nil
+}
+
+// Creates a copy of an expression with each tag name replaced by the result of the mapping function
+func MapTagNames(expression Expression, mapping func(string) string) Expression {
+	switch exp := expression.(type) {
+	case TagExpression:
+		return TagExpression{mapping(exp.Name)}
+	case NotExpression:
+		return NotExpression{MapTagNames(exp.Operand, mapping)}
+	case AndExpression:
+		return AndExpression{MapTagNames(exp.LeftOperand, mapping), MapTagNames(exp.RightOperand, mapping)}
+	case OrExpression:
+		return OrExpression{MapTagNames(exp.LeftOperand, mapping), MapTagNames(exp.RightOperand, mapping)}
+	case ComparisonExpression:
+		return ComparisonExpression{TagExpression{mapping(exp.Tag.Name)}, exp.Operator, exp.Value}
+	}
+
+	return expression
+}
+
+// Creates a copy of an expression with each tag, other than those within comparisons, replaced by the result of the
+// mapping function
+func MapTags(expression Expression, mapping func(TagExpression) Expression) Expression {
+	switch exp := expression.(type) {
+	case TagExpression:
+		return mapping(exp)
+	case NotExpression:
+		return NotExpression{MapTags(exp.Operand, mapping)}
+	case AndExpression:
+		return AndExpression{MapTags(exp.LeftOperand, mapping), MapTags(exp.RightOperand, mapping)}
+	case OrExpression:
+		return OrExpression{MapTags(exp.LeftOperand, mapping), MapTags(exp.RightOperand, mapping)}
+	}
+
+	return expression
+}
+
+// Creates a copy of an expression with each comparison replaced by the result of the mapping function
+func MapComparisons(expression Expression, mapping func(ComparisonExpression) (ComparisonExpression, error)) (Expression, error) {
+	switch exp := expression.(type) {
+	case NotExpression:
+		operand, err := MapComparisons(exp.Operand, mapping)
+		if err != nil {
+			return nil, err
+		}
+
+		return NotExpression{operand}, nil
+	case AndExpression:
+		left, right, err := mapComparisonOperands(exp.LeftOperand, exp.RightOperand, mapping)
+		if err != nil {
+			return nil, err
+		}
+
+		return AndExpression{left, right}, nil
+	case OrExpression:
+		left, right, err := mapComparisonOperands(exp.LeftOperand, exp.RightOperand, mapping)
+		if err != nil {
+			return nil, err
+		}
+
+		return OrExpression{left, right}, nil
+	case ComparisonExpression:
+		comparison, err := mapping(exp)
+		if err != nil {
+			return nil, err
+		}
+
+		return comparison, nil
+	}
+
+	return expression, nil
+}
+
+// Creates a copy of an expression with each reference to a view, a tag named 'view:NAME', replaced by the query
+// of the view, itself expanded, as retrieved by the lookup function. References to views that the lookup function
+// does not find are left as tags.
+func ExpandViews(expression Expression, lookup func(name string) (string, bool, error)) (Expression, error) {
+	return expandViews(expression, lookup, nil)
+}
+
 // unexported
 
+func expandViews(expression Expression, lookup func(name string) (string, bool, error), expanding []string) (Expression, error) {
+	switch exp := expression.(type) {
+	case TagExpression:
+		if !strings.HasPrefix(exp.Name, ViewPrefix) {
+			return exp, nil
+		}
+
+		name := exp.Name[len(ViewPrefix):]
+		queryText, found, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return exp, nil
+		}
+
+		// a copy so that the expansion of each operand is tracked separately
+		expanding = append(expanding[:len(expanding):len(expanding)], name)
+		for _, expandingName := range expanding[:len(expanding)-1] {
+			if expandingName == name {
+				return nil, fmt.Errorf("view '%v' refers to itself: %v", name, strings.Join(expanding, " -> "))
+			}
+		}
+
+		viewExpression, err := Parse(queryText)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse query of view '%v': %w", name, err)
+		}
+		if _, empty := viewExpression.(EmptyExpression); empty {
+			return nil, fmt.Errorf("view '%v' cannot be referenced as its query is empty", name)
+		}
+
+		return expandViews(viewExpression, lookup, expanding)
+	case NotExpression:
+		operand, err := expandViews(exp.Operand, lookup, expanding)
+		if err != nil {
+			return nil, err
+		}
+
+		return NotExpression{operand}, nil
+	case AndExpression:
+		left, err := expandViews(exp.LeftOperand, lookup, expanding)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := expandViews(exp.RightOperand, lookup, expanding)
+		if err != nil {
+			return nil, err
+		}
+
+		return AndExpression{left, right}, nil
+	case OrExpression:
+		left, err := expandViews(exp.LeftOperand, lookup, expanding)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := expandViews(exp.RightOperand, lookup, expanding)
+		if err != nil {
+			return nil, err
+		}
+
+		return OrExpression{left, right}, nil
+	}
+
+	return expression, nil
+}
+
+func mapComparisonOperands(left, right Expression, mapping func(ComparisonExpression) (ComparisonExpression, error)) (Expression, Expression, error) {
+	left, err := MapComparisons(left, mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	right, err = MapComparisons(right, mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return left, right, nil
+}
+
 func tagNames(expression Expression, names []string) ([]string, error) {
 	var err error
 
@@ -134,8 +318,10 @@ func exactValueNames(expression Expression, names []string) ([]string, error) {
 	case ComparisonExpression:
 		switch exp.Operator {
 		case "=", "==", "!=":
-			names = append(names, exp.Value.Name)
-		case "<", ">", "<=", ">=":
+			if !exp.Value.IsNumeric() {
+				names = append(names, exp.Value.Name)
+			}
+		case "<", ">", "<=", ">=", "~", "!~", "like":
 			// do nowt
 		default:
 			return nil, fmt.Errorf("unsupported operator '%v'", exp.Operator)
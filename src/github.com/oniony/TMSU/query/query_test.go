@@ -0,0 +1,72 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandViews(test *testing.T) {
+	views := map[string]string{"recent": "year >= 2020", "recent-photos": "photo and view:recent"}
+
+	expression, err := Parse("view:recent-photos and not archived and view:missing")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expanded, err := ExpandViews(expression, viewLookup(views))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := AndExpression{
+		AndExpression{
+			AndExpression{TagExpression{"photo"}, ComparisonExpression{TagExpression{"year"}, ">=", ValueExpression{"2020", ""}}},
+			NotExpression{TagExpression{"archived"}}},
+		TagExpression{"view:missing"}}
+
+	if !reflect.DeepEqual(expanded, expected) {
+		test.Fatalf("Expected %v but was %v.", expected, expanded)
+	}
+}
+
+func TestExpandViewsRefusesCycle(test *testing.T) {
+	views := map[string]string{"a": "cheese or view:b", "b": "wine and view:a"}
+
+	expression, err := Parse("view:a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	_, err = ExpandViews(expression, viewLookup(views))
+	if err == nil {
+		test.Fatal("Expected an error for views that refer to one another.")
+	}
+	if !strings.Contains(err.Error(), "a -> b -> a") {
+		test.Fatalf("Expected the error to describe the cycle but was '%v'.", err)
+	}
+}
+
+// unexported
+
+func viewLookup(views map[string]string) func(string) (string, bool, error) {
+	return func(name string) (string, bool, error) {
+		queryText, found := views[name]
+		return queryText, found, nil
+	}
+}
@@ -22,7 +22,8 @@ import (
 	"unicode"
 )
 
-var symbolChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol}
+// marks are accepted for the combining accents of decomposed Unicode text
+var symbolChars = []*unicode.RangeTable{unicode.Letter, unicode.Mark, unicode.Number, unicode.Punct, unicode.Symbol}
 
 type Token interface {
 }
@@ -43,6 +44,10 @@ func Type(token Token) string {
 		return "'or'"
 	case ComparisonOperatorToken:
 		return typedToken.operator
+	case InOperatorToken:
+		return "'in'"
+	case CommaToken:
+		return "','"
 	case EndToken:
 		return "EOF"
 	case nil:
@@ -78,13 +83,23 @@ type ComparisonOperatorToken struct {
 	operator string
 }
 
+type InOperatorToken struct {
+}
+
+type CommaToken struct {
+}
+
 type Scanner struct {
-	stream    *strings.Reader
-	lookAhead Token
+	stream     *strings.Reader
+	lookAhead  Token
+	afterIn    bool // the previous token was 'in'
+	inList     bool // within the parenthesized list following 'in', where ',' separates the values
+	afterMatch bool // the previous token was '~' or '!~', which may be followed by a /pattern/
+	afterLike  bool // the previous token was 'like', which may be followed by a 'quoted' pattern
 }
 
 func NewScanner(query string) *Scanner {
-	return &Scanner{strings.NewReader(query), nil}
+	return &Scanner{strings.NewReader(query), nil, false, false, false, false}
 }
 
 func (scanner *Scanner) LookAhead() (Token, error) {
@@ -129,11 +144,29 @@ func (scanner *Scanner) readToken() (Token, error) {
 		return nil, err
 	}
 
+	afterIn := scanner.afterIn
+	scanner.afterIn = false
+	afterMatch := scanner.afterMatch
+	scanner.afterMatch = false
+	afterLike := scanner.afterLike
+	scanner.afterLike = false
+
 	switch {
+	case r == rune('/') && afterMatch:
+		return scanner.readPatternToken()
+	case r == rune('\'') && afterLike:
+		return scanner.readQuotedToken()
+	case r == rune('~'):
+		scanner.afterMatch = true
+		return ComparisonOperatorToken{"~"}, nil
 	case r == rune('('):
+		scanner.inList = afterIn
 		return OpenParenToken{}, nil
 	case r == rune(')'):
+		scanner.inList = false
 		return CloseParenToken{}, nil
+	case r == rune(',') && scanner.inList:
+		return CommaToken{}, nil
 	case r == rune('!'), r == rune('='), r == rune('<'), r == rune('>'):
 		return scanner.readComparisonOperatorToken(r)
 	case unicode.IsOneOf(symbolChars, r), r == rune('\\'):
@@ -145,11 +178,17 @@ func (scanner *Scanner) readToken() (Token, error) {
 }
 
 func (scanner *Scanner) readTextToken() (Token, error) {
-	text, err := scanner.readString()
+	text, literal, err := scanner.readString()
 	if err != nil {
 		return nil, err
 	}
 
+	// escaping any character, e.g. '\in', makes the word a tag or value name such
+	// as one created before the word became an operator
+	if literal {
+		return SymbolToken{text}, nil
+	}
+
 	switch text {
 	case "not", "NOT":
 		return NotOperatorToken{}, nil
@@ -169,6 +208,12 @@ func (scanner *Scanner) readTextToken() (Token, error) {
 		return ComparisonOperatorToken{"<="}, nil
 	case "ge", "GE":
 		return ComparisonOperatorToken{">="}, nil
+	case "like", "LIKE":
+		scanner.afterLike = true
+		return ComparisonOperatorToken{"like"}, nil
+	case "in", "IN":
+		scanner.afterIn = true
+		return InOperatorToken{}, nil
 	}
 
 	return SymbolToken{text}, nil
@@ -182,9 +227,12 @@ func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 			return nil, err
 		}
 
-		switch r2 {
-		case rune('='):
+		switch {
+		case r2 == rune('='):
 			return ComparisonOperatorToken{string(r) + "="}, nil
+		case r2 == rune('~') && r == rune('!'):
+			scanner.afterMatch = true
+			return ComparisonOperatorToken{"!~"}, nil
 		default:
 			scanner.stream.UnreadRune()
 			return ComparisonOperatorToken{string(r)}, nil
@@ -194,18 +242,81 @@ func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 	}
 }
 
-func (scanner *Scanner) readString() (string, error) {
+// reads a regular expression delimited by '/', within which '\/' stands for '/'
+// and any other backslash is retained as a part of the pattern
+func (scanner *Scanner) readPatternToken() (Token, error) {
+	pattern := ""
+	escaped := false
+
+	for {
+		r, _, err := scanner.stream.ReadRune()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unterminated regular expression '/%v'", pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case escaped:
+			if r != rune('/') {
+				pattern += "\\"
+			}
+			pattern += string(r)
+			escaped = false
+		case r == rune('\\'):
+			escaped = true
+		case r == rune('/'):
+			return SymbolToken{pattern}, nil
+		default:
+			pattern += string(r)
+		}
+	}
+}
+
+// reads text delimited by single quotes, within which a backslash escapes the
+// following character, so that a pattern may contain spaces or parentheses
+func (scanner *Scanner) readQuotedToken() (Token, error) {
+	text := ""
+	escaped := false
+
+	for {
+		r, _, err := scanner.stream.ReadRune()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unterminated quoted text '%v", text)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case escaped:
+			text += string(r)
+			escaped = false
+		case r == rune('\\'):
+			escaped = true
+		case r == rune('\''):
+			return SymbolToken{text}, nil
+		default:
+			text += string(r)
+		}
+	}
+}
+
+// reads text up to the next delimiter, reporting whether any of it was escaped
+func (scanner *Scanner) readString() (string, bool, error) {
 	text := ""
 	escaped := false
+	literal := false
 	stop := false
 
 	for !stop {
 		r, _, err := scanner.stream.ReadRune()
 		if err == io.EOF {
-			return text, nil
+			return text, literal, nil
 		}
 		if err != nil {
-			return "", err
+			return "", false, err
 		}
 
 		if escaped {
@@ -216,17 +327,18 @@ func (scanner *Scanner) readString() (string, error) {
 
 		if r == rune('\\') {
 			escaped = true
+			literal = true
 			continue
 		}
 
 		switch {
-		case unicode.IsSpace(r), r == rune(')'), r == rune('('), r == rune('='), r == rune('!'), r == rune('<'), r == rune('>'):
+		case unicode.IsSpace(r), r == rune(')'), r == rune('('), r == rune('='), r == rune('!'), r == rune('<'), r == rune('>'), r == rune('~'), r == rune(',') && scanner.inList:
 			scanner.stream.UnreadRune()
-			return text, nil
+			return text, literal, nil
 		case unicode.IsOneOf(symbolChars, r):
 			text += string(r)
 		default:
-			return "", fmt.Errorf("Unexpected character '%v'.", r)
+			return "", false, fmt.Errorf("Unexpected character '%v'.", r)
 		}
 	}
 
@@ -202,6 +202,194 @@ func TestComplexQuery(test *testing.T) {
 	validateEnd(token, test)
 }
 
+func TestInList(test *testing.T) {
+	scanner := NewScanner("a,b in (c,d)")
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "a,b", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateInOperator(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateOpenParen(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "c", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComma(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "d", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateCloseParen(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateEnd(token, test)
+}
+
+func TestEscapedOperatorNames(test *testing.T) {
+	scanner := NewScanner(`\in=\like and i\n`)
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "in", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "=", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "like", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateAndOperator(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "in", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateEnd(token, test)
+}
+
+func TestPatternMatch(test *testing.T) {
+	scanner := NewScanner(`name~/^IMG_\d+ \/x/ and artist !~ /^The/`)
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "name", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "~", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, `^IMG_\d+ /x`, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateAndOperator(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "artist", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "!~", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "^The", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateEnd(token, test)
+}
+
+func TestUnterminatedPattern(test *testing.T) {
+	scanner := NewScanner("name~/^IMG")
+
+	if _, err := scanner.Next(); err == nil {
+		if _, err := scanner.Next(); err == nil {
+			test.Fatal("Expected unterminated pattern not to scan.")
+		}
+	}
+}
+
+func TestLikeOperator(test *testing.T) {
+	scanner := NewScanner(`prop:source-url like '%flickr (photos)%' and photo`)
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "prop:source-url", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "like", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "%flickr (photos)%", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateAndOperator(token, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "photo", test)
+}
+
 // unexported
 
 func validateSymbolToken(token Token, expectedName string, test *testing.T) {
@@ -249,6 +437,24 @@ func validateComparisonOperator(token Token, operator string, test *testing.T) {
 	}
 }
 
+func validateInOperator(token Token, test *testing.T) {
+	switch token.(type) {
+	case InOperatorToken:
+		return
+	default:
+		test.Fatalf("Expected 'in' operator but was '%v'.", token)
+	}
+}
+
+func validateComma(token Token, test *testing.T) {
+	switch token.(type) {
+	case CommaToken:
+		return
+	default:
+		test.Fatalf("Expected ',' but was '%v'.", token)
+	}
+}
+
 func validateOpenParen(token Token, test *testing.T) {
 	switch token.(type) {
 	case OpenParenToken:
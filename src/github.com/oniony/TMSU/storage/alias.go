@@ -0,0 +1,136 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage/database"
+	"strings"
+)
+
+// Retrieves the complete set of tag aliases.
+func (storage *Storage) Aliases(tx *Tx) (entities.Aliases, error) {
+	return database.Aliases(tx.tx)
+}
+
+// Retrieves the set of aliases for the specified tag.
+func (storage *Storage) AliasesByTagId(tx *Tx, tagId entities.TagId) (entities.Aliases, error) {
+	return database.AliasesByTagId(tx.tx, tagId)
+}
+
+// Retrieves a specific alias.
+func (storage *Storage) AliasByName(tx *Tx, name string) (*entities.Alias, error) {
+	return database.AliasByName(tx.tx, name, false)
+}
+
+// Adds an alias for a tag.
+func (storage *Storage) AddAlias(tx *Tx, name string, tag entities.Tag) (*entities.Alias, error) {
+	if err := entities.ValidateTagName(name); err != nil {
+		return nil, err
+	}
+
+	if err := storage.checkNameUnused(tx, name); err != nil {
+		return nil, err
+	}
+
+	return database.InsertAlias(tx.tx, name, tag)
+}
+
+// Deletes an alias.
+func (storage *Storage) DeleteAlias(tx *Tx, name string) error {
+	return database.DeleteAlias(tx.tx, name)
+}
+
+// Deletes the aliases for the specified tag.
+func (storage *Storage) DeleteAliasesByTagId(tx *Tx, tagId entities.TagId) error {
+	return database.DeleteAliasesByTagId(tx.tx, tagId)
+}
+
+// Retrieves a specific tag by its name or by one of its aliases.
+func (storage *Storage) TagByNameOrAlias(tx *Tx, name string) (*entities.Tag, error) {
+	tag, err := storage.TagByName(tx, name)
+	if err != nil || tag != nil {
+		return tag, err
+	}
+
+	alias, err := storage.AliasByName(tx, name)
+	if err != nil || alias == nil {
+		return nil, err
+	}
+
+	return &alias.Tag, nil
+}
+
+// Replaces any aliases in the specified query expression with the names of the tags they refer to.
+func (storage *Storage) ResolveAliases(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	aliases, err := storage.Aliases(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(aliases) == 0 {
+		return expression, nil
+	}
+
+	tagNamesByAlias := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		tagNamesByAlias[aliasKey(alias.Name, ignoreCase)] = alias.Tag.Name
+	}
+
+	return query.MapTagNames(expression, func(name string) string {
+		if tagName, ok := tagNamesByAlias[aliasKey(name, ignoreCase)]; ok {
+			return tagName
+		}
+
+		return name
+	}), nil
+}
+
+// unexported
+
+func (storage *Storage) checkNameUnused(tx *Tx, name string) error {
+	tag, err := database.TagByName(tx.tx, name, false)
+	if err != nil {
+		return err
+	}
+	if tag != nil {
+		return fmt.Errorf("a tag named '%v' already exists", name)
+	}
+
+	return storage.checkAliasUnused(tx, name)
+}
+
+func (storage *Storage) checkAliasUnused(tx *Tx, name string) error {
+	alias, err := database.AliasByName(tx.tx, name, false)
+	if err != nil {
+		return err
+	}
+	if alias != nil {
+		return fmt.Errorf("'%v' is already an alias of tag '%v'", name, alias.Tag.Name)
+	}
+
+	return nil
+}
+
+func aliasKey(name string, ignoreCase bool) string {
+	if ignoreCase {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
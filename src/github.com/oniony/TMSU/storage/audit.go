@@ -0,0 +1,210 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The name of the file beside the database to which changes are logged when the
+// 'auditLog' setting is enabled.
+const AuditLogName = "log"
+
+// A change made to the database, as recorded in the audit log.
+type AuditEntry struct {
+	Time    time.Time                     `json:"time"`
+	User    string                        `json:"user,omitempty"`
+	Command string                        `json:"command"`
+	Changes map[string]database.RowCounts `json:"changes"`
+}
+
+// The path of the audit log of the database at the path.
+func AuditLogPath(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), AuditLogName)
+}
+
+// Reads the entries of the audit log of the database at the path, oldest first.
+// There are no entries if changes have never been logged.
+func ReadAuditLog(dbPath string) ([]AuditEntry, error) {
+	path := AuditLogPath(dbPath)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]AuditEntry, 0, 10)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%v:%v: could not parse entry: %w", path, lineNumber, err)
+		}
+
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// unexported
+
+// determines whether the changes made are to be logged, which they are only
+// when the setting is enabled for a database held in a local file
+func (tx *Tx) auditing() (bool, error) {
+	if tx.auditLog == "" {
+		tx.auditLog = "no"
+
+		if _, err := os.Stat(tx.storage.DbPath); err == nil && !IsPostgres(tx.storage.DbPath) {
+			settings, err := tx.storage.Settings(tx)
+			if err != nil {
+				return false, err
+			}
+
+			if settings.AuditLog() {
+				tx.auditLog = "yes"
+			}
+		}
+	}
+
+	return tx.auditLog == "yes", nil
+}
+
+// notes the reversal of an operation, which is logged against the command
+// specified once the transaction is committed
+func (tx *Tx) auditUndo(operationId entities.OperationId, command string) error {
+	auditing, err := tx.auditing()
+	if err != nil || !auditing {
+		return err
+	}
+
+	changes, err := database.OperationChanges(tx.tx, operationId)
+	if err != nil {
+		return err
+	}
+
+	// undoing an operation reverses its insertions and deletions
+	if count := len(tx.auditEntries); count == 0 || tx.auditEntries[count-1].Command != command {
+		tx.auditEntries = append(tx.auditEntries, AuditEntry{time.Now(), tx.storage.user, command, make(map[string]database.RowCounts)})
+	}
+	entry := tx.auditEntries[len(tx.auditEntries)-1]
+	for table, counts := range changes {
+		total := entry.Changes[table]
+		total.Inserted += counts.Deleted
+		total.Updated += counts.Updated
+		total.Deleted += counts.Inserted
+		entry.Changes[table] = total
+	}
+
+	return nil
+}
+
+// the entries to log for the changes made within the transaction, determined
+// before the open operations are ended
+func (tx *Tx) pendingAuditEntries() ([]AuditEntry, error) {
+	if !tx.operationOpen && len(tx.auditEntries) == 0 {
+		return nil, nil
+	}
+
+	auditing, err := tx.auditing()
+	if err != nil || !auditing {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(tx.auditEntries)+1)
+	for _, entry := range tx.auditEntries {
+		if len(entry.Changes) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	if tx.operationOpen {
+		operations, err := database.OpenOperations(tx.tx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, operation := range operations {
+			changes, err := database.OperationChanges(tx.tx, operation.Id)
+			if err != nil {
+				return nil, err
+			}
+			if len(changes) == 0 {
+				continue
+			}
+
+			entries = append(entries, AuditEntry{time.Now(), tx.storage.user, operation.Command, changes})
+		}
+	}
+
+	return entries, nil
+}
+
+// appends the entries to the audit log of the database, warning if they cannot
+// be written as the changes to the database have by now been committed
+func appendAuditLog(dbPath string, entries []AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	path := AuditLogPath(dbPath)
+
+	var buffer []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			log.Warnf("%v: could not encode audit log entry: %v", path, err)
+			return
+		}
+
+		buffer = append(append(buffer, line...), '\n')
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Warnf("%v: could not open audit log: %v", path, err)
+		return
+	}
+
+	if _, err := file.Write(buffer); err != nil {
+		log.Warnf("%v: could not write audit log: %v", path, err)
+	}
+	if err := file.Close(); err != nil {
+		log.Warnf("%v: could not close audit log: %v", path, err)
+	}
+}
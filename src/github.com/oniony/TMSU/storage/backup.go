@@ -0,0 +1,160 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/storage/database"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The directory, beside the database, to which the database is backed up.
+const BackupDirectoryName = "backups"
+
+// the format of the timestamps by which backups are named and identified
+const backupTimestampFormat = "20060102T150405.000Z"
+
+// A copy of the database.
+type Backup struct {
+	Timestamp string
+	Path      string
+	Time      time.Time
+	Size      int64
+}
+
+// The directory to which the database at the path is backed up.
+func BackupDirectory(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), BackupDirectoryName)
+}
+
+// Backs up the database at the path to its backup directory, then removes all
+// but the latest backups up to the retention, unless this is zero.
+func BackupAt(dbPath string, retention uint) (*Backup, error) {
+	directory := BackupDirectory(dbPath)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("could not create backup directory '%v': %w", directory, err)
+	}
+
+	now := time.Now().UTC()
+	timestamp := now.Format(backupTimestampFormat)
+	path := filepath.Join(directory, backupPrefix(dbPath)+timestamp)
+
+	// the database was already backed up within the same millisecond
+	if _, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		if err := database.BackupAt(dbPath, path); err != nil {
+			return nil, err
+		}
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if retention > 0 {
+		if err := pruneBackups(dbPath, retention); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Backup{timestamp, path, now, stat.Size()}, nil
+}
+
+// The backups of the database at the path, oldest first.
+func BackupsAt(dbPath string) ([]*Backup, error) {
+	entries, err := ioutil.ReadDir(BackupDirectory(dbPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Backup{}, nil
+		}
+
+		return nil, err
+	}
+
+	prefix := backupPrefix(dbPath)
+
+	backups := make([]*Backup, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+
+		timestamp := strings.TrimPrefix(entry.Name(), prefix)
+		backupTime, err := time.Parse(backupTimestampFormat, timestamp)
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(BackupDirectory(dbPath), entry.Name())
+		backups = append(backups, &Backup{timestamp, path, backupTime, entry.Size()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.Before(backups[j].Time)
+	})
+
+	return backups, nil
+}
+
+// Replaces the database at the path with its backup with the timestamp.
+func RestoreAt(dbPath, timestamp string) error {
+	backups, err := BackupsAt(dbPath)
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups {
+		if backup.Timestamp == timestamp {
+			return database.RestoreAt(dbPath, backup.Path)
+		}
+	}
+
+	return fmt.Errorf("no backup '%v'", timestamp)
+}
+
+// unexported
+
+// backups are named for the database so that databases sharing a directory
+// do not share backups
+func backupPrefix(dbPath string) string {
+	return filepath.Base(dbPath) + "-"
+}
+
+func pruneBackups(dbPath string, retention uint) error {
+	backups, err := BackupsAt(dbPath)
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > int(retention) {
+		if err := os.Remove(backups[0].Path); err != nil {
+			return err
+		}
+
+		backups = backups[1:]
+	}
+
+	return nil
+}
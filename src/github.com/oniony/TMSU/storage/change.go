@@ -0,0 +1,107 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// The kinds of change recorded when tracking changes.
+const (
+	FileTagged   = "tagged"
+	FileUntagged = "untagged"
+	FileUpdated  = "updated"
+	FileDeleted  = "deleted"
+)
+
+// A change made to a file or to the tags applied to it.
+type Change struct {
+	Kind    string
+	Path    string
+	OldPath string
+	Tag     string
+	Value   string
+}
+
+// Starts recording the changes made by the transactions subsequently committed.
+func (storage *Storage) TrackChanges() {
+	storage.tracking = true
+}
+
+// Retrieves the changes recorded since changes were last retrieved.
+func (storage *Storage) TakeChanges() []Change {
+	changes := storage.changes
+	storage.changes = nil
+
+	return changes
+}
+
+// unexported
+
+func (storage *Storage) recordFileTagChange(tx *Tx, kind string, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	if !storage.tracking {
+		return nil
+	}
+
+	file, err := database.File(tx.tx, fileId)
+	if err != nil || file == nil {
+		return err
+	}
+	storage.absPath(file)
+
+	tag, err := database.Tag(tx.tx, tagId)
+	if err != nil || tag == nil {
+		return err
+	}
+
+	valueName := ""
+	if valueId != 0 {
+		value, err := database.Value(tx.tx, valueId)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			valueName = value.Name
+		}
+	}
+
+	tx.changes = append(tx.changes, Change{Kind: kind, Path: file.Path(), Tag: tag.Name, Value: valueName})
+
+	return nil
+}
+
+// records the change to a file that is about to be updated, to the path specified, or deleted
+func (storage *Storage) recordFileChange(tx *Tx, kind string, fileId entities.FileId, path string) error {
+	if !storage.tracking {
+		return nil
+	}
+
+	file, err := database.File(tx.tx, fileId)
+	if err != nil || file == nil {
+		return err
+	}
+	storage.absPath(file)
+
+	change := Change{Kind: kind, Path: file.Path()}
+	if kind == FileUpdated && path != file.Path() {
+		change.Path, change.OldPath = path, file.Path()
+	}
+
+	tx.changes = append(tx.changes, change)
+
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/common/log"
+	"io/ioutil"
+)
+
+// Writes a consistent copy of the database at the path to the backup path,
+// which must not exist. An encrypted database is copied as it is stored so
+// that the backup remains encrypted.
+func BackupAt(path, backupPath string) error {
+	log.Infof(2, "backing up database at '%v' to '%v'.", path, backupPath)
+
+	encrypted, err := IsEncrypted(path)
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	if encrypted {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return DatabaseAccessError{path, err}
+		}
+
+		return writeFileAtomically(backupPath, data)
+	}
+
+	db, err := sql.Open(sqliteDriverName, dataSourceName(path))
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+	defer db.Close()
+
+	// unlike copying the file this includes the changes still in the write-ahead log
+	if _, err := db.Exec("VACUUM INTO ?", backupPath); err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	return nil
+}
+
+// Replaces the database at the path with the backup at the backup path.
+func RestoreAt(path, backupPath string) error {
+	log.Infof(2, "restoring database at '%v' from '%v'.", path, backupPath)
+
+	data, err := ioutil.ReadFile(backupPath)
+	if err != nil {
+		return DatabaseAccessError{backupPath, err}
+	}
+
+	if err := writeFileAtomically(path, data); err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	return nil
+}
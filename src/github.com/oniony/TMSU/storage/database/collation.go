@@ -0,0 +1,64 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/oniony/TMSU/common/collation"
+)
+
+// the prefix of the names of the collations registered with SQLite
+const collationPrefix = "tmsu_"
+
+// Retrieves the collator with which names are sorted, as per the 'collation'
+// setting.
+func Collator(tx *Tx) (*collation.Collator, error) {
+	setting, err := Setting(tx, "collation")
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	switch {
+	case setting != nil:
+		name = setting.Value
+	case tx.database != nil && tx.database.collation != "":
+		name = tx.database.collation
+	default:
+		return collation.Binary, nil
+	}
+
+	collator, err := collation.New(name)
+	if err != nil {
+		return collation.Binary, nil
+	}
+
+	return collator, nil
+}
+
+// unexported
+
+// the clause with which names are ordered by the configured collation
+func sortCollation(tx *Tx) (string, error) {
+	collator, err := Collator(tx)
+	if err != nil {
+		return "", err
+	}
+	if collator == collation.Binary {
+		return "", nil
+	}
+
+	return " COLLATE " + collationPrefix + collator.Name, nil
+}
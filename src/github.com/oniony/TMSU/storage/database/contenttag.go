@@ -0,0 +1,146 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the tags applied to the content with the specified fingerprint.
+func ContentTags(tx *Tx, fingerprint fingerprint.Fingerprint) (entities.TagIdValueIdPairs, error) {
+	sql := `
+SELECT tag_id, value_id
+FROM content_tag
+WHERE fingerprint = ?1
+ORDER BY tag_id, value_id`
+
+	rows, err := tx.Query(sql, string(fingerprint))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readContentTags(rows, make(entities.TagIdValueIdPairs, 0, 10))
+}
+
+// Retrieves the count of content tags in the database.
+func ContentTagCount(tx *Tx) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM content_tag`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Applies a tag to the content with the specified fingerprint.
+func AddContentTag(tx *Tx, fingerprint fingerprint.Fingerprint, tagId entities.TagId, valueId entities.ValueId) error {
+	sql := `
+INSERT OR IGNORE INTO content_tag (fingerprint, tag_id, value_id)
+VALUES (?1, ?2, ?3)`
+
+	_, err := tx.Exec(sql, string(fingerprint), tagId, valueId)
+	return err
+}
+
+// Removes a tag from the content with the specified fingerprint.
+func DeleteContentTag(tx *Tx, fingerprint fingerprint.Fingerprint, tagId entities.TagId, valueId entities.ValueId) error {
+	sql := `
+DELETE FROM content_tag
+WHERE fingerprint = ?1 AND tag_id = ?2 AND value_id = ?3`
+
+	_, err := tx.Exec(sql, string(fingerprint), tagId, valueId)
+	return err
+}
+
+// Removes the specified tag from all content.
+func DeleteContentTagsByTagId(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM content_tag
+WHERE tag_id = ?1`
+
+	_, err := tx.Exec(sql, tagId)
+	return err
+}
+
+// Removes the specified value from all content.
+func DeleteContentTagsByValueId(tx *Tx, valueId entities.ValueId) error {
+	sql := `
+DELETE FROM content_tag
+WHERE value_id = ?1`
+
+	_, err := tx.Exec(sql, valueId)
+	return err
+}
+
+// Copies content tags from one tag to another.
+func CopyContentTags(tx *Tx, sourceTagId entities.TagId, destTagId entities.TagId) error {
+	sql := `
+INSERT OR IGNORE INTO content_tag (fingerprint, tag_id, value_id)
+SELECT fingerprint, ?2, value_id
+FROM content_tag
+WHERE tag_id = ?1`
+
+	_, err := tx.Exec(sql, sourceTagId, destTagId)
+	return err
+}
+
+// Replaces the value of the specified tag within the content tags.
+func ReplaceContentTagValue(tx *Tx, tagId entities.TagId, valueId, newValueId entities.ValueId) error {
+	sql := `
+INSERT OR IGNORE INTO content_tag (fingerprint, tag_id, value_id)
+SELECT fingerprint, tag_id, ?3
+FROM content_tag
+WHERE tag_id = ?1 AND value_id = ?2`
+
+	if _, err := tx.Exec(sql, tagId, valueId, newValueId); err != nil {
+		return err
+	}
+
+	sql = `
+DELETE FROM content_tag
+WHERE tag_id = ?1 AND value_id = ?2`
+
+	_, err := tx.Exec(sql, tagId, valueId)
+	return err
+}
+
+// helpers
+
+func readContentTags(rows *sql.Rows, pairs entities.TagIdValueIdPairs) (entities.TagIdValueIdPairs, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var tagId entities.TagId
+		var valueId entities.ValueId
+		if err := rows.Scan(&tagId, &valueId); err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, entities.TagIdValueIdPair{tagId, valueId})
+	}
+
+	return pairs, nil
+}
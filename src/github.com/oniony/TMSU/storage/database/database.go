@@ -18,24 +18,34 @@ package database
 import (
 	"database/sql"
 	"errors"
-	_ "github.com/mattn/go-sqlite3" // initialised Sqlite3
+	"fmt"
 	"github.com/oniony/TMSU/common/log"
 	"os"
+	"time"
 )
 
+// How long a connection waits for another process's lock to be released, such
+// as the write lock held whilst a large recursive tagging is applied.
+var BusyTimeout = 60 * time.Second
+
 type Database struct {
-	db *sql.DB
+	db         *sql.DB
+	encryption *encryption
+	readOnly   bool
+	collation  string // the collation used unless otherwise set in the database
 }
 
 func CreateAt(path string) error {
 	log.Infof(2, "creating database at '%v'.", path)
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open(sqliteDriverName, dataSourceName(path))
 	if err != nil {
 		return DatabaseAccessError{path, err}
 	}
 	defer db.Close()
 
+	useWriteAheadLog(db)
+
 	tx, err := db.Begin()
 	if err != nil {
 		return DatabaseTransactionError{path, err}
@@ -53,60 +63,86 @@ func CreateAt(path string) error {
 }
 
 func OpenAt(path string) (*Database, error) {
-	log.Infof(2, "opening database at '%v'.", path)
-
-	_, err := os.Stat(path)
-	if err != nil {
-		switch {
-		case os.IsNotExist(err):
-			return nil, DatabaseNotFoundError{path}
-		default:
-			return nil, DatabaseAccessError{path, err}
-		}
-	}
+	return openAt(path, true)
+}
 
-	db, err := sql.Open("sqlite3", path)
+// Opens the database at the path, refusing any change to it. The schema is not
+// migrated and so must already be the latest. The passphrase is only required
+// if the database is encrypted.
+func OpenReadOnlyAt(path, passphrase string) (*Database, error) {
+	database, err := openUnmigratedAt(path, passphrase)
 	if err != nil {
-		return nil, DatabaseAccessError{path, err}
+		return nil, err
 	}
 
-	tx, err := db.Begin()
+	tx, err := database.Begin()
 	if err != nil {
+		database.Close()
 		return nil, DatabaseTransactionError{path, err}
 	}
 
-	if err := upgrade(tx); err != nil {
+	version, err := checkSchemaVersion(tx.tx)
+	tx.Rollback()
+	if err != nil {
+		database.Close()
 		return nil, err
 	}
-
-	if err := tx.Commit(); err != nil {
-		return nil, DatabaseTransactionError{path, err}
+	if version != latestSchemaVersion {
+		database.Close()
+		return nil, fmt.Errorf("database schema version %v must be upgraded to %v, which cannot be done whilst it is opened read-only", version, latestSchemaVersion)
 	}
 
-	return &Database{db}, nil
+	database.readOnly = true
+
+	return database, nil
 }
 
 func (database *Database) Close() error {
 	return database.db.Close()
 }
 
+// Determines whether changes to the database are refused.
+func (database *Database) ReadOnly() bool {
+	return database.readOnly
+}
+
+// Refuses, or once again permits, changes to the database.
+func (database *Database) SetReadOnly(readOnly bool) {
+	database.readOnly = readOnly
+}
+
+// Sorts names with the specified collation unless the database sets another.
+func (database *Database) SetDefaultCollation(name string) {
+	database.collation = name
+}
+
 func (database *Database) Begin() (*Tx, error) {
+	if database.encryption != nil {
+		return database.beginEncrypted()
+	}
+
 	tx, err := database.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Tx{tx}, nil
+	return &Tx{tx, database, nil}, nil
 }
 
 type Tx struct {
-	tx *sql.Tx
+	tx        *sql.Tx
+	database  *Database
+	encrypted *encryptedHold // nil unless the database is encrypted
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
 	log.Info(3, query)
 	log.Infof(3, "params: %v", args)
 
+	if tx.database != nil && tx.database.readOnly {
+		return nil, DatabaseReadOnlyError{}
+	}
+
 	return tx.tx.Exec(query, args...)
 }
 
@@ -120,17 +156,74 @@ func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
 func (tx *Tx) Commit() error {
 	log.Info(2, "committing transaction")
 
-	return tx.tx.Commit()
+	if err := tx.tx.Commit(); err != nil {
+		if tx.encrypted != nil {
+			tx.database.releaseEncrypted(tx.encrypted, false)
+		}
+		return err
+	}
+
+	if tx.encrypted != nil {
+		return tx.database.releaseEncrypted(tx.encrypted, true)
+	}
+
+	return nil
 }
 
 func (tx *Tx) Rollback() error {
 	log.Info(2, "rolling back transaction")
 
-	return tx.tx.Rollback()
+	err := tx.tx.Rollback()
+	if tx.encrypted != nil {
+		tx.database.releaseEncrypted(tx.encrypted, false)
+	}
+
+	return err
 }
 
 // unexported
 
+// opens the database at the path, migrating its schema to the latest version if migrating is specified
+func openAt(path string, migrating bool) (*Database, error) {
+	log.Infof(2, "opening database at '%v'.", path)
+
+	_, err := os.Stat(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return nil, DatabaseNotFoundError{path}
+		default:
+			return nil, DatabaseAccessError{path, err}
+		}
+	}
+
+	db, err := sql.Open(sqliteDriverName, dataSourceName(path))
+	if err != nil {
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	useWriteAheadLog(db)
+
+	if !migrating {
+		return &Database{db, nil, false, ""}, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	if err := upgrade(tx); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	return &Database{db, nil, false, ""}, nil
+}
+
 func readCount(rows *sql.Rows) (uint, error) {
 	if !rows.Next() {
 		return 0, errors.New("could not get count")
@@ -155,3 +248,21 @@ func collationFor(ignoreCase bool) string {
 
 	return ""
 }
+
+func dataSourceName(path string) string {
+	return fmt.Sprintf("%v?_busy_timeout=%v", path, int(BusyTimeout/time.Millisecond))
+}
+
+// switches the database to write-ahead logging, which is persisted in the
+// database file, so that readers such as the virtual filesystem are not
+// blocked by a writer and vice versa
+func useWriteAheadLog(db *sql.DB) {
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode=WAL").Scan(&mode); err != nil {
+		// e.g. the database is read-only
+		log.Infof(2, "could not enable write-ahead logging: %v", err)
+		return
+	}
+
+	log.Infof(2, "database journal mode is '%v'", mode)
+}
@@ -0,0 +1,114 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReaderIsNotBlockedByOpenWriteTransaction(test *testing.T) {
+	// set-up
+
+	dir, err := ioutil.TempDir("", "tmsu-database")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const tagCount = 1000
+	dbPath := filepath.Join(dir, "db")
+	if err := CreateAt(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	// a reader blocked by the writer fails quickly rather than after a minute
+	defer func(timeout time.Duration) { BusyTimeout = timeout }(BusyTimeout)
+	BusyTimeout = 100 * time.Millisecond
+
+	writer, err := OpenAt(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer writer.Close()
+
+	writeTx, err := writer.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer writeTx.Rollback()
+
+	// as is held throughout a recursive tagging, with more changes than are
+	// cached in memory so that they are written to disk before the commit
+	if _, err := writeTx.Exec("PRAGMA cache_size = 1"); err != nil {
+		test.Fatal(err)
+	}
+	for index := 0; index < tagCount; index++ {
+		if _, err := InsertTag(writeTx, fmt.Sprintf("tag%v", index), 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	reader, err := OpenAt(dbPath)
+	if err != nil {
+		test.Fatalf("Could not open database whilst a write transaction is open: %v", err)
+	}
+	defer reader.Close()
+
+	readTx, err := reader.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer readTx.Rollback()
+
+	tags, err := Tags(readTx)
+
+	// validate
+
+	if err != nil {
+		test.Fatalf("Could not read whilst a write transaction is open: %v", err)
+	}
+	if len(tags) != 0 {
+		test.Fatalf("Expected no tags to be read before the write is committed but read %v", len(tags))
+	}
+
+	// nor is the writer blocked by the reader's open transaction
+	if err := writeTx.Commit(); err != nil {
+		test.Fatalf("Could not commit whilst a read transaction is open: %v", err)
+	}
+	readTx.Rollback()
+
+	readTx, err = reader.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer readTx.Rollback()
+
+	tags, err = Tags(readTx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != tagCount {
+		test.Fatalf("Expected the %v committed tags to be read but read %v", tagCount, len(tags))
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the file tags whose file or tag does not exist.
+func OrphanedFileTags(tx *Tx) (entities.FileTags, error) {
+	sql := `
+SELECT file_id, tag_id, value_id, applied, applied_by
+FROM file_tag
+WHERE file_id NOT IN (SELECT id FROM file) OR
+      tag_id NOT IN (SELECT id FROM tag)
+ORDER BY file_id, tag_id, value_id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTags(rows, make(entities.FileTags, 0, 10))
+}
+
+// Deletes the file tags whose file or tag does not exist.
+func DeleteOrphanedFileTags(tx *Tx) error {
+	sql := `
+DELETE FROM file_tag
+WHERE file_id NOT IN (SELECT id FROM file) OR
+      tag_id NOT IN (SELECT id FROM tag)`
+
+	_, err := tx.Exec(sql)
+	return err
+}
+
+// Retrieves the file tags, of existing files and tags, whose value does not exist.
+func DanglingValueFileTags(tx *Tx) (entities.FileTags, error) {
+	sql := `
+SELECT file_id, tag_id, value_id, applied, applied_by
+FROM file_tag
+WHERE value_id != 0 AND
+      value_id NOT IN (SELECT id FROM value) AND
+      file_id IN (SELECT id FROM file) AND
+      tag_id IN (SELECT id FROM tag)
+ORDER BY file_id, tag_id, value_id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTags(rows, make(entities.FileTags, 0, 10))
+}
+
+// Removes the values that do not exist from the file tags, leaving the tags
+// applied without a value.
+func ClearDanglingValues(tx *Tx) error {
+	// the file may already have the tag without a value
+	sql := `
+UPDATE OR IGNORE file_tag
+SET value_id = 0
+WHERE value_id != 0 AND
+      value_id NOT IN (SELECT id FROM value)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `
+DELETE FROM file_tag
+WHERE value_id != 0 AND
+      value_id NOT IN (SELECT id FROM value)`
+
+	_, err := tx.Exec(sql)
+	return err
+}
+
+// Retrieves the number of content tags whose tag or value does not exist.
+func OrphanedContentTagCount(tx *Tx) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM content_tag
+WHERE tag_id NOT IN (SELECT id FROM tag) OR
+      (value_id != 0 AND value_id NOT IN (SELECT id FROM value))`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Deletes the content tags whose tag or value does not exist.
+func DeleteOrphanedContentTags(tx *Tx) error {
+	sql := `
+DELETE FROM content_tag
+WHERE tag_id NOT IN (SELECT id FROM tag) OR
+      (value_id != 0 AND value_id NOT IN (SELECT id FROM value))`
+
+	_, err := tx.Exec(sql)
+	return err
+}
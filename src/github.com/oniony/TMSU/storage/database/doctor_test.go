@@ -0,0 +1,101 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"testing"
+	"time"
+)
+
+func TestOrphanedAndDanglingFileTags(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	statements := []string{
+		"INSERT INTO file (id, directory, name, fingerprint, mod_time, size, is_dir, mime_type) VALUES (1, '/tmp', 'a', '', '2020-01-01', 0, 0, '')",
+		"INSERT INTO tag (id, name) VALUES (1, 'photo')",
+		"INSERT INTO value (id, name) VALUES (1, '2020')",
+		"INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (1, 1, 1)", // sound
+		"INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (2, 1, 0)", // no such file
+		"INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (1, 2, 0)", // no such tag
+		"INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (1, 1, 9)", // no such value
+		"INSERT INTO content_tag VALUES ('abc', 3, 0)",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	wrapped := &Tx{tx, nil, nil}
+
+	// test
+
+	orphaned, err := OrphanedFileTags(wrapped)
+	if err != nil {
+		test.Fatal(err)
+	}
+	dangling, err := DanglingValueFileTags(wrapped)
+	if err != nil {
+		test.Fatal(err)
+	}
+	contentTagCount, err := OrphanedContentTagCount(wrapped)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(orphaned) != 2 || orphaned[0].TagId != 2 || orphaned[1].FileId != 2 {
+		test.Fatalf("Unexpected orphaned file tags: %v", orphaned)
+	}
+	if len(dangling) != 1 || dangling[0].ValueId != 9 {
+		test.Fatalf("Unexpected file tags with dangling values: %v", dangling)
+	}
+	if contentTagCount != 1 {
+		test.Fatalf("Unexpected orphaned content tag count %v", contentTagCount)
+	}
+
+	// test
+
+	if err := DeleteOrphanedFileTags(wrapped); err != nil {
+		test.Fatal(err)
+	}
+	if err := ClearDanglingValues(wrapped); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	fileTags, err := FileTags(wrapped)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := map[entities.FileTag]bool{{1, 1, 0, true, false, time.Time{}, ""}: true, {1, 1, 1, true, false, time.Time{}, ""}: true}
+	if len(fileTags) != len(expected) {
+		test.Fatalf("Unexpected file tags: %v", fileTags)
+	}
+	for _, fileTag := range fileTags {
+		if !expected[*fileTag] {
+			test.Fatalf("Unexpected file tag %v", fileTag)
+		}
+	}
+}
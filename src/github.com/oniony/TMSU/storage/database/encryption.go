@@ -0,0 +1,682 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/oniony/TMSU/common/log"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Determines whether the database at the path is encrypted.
+func IsEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return bytes.Equal(magic, encryptedMagic), nil
+}
+
+// Creates a new database at the path encrypted with the passphrase.
+func CreateEncryptedAt(path, passphrase string) error {
+	log.Infof(2, "creating encrypted database at '%v'.", path)
+
+	// an existing database would be replaced rather than upgraded
+	if _, err := os.Stat(path); err == nil {
+		return DatabaseAccessError{path, errors.New("database already exists")}
+	}
+
+	encryption, err := newEncryption(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	db, err := openMemoryDatabase()
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+	defer db.Close()
+
+	database := &Database{db, encryption, false, ""}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return DatabaseTransactionError{path, err}
+	}
+
+	if err := upgrade(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DatabaseTransactionError{path, err}
+	}
+
+	return database.save(true)
+}
+
+// Opens the encrypted database at the path using the passphrase.
+//
+// The database is decrypted into memory and written back, encrypted, whenever
+// a transaction that changed it is committed, whilst holding the lock on the
+// database. Each transaction first reloads the database if another process has
+// since written it, and the changes are refused rather than written back if one
+// has done so during the transaction, so that its changes are not lost.
+func OpenEncryptedAt(path, passphrase string) (*Database, error) {
+	return openEncryptedAt(path, passphrase, true)
+}
+
+// Encrypts the unencrypted database at the path with the passphrase.
+func EncryptAt(path, passphrase string) error {
+	log.Infof(2, "encrypting database at '%v'.", path)
+
+	lock := NewLock(path, BusyTimeout)
+	if err := lock.Acquire(); err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	db, err := sql.Open(sqliteDriverName, dataSourceName(path))
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+	defer db.Close()
+
+	// fold the write-ahead log into the database so that the image is complete
+	if _, err := db.Exec("PRAGMA journal_mode=DELETE"); err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	image, err := serializeImage(db)
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	encryption, err := newEncryption(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return encryption.write(image)
+}
+
+// Decrypts the encrypted database at the path using the passphrase.
+func DecryptAt(path, passphrase string) error {
+	log.Infof(2, "decrypting database at '%v'.", path)
+
+	lock := NewLock(path, BusyTimeout)
+	if err := lock.Acquire(); err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	_, _, image, err := decryptImage(path, passphrase, data)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(path, image); err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	return nil
+}
+
+// Re-encrypts the encrypted database at the path with a new passphrase.
+func ChangePassphraseAt(path, passphrase, newPassphrase string) error {
+	log.Infof(2, "changing passphrase of database at '%v'.", path)
+
+	lock := NewLock(path, BusyTimeout)
+	if err := lock.Acquire(); err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	_, _, image, err := decryptImage(path, passphrase, data)
+	if err != nil {
+		return err
+	}
+
+	encryption, err := newEncryption(path, newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	return encryption.write(image)
+}
+
+// unexported
+
+// opens the encrypted database at the path, migrating its schema to the latest version if migrating is specified
+func openEncryptedAt(path, passphrase string, migrating bool) (*Database, error) {
+	log.Infof(2, "opening encrypted database at '%v'.", path)
+
+	// taken before reading so that a later change is noticed
+	stat, err := os.Stat(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return nil, DatabaseNotFoundError{path}
+		default:
+			return nil, DatabaseAccessError{path, err}
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	key, salt, image, err := decryptImage(path, passphrase, data)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openMemoryDatabase()
+	if err != nil {
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	if err := loadImage(db, image); err != nil {
+		db.Close()
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	database := &Database{db, &encryption{path: path, key: key, salt: salt, stat: stat, lock: NewLock(path, BusyTimeout)}, false, ""}
+	if database.encryption.changes, err = database.totalChanges(); err != nil {
+		db.Close()
+		return nil, DatabaseAccessError{path, err}
+	}
+
+	if !migrating {
+		return database, nil
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		db.Close()
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	if err := upgrade(tx.tx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		db.Close()
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	return database, nil
+}
+
+// identifies an encrypted database: the magic is followed by the key salt, the
+// nonce and then the AES-256-GCM sealed SQLite database image
+var encryptedMagic = []byte("TMSUENC1")
+
+const saltLength = 16
+const keyLength = 32
+
+type encryption struct {
+	path    string
+	key     []byte
+	salt    []byte
+	changes int64
+	stat    os.FileInfo // of the file as last read or written, to notice another process writing it
+	lock    *Lock       // held whilst the file is checked and written
+	mutex   sync.Mutex
+}
+
+func newEncryption(path, passphrase string) (*encryption, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryption{path: path, key: key, salt: salt, lock: NewLock(path, BusyTimeout)}, nil
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, keyLength)
+}
+
+func newCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypts the database image and writes it to the database path, replacing
+// the file only once the whole image is written
+func (encryption *encryption) write(image []byte) error {
+	aead, err := newCipher(encryption.key)
+	if err != nil {
+		return err
+	}
+
+	header := append(append([]byte{}, encryptedMagic...), encryption.salt...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data := aead.Seal(append(header, nonce...), nonce, image, header)
+
+	if err := writeFileAtomically(encryption.path, data); err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	return nil
+}
+
+// decrypts the database image, returning the key and salt alongside
+func decryptImage(path, passphrase string, data []byte) ([]byte, []byte, []byte, error) {
+	headerLength := len(encryptedMagic) + saltLength
+	if len(data) < headerLength || !bytes.Equal(data[:len(encryptedMagic)], encryptedMagic) {
+		return nil, nil, nil, DatabaseAccessError{path, errors.New("database is not encrypted")}
+	}
+
+	salt := data[len(encryptedMagic):headerLength]
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	image, err := openImage(path, key, data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return key, salt, image, nil
+}
+
+// decrypts the database image with the key, as derived from the salt in the
+// header of the encrypted data
+func openImage(path string, key, data []byte) ([]byte, error) {
+	headerLength := len(encryptedMagic) + saltLength
+	header := data[:headerLength]
+
+	aead, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < headerLength+aead.NonceSize() {
+		return nil, DatabaseAccessError{path, errors.New("encrypted database is truncated")}
+	}
+
+	nonce := data[headerLength : headerLength+aead.NonceSize()]
+	image, err := aead.Open(nil, nonce, data[headerLength+aead.NonceSize():], header)
+	if err != nil {
+		return nil, DatabasePassphraseError{path}
+	}
+
+	return image, nil
+}
+
+// writes the encrypted database back if it has changed since it was last
+// written, refusing to if another process has written it since it was loaded
+// as its changes would otherwise be lost
+func (database *Database) save(force bool) error {
+	if database.encryption == nil {
+		return nil
+	}
+
+	encryption := database.encryption
+	encryption.mutex.Lock()
+	defer encryption.mutex.Unlock()
+
+	changes, err := database.totalChanges()
+	if err != nil {
+		return err
+	}
+	if !force && changes == encryption.changes {
+		return nil
+	}
+
+	if err := encryption.lock.Acquire(); err != nil {
+		return err
+	}
+	defer encryption.lock.Release()
+
+	if changed, err := encryption.changedOnDisk(); err != nil {
+		return err
+	} else if changed {
+		return DatabaseAccessError{encryption.path, errors.New("the database was changed by another process whilst open so the changes have not been saved")}
+	}
+
+	log.Info(2, "writing encrypted database")
+
+	image, err := serializeImage(database.db)
+	if err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	if err := encryption.write(image); err != nil {
+		return err
+	}
+
+	encryption.changes = changes
+	if encryption.stat, err = os.Stat(encryption.path); err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	return nil
+}
+
+// the connection to the in-memory copy of an encrypted database, held whilst it
+// is reloaded and changed
+type encryptedHold struct {
+	conn      *sql.Conn
+	released  bool
+	forceSave bool // whether it is written back although no row has changed
+}
+
+// begins a transaction of the encrypted database, first reloading it if another
+// process has written it since it was loaded
+func (database *Database) beginEncrypted() (*Tx, error) {
+	hold, err := database.acquireEncrypted()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := hold.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		database.releaseEncrypted(hold, false)
+		return nil, err
+	}
+
+	return &Tx{tx, database, hold}, nil
+}
+
+// takes the single connection to the in-memory copy of the encrypted database,
+// reloading it if another process has written the database since it was loaded
+func (database *Database) acquireEncrypted() (*encryptedHold, error) {
+	conn, err := database.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.reload(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &encryptedHold{conn: conn}, nil
+}
+
+// releases the connection, then writes the database back if saving and it has
+// changed
+func (database *Database) releaseEncrypted(hold *encryptedHold, saving bool) error {
+	if hold.released {
+		return nil
+	}
+	hold.released = true
+
+	// returned to the pool so that the image can be serialized
+	hold.conn.Close()
+
+	if !saving {
+		return nil
+	}
+
+	return database.save(hold.forceSave)
+}
+
+// reloads the in-memory copy of the database, upon its connection, if another
+// process has written the database since it was loaded
+func (database *Database) reload(conn *sql.Conn) error {
+	encryption := database.encryption
+	encryption.mutex.Lock()
+	defer encryption.mutex.Unlock()
+
+	changed, err := encryption.changedOnDisk()
+	if err != nil || !changed {
+		return err
+	}
+
+	log.Info(2, "reloading encrypted database changed by another process")
+
+	stat, err := os.Stat(encryption.path)
+	if err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	data, err := ioutil.ReadFile(encryption.path)
+	if err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	headerLength := len(encryptedMagic) + saltLength
+	if len(data) < headerLength || !bytes.Equal(data[:len(encryptedMagic)], encryptedMagic) {
+		return DatabaseAccessError{encryption.path, errors.New("database is no longer encrypted")}
+	}
+	if !bytes.Equal(data[len(encryptedMagic):headerLength], encryption.salt) {
+		return DatabaseAccessError{encryption.path, errors.New("the passphrase of the database was changed by another process whilst open")}
+	}
+
+	image, err := openImage(encryption.path, encryption.key, data)
+	if err != nil {
+		return err
+	}
+
+	if err := loadImageUpon(conn, image); err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	var changes int64
+	if err := conn.QueryRowContext(context.Background(), "SELECT total_changes()").Scan(&changes); err != nil {
+		return DatabaseAccessError{encryption.path, err}
+	}
+
+	encryption.changes = changes
+	encryption.stat = stat
+
+	return nil
+}
+
+// whether the database file has been replaced since it was last read or
+// written, as it is whenever it is written
+func (encryption *encryption) changedOnDisk() (bool, error) {
+	if encryption.stat == nil {
+		return false, nil
+	}
+
+	stat, err := os.Stat(encryption.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+
+		return false, DatabaseAccessError{encryption.path, err}
+	}
+
+	return !os.SameFile(stat, encryption.stat) || !stat.ModTime().Equal(encryption.stat.ModTime()) || stat.Size() != encryption.stat.Size(), nil
+}
+
+func (database *Database) totalChanges() (int64, error) {
+	var changes int64
+	err := database.db.QueryRow("SELECT total_changes()").Scan(&changes)
+
+	return changes, err
+}
+
+// opens an in-memory database upon a single connection, which must be kept
+// open for the lifetime of the database lest its contents be lost
+func openMemoryDatabase() (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriverName, ":memory:")
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	return db, nil
+}
+
+// loads a database image into the in-memory database. A deserialized image
+// cannot grow so it is copied, via a scratch connection, using the backup API.
+func loadImage(db *sql.DB, image []byte) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return loadImageUpon(conn, image)
+}
+
+// loads a database image into the in-memory database upon its connection
+func loadImageUpon(conn *sql.Conn, image []byte) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		destination, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected connection type %T", driverConn)
+		}
+
+		scratchConn, err := (&sqlite3.SQLiteDriver{}).Open(":memory:")
+		if err != nil {
+			return err
+		}
+		scratch := scratchConn.(*sqlite3.SQLiteConn)
+		defer scratch.Close()
+
+		if err := scratch.Deserialize(image, "main"); err != nil {
+			return err
+		}
+
+		backup, err := destination.Backup("main", scratch, "main")
+		if err != nil {
+			return err
+		}
+
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+
+		return backup.Finish()
+	})
+}
+
+func serializeImage(db *sql.DB) ([]byte, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var image []byte
+	err = conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected connection type %T", driverConn)
+		}
+
+		image, err = sqliteConn.Serialize("main")
+		return err
+	})
+
+	return image, err
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// the write-ahead log of an unencrypted database would otherwise be
+	// replayed on top of the new contents
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedDatabaseKeepsChangesOfAnotherProcess(test *testing.T) {
+	// set-up
+
+	dbPath := createEncryptedDatabase(test)
+	defer os.RemoveAll(filepath.Dir(dbPath))
+
+	first := openEncryptedDatabase(test, dbPath)
+	defer first.Close()
+
+	second := openEncryptedDatabase(test, dbPath)
+	defer second.Close()
+
+	// test
+
+	insertTag(test, first, "aubergine")
+	insertTag(test, second, "banana")
+
+	// validate
+
+	third := openEncryptedDatabase(test, dbPath)
+	defer third.Close()
+
+	for _, database := range []*Database{first, second, third} {
+		assertTagNames(test, database, "aubergine", "banana")
+	}
+}
+
+func TestEncryptedDatabaseRefusesToOverwriteChangesOfAnotherProcess(test *testing.T) {
+	// set-up
+
+	dbPath := createEncryptedDatabase(test)
+	defer os.RemoveAll(filepath.Dir(dbPath))
+
+	first := openEncryptedDatabase(test, dbPath)
+	defer first.Close()
+
+	second := openEncryptedDatabase(test, dbPath)
+	defer second.Close()
+
+	// test
+
+	tx, err := first.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := InsertTag(tx, "aubergine", 0); err != nil {
+		test.Fatal(err)
+	}
+
+	insertTag(test, second, "banana")
+
+	commitErr := tx.Commit()
+
+	// validate
+
+	if commitErr == nil {
+		test.Fatal("Expected changes to be refused as the database was changed by another process")
+	}
+
+	third := openEncryptedDatabase(test, dbPath)
+	defer third.Close()
+
+	assertTagNames(test, second, "banana")
+	assertTagNames(test, third, "banana")
+}
+
+// unexported
+
+func createEncryptedDatabase(test *testing.T) string {
+	dir, err := ioutil.TempDir("", "tmsu-encryption")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "db")
+	if err := CreateEncryptedAt(dbPath, "hunter2"); err != nil {
+		os.RemoveAll(dir)
+		test.Fatal(err)
+	}
+
+	return dbPath
+}
+
+func openEncryptedDatabase(test *testing.T, dbPath string) *Database {
+	database, err := OpenEncryptedAt(dbPath, "hunter2")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return database
+}
+
+func insertTag(test *testing.T, database *Database, name string) {
+	tx, err := database.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := InsertTag(tx, name, 0); err != nil {
+		tx.Rollback()
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func assertTagNames(test *testing.T, database *Database, expectedNames ...string) {
+	tx, err := database.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	tags, err := Tags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(tags) != len(expectedNames) {
+		test.Fatalf("Expected %v tags but were %v", len(expectedNames), len(tags))
+	}
+	for index, tag := range tags {
+		if tag.Name != expectedNames[index] {
+			test.Fatalf("Expected tag %v to be '%v' but was '%v'", index, expectedNames[index], tag.Name)
+		}
+	}
+}
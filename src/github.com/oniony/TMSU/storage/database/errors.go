@@ -16,8 +16,11 @@
 package database
 
 import (
+	"errors"
 	"fmt"
+	"github.com/mattn/go-sqlite3"
 	"github.com/oniony/TMSU/entities"
+	"strings"
 )
 
 type DatabaseNotFoundError struct {
@@ -37,6 +40,14 @@ func (err DatabaseAccessError) Error() string {
 	return fmt.Sprintf("cannot access database at '%v': %v", err.DatabasePath, err.Reason)
 }
 
+type DatabasePassphraseError struct {
+	DatabasePath string
+}
+
+func (err DatabasePassphraseError) Error() string {
+	return fmt.Sprintf("incorrect passphrase for database at '%v'", err.DatabasePath)
+}
+
 type DatabaseTransactionError struct {
 	DatabasePath string
 	Reason       error
@@ -46,6 +57,22 @@ func (err DatabaseTransactionError) Error() string {
 	return fmt.Sprintf("database transaction error: %v", err.Reason)
 }
 
+type SchemaVersionError struct {
+	Version       string
+	LatestVersion string
+}
+
+func (err SchemaVersionError) Error() string {
+	return fmt.Sprintf("database schema version %v is newer than the latest version %v supported by this version of TMSU: upgrade TMSU to use this database", err.Version, err.LatestVersion)
+}
+
+// A change was attempted to a database opened read-only.
+type DatabaseReadOnlyError struct{}
+
+func (err DatabaseReadOnlyError) Error() string {
+	return "the database is read-only"
+}
+
 type DatabaseQueryError struct {
 	DatabasePath string
 	Query        string
@@ -99,6 +126,55 @@ func (err NoSuchImplicationError) Error() string {
 	return fmt.Sprintf("no such implication where #%v implies #%v", err.TagValuePair, err.ImpliedTagValuePair)
 }
 
+type NoSuchAliasError struct {
+	Name string
+}
+
+func (err NoSuchAliasError) Error() string {
+	return fmt.Sprintf("no such alias '%v'", err.Name)
+}
+
+type NoSuchNoteError struct {
+	FileId entities.FileId
+}
+
+func (err NoSuchNoteError) Error() string {
+	return fmt.Sprintf("no note for file #%v", err.FileId)
+}
+
+type NoSuchPropertyError struct {
+	FileId entities.FileId
+	Name   string
+}
+
+func (err NoSuchPropertyError) Error() string {
+	return fmt.Sprintf("no property '%v' for file #%v", err.Name, err.FileId)
+}
+
+type NoSuchRuleError struct {
+	RuleId entities.RuleId
+}
+
+func (err NoSuchRuleError) Error() string {
+	return fmt.Sprintf("no such rule #%v", err.RuleId)
+}
+
+type NoSuchViewError struct {
+	Name string
+}
+
+func (err NoSuchViewError) Error() string {
+	return fmt.Sprintf("no such view '%v'", err.Name)
+}
+
+type NoSuchSnapshotError struct {
+	Name string
+}
+
+func (err NoSuchSnapshotError) Error() string {
+	return fmt.Sprintf("no such snapshot '%v'", err.Name)
+}
+
 type NoSuchSettingError struct {
 	Name string
 }
@@ -106,3 +182,45 @@ type NoSuchSettingError struct {
 func (err NoSuchSettingError) Error() string {
 	return fmt.Sprintf("no such setting '%v'", err.Name)
 }
+
+// Determines whether the error arose because another process holds a lock on
+// the database.
+func IsLocked(err error) bool {
+	var lockTimeoutErr LockTimeoutError
+	if errors.As(err, &lockTimeoutErr) {
+		return true
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	// lock not available or deadlock detected
+	state := sqlState(err)
+	return state == "55P03" || state == "40P01"
+}
+
+// Determines whether the error arose from a change that would violate a
+// database constraint, such as a duplicate name.
+func IsConstraintViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrConstraint
+	}
+
+	// integrity constraint violation
+	return strings.HasPrefix(sqlState(err), "23")
+}
+
+// unexported
+
+// the SQLSTATE code of an error reported by PostgreSQL, if it is one
+func sqlState(err error) string {
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState()
+	}
+
+	return ""
+}
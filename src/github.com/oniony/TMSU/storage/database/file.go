@@ -18,10 +18,13 @@ package database
 import (
 	"database/sql"
 	"github.com/oniony/TMSU/common/fingerprint"
+	_path "github.com/oniony/TMSU/common/path"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -43,10 +46,10 @@ func FileCount(tx *Tx) (uint, error) {
 func Files(tx *Tx, sort string) (entities.Files, error) {
 	builder := NewBuilder()
 	builder.AppendSql(`
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file `)
 
-	buildSort(sort, builder)
+	buildSort(sort, false, "", builder)
 
 	rows, err := tx.Query(builder.Sql())
 	if err != nil {
@@ -60,7 +63,7 @@ FROM file `)
 // Retrieves a specific file.
 func File(tx *Tx, id entities.FileId) (*entities.File, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
 WHERE id = ?`
 
@@ -79,9 +82,9 @@ func FileByPath(tx *Tx, path string) (*entities.File, error) {
 	name := filepath.Base(path)
 
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
-WHERE directory = ? AND name = ?`
+WHERE directory = ?` + pathCollation() + ` AND name = ?` + pathCollation()
 
 	rows, err := tx.Query(sql, directory, name)
 	if err != nil {
@@ -92,10 +95,65 @@ WHERE directory = ? AND name = ?`
 	return readFile(rows)
 }
 
+// Retrieves the files with the specified paths, querying the paths in batches.
+func FilesByPaths(tx *Tx, paths []string) (entities.Files, error) {
+	namesByDirectory := make(map[string][]string, 10)
+	directories := make([]string, 0, 10)
+	for _, path := range paths {
+		directory := filepath.Dir(path)
+		name := filepath.Base(path)
+
+		if _, ok := namesByDirectory[directory]; !ok {
+			directories = append(directories, directory)
+		}
+		namesByDirectory[directory] = append(namesByDirectory[directory], name)
+	}
+
+	files := make(entities.Files, 0, len(paths))
+
+	for _, directory := range directories {
+		names := namesByDirectory[directory]
+
+		for start := 0; start < len(names); start += filesByPathsBatchSize {
+			end := start + filesByPathsBatchSize
+			if end > len(names) {
+				end = len(names)
+			}
+			batch := names[start:end]
+
+			sql := `
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
+FROM file
+WHERE directory = ?` + pathCollation() + ` AND name` + pathCollation() + ` IN (?`
+			sql += strings.Repeat(",?", len(batch)-1)
+			sql += ")"
+
+			params := make([]interface{}, 0, len(batch)+1)
+			params = append(params, directory)
+			for _, name := range batch {
+				params = append(params, name)
+			}
+
+			rows, err := tx.Query(sql, params...)
+			if err != nil {
+				return nil, err
+			}
+
+			files, err = readFiles(rows, files)
+			rows.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
+
 // Retrieves all files that are under the specified directory.
 func FilesByDirectory(tx *Tx, path string, pathContainsRoot bool) (entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
 WHERE directory = ? OR directory LIKE ?`
 
@@ -136,7 +194,7 @@ WHERE fingerprint = ?`
 // Retrieves the set of files with the specified fingerprint.
 func FilesByFingerprint(tx *Tx, fingerprint fingerprint.Fingerprint) (entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
 WHERE fingerprint = ?
 ORDER BY directory || '/' || name`
@@ -150,10 +208,50 @@ ORDER BY directory || '/' || name`
 	return readFiles(rows, make(entities.Files, 0, 1))
 }
 
+// Retrieves the set of files, other than directories, with the specified size.
+func FilesBySize(tx *Tx, size int64) (entities.Files, error) {
+	sql := `
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
+FROM file
+WHERE size = ? AND is_dir = 0
+ORDER BY directory || '/' || name`
+
+	rows, err := tx.Query(sql, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(entities.Files, 0, 1))
+}
+
+// Retrieves the files, other than directories, that have no fingerprint but
+// share their size with another such file, by size.
+func UnfingerprintedFilesOfSharedSize(tx *Tx) (entities.Files, error) {
+	sql := `
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
+FROM file
+WHERE fingerprint = '' AND is_dir = 0 AND
+      size IN (SELECT size
+               FROM file
+               WHERE fingerprint = '' AND is_dir = 0
+               GROUP BY size
+               HAVING count(1) > 1)
+ORDER BY size, directory || '/' || name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(entities.Files, 0, 10))
+}
+
 // Retrieves the set of untagged files.
 func UntaggedFiles(tx *Tx) (entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
 WHERE id NOT IN (SELECT distinct(file_id)
                  FROM file_tag)`
@@ -167,9 +265,27 @@ WHERE id NOT IN (SELECT distinct(file_id)
 	return readFiles(rows, make(entities.Files, 0, 10))
 }
 
-// Retrieves the count of files matching the specified query and matching the specified path.
-func FileCountForQuery(tx *Tx, expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool) (uint, error) {
-	builder := buildCountQuery(expression, path, pathContainsRoot, explicitOnly, ignoreCase)
+// Opens a cursor over the set of untagged files, by path. The cursor must be
+// closed before further statements are executed within the transaction.
+func UntaggedFileCursor(tx *Tx) (*FileCursor, error) {
+	sql := `
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
+FROM file
+WHERE id NOT IN (SELECT distinct(file_id)
+                 FROM file_tag)
+ORDER BY directory || '/' || name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCursor{rows}, nil
+}
+
+// Retrieves the count of files matching the specified query and lying at or beneath any of the specified paths.
+func FileCountForQuery(tx *Tx, expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool) (uint, error) {
+	builder := buildCountQuery(expression, paths, notes, pathContainsRoot, explicitOnly, ignoreCase)
 
 	rows, err := tx.Query(builder.Sql(), builder.Params()...)
 	if err != nil {
@@ -180,9 +296,61 @@ func FileCountForQuery(tx *Tx, expression query.Expression, path string, pathCon
 	return readCount(rows)
 }
 
-// Retrieves the set of files matching the specified query and matching the specified path.
-func FilesForQuery(tx *Tx, expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string) (entities.Files, error) {
-	builder := buildQuery(expression, path, pathContainsRoot, explicitOnly, ignoreCase, sort)
+// Retrieves the set of files matching the specified query and lying at or beneath any of the specified paths.
+// At most limit files are retrieved unless limit is zero.
+func FilesForQuery(tx *Tx, expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint) (entities.Files, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := buildQuery(expression, paths, notes, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit, nameCollation)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(entities.Files, 0, 10))
+}
+
+// A set operation by which the files matching two queries are combined.
+type SetOperation string
+
+const (
+	// the files matching the first query but not the second
+	Difference SetOperation = "EXCEPT"
+	// the files matching both queries
+	Intersection SetOperation = "INTERSECT"
+)
+
+// Retrieves the files resulting from combining the files matching each of the specified queries, and lying at or
+// beneath any of the specified paths, with the specified set operation.
+func FilesForQueries(tx *Tx, first, second query.Expression, operation SetOperation, paths []string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string) (entities.Files, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewBuilder()
+
+	builder.AppendSql(`
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
+FROM file
+WHERE id IN (SELECT id
+             FROM file
+             WHERE`)
+	buildQueryBranch(first, builder, explicitOnly, ignoreCase)
+	buildPathClause(paths, pathContainsRoot, builder)
+	builder.AppendSql(string(operation) + `
+             SELECT id
+             FROM file
+             WHERE`)
+	buildQueryBranch(second, builder, explicitOnly, ignoreCase)
+	buildPathClause(paths, pathContainsRoot, builder)
+	builder.AppendSql(")")
+	buildSort(sort, false, nameCollation, builder)
 
 	rows, err := tx.Query(builder.Sql(), builder.Params()...)
 	if err != nil {
@@ -193,10 +361,109 @@ func FilesForQuery(tx *Tx, expression query.Expression, path string, pathContain
 	return readFiles(rows, make(entities.Files, 0, 10))
 }
 
+// A cursor over the files matching a query, from which they are read a page at a
+// time rather than all at once.
+type FileCursor struct {
+	rows *sql.Rows
+}
+
+// Opens a cursor over the set of files matching the specified query, as retrieved by FilesForQuery. The cursor
+// must be closed before further statements are executed within the transaction.
+func FileCursorForQuery(tx *Tx, expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint) (*FileCursor, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := buildQuery(expression, paths, notes, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit, nameCollation)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCursor{rows}, nil
+}
+
+// Retrieves up to count further files, or none once every file has been read.
+func (cursor *FileCursor) Next(count int) (entities.Files, error) {
+	files := make(entities.Files, 0, count)
+	for len(files) < count {
+		file, err := readFile(cursor.rows)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return files, cursor.rows.Err()
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+func (cursor *FileCursor) Close() error {
+	return cursor.rows.Close()
+}
+
+// Retrieves the SQL for the set of files matching the specified query, and SQLite's plan for running it.
+func ExplainFilesForQuery(tx *Tx, expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint) (*entities.QueryPlan, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := buildQuery(expression, paths, notes, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit, nameCollation)
+
+	return explainQuery(tx, builder)
+}
+
+// Retrieves the number of files matching the specified query, and lying at or beneath any of the specified paths,
+// to which each value of the specified tag is applied, ordered by value name.
+func FileCountsByValueForQuery(tx *Tx, expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool, tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	builder := NewBuilder()
+
+	builder.AppendSql(`
+SELECT ft.value_id, coalesce(v.name, ''), count(DISTINCT ft.file_id)
+FROM file_tag ft
+LEFT JOIN value v ON v.id = ft.value_id
+WHERE ft.tag_id = `)
+	builder.AppendParam(tagId)
+	builder.AppendSql(` AND
+      ft.file_id IN (SELECT id
+                     FROM file
+                     WHERE`)
+	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
+	buildPathClause(paths, pathContainsRoot, builder)
+	buildNotesClause(notes, builder)
+	builder.AppendSql(`)
+GROUP BY ft.value_id
+ORDER BY coalesce(v.name, '')`)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]entities.ValueFileCount, 0, 10)
+	for rows.Next() {
+		var count entities.ValueFileCount
+		if err := rows.Scan(&count.Id, &count.Name, &count.FileCount); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
 // Retrieves the sets of duplicate files within the database.
 func DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 	sql := `
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
 WHERE fingerprint IN (SELECT fingerprint
                       FROM file
@@ -226,7 +493,8 @@ ORDER BY fingerprint, directory || '/' || name`
 		var modTime time.Time
 		var size int64
 		var isDir bool
-		err = rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir)
+		var mimeType string
+		err = rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir, &mimeType)
 		if err != nil {
 			return nil, err
 		}
@@ -241,7 +509,7 @@ ORDER BY fingerprint, directory || '/' || name`
 			previousFingerprint = fingerprint
 		}
 
-		fileSet = append(fileSet, &entities.File{fileId, directory, name, fingerprint, modTime, size, isDir})
+		fileSet = append(fileSet, &entities.File{fileId, directory, name, fingerprint, modTime, size, isDir, mimeType})
 	}
 
 	// ensure last file set is added
@@ -253,15 +521,15 @@ ORDER BY fingerprint, directory || '/' || name`
 }
 
 // Adds a file to the database.
-func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, mimeType string) (*entities.File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
 	sql := `
-INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir)
-VALUES (?, ?, ?, ?, ?, ?)`
+INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir, mime_type)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir)
+	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, mimeType)
 	if err != nil {
 		return nil, err
 	}
@@ -279,20 +547,20 @@ VALUES (?, ?, ?, ?, ?, ?)`
 		panic("expected exactly one row to be affected.")
 	}
 
-	return &entities.File{entities.FileId(id), directory, name, fingerprint, modTime, size, isDir}, nil
+	return &entities.File{entities.FileId(id), directory, name, fingerprint, modTime, size, isDir, mimeType}, nil
 }
 
 // Updates a file in the database.
-func UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+func UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, mimeType string) (*entities.File, error) {
 	directory := filepath.Dir(path)
 	name := filepath.Base(path)
 
 	sql := `
 UPDATE file
-SET directory = ?, name = ?, fingerprint = ?, mod_time = ?, size = ?, is_dir = ?
+SET directory = ?, name = ?, fingerprint = ?, mod_time = ?, size = ?, is_dir = ?, mime_type = ?
 WHERE id = ?`
 
-	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, int(fileId))
+	result, err := tx.Exec(sql, directory, name, string(fingerprint), modTime, size, isDir, mimeType, int(fileId))
 	if err != nil {
 		return nil, err
 	}
@@ -305,7 +573,7 @@ WHERE id = ?`
 		panic("expected exactly one row to be affected.")
 	}
 
-	return &entities.File{entities.FileId(fileId), directory, name, fingerprint, modTime, size, isDir}, nil
+	return &entities.File{entities.FileId(fileId), directory, name, fingerprint, modTime, size, isDir, mimeType}, nil
 }
 
 // Removes a file from the database.
@@ -354,6 +622,10 @@ AND (SELECT count(1)
 
 // unexported
 
+// the number of names looked up per query, keeping within SQLite's limit on
+// the number of parameters
+const filesByPathsBatchSize = 500
+
 func readFile(rows *sql.Rows) (*entities.File, error) {
 	if !rows.Next() {
 		return nil, nil
@@ -367,12 +639,13 @@ func readFile(rows *sql.Rows) (*entities.File, error) {
 	var modTime time.Time
 	var size int64
 	var isDir bool
-	err := rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir)
+	var mimeType string
+	err := rows.Scan(&fileId, &directory, &name, &fp, &modTime, &size, &isDir, &mimeType)
 	if err != nil {
 		return nil, err
 	}
 
-	return &entities.File{fileId, directory, name, fingerprint.Fingerprint(fp), modTime, size, isDir}, nil
+	return &entities.File{fileId, directory, name, fingerprint.Fingerprint(fp), modTime, size, isDir, mimeType}, nil
 }
 
 func readFiles(rows *sql.Rows, files entities.Files) (entities.Files, error) {
@@ -391,7 +664,28 @@ func readFiles(rows *sql.Rows, files entities.Files) (entities.Files, error) {
 	return files, nil
 }
 
-func buildCountQuery(expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool) *SqlBuilder {
+func explainQuery(tx *Tx, builder *SqlBuilder) (*entities.QueryPlan, error) {
+	rows, err := tx.Query("EXPLAIN QUERY PLAN "+builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plan := entities.QueryPlan{builder.Sql(), builder.Params(), make([]entities.QueryPlanStep, 0, 10)}
+	for rows.Next() {
+		var step entities.QueryPlanStep
+		var unused int
+		if err := rows.Scan(&step.Id, &step.Parent, &unused, &step.Detail); err != nil {
+			return nil, err
+		}
+
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	return &plan, rows.Err()
+}
+
+func buildCountQuery(expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool) *SqlBuilder {
 	builder := NewBuilder()
 
 	builder.AppendSql(`
@@ -399,21 +693,24 @@ SELECT count(id)
 FROM file
 WHERE`)
 	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
-	buildPathClause(path, pathContainsRoot, builder)
+	buildPathClause(paths, pathContainsRoot, builder)
+	buildNotesClause(notes, builder)
 
 	return builder
 }
 
-func buildQuery(expression query.Expression, path string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string) *SqlBuilder {
+func buildQuery(expression query.Expression, paths []string, notes string, pathContainsRoot, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint, nameCollation string) *SqlBuilder {
 	builder := NewBuilder()
 
 	builder.AppendSql(`
-SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+SELECT id, directory, name, fingerprint, mod_time, size, is_dir, mime_type
 FROM file
 WHERE`)
 	buildQueryBranch(expression, builder, explicitOnly, ignoreCase)
-	buildPathClause(path, pathContainsRoot, builder)
-	buildSort(sort, builder)
+	buildPathClause(paths, pathContainsRoot, builder)
+	buildNotesClause(notes, builder)
+	buildSort(sort, reverse, nameCollation, builder)
+	buildLimit(limit, builder)
 
 	return builder
 }
@@ -421,7 +718,11 @@ WHERE`)
 func buildQueryBranch(expression query.Expression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
 	switch exp := expression.(type) {
 	case query.TagExpression:
-		buildTagQueryBranch(exp, builder, explicitOnly, ignoreCase)
+		if entities.IsPropertyTagName(exp.Name) {
+			buildPropertyQueryBranch(exp, builder, explicitOnly, ignoreCase)
+		} else {
+			buildTagQueryBranch(exp, builder, explicitOnly, ignoreCase)
+		}
 	case query.ComparisonExpression:
 		buildComparisonQueryBranch(exp, builder, explicitOnly, ignoreCase)
 	case query.NotExpression:
@@ -444,69 +745,202 @@ func buildTagQueryBranch(expression query.TagExpression, builder *SqlBuilder, ex
 		builder.AppendSql(`
 id IN (SELECT file_id
        FROM file_tag
-       WHERE tag_id = (SELECT id
-                       FROM tag
-                       WHERE name` + collation + ` = `)
-		builder.AppendParam(expression.Name)
+       WHERE tag_id IN `)
+		buildDescendantTagIds(expression.Name, builder, collation)
 		builder.AppendSql(`
-                       )
       )`)
 	} else {
 		builder.AppendSql(`
-id IN (SELECT file_id
+id IN (WITH RECURSIVE working (tag_id, value_id) AS
+       (
+           SELECT id, 0
+           FROM tag
+           WHERE id IN `)
+		buildDescendantTagIds(expression.Name, builder, collation)
+		builder.AppendSql(`
+           UNION
+           SELECT b.tag_id, b.value_id
+           FROM implication b, working
+           WHERE b.implied_tag_id = working.tag_id AND
+                 (b.implied_value_id = working.value_id OR working.value_id = 0)
+       )
+
+       SELECT file_id
        FROM file_tag
-       INNER JOIN (WITH RECURSIVE working (tag_id, value_id) AS
-                   (
-                       SELECT id, 0
-                       FROM tag
-                       WHERE name` + collation + ` = `)
-		builder.AppendParam(expression.Name)
+       INNER JOIN working
+       ON file_tag.tag_id = working.tag_id
+       AND (file_tag.value_id = working.value_id OR working.value_id = 0)`)
+		buildAttributeImplicationMatches("working", builder, collation)
 		builder.AppendSql(`
-                       UNION ALL
-                       SELECT b.tag_id, b.value_id
-                       FROM implication b, working
-                       WHERE b.implied_tag_id = working.tag_id AND
-                             (b.implied_value_id = working.value_id OR working.value_id = 0)
-                   )
-                   SELECT tag_id, value_id
-                   FROM working
-                  ) imps
-       ON file_tag.tag_id = imps.tag_id
-       AND (file_tag.value_id = imps.value_id OR imps.value_id = 0)
       )`)
 	}
 }
 
-func buildComparisonQueryBranch(expression query.ComparisonExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+// matches the files with the property as well as any tag of the same name
+func buildPropertyQueryBranch(expression query.TagExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
 	collation := collationFor(ignoreCase)
 
-	var valueTerm string
-	_, err := strconv.ParseFloat(expression.Value.Name, 64)
-	if err == nil {
-		valueTerm = "CAST(v.name AS float)"
-	} else {
-		valueTerm = "v.name"
-	}
+	builder.AppendSql(`(id IN (SELECT file_id
+       FROM property
+       WHERE name` + collation + ` = `)
+	builder.AppendParam(entities.PropertyName(expression.Name))
+	builder.AppendSql(`) OR `)
+	buildTagQueryBranch(expression, builder, explicitOnly, ignoreCase)
+	builder.AppendSql(")")
+}
+
+func buildComparisonQueryBranch(expression query.ComparisonExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+	collation := collationFor(ignoreCase)
 
-	if expression.Operator == "!=" {
+	switch expression.Operator {
+	case "!=":
 		// reinterprent as otherwise it won't work for multiple values of same tag
 		expression.Operator = "=="
 		builder.AppendSql(" not ")
+	case "!~":
+		expression.Operator = "~"
+		builder.AppendSql(" not ")
+	}
+
+	switch {
+	case expression.Tag.Name == entities.MimeTypeTagName:
+		// matches the detected MIME type as well as any tag of the same name
+		builder.AppendSql("(")
+		buildColumnComparison("mime_type", expression, builder, collation)
+		builder.AppendSql(" OR ")
+		buildTagComparison([]query.ComparisonExpression{expression}, builder, explicitOnly, collation)
+		builder.AppendSql(")")
+	case entities.IsPropertyTagName(expression.Tag.Name):
+		// likewise matches the property value as well as any tag of the same name
+		builder.AppendSql("(")
+		buildPropertyComparison(expression, builder, collation)
+		builder.AppendSql(" OR ")
+		buildTagComparison([]query.ComparisonExpression{expression}, builder, explicitOnly, collation)
+		builder.AppendSql(")")
+	case entities.IsBuiltInTagName(expression.Tag.Name), expression.Tag.Name == entities.NameTagName:
+		// likewise matches the file attribute as well as any tag of the same name
+		builder.AppendSql("(")
+		buildAttributeComparison(expression, builder, collation)
+		builder.AppendSql(" OR ")
+		buildTagComparison([]query.ComparisonExpression{expression}, builder, explicitOnly, collation)
+		builder.AppendSql(")")
+	default:
+		buildTagComparison([]query.ComparisonExpression{expression}, builder, explicitOnly, collation)
 	}
+}
+
+// compares the file attribute underlying a built-in tag: values that cannot be
+// interpreted as the attribute match no files
+func buildAttributeComparison(expression query.ComparisonExpression, builder *SqlBuilder, collation string) {
+	operator := expression.Operator
+
+	switch expression.Tag.Name {
+	case entities.NameTagName:
+		buildColumnComparison("name", expression, builder, collation)
+	case entities.SizeTagName:
+		size, err := entities.ParseFileSize(expression.Value.Name)
+		if err != nil || expression.IsTextMatch() {
+			builder.AppendSql("0 = 1")
+			return
+		}
+
+		builder.AppendSql("(is_dir = 0 AND size " + operator + " ")
+		builder.AppendParam(size)
+		builder.AppendSql(")")
+	case entities.ExtensionTagName:
+		// the extension is the text following the last '.' of the name
+		buildColumnComparison(`(CASE WHEN instr(name, '.') > 0
+                             THEN substr(name, length(rtrim(name, replace(name, '.', ''))) + 1)
+                             ELSE ''
+                        END)`, expression, builder, collation)
+	case entities.ModTimeTagName, entities.ModTimeAfterTagName, entities.ModTimeBeforeTagName:
+		modTime, err := entities.ParseModTime(expression.Value.Name)
+		if err != nil || expression.IsTextMatch() {
+			builder.AppendSql("0 = 1")
+			return
+		}
+
+		if expression.Tag.Name != entities.ModTimeTagName {
+			if operator != "=" && operator != "==" {
+				builder.AppendSql("0 = 1")
+				return
+			}
+
+			if expression.Tag.Name == entities.ModTimeAfterTagName {
+				operator = ">="
+			} else {
+				operator = "<"
+			}
+		}
+
+		// times are stored as text beginning 'YYYY-MM-DD HH:MM:SS' and so compare by prefix
+		builder.AppendSql("substr(mod_time, 1, " + strconv.Itoa(len(modTime)) + ") " + operator + " ")
+		builder.AppendParam(modTime)
+	case entities.TaggedAfterTagName, entities.TaggedBeforeTagName:
+		taggedTime, err := entities.ParseTaggedTime(expression.Value.Name)
+		if err != nil || (operator != "=" && operator != "==") {
+			builder.AppendSql("0 = 1")
+			return
+		}
+
+		if expression.Tag.Name == entities.TaggedAfterTagName {
+			operator = ">="
+		} else {
+			operator = "<"
+		}
+
+		// the files with any tag applied within the period, which excludes tags
+		// applied before the times were recorded
+		builder.AppendSql(`id IN (SELECT file_id
+       FROM file_tag
+       WHERE substr(applied, 1, ` + strconv.Itoa(len(taggedTime)) + ") " + operator + " ")
+		builder.AppendParam(taggedTime)
+		builder.AppendSql(")")
+	case entities.TaggedByTagName:
+		if operator != "=" && operator != "==" && operator != "~" && operator != "like" {
+			builder.AppendSql("0 = 1")
+			return
+		}
+
+		// the files with any tag applied by the user, which excludes tags
+		// applied before the users were recorded
+		builder.AppendSql(`id IN (SELECT file_id
+       FROM file_tag
+       WHERE `)
+		buildColumnComparison("applied_by", expression, builder, collation)
+		builder.AppendSql(")")
+	default:
+		builder.AppendSql("0 = 1")
+	}
+}
+
+// matches the files with the compared property and a value satisfying the comparison
+func buildPropertyComparison(expression query.ComparisonExpression, builder *SqlBuilder, collation string) {
+	builder.AppendSql(`id IN (SELECT file_id
+       FROM property
+       WHERE name` + collation + ` = `)
+	builder.AppendParam(entities.PropertyName(expression.Tag.Name))
+	builder.AppendSql(" AND ")
+	buildValueComparison("value", expression, builder, collation)
+	builder.AppendSql(")")
+}
+
+// matches the files tagged with the compared tag and a value satisfying any of
+// the comparisons, which are all of the same tag
+func buildTagComparison(expressions []query.ComparisonExpression, builder *SqlBuilder, explicitOnly bool, collation string) {
+	tagName := expressions[0].Tag.Name
 
 	if explicitOnly {
 		builder.AppendSql(`
 id IN (SELECT file_id
        FROM file_tag
-       WHERE tag_id = (SELECT id
-                       FROM tag
-                       WHERE name` + collation + ` = `)
-		builder.AppendParam(expression.Tag.Name)
-		builder.AppendSql(`) AND
-             value_id = (SELECT id
-                         FROM value
-                         WHERE name` + collation + ` = `)
-		builder.AppendParam(expression.Value.Name)
+       WHERE tag_id IN `)
+		buildDescendantTagIds(tagName, builder, collation)
+		builder.AppendSql(` AND
+             value_id IN (SELECT v.id
+                          FROM value v
+                          WHERE `)
+		buildValueComparisons(expressions, builder, collation)
 		builder.AppendSql(`)
      )`)
 	} else {
@@ -515,12 +949,12 @@ id IN (WITH RECURSIVE impft (tag_id, value_id) AS
        (
            SELECT t.id, v.id
            FROM tag t, value v
-           WHERE t.name` + collation + ` = `)
-		builder.AppendParam(expression.Tag.Name)
-		builder.AppendSql("AND " + valueTerm + collation + " " + expression.Operator + " ")
-		builder.AppendParam(expression.Value.Name)
+           WHERE t.id IN `)
+		buildDescendantTagIds(tagName, builder, collation)
+		builder.AppendSql(" AND ")
+		buildValueComparisons(expressions, builder, collation)
 		builder.AppendSql(`
-           UNION ALL
+           UNION
            SELECT b.tag_id, b.value_id
            FROM implication b, impft
            WHERE b.implied_tag_id = impft.tag_id AND
@@ -531,23 +965,204 @@ id IN (WITH RECURSIVE impft (tag_id, value_id) AS
        FROM file_tag
        INNER JOIN impft
        ON file_tag.tag_id = impft.tag_id AND
-          file_tag.value_id = impft.value_id
+          file_tag.value_id = impft.value_id`)
+		buildAttributeImplicationMatches("impft", builder, collation)
+		builder.AppendSql(`
       )`)
 	}
 }
 
+// the files whose attributes satisfy the conditions of the implications, such as
+// 'ext=raw -> photo', amongst the tag and value pairs of the named working set
+func buildAttributeImplicationMatches(working string, builder *SqlBuilder, collation string) {
+	builder.AppendSql(`
+       UNION
+       SELECT f.id
+       FROM file f, ` + working + ` imp, tag t, value v
+       WHERE t.id = imp.tag_id AND
+             v.id = imp.value_id AND
+             ((t.name = '` + entities.MimeTypeTagName + `' AND f.mime_type` + collation + ` = v.name) OR
+              (t.name = '` + entities.ExtensionTagName + `' AND instr(f.name, '.') > 0 AND
+               substr(f.name, length(rtrim(f.name, replace(f.name, '.', ''))) + 1)` + collation + ` = v.name) OR
+              (t.name = '` + entities.ModTimeTagName + `' AND
+               substr(f.mod_time, 1, length(v.name)) = replace(v.name, 'T', ' ')) OR
+              (t.name = '` + entities.ModTimeAfterTagName + `' AND
+               substr(f.mod_time, 1, length(v.name)) >= replace(v.name, 'T', ' ')) OR
+              (t.name = '` + entities.ModTimeBeforeTagName + `' AND
+               substr(f.mod_time, 1, length(v.name)) < replace(v.name, 'T', ' ')))`)
+}
+
+// compares values against those of the comparisons, using a single IN clause
+// where several values are tested for equality
+func buildValueComparisons(expressions []query.ComparisonExpression, builder *SqlBuilder, collation string) {
+	if len(expressions) == 1 {
+		buildValueComparison("v.name", expressions[0], builder, collation)
+		return
+	}
+
+	buildValueList := func(cast string) {
+		for index, expression := range expressions {
+			if index > 0 {
+				builder.AppendSql(", ")
+			}
+
+			if cast == "" {
+				builder.AppendParam(expression.Value.Name)
+			} else {
+				builder.AppendSql("CAST(")
+				builder.AppendParam(expression.Value.Name)
+				builder.AppendSql(" AS " + cast + ")")
+			}
+		}
+		builder.AppendSql(")")
+	}
+
+	value := expressions[0].Value
+
+	switch {
+	case value.Type == string(entities.IntegerValues):
+		builder.AppendSql(`(v.name GLOB '*[0-9]*' AND
+                            v.name NOT GLOB '*[^0-9+-]*' AND
+                            CAST(v.name AS integer) IN (`)
+		buildValueList("integer")
+		builder.AppendSql(")")
+	case value.Type == string(entities.DateValues):
+		builder.AppendSql(`(v.name GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]' AND
+                            v.name IN (`)
+		buildValueList("")
+		builder.AppendSql(")")
+	case value.Type == "" && value.IsNumeric():
+		builder.AppendSql(`(v.name GLOB '*[0-9]*' AND
+                            v.name NOT GLOB '*[^0-9.eE+-]*' AND
+                            CAST(v.name AS float) IN (`)
+		buildValueList("float")
+		builder.AppendSql(")")
+	default:
+		builder.AppendSql("v.name" + collation + " IN (")
+		buildValueList("")
+	}
+}
+
+// the equality comparisons of a chain of alternatives, which can be made with a
+// single IN clause if they compare the same tag's values in the same way, or
+// nil if they cannot
+func equalityAlternatives(expression query.Expression) []query.ComparisonExpression {
+	switch exp := expression.(type) {
+	case query.OrExpression:
+		left := equalityAlternatives(exp.LeftOperand)
+		right := equalityAlternatives(exp.RightOperand)
+		if left == nil || right == nil {
+			return nil
+		}
+
+		first, other := left[0], right[0]
+		if first.Tag.Name != other.Tag.Name || first.Value.Type != other.Value.Type || first.Value.IsNumeric() != other.Value.IsNumeric() {
+			return nil
+		}
+
+		return append(left, right...)
+	case query.ComparisonExpression:
+		if exp.Operator != "=" && exp.Operator != "==" {
+			return nil
+		}
+		if exp.Tag.Name == entities.MimeTypeTagName || exp.Tag.Name == entities.NameTagName || entities.IsBuiltInTagName(exp.Tag.Name) || entities.IsPropertyTagName(exp.Tag.Name) {
+			// also compared against the file attributes or properties
+			return nil
+		}
+
+		return []query.ComparisonExpression{exp}
+	default:
+		return nil
+	}
+}
+
+// compares the values in the column according to the compared tag's value type, if
+// it has one, otherwise numerically if the query value is a number or as text if not
+func buildValueComparison(column string, expression query.ComparisonExpression, builder *SqlBuilder, collation string) {
+	switch {
+	case expression.IsTextMatch():
+		buildColumnComparison(column, expression, builder, collation)
+	case expression.Value.Type == string(entities.IntegerValues):
+		// values applied before the tag was typed might not be integers
+		builder.AppendSql(`(` + column + ` GLOB '*[0-9]*' AND
+                            ` + column + ` NOT GLOB '*[^0-9+-]*' AND
+                            CAST(` + column + ` AS integer) ` + expression.Operator + ` CAST(`)
+		builder.AppendParam(expression.Value.Name)
+		builder.AppendSql(` AS integer))`)
+	case expression.Value.Type == string(entities.DateValues):
+		// dates are stored as YYYY-MM-DD and so compare chronologically by name
+		builder.AppendSql(`(` + column + ` GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]' AND
+                            ` + column + ` ` + expression.Operator + ` `)
+		builder.AppendParam(expression.Value.Name)
+		builder.AppendSql(`)`)
+	case expression.Value.Type == "" && expression.Value.IsNumeric():
+		// values that are not themselves numbers take no part in numeric comparisons
+		builder.AppendSql(`(` + column + ` GLOB '*[0-9]*' AND
+                            ` + column + ` NOT GLOB '*[^0-9.eE+-]*' AND
+                            CAST(` + column + ` AS float) ` + expression.Operator + ` CAST(`)
+		builder.AppendParam(expression.Value.Name)
+		builder.AppendSql(` AS float))`)
+	default:
+		buildColumnComparison(column, expression, builder, collation)
+	}
+}
+
+// compares the column with the value, matching it against the value as a regular
+// expression for the '~' operator, case-insensitively if the collation ignores case
+func buildColumnComparison(column string, expression query.ComparisonExpression, builder *SqlBuilder, collation string) {
+	if expression.Operator == "~" {
+		pattern := expression.Value.Name
+		if collation != "" {
+			pattern = "(?i)" + pattern
+		}
+
+		builder.AppendSql(column + " REGEXP ")
+		builder.AppendParam(pattern)
+		return
+	}
+
+	builder.AppendSql(column + collation + " " + expression.Operator + " ")
+	builder.AppendParam(expression.Value.Name)
+}
+
+// the tag together with any tags beneath it in the tag hierarchy
+func buildDescendantTagIds(tagName string, builder *SqlBuilder, collation string) {
+	builder.AppendSql(`(WITH RECURSIVE descendant (id) AS
+                    (
+                        SELECT id
+                        FROM tag
+                        WHERE name` + collation + ` = `)
+	builder.AppendParam(tagName)
+	builder.AppendSql(`
+                        UNION
+                        SELECT tag.id
+                        FROM tag, descendant
+                        WHERE tag.parent_id = descendant.id
+                    )
+                    SELECT id
+                    FROM descendant)`)
+}
+
 func buildNotQueryBranch(expression query.NotExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
-	builder.AppendSql("NOT")
+	builder.AppendSql("NOT (")
 	buildQueryBranch(expression.Operand, builder, explicitOnly, ignoreCase)
+	builder.AppendSql(")")
 }
 
 func buildAndQueryBranch(expression query.AndExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+	builder.AppendSql("(")
 	buildQueryBranch(expression.LeftOperand, builder, explicitOnly, ignoreCase)
 	builder.AppendSql("AND")
 	buildQueryBranch(expression.RightOperand, builder, explicitOnly, ignoreCase)
+	builder.AppendSql(")")
 }
 
 func buildOrQueryBranch(expression query.OrExpression, builder *SqlBuilder, explicitOnly, ignoreCase bool) {
+	if alternatives := equalityAlternatives(expression); alternatives != nil {
+		buildTagComparison(alternatives, builder, explicitOnly, collationFor(ignoreCase))
+		return
+	}
+
 	builder.AppendSql("(")
 	buildQueryBranch(expression.LeftOperand, builder, explicitOnly, ignoreCase)
 	builder.AppendSql("OR")
@@ -555,51 +1170,139 @@ func buildOrQueryBranch(expression query.OrExpression, builder *SqlBuilder, expl
 	builder.AppendSql(")")
 }
 
-func buildPathClause(path string, pathContainsRoot bool, builder *SqlBuilder) {
-	if path == "" {
+// restricts the files to those at or beneath any of the paths. Directories are
+// compared by range rather than with LIKE so that the index on the file path
+// can be used and so that wildcard characters within paths are not special.
+func buildPathClause(paths []string, pathContainsRoot bool, builder *SqlBuilder) {
+	if len(paths) == 0 {
 		return
 	}
 
-	path = filepath.Clean(path)
-
 	builder.AppendSql("AND (")
 
+	for index, path := range paths {
+		if index > 0 {
+			builder.AppendSql(" OR ")
+		}
+
+		buildPathPredicate(filepath.Clean(path), builder)
+	}
+
+	if pathContainsRoot {
+		builder.AppendSql(" OR ")
+		buildRelativeDirectoryPredicate(builder)
+	}
+
+	builder.AppendSql(")")
+}
+
+func buildPathPredicate(path string, builder *SqlBuilder) {
 	if path == "." {
-		builder.AppendSql("directory NOT LIKE '/%'")
-	} else {
-		builder.AppendSql("directory = ")
-		builder.AppendParam(path)
-		builder.AppendSql(" OR directory LIKE ")
-		builder.AppendParam(filepath.Join(path, "%"))
+		buildRelativeDirectoryPredicate(builder)
+		return
+	}
 
-		if pathContainsRoot {
-			builder.AppendSql(" OR directory NOT LIKE '/%'")
-		}
+	prefix := path
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
 	}
 
+	// the directories beginning with the prefix sort before the prefix with
+	// its trailing separator incremented
+	limit := prefix[:len(prefix)-1] + string(filepath.Separator+1)
+
+	builder.AppendSql("directory = ")
+	builder.AppendParam(path)
+	builder.AppendSql(" OR (directory >= ")
+	builder.AppendParam(prefix)
+	builder.AppendSql(" AND directory < ")
+	builder.AppendParam(limit)
+	builder.AppendSql(")")
+
+	// the path may itself be a file
 	dir, name := filepath.Split(path)
-	if dir != "" {
+	if name != "" {
 		builder.AppendSql(" OR (directory = ")
 		builder.AppendParam(filepath.Clean(dir))
 		builder.AppendSql(" AND name = ")
 		builder.AppendParam(name)
 		builder.AppendSql(")")
 	}
+}
 
+// matches the directories stored relative to the root path: absolute
+// directories begin with the separator or, on Windows, a drive letter
+func buildRelativeDirectoryPredicate(builder *SqlBuilder) {
+	builder.AppendSql("(directory NOT LIKE ")
+	builder.AppendParam(string(filepath.Separator) + "%")
+	if runtime.GOOS == "windows" {
+		builder.AppendSql(" AND directory NOT LIKE '_:%'")
+	}
 	builder.AppendSql(")")
 }
 
-func buildSort(sort string, builder *SqlBuilder) {
+// the collation for comparing paths, which ignores case on file systems that
+// are case-insensitive
+func pathCollation() string {
+	if _path.CaseSensitive {
+		return ""
+	}
+
+	return " COLLATE NOCASE"
+}
+
+func buildNotesClause(notes string, builder *SqlBuilder) {
+	if notes == "" {
+		return
+	}
+
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(notes)
+
+	builder.AppendSql("AND id IN (SELECT file_id FROM note WHERE text LIKE ")
+	builder.AppendParam("%" + pattern + "%")
+	builder.AppendSql(` ESCAPE '\')`)
+}
+
+// the paths are compared with the specified collation, if any, so that the
+// names of the files are ordered for the reader
+func buildSort(sort string, reverse bool, nameCollation string, builder *SqlBuilder) {
+	path := "directory || '/' || name"
+	if nameCollation != "" {
+		path = "(" + path + ")" + nameCollation
+	}
+
+	var columns []string
 	switch sort {
 	case "none":
-		// do nowt
+		return
 	case "id":
-		builder.AppendSql("ORDER BY id")
+		columns = []string{"id"}
 	case "name":
-		builder.AppendSql("ORDER BY directory || '/' || name")
-	case "time":
-		builder.AppendSql("ORDER BY mod_time, directory || '/' || name")
+		columns = []string{path}
+	case "time", "mtime":
+		columns = []string{"mod_time", path}
 	case "size":
-		builder.AppendSql("ORDER BY size, directory || '/' || name")
+		columns = []string{"size", path}
+	case "tag-count":
+		columns = []string{"(SELECT count(1) FROM file_tag WHERE file_tag.file_id = file.id)", path}
+	default:
+		return
 	}
+
+	if reverse {
+		for index := range columns {
+			columns[index] += " DESC"
+		}
+	}
+
+	builder.AppendSql("ORDER BY " + strings.Join(columns, ", "))
+}
+
+func buildLimit(limit uint, builder *SqlBuilder) {
+	if limit == 0 {
+		return
+	}
+
+	builder.AppendSql("LIMIT ")
+	builder.AppendParam(limit)
 }
@@ -0,0 +1,161 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/query"
+	"testing"
+)
+
+func TestFileCursorReadsPages(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	for id := 1; id <= 5; id++ {
+		statement := fmt.Sprintf("INSERT INTO file (id, directory, name, fingerprint, mod_time, size, is_dir, mime_type) VALUES (%v, '/tmp', 'file%v', '', '2020-01-01', 0, 0, '')", id, id)
+		if _, err := tx.Exec(statement); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	wrapped := &Tx{tx, nil, nil}
+
+	// test
+
+	cursor, err := FileCursorForQuery(wrapped, query.EmptyExpression{}, nil, "", false, false, false, "name", false, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer cursor.Close()
+
+	pageSizes := make([]int, 0, 3)
+	names := make([]string, 0, 5)
+	for {
+		files, err := cursor.Next(2)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		pageSizes = append(pageSizes, len(files))
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+	}
+
+	// validate
+
+	if fmt.Sprint(pageSizes) != "[2 2 1]" {
+		test.Fatalf("Unexpected page sizes %v", pageSizes)
+	}
+	if fmt.Sprint(names) != "[file1 file2 file3 file4 file5]" {
+		test.Fatalf("Unexpected files %v", names)
+	}
+}
+
+func TestUntaggedFileCursor(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	for id := 1; id <= 3; id++ {
+		statement := fmt.Sprintf("INSERT INTO file (id, directory, name, fingerprint, mod_time, size, is_dir, mime_type) VALUES (%v, '/tmp', 'file%v', '', '2020-01-01', 0, 0, '')", id, 4-id)
+		if _, err := tx.Exec(statement); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (2, 1, 0)"); err != nil {
+		test.Fatal(err)
+	}
+
+	wrapped := &Tx{tx, nil, nil}
+
+	// test
+
+	cursor, err := UntaggedFileCursor(wrapped)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer cursor.Close()
+
+	files, err := cursor.Next(10)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	if fmt.Sprint(names) != "[file1 file3]" {
+		test.Fatalf("Unexpected files %v", names)
+	}
+}
+
+func TestFilesForQueriesCombinesResults(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	statements := []string{"INSERT INTO tag (id, name) VALUES (1, 'aubergine'), (2, 'banana')"}
+	for id := 1; id <= 3; id++ {
+		statements = append(statements, fmt.Sprintf("INSERT INTO file (id, directory, name, fingerprint, mod_time, size, is_dir, mime_type) VALUES (%v, '/tmp', 'file%v', '', '2020-01-01', 0, 0, '')", id, id))
+	}
+	statements = append(statements, "INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (1, 1, 0), (2, 1, 0), (2, 2, 0), (3, 2, 0)")
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	wrapped := &Tx{tx, nil, nil}
+	aubergine := query.TagExpression{Name: "aubergine"}
+	banana := query.TagExpression{Name: "banana"}
+
+	// test
+
+	difference, err := FilesForQueries(wrapped, aubergine, banana, Difference, nil, false, false, false, "name")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	intersection, err := FilesForQueries(wrapped, aubergine, banana, Intersection, nil, false, false, false, "name")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(difference) != 1 || difference[0].Name != "file1" {
+		test.Fatalf("Unexpected difference %v", difference.Paths())
+	}
+	if len(intersection) != 1 || intersection[0].Name != "file2" {
+		test.Fatalf("Unexpected intersection %v", intersection.Paths())
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the identity recorded for the specified file.
+func FileIdentityByFileId(tx *Tx, fileId entities.FileId) (*entities.FileIdentity, error) {
+	sql := `
+SELECT file_id, device, inode
+FROM file_identity
+WHERE file_id = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileIdentity(rows)
+}
+
+// Adds or replaces the identity recorded for the specified file.
+func UpdateFileIdentity(tx *Tx, identity entities.FileIdentity) error {
+	sql := `
+INSERT OR REPLACE INTO file_identity (file_id, device, inode)
+VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(sql, identity.FileId, int64(identity.Device), int64(identity.Inode))
+	return err
+}
+
+// Deletes the identity recorded for the specified file, if any.
+func DeleteFileIdentity(tx *Tx, fileId entities.FileId) error {
+	sql := `
+DELETE FROM file_identity
+WHERE file_id = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	return err
+}
+
+// Deletes the identities of files that are no longer in the database.
+func DeleteOrphanedFileIdentities(tx *Tx) error {
+	sql := `
+DELETE FROM file_identity
+WHERE file_id NOT IN (SELECT id
+                      FROM file)`
+
+	_, err := tx.Exec(sql)
+	return err
+}
+
+// unexported
+
+func readFileIdentity(rows *sql.Rows) (*entities.FileIdentity, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var fileId entities.FileId
+	var device, inode int64
+	if err := rows.Scan(&fileId, &device, &inode); err != nil {
+		return nil, err
+	}
+
+	return &entities.FileIdentity{fileId, uint64(device), uint64(inode)}, nil
+}
@@ -18,6 +18,7 @@ package database
 import (
 	"database/sql"
 	"github.com/oniony/TMSU/entities"
+	"time"
 )
 
 // Determines whether the specified file has the specified tag applied.
@@ -57,7 +58,7 @@ FROM file_tag`
 // Retrieves the complete set of file tags.
 func FileTags(tx *Tx) (entities.FileTags, error) {
 	sql := `
-SELECT file_id, tag_id, value_id
+SELECT file_id, tag_id, value_id, applied, applied_by
 FROM file_tag`
 
 	rows, err := tx.Query(sql)
@@ -105,10 +106,26 @@ WHERE tag_id = ?1`
 	return readCount(rows)
 }
 
+// Retrieves the number of files tagged with the specified tag.
+func FileCountByTagId(tx *Tx, tagId entities.TagId) (uint, error) {
+	sql := `
+SELECT count(DISTINCT file_id)
+FROM file_tag
+WHERE tag_id = ?1`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
 // Retrieves the set of file tags with the specified tag ID.
 func FileTagsByTagId(tx *Tx, tagId entities.TagId) (entities.FileTags, error) {
 	sql := `
-SELECT file_id, tag_id, value_id
+SELECT file_id, tag_id, value_id, applied, applied_by
 FROM file_tag
 WHERE tag_id = ?1`
 
@@ -139,10 +156,26 @@ WHERE value_id = ?1`
 	return readCount(rows)
 }
 
+// Retrieves the number of files tagged with the specified value.
+func FileCountByValueId(tx *Tx, valueId entities.ValueId) (uint, error) {
+	sql := `
+SELECT count(DISTINCT file_id)
+FROM file_tag
+WHERE value_id = ?1`
+
+	rows, err := tx.Query(sql, valueId)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
 // Retrieves the set of file tags with the specified value ID.
 func FileTagsByValueId(tx *Tx, valueId entities.ValueId) (entities.FileTags, error) {
 	sql := `
-SELECT file_id, tag_id, value_id
+SELECT file_id, tag_id, value_id, applied, applied_by
 FROM file_tag
 WHERE value_id = ?1`
 
@@ -158,7 +191,7 @@ WHERE value_id = ?1`
 // Retrieves the set of file tags for the specified file.
 func FileTagsByFileId(tx *Tx, fileId entities.FileId) (entities.FileTags, error) {
 	sql := `
-SELECT file_id, tag_id, value_id
+SELECT file_id, tag_id, value_id, applied, applied_by
 FROM file_tag
 WHERE file_id = ?1`
 
@@ -171,18 +204,23 @@ WHERE file_id = ?1`
 	return readFileTags(rows, make(entities.FileTags, 0, 10))
 }
 
-// Adds a file tag.
-func AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
+// Adds a file tag, recording the time at which and the user by whom it was
+// applied unless it is already applied.
+func AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, applied time.Time, appliedBy string) (*entities.FileTag, error) {
+	// the time and user are left null when not known
+	at := sql.NullTime{applied, !applied.IsZero()}
+	by := sql.NullString{appliedBy, appliedBy != ""}
+
 	sql := `
-INSERT OR IGNORE INTO file_tag (file_id, tag_id, value_id)
-VALUES (?1, ?2, ?3)`
+INSERT OR IGNORE INTO file_tag (file_id, tag_id, value_id, applied, applied_by)
+VALUES (?1, ?2, ?3, ?4, ?5)`
 
-	_, err := tx.Exec(sql, fileId, tagId, valueId)
+	_, err := tx.Exec(sql, fileId, tagId, valueId, at, by)
 	if err != nil {
 		return nil, err
 	}
 
-	return &entities.FileTag{fileId, tagId, valueId, true, false}, nil
+	return &entities.FileTag{fileId, tagId, valueId, true, false, applied, appliedBy}, nil
 }
 
 // Removes a file tag.
@@ -252,11 +290,11 @@ WHERE value_id = ?`
 	return nil
 }
 
-// Copies file tags from one tag to another.
+// Copies file tags from one tag to another, together with the times at which and the users by whom they were applied.
 func CopyFileTags(tx *Tx, sourceTagId entities.TagId, destTagId entities.TagId) error {
 	sql := `
-INSERT INTO file_tag (file_id, tag_id, value_id)
-SELECT file_id, ?2, value_id
+INSERT INTO file_tag (file_id, tag_id, value_id, applied, applied_by)
+SELECT file_id, ?2, value_id, applied, applied_by
 FROM file_tag
 WHERE tag_id = ?1`
 
@@ -279,12 +317,14 @@ func readFileTags(rows *sql.Rows, fileTags entities.FileTags) (entities.FileTags
 		var fileId entities.FileId
 		var tagId entities.TagId
 		var valueId entities.ValueId
-		err := rows.Scan(&fileId, &tagId, &valueId)
+		var applied sql.NullTime
+		var appliedBy sql.NullString
+		err := rows.Scan(&fileId, &tagId, &valueId, &applied, &appliedBy)
 		if err != nil {
 			return nil, err
 		}
 
-		fileTags = append(fileTags, &entities.FileTag{entities.FileId(fileId), tagId, valueId, true, false})
+		fileTags = append(fileTags, &entities.FileTag{entities.FileId(fileId), tagId, valueId, true, false, applied.Time, appliedBy.String})
 	}
 
 	return fileTags, nil
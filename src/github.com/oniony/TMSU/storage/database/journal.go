@@ -0,0 +1,371 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"strings"
+	"time"
+)
+
+// Retrieves the most recent operations, latest first.
+func LatestOperations(tx *Tx, count uint) (entities.Operations, error) {
+	sql := `
+SELECT id, command, time
+FROM operation
+ORDER BY id DESC
+LIMIT ?`
+
+	rows, err := tx.Query(sql, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperations(rows, make(entities.Operations, 0, count))
+}
+
+// Begins a new operation. The changes made to the journaled tables are
+// recorded against this operation until it is ended.
+func InsertOperation(tx *Tx, command string) (*entities.Operation, error) {
+	sql := `
+INSERT INTO operation (command, time, open)
+VALUES (?, ?, 1)`
+
+	now := time.Now().UTC()
+
+	result, err := tx.Exec(sql, command, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Operation{entities.OperationId(id), command, now}, nil
+}
+
+// Ends the open operations so that further changes are not recorded. Open
+// operations that made no changes are discarded.
+func EndOperations(tx *Tx) error {
+	sql := `
+DELETE FROM operation
+WHERE open = 1 AND id NOT IN (SELECT DISTINCT operation_id
+                              FROM journal)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `
+UPDATE operation
+SET open = 0
+WHERE open = 1`
+
+	_, err := tx.Exec(sql)
+	return err
+}
+
+// The number of rows of a table that an operation inserted, updated and deleted.
+type RowCounts struct {
+	Inserted uint `json:"inserted,omitempty"`
+	Updated  uint `json:"updated,omitempty"`
+	Deleted  uint `json:"deleted,omitempty"`
+}
+
+// Retrieves the operations that have not yet been ended.
+func OpenOperations(tx *Tx) (entities.Operations, error) {
+	sql := `
+SELECT id, command, time
+FROM operation
+WHERE open = 1
+ORDER BY id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperations(rows, make(entities.Operations, 0, 1))
+}
+
+// Counts the rows of each table changed by the specified operation, as
+// determined from the statements recorded to reverse its changes.
+func OperationChanges(tx *Tx, operationId entities.OperationId) (map[string]RowCounts, error) {
+	sql := `
+SELECT substr(statement, 1, 64)
+FROM journal
+WHERE operation_id = ?`
+
+	rows, err := tx.Query(sql, operationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make(map[string]RowCounts)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			return nil, err
+		}
+
+		// each statement is the inverse of the change made
+		words := strings.Fields(statement)
+		if len(words) < 3 {
+			continue
+		}
+
+		switch words[0] {
+		case "DELETE":
+			counts := changes[words[2]]
+			counts.Inserted++
+			changes[words[2]] = counts
+		case "INSERT":
+			counts := changes[words[2]]
+			counts.Deleted++
+			changes[words[2]] = counts
+		case "UPDATE":
+			counts := changes[words[1]]
+			counts.Updated++
+			changes[words[1]] = counts
+		}
+	}
+
+	return changes, nil
+}
+
+// Reverts the changes recorded for the specified operation and removes the
+// operation from the journal.
+func UndoOperation(tx *Tx, operationId entities.OperationId) error {
+	sql := `
+SELECT statement
+FROM journal
+WHERE operation_id = ?
+ORDER BY id DESC`
+
+	rows, err := tx.Query(sql, operationId)
+	if err != nil {
+		return err
+	}
+
+	statements := make([]string, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			rows.Close()
+			return rows.Err()
+		}
+
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			rows.Close()
+			return err
+		}
+
+		statements = append(statements, statement)
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return DeleteOperation(tx, operationId)
+}
+
+// Deletes an operation and its journal entries.
+func DeleteOperation(tx *Tx, operationId entities.OperationId) error {
+	sql := `
+DELETE FROM journal
+WHERE operation_id = ?`
+
+	if _, err := tx.Exec(sql, operationId); err != nil {
+		return err
+	}
+
+	sql = `
+DELETE FROM operation
+WHERE id = ?`
+
+	if _, err := tx.Exec(sql, operationId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all but the most recent operations.
+func PruneOperations(tx *Tx, keep uint) error {
+	sql := `
+DELETE FROM journal
+WHERE operation_id NOT IN (SELECT id
+                           FROM operation
+                           ORDER BY id DESC
+                           LIMIT ?)`
+
+	if _, err := tx.Exec(sql, keep); err != nil {
+		return err
+	}
+
+	sql = `
+DELETE FROM operation
+WHERE id NOT IN (SELECT id
+                 FROM operation
+                 ORDER BY id DESC
+                 LIMIT ?)`
+
+	if _, err := tx.Exec(sql, keep); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+// a table whose changes are recorded in the journal
+type journaledTable struct {
+	name        string
+	keyColumns  []string
+	dataColumns []string
+}
+
+var journaledTables = []journaledTable{
+	{"file", []string{"id"}, []string{"directory", "name", "fingerprint", "mod_time", "size", "is_dir", "mime_type"}},
+	{"tag", []string{"id"}, []string{"name", "parent_id"}},
+	{"value", []string{"id"}, []string{"name"}},
+	{"file_tag", []string{"file_id", "tag_id", "value_id"}, []string{"applied", "applied_by"}},
+	{"content_tag", []string{"fingerprint", "tag_id", "value_id"}, nil},
+	{"implication", []string{"tag_id", "value_id", "implied_tag_id", "implied_value_id"}, nil},
+	{"alias", []string{"name"}, []string{"tag_id"}},
+	{"note", []string{"file_id"}, []string{"text"}},
+	{"file_identity", []string{"file_id"}, []string{"device", "inode"}},
+	{"property", []string{"file_id", "name"}, []string{"value"}},
+	{"tag_type", []string{"tag_id"}, []string{"type"}},
+	{"tag_info", []string{"tag_id"}, []string{"description", "colour", "icon"}},
+	{"tag_constraint", []string{"tag_id"}, []string{"pattern", "default_value"}},
+	{"tag_group", []string{"tag_id"}, []string{"name"}},
+}
+
+func readOperation(rows *sql.Rows) (*entities.Operation, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var id entities.OperationId
+	var command string
+	var time time.Time
+	err := rows.Scan(&id, &command, &time)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Operation{id, command, time}, nil
+}
+
+func readOperations(rows *sql.Rows, operations entities.Operations) (entities.Operations, error) {
+	for {
+		operation, err := readOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		if operation == nil {
+			break
+		}
+
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+// Each trigger records the statement that reverses the change it observes.
+// The statements are only recorded whilst an operation is open.
+func createJournalTriggers(tx *sql.Tx) error {
+	for _, table := range journaledTables {
+		if !tableExists(tx, table.name) {
+			// tables added by later upgrades are journaled once created
+			continue
+		}
+
+		allColumns := append(append([]string{}, table.keyColumns...), table.dataColumns...)
+
+		insertInverse := fmt.Sprintf("'DELETE FROM %v WHERE ' || %v", table.name, quotedAssignments(table.keyColumns, "new", " AND "))
+		if err := createJournalTrigger(tx, table.name, "insert", insertInverse); err != nil {
+			return err
+		}
+
+		values := make([]string, len(allColumns))
+		for index, column := range allColumns {
+			values[index] = "quote(old." + column + ")"
+		}
+		deleteInverse := fmt.Sprintf("'INSERT INTO %v (%v) VALUES (' || %v || ')'", table.name, strings.Join(allColumns, ", "), strings.Join(values, " || ', ' || "))
+		if err := createJournalTrigger(tx, table.name, "delete", deleteInverse); err != nil {
+			return err
+		}
+
+		if len(table.dataColumns) > 0 {
+			updateInverse := fmt.Sprintf("'UPDATE %v SET ' || %v || ' WHERE ' || %v", table.name, quotedAssignments(table.dataColumns, "old", ", "), quotedAssignments(table.keyColumns, "old", " AND "))
+			if err := createJournalTrigger(tx, table.name, "update", updateInverse); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func createJournalTrigger(tx *sql.Tx, tableName, event, inverse string) error {
+	sql := fmt.Sprintf(`
+CREATE TRIGGER IF NOT EXISTS trg_%[1]v_%[2]v_journal
+AFTER %[3]v ON %[1]v
+WHEN EXISTS (SELECT 1 FROM operation WHERE open = 1)
+BEGIN
+    INSERT INTO journal (operation_id, statement)
+    VALUES ((SELECT max(id) FROM operation WHERE open = 1), %[4]v);
+END`, tableName, event, strings.ToUpper(event), inverse)
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// builds an SQL expression that yields "column = value" for each column,
+// joined by the separator, using the column values of the specified row
+func quotedAssignments(columns []string, row, separator string) string {
+	assignments := make([]string, len(columns))
+	for index, column := range columns {
+		assignments[index] = fmt.Sprintf("'%v = ' || quote(%v.%v)", column, row, column)
+	}
+
+	return strings.Join(assignments, fmt.Sprintf(" || '%v' || ", separator))
+}
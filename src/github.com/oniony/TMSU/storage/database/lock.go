@@ -0,0 +1,231 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The extension of the lock file beside the database.
+const LockExtension = ".lock"
+
+// A lock, cooperatively taken by the processes that change the database, which
+// they wait in turn for rather than failing because the database is locked.
+// The lock is held on a file beside the database, within which the process
+// holding it is described so that those waiting can report what they wait for.
+// It may be acquired more than once within a process, including by different
+// connections to the same database, and is released once it has been released
+// as many times.
+type Lock struct {
+	sync.Mutex
+	path    string
+	timeout time.Duration
+	file    *os.File
+	holds   uint
+}
+
+// The lock on the database at the path, which is waited for for up to the timeout.
+func NewLock(dbPath string, timeout time.Duration) *Lock {
+	path := dbPath + LockExtension
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+
+	processLocks.Lock()
+	defer processLocks.Unlock()
+
+	lock, ok := processLocks.locks[path]
+	if !ok {
+		lock = &Lock{path: path}
+		processLocks.locks[path] = lock
+	}
+
+	lock.Lock()
+	lock.timeout = timeout
+	lock.Unlock()
+
+	return lock
+}
+
+type LockTimeoutError struct {
+	Path    string
+	Timeout time.Duration
+	Holder  string
+}
+
+func (err LockTimeoutError) Error() string {
+	if err.Holder == "" {
+		return fmt.Sprintf("timed out after %v waiting for the lock on the database", err.Timeout)
+	}
+
+	return fmt.Sprintf("timed out after %v waiting for the lock on the database held by %v", err.Timeout, err.Holder)
+}
+
+// Acquires the lock, waiting for any other process holding it to release it.
+func (lock *Lock) Acquire() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lock.holds > 0 {
+		lock.holds++
+		return nil
+	}
+
+	file, err := os.OpenFile(lock.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open lock file '%v': %w", lock.path, err)
+	}
+
+	if err := lock.wait(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	// describes this process to any that wait for the lock
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(lockHolder()), 0)
+	}
+
+	lock.file = file
+	lock.holds = 1
+
+	return nil
+}
+
+// Releases the lock.
+func (lock *Lock) Release() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lock.holds == 0 {
+		return nil
+	}
+
+	lock.holds--
+	if lock.holds > 0 {
+		return nil
+	}
+
+	file := lock.file
+	lock.file = nil
+
+	file.Truncate(0)
+	if err := unlockFile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("could not release lock file '%v': %w", lock.path, err)
+	}
+
+	return file.Close()
+}
+
+// unexported
+
+// the locks taken by this process, by path, as a process cannot wait for a lock
+// on a file that it itself holds
+var processLocks = struct {
+	sync.Mutex
+	locks map[string]*Lock
+}{locks: make(map[string]*Lock)}
+
+// how often the progress of a wait for the lock is reported
+const lockReportInterval = 5 * time.Second
+
+// the longest between attempts to take the lock
+const lockMaxRetryInterval = 250 * time.Millisecond
+
+// waits for up to the timeout to lock the file, with a growing interval between
+// attempts, reporting what is being waited for in verbose mode
+func (lock *Lock) wait(file *os.File) error {
+	locked, err := tryLockFile(file)
+	if err != nil {
+		return fmt.Errorf("could not take lock file '%v': %w", lock.path, err)
+	}
+	if locked {
+		return nil
+	}
+
+	holder := lock.holder()
+	log.Infof(2, "waiting for up to %v for the lock on the database held by %v", lock.timeout, describeHolder(holder))
+
+	start := time.Now()
+	lastReport := start
+	interval := 10 * time.Millisecond
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= lock.timeout {
+			return LockTimeoutError{lock.path, lock.timeout, holder}
+		}
+
+		if remaining := lock.timeout - elapsed; interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		if interval *= 2; interval > lockMaxRetryInterval {
+			interval = lockMaxRetryInterval
+		}
+
+		locked, err := tryLockFile(file)
+		if err != nil {
+			return fmt.Errorf("could not take lock file '%v': %w", lock.path, err)
+		}
+		if locked {
+			log.Infof(2, "acquired the lock on the database after waiting %v", time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+
+		// the lock may have passed to another process in the meantime
+		if current := lock.holder(); current != holder {
+			holder = current
+			log.Infof(2, "the lock on the database is now held by %v", describeHolder(holder))
+		}
+
+		if time.Since(lastReport) >= lockReportInterval {
+			lastReport = time.Now()
+			log.Infof(2, "still waiting for the lock on the database held by %v after %v", describeHolder(holder), time.Since(start).Round(time.Second))
+		}
+	}
+}
+
+// the description of the process holding the lock, as written to the lock file,
+// or an empty string if it is not known
+func (lock *Lock) holder() string {
+	data, err := ioutil.ReadFile(lock.path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// describes this process: its ID, command line and when it took the lock
+func lockHolder() string {
+	return fmt.Sprintf("process %v (%v) since %v", os.Getpid(), strings.Join(os.Args, " "), time.Now().Format(time.RFC3339))
+}
+
+func describeHolder(holder string) string {
+	if holder == "" {
+		return "another process"
+	}
+
+	return holder
+}
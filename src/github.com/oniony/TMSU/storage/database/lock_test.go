@@ -0,0 +1,115 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package database
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockIsSharedWithinProcess(test *testing.T) {
+	// set-up
+
+	dir, err := ioutil.TempDir("", "tmsu-lock")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+	first := NewLock(dbPath, 0)
+	second := NewLock(dbPath, 0)
+
+	// test
+
+	if err := first.Acquire(); err != nil {
+		test.Fatal(err)
+	}
+	if err := second.Acquire(); err != nil {
+		test.Fatalf("Expected lock to be acquired again within the process but was: %v", err)
+	}
+
+	// validate
+
+	if first != second {
+		test.Fatal("Expected the same lock for the same database")
+	}
+
+	second.Release()
+	if first.holds != 1 {
+		test.Fatalf("Expected lock to be held once but was held %v times", first.holds)
+	}
+
+	first.Release()
+	if first.file != nil {
+		test.Fatal("Expected lock file to be closed once released")
+	}
+}
+
+func TestLockTimesOutWhilstHeldElsewhere(test *testing.T) {
+	// set-up
+
+	dir, err := ioutil.TempDir("", "tmsu-lock")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+
+	// a lock on a separate file handle is as that of another process
+	other, err := os.OpenFile(dbPath+LockExtension, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer other.Close()
+
+	if locked, err := tryLockFile(other); err != nil || !locked {
+		test.Fatalf("Could not lock file: %v", err)
+	}
+	other.WriteString("process 1 (tmsu tag) since now")
+
+	lock := NewLock(dbPath, 50*time.Millisecond)
+
+	// test
+
+	err = lock.Acquire()
+
+	// validate
+
+	var timeoutErr LockTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		test.Fatalf("Expected lock timeout error but was: %v", err)
+	}
+	if timeoutErr.Holder != "process 1 (tmsu tag) since now" {
+		test.Fatalf("Expected holder to be described but was '%v'", timeoutErr.Holder)
+	}
+	if !IsLocked(err) {
+		test.Fatal("Expected lock timeout to be reported as the database being locked")
+	}
+
+	unlockFile(other)
+	if err := lock.Acquire(); err != nil {
+		test.Fatalf("Expected lock to be acquired once released but was: %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,60 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build windows
+
+package database
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// unexported
+
+var kernel32 = syscall.NewLazyDLL("kernel32.dll")
+var lockFileEx = kernel32.NewProc("LockFileEx")
+var unlockFileEx = kernel32.NewProc("UnlockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// takes an exclusive lock on the file unless another process holds it
+func tryLockFile(file *os.File) (bool, error) {
+	overlapped := syscall.Overlapped{}
+	success, _, err := syscall.Syscall6(lockFileEx.Addr(), 6, file.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	switch {
+	case success != 0:
+		return true, nil
+	case err == errorLockViolation:
+		return false, nil
+	}
+
+	return false, err
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := syscall.Overlapped{}
+	success, _, err := syscall.Syscall6(unlockFileEx.Addr(), 5, file.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)), 0)
+	if success == 0 {
+		return err
+	}
+
+	return nil
+}
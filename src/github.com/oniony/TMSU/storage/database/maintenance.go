@@ -0,0 +1,220 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"github.com/oniony/TMSU/entities"
+	"strings"
+)
+
+// Creates those indexes expected by the schema that are missing from the database, returning their names.
+func CreateMissingIndexes(tx *Tx) ([]string, error) {
+	rows, err := tx.Query(`
+SELECT name
+FROM sqlite_master
+WHERE type = 'index'`)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	created := make([]string, 0, len(schemaIndexes))
+	for _, index := range schemaIndexes {
+		if existing[index.name] {
+			continue
+		}
+
+		if err := createIndex(tx.tx, index.name); err != nil {
+			return nil, err
+		}
+
+		created = append(created, index.name)
+	}
+
+	return created, nil
+}
+
+// Gathers the statistics about the tables and indexes that SQLite's query planner uses to choose between indexes.
+func Analyze(tx *Tx) error {
+	_, err := tx.Exec("ANALYZE")
+	return err
+}
+
+// Retrieves the size of the database, and the space within it that is unused, in bytes.
+func DatabaseSize(tx *Tx) (int64, int64, error) {
+	pageSize, err := pragmaValue(tx, "page_size")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pageCount, err := pragmaValue(tx, "page_count")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	freePageCount, err := pragmaValue(tx, "freelist_count")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return pageCount * pageSize, freePageCount * pageSize, nil
+}
+
+// Retrieves the tables and indexes of the database, ordered by table, with the number of rows of each table and, if
+// SQLite is built with the 'dbstat' virtual table, the bytes used by each.
+func DatabaseObjects(tx *Tx) (entities.DatabaseObjects, error) {
+	rows, err := tx.Query(`
+SELECT type, name, tbl_name
+FROM sqlite_master
+WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'
+ORDER BY tbl_name, type DESC, name`)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(entities.DatabaseObjects, 0, 30)
+	for rows.Next() {
+		object := entities.DatabaseObject{Size: -1}
+		if err := rows.Scan(&object.Type, &object.Name, &object.Table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		objects = append(objects, &object)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sizes := objectSizes(tx)
+
+	for _, object := range objects {
+		if object.Type == "table" {
+			count, err := tableRowCount(tx, object.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			object.Rows = count
+		}
+
+		if size, ok := sizes[object.Name]; ok {
+			object.Size = size
+		}
+	}
+
+	return objects, nil
+}
+
+// Rebuilds the database file, reclaiming the space left unused by deleted rows. This cannot be done within a
+// transaction.
+func (database *Database) Vacuum() error {
+	if database.readOnly {
+		return DatabaseReadOnlyError{}
+	}
+
+	if database.encryption == nil {
+		_, err := database.db.Exec("VACUUM")
+		return err
+	}
+
+	hold, err := database.acquireEncrypted()
+	if err != nil {
+		return err
+	}
+
+	if _, err := hold.conn.ExecContext(context.Background(), "VACUUM"); err != nil {
+		database.releaseEncrypted(hold, false)
+		return err
+	}
+
+	// the image is smaller although no row has changed
+	hold.forceSave = true
+
+	return database.releaseEncrypted(hold, true)
+}
+
+// unexported
+
+func pragmaValue(tx *Tx, name string) (int64, error) {
+	rows, err := tx.Query("PRAGMA " + name)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var value int64
+	if rows.Next() {
+		if err := rows.Scan(&value); err != nil {
+			return 0, err
+		}
+	}
+
+	return value, rows.Err()
+}
+
+func tableRowCount(tx *Tx, table string) (uint, error) {
+	rows, err := tx.Query(`SELECT count(1) FROM "` + strings.Replace(table, `"`, `""`, -1) + `"`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// the bytes used by each table and index, which are empty where SQLite is not
+// built with the 'dbstat' virtual table
+func objectSizes(tx *Tx) map[string]int64 {
+	sizes := make(map[string]int64)
+
+	rows, err := tx.Query(`
+SELECT name, sum(pgsize)
+FROM dbstat
+GROUP BY name`)
+	if err != nil {
+		return sizes
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return sizes
+		}
+
+		sizes[name] = size
+	}
+
+	return sizes
+}
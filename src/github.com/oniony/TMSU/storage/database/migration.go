@@ -0,0 +1,153 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"time"
+)
+
+// Migrates the schema of the database at the path to the specified version,
+// or to the latest version if none is specified, returning the migrations
+// applied. The passphrase is only required if the database is encrypted.
+func MigrateAt(path, passphrase, version string) (entities.Migrations, error) {
+	target := latestSchemaVersion
+	if version != "" {
+		var err error
+		if target, err = parseSchemaVersion(version); err != nil {
+			return nil, err
+		}
+
+		if _, found := findMigration(target); !found {
+			return nil, fmt.Errorf("no migration to schema version %v: the latest schema version is %v", target, latestSchemaVersion)
+		}
+	}
+
+	database, err := openUnmigratedAt(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	applied, err := migrate(tx.tx, target)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, DatabaseTransactionError{path, err}
+	}
+
+	migrations := make(entities.Migrations, len(applied))
+	for index, migration := range applied {
+		migrations[index] = &entities.Migration{migration.version.String(), migration.description, true, time.Time{}}
+	}
+
+	return migrations, nil
+}
+
+// Retrieves the schema version of the database at the path along with every
+// migration, whether applied to the database or pending, without migrating
+// it. The passphrase is only required if the database is encrypted.
+func MigrationsAt(path, passphrase string) (string, entities.Migrations, error) {
+	database, err := openUnmigratedAt(path, passphrase)
+	if err != nil {
+		return "", nil, err
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		return "", nil, DatabaseTransactionError{path, err}
+	}
+	defer tx.Rollback()
+
+	version, err := checkSchemaVersion(tx.tx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	history, err := migrationHistory(tx.tx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	list := make(entities.Migrations, len(migrations))
+	for index, migration := range migrations {
+		list[index] = &entities.Migration{migration.version.String(), migration.description, !version.LessThan(migration.version), history[migration.version]}
+	}
+
+	return version.String(), list, nil
+}
+
+// unexported
+
+func openUnmigratedAt(path, passphrase string) (*Database, error) {
+	if passphrase != "" {
+		return openEncryptedAt(path, passphrase, false)
+	}
+
+	return openAt(path, false)
+}
+
+func insertMigration(tx *sql.Tx, migration migration, applied time.Time) error {
+	sql := `
+INSERT OR REPLACE INTO migration (major, minor, patch, revision, description, applied)
+VALUES (?, ?, ?, ?, ?, ?)`
+
+	version := migration.version
+	if _, err := tx.Exec(sql, version.Major, version.Minor, version.Patch, version.Revision, migration.description, applied); err != nil {
+		return fmt.Errorf("could not record migration: %w", err)
+	}
+
+	return nil
+}
+
+// the times at which the recorded migrations were applied, by schema version
+func migrationHistory(tx *sql.Tx) (map[schemaVersion]time.Time, error) {
+	history := make(map[schemaVersion]time.Time)
+	if !tableExists(tx, "migration") {
+		return history, nil
+	}
+
+	rows, err := tx.Query(`
+SELECT major, minor, patch, revision, applied
+FROM migration`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version schemaVersion
+		var applied time.Time
+		if err := rows.Scan(&version.Major, &version.Minor, &version.Patch, &version.Revision, &applied); err != nil {
+			return nil, err
+		}
+
+		history[version] = applied
+	}
+
+	return history, rows.Err()
+}
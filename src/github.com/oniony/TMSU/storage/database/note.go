@@ -0,0 +1,115 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the note for the specified file.
+func NoteByFileId(tx *Tx, fileId entities.FileId) (*entities.Note, error) {
+	sql := `
+SELECT file_id, text
+FROM note
+WHERE file_id = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readNote(rows)
+}
+
+// Adds or replaces the note for the specified file.
+func UpdateNote(tx *Tx, fileId entities.FileId, text string) (*entities.Note, error) {
+	sql := `
+INSERT OR REPLACE INTO note (file_id, text)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, fileId, text)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return &entities.Note{fileId, text}, nil
+}
+
+// Deletes the note for the specified file.
+func DeleteNote(tx *Tx, fileId entities.FileId) error {
+	sql := `
+DELETE FROM note
+WHERE file_id = ?`
+
+	result, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchNoteError{fileId}
+	}
+
+	return nil
+}
+
+// Deletes the notes of files that are no longer in the database.
+func DeleteOrphanedNotes(tx *Tx) error {
+	sql := `
+DELETE FROM note
+WHERE file_id NOT IN (SELECT id
+                      FROM file)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readNote(rows *sql.Rows) (*entities.Note, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var fileId entities.FileId
+	var text string
+	err := rows.Scan(&fileId, &text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Note{fileId, text}, nil
+}
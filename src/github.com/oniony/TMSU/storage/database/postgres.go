@@ -0,0 +1,335 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/oniony/TMSU/common/log"
+	"io"
+	"strings"
+	"time"
+)
+
+// Determines whether the database path is instead a PostgreSQL connection
+// string, i.e. a postgres:// or postgresql:// URL.
+func IsPostgres(path string) bool {
+	return strings.HasPrefix(path, "postgres://") || strings.HasPrefix(path, "postgresql://")
+}
+
+// Opens the PostgreSQL database named by the connection string, creating the
+// schema if the database is empty. The statements, which are written for
+// SQLite, are rewritten for PostgreSQL as they are executed.
+func OpenPostgres(connection string) (*Database, error) {
+	log.Infof(2, "opening PostgreSQL database")
+
+	if !postgresSupported() {
+		return nil, errors.New("this build of TMSU does not support PostgreSQL: rebuild it with the 'postgres' build tag")
+	}
+
+	base, err := sql.Open(postgresDriverName, connection)
+	if err != nil {
+		return nil, DatabaseAccessError{RedactConnection(connection), err}
+	}
+	connector := postgresConnector{base.Driver(), connection}
+	base.Close()
+
+	database := &Database{sql.OpenDB(connector), nil, false, ""}
+
+	tx, err := database.db.Begin()
+	if err != nil {
+		database.Close()
+		return nil, DatabaseAccessError{RedactConnection(connection), err}
+	}
+
+	if err := preparePostgresSchema(tx); err != nil {
+		tx.Rollback()
+		database.Close()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		database.Close()
+		return nil, DatabaseTransactionError{RedactConnection(connection), err}
+	}
+
+	return database, nil
+}
+
+// The connection string less any password, for reporting.
+func RedactConnection(connection string) string {
+	schemeEnd := strings.Index(connection, "://") + len("://")
+	at := strings.LastIndex(connection, "@")
+	if at < schemeEnd {
+		return connection
+	}
+
+	credentials := connection[schemeEnd:at]
+	if colon := strings.Index(credentials, ":"); colon != -1 {
+		return connection[:schemeEnd] + credentials[:colon] + ":xxx" + connection[at:]
+	}
+
+	return connection
+}
+
+// unexported
+
+// the name with which the PostgreSQL driver, linked in by the 'postgres' build
+// tag, registers itself
+const postgresDriverName = "postgres"
+
+func postgresSupported() bool {
+	for _, name := range sql.Drivers() {
+		if name == postgresDriverName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// creates the schema of an empty database, which is always the latest as the
+// migrations are specific to SQLite
+func preparePostgresSchema(tx *sql.Tx) error {
+	if tableExists(tx, "version") {
+		version, err := checkSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if version != latestSchemaVersion {
+			return fmt.Errorf("PostgreSQL database schema version %v cannot be migrated to %v", version, latestSchemaVersion)
+		}
+
+		return nil
+	}
+
+	log.Infof(2, "creating schema")
+
+	// tag names are matched regardless of case with this collation, in place of SQLite's NOCASE
+	if _, err := tx.Exec(`CREATE COLLATION IF NOT EXISTS nocase (provider = icu, locale = 'und-u-ks-level2', deterministic = false)`); err != nil {
+		return err
+	}
+
+	if err := createSchema(tx); err != nil {
+		return err
+	}
+
+	for _, index := range schemaIndexes {
+		if err := createIndex(tx, index.name); err != nil {
+			return err
+		}
+	}
+
+	return insertMigration(tx, migration{latestSchemaVersion, createdSchemaDescription, nil}, time.Now().UTC())
+}
+
+type postgresConnector struct {
+	driver     driver.Driver
+	connection string
+}
+
+func (connector postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.driver.Open(connector.connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresConn{conn}, nil
+}
+
+func (connector postgresConnector) Driver() driver.Driver {
+	return postgresDriver{}
+}
+
+type postgresDriver struct{}
+
+func (postgresDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("PostgreSQL databases must be opened with OpenPostgres")
+}
+
+// a connection to PostgreSQL that rewrites each statement it is given
+type postgresConn struct {
+	conn driver.Conn
+}
+
+func (conn *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	statement, err := rewritePostgres(query)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := conn.conn.Prepare(statement.query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresStmt{stmt, statement.returningId}, nil
+}
+
+func (conn *postgresConn) Close() error {
+	return conn.conn.Close()
+}
+
+func (conn *postgresConn) Begin() (driver.Tx, error) {
+	return conn.conn.Begin()
+}
+
+// executes statements without preparing them, which is required of those
+// rewritten as several statements, such as the journal triggers
+func (conn *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	statement, err := rewritePostgres(query)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, canExec := conn.conn.(driver.ExecerContext)
+	queryer, canQuery := conn.conn.(driver.QueryerContext)
+	if !canExec || !canQuery {
+		return nil, driver.ErrSkip
+	}
+
+	args = postgresArgs(args)
+
+	if statement.returningId {
+		rows, err := queryer.QueryContext(ctx, statement.query, args)
+		if err != nil {
+			return nil, err
+		}
+
+		return insertedRows(rows)
+	}
+
+	return execer.ExecContext(ctx, statement.query, args)
+}
+
+func (conn *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	statement, err := rewritePostgres(query)
+	if err != nil {
+		return nil, err
+	}
+
+	queryer, ok := conn.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	return queryer.QueryContext(ctx, statement.query, postgresArgs(args))
+}
+
+type postgresStmt struct {
+	stmt        driver.Stmt
+	returningId bool
+}
+
+func (stmt *postgresStmt) Close() error {
+	return stmt.stmt.Close()
+}
+
+func (stmt *postgresStmt) NumInput() int {
+	return stmt.stmt.NumInput()
+}
+
+func (stmt *postgresStmt) Exec(args []driver.Value) (driver.Result, error) {
+	args = postgresValues(args)
+
+	if stmt.returningId {
+		rows, err := stmt.stmt.Query(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return insertedRows(rows)
+	}
+
+	return stmt.stmt.Exec(args)
+}
+
+func (stmt *postgresStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return stmt.stmt.Query(postgresValues(args))
+}
+
+// the outcome of an insert whose statement was rewritten to return the IDs of
+// the rows inserted, as PostgreSQL has no equivalent of SQLite's last row ID
+type postgresResult struct {
+	insertedId   int64
+	affectedRows int64
+}
+
+func (result postgresResult) LastInsertId() (int64, error) {
+	return result.insertedId, nil
+}
+
+func (result postgresResult) RowsAffected() (int64, error) {
+	return result.affectedRows, nil
+}
+
+func insertedRows(rows driver.Rows) (driver.Result, error) {
+	defer rows.Close()
+
+	var result postgresResult
+	values := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(values)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if id, ok := values[0].(int64); ok {
+			result.insertedId = id
+		}
+		result.affectedRows++
+	}
+
+	return result, nil
+}
+
+// booleans are stored as integers, as the statements compare them with 0 and 1
+func postgresArgs(args []driver.NamedValue) []driver.NamedValue {
+	converted := make([]driver.NamedValue, len(args))
+	for index, arg := range args {
+		converted[index] = arg
+		converted[index].Value = postgresValue(arg.Value)
+	}
+
+	return converted
+}
+
+func postgresValues(args []driver.Value) []driver.Value {
+	converted := make([]driver.Value, len(args))
+	for index, arg := range args {
+		converted[index] = postgresValue(arg)
+	}
+
+	return converted
+}
+
+func postgresValue(value driver.Value) driver.Value {
+	if flag, ok := value.(bool); ok {
+		if flag {
+			return int64(1)
+		}
+
+		return int64(0)
+	}
+
+	return value
+}
@@ -0,0 +1,100 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build postgres
+
+package database
+
+import (
+	"github.com/oniony/TMSU/common/fingerprint"
+	"os"
+	"testing"
+	"time"
+)
+
+// runs the statements of tagging, which use numbered placeholders, against the
+// PostgreSQL database of the TMSU_TEST_POSTGRES connection string, if set,
+// within a transaction that is rolled back
+func TestPostgresTagging(test *testing.T) {
+	// set-up
+
+	connection := os.Getenv("TMSU_TEST_POSTGRES")
+	if connection == "" {
+		test.Skip("TMSU_TEST_POSTGRES is not set")
+	}
+
+	database, err := OpenPostgres(connection)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	tag, err := InsertTag(tx, "tmsu-test-tag", 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	value, err := InsertValue(tx, "tmsu-test-value")
+	if err != nil {
+		test.Fatal(err)
+	}
+	file, err := InsertFile(tx, "/tmp/tmsu-test/file", fingerprint.Fingerprint("tmsu-test"), time.Now(), 1, false, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if _, err := AddFileTag(tx, file.Id, tag.Id, value.Id, time.Now(), "test"); err != nil {
+		test.Fatal(err)
+	}
+	tagged, err := FileTagExists(tx, file.Id, tag.Id, value.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := RenameValue(tx, value.Id, "tmsu-test-renamed"); err != nil {
+		test.Fatal(err)
+	}
+	renamed, err := ValueByName(tx, "tmsu-test-renamed", false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := DeleteFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+		test.Fatal(err)
+	}
+	untagged, err := FileTagExists(tx, file.Id, tag.Id, value.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if !tagged {
+		test.Fatal("Expected file to be tagged")
+	}
+	if renamed == nil || renamed.Id != value.Id {
+		test.Fatalf("Expected value #%v to be renamed but found %v", value.Id, renamed)
+	}
+	if untagged {
+		test.Fatal("Expected file to be untagged")
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unexported
+
+// a statement rewritten for PostgreSQL
+type postgresStatement struct {
+	query string
+
+	// whether the statement returns the ID of the row inserted
+	returningId bool
+}
+
+// rewrites a statement written for SQLite, as are all of TMSU's, into the
+// dialect of PostgreSQL
+func rewritePostgres(query string) (postgresStatement, error) {
+	trimmed := strings.TrimSpace(query)
+
+	if match := tableInfoRegexp.FindStringSubmatch(trimmed); match != nil {
+		return postgresStatement{fmt.Sprintf(postgresTableInfo, match[1]), false}, nil
+	}
+	if strings.HasPrefix(strings.ToUpper(trimmed), "PRAGMA") {
+		return postgresStatement{}, fmt.Errorf("'%v' is not supported by PostgreSQL databases", trimmed)
+	}
+
+	if match := triggerRegexp.FindStringSubmatch(trimmed); match != nil {
+		return postgresStatement{rewritePostgresTrigger(match), false}, nil
+	}
+
+	query = rewritePostgresClauses(query)
+
+	returningId := false
+	if match := insertRegexp.FindStringSubmatch(query); match != nil && postgresSerialTables[match[1]] && !strings.Contains(query, " RETURNING ") {
+		query += " RETURNING id"
+		returningId = true
+	}
+
+	return postgresStatement{numberPlaceholders(query), returningId}, nil
+}
+
+var tableInfoRegexp = regexp.MustCompile(`^(?i)PRAGMA table_info\((\w+)\)$`)
+var triggerRegexp = regexp.MustCompile(`^(?is)CREATE TRIGGER IF NOT EXISTS (\w+)\s+AFTER (\w+) ON (\w+)\s+WHEN (.+?)\s+BEGIN\s+(.+?);\s*END$`)
+var insertRegexp = regexp.MustCompile(`^\s*INSERT INTO (\w+)`)
+var insertOrIgnoreRegexp = regexp.MustCompile(`\bINSERT OR IGNORE INTO\b`)
+var insertOrReplaceRegexp = regexp.MustCompile(`\bINSERT OR REPLACE INTO (\w+) \(([^)]*)\)`)
+var trailingCollationRegexp = regexp.MustCompile(`\)\s*COLLATE NOCASE\s*$`)
+var sortCollationRegexp = regexp.MustCompile(`\bCOLLATE ` + collationPrefix + `(\w+)`)
+var globRegexp = regexp.MustCompile(`\b(NOT )?GLOB '([^']*)'`)
+var dateTextRegexp = regexp.MustCompile(`\bsubstr\(((?:\w+\.)?(?:mod_time|applied)),`)
+var serialIdRegexp = regexp.MustCompile(`(?m)^(\s*)id INTEGER PRIMARY KEY`)
+var foreignKeyRegexp = regexp.MustCompile(`,?\s*FOREIGN KEY \([^)]*\) REFERENCES \w+\(\w+\)`)
+
+// the columns of the rows of 'PRAGMA table_info', of which only the name is read
+const postgresTableInfo = `
+SELECT ordinal_position - 1 AS cid, column_name AS name, data_type AS type, 0 AS notnull, column_default AS dflt_value, 0 AS pk
+FROM information_schema.columns
+WHERE table_schema = current_schema() AND table_name = '%v'
+ORDER BY ordinal_position`
+
+// the tables and indexes listed by SQLite's catalogue
+const postgresCatalogue = `(SELECT 'table' AS type, table_name AS name, table_name AS tbl_name, '' AS sql
+ FROM information_schema.tables
+ WHERE table_schema = current_schema()
+ UNION ALL
+ SELECT 'index', indexname, tablename, indexdef
+ FROM pg_indexes
+ WHERE schemaname = current_schema()) AS sqlite_master`
+
+// the tables whose rows are identified by an 'id' column that is assigned upon insertion
+var postgresSerialTables = map[string]bool{"file": true, "tag": true, "value": true, "rule": true, "operation": true, "journal": true, "snapshot": true}
+
+// the primary keys of the tables whose rows are replaced, upon which inserts conflict
+var postgresReplacedKeys = map[string][]string{
+	"file_identity":  {"file_id"},
+	"migration":      {"major", "minor", "patch", "revision"},
+	"note":           {"file_id"},
+	"property":       {"file_id", "name"},
+	"query_usage":    {"text"},
+	"setting":        {"name"},
+	"sync":           {"peer"},
+	"tag_constraint": {"tag_id"},
+	"tag_group":      {"tag_id"},
+	"tag_info":       {"tag_id"},
+	"tag_type":       {"tag_id"},
+	"view":           {"name"},
+}
+
+func rewritePostgresClauses(query string) string {
+	if strings.HasPrefix(strings.TrimSpace(query), "CREATE TABLE") {
+		// SQLite does not enforce foreign keys unless asked, and the schema
+		// relies upon this as a value ID of 0 denotes no value
+		query = foreignKeyRegexp.ReplaceAllString(query, "")
+		query = serialIdRegexp.ReplaceAllString(query, "${1}id BIGSERIAL PRIMARY KEY")
+		query = strings.Replace(query, " INTEGER", " BIGINT", -1)
+		query = strings.Replace(query, " DATETIME", " TIMESTAMP WITH TIME ZONE", -1)
+		query = strings.Replace(query, " BOOLEAN", " SMALLINT", -1)
+		query = strings.Replace(query, " BLOB", " BYTEA", -1)
+
+		return query
+	}
+
+	if insertOrIgnoreRegexp.MatchString(query) {
+		query = insertOrIgnoreRegexp.ReplaceAllString(query, "INSERT INTO") + " ON CONFLICT DO NOTHING"
+	}
+
+	if match := insertOrReplaceRegexp.FindStringSubmatch(query); match != nil {
+		table := match[1]
+		keys := postgresReplacedKeys[table]
+
+		isKey := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			isKey[key] = true
+		}
+
+		updates := make([]string, 0)
+		for _, column := range strings.Split(match[2], ",") {
+			column = strings.TrimSpace(column)
+			if !isKey[column] {
+				updates = append(updates, column+" = EXCLUDED."+column)
+			}
+		}
+
+		query = strings.Replace(query, "INSERT OR REPLACE INTO", "INSERT INTO", 1)
+		if len(updates) == 0 {
+			query += " ON CONFLICT DO NOTHING"
+		} else {
+			query += fmt.Sprintf(" ON CONFLICT (%v) DO UPDATE SET %v", strings.Join(keys, ", "), strings.Join(updates, ", "))
+		}
+	}
+
+	query = trailingCollationRegexp.ReplaceAllString(query, ")")
+	query = strings.Replace(query, "COLLATE NOCASE", "COLLATE nocase", -1)
+	query = sortCollationRegexp.ReplaceAllString(query, `COLLATE "$1-x-icu"`)
+	query = strings.Replace(query, "FROM sqlite_master", "FROM "+postgresCatalogue, -1)
+	query = strings.Replace(query, "instr(", "strpos(", -1)
+	query = strings.Replace(query, "quote(", "quote_nullable(", -1)
+	query = strings.Replace(query, " REGEXP ", " ~ ", -1)
+
+	// dates and times are compared as text by their leading characters
+	query = dateTextRegexp.ReplaceAllString(query, "substr(to_char($1, 'YYYY-MM-DD HH24:MI:SS'),")
+
+	query = globRegexp.ReplaceAllStringFunc(query, func(glob string) string {
+		match := globRegexp.FindStringSubmatch(glob)
+
+		operator := "~"
+		if match[1] != "" {
+			operator = "!~"
+		}
+
+		return operator + " '" + globToRegexp(match[2]) + "'"
+	})
+
+	return query
+}
+
+// rewrites a SQLite trigger as a PostgreSQL trigger function and the trigger
+// that executes it, replacing any existing trigger of the same name
+func rewritePostgresTrigger(match []string) string {
+	name, event, table, condition, body := match[1], match[2], match[3], match[4], match[5]
+
+	return fmt.Sprintf(`
+CREATE OR REPLACE FUNCTION %[1]v() RETURNS trigger AS $tmsu$
+BEGIN
+    IF %[4]v THEN
+        %[5]v;
+    END IF;
+    RETURN NULL;
+END
+$tmsu$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS %[1]v ON %[3]v;
+CREATE TRIGGER %[1]v AFTER %[2]v ON %[3]v FOR EACH ROW EXECUTE FUNCTION %[1]v()`,
+		name, event, table, condition, rewritePostgresClauses(body))
+}
+
+// converts a GLOB pattern, which must match in its entirety, into a regular expression
+func globToRegexp(glob string) string {
+	expression := "^"
+	inClass := false
+	for _, char := range glob {
+		switch {
+		case inClass:
+			expression += string(char)
+			if char == ']' {
+				inClass = false
+			}
+		case char == '[':
+			expression += "["
+			inClass = true
+		case char == '*':
+			expression += ".*"
+		case char == '?':
+			expression += "."
+		default:
+			expression += regexp.QuoteMeta(string(char))
+		}
+	}
+
+	return expression + "$"
+}
+
+// replaces each '?' or '?NNN' placeholder outside of string literals and quoted
+// identifiers with PostgreSQL's numbered placeholders: as with SQLite, '?NNN' is
+// the NNNth argument and a bare '?' the argument after the highest numbered yet
+func numberPlaceholders(query string) string {
+	var builder strings.Builder
+	var quote rune
+	highest := 0
+	chars := []rune(query)
+	for index := 0; index < len(chars); index++ {
+		char := chars[index]
+
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == '?':
+			end := index + 1
+			for end < len(chars) && chars[end] >= '0' && chars[end] <= '9' {
+				end++
+			}
+
+			number := highest + 1
+			if end > index+1 {
+				number, _ = strconv.Atoi(string(chars[index+1 : end]))
+			}
+			if number > highest {
+				highest = number
+			}
+
+			builder.WriteString("$" + strconv.Itoa(number))
+			index = end - 1
+			continue
+		}
+
+		builder.WriteRune(char)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,147 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the properties of the specified file, ordered by name.
+func PropertiesByFileId(tx *Tx, fileId entities.FileId) (entities.Properties, error) {
+	sql := `
+SELECT file_id, name, value
+FROM property
+WHERE file_id = ?
+ORDER BY name`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readProperties(rows, make(entities.Properties, 0, 10))
+}
+
+// Retrieves the named property of the specified file, or nil if it has none.
+func Property(tx *Tx, fileId entities.FileId, name string) (*entities.Property, error) {
+	sql := `
+SELECT file_id, name, value
+FROM property
+WHERE file_id = ? AND name = ?`
+
+	rows, err := tx.Query(sql, fileId, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readProperty(rows)
+}
+
+// Adds or replaces the named property of the specified file.
+func UpdateProperty(tx *Tx, fileId entities.FileId, name, value string) (*entities.Property, error) {
+	sql := `
+INSERT OR REPLACE INTO property (file_id, name, value)
+VALUES (?, ?, ?)`
+
+	result, err := tx.Exec(sql, fileId, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return &entities.Property{fileId, name, value}, nil
+}
+
+// Deletes the named property of the specified file.
+func DeleteProperty(tx *Tx, fileId entities.FileId, name string) error {
+	sql := `
+DELETE FROM property
+WHERE file_id = ? AND name = ?`
+
+	result, err := tx.Exec(sql, fileId, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchPropertyError{fileId, name}
+	}
+
+	return nil
+}
+
+// Deletes the properties of files that are no longer in the database.
+func DeleteOrphanedProperties(tx *Tx) error {
+	sql := `
+DELETE FROM property
+WHERE file_id NOT IN (SELECT id
+                      FROM file)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readProperty(rows *sql.Rows) (*entities.Property, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var fileId entities.FileId
+	var name, value string
+	if err := rows.Scan(&fileId, &name, &value); err != nil {
+		return nil, err
+	}
+
+	return &entities.Property{fileId, name, value}, nil
+}
+
+func readProperties(rows *sql.Rows, properties entities.Properties) (entities.Properties, error) {
+	for {
+		property, err := readProperty(rows)
+		if err != nil {
+			return nil, err
+		}
+		if property == nil {
+			break
+		}
+
+		properties = append(properties, property)
+	}
+
+	return properties, nil
+}
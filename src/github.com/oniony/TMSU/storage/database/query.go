@@ -99,6 +99,59 @@ WHERE text = ?`
 	return nil
 }
 
+// Records a use of a query, returning the number of times it has been used.
+func IncrementQueryUsage(tx *Tx, text string) (uint, error) {
+	sql := `
+UPDATE query_usage
+SET count = count + 1
+WHERE text = ?`
+
+	result, err := tx.Exec(sql, text)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 {
+		sql = `
+INSERT INTO query_usage (text, count)
+VALUES (?, 1)`
+
+		if _, err := tx.Exec(sql, text); err != nil {
+			return 0, err
+		}
+	}
+
+	sql = `
+SELECT count
+FROM query_usage
+WHERE text = ?`
+
+	rows, err := tx.Query(sql, text)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Forgets the uses of a query.
+func DeleteQueryUsage(tx *Tx, text string) error {
+	sql := `
+DELETE FROM query_usage
+WHERE text = ?`
+
+	if _, err := tx.Exec(sql, text); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // unexported
 
 func readQuery(rows *sql.Rows) (*entities.Query, error) {
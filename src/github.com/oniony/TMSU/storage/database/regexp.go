@@ -0,0 +1,73 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/oniony/TMSU/common/collation"
+	"regexp"
+	"sync"
+)
+
+// the name of the SQLite driver with the functions the queries rely upon
+const sqliteDriverName = "sqlite3_tmsu"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, collator := range collation.Collators() {
+				if err := conn.RegisterCollation(collationPrefix+collator.Name, collator.Compare); err != nil {
+					return err
+				}
+			}
+
+			return conn.RegisterFunc("regexp", matchRegexp, true)
+		},
+	})
+}
+
+// the compiled regular expressions, keyed by pattern, as each is matched against
+// every row of a query
+var compiledPatterns sync.Map
+
+// implements SQLite's REGEXP operator, for which 'X REGEXP Y' calls regexp(Y, X):
+// NULL matches no pattern
+func matchRegexp(pattern string, text interface{}) (bool, error) {
+	if text == nil {
+		return false, nil
+	}
+
+	compiled, ok := compiledPatterns.Load(pattern)
+	if !ok {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression '%v': %v", pattern, err)
+		}
+
+		compiled, _ = compiledPatterns.LoadOrStore(pattern, expression)
+	}
+
+	switch typedText := text.(type) {
+	case string:
+		return compiled.(*regexp.Regexp).MatchString(typedText), nil
+	case []byte:
+		return typedText != nil && compiled.(*regexp.Regexp).Match(typedText), nil
+	default:
+		return compiled.(*regexp.Regexp).MatchString(fmt.Sprint(typedText)), nil
+	}
+}
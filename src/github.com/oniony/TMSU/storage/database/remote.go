@@ -0,0 +1,232 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"time"
+)
+
+// A statement sent to a remote database.
+type RemoteRequest struct {
+	Query string
+	Args  []interface{}
+}
+
+// The outcome of a statement executed by a remote database.
+type RemoteResult struct {
+	InsertedId   int64
+	AffectedRows int64
+}
+
+func (result RemoteResult) LastInsertId() (int64, error) {
+	return result.InsertedId, nil
+}
+
+func (result RemoteResult) RowsAffected() (int64, error) {
+	return result.AffectedRows, nil
+}
+
+// The rows retrieved by a query against a remote database.
+type RemoteRows struct {
+	Columns []string
+	Values  [][]interface{}
+}
+
+// Opens a database served by 'tmsu serve' at the address, which is either
+// HOST:PORT or unix:PATH. The root path of the served database is returned
+// alongside. The database refuses changes if it is served read-only.
+func OpenRemote(address, secret string) (*Database, string, error) {
+	connector := remoteConnector{address, secret}
+
+	// connect up front so that problems are reported when opening
+	client, rootPath, err := connector.dial()
+	if err != nil {
+		return nil, "", DatabaseAccessError{address, err}
+	}
+	defer client.Close()
+
+	var readOnly bool
+	if err := client.Call("Database.ReadOnly", true, &readOnly); err != nil {
+		return nil, "", DatabaseAccessError{address, err}
+	}
+
+	return &Database{sql.OpenDB(connector), nil, readOnly, ""}, rootPath, nil
+}
+
+// unexported
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+// splits an address into the network and address to dial or listen upon
+func remoteNetwork(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", address[len("unix:"):]
+	}
+
+	return "tcp", address
+}
+
+type remoteConnector struct {
+	address string
+	secret  string
+}
+
+func (connector remoteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	client, _, err := connector.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteConn{client}, nil
+}
+
+func (connector remoteConnector) Driver() driver.Driver {
+	return remoteDriver{}
+}
+
+func (connector remoteConnector) dial() (*rpc.Client, string, error) {
+	network, address := remoteNetwork(connector.address)
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := rpc.NewClient(conn)
+
+	var rootPath string
+	if err := client.Call("Database.Authenticate", connector.secret, &rootPath); err != nil {
+		client.Close()
+		return nil, "", err
+	}
+
+	return client, rootPath, nil
+}
+
+type remoteDriver struct{}
+
+func (remoteDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("remote databases must be opened with OpenRemote")
+}
+
+type remoteConn struct {
+	client *rpc.Client
+}
+
+func (conn *remoteConn) Prepare(query string) (driver.Stmt, error) {
+	return &remoteStmt{conn, query}, nil
+}
+
+func (conn *remoteConn) Close() error {
+	return conn.client.Close()
+}
+
+func (conn *remoteConn) Begin() (driver.Tx, error) {
+	if err := conn.client.Call("Database.Begin", true, new(bool)); err != nil {
+		return nil, err
+	}
+
+	return &remoteTx{conn}, nil
+}
+
+type remoteTx struct {
+	conn *remoteConn
+}
+
+func (tx *remoteTx) Commit() error {
+	return tx.conn.client.Call("Database.Commit", true, new(bool))
+}
+
+func (tx *remoteTx) Rollback() error {
+	return tx.conn.client.Call("Database.Rollback", true, new(bool))
+}
+
+type remoteStmt struct {
+	conn  *remoteConn
+	query string
+}
+
+func (stmt *remoteStmt) Close() error {
+	return nil
+}
+
+func (stmt *remoteStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *remoteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	var result RemoteResult
+	if err := stmt.conn.client.Call("Database.Exec", remoteRequest(stmt.query, args), &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (stmt *remoteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	var rows RemoteRows
+	if err := stmt.conn.client.Call("Database.Query", remoteRequest(stmt.query, args), &rows); err != nil {
+		return nil, err
+	}
+
+	return &remoteRows{rows, 0}, nil
+}
+
+func remoteRequest(query string, args []driver.Value) RemoteRequest {
+	values := make([]interface{}, len(args))
+	for index, arg := range args {
+		values[index] = arg
+	}
+
+	return RemoteRequest{query, values}
+}
+
+type remoteRows struct {
+	rows  RemoteRows
+	index int
+}
+
+func (rows *remoteRows) Columns() []string {
+	return rows.rows.Columns
+}
+
+func (rows *remoteRows) Close() error {
+	return nil
+}
+
+func (rows *remoteRows) Next(dest []driver.Value) error {
+	if rows.index >= len(rows.rows.Values) {
+		return io.EOF
+	}
+
+	for index, value := range rows.rows.Values[rows.index] {
+		dest[index] = value
+	}
+	rows.index++
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the complete set of rules.
+func Rules(tx *Tx) (entities.Rules, error) {
+	sql := `
+SELECT id, condition, tags
+FROM rule
+ORDER BY id`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readRules(rows, make(entities.Rules, 0, 10))
+}
+
+// Adds a rule.
+func InsertRule(tx *Tx, condition, tags string) (*entities.Rule, error) {
+	sql := `
+INSERT INTO rule (condition, tags)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, condition, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Rule{entities.RuleId(id), condition, tags}, nil
+}
+
+// Deletes a rule.
+func DeleteRule(tx *Tx, ruleId entities.RuleId) error {
+	sql := `
+DELETE FROM rule
+WHERE id = ?`
+
+	result, err := tx.Exec(sql, ruleId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchRuleError{ruleId}
+	}
+
+	return nil
+}
+
+// unexported
+
+func readRule(rows *sql.Rows) (*entities.Rule, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var rule entities.Rule
+	if err := rows.Scan(&rule.Id, &rule.Condition, &rule.Tags); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func readRules(rows *sql.Rows, rules entities.Rules) (entities.Rules, error) {
+	for {
+		rule, err := readRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			break
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -23,7 +23,7 @@ import (
 
 // unexported
 
-var latestSchemaVersion = schemaVersion{common.Version{0, 7, 0}, 1}
+var latestSchemaVersion = schemaVersion{common.Version{0, 8, 0}, 17}
 
 func currentSchemaVersion(tx *sql.Tx) schemaVersion {
 	sql := `
@@ -56,7 +56,7 @@ VALUES (?, ?, ?, ?)`
 
 	result, err := tx.Exec(sql, version.Major, version.Minor, version.Patch, version.Revision)
 	if err != nil {
-		return fmt.Errorf("could not update schema version: %v", err)
+		return fmt.Errorf("could not update schema version: %w", err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -75,7 +75,7 @@ UPDATE version SET major = ?, minor = ?, patch = ?, revision = ?`
 
 	result, err := tx.Exec(sql, version.Major, version.Minor, version.Patch, version.Revision)
 	if err != nil {
-		return fmt.Errorf("could not update schema version: %v", err)
+		return fmt.Errorf("could not update schema version: %w", err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -88,6 +88,31 @@ UPDATE version SET major = ?, minor = ?, patch = ?, revision = ?`
 	return nil
 }
 
+// an index created by the schema
+type schemaIndex struct {
+	name    string
+	table   string
+	columns string
+}
+
+// the indexes created by the schema, which are recreated by 'tmsu db optimize'
+// should any be missing
+var schemaIndexes = []schemaIndex{
+	{"idx_tag_name", "tag", "name"},
+	{"idx_tag_parent_id", "tag", "parent_id"},
+	{"idx_file_fingerprint", "file", "fingerprint"},
+	{"idx_file_identity_inode", "file_identity", "inode"},
+	{"idx_file_tag_file_id", "file_tag", "file_id"},
+	{"idx_file_tag_tag_id", "file_tag", "tag_id"},
+	{"idx_file_tag_value_id", "file_tag", "value_id"},
+	{"idx_content_tag_tag_id", "content_tag", "tag_id"},
+	{"idx_content_tag_value_id", "content_tag", "value_id"},
+	{"idx_alias_tag_id", "alias", "tag_id"},
+	{"idx_property_name", "property", "name"},
+	{"idx_tag_group_name", "tag_group", "name"},
+	{"idx_journal_operation_id", "journal", "operation_id"},
+}
+
 func createSchema(tx *sql.Tx) error {
 	if err := createTagTable(tx); err != nil {
 		return err
@@ -109,18 +134,82 @@ func createSchema(tx *sql.Tx) error {
 		return err
 	}
 
+	if err := createAliasTable(tx); err != nil {
+		return err
+	}
+
+	if err := createTagTypeTable(tx); err != nil {
+		return err
+	}
+
+	if err := createTagInfoTable(tx); err != nil {
+		return err
+	}
+
+	if err := createTagConstraintTable(tx); err != nil {
+		return err
+	}
+
+	if err := createTagGroupTable(tx); err != nil {
+		return err
+	}
+
+	if err := createContentTagTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileIdentityTable(tx); err != nil {
+		return err
+	}
+
+	if err := createNoteTable(tx); err != nil {
+		return err
+	}
+
+	if err := createPropertyTable(tx); err != nil {
+		return err
+	}
+
 	if err := createQueryTable(tx); err != nil {
 		return err
 	}
 
+	if err := createQueryUsageTable(tx); err != nil {
+		return err
+	}
+
+	if err := createRuleTable(tx); err != nil {
+		return err
+	}
+
+	if err := createViewTable(tx); err != nil {
+		return err
+	}
+
+	if err := createSnapshotTables(tx); err != nil {
+		return err
+	}
+
 	if err := createSettingTable(tx); err != nil {
 		return err
 	}
 
+	if err := createJournalTables(tx); err != nil {
+		return err
+	}
+
 	if err := createVersionTable(tx); err != nil {
 		return err
 	}
 
+	if err := createMigrationTable(tx); err != nil {
+		return err
+	}
+
+	if err := createSyncTable(tx); err != nil {
+		return err
+	}
+
 	if err := insertSchemaVersion(tx, latestSchemaVersion); err != nil {
 		return err
 	}
@@ -132,22 +221,23 @@ func createTagTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS tag (
     id INTEGER PRIMARY KEY,
-    name TEXT NOT NULL
+    name TEXT NOT NULL,
+    parent_id INTEGER NOT NULL DEFAULT 0
 )`
 
 	if _, err := tx.Exec(sql); err != nil {
 		return err
 	}
 
-	sql = `
-CREATE INDEX IF NOT EXISTS idx_tag_name
-ON tag(name)`
-
-	if _, err := tx.Exec(sql); err != nil {
+	if err := createIndex(tx, "idx_tag_name"); err != nil {
 		return err
 	}
 
-	return nil
+	return createTagParentIndex(tx)
+}
+
+func createTagParentIndex(tx *sql.Tx) error {
+	return createIndex(tx, "idx_tag_parent_id")
 }
 
 func createFileTable(tx *sql.Tx) error {
@@ -160,6 +250,7 @@ CREATE TABLE IF NOT EXISTS file (
     mod_time DATETIME NOT NULL,
     size INTEGER NOT NULL,
     is_dir BOOLEAN NOT NULL,
+    mime_type TEXT NOT NULL DEFAULT '',
     CONSTRAINT con_file_path UNIQUE (directory, name)
 )`
 
@@ -167,11 +258,7 @@ CREATE TABLE IF NOT EXISTS file (
 		return err
 	}
 
-	sql = `
-CREATE INDEX IF NOT EXISTS idx_file_fingerprint
-ON file(fingerprint)`
-
-	if _, err := tx.Exec(sql); err != nil {
+	if err := createIndex(tx, "idx_file_fingerprint"); err != nil {
 		return err
 	}
 
@@ -199,6 +286,8 @@ CREATE TABLE IF NOT EXISTS file_tag (
     file_id INTEGER NOT NULL,
     tag_id INTEGER NOT NULL,
     value_id INTEGER NOT NULL,
+    applied DATETIME,
+    applied_by TEXT,
     PRIMARY KEY (file_id, tag_id, value_id),
     FOREIGN KEY (file_id) REFERENCES file(id),
     FOREIGN KEY (tag_id) REFERENCES tag(id)
@@ -209,27 +298,41 @@ CREATE TABLE IF NOT EXISTS file_tag (
 		return err
 	}
 
-	sql = `
-CREATE INDEX IF NOT EXISTS idx_file_tag_file_id
-ON file_tag(file_id)`
+	if err := createIndex(tx, "idx_file_tag_file_id"); err != nil {
+		return err
+	}
 
-	if _, err := tx.Exec(sql); err != nil {
+	if err := createIndex(tx, "idx_file_tag_tag_id"); err != nil {
 		return err
 	}
 
-	sql = `
-CREATE INDEX IF NOT EXISTS idx_file_tag_tag_id
-ON file_tag(tag_id)`
+	if err := createIndex(tx, "idx_file_tag_value_id"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createContentTagTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS content_tag (
+    fingerprint TEXT NOT NULL,
+    tag_id INTEGER NOT NULL,
+    value_id INTEGER NOT NULL,
+    PRIMARY KEY (fingerprint, tag_id, value_id),
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+    FOREIGN KEY (value_id) REFERENCES value(id)
+)`
 
 	if _, err := tx.Exec(sql); err != nil {
 		return err
 	}
 
-	sql = `
-CREATE INDEX IF NOT EXISTS idx_file_tag_value_id
-ON file_tag(value_id)`
+	if err := createIndex(tx, "idx_content_tag_tag_id"); err != nil {
+		return err
+	}
 
-	if _, err := tx.Exec(sql); err != nil {
+	if err := createIndex(tx, "idx_content_tag_value_id"); err != nil {
 		return err
 	}
 
@@ -253,6 +356,165 @@ CREATE TABLE IF NOT EXISTS implication (
 	return nil
 }
 
+func createAliasTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS alias (
+    name TEXT PRIMARY KEY,
+    tag_id INTEGER NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := createIndex(tx, "idx_alias_tag_id"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createTagTypeTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS tag_type (
+    tag_id INTEGER PRIMARY KEY,
+    type TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createTagInfoTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS tag_info (
+    tag_id INTEGER PRIMARY KEY,
+    description TEXT NOT NULL,
+    colour TEXT NOT NULL,
+    icon TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createTagConstraintTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS tag_constraint (
+    tag_id INTEGER PRIMARY KEY,
+    pattern TEXT NOT NULL,
+    default_value TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createTagGroupTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS tag_group (
+    tag_id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tag(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return createIndex(tx, "idx_tag_group_name")
+}
+
+func createFileIdentityTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS file_identity (
+    file_id INTEGER PRIMARY KEY,
+    device INTEGER NOT NULL,
+    inode INTEGER NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return createIndex(tx, "idx_file_identity_inode")
+}
+
+func createNoteTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS note (
+    file_id INTEGER PRIMARY KEY,
+    text TEXT NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createPropertyTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS property (
+    file_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (file_id, name),
+    FOREIGN KEY (file_id) REFERENCES file(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return createIndex(tx, "idx_property_name")
+}
+
+func createRuleTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS rule (
+    id INTEGER PRIMARY KEY,
+    condition TEXT NOT NULL,
+    tags TEXT NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createViewTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS view (
+    name TEXT PRIMARY KEY,
+    query TEXT NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func createQueryTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS query (
@@ -266,6 +528,50 @@ CREATE TABLE IF NOT EXISTS query (
 	return nil
 }
 
+func createQueryUsageTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS query_usage (
+    text TEXT PRIMARY KEY,
+    count INTEGER NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createSnapshotTables(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS snapshot (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    query TEXT NOT NULL,
+    time DATETIME NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `
+CREATE TABLE IF NOT EXISTS snapshot_file (
+    snapshot_id INTEGER NOT NULL,
+    file_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    tags TEXT NOT NULL,
+    PRIMARY KEY (snapshot_id, file_id),
+    FOREIGN KEY (snapshot_id) REFERENCES snapshot(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func createSettingTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS setting (
@@ -280,6 +586,38 @@ CREATE TABLE IF NOT EXISTS setting (
 	return nil
 }
 
+func createJournalTables(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS operation (
+    id INTEGER PRIMARY KEY,
+    command TEXT NOT NULL,
+    time DATETIME NOT NULL,
+    open BOOLEAN NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `
+CREATE TABLE IF NOT EXISTS journal (
+    id INTEGER PRIMARY KEY,
+    operation_id INTEGER NOT NULL,
+    statement TEXT NOT NULL,
+    FOREIGN KEY (operation_id) REFERENCES operation(id)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := createIndex(tx, "idx_journal_operation_id"); err != nil {
+		return err
+	}
+
+	return createJournalTriggers(tx)
+}
+
 func createVersionTable(tx *sql.Tx) error {
 	sql := `
 CREATE TABLE IF NOT EXISTS version (
@@ -296,3 +634,54 @@ CREATE TABLE IF NOT EXISTS version (
 
 	return nil
 }
+
+func createMigrationTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS migration (
+    major NUMBER NOT NULL,
+    minor NUMBER NOT NULL,
+    patch NUMBER NOT NULL,
+    revision NUMBER NOT NULL,
+    description TEXT NOT NULL,
+    applied DATETIME NOT NULL,
+    PRIMARY KEY (major, minor, patch, revision)
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createSyncTable(tx *sql.Tx) error {
+	sql := `
+CREATE TABLE IF NOT EXISTS sync (
+    peer TEXT PRIMARY KEY,
+    time DATETIME NOT NULL
+)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createIndex(tx *sql.Tx, name string) error {
+	for _, index := range schemaIndexes {
+		if index.name == name {
+			sql := fmt.Sprintf(`
+CREATE INDEX IF NOT EXISTS %v
+ON %v(%v)`, index.name, index.table, index.columns)
+
+			if _, err := tx.Exec(sql); err != nil {
+				return err
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no such index '%v'", name)
+}
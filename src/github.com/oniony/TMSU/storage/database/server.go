@@ -0,0 +1,291 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"github.com/oniony/TMSU/common/log"
+	"net"
+	"net/rpc"
+	"os"
+	"strconv"
+)
+
+// Serves the database to clients connecting to the address, which is either
+// HOST:PORT or unix:PATH, until the listener fails. Clients must present the
+// secret before making requests: a secret is mandatory over TCP.
+func (database *Database) Serve(address, rootPath, secret string) error {
+	listener, err := Listen(address, secret)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	log.Infof(2, "serving database on '%v'", address)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go database.serveConnection(conn, rootPath, secret)
+	}
+}
+
+// Listens on the address, which is either HOST:PORT or unix:PATH, where only the
+// owner may connect to the socket of the latter. A secret is mandatory over TCP.
+func Listen(address, secret string) (net.Listener, error) {
+	network, listenAddress := remoteNetwork(address)
+
+	if network == "tcp" && secret == "" {
+		return nil, errors.New("a secret is required to serve over TCP")
+	}
+
+	if network == "unix" {
+		removeStaleSocket(listenAddress)
+	}
+
+	listener, err := net.Listen(network, listenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		if err := os.Chmod(listenAddress, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
+
+// unexported
+
+func (database *Database) serveConnection(conn net.Conn, rootPath, secret string) {
+	log.Infof(2, "%v: client connected", conn.RemoteAddr())
+
+	session := &remoteSession{database, nil, rootPath, secret, secret == ""}
+	defer session.close()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("Database", session); err != nil {
+		log.Warnf("could not register session: %v", err)
+		conn.Close()
+		return
+	}
+
+	server.ServeConn(conn)
+
+	log.Infof(2, "%v: client disconnected", conn.RemoteAddr())
+}
+
+func removeStaleSocket(path string) {
+	stat, err := os.Lstat(path)
+	if err == nil && stat.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+}
+
+var errNotAuthenticated = errors.New("not authenticated")
+var errNoTransaction = errors.New("no transaction in progress")
+
+// the state of a client's connection
+type remoteSession struct {
+	database      *Database
+	tx            *Tx
+	rootPath      string
+	secret        string
+	authenticated bool
+}
+
+func (session *remoteSession) Authenticate(secret string, rootPath *string) error {
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(session.secret)) != 1 {
+		return errors.New("authentication failed")
+	}
+
+	session.authenticated = true
+	*rootPath = session.rootPath
+
+	return nil
+}
+
+// Determines whether the database refuses changes, so that the client may
+// refuse them too before making any.
+func (session *remoteSession) ReadOnly(_ bool, readOnly *bool) error {
+	if !session.authenticated {
+		return errNotAuthenticated
+	}
+
+	*readOnly = session.database.readOnly
+
+	return nil
+}
+
+func (session *remoteSession) Begin(_ bool, _ *bool) error {
+	if !session.authenticated {
+		return errNotAuthenticated
+	}
+	if session.tx != nil {
+		return errors.New("transaction already in progress")
+	}
+
+	tx, err := session.beginTx()
+	if err != nil {
+		return err
+	}
+
+	session.tx = tx
+
+	return nil
+}
+
+func (session *remoteSession) Commit(_ bool, _ *bool) error {
+	if session.tx == nil {
+		return errNoTransaction
+	}
+
+	err := session.tx.Commit()
+	session.tx = nil
+
+	return err
+}
+
+func (session *remoteSession) Rollback(_ bool, _ *bool) error {
+	if session.tx == nil {
+		return errNoTransaction
+	}
+
+	err := session.tx.Rollback()
+	session.tx = nil
+
+	return err
+}
+
+func (session *remoteSession) Exec(request RemoteRequest, result *RemoteResult) error {
+	if !session.authenticated {
+		return errNotAuthenticated
+	}
+
+	log.Info(3, request.Query)
+	log.Infof(3, "params: %v", request.Args)
+
+	if session.database.readOnly {
+		return DatabaseReadOnlyError{}
+	}
+
+	var sqlResult sql.Result
+	var err error
+	if session.tx != nil {
+		sqlResult, err = session.tx.tx.Exec(request.Query, request.Args...)
+	} else {
+		var tx *Tx
+		if tx, err = session.beginTx(); err != nil {
+			return err
+		}
+
+		if sqlResult, err = tx.tx.Exec(request.Query, request.Args...); err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// not every statement has an inserted row
+	result.InsertedId, _ = sqlResult.LastInsertId()
+
+	result.AffectedRows, err = sqlResult.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (session *remoteSession) Query(request RemoteRequest, result *RemoteRows) error {
+	if !session.authenticated {
+		return errNotAuthenticated
+	}
+
+	log.Info(3, request.Query)
+	log.Infof(3, "params: %v", request.Args)
+
+	tx := session.tx
+	if tx == nil {
+		var err error
+		if tx, err = session.beginTx(); err != nil {
+			return err
+		}
+		defer tx.Commit()
+	}
+
+	rows, err := tx.tx.Query(request.Query, request.Args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	result.Columns, err = rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(result.Columns))
+		pointers := make([]interface{}, len(values))
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+
+		result.Values = append(result.Values, values)
+	}
+
+	return rows.Err()
+}
+
+// begins a transaction which, if the database is read-only, refuses changes
+// made by any statement, including those a client sends as queries
+func (session *remoteSession) beginTx() (*Tx, error) {
+	tx, err := session.database.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.tx.Exec("PRAGMA query_only = " + strconv.FormatBool(session.database.readOnly)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// rolls back any transaction left open by a client that has disconnected
+func (session *remoteSession) close() {
+	if session.tx != nil {
+		session.tx.Rollback()
+		session.tx = nil
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoteSessionRefusesChangesToReadOnlyDatabase(test *testing.T) {
+	// set-up
+
+	dir, err := ioutil.TempDir("", "tmsu-server")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+	if err := CreateAt(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	database, err := OpenReadOnlyAt(dbPath, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer database.Close()
+
+	session := &remoteSession{database, nil, dir, "", true}
+	defer session.close()
+
+	insert := RemoteRequest{"INSERT INTO tag (name) VALUES (?1)", []interface{}{"aubergine"}}
+
+	// test
+
+	var result RemoteResult
+	execErr := session.Exec(insert, &result)
+
+	var rows RemoteRows
+	queryErr := session.Query(insert, &rows)
+
+	if err := session.Begin(true, nil); err != nil {
+		test.Fatal(err)
+	}
+	txErr := session.Exec(insert, &result)
+	txQueryErr := session.Query(insert, &rows)
+	if err := session.Rollback(true, nil); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, ok := execErr.(DatabaseReadOnlyError); !ok {
+		test.Fatalf("Expected statement to be refused as the database is read-only but was: %v", execErr)
+	}
+	if queryErr == nil {
+		test.Fatal("Expected change sent as a query to be refused")
+	}
+	if _, ok := txErr.(DatabaseReadOnlyError); !ok {
+		test.Fatalf("Expected statement within transaction to be refused as the database is read-only but was: %v", txErr)
+	}
+	if txQueryErr == nil {
+		test.Fatal("Expected change sent as a query within transaction to be refused")
+	}
+
+	var readOnly bool
+	if err := session.ReadOnly(true, &readOnly); err != nil {
+		test.Fatal(err)
+	}
+	if !readOnly {
+		test.Fatal("Expected session to report the database as read-only")
+	}
+
+	rows = RemoteRows{}
+	if err := session.Query(RemoteRequest{"SELECT count(*) FROM tag", nil}, &rows); err != nil {
+		test.Fatalf("Expected query to be permitted but was: %v", err)
+	}
+	if len(rows.Values) != 1 || rows.Values[0][0] != int64(0) {
+		test.Fatalf("Expected no tags to have been added but count was %v", rows.Values)
+	}
+}
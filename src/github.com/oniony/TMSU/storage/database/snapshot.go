@@ -0,0 +1,211 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+	"strings"
+	"time"
+)
+
+// Retrieves the complete set of snapshots.
+func Snapshots(tx *Tx) (entities.Snapshots, error) {
+	sql := `
+SELECT id, name, query, time
+FROM snapshot
+ORDER BY name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readSnapshots(rows, make(entities.Snapshots, 0, 10))
+}
+
+// Retrieves a specific snapshot.
+func SnapshotByName(tx *Tx, name string) (*entities.Snapshot, error) {
+	sql := `
+SELECT id, name, query, time
+FROM snapshot
+WHERE name = ?`
+
+	rows, err := tx.Query(sql, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readSnapshot(rows)
+}
+
+// Adds a snapshot.
+func InsertSnapshot(tx *Tx, name, queryText string) (*entities.Snapshot, error) {
+	sql := `
+INSERT INTO snapshot (name, query, time)
+VALUES (?, ?, ?)`
+
+	now := time.Now().UTC()
+
+	result, err := tx.Exec(sql, name, queryText, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return &entities.Snapshot{entities.SnapshotId(id), name, queryText, now}, nil
+}
+
+// Retrieves the files recorded by a snapshot.
+func SnapshotFiles(tx *Tx, snapshotId entities.SnapshotId) (entities.SnapshotFiles, error) {
+	sql := `
+SELECT file_id, path, tags
+FROM snapshot_file
+WHERE snapshot_id = ?
+ORDER BY path`
+
+	rows, err := tx.Query(sql, snapshotId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshotFiles := make(entities.SnapshotFiles, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var snapshotFile entities.SnapshotFile
+		var tags string
+		if err := rows.Scan(&snapshotFile.FileId, &snapshotFile.Path, &tags); err != nil {
+			return nil, err
+		}
+
+		if tags != "" {
+			snapshotFile.Tags = strings.Split(tags, "\n")
+		}
+
+		snapshotFiles = append(snapshotFiles, &snapshotFile)
+	}
+
+	return snapshotFiles, rows.Err()
+}
+
+// Records a file within a snapshot.
+func InsertSnapshotFile(tx *Tx, snapshotId entities.SnapshotId, snapshotFile entities.SnapshotFile) error {
+	sql := `
+INSERT INTO snapshot_file (snapshot_id, file_id, path, tags)
+VALUES (?, ?, ?, ?)`
+
+	// tag and value names cannot contain control characters
+	tags := strings.Join(snapshotFile.Tags, "\n")
+
+	result, err := tx.Exec(sql, snapshotId, snapshotFile.FileId, snapshotFile.Path, tags)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// Deletes a snapshot and the files it recorded.
+func DeleteSnapshot(tx *Tx, name string) error {
+	sql := `
+DELETE FROM snapshot_file
+WHERE snapshot_id IN (SELECT id
+                      FROM snapshot
+                      WHERE name = ?)`
+
+	if _, err := tx.Exec(sql, name); err != nil {
+		return err
+	}
+
+	sql = `
+DELETE FROM snapshot
+WHERE name = ?`
+
+	result, err := tx.Exec(sql, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchSnapshotError{name}
+	}
+
+	return nil
+}
+
+// unexported
+
+func readSnapshot(rows *sql.Rows) (*entities.Snapshot, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var snapshot entities.Snapshot
+	if err := rows.Scan(&snapshot.Id, &snapshot.Name, &snapshot.Query, &snapshot.Time); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+func readSnapshots(rows *sql.Rows, snapshots entities.Snapshots) (entities.Snapshots, error) {
+	for {
+		snapshot, err := readSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot == nil {
+			break
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+)
+
+// Retrieves the time at which the database was last synchronized with the
+// specified peer database, or the zero time if it never has been.
+func LastSyncTime(tx *Tx, peer string) (time.Time, error) {
+	sql := `
+SELECT time
+FROM sync
+WHERE peer = ?`
+
+	rows, err := tx.Query(sql, peer)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return time.Time{}, rows.Err()
+	}
+
+	var syncTime time.Time
+	if err := rows.Scan(&syncTime); err != nil {
+		return time.Time{}, err
+	}
+
+	return syncTime, nil
+}
+
+// Records the time at which the database was synchronized with the specified
+// peer database.
+func UpdateSyncTime(tx *Tx, peer string, syncTime time.Time) error {
+	sql := `
+INSERT OR REPLACE INTO sync (peer, time)
+VALUES (?, ?)`
+
+	if _, err := tx.Exec(sql, peer, syncTime); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"database/sql"
 	"github.com/oniony/TMSU/entities"
 	"strings"
+	"unicode/utf8"
 )
 
 // The number of tags in the database.
@@ -38,10 +39,15 @@ FROM tag`
 
 // The set of tags.
 func Tags(tx *Tx) (entities.Tags, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
 SELECT id, name
 FROM tag
-ORDER BY name`
+ORDER BY name` + nameCollation
 
 	rows, err := tx.Query(sql)
 	if err != nil {
@@ -149,12 +155,12 @@ WHERE name ` + collation + ` IN (?`
 }
 
 // Adds a tag.
-func InsertTag(tx *Tx, name string) (*entities.Tag, error) {
+func InsertTag(tx *Tx, name string, parentId entities.TagId) (*entities.Tag, error) {
 	sql := `
-INSERT INTO tag (name)
-VALUES (?)`
+INSERT INTO tag (name, parent_id)
+VALUES (?, ?)`
 
-	result, err := tx.Exec(sql, name)
+	result, err := tx.Exec(sql, name, parentId)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +204,99 @@ WHERE id = ?`
 	return &entities.Tag{tagId, name}, nil
 }
 
+// Updates the parent of a tag.
+func UpdateTagParent(tx *Tx, tagId, parentId entities.TagId) error {
+	sql := `
+UPDATE tag
+SET parent_id = ?
+WHERE id = ?`
+
+	result, err := tx.Exec(sql, parentId, tagId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// The number of child tags of a tag.
+func ChildTagCount(tx *Tx, tagId entities.TagId) (uint, error) {
+	sql := `
+SELECT count(1)
+FROM tag
+WHERE parent_id = ?`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Retrieves the set of tags whose names begin with the specified prefix.
+func TagsByNamePrefix(tx *Tx, prefix string) (entities.Tags, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+SELECT id, name
+FROM tag
+WHERE substr(name, 1, ?) = ?
+ORDER BY name` + nameCollation
+
+	rows, err := tx.Query(sql, utf8.RuneCountInString(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(entities.Tags, 0, 10))
+}
+
+// Retrieves the set of tags beneath a tag in the tag hierarchy.
+func DescendantTags(tx *Tx, tagId entities.TagId) (entities.Tags, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+WITH RECURSIVE descendant (id) AS
+(
+    SELECT id
+    FROM tag
+    WHERE parent_id = ?
+    UNION
+    SELECT tag.id
+    FROM tag, descendant
+    WHERE tag.parent_id = descendant.id
+)
+SELECT id, name
+FROM tag
+WHERE id IN (SELECT id FROM descendant)
+ORDER BY name` + nameCollation
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(entities.Tags, 0, 10))
+}
+
 // Deletes a tag.
 func DeleteTag(tx *Tx, tagId entities.TagId) error {
 	sql := `
@@ -222,12 +321,17 @@ WHERE id = ?`
 
 // Retrieves the usage of each tag
 func TagUsage(tx *Tx) ([]entities.TagFileCount, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
 SELECT t.id, t.name, count(file_id)
 FROM file_tag ft, tag t
 WHERE ft.tag_id = t.id
 GROUP BY t.id
-ORDER BY t.name`
+ORDER BY t.name` + nameCollation
 
 	rows, err := tx.Query(sql)
 	if err != nil {
@@ -235,27 +339,119 @@ ORDER BY t.name`
 	}
 	defer rows.Close()
 
-	tags := make([]entities.TagFileCount, 0, 10)
-	for {
-		if !rows.Next() {
-			break
-		}
+	return readTagFileCounts(rows)
+}
+
+// Retrieves the usage of the most used tags, most used first. A limit of zero retrieves every tag.
+func TopTagUsage(tx *Tx, limit uint) ([]entities.TagFileCount, error) {
+	builder := NewBuilder()
+	builder.AppendSql(`
+SELECT t.id, t.name, count(DISTINCT file_id)
+FROM file_tag ft, tag t
+WHERE ft.tag_id = t.id
+GROUP BY t.id
+ORDER BY count(DISTINCT file_id) DESC, t.name
+`)
+	buildLimit(limit, builder)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagFileCounts(rows)
+}
+
+// Retrieves the number of files to which each pair of tags, in name order, is applied together,
+// most common first. A limit of zero retrieves every pair.
+func TagPairUsage(tx *Tx, limit uint) ([]entities.TagPairFileCount, error) {
+	builder := NewBuilder()
+	builder.AppendSql(`
+SELECT t1.id, t1.name, t2.id, t2.name, count(DISTINCT ft1.file_id)
+FROM file_tag ft1
+INNER JOIN tag t1 ON t1.id = ft1.tag_id
+INNER JOIN file_tag ft2 ON ft2.file_id = ft1.file_id
+INNER JOIN tag t2 ON t2.id = ft2.tag_id AND t2.name > t1.name
+GROUP BY t1.id, t2.id
+ORDER BY count(DISTINCT ft1.file_id) DESC, t1.name, t2.name
+`)
+	buildLimit(limit, builder)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := make([]entities.TagPairFileCount, 0, 10)
+	for rows.Next() {
 		if rows.Err() != nil {
 			return nil, rows.Err()
 		}
 
-		var tagId entities.TagId
-		var name string
-		var count uint
-		err := rows.Scan(&tagId, &name, &count)
-		if err != nil {
+		var pair entities.TagPairFileCount
+		if err := rows.Scan(&pair.TagId, &pair.TagName, &pair.OtherTagId, &pair.OtherTagName, &pair.FileCount); err != nil {
 			return nil, err
 		}
 
-		tags = append(tags, entities.TagFileCount{tagId, name, count})
+		pairs = append(pairs, pair)
 	}
 
-	return tags, nil
+	return pairs, nil
+}
+
+// Retrieves the tags most often applied to the other files that have any of the specified tags,
+// most common first, omitting the specified tags and those already applied to the specified files.
+// A limit of zero retrieves every tag.
+func CoOccurringTags(tx *Tx, tagIds entities.TagIds, fileIds entities.FileIds, limit uint) ([]entities.TagFileCount, error) {
+	if len(tagIds) == 0 {
+		return []entities.TagFileCount{}, nil
+	}
+
+	builder := NewBuilder()
+	builder.AppendSql(`
+SELECT t.id, t.name, count(DISTINCT ft.file_id)
+FROM file_tag ft
+INNER JOIN tag t ON t.id = ft.tag_id
+WHERE ft.file_id IN (SELECT file_id FROM file_tag WHERE tag_id IN (`)
+	for _, tagId := range tagIds {
+		builder.AppendParam(tagId)
+	}
+	builder.AppendSql(`))
+AND ft.tag_id NOT IN (`)
+	for _, tagId := range tagIds {
+		builder.AppendParam(tagId)
+	}
+	builder.AppendSql(")")
+
+	if len(fileIds) > 0 {
+		builder.AppendSql(`
+AND ft.file_id NOT IN (`)
+		for _, fileId := range fileIds {
+			builder.AppendParam(fileId)
+		}
+		builder.AppendSql(`)
+AND ft.tag_id NOT IN (SELECT tag_id FROM file_tag WHERE file_id IN (`)
+		for _, fileId := range fileIds {
+			builder.AppendParam(fileId)
+		}
+		builder.AppendSql("))")
+	}
+
+	builder.AppendSql(`
+GROUP BY t.id
+ORDER BY count(DISTINCT ft.file_id) DESC, t.name
+`)
+	buildLimit(limit, builder)
+
+	rows, err := tx.Query(builder.Sql(), builder.Params()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagFileCounts(rows)
 }
 
 // unexported
@@ -293,3 +489,27 @@ func readTags(rows *sql.Rows, tags entities.Tags) (entities.Tags, error) {
 
 	return tags, nil
 }
+
+func readTagFileCounts(rows *sql.Rows) ([]entities.TagFileCount, error) {
+	tags := make([]entities.TagFileCount, 0, 10)
+	for {
+		if !rows.Next() {
+			break
+		}
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var tagId entities.TagId
+		var name string
+		var count uint
+		err := rows.Scan(&tagId, &name, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, entities.TagFileCount{tagId, name, count})
+	}
+
+	return tags, nil
+}
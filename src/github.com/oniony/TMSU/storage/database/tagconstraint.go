@@ -0,0 +1,133 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the constraints of every tag that has any.
+func TagConstraints(tx *Tx) (entities.TagConstraints, error) {
+	sql := `
+SELECT tag.id, tag.name, tag_constraint.pattern, tag_constraint.default_value
+FROM tag_constraint
+INNER JOIN tag ON tag_constraint.tag_id = tag.id
+ORDER BY tag.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagConstraints(rows, make(entities.TagConstraints, 0, 10))
+}
+
+// Retrieves the constraint of the specified tag, or nil if it has none.
+func TagConstraint(tx *Tx, tagId entities.TagId) (*entities.TagConstraint, error) {
+	sql := `
+SELECT tag.id, tag.name, tag_constraint.pattern, tag_constraint.default_value
+FROM tag_constraint
+INNER JOIN tag ON tag_constraint.tag_id = tag.id
+WHERE tag_constraint.tag_id = ?`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagConstraint(rows)
+}
+
+// Sets the constraint of the specified tag, removing it if it is empty.
+func UpdateTagConstraint(tx *Tx, tagId entities.TagId, pattern, defaultValue string) error {
+	if err := DeleteTagConstraint(tx, tagId); err != nil {
+		return err
+	}
+
+	if pattern == "" && defaultValue == "" {
+		return nil
+	}
+
+	sql := `
+INSERT INTO tag_constraint (tag_id, pattern, default_value)
+VALUES (?, ?, ?)`
+
+	result, err := tx.Exec(sql, tagId, pattern, defaultValue)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// Removes the constraint of the specified tag.
+func DeleteTagConstraint(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM tag_constraint
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readTagConstraint(rows *sql.Rows) (*entities.TagConstraint, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var tagId entities.TagId
+	var tagName, pattern, defaultValue string
+	if err := rows.Scan(&tagId, &tagName, &pattern, &defaultValue); err != nil {
+		return nil, err
+	}
+
+	return &entities.TagConstraint{entities.Tag{tagId, tagName}, pattern, defaultValue}, nil
+}
+
+func readTagConstraints(rows *sql.Rows, tagConstraints entities.TagConstraints) (entities.TagConstraints, error) {
+	for {
+		tagConstraint, err := readTagConstraint(rows)
+		if err != nil {
+			return nil, err
+		}
+		if tagConstraint == nil {
+			break
+		}
+
+		tagConstraints = append(tagConstraints, tagConstraint)
+	}
+
+	return tagConstraints, nil
+}
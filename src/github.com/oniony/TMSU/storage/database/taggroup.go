@@ -0,0 +1,148 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the complete set of tag groups, with their tags, in name order.
+func TagGroups(tx *Tx) (entities.TagGroups, error) {
+	sql := `
+SELECT tag_group.name, tag.id, tag.name
+FROM tag_group
+INNER JOIN tag ON tag_group.tag_id = tag.id
+ORDER BY tag_group.name, tag.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagGroups(rows, make(entities.TagGroups, 0, 10))
+}
+
+// Retrieves the name of the group of the specified tag, or an empty string if
+// it is in no group.
+func TagGroupName(tx *Tx, tagId entities.TagId) (string, error) {
+	sql := `
+SELECT name
+FROM tag_group
+WHERE tag_id = ?`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+
+	var name string
+	if err := rows.Scan(&name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// Places the specified tag in the group with the specified name, removing it
+// from any other group.
+func UpdateTagGroup(tx *Tx, tagId entities.TagId, name string) error {
+	if err := DeleteTagGroup(tx, tagId); err != nil {
+		return err
+	}
+
+	sql := `
+INSERT INTO tag_group (tag_id, name)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, tagId, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// Removes the specified tag from its group.
+func DeleteTagGroup(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM tag_group
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the number of files tagged with both the specified tag and another
+// tag of the group with the specified name.
+func TagGroupConflictCount(tx *Tx, tagId entities.TagId, name string) (uint, error) {
+	sql := `
+SELECT count(DISTINCT file_tag.file_id)
+FROM file_tag
+INNER JOIN file_tag other ON other.file_id = file_tag.file_id
+INNER JOIN tag_group ON tag_group.tag_id = other.tag_id
+WHERE file_tag.tag_id = ?1 AND other.tag_id != ?1 AND tag_group.name = ?2`
+
+	rows, err := tx.Query(sql, tagId, name)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// unexported
+
+func readTagGroups(rows *sql.Rows, tagGroups entities.TagGroups) (entities.TagGroups, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var name, tagName string
+		var tagId entities.TagId
+		if err := rows.Scan(&name, &tagId, &tagName); err != nil {
+			return nil, err
+		}
+
+		if count := len(tagGroups); count == 0 || tagGroups[count-1].Name != name {
+			tagGroups = append(tagGroups, &entities.TagGroup{name, entities.Tags{}})
+		}
+
+		tagGroup := tagGroups[len(tagGroups)-1]
+		tagGroup.Tags = append(tagGroup.Tags, &entities.Tag{tagId, tagName})
+	}
+
+	return tagGroups, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the information of every tag that has any.
+func TagInfos(tx *Tx) (entities.TagInfos, error) {
+	sql := `
+SELECT tag.id, tag.name, tag_info.description, tag_info.colour, tag_info.icon
+FROM tag_info
+INNER JOIN tag ON tag_info.tag_id = tag.id
+ORDER BY tag.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagInfos(rows, make(entities.TagInfos, 0, 10))
+}
+
+// Retrieves the information of the specified tag, or nil if it has none.
+func TagInfo(tx *Tx, tagId entities.TagId) (*entities.TagInfo, error) {
+	sql := `
+SELECT tag.id, tag.name, tag_info.description, tag_info.colour, tag_info.icon
+FROM tag_info
+INNER JOIN tag ON tag_info.tag_id = tag.id
+WHERE tag_info.tag_id = ?`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagInfo(rows)
+}
+
+// Sets the information of the specified tag, removing it if it is empty.
+func UpdateTagInfo(tx *Tx, tagId entities.TagId, description, colour, icon string) error {
+	if err := DeleteTagInfo(tx, tagId); err != nil {
+		return err
+	}
+
+	if description == "" && colour == "" && icon == "" {
+		return nil
+	}
+
+	sql := `
+INSERT INTO tag_info (tag_id, description, colour, icon)
+VALUES (?, ?, ?, ?)`
+
+	result, err := tx.Exec(sql, tagId, description, colour, icon)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// Removes the information of the specified tag.
+func DeleteTagInfo(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM tag_info
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readTagInfo(rows *sql.Rows) (*entities.TagInfo, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var tagId entities.TagId
+	var tagName, description, colour, icon string
+	if err := rows.Scan(&tagId, &tagName, &description, &colour, &icon); err != nil {
+		return nil, err
+	}
+
+	return &entities.TagInfo{entities.Tag{tagId, tagName}, description, colour, icon}, nil
+}
+
+func readTagInfos(rows *sql.Rows, tagInfos entities.TagInfos) (entities.TagInfos, error) {
+	for {
+		tagInfo, err := readTagInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		if tagInfo == nil {
+			break
+		}
+
+		tagInfos = append(tagInfos, tagInfo)
+	}
+
+	return tagInfos, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the complete set of tag types.
+func TagTypes(tx *Tx) (entities.TagTypes, error) {
+	sql := `
+SELECT tag.id, tag.name, tag_type.type
+FROM tag_type
+INNER JOIN tag ON tag_type.tag_id = tag.id
+ORDER BY tag.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagTypes(rows, make(entities.TagTypes, 0, 10))
+}
+
+// Retrieves the type of the values of the specified tag.
+func TagType(tx *Tx, tagId entities.TagId) (entities.ValueType, error) {
+	sql := `
+SELECT type
+FROM tag_type
+WHERE tag_id = ?`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return entities.UntypedValues, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return entities.UntypedValues, rows.Err()
+	}
+
+	var valueType string
+	if err := rows.Scan(&valueType); err != nil {
+		return entities.UntypedValues, err
+	}
+
+	return entities.ValueType(valueType), nil
+}
+
+// Sets the type of the values of the specified tag.
+func UpdateTagType(tx *Tx, tagId entities.TagId, valueType entities.ValueType) error {
+	if err := DeleteTagType(tx, tagId); err != nil {
+		return err
+	}
+
+	if valueType == entities.UntypedValues {
+		return nil
+	}
+
+	sql := `
+INSERT INTO tag_type (tag_id, type)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, tagId, string(valueType))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return nil
+}
+
+// Removes the type of the values of the specified tag.
+func DeleteTagType(tx *Tx, tagId entities.TagId) error {
+	sql := `
+DELETE FROM tag_type
+WHERE tag_id = ?`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readTagType(rows *sql.Rows) (*entities.TagType, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var tagId entities.TagId
+	var tagName, valueType string
+	if err := rows.Scan(&tagId, &tagName, &valueType); err != nil {
+		return nil, err
+	}
+
+	return &entities.TagType{entities.Tag{tagId, tagName}, entities.ValueType(valueType)}, nil
+}
+
+func readTagTypes(rows *sql.Rows, tagTypes entities.TagTypes) (entities.TagTypes, error) {
+	for {
+		tagType, err := readTagType(rows)
+		if err != nil {
+			return nil, err
+		}
+		if tagType == nil {
+			break
+		}
+
+		tagTypes = append(tagTypes, tagType)
+	}
+
+	return tagTypes, nil
+}
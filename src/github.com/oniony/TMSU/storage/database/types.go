@@ -18,6 +18,8 @@ package database
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common"
+	"strconv"
+	"strings"
 )
 
 // unexported
@@ -32,9 +34,42 @@ func (version schemaVersion) String() string {
 }
 
 func (this schemaVersion) LessThan(that schemaVersion) bool {
-	return this.Major < that.Major || this.Minor < that.Minor || this.Patch < that.Patch || this.Revision < that.Revision
+	return this.Version.LessThan(that.Version) || (this.Version == that.Version && this.Revision < that.Revision)
 }
 
 func (this schemaVersion) GreaterThan(that schemaVersion) bool {
-	return this.Major > that.Major || this.Minor > that.Minor || this.Patch > that.Patch || this.Revision > that.Revision
+	return this.Version.GreaterThan(that.Version) || (this.Version == that.Version && this.Revision > that.Revision)
+}
+
+// parses a schema version of the form MAJOR.MINOR.PATCH-REVISION, where the
+// revision defaults to zero
+func parseSchemaVersion(text string) (schemaVersion, error) {
+	invalid := fmt.Errorf("invalid schema version '%v': expected MAJOR.MINOR.PATCH-REVISION", text)
+
+	revision := uint64(0)
+	if index := strings.Index(text, "-"); index != -1 {
+		var err error
+		if revision, err = strconv.ParseUint(text[index+1:], 10, 32); err != nil {
+			return schemaVersion{}, invalid
+		}
+
+		text = text[:index]
+	}
+
+	parts := strings.Split(text, ".")
+	if len(parts) != 3 {
+		return schemaVersion{}, invalid
+	}
+
+	numbers := make([]uint, len(parts))
+	for index, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return schemaVersion{}, invalid
+		}
+
+		numbers[index] = uint(number)
+	}
+
+	return schemaVersion{common.Version{numbers[0], numbers[1], numbers[2]}, uint(revision)}, nil
 }
@@ -0,0 +1,59 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/oniony/TMSU/common"
+	"testing"
+)
+
+func TestSchemaVersionLessThan(test *testing.T) {
+	// set-up
+
+	older := schemaVersion{common.Version{0, 7, 0}, 4}
+	newer := schemaVersion{common.Version{0, 8, 0}, 0}
+
+	// validate
+
+	if !older.LessThan(newer) || newer.LessThan(older) || older.LessThan(older) {
+		test.Fatalf("Unexpected ordering of %v and %v", older, newer)
+	}
+	if !newer.GreaterThan(older) || older.GreaterThan(newer) {
+		test.Fatalf("Unexpected ordering of %v and %v", newer, older)
+	}
+}
+
+func TestParseSchemaVersion(test *testing.T) {
+	// test
+
+	version, err := parseSchemaVersion("0.8.0-7")
+
+	// validate
+
+	if err != nil || version != (schemaVersion{common.Version{0, 8, 0}, 7}) {
+		test.Fatalf("Unexpected version %v: %v", version, err)
+	}
+
+	if version, err := parseSchemaVersion("0.7.0"); err != nil || version != (schemaVersion{common.Version{0, 7, 0}, 0}) {
+		test.Fatalf("Unexpected version %v: %v", version, err)
+	}
+
+	for _, text := range []string{"", "0.8", "0.8.x-1", "0.8.0-", "0.8.0-1-2"} {
+		if _, err := parseSchemaVersion(text); err == nil {
+			test.Fatalf("Expected '%v' to be invalid", text)
+		}
+	}
+}
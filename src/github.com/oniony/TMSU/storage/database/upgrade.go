@@ -17,70 +17,166 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/oniony/TMSU/common"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"path/filepath"
+	"time"
 )
 
 // unexported
 
+// a change to the schema, applied to databases with an earlier schema version
+type migration struct {
+	version     schemaVersion
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// the migrations in the order they are applied. The version of the last must
+// be the latest schema version.
+var migrations = []migration{
+	{schemaVersion{common.Version{0, 5, 0}, 0}, "renaming fingerprint algorithm setting", renameFingerprintAlgorithmSetting},
+	{schemaVersion{common.Version{0, 6, 0}, 0}, "recreating implication table", recreateImplicationTable},
+	{schemaVersion{common.Version{0, 7, 0}, 0}, "updating fingerprint algorithms", updateFingerprintAlgorithms},
+	{schemaVersion{common.Version{0, 7, 0}, 1}, "recreating version table", recreateVersionTable},
+	{schemaVersion{common.Version{0, 7, 0}, 2}, "creating alias table", createAliasTable},
+	{schemaVersion{common.Version{0, 7, 0}, 3}, "adding tag hierarchy", addTagParentColumn},
+	{schemaVersion{common.Version{0, 7, 0}, 4}, "creating note table", createNoteTable},
+	{schemaVersion{common.Version{0, 8, 0}, 0}, "creating journal tables", createJournalTables},
+	{schemaVersion{common.Version{0, 8, 0}, 1}, "creating rule table", createRuleTable},
+	{schemaVersion{common.Version{0, 8, 0}, 2}, "adding file MIME type column", addFileMimeTypeColumn},
+	{schemaVersion{common.Version{0, 8, 0}, 3}, "creating view table", createViewTable},
+	{schemaVersion{common.Version{0, 8, 0}, 4}, "creating tag type table", journaled(createTagTypeTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 5}, "creating query usage table", createQueryUsageTable},
+	{schemaVersion{common.Version{0, 8, 0}, 6}, "creating tag info table", journaled(createTagInfoTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 7}, "creating content tag table", journaled(createContentTagTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 8}, "creating migration history table", createMigrationTable},
+	{schemaVersion{common.Version{0, 8, 0}, 9}, "adding file tag applied column", addFileTagAppliedColumn},
+	{schemaVersion{common.Version{0, 8, 0}, 10}, "adding file tag applied by column", addFileTagAppliedByColumn},
+	{schemaVersion{common.Version{0, 8, 0}, 11}, "creating sync table", createSyncTable},
+	{schemaVersion{common.Version{0, 8, 0}, 12}, "creating property table", journaled(createPropertyTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 13}, "creating tag group table", journaled(createTagGroupTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 14}, "creating file identity table", journaled(createFileIdentityTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 15}, "merging duplicate file entries", mergeDuplicateFiles},
+	{schemaVersion{common.Version{0, 8, 0}, 16}, "creating tag constraint table", journaled(createTagConstraintTable)},
+	{schemaVersion{common.Version{0, 8, 0}, 17}, "creating snapshot tables", createSnapshotTables},
+}
+
+// the description recorded in the migration history for a newly created schema
+const createdSchemaDescription = "creating schema"
+
 func upgrade(tx *sql.Tx) error {
-	version := currentSchemaVersion(tx)
+	_, err := migrate(tx, latestSchemaVersion)
+	return err
+}
+
+// applies the migrations up to and including the target version, returning those applied
+func migrate(tx *sql.Tx, target schemaVersion) ([]migration, error) {
+	version, err := checkSchemaVersion(tx)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Infof(2, "database schema has version %v, latest schema version is %v", version, latestSchemaVersion)
 
-	if version == latestSchemaVersion {
+	if version == target {
 		log.Infof(2, "schema is up to date")
-		return nil
+		return nil, nil
+	}
+
+	if target.LessThan(version) {
+		return nil, fmt.Errorf("cannot migrate database schema from version %v to earlier version %v: migrations cannot be reversed", version, target)
 	}
 
+	applied := make([]migration, 0, len(migrations))
+
 	noVersion := schemaVersion{}
 	if version == noVersion {
 		log.Infof(2, "creating schema")
 
 		if err := createSchema(tx); err != nil {
-			return err
+			return nil, err
 		}
 
 		// still need to run upgrade as per 0.5.0 database did not store a version
+		target = latestSchemaVersion
+		applied = append(applied, migration{latestSchemaVersion, createdSchemaDescription, nil})
 	}
 
 	log.Infof(2, "upgrading database")
 
-	if version.LessThan(schemaVersion{common.Version{0, 5, 0}, 0}) {
-		log.Infof(2, "renaming fingerprint algorithm setting")
+	for _, migration := range migrations {
+		if !version.LessThan(migration.version) {
+			continue
+		}
+		if target.LessThan(migration.version) {
+			break
+		}
+
+		log.Infof(2, "%v", migration.description)
 
-		if err := renameFingerprintAlgorithmSetting(tx); err != nil {
-			return err
+		if err := migration.apply(tx); err != nil {
+			return nil, err
+		}
+
+		if version != noVersion {
+			applied = append(applied, migration)
 		}
 	}
-	if version.LessThan(schemaVersion{common.Version{0, 6, 0}, 0}) {
-		log.Infof(2, "recreating implication table")
 
-		if err := recreateImplicationTable(tx); err != nil {
-			return err
+	// migrations are recorded from the schema version that introduced the history
+	if tableExists(tx, "migration") {
+		log.Infof(2, "recording migrations")
+
+		now := time.Now().UTC()
+		for _, migration := range applied {
+			if err := insertMigration(tx, migration, now); err != nil {
+				return nil, err
+			}
 		}
 	}
-	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 0}) {
-		log.Infof(2, "updating fingerprint algorithms")
 
-		if err := updateFingerprintAlgorithms(tx); err != nil {
-			return err
+	log.Infof(2, "updating schema version")
+	if err := updateSchemaVersion(tx, target); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// retrieves the schema version of the database, which must not be newer than
+// the latest schema version
+func checkSchemaVersion(tx *sql.Tx) (schemaVersion, error) {
+	version := currentSchemaVersion(tx)
+	if latestSchemaVersion.LessThan(version) {
+		return version, SchemaVersionError{version.String(), latestSchemaVersion.String()}
+	}
+
+	return version, nil
+}
+
+// the migration with the specified version
+func findMigration(version schemaVersion) (migration, bool) {
+	for _, migration := range migrations {
+		if migration.version == version {
+			return migration, true
 		}
 	}
-	if version.LessThan(schemaVersion{common.Version{0, 7, 0}, 1}) {
-		log.Infof(2, "recreating version table")
 
-		if err := recreateVersionTable(tx); err != nil {
+	return migration{}, false
+}
+
+// applies a migration creating a table and then journals the new table
+func journaled(create func(tx *sql.Tx) error) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if err := create(tx); err != nil {
 			return err
 		}
-	}
 
-	log.Infof(2, "updating schema version")
-	if err := updateSchemaVersion(tx, latestSchemaVersion); err != nil {
-		return err
+		return createJournalTriggers(tx)
 	}
-
-	return nil
 }
 
 func renameFingerprintAlgorithmSetting(tx *sql.Tx) error {
@@ -176,3 +272,311 @@ func recreateVersionTable(tx *sql.Tx) error {
 
 	return nil
 }
+
+func addTagParentColumn(tx *sql.Tx) error {
+	if !columnExists(tx, "tag", "parent_id") {
+		if _, err := tx.Exec(`
+ALTER TABLE tag
+ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return err
+		}
+	}
+
+	if err := createTagParentIndex(tx); err != nil {
+		return err
+	}
+
+	// link existing hierarchical tags to their parents, creating any that are missing
+	rows, err := tx.Query(`
+SELECT id, name
+FROM tag
+WHERE name LIKE '%/%'
+ORDER BY length(name)`)
+	if err != nil {
+		return err
+	}
+
+	type hierarchicalTag struct {
+		id   uint
+		name string
+	}
+
+	tags := make([]hierarchicalTag, 0, 10)
+	for rows.Next() {
+		var tag hierarchicalTag
+		if err := rows.Scan(&tag.id, &tag.name); err != nil {
+			rows.Close()
+			return err
+		}
+
+		tags = append(tags, tag)
+	}
+	rows.Close()
+
+	for _, tag := range tags {
+		if entities.ValidateTagName(tag.name) != nil {
+			continue
+		}
+
+		parentId, err := upgradeParentTagId(tx, entities.ParentTagName(tag.name))
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`
+UPDATE tag
+SET parent_id = ?
+WHERE id = ?`, parentId, tag.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFileMimeTypeColumn(tx *sql.Tx) error {
+	if !columnExists(tx, "file", "mime_type") {
+		if _, err := tx.Exec(`
+ALTER TABLE file
+ADD COLUMN mime_type TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+
+	// the file journal triggers must record the new column
+	for _, event := range []string{"insert", "update", "delete"} {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS trg_file_" + event + "_journal"); err != nil {
+			return err
+		}
+	}
+
+	if err := createJournalTriggers(tx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// the time at which the existing file tags were applied is not known so is left null
+func addFileTagAppliedColumn(tx *sql.Tx) error {
+	if !columnExists(tx, "file_tag", "applied") {
+		if _, err := tx.Exec(`
+ALTER TABLE file_tag
+ADD COLUMN applied DATETIME`); err != nil {
+			return err
+		}
+	}
+
+	// the file tag journal triggers must record the new column
+	for _, event := range []string{"insert", "update", "delete"} {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS trg_file_tag_" + event + "_journal"); err != nil {
+			return err
+		}
+	}
+
+	if err := createJournalTriggers(tx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// the user who applied the existing file tags is not known so is left null
+func addFileTagAppliedByColumn(tx *sql.Tx) error {
+	if !columnExists(tx, "file_tag", "applied_by") {
+		if _, err := tx.Exec(`
+ALTER TABLE file_tag
+ADD COLUMN applied_by TEXT`); err != nil {
+			return err
+		}
+	}
+
+	// the file tag journal triggers must record the new column
+	for _, event := range []string{"insert", "update", "delete"} {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS trg_file_tag_" + event + "_journal"); err != nil {
+			return err
+		}
+	}
+
+	if err := createJournalTriggers(tx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// merges the files whose stored paths differ only in that they were not
+// cleaned, e.g. './photo.jpg' and 'photo.jpg', into the earliest of them and
+// stores its path cleaned
+func mergeDuplicateFiles(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+SELECT id, directory, name
+FROM file
+ORDER BY id`)
+	if err != nil {
+		return err
+	}
+
+	type fileIds struct{ fileId, duplicateId uint }
+
+	fileIdsByPath := make(map[string]uint)
+	merges := make([]fileIds, 0, 10)
+	cleanedDirectories := make(map[uint]string)
+	for rows.Next() {
+		var id uint
+		var directory, name string
+		if err := rows.Scan(&id, &directory, &name); err != nil {
+			rows.Close()
+			return err
+		}
+
+		cleanDirectory := filepath.Clean(directory)
+		path := filepath.Join(cleanDirectory, name)
+
+		if fileId, seen := fileIdsByPath[path]; seen {
+			merges = append(merges, fileIds{fileId, id})
+			continue
+		}
+
+		fileIdsByPath[path] = id
+		if cleanDirectory != directory {
+			cleanedDirectories[id] = cleanDirectory
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// the tables referencing files, with the columns that, together with the
+	// file ID, identify their rows
+	fileTables := []struct {
+		name       string
+		keyColumns []string
+	}{{"file_tag", []string{"tag_id", "value_id"}},
+		{"note", nil},
+		{"property", []string{"name"}},
+		{"file_identity", nil}}
+
+	for _, merge := range merges {
+		// rows the file already has are left with the duplicate and removed with it
+		for _, table := range fileTables {
+			sql := "UPDATE " + table.name + `
+SET file_id = ?
+WHERE file_id = ? AND NOT EXISTS (SELECT 1
+                                  FROM ` + table.name + ` existing
+                                  WHERE existing.file_id = ?`
+			for _, column := range table.keyColumns {
+				sql += " AND existing." + column + " = " + table.name + "." + column
+			}
+			sql += ")"
+
+			if _, err := tx.Exec(sql, merge.fileId, merge.duplicateId, merge.fileId); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("DELETE FROM "+table.name+" WHERE file_id = ?", merge.duplicateId); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM file WHERE id = ?", merge.duplicateId); err != nil {
+			return err
+		}
+	}
+
+	for id, directory := range cleanedDirectories {
+		if _, err := tx.Exec(`
+UPDATE file
+SET directory = ?
+WHERE id = ?`, directory, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func upgradeParentTagId(tx *sql.Tx, name string) (uint, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	var id uint
+	err := tx.QueryRow(`
+SELECT id
+FROM tag
+WHERE name = ?`, name).Scan(&id)
+	switch err {
+	case nil:
+		return id, nil
+	case sql.ErrNoRows:
+		// create below
+	default:
+		return 0, err
+	}
+
+	parentId, err := upgradeParentTagId(tx, entities.ParentTagName(name))
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+INSERT INTO tag (name, parent_id)
+VALUES (?, ?)`, name, parentId)
+	if err != nil {
+		return 0, err
+	}
+
+	newId, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(newId), nil
+}
+
+func columnExists(tx *sql.Tx, table, column string) bool {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		var name string
+		for index := range values {
+			values[index] = new(interface{})
+		}
+		values[1] = &name
+
+		if err := rows.Scan(values...); err != nil {
+			return false
+		}
+
+		if name == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tableExists(tx *sql.Tx, table string) bool {
+	var count uint
+	if err := tx.QueryRow(`
+SELECT count(1)
+FROM sqlite_master
+WHERE type = 'table' AND name = ?`, table).Scan(&count); err != nil {
+		return false
+	}
+
+	return count > 0
+}
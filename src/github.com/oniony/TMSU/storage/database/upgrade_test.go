@@ -0,0 +1,224 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/common"
+	"testing"
+)
+
+func TestLatestSchemaVersionIsThatOfLastMigration(test *testing.T) {
+	// validate
+
+	if last := migrations[len(migrations)-1].version; last != latestSchemaVersion {
+		test.Fatalf("Last migration has version %v but latest schema version is %v", last, latestSchemaVersion)
+	}
+
+	for index := 1; index < len(migrations); index++ {
+		if !migrations[index-1].version.LessThan(migrations[index].version) {
+			test.Fatalf("Migration %v is not ordered after %v", migrations[index].version, migrations[index-1].version)
+		}
+	}
+}
+
+func TestMigrateAppliesMigrationsUpToTarget(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DROP TABLE content_tag; DROP TABLE migration"); err != nil {
+		test.Fatal(err)
+	}
+	if err := updateSchemaVersion(tx, schemaVersion{common.Version{0, 8, 0}, 6}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	applied, err := migrate(tx, schemaVersion{common.Version{0, 8, 0}, 7})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(applied) != 1 || applied[0].description != "creating content tag table" {
+		test.Fatalf("Unexpected migrations applied: %v", applied)
+	}
+	if !tableExists(tx, "content_tag") || tableExists(tx, "migration") {
+		test.Fatalf("Unexpected tables after migration")
+	}
+	if version := currentSchemaVersion(tx); version != (schemaVersion{common.Version{0, 8, 0}, 7}) {
+		test.Fatalf("Unexpected schema version %v", version)
+	}
+
+	// test
+
+	applied, err = migrate(tx, latestSchemaVersion)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	// the migrations since the migration history table was created are recorded
+	pending := 0
+	for _, migration := range migrations {
+		if migration.version.GreaterThan(schemaVersion{common.Version{0, 8, 0}, 7}) {
+			pending++
+		}
+	}
+
+	if len(applied) != pending || applied[len(applied)-1].version != latestSchemaVersion {
+		test.Fatalf("Unexpected migrations applied: %v", applied)
+	}
+
+	history, err := migrationHistory(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, recorded := history[latestSchemaVersion]; len(history) != pending || !recorded {
+		test.Fatalf("Unexpected migration history: %v", history)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	newer := schemaVersion{common.Version{latestSchemaVersion.Major, latestSchemaVersion.Minor + 1, 0}, 0}
+	if err := updateSchemaVersion(tx, newer); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	_, err := migrate(tx, latestSchemaVersion)
+
+	// validate
+
+	if _, ok := err.(SchemaVersionError); !ok {
+		test.Fatalf("Expected schema version error but got: %v", err)
+	}
+	if version := currentSchemaVersion(tx); version != newer {
+		test.Fatalf("Schema version changed to %v", version)
+	}
+}
+
+func TestMigrateRefusesDowngrade(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	// test
+
+	_, err := migrate(tx, schemaVersion{common.Version{0, 8, 0}, 0})
+
+	// validate
+
+	if err == nil {
+		test.Fatalf("Expected downgrade to be refused")
+	}
+}
+
+func TestMergeDuplicateFiles(test *testing.T) {
+	// set-up
+
+	db, tx := createTestDatabase(test)
+	defer db.Close()
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+INSERT INTO file (id, directory, name, fingerprint, mod_time, size, is_dir)
+VALUES (1, 'photos', 'photo.jpg', '', '2018-01-01', 0, 0),
+       (2, './photos', 'photo.jpg', '', '2018-01-01', 0, 0),
+       (3, 'photos/../photos/', 'photo.jpg', '', '2018-01-01', 0, 0),
+       (4, './other', 'photo.jpg', '', '2018-01-01', 0, 0);
+INSERT INTO tag (id, name) VALUES (1, 'a'), (2, 'b');
+INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (1, 1, 0), (2, 1, 0), (3, 2, 0);
+INSERT INTO note (file_id, text) VALUES (2, 'hello')`); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := mergeDuplicateFiles(tx); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	rows, err := tx.Query("SELECT id, directory FROM file ORDER BY id")
+	if err != nil {
+		test.Fatal(err)
+	}
+	directories := make(map[uint]string)
+	for rows.Next() {
+		var id uint
+		var directory string
+		if err := rows.Scan(&id, &directory); err != nil {
+			test.Fatal(err)
+		}
+		directories[id] = directory
+	}
+	rows.Close()
+
+	if len(directories) != 2 || directories[1] != "photos" || directories[4] != "other" {
+		test.Fatalf("Unexpected files after merge: %v", directories)
+	}
+
+	var fileTagCount, noteCount uint
+	if err := tx.QueryRow("SELECT count(1) FROM file_tag WHERE file_id = 1").Scan(&fileTagCount); err != nil {
+		test.Fatal(err)
+	}
+	if err := tx.QueryRow("SELECT count(1) FROM note WHERE file_id = 1").Scan(&noteCount); err != nil {
+		test.Fatal(err)
+	}
+	if fileTagCount != 2 || noteCount != 1 {
+		test.Fatalf("Expected the tags and note of the duplicates to be merged but file has %v tags and %v notes", fileTagCount, noteCount)
+	}
+}
+
+// unexported
+
+func createTestDatabase(test *testing.T) (*sql.DB, *sql.Tx) {
+	db, err := openMemoryDatabase()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		test.Fatal(err)
+	}
+
+	if err := upgrade(tx); err != nil {
+		tx.Rollback()
+		db.Close()
+		test.Fatal(err)
+	}
+
+	return db, tx
+}
@@ -38,10 +38,15 @@ FROM value`
 
 // Retrieves the complete set of values.
 func Values(tx *Tx) (entities.Values, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
 SELECT id, name
 FROM value
-ORDER BY name`
+ORDER BY name` + nameCollation
 
 	rows, err := tx.Query(sql)
 	if err != nil {
@@ -176,13 +181,18 @@ COLLATE NOCASE`
 
 // Retrieves the set of values for the specified tag.
 func ValuesByTagId(tx *Tx, tagId entities.TagId) (entities.Values, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
 	sql := `
 SELECT id, name
 FROM value
 WHERE id IN (SELECT value_id
              FROM file_tag
              WHERE tag_id = ?1)
-ORDER BY name`
+ORDER BY name` + nameCollation
 
 	rows, err := tx.Query(sql, tagId)
 	if err != nil {
@@ -193,6 +203,48 @@ ORDER BY name`
 	return readValues(rows, make(entities.Values, 0, 10))
 }
 
+// Retrieves the names of the values, beginning with the specified prefix, that
+// are applied with the tag having the specified name or alias.
+func ValueNamesByTagName(tx *Tx, tagName, prefix string) ([]string, error) {
+	nameCollation, err := sortCollation(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+SELECT name
+FROM value
+WHERE id IN (SELECT value_id
+             FROM file_tag
+             WHERE tag_id IN (SELECT id FROM tag WHERE name = ?1
+                              UNION
+                              SELECT tag_id FROM alias WHERE name = ?1)) AND
+      substr(name, 1, length(?2)) = ?2
+ORDER BY name` + nameCollation
+
+	rows, err := tx.Query(sql, tagName, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]string, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
 // Adds a value.
 func InsertValue(tx *Tx, name string) (*entities.Value, error) {
 	sql := `
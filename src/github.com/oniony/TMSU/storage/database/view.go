@@ -0,0 +1,131 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"github.com/oniony/TMSU/entities"
+)
+
+// Retrieves the complete set of views.
+func Views(tx *Tx) (entities.Views, error) {
+	sql := `
+SELECT name, query
+FROM view
+ORDER BY name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readViews(rows, make(entities.Views, 0, 10))
+}
+
+// Retrieves a specific view.
+func ViewByName(tx *Tx, name string) (*entities.View, error) {
+	sql := `
+SELECT name, query
+FROM view
+WHERE name = ?`
+
+	rows, err := tx.Query(sql, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readView(rows)
+}
+
+// Adds a view.
+func InsertView(tx *Tx, name, queryText string) (*entities.View, error) {
+	sql := `
+INSERT INTO view (name, query)
+VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, name, queryText)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return &entities.View{name, queryText}, nil
+}
+
+// Deletes a view.
+func DeleteView(tx *Tx, name string) error {
+	sql := `
+DELETE FROM view
+WHERE name = ?`
+
+	result, err := tx.Exec(sql, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchViewError{name}
+	}
+
+	return nil
+}
+
+// unexported
+
+func readView(rows *sql.Rows) (*entities.View, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var view entities.View
+	if err := rows.Scan(&view.Name, &view.Query); err != nil {
+		return nil, err
+	}
+
+	return &view, nil
+}
+
+func readViews(rows *sql.Rows, views entities.Views) (entities.Views, error) {
+	for {
+		view, err := readView(rows)
+		if err != nil {
+			return nil, err
+		}
+		if view == nil {
+			break
+		}
+
+		views = append(views, view)
+	}
+
+	return views, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+	"golang.org/x/text/unicode/norm"
+	"path/filepath"
+)
+
+// Retrieves the file tags whose file or tag does not exist.
+func (storage *Storage) OrphanedFileTags(tx *Tx) (entities.FileTags, error) {
+	return database.OrphanedFileTags(tx.tx)
+}
+
+// Deletes the file tags whose file or tag does not exist.
+func (storage *Storage) DeleteOrphanedFileTags(tx *Tx) error {
+	return database.DeleteOrphanedFileTags(tx.tx)
+}
+
+// Retrieves the file tags whose value does not exist.
+func (storage *Storage) DanglingValueFileTags(tx *Tx) (entities.FileTags, error) {
+	return database.DanglingValueFileTags(tx.tx)
+}
+
+// Removes the values that do not exist from the file tags.
+func (storage *Storage) ClearDanglingValues(tx *Tx) error {
+	return database.ClearDanglingValues(tx.tx)
+}
+
+// Retrieves the number of content tags whose tag or value does not exist.
+func (storage *Storage) OrphanedContentTagCount(tx *Tx) (uint, error) {
+	return database.OrphanedContentTagCount(tx.tx)
+}
+
+// Deletes the content tags whose tag or value does not exist.
+func (storage *Storage) DeleteOrphanedContentTags(tx *Tx) error {
+	return database.DeleteOrphanedContentTags(tx.tx)
+}
+
+// Retrieves the sets of files whose paths differ only in the form in which
+// they are stored, e.g. relative or absolute, or in their Unicode
+// normalization, or, with the 'canonicalPaths' setting, in the linked
+// directories through which they were reached. Each set begins with the file
+// whose path is stored in the form that the settings now determine, if any,
+// the remainder being ordered by ID.
+func (storage *Storage) NormalizedDuplicateFiles(tx *Tx) ([]entities.Files, error) {
+	files, err := database.Files(tx.tx, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	form, err := storage.pathForm(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, 10)
+	filesByKey := make(map[string]entities.Files)
+	for _, file := range files {
+		storedPath := file.Path()
+		storage.absPath(file)
+
+		key := filepath.Clean(file.Path())
+		if form.canonical {
+			key = canonicalPath(key)
+		}
+		key = norm.NFC.String(key)
+		if _, seen := filesByKey[key]; !seen {
+			keys = append(keys, key)
+		}
+
+		if storedPath == filepath.Clean(storage.pathToStore(file.Path(), form)) {
+			filesByKey[key] = append(entities.Files{file}, filesByKey[key]...)
+		} else {
+			filesByKey[key] = append(filesByKey[key], file)
+		}
+	}
+
+	duplicates := make([]entities.Files, 0, 10)
+	for _, key := range keys {
+		if len(filesByKey[key]) > 1 {
+			duplicates = append(duplicates, filesByKey[key])
+		}
+	}
+
+	return duplicates, nil
+}
+
+// Merges the duplicate file into the file, moving its tags and note, and then
+// removes it.
+func (storage *Storage) MergeDuplicateFile(tx *Tx, fileId, duplicateId entities.FileId) error {
+	fileTags, err := storage.FileTagsByFileId(tx, duplicateId, true)
+	if err != nil {
+		return err
+	}
+
+	for _, fileTag := range fileTags {
+		exists, err := storage.FileTagExists(tx, fileId, fileTag.TagId, fileTag.ValueId, true)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := storage.AddFileTag(tx, fileId, fileTag.TagId, fileTag.ValueId); err != nil {
+			return err
+		}
+	}
+
+	note, err := storage.NoteByFileId(tx, duplicateId)
+	if err != nil {
+		return err
+	}
+	if note != nil {
+		existing, err := storage.NoteByFileId(tx, fileId)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			if _, err := storage.UpdateNote(tx, fileId, note.Text); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := database.DeleteFileTagsByFileId(tx.tx, duplicateId); err != nil {
+		return err
+	}
+
+	return storage.DeleteFile(tx, duplicateId)
+}
@@ -0,0 +1,58 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Determines whether the database at the path is encrypted.
+func IsEncrypted(path string) (bool, error) {
+	return database.IsEncrypted(path)
+}
+
+func CreateEncryptedAt(path, passphrase string) error {
+	return database.CreateEncryptedAt(path, passphrase)
+}
+
+func OpenEncryptedAt(path, passphrase string) (*Storage, error) {
+	db, err := database.OpenEncryptedAt(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	rootPath, err := determineRootPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
+
+	return &Storage{db, path, rootPath, nil, false, nil, nil, "", nil}, nil
+}
+
+func EncryptAt(path, passphrase string) error {
+	return database.EncryptAt(path, passphrase)
+}
+
+func DecryptAt(path, passphrase string) error {
+	return database.DecryptAt(path, passphrase)
+}
+
+func ChangePassphraseAt(path, passphrase, newPassphrase string) error {
+	return database.ChangePassphraseAt(path, passphrase, newPassphrase)
+}
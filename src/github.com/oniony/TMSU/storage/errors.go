@@ -38,3 +38,9 @@ type FileTagDoesNotExist struct {
 func (err FileTagDoesNotExist) Error() string {
 	return fmt.Sprintf("File-tag for file #%v, tag #%v and value #%v does not exist", err.FileId, err.TagId, err.ValueId)
 }
+
+type BatchRolledBackError struct{}
+
+func (err BatchRolledBackError) Error() string {
+	return "A transaction within the batch was rolled back"
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage/database"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -49,7 +50,10 @@ func (store *Storage) File(tx *Tx, id entities.FileId) (*entities.File, error) {
 
 // Retrieves the file with the specified path.
 func (store *Storage) FileByPath(tx *Tx, path string) (*entities.File, error) {
-	relPath := store.relPath(path)
+	relPath, err := store.storedPath(tx, path)
+	if err != nil {
+		return nil, err
+	}
 
 	file, err := database.FileByPath(tx.tx, relPath)
 	store.absPath(file)
@@ -57,9 +61,30 @@ func (store *Storage) FileByPath(tx *Tx, path string) (*entities.File, error) {
 	return file, err
 }
 
+// Retrieves the files with the specified paths. Paths not in the database are omitted.
+func (store *Storage) FilesByPaths(tx *Tx, paths []string) (entities.Files, error) {
+	form, err := store.pathForm(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	relPaths := make([]string, len(paths))
+	for index, path := range paths {
+		relPaths[index] = store.pathToStore(path, form)
+	}
+
+	files, err := database.FilesByPaths(tx.tx, relPaths)
+	store.absPaths(files)
+
+	return files, err
+}
+
 // Retrieves all files that are under the specified directory.
 func (store *Storage) FilesByDirectory(tx *Tx, path string) (entities.Files, error) {
-	relPath := store.relPath(path)
+	relPath, err := store.storedPath(tx, path)
+	if err != nil {
+		return nil, err
+	}
 	pathContainsRoot := store.pathContainsRoot(relPath)
 
 	files, err := database.FilesByDirectory(tx.tx, relPath, pathContainsRoot)
@@ -70,15 +95,20 @@ func (store *Storage) FilesByDirectory(tx *Tx, path string) (entities.Files, err
 
 // Retrieves all file that are under the specified directories.
 func (store *Storage) FilesByDirectories(tx *Tx, paths []string) (entities.Files, error) {
+	form, err := store.pathForm(tx)
+	if err != nil {
+		return nil, err
+	}
+
 	files := make(entities.Files, 0, 100)
 
 	for _, path := range paths {
-		relPath := store.relPath(path)
+		relPath := store.pathToStore(path, form)
 		pathContainsRoot := store.pathContainsRoot(relPath)
 
 		pathFiles, err := database.FilesByDirectory(tx.tx, relPath, pathContainsRoot)
 		if err != nil {
-			return nil, fmt.Errorf("'%v': could not retrieve files for directory: %v", path, err)
+			return nil, fmt.Errorf("'%v': could not retrieve files for directory: %w", path, err)
 		}
 
 		files = append(files, pathFiles...)
@@ -101,6 +131,21 @@ func (store *Storage) FilesByFingerprint(tx *Tx, fingerprint fingerprint.Fingerp
 	return files, err
 }
 
+// Retrieves the set of files, other than directories, with the specified size.
+func (store *Storage) FilesBySize(tx *Tx, size int64) (entities.Files, error) {
+	files, err := database.FilesBySize(tx.tx, size)
+	store.absPaths(files)
+	return files, err
+}
+
+// Retrieves the files, other than directories, that have no fingerprint but
+// share their size with another such file.
+func (store *Storage) UnfingerprintedFilesOfSharedSize(tx *Tx) (entities.Files, error) {
+	files, err := database.UnfingerprintedFilesOfSharedSize(tx.tx)
+	store.absPaths(files)
+	return files, err
+}
+
 // Retrieves the set of untagged files.
 func (store *Storage) UntaggedFiles(tx *Tx) (entities.Files, error) {
 	files, err := database.UntaggedFiles(tx.tx)
@@ -108,26 +153,144 @@ func (store *Storage) UntaggedFiles(tx *Tx) (entities.Files, error) {
 	return files, err
 }
 
-// Retrieves the count of files that match the specified query and matching the specified path.
-func (store *Storage) FileCountForQuery(tx *Tx, expression query.Expression, path string, explicitOnly, ignoreCase bool) (uint, error) {
-	relPath := store.relPath(path)
+// Opens a cursor over the untagged files, in the manner of FileCursorForQuery.
+func (store *Storage) UntaggedFileCursor(tx *Tx) (*FileCursor, error) {
+	cursor, err := database.UntaggedFileCursor(tx.tx)
+	if err != nil {
+		return nil, err
+	}
 
-	pathContainsRoot := store.pathContainsRoot(relPath)
+	return &FileCursor{store, cursor}, nil
+}
 
-	return database.FileCountForQuery(tx.tx, expression, relPath, pathContainsRoot, explicitOnly, ignoreCase)
+// Retrieves the count of files that match the specified query and lie at or beneath any of the specified paths.
+func (store *Storage) FileCountForQuery(tx *Tx, expression query.Expression, paths []string, notes string, explicitOnly, ignoreCase bool) (uint, error) {
+	relPaths, pathContainsRoot, err := store.storedQueryPaths(tx, paths)
+	if err != nil {
+		return 0, err
+	}
+
+	expression, err = store.resolveQuery(tx, expression, ignoreCase)
+	if err != nil {
+		return 0, err
+	}
+
+	return database.FileCountForQuery(tx.tx, expression, relPaths, notes, pathContainsRoot, explicitOnly, ignoreCase)
 }
 
-// Retrieves the set of files that match the specified query.
-func (store *Storage) FilesForQuery(tx *Tx, expression query.Expression, path string, explicitOnly, ignoreCase bool, sort string) (entities.Files, error) {
-	relPath := store.relPath(path)
+// Retrieves the set of files that match the specified query and lie at or beneath any of the specified paths,
+// optionally limited to those with notes containing the specified text.
+// At most limit files are retrieved, in the specified order, unless limit is zero.
+func (store *Storage) FilesForQuery(tx *Tx, expression query.Expression, paths []string, notes string, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint) (entities.Files, error) {
+	relPaths, pathContainsRoot, err := store.storedQueryPaths(tx, paths)
+	if err != nil {
+		return nil, err
+	}
 
-	pathContainsRoot := store.pathContainsRoot(relPath)
+	expression, err = store.resolveQuery(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := database.FilesForQuery(tx.tx, expression, relPaths, notes, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit)
+	store.absPaths(files)
+	return files, err
+}
+
+// Retrieves the files that result from combining, with the specified set operation, the files that match each of the
+// specified queries and lie at or beneath any of the specified paths.
+func (store *Storage) FilesForQueries(tx *Tx, first, second query.Expression, operation database.SetOperation, paths []string, explicitOnly, ignoreCase bool, sort string) (entities.Files, error) {
+	relPaths, pathContainsRoot, err := store.storedQueryPaths(tx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err = store.resolveQuery(tx, first, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	second, err = store.resolveQuery(tx, second, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
 
-	files, err := database.FilesForQuery(tx.tx, expression, relPath, pathContainsRoot, explicitOnly, ignoreCase, sort)
+	files, err := database.FilesForQueries(tx.tx, first, second, operation, relPaths, pathContainsRoot, explicitOnly, ignoreCase, sort)
 	store.absPaths(files)
 	return files, err
 }
 
+// A cursor over the files that match a query, which are read a page at a time
+// rather than all at once.
+type FileCursor struct {
+	store  *Storage
+	cursor *database.FileCursor
+}
+
+// Opens a cursor over the files that match the specified query, in the manner of FilesForQuery, so that huge
+// results may be processed without retrieving them all at once.
+func (store *Storage) FileCursorForQuery(tx *Tx, expression query.Expression, paths []string, notes string, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint) (*FileCursor, error) {
+	relPaths, pathContainsRoot, err := store.storedQueryPaths(tx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.resolveQuery(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := database.FileCursorForQuery(tx.tx, expression, relPaths, notes, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCursor{store, cursor}, nil
+}
+
+// Retrieves up to count further files, or none once every file has been read.
+func (cursor *FileCursor) Next(count int) (entities.Files, error) {
+	files, err := cursor.cursor.Next(count)
+	cursor.store.absPaths(files)
+	return files, err
+}
+
+func (cursor *FileCursor) Close() error {
+	return cursor.cursor.Close()
+}
+
+// Retrieves the SQL by which the files that match the specified query are retrieved, together with SQLite's plan
+// for running it.
+func (store *Storage) ExplainFilesForQuery(tx *Tx, expression query.Expression, paths []string, notes string, explicitOnly, ignoreCase bool, sort string, reverse bool, limit uint) (*entities.QueryPlan, error) {
+	relPaths, pathContainsRoot, err := store.storedQueryPaths(tx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.resolveQuery(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.ExplainFilesForQuery(tx.tx, expression, relPaths, notes, pathContainsRoot, explicitOnly, ignoreCase, sort, reverse, limit)
+}
+
+// Retrieves the number of files that match the specified query, and lie at or beneath any of the specified paths,
+// to which each value of the specified tag is applied.
+func (store *Storage) FileCountsByValueForQuery(tx *Tx, expression query.Expression, paths []string, notes string, explicitOnly, ignoreCase bool, tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	relPaths, pathContainsRoot, err := store.storedQueryPaths(tx, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.resolveQuery(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.FileCountsByValueForQuery(tx.tx, expression, relPaths, notes, pathContainsRoot, explicitOnly, ignoreCase, tagId)
+}
+
 // Retrieves the sets of duplicate files within the database.
 func (store *Storage) DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 	fileSets, err := database.DuplicateFiles(tx.tx)
@@ -139,27 +302,78 @@ func (store *Storage) DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 	return fileSets, err
 }
 
-// Adds a file to the database.
-func (store *Storage) AddFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
-	relPath := store.relPath(path)
-	file, err := database.InsertFile(tx.tx, relPath, fingerprint, modTime, size, isDir)
+// Adds a file to the database. When tagging by content the file is given the tags of its content.
+func (store *Storage) AddFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, mimeType string) (*entities.File, error) {
+	relPath, err := store.storedPath(tx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := database.InsertFile(tx.tx, relPath, fingerprint, modTime, size, isDir, mimeType)
+	if err != nil {
+		return nil, err
+	}
 	store.absPath(file)
 
-	return file, err
+	if err := store.recordFileIdentity(tx, file); err != nil {
+		return nil, err
+	}
+
+	// a copy of content already in the database takes on its tags
+	if err := store.applyContentTags(tx, file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
 }
 
 // Updates a file in the database.
-func (store *Storage) UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
-	relPath := store.relPath(path)
-	file, err := database.UpdateFile(tx.tx, fileId, relPath, fingerprint, modTime, size, isDir)
+func (store *Storage) UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool, mimeType string) (*entities.File, error) {
+	if err := store.recordFileChange(tx, FileUpdated, fileId, path); err != nil {
+		return nil, err
+	}
+
+	if err := store.noteSidecars(tx, fileId); err != nil {
+		return nil, err
+	}
+
+	if err := store.noteSidecarPath(tx, path); err != nil {
+		return nil, err
+	}
+
+	relPath, err := store.storedPath(tx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := database.UpdateFile(tx.tx, fileId, relPath, fingerprint, modTime, size, isDir, mimeType)
+	if err != nil {
+		return nil, err
+	}
 	store.absPath(file)
 
-	return file, err
+	if err := store.recordFileIdentity(tx, file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
 }
 
 // Deletes a file from the database.
 func (store *Storage) DeleteFile(tx *Tx, fileId entities.FileId) error {
-	return database.DeleteFile(tx.tx, fileId)
+	if err := store.recordFileChange(tx, FileDeleted, fileId, ""); err != nil {
+		return err
+	}
+
+	if err := store.noteSidecars(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := database.DeleteFile(tx.tx, fileId); err != nil {
+		return err
+	}
+
+	return store.deleteOrphanedAttachments(tx)
 }
 
 // Deletes a file if it is untagged
@@ -179,17 +393,193 @@ func (store *Storage) DeleteFileIfUntagged(tx *Tx, fileId entities.FileId) error
 
 // Deletes the specified files if they are untagged
 func (store *Storage) DeleteUntaggedFiles(tx *Tx, fileIds entities.FileIds) error {
-	return database.DeleteUntaggedFiles(tx.tx, fileIds)
+	if err := database.DeleteUntaggedFiles(tx.tx, fileIds); err != nil {
+		return err
+	}
+
+	return store.deleteOrphanedAttachments(tx)
+}
+
+// A change to the form in which a file's path is stored.
+type PathConversion struct {
+	File    *entities.File
+	OldPath string
+	NewPath string
+}
+
+// Converts the stored paths of the files, so that those beneath the root path
+// are stored relative to it or so that all are stored absolute, and updates the
+// 'relativePaths' setting to match. The conversions made are returned.
+func (store *Storage) ConvertPaths(tx *Tx, relative bool) ([]PathConversion, error) {
+	files, err := database.Files(tx.tx, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	form, err := store.pathForm(tx)
+	if err != nil {
+		return nil, err
+	}
+	form.relative = relative
+
+	conversions := make([]PathConversion, 0, len(files))
+	for _, file := range files {
+		oldPath := file.Path()
+		if !filepath.IsAbs(oldPath) && oldPath != ".." && !strings.HasPrefix(oldPath, ".."+string(filepath.Separator)) {
+			// as stored, less the leading './' that joining strips
+			oldPath = "." + string(filepath.Separator) + oldPath
+		}
+		store.absPath(file)
+
+		newPath := store.pathToStore(file.Path(), form)
+		if filepath.Dir(newPath) == filepath.Dir(oldPath) {
+			continue
+		}
+
+		if _, err := database.UpdateFile(tx.tx, file.Id, newPath, file.Fingerprint, file.ModTime, file.Size, file.IsDir, file.MimeType); err != nil {
+			if database.IsConstraintViolation(err) {
+				return nil, fmt.Errorf("%v: cannot store as '%v' as another entry already is", file.Path(), newPath)
+			}
+
+			return nil, err
+		}
+
+		conversions = append(conversions, PathConversion{file, oldPath, newPath})
+	}
+
+	value := "no"
+	if relative {
+		value = "yes"
+	}
+
+	if _, err := store.UpdateSetting(tx, "relativePaths", value); err != nil {
+		return nil, err
+	}
+
+	return conversions, nil
 }
 
 // unexported
 
-func (store *Storage) relPath(path string) string {
+// resolves the aliases, tag names, tag prefixes and value types of the query
+func (store *Storage) resolveQuery(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	expression, err := store.ExpandViews(tx, expression)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.ResolveAliases(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.ResolveTagNames(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = store.ExpandTagPrefixes(tx, expression, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ResolveValueTypes(tx, expression, ignoreCase)
+}
+
+// the form in which paths are stored
+type pathForm struct {
+	relative  bool // paths beneath the root path are stored relative to it
+	canonical bool // directories are resolved through symbolic links
+}
+
+// the form in which paths are stored, as determined by the 'relativePaths'
+// and 'canonicalPaths' settings
+func (store *Storage) pathForm(tx *Tx) (pathForm, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return pathForm{}, err
+	}
+
+	return pathForm{settings.RelativePaths(), settings.CanonicalPaths()}, nil
+}
+
+// the form in which the path is stored, as determined by the 'relativePaths'
+// and 'canonicalPaths' settings
+func (store *Storage) storedPath(tx *Tx, path string) (string, error) {
+	if path == "" {
+		return "", nil // don't alter empty paths
+	}
+
+	form, err := store.pathForm(tx)
+	if err != nil {
+		return "", err
+	}
+
+	return store.pathToStore(path, form), nil
+}
+
+// the paths by which a query is scoped, as stored, and whether any of them contains the root path
+func (store *Storage) storedQueryPaths(tx *Tx, paths []string) ([]string, bool, error) {
+	relPaths := make([]string, 0, len(paths))
+	pathContainsRoot := false
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		relPath, err := store.storedPath(tx, path)
+		if err != nil {
+			return nil, false, err
+		}
+
+		relPaths = append(relPaths, relPath)
+		pathContainsRoot = pathContainsRoot || store.pathContainsRoot(relPath)
+	}
+
+	return relPaths, pathContainsRoot, nil
+}
+
+// the path as stored: cleaned, so that './photo.jpg' and 'photo.jpg' are the
+// same entry, and resolved through linked directories if canonical
+func (store *Storage) pathToStore(path string, form pathForm) string {
 	if path == "" {
 		return "" // don't alter empty paths
 	}
 
-	return _path.RelTo(path, store.RootPath)
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		panic("could not get absolute path")
+	}
+
+	rootPath := store.RootPath
+	if form.canonical {
+		absPath = canonicalPath(absPath)
+		rootPath = canonicalPath(rootPath)
+	}
+
+	if !form.relative {
+		return absPath
+	}
+
+	return _path.RelTo(absPath, rootPath)
+}
+
+// resolves the symbolic links in the directory of the path, but not the final
+// element, so that a symbolic link is still stored as itself. The path is
+// returned unresolved if its directory does not exist.
+func canonicalPath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	directory, err := filepath.EvalSymlinks(filepath.Dir(absPath))
+	if err != nil {
+		return absPath
+	}
+
+	return filepath.Join(directory, filepath.Base(absPath))
 }
 
 func (store *Storage) absPaths(files entities.Files) {
@@ -199,7 +589,7 @@ func (store *Storage) absPaths(files entities.Files) {
 }
 
 func (store *Storage) absPath(file *entities.File) {
-	if file == nil || file.Directory == "" || file.Directory[0] == filepath.Separator {
+	if file == nil || file.Directory == "" || filepath.IsAbs(file.Directory) {
 		return
 	}
 
@@ -219,7 +609,7 @@ func (store *Storage) pathContainsRoot(path string) bool {
 		if checkPath == path {
 			return true
 		}
-		if checkPath == string(filepath.Separator) && file == "" {
+		if _path.IsRoot(checkPath) && file == "" {
 			return false
 		}
 
@@ -227,3 +617,16 @@ func (store *Storage) pathContainsRoot(path string) bool {
 		checkPath = filepath.Clean(checkPath)
 	}
 }
+
+// removes the notes and properties of the files no longer in the database
+func (store *Storage) deleteOrphanedAttachments(tx *Tx) error {
+	if err := database.DeleteOrphanedNotes(tx.tx); err != nil {
+		return err
+	}
+
+	if err := database.DeleteOrphanedFileIdentities(tx.tx); err != nil {
+		return err
+	}
+
+	return database.DeleteOrphanedProperties(tx.tx)
+}
@@ -0,0 +1,80 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+	"os"
+)
+
+// Retrieves the identity recorded for the specified file, or nil if there is none.
+func (store *Storage) FileIdentity(tx *Tx, fileId entities.FileId) (*entities.FileIdentity, error) {
+	return database.FileIdentityByFileId(tx.tx, fileId)
+}
+
+// The identity of the file on the file system described by the file info, or
+// nil if the platform does not provide one.
+func FileIdentityOf(stat os.FileInfo) *entities.FileIdentity {
+	device, inode, ok := fileIdentity(stat)
+	if !ok {
+		return nil
+	}
+
+	return &entities.FileIdentity{0, device, inode}
+}
+
+// unexported
+
+// determines whether the identities of files are recorded, as loaded from the
+// settings when first needed
+func (tx *Tx) trackingInodes() (bool, error) {
+	if tx.trackInodes == "" {
+		settings, err := tx.storage.Settings(tx)
+		if err != nil {
+			return false, err
+		}
+
+		tx.trackInodes = "no"
+		if settings.TrackInodes() {
+			tx.trackInodes = "yes"
+		}
+	}
+
+	return tx.trackInodes == "yes", nil
+}
+
+// records the identity of the file as it is now on the file system, if the
+// identities of files are being tracked
+func (store *Storage) recordFileIdentity(tx *Tx, file *entities.File) error {
+	tracking, err := tx.trackingInodes()
+	if err != nil || !tracking {
+		return err
+	}
+
+	stat, err := os.Stat(file.Path())
+	if err != nil {
+		return database.DeleteFileIdentity(tx.tx, file.Id)
+	}
+
+	identity := FileIdentityOf(stat)
+	if identity == nil {
+		return database.DeleteFileIdentity(tx.tx, file.Id)
+	}
+	identity.FileId = file.Id
+
+	return database.UpdateFileIdentity(tx.tx, *identity)
+}
@@ -16,8 +16,10 @@
 package storage
 
 import (
+	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage/database"
+	"time"
 )
 
 // Determines whether the specified file has the specified tag applied.
@@ -76,6 +78,11 @@ func (storage *Storage) FileTagCountByTagId(tx *Tx, tagId entities.TagId, explic
 	return uint(len(fileTags)), err
 }
 
+// Retrieves the number of files explicitly tagged with the specified tag.
+func (storage *Storage) FileCountByTagId(tx *Tx, tagId entities.TagId) (uint, error) {
+	return database.FileCountByTagId(tx.tx, tagId)
+}
+
 // Retrieves the file tags with the specified tag ID.
 func (storage *Storage) FileTagsByTagId(tx *Tx, tagId entities.TagId, explicitOnly bool) (entities.FileTags, error) {
 	fileTags, err := database.FileTagsByTagId(tx.tx, tagId)
@@ -99,6 +106,11 @@ func (storage *Storage) FileTagCountByValueId(tx *Tx, valueId entities.ValueId)
 	return database.FileTagCountByValueId(tx.tx, valueId)
 }
 
+// Retrieves the number of files tagged with the specified value.
+func (storage *Storage) FileCountByValueId(tx *Tx, valueId entities.ValueId) (uint, error) {
+	return database.FileCountByValueId(tx.tx, valueId)
+}
+
 // Retrieves the file tags with the specified value ID.
 func (storage *Storage) FileTagsByValueId(tx *Tx, valueId entities.ValueId) (entities.FileTags, error) {
 	return database.FileTagsByValueId(tx.tx, valueId)
@@ -113,6 +125,11 @@ func (storage *Storage) FileTagsByFileId(tx *Tx, fileId entities.FileId, explici
 
 	if !explicitOnly {
 		var err error
+		fileTags, err = storage.addAttributeImpliedFileTags(tx, fileId, fileTags)
+		if err != nil {
+			return nil, err
+		}
+
 		fileTags, err = storage.addImpliedFileTags(tx, fileTags)
 		if err != nil {
 			return nil, err
@@ -122,34 +139,111 @@ func (storage *Storage) FileTagsByFileId(tx *Tx, fileId entities.FileId, explici
 	return fileTags, nil
 }
 
-// Adds a file tag.
+// Retrieves the tag/value pairs applied to every one of the specified files.
+func (storage *Storage) SharedTagIdValueIdPairs(tx *Tx, fileIds entities.FileIds, explicitOnly bool) (entities.TagIdValueIdPairs, error) {
+	var shared entities.TagIdValueIdPairs
+
+	for index, fileId := range fileIds {
+		fileTags, err := storage.FileTagsByFileId(tx, fileId, explicitOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs := fileTags.ToTagIdValueIdPairs()
+		if index == 0 {
+			shared = pairs
+		} else {
+			shared = shared.Intersection(pairs)
+		}
+	}
+
+	return shared, nil
+}
+
+// Adds a file tag. When tagging by content the tag is also applied to the
+// file's content and so to the other files with the same content.
 func (storage *Storage) AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
-	return database.AddFileTag(tx.tx, fileId, tagId, valueId)
+	fingerprint, copies, err := storage.contentCopies(tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := time.Now()
+
+	fileTag, err := storage.addFileTag(tx, fileId, tagId, valueId, applied, storage.user)
+	if err != nil || fingerprint == "" {
+		return fileTag, err
+	}
+
+	if err := storage.removeGroupedContentTags(tx, fingerprint, tagId); err != nil {
+		return nil, err
+	}
+
+	if err := database.AddContentTag(tx.tx, fingerprint, tagId, valueId); err != nil {
+		return nil, err
+	}
+
+	for _, other := range copies {
+		if _, err := storage.addFileTag(tx, other.Id, tagId, valueId, applied, storage.user); err != nil {
+			return nil, err
+		}
+	}
+
+	return fileTag, nil
+}
+
+// Adds a file tag as applied at the specified time by the specified user, as
+// when copied from another database, rather than now by the current user.
+func (storage *Storage) AddFileTagAsApplied(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, applied time.Time, appliedBy string) (*entities.FileTag, error) {
+	return storage.addFileTag(tx, fileId, tagId, valueId, applied, appliedBy)
 }
 
-// Delete file tag.
+// Delete file tag. When tagging by content the tag is also removed from the
+// file's content and so from the other files with the same content.
 func (storage *Storage) DeleteFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
-	exists, err := storage.FileTagExists(tx, fileId, tagId, valueId, true)
+	fingerprint, copies, err := storage.contentCopies(tx, fileId)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return FileTagDoesNotExist{fileId, tagId, valueId}
-	}
 
-	if err := database.DeleteFileTag(tx.tx, fileId, tagId, valueId); err != nil {
+	if err := storage.deleteFileTag(tx, fileId, tagId, valueId); err != nil || fingerprint == "" {
 		return err
 	}
 
-	if err := storage.DeleteFileIfUntagged(tx, fileId); err != nil {
+	if err := database.DeleteContentTag(tx.tx, fingerprint, tagId, valueId); err != nil {
 		return err
 	}
 
+	for _, other := range copies {
+		if err := storage.deleteFileTag(tx, other.Id, tagId, valueId); err != nil {
+			if _, ok := err.(FileTagDoesNotExist); !ok {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
 // Deletes all of the file tags for the specified file.
 func (storage *Storage) DeleteFileTagsByFileId(tx *Tx, fileId entities.FileId) error {
+	if err := storage.noteSidecars(tx, fileId); err != nil {
+		return err
+	}
+
+	if storage.tracking {
+		fileTags, err := database.FileTagsByFileId(tx.tx, fileId)
+		if err != nil {
+			return err
+		}
+
+		for _, fileTag := range fileTags {
+			if err := storage.recordFileTagChange(tx, FileUntagged, fileId, fileTag.TagId, fileTag.ValueId); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err := database.DeleteFileTagsByFileId(tx.tx, fileId); err != nil {
 		return err
 	}
@@ -168,10 +262,18 @@ func (storage *Storage) DeleteFileTagsByTagId(tx *Tx, tagId entities.TagId) erro
 		return err
 	}
 
+	if err := storage.noteSidecars(tx, fileTags.FileIds()...); err != nil {
+		return err
+	}
+
 	if err := database.DeleteFileTagsByTagId(tx.tx, tagId); err != nil {
 		return err
 	}
 
+	if err := database.DeleteContentTagsByTagId(tx.tx, tagId); err != nil {
+		return err
+	}
+
 	if err := storage.DeleteUntaggedFiles(tx, fileTags.FileIds()); err != nil {
 		return err
 	}
@@ -186,10 +288,18 @@ func (storage *Storage) DeleteFileTagsByValueId(tx *Tx, valueId entities.ValueId
 		return err
 	}
 
+	if err := storage.noteSidecars(tx, fileTags.FileIds()...); err != nil {
+		return err
+	}
+
 	if err := database.DeleteFileTagsByValueId(tx.tx, valueId); err != nil {
 		return err
 	}
 
+	if err := database.DeleteContentTagsByValueId(tx.tx, valueId); err != nil {
+		return err
+	}
+
 	if err := storage.DeleteUntaggedFiles(tx, fileTags.FileIds()); err != nil {
 		return err
 	}
@@ -199,11 +309,144 @@ func (storage *Storage) DeleteFileTagsByValueId(tx *Tx, valueId entities.ValueId
 
 // Copies file tags from one tag to another.
 func (storage *Storage) CopyFileTags(tx *Tx, sourceTagId, destTagId entities.TagId) error {
-	return database.CopyFileTags(tx.tx, sourceTagId, destTagId)
+	fileTags, err := database.FileTagsByTagId(tx.tx, sourceTagId)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.noteSidecars(tx, fileTags.FileIds()...); err != nil {
+		return err
+	}
+
+	if err := database.CopyFileTags(tx.tx, sourceTagId, destTagId); err != nil {
+		return err
+	}
+
+	return database.CopyContentTags(tx.tx, sourceTagId, destTagId)
+}
+
+// Replaces a value of a tag with another value on each of the files tagged with it.
+func (storage *Storage) ReplaceFileTagValue(tx *Tx, tagId entities.TagId, valueId, newValueId entities.ValueId) error {
+	fileTags, err := database.FileTagsByTagId(tx.tx, tagId)
+	if err != nil {
+		return err
+	}
+
+	for _, fileTag := range fileTags {
+		if fileTag.ValueId != valueId {
+			continue
+		}
+
+		if err := storage.noteSidecars(tx, fileTag.FileId); err != nil {
+			return err
+		}
+
+		if _, err := database.AddFileTag(tx.tx, fileTag.FileId, tagId, newValueId, fileTag.Applied, fileTag.AppliedBy); err != nil {
+			return err
+		}
+
+		if err := database.DeleteFileTag(tx.tx, fileTag.FileId, tagId, valueId); err != nil {
+			return err
+		}
+	}
+
+	return database.ReplaceContentTagValue(tx.tx, tagId, valueId, newValueId)
 }
 
 // unexported
 
+func (storage *Storage) addFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, applied time.Time, appliedBy string) (*entities.FileTag, error) {
+	if err := storage.noteSidecars(tx, fileId); err != nil {
+		return nil, err
+	}
+
+	if err := storage.removeGroupedFileTags(tx, fileId, tagId); err != nil {
+		return nil, err
+	}
+
+	if !storage.tracking {
+		return database.AddFileTag(tx.tx, fileId, tagId, valueId, applied, appliedBy)
+	}
+
+	exists, err := database.FileTagExists(tx.tx, fileId, tagId, valueId)
+	if err != nil {
+		return nil, err
+	}
+
+	fileTag, err := database.AddFileTag(tx.tx, fileId, tagId, valueId, applied, appliedBy)
+	if err != nil || exists {
+		return fileTag, err
+	}
+
+	return fileTag, storage.recordFileTagChange(tx, FileTagged, fileId, tagId, valueId)
+}
+
+func (storage *Storage) deleteFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	exists, err := storage.FileTagExists(tx, fileId, tagId, valueId, true)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return FileTagDoesNotExist{fileId, tagId, valueId}
+	}
+
+	if err := storage.noteSidecars(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := storage.recordFileTagChange(tx, FileUntagged, fileId, tagId, valueId); err != nil {
+		return err
+	}
+
+	if err := database.DeleteFileTag(tx.tx, fileId, tagId, valueId); err != nil {
+		return err
+	}
+
+	if err := storage.DeleteFileIfUntagged(tx, fileId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// adds the tags implied by the implications whose conditions the file's
+// attributes satisfy, so that their own implications are added in turn
+func (storage *Storage) addAttributeImpliedFileTags(tx *Tx, fileId entities.FileId, fileTags entities.FileTags) (entities.FileTags, error) {
+	implications, err := storage.attributeImplications(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(implications) == 0 {
+		return fileTags, nil
+	}
+
+	file, err := database.File(tx.tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return fileTags, nil
+	}
+
+	for _, implication := range implications {
+		if !entities.AttributeMatches(*file, implication.ImplyingTag.Name, implication.ImplyingValue.Name) {
+			continue
+		}
+
+		predicate := func(ft entities.FileTag) bool {
+			return ft.TagId == implication.ImpliedTag.Id && ft.ValueId == implication.ImpliedValue.Id
+		}
+
+		if impliedFileTag := fileTags.Where(predicate).Single(); impliedFileTag != nil {
+			impliedFileTag.Implicit = true
+		} else {
+			fileTags = append(fileTags, &entities.FileTag{fileId, implication.ImpliedTag.Id, implication.ImpliedValue.Id, false, true, time.Time{}, ""})
+		}
+	}
+
+	return fileTags, nil
+}
+
 func (storage *Storage) addImpliedFileTags(tx *Tx, fileTags entities.FileTags) (entities.FileTags, error) {
 	// WARN: this cannot use 'range' as fileTags is expanded within the loop
 	for index := 0; index < len(fileTags); index++ {
@@ -226,7 +469,7 @@ func (storage *Storage) addImpliedFileTags(tx *Tx, fileTags entities.FileTags) (
 			if impliedFileTag != nil {
 				impliedFileTag.Implicit = true
 			} else {
-				impliedFileTag := entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, implication.ImpliedValue.Id, false, true}
+				impliedFileTag := entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, implication.ImpliedValue.Id, false, true, time.Time{}, ""}
 
 				fileTags = append(fileTags, &impliedFileTag)
 			}
@@ -235,3 +478,72 @@ func (storage *Storage) addImpliedFileTags(tx *Tx, fileTags entities.FileTags) (
 
 	return fileTags, nil
 }
+
+// the fingerprint of a file together with the other files that share its
+// content, or an empty fingerprint where files are not tagged by content
+func (storage *Storage) contentCopies(tx *Tx, fileId entities.FileId) (fingerprint.Fingerprint, entities.Files, error) {
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return "", nil, err
+	}
+	if !settings.TagByContent() {
+		return "", nil, nil
+	}
+
+	file, err := database.File(tx.tx, fileId)
+	if err != nil {
+		return "", nil, err
+	}
+	if file == nil || file.Fingerprint == "" {
+		return "", nil, nil
+	}
+
+	files, err := database.FilesByFingerprint(tx.tx, file.Fingerprint)
+	if err != nil {
+		return "", nil, err
+	}
+
+	copies := make(entities.Files, 0, len(files))
+	for _, other := range files {
+		if other.Id != fileId {
+			copies = append(copies, other)
+		}
+	}
+
+	return file.Fingerprint, copies, nil
+}
+
+// applies to a newly added file the tags of its content: those recorded
+// against the content and those applied explicitly to other files sharing it
+func (storage *Storage) applyContentTags(tx *Tx, file *entities.File) error {
+	fingerprint, copies, err := storage.contentCopies(tx, file.Id)
+	if err != nil || fingerprint == "" {
+		return err
+	}
+
+	pairs, err := database.ContentTags(tx.tx, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range copies {
+		fileTags, err := database.FileTagsByFileId(tx.tx, other.Id)
+		if err != nil {
+			return err
+		}
+
+		pairs = append(pairs, fileTags.ToTagIdValueIdPairs()...)
+	}
+
+	for _, pair := range pairs {
+		if err := database.AddContentTag(tx.tx, fingerprint, pair.TagId, pair.ValueId); err != nil {
+			return err
+		}
+
+		if _, err := storage.addFileTag(tx, file.Id, pair.TagId, pair.ValueId, time.Now(), storage.user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage/database"
+	"strings"
 )
 
 // Retrieves the complete set of tag implications.
@@ -76,17 +77,36 @@ func (storage *Storage) ImplicationsImplying(tx *Tx, pairs ...entities.TagIdValu
 	return resultantImplications, nil
 }
 
+// Retrieves the implications conditional upon a built-in tag, such as
+// 'ext=raw -> photo', whose condition the file's attributes satisfy.
+func (storage *Storage) AttributeImplicationsFor(tx *Tx, file *entities.File) (entities.Implications, error) {
+	implications, err := storage.attributeImplications(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := func(implication entities.Implication) bool {
+		return entities.AttributeMatches(*file, implication.ImplyingTag.Name, implication.ImplyingValue.Name)
+	}
+
+	return implications.Where(predicate), nil
+}
+
 // Adds the specified implication.
 func (storage Storage) AddImplication(tx *Tx, pair, impliedPair entities.TagIdValueIdPair) error {
-	implications, err := storage.ImplicationsFor(tx, impliedPair)
+	cycle, err := storage.implicationCycle(tx, pair, impliedPair)
 	if err != nil {
 		return err
 	}
-
-	for _, implication := range implications {
-		if implication.ImpliedTag.Id == pair.TagId && (pair.ValueId == 0 || implication.ImpliedValue.Id == pair.ValueId) {
-			return fmt.Errorf("implication would create a cycle")
+	if cycle != nil {
+		names := make([]string, len(cycle))
+		for index, cyclePair := range cycle {
+			if names[index], err = storage.tagValuePairName(tx, cyclePair); err != nil {
+				return err
+			}
 		}
+
+		return fmt.Errorf("implication would create a cycle: %v", strings.Join(names, " -> "))
 	}
 
 	return database.AddImplication(tx.tx, pair, impliedPair)
@@ -106,3 +126,100 @@ func (storage Storage) DeleteImplicationsByTagId(tx *Tx, tagId entities.TagId) e
 func (storage Storage) DeleteImplicationsByValueId(tx *Tx, valueId entities.ValueId) error {
 	return database.DeleteImplicationsByValueId(tx.tx, valueId)
 }
+
+// unexported
+
+// Identifies the chain of implications, beginning with the proposed
+// implication, that would lead back to the implying tag (and value).
+func (storage *Storage) attributeImplications(tx *Tx) (entities.Implications, error) {
+	implications, err := database.Implications(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := func(implication entities.Implication) bool {
+		return implication.ImplyingValue.Id != 0 && entities.IsBuiltInTagName(implication.ImplyingTag.Name)
+	}
+
+	return implications.Where(predicate), nil
+}
+
+func (storage Storage) implicationCycle(tx *Tx, pair, impliedPair entities.TagIdValueIdPair) ([]entities.TagIdValueIdPair, error) {
+	// implications of a tag without a value apply whatever the value
+	completesCycle := func(candidate entities.TagIdValueIdPair) bool {
+		return candidate.TagId == pair.TagId && (pair.ValueId == 0 || candidate.ValueId == pair.ValueId)
+	}
+
+	parents := map[entities.TagIdValueIdPair]entities.TagIdValueIdPair{impliedPair: pair}
+	pending := entities.TagIdValueIdPairs{impliedPair}
+
+	for len(pending) > 0 {
+		for _, candidate := range pending {
+			if completesCycle(candidate) {
+				cycle := []entities.TagIdValueIdPair{candidate}
+				for {
+					candidate = parents[candidate]
+					cycle = append([]entities.TagIdValueIdPair{candidate}, cycle...)
+
+					if candidate == pair {
+						break
+					}
+				}
+
+				return cycle, nil
+			}
+		}
+
+		implications, err := database.ImplicationsFor(tx.tx, pending)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make(entities.TagIdValueIdPairs, 0, len(implications))
+		for _, implication := range implications {
+			implyingPair := implication.ImplyingTagValuePair()
+			impliedPair := implication.ImpliedTagValuePair()
+			if _, seen := parents[impliedPair]; seen {
+				continue
+			}
+
+			// implications of a tag without a value are found for all of the tag's values
+			for _, candidate := range pending {
+				if candidate.TagId == implyingPair.TagId && (implyingPair.ValueId == 0 || candidate.ValueId == implyingPair.ValueId) {
+					parents[impliedPair] = candidate
+					break
+				}
+			}
+
+			next = append(next, impliedPair)
+		}
+
+		pending = next
+	}
+
+	return nil, nil
+}
+
+func (storage Storage) tagValuePairName(tx *Tx, pair entities.TagIdValueIdPair) (string, error) {
+	tag, err := database.Tag(tx.tx, pair.TagId)
+	if err != nil {
+		return "", err
+	}
+	if tag == nil {
+		return "", fmt.Errorf("no such tag #%v", pair.TagId)
+	}
+
+	if pair.ValueId == 0 {
+		return tag.Name, nil
+	}
+
+	value, err := database.Value(tx.tx, pair.ValueId)
+	if err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", fmt.Errorf("no such value #%v", pair.ValueId)
+	}
+
+	return tag.Name + "=" + value.Name, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// The number of operations retained in the journal.
+const journalLength = 100
+
+// Begins recording the changes made within the transaction as an operation
+// that can subsequently be undone. The operation ends when the transaction is
+// committed.
+func (storage *Storage) BeginOperation(tx *Tx, command string) (*entities.Operation, error) {
+	if err := database.PruneOperations(tx.tx, journalLength-1); err != nil {
+		return nil, err
+	}
+
+	operation, err := database.InsertOperation(tx.tx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.operationOpen = true
+
+	return operation, nil
+}
+
+// Retrieves the most recent operations, latest first.
+func (storage *Storage) LatestOperations(tx *Tx, count uint) (entities.Operations, error) {
+	return database.LatestOperations(tx.tx, count)
+}
+
+// Reverts the changes made by an operation. If the audit log is enabled then the
+// reversal is logged against the command specified.
+func (storage *Storage) UndoOperation(tx *Tx, operationId entities.OperationId, command string) error {
+	if err := tx.auditUndo(operationId, command); err != nil {
+		return err
+	}
+
+	return database.UndoOperation(tx.tx, operationId)
+}
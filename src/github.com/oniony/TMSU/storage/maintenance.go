@@ -0,0 +1,64 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Creates those indexes expected by the schema that are missing from the database, returning their names.
+func (storage *Storage) CreateMissingIndexes(tx *Tx) ([]string, error) {
+	return database.CreateMissingIndexes(tx.tx)
+}
+
+// Updates the statistics used by the query planner.
+func (storage *Storage) Analyze(tx *Tx) error {
+	return database.Analyze(tx.tx)
+}
+
+// Retrieves the size of the database and the unused space within it, in bytes.
+func (storage *Storage) DatabaseSize(tx *Tx) (int64, int64, error) {
+	return database.DatabaseSize(tx.tx)
+}
+
+// Retrieves the tables and indexes of the database.
+func (storage *Storage) DatabaseObjects(tx *Tx) (entities.DatabaseObjects, error) {
+	return database.DatabaseObjects(tx.tx)
+}
+
+// Rebuilds the database file to reclaim unused space. As this cannot be done
+// within a transaction it must not be called whilst one is open.
+func (storage *Storage) Vacuum() error {
+	if storage.batch != nil {
+		return fmt.Errorf("cannot vacuum the database during a batch of transactions")
+	}
+
+	return storage.db.Vacuum()
+}
+
+// Migrates the schema of the database at the path to the version specified,
+// or to the latest version if none is, returning the migrations applied.
+func MigrateAt(path, passphrase, version string) (entities.Migrations, error) {
+	return database.MigrateAt(path, passphrase, version)
+}
+
+// Retrieves the schema version of the database at the path and every
+// migration, applied or pending, without migrating the database.
+func MigrationsAt(path, passphrase string) (string, entities.Migrations, error) {
+	return database.MigrationsAt(path, passphrase)
+}
@@ -0,0 +1,36 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the note for the specified file.
+func (storage *Storage) NoteByFileId(tx *Tx, fileId entities.FileId) (*entities.Note, error) {
+	return database.NoteByFileId(tx.tx, fileId)
+}
+
+// Adds or replaces the note for the specified file.
+func (storage *Storage) UpdateNote(tx *Tx, fileId entities.FileId, text string) (*entities.Note, error) {
+	return database.UpdateNote(tx.tx, fileId, text)
+}
+
+// Deletes the note for the specified file.
+func (storage *Storage) DeleteNote(tx *Tx, fileId entities.FileId) error {
+	return database.DeleteNote(tx.tx, fileId)
+}
@@ -0,0 +1,50 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Determines whether the database path is instead a PostgreSQL connection string.
+func IsPostgres(path string) bool {
+	return database.IsPostgres(path)
+}
+
+// Opens the PostgreSQL database named by the connection string, which may be
+// shared by several clients. Files are stored relative to the root path, if
+// specified, or else the root of the file system.
+func OpenPostgres(connection, rootPath string) (*Storage, error) {
+	db, err := database.OpenPostgres(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootPath == "" {
+		rootPath = _path.VolumeRoot("/")
+	}
+
+	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
+
+	return &Storage{db, connection, rootPath, nil, false, nil, nil, "", nil}, nil
+}
+
+// The connection string less any password, for display.
+func RedactConnection(connection string) string {
+	return database.RedactConnection(connection)
+}
@@ -0,0 +1,41 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the properties of the specified file, ordered by name.
+func (storage *Storage) PropertiesByFileId(tx *Tx, fileId entities.FileId) (entities.Properties, error) {
+	return database.PropertiesByFileId(tx.tx, fileId)
+}
+
+// Retrieves the named property of the specified file, or nil if it has none.
+func (storage *Storage) Property(tx *Tx, fileId entities.FileId, name string) (*entities.Property, error) {
+	return database.Property(tx.tx, fileId, name)
+}
+
+// Adds or replaces the named property of the specified file.
+func (storage *Storage) UpdateProperty(tx *Tx, fileId entities.FileId, name, value string) (*entities.Property, error) {
+	return database.UpdateProperty(tx.tx, fileId, name, value)
+}
+
+// Deletes the named property of the specified file.
+func (storage *Storage) DeleteProperty(tx *Tx, fileId entities.FileId, name string) error {
+	return database.DeleteProperty(tx.tx, fileId, name)
+}
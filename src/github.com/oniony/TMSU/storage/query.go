@@ -36,6 +36,30 @@ func (storage *Storage) AddQuery(tx *Tx, text string) (*entities.Query, error) {
 }
 
 // Removes a query from the database.
+// Its uses are forgotten so that it is not immediately added again.
 func (storage *Storage) DeleteQuery(tx *Tx, text string) error {
-	return database.DeleteQuery(tx.tx, text)
+	if err := database.DeleteQuery(tx.tx, text); err != nil {
+		return err
+	}
+
+	return database.DeleteQueryUsage(tx.tx, text)
+}
+
+// Records a use of a query, adding it to the set of queries once it has been used the specified number of times.
+func (storage *Storage) UseQuery(tx *Tx, text string, rememberAfter uint) error {
+	count, err := database.IncrementQueryUsage(tx.tx, text)
+	if err != nil {
+		return err
+	}
+	if count < rememberAfter {
+		return nil
+	}
+
+	query, err := database.Query(tx.tx, text)
+	if err != nil || query != nil {
+		return err
+	}
+
+	_, err = database.InsertQuery(tx.tx, text)
+	return err
 }
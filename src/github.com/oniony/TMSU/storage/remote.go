@@ -0,0 +1,44 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Opens the database served by 'tmsu serve' at the address. Files are stored
+// relative to the root path specified or else that of the served database.
+func OpenRemote(address, secret, rootPath string) (*Storage, error) {
+	db, remoteRootPath, err := database.OpenRemote(address, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootPath == "" {
+		rootPath = remoteRootPath
+	}
+
+	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
+
+	return &Storage{db, address, rootPath, nil, false, nil, nil, "", nil}, nil
+}
+
+// Serves the database to clients connecting to the address until the listener
+// fails.
+func (storage *Storage) Serve(address, secret string) error {
+	return storage.db.Serve(address, storage.RootPath, secret)
+}
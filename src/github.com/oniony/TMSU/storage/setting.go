@@ -16,18 +16,39 @@
 package storage
 
 import (
+	"github.com/oniony/TMSU/common/collation"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage/database"
 	"sort"
 )
 
 var defaultSettings = entities.Settings{
+	&entities.Setting{"auditLog", "no"},
 	&entities.Setting{"autoCreateTags", "yes"},
 	&entities.Setting{"autoCreateValues", "yes"},
+	&entities.Setting{"backupInterval", "none"},
+	&entities.Setting{"backupRetention", "10"},
+	&entities.Setting{"canonicalPaths", "no"},
+	&entities.Setting{"collation", "binary"},
+	&entities.Setting{"defaultSort", "name"},
 	&entities.Setting{"directoryFingerprintAlgorithm", "none"},
 	&entities.Setting{"fileFingerprintAlgorithm", "dynamic:SHA256"},
+	&entities.Setting{"fingerprintCommand", ""},
+	&entities.Setting{"followSymlinks", "yes"},
+	&entities.Setting{"ignoreTagCase", "no"},
+	&entities.Setting{"normalizeTagNames", "no"},
+	&entities.Setting{"openHandlers", ""},
+	&entities.Setting{"readOnly", "no"},
+	&entities.Setting{"recursiveTagLimit", "10000"},
+	&entities.Setting{"relativePaths", "yes"},
 	&entities.Setting{"reportDuplicates", "yes"},
-	&entities.Setting{"symlinkFingerprintAlgorithm", "follow"}}
+	&entities.Setting{"sidecars", "none"},
+	&entities.Setting{"symlinkFingerprintAlgorithm", "follow"},
+	&entities.Setting{"tagByContent", "no"},
+	&entities.Setting{"trackInodes", "no"},
+	&entities.Setting{"vfsFileNameTemplate", "{name}.{id}.{ext}"},
+	&entities.Setting{"vfsInboxTags", "inbox"},
+	&entities.Setting{"vfsRecentDays", "7"}}
 
 // The complete set of settings.
 func (storage *Storage) Settings(tx *Tx) (entities.Settings, error) {
@@ -36,7 +57,12 @@ func (storage *Storage) Settings(tx *Tx) (entities.Settings, error) {
 		return nil, err
 	}
 
-	// enrich with defaults
+	// enrich with the global settings and then the defaults
+	for _, globalSetting := range storage.globals {
+		if !settings.ContainsName(globalSetting.Name) {
+			settings = append(settings, globalSetting)
+		}
+	}
 	for _, defaultSetting := range defaultSettings {
 		if !settings.ContainsName(defaultSetting.Name) {
 			settings = append(settings, defaultSetting)
@@ -53,6 +79,9 @@ func (storage *Storage) Setting(tx *Tx, name string) (*entities.Setting, error)
 	if err != nil {
 		return nil, err
 	}
+	if setting == nil && storage.globals.ContainsName(name) {
+		setting = &entities.Setting{name, storage.globals.Value(name)}
+	}
 	if setting == nil {
 		value := defaultSettings.Value(name)
 		setting = &entities.Setting{name, value}
@@ -61,6 +90,34 @@ func (storage *Storage) Setting(tx *Tx, name string) (*entities.Setting, error)
 	return setting, nil
 }
 
+// Uses the specified settings, such as those of a global configuration file,
+// for the settings not set in the database itself.
+func (storage *Storage) UseGlobalSettings(settings entities.Settings) {
+	storage.globals = settings
+	storage.db.SetDefaultCollation(settings.Value("collation"))
+}
+
+// Retrieves the collator with which tag, value and file names are sorted.
+func (storage *Storage) Collator(tx *Tx) (*collation.Collator, error) {
+	return database.Collator(tx.tx)
+}
+
+// Attributes the tags subsequently applied to the specified user, or to no
+// one if empty.
+func (storage *Storage) SetUser(user string) {
+	storage.user = user
+}
+
+// The complete set of settings with their default values.
+func DefaultSettings() entities.Settings {
+	settings := make(entities.Settings, len(defaultSettings))
+	for index, setting := range defaultSettings {
+		settings[index] = &entities.Setting{setting.Name, setting.Value}
+	}
+
+	return settings
+}
+
 func (storage *Storage) UpdateSetting(tx *Tx, name, value string) (*entities.Setting, error) {
 	return database.UpdateSetting(tx.tx, name, value)
 }
@@ -0,0 +1,345 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The formats of the sidecar files to which the tags of files are mirrored.
+const (
+	NoSidecars        = "none"
+	FileSidecars      = "file"      // a FILE.tmsu beside each file
+	DirectorySidecars = "directory" // a .tags file in each directory
+)
+
+var SidecarFormats = []string{NoSidecars, FileSidecars, DirectorySidecars}
+
+// The extension of the sidecar file beside each file.
+const SidecarExtension = ".tmsu"
+
+// The name of the sidecar file listing the tags of the files in its directory.
+const DirectorySidecarName = ".tags"
+
+// A tag, and optional value, read from a sidecar file.
+type SidecarTag struct {
+	Path  string
+	Tag   string
+	Value string
+}
+
+// Reads the tags from a sidecar file in either format.
+func ReadSidecar(path string) ([]SidecarTag, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	isDirectorySidecar := filepath.Base(path) == DirectorySidecarName
+	targetPath := strings.TrimSuffix(path, SidecarExtension)
+	directory := filepath.Dir(path)
+
+	tags := make([]SidecarTag, 0, 10)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		for index := range fields {
+			fields[index] = unescapeSidecarField(fields[index])
+		}
+
+		if isDirectorySidecar {
+			if len(fields) < 2 {
+				continue
+			}
+			targetPath = filepath.Join(directory, fields[0])
+			fields = fields[1:]
+		}
+
+		tag := SidecarTag{Path: targetPath, Tag: fields[0]}
+		if len(fields) > 1 {
+			tag.Value = fields[1]
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// unexported
+
+// the content to write to a sidecar file, or nil to remove it
+type sidecarWrite struct {
+	path    string
+	content []byte
+}
+
+// notes that the sidecars of the files are to be written when the transaction
+// is committed, recording their paths now as the files may be removed
+func (storage *Storage) noteSidecars(tx *Tx, fileIds ...entities.FileId) error {
+	// the change to the tags is refused so the sidecars are left as they are
+	if storage.ReadOnly() {
+		return nil
+	}
+
+	format, err := tx.loadSidecarFormat()
+	if err != nil || format == NoSidecars {
+		return err
+	}
+
+	for _, fileId := range fileIds {
+		file, err := storage.File(tx, fileId)
+		if err != nil {
+			return err
+		}
+		if file == nil {
+			continue
+		}
+
+		tx.sidecarPaths[file.Path()] = true
+	}
+
+	return nil
+}
+
+// notes that the sidecars of the files tagged with the tags are to be written
+func (storage *Storage) noteTagSidecars(tx *Tx, tagIds ...entities.TagId) error {
+	for _, tagId := range tagIds {
+		fileTags, err := database.FileTagsByTagId(tx.tx, tagId)
+		if err != nil {
+			return err
+		}
+
+		if err := storage.noteSidecars(tx, fileTags.FileIds()...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notes that the sidecar for the path is to be written, such as when a file is
+// moved to or from it
+func (storage *Storage) noteSidecarPath(tx *Tx, path string) error {
+	format, err := tx.loadSidecarFormat()
+	if err != nil || format == NoSidecars {
+		return err
+	}
+
+	tx.sidecarPaths[path] = true
+
+	return nil
+}
+
+func (tx *Tx) loadSidecarFormat() (string, error) {
+	if tx.sidecarFormat == "" {
+		settings, err := tx.storage.Settings(tx)
+		if err != nil {
+			return "", err
+		}
+
+		tx.sidecarFormat = settings.Sidecars()
+		if tx.sidecarPaths == nil {
+			tx.sidecarPaths = make(map[string]bool)
+		}
+	}
+
+	return tx.sidecarFormat, nil
+}
+
+// the contents of the sidecar files of the noted paths, read before the
+// transaction is committed
+func (tx *Tx) sidecarWrites() ([]sidecarWrite, error) {
+	if len(tx.sidecarPaths) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, 0, len(tx.sidecarPaths))
+	for path := range tx.sidecarPaths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	tx.sidecarPaths = make(map[string]bool)
+
+	writes := make([]sidecarWrite, 0, len(paths))
+
+	switch tx.sidecarFormat {
+	case FileSidecars:
+		for _, path := range paths {
+			lines, err := tx.sidecarLines(path, "")
+			if err != nil {
+				return nil, err
+			}
+
+			writes = append(writes, sidecarWrite{path + SidecarExtension, sidecarContent(lines)})
+		}
+	case DirectorySidecars:
+		directories := make(map[string]bool)
+		for _, path := range paths {
+			directory := filepath.Dir(path)
+			if directories[directory] {
+				continue
+			}
+			directories[directory] = true
+
+			files, err := tx.storage.FilesByDirectory(tx, directory)
+			if err != nil {
+				return nil, err
+			}
+			sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+			var lines []string
+			for _, file := range files {
+				if file.Directory != directory {
+					continue
+				}
+
+				fileLines, err := tx.sidecarLines(file.Path(), escapeSidecarField(file.Name)+"\t")
+				if err != nil {
+					return nil, err
+				}
+
+				lines = append(lines, fileLines...)
+			}
+
+			writes = append(writes, sidecarWrite{filepath.Join(directory, DirectorySidecarName), sidecarContent(lines)})
+		}
+	}
+
+	return writes, nil
+}
+
+// the lines of the sidecar listing the explicit tags of the file at the path,
+// each with the prefix
+func (tx *Tx) sidecarLines(path, prefix string) ([]string, error) {
+	file, err := tx.storage.FileByPath(tx, path)
+	if err != nil || file == nil {
+		return nil, err
+	}
+
+	fileTags, err := tx.storage.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tag, err := tx.storage.Tag(tx, fileTag.TagId)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			continue
+		}
+
+		line := prefix + escapeSidecarField(tag.Name)
+
+		if fileTag.ValueId != 0 {
+			value, err := tx.storage.Value(tx, fileTag.ValueId)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				line += "\t" + escapeSidecarField(value.Name)
+			}
+		}
+
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	return lines, nil
+}
+
+func sidecarContent(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	for _, line := range lines {
+		buffer.WriteString(line)
+		buffer.WriteByte('\n')
+	}
+
+	return buffer.Bytes()
+}
+
+// writes the sidecar files, warning of those that cannot be written as the
+// changes to the database have by now been committed
+func writeSidecars(writes []sidecarWrite) {
+	for _, write := range writes {
+		var err error
+		if write.content == nil {
+			err = os.Remove(write.path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = ioutil.WriteFile(write.path, write.content, 0644)
+		}
+
+		if err != nil {
+			log.Warnf("%v: could not write sidecar: %v", write.path, err)
+		}
+	}
+}
+
+var sidecarEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+func escapeSidecarField(text string) string {
+	return sidecarEscaper.Replace(text)
+}
+
+func unescapeSidecarField(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+
+	var buffer bytes.Buffer
+	escaped := false
+	for _, r := range text {
+		switch {
+		case escaped:
+			switch r {
+			case 't':
+				buffer.WriteRune('\t')
+			case 'n':
+				buffer.WriteRune('\n')
+			default:
+				buffer.WriteRune(r)
+			}
+			escaped = false
+		case r == '\\':
+			escaped = true
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+
+	return buffer.String()
+}
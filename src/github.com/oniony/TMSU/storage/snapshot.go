@@ -0,0 +1,76 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the complete set of snapshots.
+func (storage *Storage) Snapshots(tx *Tx) (entities.Snapshots, error) {
+	return database.Snapshots(tx.tx)
+}
+
+// Retrieves a specific snapshot.
+func (storage *Storage) SnapshotByName(tx *Tx, name string) (*entities.Snapshot, error) {
+	return database.SnapshotByName(tx.tx, name)
+}
+
+// Retrieves the files recorded by a snapshot.
+func (storage *Storage) SnapshotFiles(tx *Tx, snapshotId entities.SnapshotId) (entities.SnapshotFiles, error) {
+	return database.SnapshotFiles(tx.tx, snapshotId)
+}
+
+// Adds a snapshot that records the specified files as those matching the query
+// at this time.
+func (storage *Storage) AddSnapshot(tx *Tx, name, queryText string, snapshotFiles entities.SnapshotFiles) (*entities.Snapshot, error) {
+	if err := entities.ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	if _, err := query.Parse(queryText); err != nil {
+		return nil, fmt.Errorf("could not parse query: %w", err)
+	}
+
+	snapshot, err := database.SnapshotByName(tx.tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		return nil, fmt.Errorf("a snapshot named '%v' already exists", name)
+	}
+
+	snapshot, err = database.InsertSnapshot(tx.tx, name, queryText)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshotFile := range snapshotFiles {
+		if err := database.InsertSnapshotFile(tx.tx, snapshot.Id, *snapshotFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Deletes a snapshot.
+func (storage *Storage) DeleteSnapshot(tx *Tx, name string) error {
+	return database.DeleteSnapshot(tx.tx, name)
+}
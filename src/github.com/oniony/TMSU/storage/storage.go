@@ -18,14 +18,24 @@ package storage
 import (
 	"fmt"
 	"github.com/oniony/TMSU/common/log"
+	_path "github.com/oniony/TMSU/common/path"
+	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/storage/database"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type Storage struct {
 	db       *database.Database
 	DbPath   string
 	RootPath string
+	batch    *batch
+	tracking bool
+	changes  []Change
+	globals  entities.Settings
+	user     string
+	lock     *database.Lock // nil unless the cooperative lock is used
 }
 
 func CreateAt(path string) error {
@@ -45,26 +55,151 @@ func OpenAt(path string) (*Storage, error) {
 
 	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
 
-	return &Storage{db, path, rootPath}, nil
+	return &Storage{db, path, rootPath, nil, false, nil, nil, "", nil}, nil
+}
+
+// Opens the database at the path, refusing any change to it. The passphrase is
+// only required if the database is encrypted.
+func OpenReadOnlyAt(path, passphrase string) (*Storage, error) {
+	db, err := database.OpenReadOnlyAt(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	rootPath, err := determineRootPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
+
+	return &Storage{db, path, rootPath, nil, false, nil, nil, "", nil}, nil
+}
+
+// Determines whether changes to the database are refused.
+func (storage *Storage) ReadOnly() bool {
+	return storage.db.ReadOnly()
+}
+
+// Refuses, or once again permits, changes to the database.
+func (storage *Storage) SetReadOnly(readOnly bool) {
+	storage.db.SetReadOnly(readOnly)
+}
+
+// Makes each transaction, unless the database is read-only, first take the lock
+// that other processes using it take whilst they change it, waiting for up to the
+// timeout for its release, so that concurrent changes are made in turn.
+func (storage *Storage) UseLock(timeout time.Duration) {
+	storage.lock = database.NewLock(storage.DbPath, timeout)
+}
+
+// Whether the absolute path is that of the database or of one of the files kept
+// beside it: its write-ahead log, shared memory index, rollback journal or lock.
+func (storage *Storage) IsDatabaseFile(absPath string) bool {
+	dbPath, err := filepath.Abs(storage.DbPath)
+	if err != nil || !strings.HasPrefix(absPath, dbPath) {
+		return false
+	}
+
+	switch absPath[len(dbPath):] {
+	case "", "-wal", "-shm", "-journal", database.LockExtension:
+		return true
+	}
+
+	return false
 }
 
 func (storage *Storage) Begin() (*Tx, error) {
+	if storage.batch != nil {
+		return &Tx{storage.batch.tx, false, storage.batch, storage, nil, "", nil, false, "", nil, nil, ""}, nil
+	}
+
+	locked, err := storage.acquireLock()
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := storage.db.Begin()
 	if err != nil {
+		if locked {
+			storage.lock.Release()
+		}
 		return nil, err
 	}
 
-	return &Tx{tx}, nil
+	return &Tx{tx, false, nil, storage, nil, "", nil, locked, "", nil, nil, ""}, nil
+}
+
+// Begins a batch of transactions. Until the batch is ended the transactions
+// begun share a single database transaction so that their changes are either
+// all committed or all rolled back, and closing the storage has no effect.
+func (storage *Storage) BeginBatch() error {
+	if storage.batch != nil {
+		return fmt.Errorf("a batch of transactions is already in progress")
+	}
+
+	locked, err := storage.acquireLock()
+	if err != nil {
+		return err
+	}
+
+	tx, err := storage.db.Begin()
+	if err != nil {
+		if locked {
+			storage.lock.Release()
+		}
+		return err
+	}
+
+	storage.batch = &batch{tx, false, nil, locked, nil}
+
+	return nil
+}
+
+// Ends the batch of transactions, committing their changes if commit is
+// specified, unless any of the transactions was rolled back, or else rolling
+// them back.
+func (storage *Storage) EndBatch(commit bool) error {
+	batch := storage.batch
+	if batch == nil {
+		return fmt.Errorf("no batch of transactions is in progress")
+	}
+
+	storage.batch = nil
+	if batch.locked {
+		defer storage.lock.Release()
+	}
+
+	if !commit || batch.rolledBack {
+		if err := batch.tx.Rollback(); err != nil {
+			return err
+		}
+
+		if commit {
+			return BatchRolledBackError{}
+		}
+
+		return nil
+	}
+
+	if err := batch.tx.Commit(); err != nil {
+		return err
+	}
+
+	writeSidecars(batch.sidecarWrites)
+	appendAuditLog(storage.DbPath, batch.auditEntries)
+
+	return nil
 }
 
 func (storage *Storage) Close() error {
-	if storage.db == nil {
+	if storage.db == nil || storage.batch != nil {
 		return nil
 	}
 
 	err := storage.db.Close()
 	if err != nil {
-		return fmt.Errorf("could not close database: %v", err)
+		return fmt.Errorf("could not close database: %w", err)
 	}
 
 	storage.db = nil
@@ -73,19 +208,124 @@ func (storage *Storage) Close() error {
 }
 
 type Tx struct {
-	tx *database.Tx
+	tx            *database.Tx
+	operationOpen bool
+	batch         *batch
+	storage       *Storage
+	changes       []Change
+	sidecarFormat string                             // loaded from the settings when first needed
+	sidecarPaths  map[string]bool                    // the files whose sidecars are to be written
+	locked        bool                               // whether the storage's lock is held for the transaction
+	auditLog      string                             // whether changes are logged, determined when first needed
+	auditEntries  []AuditEntry                       // the reversals of operations to log
+	tagGroups     map[entities.TagId]entities.TagIds // loaded when first needed
+	trackInodes   string                             // whether file identities are recorded, determined when first needed
 }
 
 func (tx *Tx) Commit() error {
-	return tx.tx.Commit()
+	defer tx.releaseLock()
+
+	auditEntries, err := tx.pendingAuditEntries()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if tx.operationOpen {
+		if err := database.EndOperations(tx.tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		tx.operationOpen = false
+	}
+
+	sidecarWrites, err := tx.sidecarWrites()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if tx.batch != nil {
+		// committed when the batch ends
+		tx.batch.sidecarWrites = append(tx.batch.sidecarWrites, sidecarWrites...)
+		tx.batch.auditEntries = append(tx.batch.auditEntries, auditEntries...)
+		tx.flushChanges()
+		return nil
+	}
+
+	if err := tx.tx.Commit(); err != nil {
+		return err
+	}
+
+	tx.flushChanges()
+	writeSidecars(sidecarWrites)
+	appendAuditLog(tx.storage.DbPath, auditEntries)
+
+	return nil
 }
 
 func (tx *Tx) Rollback() error {
+	defer tx.releaseLock()
+
+	if tx.batch != nil {
+		// rolled back when the batch ends
+		tx.batch.rolledBack = true
+		tx.changes = nil
+		tx.sidecarPaths = nil
+		return nil
+	}
+
+	tx.changes = nil
+	tx.sidecarPaths = nil
+
 	return tx.tx.Rollback()
 }
 
 // unexported
 
+// takes the storage's lock, if it is used and the database may be changed,
+// returning whether it was taken
+func (storage *Storage) acquireLock() (bool, error) {
+	if storage.lock == nil || storage.ReadOnly() {
+		return false, nil
+	}
+
+	if err := storage.lock.Acquire(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// releases the storage's lock if it was taken for the transaction, which may be
+// committed or rolled back more than once
+func (tx *Tx) releaseLock() {
+	if !tx.locked {
+		return
+	}
+
+	tx.locked = false
+	if err := tx.storage.lock.Release(); err != nil {
+		log.Warn(err.Error())
+	}
+}
+
+// passes the changes recorded within the transaction to the storage
+func (tx *Tx) flushChanges() {
+	tx.storage.changes = append(tx.storage.changes, tx.changes...)
+	tx.changes = nil
+}
+
+// the database transaction shared by a batch of transactions
+type batch struct {
+	tx            *database.Tx
+	rolledBack    bool
+	sidecarWrites []sidecarWrite // written once the batch is committed
+	locked        bool           // whether the storage's lock is held for the batch
+	auditEntries  []AuditEntry   // logged once the batch is committed
+}
+
 func determineRootPath(dbPath string) (string, error) {
 	absDbPath, err := filepath.Abs(dbPath)
 	if err != nil {
@@ -97,5 +337,5 @@ func determineRootPath(dbPath string) (string, error) {
 		return filepath.Dir(absDbDirPath), nil
 	}
 
-	return string(filepath.Separator), nil //TODO Windows
+	return _path.VolumeRoot(absDbPath), nil
 }
@@ -0,0 +1,33 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/storage/database"
+	"time"
+)
+
+// Retrieves the time at which the database was last synchronized with the
+// specified peer database, or the zero time if it never has been.
+func (storage *Storage) LastSyncTime(tx *Tx, peer string) (time.Time, error) {
+	return database.LastSyncTime(tx.tx, peer)
+}
+
+// Records the time at which the database was synchronized with the specified
+// peer database.
+func (storage *Storage) UpdateSyncTime(tx *Tx, peer string, syncTime time.Time) error {
+	return database.UpdateSyncTime(tx.tx, peer, syncTime)
+}
@@ -16,8 +16,14 @@
 package storage
 
 import (
+	"fmt"
+	"github.com/oniony/TMSU/common/text"
 	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage/database"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 // The number of tags in the database.
@@ -47,7 +53,17 @@ func (storage Storage) TagByName(tx *Tx, name string) (*entities.Tag, error) {
 
 // Retrieves a specific tag with specified case-sensitivity.
 func (storage Storage) TagByCasedName(tx *Tx, name string, ignoreCase bool) (*entities.Tag, error) {
-	return database.TagByName(tx.tx, name, ignoreCase)
+	tag, err := database.TagByName(tx.tx, name, ignoreCase)
+	if err != nil || tag != nil {
+		return tag, err
+	}
+
+	tagsByKey, nameKey, err := storage.tagsByNameKey(tx, ignoreCase)
+	if err != nil || tagsByKey == nil {
+		return nil, err
+	}
+
+	return tagsByKey[nameKey(name)], nil
 }
 
 // Retrieves the set of named tags.
@@ -57,34 +73,336 @@ func (storage Storage) TagsByNames(tx *Tx, names []string) (entities.Tags, error
 
 // Retrieves the set of named tags.
 func (storage Storage) TagsByCasedNames(tx *Tx, names []string, ignoreCase bool) (entities.Tags, error) {
-	return database.TagsByNames(tx.tx, names, ignoreCase)
+	tags, err := database.TagsByNames(tx.tx, names, ignoreCase)
+	if err != nil {
+		return nil, err
+	}
+
+	tagsByKey, nameKey, err := storage.tagsByNameKey(tx, ignoreCase)
+	if err != nil || tagsByKey == nil {
+		return tags, err
+	}
+
+	for _, name := range names {
+		if tags.ContainsCasedName(name, ignoreCase) {
+			continue
+		}
+
+		if tag, ok := tagsByKey[nameKey(name)]; ok && !tags.Contains(tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// Replaces the tag names in the specified query expression with the names of the tags they match when tag names
+// are matched regardless of case or Unicode normalization.
+func (storage *Storage) ResolveTagNames(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	tagsByKey, nameKey, err := storage.tagsByNameKey(tx, ignoreCase)
+	if err != nil || tagsByKey == nil {
+		return expression, err
+	}
+
+	tags, err := storage.Tags(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.MapTagNames(expression, func(name string) string {
+		if tags.ContainsCasedName(name, ignoreCase) {
+			return name
+		}
+
+		if tag, ok := tagsByKey[nameKey(name)]; ok {
+			return tag.Name
+		}
+
+		return name
+	}), nil
+}
+
+// Replaces each tag name in the specified query expression that ends with '*', and is not itself the name of a tag,
+// with the disjunction of the tags whose names begin with the text preceding the '*'. A name of the form 'GROUP:*'
+// also matches the tags of the tag group GROUP. Tag names matching no tags are left unchanged.
+func (storage *Storage) ExpandTagPrefixes(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	tagNames, err := query.TagNames(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	hasPrefix := false
+	for _, tagName := range tagNames {
+		if isTagPrefix(tagName) {
+			hasPrefix = true
+			break
+		}
+	}
+	if !hasPrefix {
+		return expression, nil
+	}
+
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	nameKey := func(name string) string {
+		return entities.TagNameKey(name, ignoreCase || settings.IgnoreTagCase(), settings.NormalizeTagNames())
+	}
+
+	tags, err := storage.Tags(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	tagGroups, err := storage.TagGroups(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	groupedTagNames := make(map[string]map[string]bool, len(tagGroups))
+	for _, tagGroup := range tagGroups {
+		key := nameKey(tagGroup.Name)
+		if groupedTagNames[key] == nil {
+			groupedTagNames[key] = make(map[string]bool, len(tagGroup.Tags))
+		}
+
+		for _, tag := range tagGroup.Tags {
+			groupedTagNames[key][tag.Name] = true
+		}
+	}
+
+	return query.MapTags(expression, func(exp query.TagExpression) query.Expression {
+		if !isTagPrefix(exp.Name) || tags.ContainsCasedName(exp.Name, ignoreCase) {
+			return exp
+		}
+
+		prefix := nameKey(strings.TrimSuffix(exp.Name, "*"))
+		groupTagNames := groupedTagNames[strings.TrimSuffix(prefix, entities.TagNamespaceSeparator)]
+		if !strings.HasSuffix(prefix, entities.TagNamespaceSeparator) {
+			groupTagNames = nil
+		}
+
+		var expanded query.Expression
+		for _, tag := range tags {
+			if !strings.HasPrefix(nameKey(tag.Name), prefix) && !groupTagNames[tag.Name] {
+				continue
+			}
+
+			if expanded == nil {
+				expanded = query.TagExpression{tag.Name}
+			} else {
+				expanded = query.OrExpression{expanded, query.TagExpression{tag.Name}}
+			}
+		}
+
+		if expanded == nil {
+			return exp
+		}
+
+		return expanded
+	}), nil
+}
+
+// Retrieves the names of the tags whose names are similar to the specified name, closest first, for suggesting
+// alternatives to a tag name that does not exist.
+func (storage *Storage) SimilarTagNames(tx *Tx, name string) ([]string, error) {
+	tags, err := storage.Tags(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// allow roughly one edit for every three characters
+	maximum := (utf8.RuneCountInString(name) + 2) / 3
+
+	distances := make(map[string]int)
+	names := make([]string, 0, 3)
+	for _, tag := range tags {
+		distance := text.Distance(strings.ToLower(name), strings.ToLower(tag.Name))
+		if distance <= maximum {
+			distances[tag.Name] = distance
+			names = append(names, tag.Name)
+		}
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		return distances[names[i]] < distances[names[j]]
+	})
+
+	return names, nil
 }
 
 // Adds a tag.
 func (storage *Storage) AddTag(tx *Tx, name string) (*entities.Tag, error) {
+	name, err := storage.matchedTagName(tx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := entities.ValidateTagName(name); err != nil {
 		return nil, err
 	}
 
-	return database.InsertTag(tx.tx, name)
+	if err := storage.checkAliasUnused(tx, name); err != nil {
+		return nil, err
+	}
+
+	parentId, err := storage.parentTagId(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.InsertTag(tx.tx, name, parentId)
 }
 
-// Renames a tag.
+// Renames a tag, along with any tags beneath it in the tag hierarchy.
 func (storage Storage) RenameTag(tx *Tx, tagId entities.TagId, name string) (*entities.Tag, error) {
+	name, err := storage.matchedTagName(tx, name, tagId)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := entities.ValidateTagName(name); err != nil {
 		return nil, err
 	}
 
+	if err := storage.checkAliasUnused(tx, name); err != nil {
+		return nil, err
+	}
+
+	tag, err := database.Tag(tx.tx, tagId)
+	if err != nil {
+		return nil, err
+	}
+	if tag == nil {
+		return nil, fmt.Errorf("no such tag #%v", tagId)
+	}
+
+	if strings.HasPrefix(name, tag.Name+entities.TagNameSeparator) {
+		return nil, fmt.Errorf("cannot move tag '%v' beneath itself", tag.Name)
+	}
+
+	descendants, err := database.DescendantTags(tx.tx, tagId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.noteTagSidecars(tx, tagId); err != nil {
+		return nil, err
+	}
+
+	for _, descendant := range descendants {
+		descendantName := name + descendant.Name[len(tag.Name):]
+
+		existing, err := database.TagByName(tx.tx, descendantName, false)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("cannot rename tag '%v' as tag '%v' already exists", descendant.Name, descendantName)
+		}
+
+		if err := storage.noteTagSidecars(tx, descendant.Id); err != nil {
+			return nil, err
+		}
+
+		if _, err := database.RenameTag(tx.tx, descendant.Id, descendantName); err != nil {
+			return nil, err
+		}
+	}
+
+	parentId, err := storage.parentTagId(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.UpdateTagParent(tx.tx, tagId, parentId); err != nil {
+		return nil, err
+	}
+
 	return database.RenameTag(tx.tx, tagId, name)
 }
 
+// Retrieves the set of tags within the specified namespace.
+func (storage Storage) TagsByNamespace(tx *Tx, namespace string) (entities.Tags, error) {
+	if err := entities.ValidateTagNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	tags, err := database.TagsByNamePrefix(tx.tx, namespace+entities.TagNamespaceSeparator)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceTags := make(entities.Tags, 0, len(tags))
+	for _, tag := range tags {
+		if entities.TagNamespace(tag.Name) == namespace {
+			namespaceTags = append(namespaceTags, tag)
+		}
+	}
+
+	return namespaceTags, nil
+}
+
+// Moves the tags of one namespace into another, failing without change if any
+// tag of the same name already exists in the destination namespace.
+func (storage Storage) RenameTagNamespace(tx *Tx, namespace, newNamespace string) (entities.Tags, error) {
+	if err := entities.ValidateTagNamespace(newNamespace); err != nil {
+		return nil, err
+	}
+
+	tags, err := storage.TagsByNamespace(tx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range tags {
+		newName := entities.WithTagNamespace(tag.Name, newNamespace)
+
+		existing, err := database.TagByName(tx.tx, newName, false)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("cannot move tag '%v' as tag '%v' already exists", tag.Name, newName)
+		}
+	}
+
+	renamed := make(entities.Tags, 0, len(tags))
+	for _, tag := range tags {
+		if entities.ParentTagName(tag.Name) != "" {
+			// moved along with its ancestor
+			continue
+		}
+
+		renamedTag, err := storage.RenameTag(tx, tag.Id, entities.WithTagNamespace(tag.Name, newNamespace))
+		if err != nil {
+			return nil, err
+		}
+
+		renamed = append(renamed, renamedTag)
+	}
+
+	return renamed, nil
+}
+
 // Copies a tag.
 func (storage Storage) CopyTag(tx *Tx, sourceTagId entities.TagId, name string) (*entities.Tag, error) {
 	if err := entities.ValidateTagName(name); err != nil {
 		return nil, err
 	}
 
-	tag, err := database.InsertTag(tx.tx, name)
+	if err := storage.checkAliasUnused(tx, name); err != nil {
+		return nil, err
+	}
+
+	parentId, err := storage.parentTagId(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := database.InsertTag(tx.tx, name, parentId)
 	if err != nil {
 		return nil, err
 	}
@@ -94,11 +412,57 @@ func (storage Storage) CopyTag(tx *Tx, sourceTagId entities.TagId, name string)
 		return nil, err
 	}
 
+	if err := database.CopyContentTags(tx.tx, sourceTagId, tag.Id); err != nil {
+		return nil, err
+	}
+
+	valueType, err := database.TagType(tx.tx, sourceTagId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.UpdateTagType(tx.tx, tag.Id, valueType); err != nil {
+		return nil, err
+	}
+
+	tagInfo, err := database.TagInfo(tx.tx, sourceTagId)
+	if err != nil {
+		return nil, err
+	}
+	if tagInfo != nil {
+		if err := database.UpdateTagInfo(tx.tx, tag.Id, tagInfo.Description, tagInfo.Colour, tagInfo.Icon); err != nil {
+			return nil, err
+		}
+	}
+
+	tagConstraint, err := database.TagConstraint(tx.tx, sourceTagId)
+	if err != nil {
+		return nil, err
+	}
+	if tagConstraint != nil {
+		if err := database.UpdateTagConstraint(tx.tx, tag.Id, tagConstraint.Pattern, tagConstraint.Default); err != nil {
+			return nil, err
+		}
+	}
+
 	return tag, nil
 }
 
+// The number of child tags of a tag.
+func (storage Storage) ChildTagCount(tx *Tx, tagId entities.TagId) (uint, error) {
+	return database.ChildTagCount(tx.tx, tagId)
+}
+
 // Deletes a tag.
 func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
+	childCount, err := database.ChildTagCount(tx.tx, tagId)
+	if err != nil {
+		return err
+	}
+	if childCount > 0 {
+		return fmt.Errorf("tag has %v child tag(s)", childCount)
+	}
+
 	if err := storage.DeleteFileTagsByTagId(tx, tagId); err != nil {
 		return err
 	}
@@ -107,6 +471,26 @@ func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
 		return err
 	}
 
+	if err := storage.DeleteAliasesByTagId(tx, tagId); err != nil {
+		return err
+	}
+
+	if err := database.DeleteTagType(tx.tx, tagId); err != nil {
+		return err
+	}
+
+	if err := database.DeleteTagInfo(tx.tx, tagId); err != nil {
+		return err
+	}
+
+	if err := database.DeleteTagConstraint(tx.tx, tagId); err != nil {
+		return err
+	}
+
+	if err := storage.DeleteTagGroup(tx, tagId); err != nil {
+		return err
+	}
+
 	if err := database.DeleteTag(tx.tx, tagId); err != nil {
 		return err
 	}
@@ -118,3 +502,116 @@ func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
 func (storage Storage) TagUsage(tx *Tx) ([]entities.TagFileCount, error) {
 	return database.TagUsage(tx.tx)
 }
+
+// Retrieves the usage of the most used tags, most used first. A limit of zero retrieves every tag.
+func (storage Storage) TopTagUsage(tx *Tx, limit uint) ([]entities.TagFileCount, error) {
+	return database.TopTagUsage(tx.tx, limit)
+}
+
+// Retrieves the pairs of tags most often applied together. A limit of zero retrieves every pair.
+func (storage Storage) TagPairUsage(tx *Tx, limit uint) ([]entities.TagPairFileCount, error) {
+	return database.TagPairUsage(tx.tx, limit)
+}
+
+// Retrieves the tags most often applied alongside the specified tags, omitting those already
+// applied to the specified files. A limit of zero retrieves every tag.
+func (storage Storage) CoOccurringTags(tx *Tx, tagIds entities.TagIds, fileIds entities.FileIds, limit uint) ([]entities.TagFileCount, error) {
+	return database.CoOccurringTags(tx.tx, tagIds, fileIds, limit)
+}
+
+// Retrieves the set of tags beneath the specified tag in the tag hierarchy.
+func (storage Storage) DescendantTags(tx *Tx, tagId entities.TagId) (entities.Tags, error) {
+	return database.DescendantTags(tx.tx, tagId)
+}
+
+// unexported
+
+func isTagPrefix(tagName string) bool {
+	return len(tagName) > 1 && strings.HasSuffix(tagName, "*")
+}
+
+// Retrieves the identifier of the parent of a hierarchical tag, creating the parent if necessary.
+// the tags keyed by the form of their names that is matched, or nil if tag names must match exactly
+func (storage Storage) tagsByNameKey(tx *Tx, ignoreCase bool) (map[string]*entities.Tag, func(string) string, error) {
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !settings.IgnoreTagCase() && !settings.NormalizeTagNames() {
+		return nil, nil, nil
+	}
+
+	nameKey := func(name string) string {
+		return entities.TagNameKey(name, ignoreCase || settings.IgnoreTagCase(), settings.NormalizeTagNames())
+	}
+
+	tags, err := database.Tags(tx.tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tagsByKey := make(map[string]*entities.Tag, len(tags))
+	for _, tag := range tags {
+		key := nameKey(tag.Name)
+		if _, ok := tagsByKey[key]; !ok {
+			tagsByKey[key] = tag
+		}
+	}
+
+	return tagsByKey, nameKey, nil
+}
+
+// the name under which a tag is to be stored: normalized, if tag names are normalized, and beneath the existing
+// parent tag it matches. An error is returned if the name matches a tag other than the one specified.
+func (storage Storage) matchedTagName(tx *Tx, name string, tagId entities.TagId) (string, error) {
+	tagsByKey, nameKey, err := storage.tagsByNameKey(tx, false)
+	if err != nil || tagsByKey == nil {
+		return name, err
+	}
+
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return "", err
+	}
+
+	if settings.NormalizeTagNames() {
+		name = entities.NormalizeTagName(name)
+	}
+
+	if existing, ok := tagsByKey[nameKey(name)]; ok && existing.Id != tagId && existing.Name != name {
+		return "", fmt.Errorf("tag '%v' matches existing tag '%v'", name, existing.Name)
+	}
+
+	if parentName := entities.ParentTagName(name); parentName != "" {
+		parent, err := storage.TagByName(tx, parentName)
+		if err != nil {
+			return "", err
+		}
+		if parent != nil {
+			name = parent.Name + name[len(parentName):]
+		}
+	}
+
+	return name, nil
+}
+
+func (storage Storage) parentTagId(tx *Tx, name string) (entities.TagId, error) {
+	parentName := entities.ParentTagName(name)
+	if parentName == "" {
+		return 0, nil
+	}
+
+	parent, err := database.TagByName(tx.tx, parentName, false)
+	if err != nil {
+		return 0, err
+	}
+	if parent == nil {
+		parent, err = storage.AddTag(tx, parentName)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return parent.Id, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the constraints of every tag that has any.
+func (storage *Storage) TagConstraints(tx *Tx) (entities.TagConstraints, error) {
+	return database.TagConstraints(tx.tx)
+}
+
+// Retrieves the constraint of the specified tag, which is empty if it has none.
+func (storage *Storage) TagConstraint(tx *Tx, tag entities.Tag) (*entities.TagConstraint, error) {
+	tagConstraint, err := database.TagConstraint(tx.tx, tag.Id)
+	if err != nil {
+		return nil, err
+	}
+	if tagConstraint == nil {
+		tagConstraint = &entities.TagConstraint{Tag: tag}
+	}
+
+	return tagConstraint, nil
+}
+
+// Sets the constraint of the specified tag.
+// The default value and the values already applied with the tag must be allowed by it.
+func (storage *Storage) SetTagConstraint(tx *Tx, tagConstraint entities.TagConstraint) error {
+	if err := entities.ValidateValuePattern(tagConstraint.Pattern); err != nil {
+		return err
+	}
+
+	tag := tagConstraint.Tag
+
+	if tagConstraint.Default != "" {
+		valueType, err := database.TagType(tx.tx, tag.Id)
+		if err != nil {
+			return err
+		}
+
+		normalized, err := valueType.Normalize(tagConstraint.Default)
+		if err != nil {
+			return fmt.Errorf("invalid default value '%v' for %v tag '%v': %w", tagConstraint.Default, valueType, tag.Name, err)
+		}
+		if !tagConstraint.Allows(normalized) {
+			return fmt.Errorf("default value '%v' of tag '%v' does not match '%v'", normalized, tag.Name, tagConstraint.Pattern)
+		}
+
+		tagConstraint.Default = normalized
+	}
+
+	values, err := database.ValuesByTagId(tx.tx, tag.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if !tagConstraint.Allows(value.Name) {
+			return fmt.Errorf("tag '%v' has value '%v' which does not match '%v'", tag.Name, value.Name, tagConstraint.Pattern)
+		}
+	}
+
+	return database.UpdateTagConstraint(tx.tx, tag.Id, tagConstraint.Pattern, tagConstraint.Default)
+}
@@ -0,0 +1,156 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/fingerprint"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the complete set of tag groups.
+func (storage *Storage) TagGroups(tx *Tx) (entities.TagGroups, error) {
+	return database.TagGroups(tx.tx)
+}
+
+// Retrieves the name of the group of the specified tag, or an empty string if
+// it is in no group.
+func (storage *Storage) TagGroupName(tx *Tx, tagId entities.TagId) (string, error) {
+	return database.TagGroupName(tx.tx, tagId)
+}
+
+// Places the tag in the group with the specified name, removing it from any
+// other group. The tag cannot be added where files are already tagged with it
+// and another tag of the group.
+func (storage *Storage) SetTagGroup(tx *Tx, tag entities.Tag, name string) error {
+	if err := entities.ValidateTagGroupName(name); err != nil {
+		return err
+	}
+
+	conflicts, err := database.TagGroupConflictCount(tx.tx, tag.Id, name)
+	if err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("cannot add tag '%v' to group '%v' as %v file(s) are also tagged with another of its tags", tag.Name, name, conflicts)
+	}
+
+	tx.tagGroups = nil
+
+	return database.UpdateTagGroup(tx.tx, tag.Id, name)
+}
+
+// Removes the tag from its group.
+func (storage *Storage) DeleteTagGroup(tx *Tx, tagId entities.TagId) error {
+	tx.tagGroups = nil
+
+	return database.DeleteTagGroup(tx.tx, tagId)
+}
+
+// unexported
+
+// the other tags of the group of each tag that is in a group, loaded when first
+// needed
+func (tx *Tx) loadTagGroups() (map[entities.TagId]entities.TagIds, error) {
+	if tx.tagGroups == nil {
+		tagGroups, err := database.TagGroups(tx.tx)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.tagGroups = make(map[entities.TagId]entities.TagIds)
+		for _, tagGroup := range tagGroups {
+			for _, tag := range tagGroup.Tags {
+				others := make(entities.TagIds, 0, len(tagGroup.Tags)-1)
+				for _, other := range tagGroup.Tags {
+					if other.Id != tag.Id {
+						others = append(others, other.Id)
+					}
+				}
+
+				tx.tagGroups[tag.Id] = others
+			}
+		}
+	}
+
+	return tx.tagGroups, nil
+}
+
+// removes from the file the other tags of the group of the tag about to be
+// applied to it, so that at most one tag of the group is applied
+func (storage *Storage) removeGroupedFileTags(tx *Tx, fileId entities.FileId, tagId entities.TagId) error {
+	tagGroups, err := tx.loadTagGroups()
+	if err != nil {
+		return err
+	}
+
+	others, ok := tagGroups[tagId]
+	if !ok || len(others) == 0 {
+		return nil
+	}
+
+	fileTags, err := database.FileTagsByFileId(tx.tx, fileId)
+	if err != nil {
+		return err
+	}
+
+	for _, fileTag := range fileTags {
+		if !others.Contains(fileTag.TagId) {
+			continue
+		}
+
+		if err := storage.recordFileTagChange(tx, FileUntagged, fileId, fileTag.TagId, fileTag.ValueId); err != nil {
+			return err
+		}
+
+		// the file is not deleted, though momentarily untagged, as it is about to be tagged
+		if err := database.DeleteFileTag(tx.tx, fileId, fileTag.TagId, fileTag.ValueId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removes from the content the other tags of the group of the tag about to be
+// applied to it
+func (storage *Storage) removeGroupedContentTags(tx *Tx, fingerprint fingerprint.Fingerprint, tagId entities.TagId) error {
+	tagGroups, err := tx.loadTagGroups()
+	if err != nil {
+		return err
+	}
+
+	others, ok := tagGroups[tagId]
+	if !ok || len(others) == 0 {
+		return nil
+	}
+
+	contentTags, err := database.ContentTags(tx.tx, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	for _, contentTag := range contentTags {
+		if others.Contains(contentTag.TagId) {
+			if err := database.DeleteContentTag(tx.tx, fingerprint, contentTag.TagId, contentTag.ValueId); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the information of every tag that has any.
+func (storage *Storage) TagInfos(tx *Tx) (entities.TagInfos, error) {
+	return database.TagInfos(tx.tx)
+}
+
+// Retrieves the information of the specified tag, which is empty if it has none.
+func (storage *Storage) TagInfo(tx *Tx, tag entities.Tag) (*entities.TagInfo, error) {
+	tagInfo, err := database.TagInfo(tx.tx, tag.Id)
+	if err != nil {
+		return nil, err
+	}
+	if tagInfo == nil {
+		tagInfo = &entities.TagInfo{Tag: tag}
+	}
+
+	return tagInfo, nil
+}
+
+// Sets the information of the specified tag.
+func (storage *Storage) SetTagInfo(tx *Tx, tagInfo entities.TagInfo) error {
+	if err := entities.ValidateTagColour(tagInfo.Colour); err != nil {
+		return err
+	}
+
+	return database.UpdateTagInfo(tx.tx, tagInfo.Tag.Id, tagInfo.Description, tagInfo.Colour, tagInfo.Icon)
+}
@@ -0,0 +1,135 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the set of tags that have a value type.
+func (storage *Storage) TagTypes(tx *Tx) (entities.TagTypes, error) {
+	return database.TagTypes(tx.tx)
+}
+
+// Retrieves the type of the values of the specified tag.
+func (storage *Storage) TagType(tx *Tx, tagId entities.TagId) (entities.ValueType, error) {
+	return database.TagType(tx.tx, tagId)
+}
+
+// Sets the type of the values of the specified tag.
+// The values already applied with the tag, and its default value, must be valid for the type.
+func (storage *Storage) SetTagType(tx *Tx, tag entities.Tag, valueType entities.ValueType) error {
+	values, err := database.ValuesByTagId(tx.tx, tag.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		normalized, err := valueType.Normalize(value.Name)
+		if err == nil && normalized != value.Name {
+			err = fmt.Errorf("'%v' should be written '%v'", value.Name, normalized)
+		}
+		if err != nil {
+			return fmt.Errorf("tag '%v' has value '%v' which is not valid for type '%v': %w", tag.Name, value.Name, valueType, err)
+		}
+	}
+
+	tagConstraint, err := database.TagConstraint(tx.tx, tag.Id)
+	if err != nil {
+		return err
+	}
+	if tagConstraint != nil && tagConstraint.Default != "" {
+		normalized, err := valueType.Normalize(tagConstraint.Default)
+		if err == nil && normalized != tagConstraint.Default {
+			err = fmt.Errorf("'%v' should be written '%v'", tagConstraint.Default, normalized)
+		}
+		if err != nil {
+			return fmt.Errorf("tag '%v' has default value '%v' which is not valid for type '%v': %w", tag.Name, tagConstraint.Default, valueType, err)
+		}
+	}
+
+	return database.UpdateTagType(tx.tx, tag.Id, valueType)
+}
+
+// Checks that a value may be applied with the specified tag, returning the value name in the form the tag's type stores it.
+// Where no value is given the tag's default value, if any, is returned.
+func (storage *Storage) TagValueName(tx *Tx, tag entities.Tag, valueName string) (string, error) {
+	tagConstraint, err := database.TagConstraint(tx.tx, tag.Id)
+	if err != nil {
+		return "", err
+	}
+
+	if valueName == "" && tagConstraint != nil {
+		valueName = tagConstraint.Default
+	}
+
+	if valueName == "" {
+		return valueName, nil
+	}
+
+	valueType, err := database.TagType(tx.tx, tag.Id)
+	if err != nil {
+		return "", err
+	}
+
+	normalized, err := valueType.Normalize(valueName)
+	if err != nil {
+		return "", fmt.Errorf("invalid value '%v' for %v tag '%v': %w", valueName, valueType, tag.Name, err)
+	}
+
+	if tagConstraint != nil && !tagConstraint.Allows(normalized) {
+		return "", fmt.Errorf("invalid value '%v' for tag '%v': must match '%v'", normalized, tag.Name, tagConstraint.Pattern)
+	}
+
+	return normalized, nil
+}
+
+// Annotates the comparisons in the specified query expression with the value types of the tags they compare,
+// converting the compared values to the form in which the tags store them.
+func (storage *Storage) ResolveValueTypes(tx *Tx, expression query.Expression, ignoreCase bool) (query.Expression, error) {
+	tagTypes, err := storage.TagTypes(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tagTypes) == 0 {
+		return expression, nil
+	}
+
+	valueTypesByTagName := make(map[string]entities.ValueType, len(tagTypes))
+	for _, tagType := range tagTypes {
+		valueTypesByTagName[aliasKey(tagType.Tag.Name, ignoreCase)] = tagType.Type
+	}
+
+	return query.MapComparisons(expression, func(comparison query.ComparisonExpression) (query.ComparisonExpression, error) {
+		valueType, ok := valueTypesByTagName[aliasKey(comparison.Tag.Name, ignoreCase)]
+		if !ok {
+			return comparison, nil
+		}
+
+		valueName, err := valueType.Normalize(comparison.Value.Name)
+		if err != nil {
+			return comparison, fmt.Errorf("invalid value '%v' for %v tag '%v': %w", comparison.Value.Name, valueType, comparison.Tag.Name, err)
+		}
+
+		comparison.Value = query.ValueExpression{Name: valueName, Type: string(valueType)}
+
+		return comparison, nil
+	})
+}
@@ -74,6 +74,12 @@ func (storage *Storage) ValuesByTag(tx *Tx, tagId entities.TagId) (entities.Valu
 	return database.ValuesByTagId(tx.tx, tagId)
 }
 
+// Retrieves the names of the values beginning with the specified prefix that
+// are applied with the tag of the specified name or alias.
+func (storage *Storage) ValueNamesByTagName(tx *Tx, tagName, prefix string) ([]string, error) {
+	return database.ValueNamesByTagName(tx.tx, tagName, prefix)
+}
+
 // Adds a value.
 func (storage *Storage) AddValue(tx *Tx, name string) (*entities.Value, error) {
 	if err := entities.ValidateValueName(name); err != nil {
@@ -89,6 +95,15 @@ func (storage *Storage) RenameValue(tx *Tx, valueId entities.ValueId, newName st
 		return nil, err
 	}
 
+	fileTags, err := database.FileTagsByValueId(tx.tx, valueId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.noteSidecars(tx, fileTags.FileIds()...); err != nil {
+		return nil, err
+	}
+
 	return database.RenameValue(tx.tx, valueId, newName)
 }
 
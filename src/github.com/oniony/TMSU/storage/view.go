@@ -0,0 +1,102 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/query"
+	"github.com/oniony/TMSU/storage/database"
+)
+
+// Retrieves the complete set of views.
+func (storage *Storage) Views(tx *Tx) (entities.Views, error) {
+	return database.Views(tx.tx)
+}
+
+// Retrieves a specific view.
+func (storage *Storage) ViewByName(tx *Tx, name string) (*entities.View, error) {
+	return database.ViewByName(tx.tx, name)
+}
+
+// Adds a view that saves the query under the specified name. The query may refer
+// only to existing views and not, directly or through them, to the view itself.
+func (storage *Storage) AddView(tx *Tx, name, queryText string) (*entities.View, error) {
+	if err := entities.ValidateViewName(name); err != nil {
+		return nil, err
+	}
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query: %w", err)
+	}
+
+	if _, err := query.ExpandViews(expression, viewQueryLookup(tx, name, queryText)); err != nil {
+		return nil, err
+	}
+
+	view, err := database.ViewByName(tx.tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if view != nil {
+		return nil, fmt.Errorf("a view named '%v' already exists", name)
+	}
+
+	return database.InsertView(tx.tx, name, queryText)
+}
+
+// Deletes a view.
+func (storage *Storage) DeleteView(tx *Tx, name string) error {
+	return database.DeleteView(tx.tx, name)
+}
+
+// Expands the references to views within the query to the views' queries. A
+// reference to a view that does not exist is left as a tag name if there is a tag
+// of that name and is otherwise reported as an unknown view.
+func (storage *Storage) ExpandViews(tx *Tx, expression query.Expression) (query.Expression, error) {
+	return query.ExpandViews(expression, viewQueryLookup(tx, "", ""))
+}
+
+// unexported
+
+// looks up the query of a view, taking the named view, if any, to have the query
+// specified as it is being added
+func viewQueryLookup(tx *Tx, name, queryText string) func(string) (string, bool, error) {
+	return func(viewName string) (string, bool, error) {
+		if name != "" && viewName == name {
+			return queryText, true, nil
+		}
+
+		view, err := database.ViewByName(tx.tx, viewName)
+		if err != nil {
+			return "", false, err
+		}
+		if view != nil {
+			return view.Query, true, nil
+		}
+
+		tag, err := database.TagByName(tx.tx, query.ViewPrefix+viewName, false)
+		if err != nil {
+			return "", false, err
+		}
+		if tag == nil {
+			return "", false, database.NoSuchViewError{viewName}
+		}
+
+		return "", false, nil
+	}
+}
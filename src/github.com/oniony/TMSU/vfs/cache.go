@@ -0,0 +1,154 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"os"
+	"sync"
+	"time"
+)
+
+// how long ago the database must have last changed for its results to be cached,
+// as a change made within the same tick of the file system's clock as an earlier
+// one would otherwise go unnoticed
+const cacheSettleTime = time.Second
+
+// the most results the cache holds before it is emptied
+const cacheCapacity = 10000
+
+// the state of the database's files, by which changes to it are detected
+type databaseState struct {
+	modTime    time.Time
+	size       int64
+	walModTime time.Time
+	walSize    int64
+}
+
+// the state of the database's files, or false if it is not held in a local file
+func statDatabase(dbPath string) (databaseState, bool) {
+	fileInfo, err := os.Stat(dbPath)
+	if err != nil {
+		return databaseState{}, false
+	}
+
+	state := databaseState{modTime: fileInfo.ModTime(), size: fileInfo.Size()}
+
+	// changes are written to the write-ahead log before the database itself
+	if walInfo, err := os.Stat(dbPath + "-wal"); err == nil {
+		state.walModTime = walInfo.ModTime()
+		state.walSize = walInfo.Size()
+	}
+
+	return state, true
+}
+
+func (state databaseState) equals(other databaseState) bool {
+	return state.modTime.Equal(other.modTime) && state.size == other.size &&
+		state.walModTime.Equal(other.walModTime) && state.walSize == other.walSize
+}
+
+func (state databaseState) settled() bool {
+	latest := state.modTime
+	if state.walModTime.After(latest) {
+		latest = state.walModTime
+	}
+
+	return time.Since(latest) > cacheSettleTime
+}
+
+type cachedResult struct {
+	value  interface{}
+	status fuse.Status
+}
+
+// the results of look-ups against the database, such as directory listings and
+// attributes, so that a file manager repeatedly listing the same directories does
+// not query the database each time. The results are discarded whenever the
+// database's files change or the virtual filesystem itself changes the database.
+type resultCache struct {
+	sync.Mutex
+	dbPath     string
+	state      databaseState
+	generation uint
+	results    map[string]cachedResult
+}
+
+func newResultCache(dbPath string) *resultCache {
+	return &resultCache{dbPath: dbPath, results: make(map[string]cachedResult)}
+}
+
+// the result cached under the key, or else that retrieved, which is cached if
+// keep permits it and the database has not changed whilst it was retrieved
+func (cache *resultCache) get(key string, retrieve func() (interface{}, fuse.Status), keep func(interface{}, fuse.Status) bool) (interface{}, fuse.Status) {
+	state, ok := statDatabase(cache.dbPath)
+	if !ok || !state.settled() {
+		return retrieve()
+	}
+
+	cache.Lock()
+	if !state.equals(cache.state) {
+		cache.state = state
+		cache.discard()
+	}
+	if result, ok := cache.results[key]; ok {
+		cache.Unlock()
+		return result.value, result.status
+	}
+	generation := cache.generation
+	cache.Unlock()
+
+	value, status := retrieve()
+	if !keep(value, status) {
+		return value, status
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.generation != generation {
+		return value, status
+	}
+	if current, ok := statDatabase(cache.dbPath); !ok || !current.equals(state) {
+		return value, status
+	}
+
+	if len(cache.results) >= cacheCapacity {
+		cache.results = make(map[string]cachedResult)
+	}
+	cache.results[key] = cachedResult{value, status}
+
+	return value, status
+}
+
+// discards the cached results, as when the virtual filesystem changes the database
+func (cache *resultCache) clear() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.discard()
+}
+
+func (cache *resultCache) discard() {
+	cache.results = make(map[string]cachedResult)
+	cache.generation++
+}
+
+func keepAny(value interface{}, status fuse.Status) bool {
+	return true
+}
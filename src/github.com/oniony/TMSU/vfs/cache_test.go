@@ -0,0 +1,98 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheDiscardsResultsWhenDatabaseChanges(test *testing.T) {
+	// set-up
+
+	dir, err := ioutil.TempDir("", "tmsu-cache")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+	settleDatabase(dbPath, "a", test)
+
+	cache := newResultCache(dbPath)
+	retrievals := 0
+	retrieve := func() (interface{}, fuse.Status) {
+		retrievals++
+		return retrievals, fuse.OK
+	}
+
+	// test
+
+	assertCachedResult(cache, retrieve, 1, test)
+	assertCachedResult(cache, retrieve, 1, test)
+
+	settleDatabase(dbPath, "ab", test)
+	assertCachedResult(cache, retrieve, 2, test)
+	assertCachedResult(cache, retrieve, 2, test)
+
+	cache.clear()
+	assertCachedResult(cache, retrieve, 3, test)
+
+	// an unsettled database is not cached
+	if err := ioutil.WriteFile(dbPath, []byte("abc"), 0600); err != nil {
+		test.Fatal(err)
+	}
+	assertCachedResult(cache, retrieve, 4, test)
+	assertCachedResult(cache, retrieve, 5, test)
+}
+
+func TestCacheIsBypassedWithoutDatabaseFile(test *testing.T) {
+	cache := newResultCache("postgres://localhost/tmsu")
+	retrievals := 0
+	retrieve := func() (interface{}, fuse.Status) {
+		retrievals++
+		return retrievals, fuse.OK
+	}
+
+	assertCachedResult(cache, retrieve, 1, test)
+	assertCachedResult(cache, retrieve, 2, test)
+}
+
+// unexported
+
+func settleDatabase(dbPath, content string, test *testing.T) {
+	if err := ioutil.WriteFile(dbPath, []byte(content), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(dbPath, past, past); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func assertCachedResult(cache *resultCache, retrieve func() (interface{}, fuse.Status), expected int, test *testing.T) {
+	value, status := cache.get("key", retrieve, keepAny)
+	if status != fuse.OK || value.(int) != expected {
+		test.Fatalf("Expected result %v but was %v (%v)", expected, value, status)
+	}
+}
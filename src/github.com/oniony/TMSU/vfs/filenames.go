@@ -0,0 +1,181 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/entities"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The template file symlinks are named with unless the 'vfsFileNameTemplate'
+// setting specifies otherwise.
+const DefaultFileNameTemplate = "{name}.{id}.{ext}"
+
+// the longest name most filesystems will permit
+const maxFileNameLength = 255
+
+// A template for the names of the file symlinks in the virtual filesystem.
+//
+// The placeholders {name}, {ext} and {id} are substituted with the file name
+// less its extension, the extension and the file ID respectively. Any other
+// placeholder is substituted with the file's value for the tag of that name.
+type FileNameTemplate struct {
+	text  string
+	parts []templatePart
+}
+
+type templatePart struct {
+	text        string
+	placeholder bool
+}
+
+func ParseFileNameTemplate(text string) (*FileNameTemplate, error) {
+	if text == "" {
+		return nil, fmt.Errorf("file name template must not be empty")
+	}
+	if strings.ContainsAny(text, `/\`) {
+		return nil, fmt.Errorf("invalid file name template '%v': must not contain slashes", text)
+	}
+
+	parts := make([]templatePart, 0, 5)
+	for remaining := text; remaining != ""; {
+		start := strings.IndexAny(remaining, "{}")
+		if start == -1 {
+			parts = append(parts, templatePart{remaining, false})
+			break
+		}
+		if remaining[start] == '}' {
+			return nil, fmt.Errorf("invalid file name template '%v': unexpected '}'", text)
+		}
+		if start > 0 {
+			parts = append(parts, templatePart{remaining[:start], false})
+		}
+
+		end := strings.IndexAny(remaining[start+1:], "{}")
+		if end == -1 || remaining[start+1+end] == '{' {
+			return nil, fmt.Errorf("invalid file name template '%v': unterminated placeholder", text)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("invalid file name template '%v': empty placeholder", text)
+		}
+
+		parts = append(parts, templatePart{remaining[start+1 : start+1+end], true})
+		remaining = remaining[start+end+2:]
+	}
+
+	return &FileNameTemplate{text, parts}, nil
+}
+
+func (template FileNameTemplate) String() string {
+	return template.text
+}
+
+// Whether this is the default template, the names from which can be parsed for the file ID.
+func (template FileNameTemplate) IsDefault() bool {
+	return template.text == DefaultFileNameTemplate
+}
+
+// The names of the tags whose values the template includes.
+func (template FileNameTemplate) TagNames() []string {
+	tagNames := make([]string, 0, len(template.parts))
+	seen := make(map[string]bool, len(template.parts))
+	for _, part := range template.parts {
+		if part.placeholder && !isFilePlaceholder(part.text) && !seen[part.text] {
+			tagNames = append(tagNames, part.text)
+			seen[part.text] = true
+		}
+	}
+
+	return tagNames
+}
+
+// Renders the symlink name for a file, with the specified tag values.
+//
+// The separator before an {ext} placeholder is dropped for files without an
+// extension and the file name part is shortened should the name be too long.
+func (template FileNameTemplate) Render(path string, fileId entities.FileId, values map[string]string) string {
+	extension := filepath.Ext(path)
+	fileName := filepath.Base(path)
+	baseName := fileName[0 : len(fileName)-len(extension)]
+	if extension != "" {
+		extension = extension[1:]
+	}
+
+	pieces := make([]string, 0, len(template.parts))
+	nameIndices := make([]int, 0, 1)
+	length := 0
+	for _, part := range template.parts {
+		piece := part.text
+
+		if part.placeholder {
+			switch part.text {
+			case "name":
+				piece = baseName
+				nameIndices = append(nameIndices, len(pieces))
+			case "ext":
+				piece = extension
+				if piece == "" && len(pieces) > 0 {
+					previous := pieces[len(pieces)-1]
+					if strings.HasSuffix(previous, ".") {
+						pieces[len(pieces)-1] = previous[:len(previous)-1]
+						length--
+					}
+				}
+			case "id":
+				piece = strconv.FormatUint(uint64(fileId), 10)
+			default:
+				piece = values[part.text]
+			}
+		}
+
+		pieces = append(pieces, piece)
+		length += len(piece)
+	}
+
+	for index := len(nameIndices) - 1; index >= 0 && length > maxFileNameLength; index-- {
+		piece := pieces[nameIndices[index]]
+		excess := length - maxFileNameLength
+		if excess > len(piece) {
+			excess = len(piece)
+		}
+
+		pieces[nameIndices[index]] = piece[:len(piece)-excess]
+		length -= excess
+	}
+
+	name := strings.Join(pieces, "")
+	if len(name) > maxFileNameLength {
+		name = name[:maxFileNameLength]
+	}
+
+	return name
+}
+
+// unexported
+
+func isFilePlaceholder(name string) bool {
+	switch name {
+	case "name", "ext", "id":
+		return true
+	}
+
+	return false
+}
+
+var defaultFileNameTemplate, _ = ParseFileNameTemplate(DefaultFileNameTemplate)
@@ -0,0 +1,73 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDefaultTemplate(test *testing.T) {
+	template, err := ParseFileNameTemplate(DefaultFileNameTemplate)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	assertRender(template, "/some/photo.jpg", nil, "photo.12.jpg", test)
+	assertRender(template, "/some/README", nil, "README.12", test)
+}
+
+func TestRenderTemplateWithValues(test *testing.T) {
+	template, err := ParseFileNameTemplate("{year}-{name}.{ext}")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if tagNames := template.TagNames(); len(tagNames) != 1 || tagNames[0] != "year" {
+		test.Fatalf("Expected tag names [year] but were %v", tagNames)
+	}
+
+	assertRender(template, "/some/photo.jpg", map[string]string{"year": "2019"}, "2019-photo.jpg", test)
+	assertRender(template, "/some/photo.jpg", nil, "-photo.jpg", test)
+}
+
+func TestRenderLongName(test *testing.T) {
+	template, err := ParseFileNameTemplate(DefaultFileNameTemplate)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	name := template.Render("/some/"+strings.Repeat("a", 300)+".txt", 12, nil)
+	if len(name) != maxFileNameLength || !strings.HasSuffix(name, "a.12.txt") {
+		test.Fatalf("Expected name to be truncated to %v characters but was '%v'", maxFileNameLength, name)
+	}
+}
+
+func TestParseInvalidTemplate(test *testing.T) {
+	for _, text := range []string{"", "{name", "name}", "{}", "{na{me}", "{year}/{name}"} {
+		if _, err := ParseFileNameTemplate(text); err == nil {
+			test.Fatalf("Expected '%v' not to parse as a file name template", text)
+		}
+	}
+}
+
+// unexported
+
+func assertRender(template *FileNameTemplate, path string, values map[string]string, expected string, test *testing.T) {
+	if name := template.Render(path, 12, values); name != expected {
+		test.Fatalf("Expected '%v' but was '%v'", expected, name)
+	}
+}
@@ -22,14 +22,21 @@ import (
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
 	"github.com/hanwen/go-fuse/fuse/pathfs"
+	"github.com/oniony/TMSU/common/fingerprint"
 	"github.com/oniony/TMSU/common/log"
+	"github.com/oniony/TMSU/common/mimetype"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/common/trash"
 	"github.com/oniony/TMSU/entities"
 	"github.com/oniony/TMSU/query"
 	"github.com/oniony/TMSU/storage"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -58,56 +65,124 @@ The tags directory also allows some operations to be performed:
 
   * Create a tag by creating a new directory
   * Rename a tag by renaming the tag directory
+  * Tag a file by creating a symlink to it in a tag directory
+  * Retag a file by moving its symlink from one tag directory to another
   * Untag a file by deleting the file symlink from the tag directory
   * Delete an unused tag by deleting the directory
 
+If the filesystem was mounted with '--delete-policy=trash' or
+'--delete-policy=delete' then deleting a file symlink instead removes the file
+from the database and moves the file itself to the trash or deletes it.
+
+The file symlinks expose the file's tags as the extended attribute
+'user.tmsu.tags' and the values of each tag as 'user.tmsu.tag.TAG'. Writing
+these attributes retags the file and removing them untags it. (Linux only
+permits the names of extended attributes to be listed on symlinks.)
+
+Files are named according to the 'vfsFileNameTemplate' setting, for example:
+
+    $ tmsu config vfsFileNameTemplate='{year}-{name}.{ext}'
+
 (This file will hide once you have created a few tags.)`
 
 const queriesDir = "queries"
 const queryDirHelp = `Query Directories
 -----------------
 
-Change to any directory that is a valid query to see a view of the files that
-match the query. (It is not necessary to create the directory first.)
+Create a directory named after a query to see a view of the files that match
+the query. Queries may use parentheses and comparison operators:
 
     $ ls
     README.md
+    $ mkdir "cheese and wine" "cheese and (tomato or mushroom)" "year >= 2017"
     $ ls "cheese and wine"
     pinot_cheddar.12  edam_blanc.14
     $ ls "cheese and (tomato or mushroom)"
     margherita.7  funghi.11
-    $ ls
-    cheese and (tomato or mushroom)  cheese and wine
 
-You can even create new queries by typing the query into the file chooser of a
-graphical program.
+You can also create new queries with the 'New Folder' action of a graphical file
+manager. Queries that are run frequently with 'tmsu files' are added here
+automatically.
+
+A directory name cannot contain a slash so, within the name of a query
+directory, a slash is written %2F, a backslash %5C and a percent sign %25:
+
+    $ mkdir "url = http:%2F%2Fexample.org"
 
 Use ` + "`rmdir`" + ` to remove any query directory you no longer need. Do not use ` + "`rm -r`" + `
-as this will untag the contained files.
+as, if the filesystem was mounted with a 'trash' or 'delete' delete policy, this
+will trash or delete the files themselves.
+
+If the filesystem was mounted with '--previews' then each query directory also
+holds a '.previews' directory of thumbnails of the images and videos within it,
+for file managers to show as a gallery:
+
+    $ ls "holiday and photo/.previews"
+    beach.21.jpg.jpg  harbour.22.jpg.jpg
 
 (This file will hide once you have created a query.)`
 
+const viewsDir = "views"
+const viewsDirHelp = `View Directories
+----------------
+
+Views are queries saved with the 'tmsu view' subcommand. Each view appears here
+as a directory containing the files that currently match its query:
+
+    $ tmsu view add recent-photos "photo and year=2024"
+    $ ls
+    recent-photos
+    $ ls recent-photos
+    beach.21  harbour.22
+
+A view can also be saved from here, such as by a file manager, by creating a
+symbolic link named after the view whose target is the query. Once created it
+appears as a directory like any other view:
+
+    $ ln -s "holiday and video" holiday-videos
+    $ ls holiday-videos
+    beach.mp4.23
+
+Use ` + "`rmdir`" + ` to delete a view you no longer need.
+
+(This file will hide once you have created a view.)`
+
+const favoritesDir = "favorites"
+const untaggedDir = "untagged"
+const recentDir = "recent"
+const inboxDir = "inbox"
+
 type FuseVfs struct {
 	store     *storage.Storage
 	mountPath string
 	server    *fuse.Server
+	links     *createdLinks
+	names     *listedNames
+	cache     *resultCache
+	policy    trash.Policy
+	previews  *previewer // nil unless previews are enabled
+	inbox     bool       // whether files linked into the inbox directory are added
 }
 
-func MountVfs(store *storage.Storage, mountPath string, options []string) (*FuseVfs, error) {
-	fuseVfs := FuseVfs{nil, "", nil}
+func MountVfs(store *storage.Storage, mountPath string, options []string, deletePolicy trash.Policy, previews, inbox bool) (*FuseVfs, error) {
+	fuseVfs := FuseVfs{nil, "", nil, &createdLinks{links: make(map[string]createdLink)}, &listedNames{dirs: make(map[string]listedDir)}, newResultCache(store.DbPath), deletePolicy, nil, inbox}
+	if previews {
+		fuseVfs.previews = newPreviewer(store.DbPath)
+	}
 
 	pathFs := pathfs.NewPathNodeFs(&fuseVfs, nil)
 	conn := nodefs.NewFileSystemConnector(pathFs.Root(), nil)
-	mountOptions := &fuse.MountOptions{Options: options}
 
-	server, err := fuse.NewServer(conn.RawFS(), mountPath, mountOptions)
+	absMountPath, err := filepath.Abs(mountPath)
 	if err != nil {
-		return nil, fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err)
+		return nil, fmt.Errorf("could not convert mount path '%v' to absolute: %v", mountPath, err)
 	}
 
-	absMountPath, err := filepath.Abs(mountPath)
+	mountOptions := &fuse.MountOptions{Options: platformMountOptions(absMountPath, options)}
+
+	server, err := fuse.NewServer(conn.RawFS(), mountPath, mountOptions)
 	if err != nil {
-		return nil, fmt.Errorf("could not convert mount path '%v' to absolute: %v", mountPath, err)
+		return nil, fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err)
 	}
 
 	fuseVfs.store = store
@@ -161,24 +236,79 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 	log.Infof(2, "BEGIN GetAttr(%v)", name)
 	defer log.Infof(2, "END GetAttr(%v)", name)
 
-	switch name {
-	case databaseFilename:
+	if isPlatformMetadata(filepath.Base(name)) {
+		return nil, fuse.ENOENT
+	}
+
+	if name == databaseFilename {
 		return vfs.getDatabaseFileAttr()
+	}
+
+	// the attributes of file symlinks are those of the files themselves so are
+	// not cached
+	value, status := vfs.cache.get("attr\000"+name, func() (interface{}, fuse.Status) {
+		return vfs.getAttr(name)
+	}, func(value interface{}, status fuse.Status) bool {
+		return status != fuse.OK || value.(*fuse.Attr).IsDir()
+	})
+
+	attr := value.(*fuse.Attr)
+	if attr == nil {
+		return nil, status
+	}
+
+	// the attributes are amended by the caller
+	copied := *attr
+	return &copied, status
+}
+
+func (vfs FuseVfs) getAttr(name string) (*fuse.Attr, fuse.Status) {
+	switch name {
 	case "":
 		fallthrough
 	case tagsDir:
 		return vfs.getTagsAttr()
 	case queriesDir:
 		return vfs.getQueryAttr()
+	case viewsDir:
+		return vfs.getViewsAttr()
+	case favoritesDir, untaggedDir, recentDir:
+		return vfs.getFileListAttr()
+	case inboxDir:
+		if vfs.inbox {
+			return vfs.getFileListAttr()
+		}
 	}
 
 	path := vfs.splitPath(name)
 
 	switch path[0] {
 	case tagsDir:
+		if fileId := vfs.links.fileId(name); fileId != 0 {
+			return vfs.getFileEntryAttr(fileId)
+		}
+
 		return vfs.getTaggedEntryAttr(path[1:])
 	case queriesDir:
 		return vfs.getQueryEntryAttr(path[1:])
+	case viewsDir:
+		if queryText := vfs.links.target(name); queryText != "" {
+			now := time.Now()
+			return &fuse.Attr{Mode: fuse.S_IFLNK | 0755, Nlink: 1, Size: uint64(len(queryText)), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+		}
+
+		return vfs.getViewEntryAttr(path[1:])
+	case favoritesDir, untaggedDir, recentDir:
+		return vfs.getFileListEntryAttr(path)
+	case inboxDir:
+		if !vfs.inbox {
+			break
+		}
+		if fileId := vfs.links.fileId(name); fileId != 0 {
+			return vfs.getFileEntryAttr(fileId)
+		}
+
+		return vfs.getFileListEntryAttr(path)
 	}
 
 	return nil, fuse.ENOENT
@@ -186,9 +316,62 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 
 func (vfs FuseVfs) GetXAttr(name string, attr string, context *fuse.Context) ([]byte, fuse.Status) {
 	log.Infof(2, "BEGIN GetXAttr(%v, %v)", name, attr)
-	defer log.Infof(2, "END GetAttr(%v, %v)", name, attr)
+	defer log.Infof(2, "END GetXAttr(%v, %v)", name, attr)
 
-	return nil, fuse.ENOSYS
+	value, status := vfs.cache.get("xattr\000"+name+"\000"+attr, func() (interface{}, fuse.Status) {
+		return vfs.getXAttr(name, attr)
+	}, keepAny)
+
+	return append([]byte(nil), value.([]byte)...), status
+}
+
+func (vfs FuseVfs) getXAttr(name string, attr string) ([]byte, fuse.Status) {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	if tagInfo := vfs.xattrTagInfo(tx, name); tagInfo != nil {
+		if value := tagInfoXAttrs(*tagInfo)[attr]; value != "" {
+			return []byte(value), fuse.OK
+		}
+
+		return nil, fuse.ENOATTR
+	}
+
+	fileId := vfs.xattrFileId(tx, name)
+	if fileId == 0 {
+		return nil, fuse.ENOATTR
+	}
+
+	fileTags := vfs.xattrTagsForFile(tx, fileId)
+
+	if attr == tagsXAttr {
+		tagArgs := make([]string, len(fileTags))
+		for index, fileTag := range fileTags {
+			tagArgs[index] = formatXAttrTag(fileTag.tagName, fileTag.valueName)
+		}
+
+		return []byte(strings.Join(tagArgs, " ")), fuse.OK
+	}
+
+	if strings.HasPrefix(attr, tagXAttrPrefix) {
+		tagName := attr[len(tagXAttrPrefix):]
+
+		valueNames := make([]string, 0, 1)
+		for _, fileTag := range fileTags {
+			if fileTag.tagName == tagName && fileTag.valueName != "" {
+				valueNames = append(valueNames, escapeXAttrText(fileTag.valueName))
+			}
+		}
+
+		if len(valueNames) > 0 || fileTags.contain(tagName) {
+			return []byte(strings.Join(valueNames, " ")), fuse.OK
+		}
+	}
+
+	return nil, fuse.ENOATTR
 }
 
 func (vfs FuseVfs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
@@ -202,12 +385,57 @@ func (vfs FuseVfs) ListXAttr(name string, context *fuse.Context) ([]string, fuse
 	log.Infof(2, "BEGIN ListXAttr(%v)", name)
 	defer log.Infof(2, "END ListXAttr(%v)", name)
 
-	return nil, fuse.ENOSYS
+	value, status := vfs.cache.get("xattrs\000"+name, func() (interface{}, fuse.Status) {
+		return vfs.listXAttr(name)
+	}, keepAny)
+
+	attrs := value.([]string)
+	if attrs == nil {
+		return nil, status
+	}
+
+	return append([]string{}, attrs...), status
+}
+
+func (vfs FuseVfs) listXAttr(name string) ([]string, fuse.Status) {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	if tagInfo := vfs.xattrTagInfo(tx, name); tagInfo != nil {
+		attrs := make([]string, 0, 3)
+		for attr, value := range tagInfoXAttrs(*tagInfo) {
+			if value != "" {
+				attrs = append(attrs, attr)
+			}
+		}
+		sort.Strings(attrs)
+
+		return attrs, fuse.OK
+	}
+
+	fileId := vfs.xattrFileId(tx, name)
+	if fileId == 0 {
+		return []string{}, fuse.OK
+	}
+
+	attrs := []string{tagsXAttr}
+	for _, fileTag := range vfs.xattrTagsForFile(tx, fileId) {
+		attr := tagXAttrPrefix + fileTag.tagName
+		if !containsString(attrs, attr) {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	return attrs, fuse.OK
 }
 
 func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Mkdir(%v)", name)
 	defer log.Infof(2, "END Mkdir(%v)", name)
+	defer vfs.cache.clear()
 
 	path := vfs.splitPath(name)
 
@@ -235,6 +463,30 @@ func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 
 		return fuse.OK
 	case queriesDir:
+		queryText := decodeQueryName(path[1])
+
+		if status := vfs.checkQuery(tx, queryText); status != fuse.OK {
+			return status
+		}
+
+		q, err := vfs.store.Query(tx, queryText)
+		if err != nil {
+			log.Fatalf("could not retrieve query '%v': %v", queryText, err)
+		}
+		if q != nil {
+			return fuse.Status(syscall.EEXIST)
+		}
+
+		if _, err := vfs.store.AddQuery(tx, queryText); err != nil {
+			log.Fatalf("could not add query '%v': %v", queryText, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Fatalf("could not commit transaction: %v", err)
+		}
+
+		return fuse.OK
+	case viewsDir:
 		return fuse.EINVAL
 	}
 
@@ -267,6 +519,12 @@ func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodef
 		return nodefs.NewDataFile([]byte(queryDirHelp)), fuse.OK
 	case filepath.Join(tagsDir, helpFilename):
 		return nodefs.NewDataFile([]byte(tagsDirHelp)), fuse.OK
+	case filepath.Join(viewsDir, helpFilename):
+		return nodefs.NewDataFile([]byte(viewsDirHelp)), fuse.OK
+	}
+
+	if path := vfs.splitPath(name); vfs.isPreviewPath(path) {
+		return vfs.openPreview(path)
 	}
 
 	return nil, fuse.ENOSYS
@@ -276,31 +534,40 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 	log.Infof(2, "BEGIN OpenDir(%v)", name)
 	defer log.Infof(2, "END OpenDir(%v)", name)
 
+	value, status := vfs.cache.get("dir\000"+name, func() (interface{}, fuse.Status) {
+		return vfs.listDir(name)
+	}, keepAny)
+
+	entries := value.([]fuse.DirEntry)
+	if entries == nil {
+		return nil, status
+	}
+
+	return append([]fuse.DirEntry{}, entries...), status
+}
+
+func (vfs FuseVfs) listDir(name string) ([]fuse.DirEntry, fuse.Status) {
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
 	defer tx.Commit()
 
-	switch name {
-	case "":
-		return vfs.topFiles()
-	case tagsDir:
-		return vfs.tagDirectories(tx)
-	case queriesDir:
-		return vfs.queriesDirectories(tx)
+	entries, status := vfs.openDir(tx, name)
+	if status != fuse.OK {
+		return nil, status
 	}
 
-	path := vfs.splitPath(name)
-
-	switch path[0] {
-	case tagsDir:
-		return vfs.openTaggedEntryDir(tx, path[1:])
-	case queriesDir:
-		return vfs.openQueryEntryDir(tx, path[1:])
+	// files named like the platform's own metadata are hidden as the file
+	// manager would otherwise take them for its own
+	visibleEntries := entries[:0]
+	for _, entry := range entries {
+		if !isPlatformMetadata(entry.Name) {
+			visibleEntries = append(visibleEntries, entry)
+		}
 	}
 
-	return nil, fuse.ENOENT
+	return visibleEntries, fuse.OK
 }
 
 func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
@@ -317,9 +584,13 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 		return vfs.readDatabaseFileLink()
 	}
 
+	if queryText := vfs.links.target(name); queryText != "" {
+		return queryText, fuse.OK
+	}
+
 	path := vfs.splitPath(name)
 	switch path[0] {
-	case tagsDir, queriesDir:
+	case tagsDir, queriesDir, viewsDir, favoritesDir, untaggedDir, recentDir, inboxDir:
 		return vfs.readTaggedEntryLink(tx, path)
 	}
 
@@ -329,13 +600,49 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 func (vfs FuseVfs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN RemoveXAttr(%v, %v)", name, attr)
 	defer log.Infof(2, "END RemoveXAttr(%v, %v)", name, attr)
+	defer vfs.cache.clear()
 
-	return fuse.ENOSYS
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	fileId := vfs.xattrFileId(tx, name)
+	if fileId == 0 {
+		return fuse.ENOATTR
+	}
+
+	fileTags := vfs.xattrTagsForFile(tx, fileId)
+
+	var removed xattrTags
+	switch {
+	case attr == tagsXAttr:
+		removed = fileTags
+	case strings.HasPrefix(attr, tagXAttrPrefix):
+		removed = fileTags.withTagName(attr[len(tagXAttrPrefix):])
+	}
+	if len(removed) == 0 {
+		return fuse.ENOATTR
+	}
+
+	for _, fileTag := range removed {
+		if err := vfs.store.DeleteFileTag(tx, fileId, fileTag.pair.TagId, fileTag.pair.ValueId); err != nil {
+			log.Fatalf("could not untag file #%v: %v", fileId, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
+
+	return fuse.OK
 }
 
 func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Rename(%v, %v)", oldName, newName)
 	defer log.Infof(2, "END Rename(%v, %v)", oldName, newName)
+	defer vfs.cache.clear()
 
 	tx, err := vfs.store.Begin()
 	if err != nil {
@@ -346,6 +653,10 @@ func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context)
 	oldPath := vfs.splitPath(oldName)
 	newPath := vfs.splitPath(newName)
 
+	if fileId := vfs.linkFileId(tx, oldPath); fileId != 0 && len(oldPath) > 2 {
+		return vfs.moveTaggedEntry(tx, fileId, oldPath, newPath)
+	}
+
 	if len(oldPath) != 2 || len(newPath) != 2 {
 		return fuse.EPERM
 	}
@@ -379,6 +690,7 @@ func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context)
 func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Rmdir(%v)", name)
 	defer log.Infof(2, "END Rmdir(%v)", name)
+	defer vfs.cache.clear()
 
 	tx, err := vfs.store.Begin()
 	if err != nil {
@@ -427,7 +739,15 @@ func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 			return fuse.EPERM
 		}
 
-		text := path[1]
+		text := decodeQueryName(path[1])
+
+		q, err := vfs.store.Query(tx, text)
+		if err != nil {
+			log.Fatalf("could not retrieve query '%v': %v", text, err)
+		}
+		if q == nil {
+			return fuse.ENOENT
+		}
 
 		if err := vfs.store.DeleteQuery(tx, text); err != nil {
 			log.Fatalf("could not remove tag '%v': %v", name, err)
@@ -438,6 +758,37 @@ func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 		}
 
 		return fuse.OK
+	case viewsDir:
+		if len(path) != 2 {
+			// can only remove the view directories themselves
+			return fuse.EPERM
+		}
+
+		viewName := unescape(path[1])
+
+		view, err := vfs.store.ViewByName(tx, viewName)
+		if err != nil {
+			log.Fatalf("could not retrieve view '%v': %v", viewName, err)
+		}
+		if view == nil {
+			return fuse.ENOENT
+		}
+
+		if err := vfs.store.DeleteView(tx, viewName); err != nil {
+			log.Fatalf("could not delete view '%v': %v", viewName, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Fatalf("could not commit transaction: %v", err)
+		}
+
+		return fuse.OK
+	case favoritesDir:
+		// favorites are the files rated with the 'rate' subcommand
+		return fuse.EPERM
+	case untaggedDir, recentDir, inboxDir:
+		// these list files according to their tags so cannot be removed
+		return fuse.EPERM
 	}
 
 	return fuse.ENOSYS
@@ -446,8 +797,64 @@ func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 func (vfs FuseVfs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN SetXAttr(%v, %v)", name, attr)
 	defer log.Infof(2, "END SetXAttr(%v, %v)", name, attr)
+	defer vfs.cache.clear()
 
-	return fuse.ENOSYS
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	fileId := vfs.xattrFileId(tx, name)
+	if fileId == 0 {
+		return fuse.EPERM
+	}
+
+	fileTags := vfs.xattrTagsForFile(tx, fileId)
+	words := text.Tokenize(string(data))
+
+	// the tags attribute replaces all of the file's tags whilst a tag attribute
+	// replaces just the values of that tag
+	var replaced xattrTags
+	var pairs entities.TagIdValueIdPairs
+	var status fuse.Status
+	switch {
+	case attr == tagsXAttr:
+		replaced = fileTags
+		pairs, status = vfs.xattrTagValuePairs(tx, words, "")
+	case strings.HasPrefix(attr, tagXAttrPrefix):
+		tagName := attr[len(tagXAttrPrefix):]
+		replaced = fileTags.withTagName(tagName)
+		pairs, status = vfs.xattrTagValuePairs(tx, words, tagName)
+	default:
+		return fuse.EPERM
+	}
+	if status != fuse.OK {
+		return status
+	}
+
+	// tags are added before any are removed as files are deleted once untagged
+	for _, pair := range pairs {
+		if !fileTags.containPair(pair) {
+			if _, err := vfs.store.AddFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+				log.Fatalf("could not tag file #%v: %v", fileId, err)
+			}
+		}
+	}
+
+	for _, fileTag := range replaced {
+		if !pairs.Contains(fileTag.pair) {
+			if err := vfs.store.DeleteFileTag(tx, fileId, fileTag.pair.TagId, fileTag.pair.ValueId); err != nil {
+				log.Fatalf("could not untag file #%v: %v", fileId, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
+
+	return fuse.OK
 }
 
 func (vfs FuseVfs) StatFs(name string) *fuse.StatfsOut {
@@ -464,20 +871,25 @@ func (vfs FuseVfs) String() string {
 func (vfs FuseVfs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Symlink(%v, %v)", value, linkName)
 	defer log.Infof(2, "END Symlink(%v, %v)", value, linkName)
+	defer vfs.cache.clear()
 
-	return fuse.ENOSYS
-}
-
-func (vfs FuseVfs) Truncate(name string, offset uint64, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Truncate(%v)", name)
-	defer log.Infof(2, "END Truncate(%v)", name)
-
-	return fuse.ENOSYS
-}
+	path := vfs.splitPath(linkName)
+	if path[0] == viewsDir {
+		return vfs.addViewLink(value, linkName, path[1:])
+	}
+	if !(path[0] == tagsDir && len(path) >= 3) && !(path[0] == inboxDir && vfs.inbox && len(path) == 2) {
+		// can only tag files by linking them into tag directories or the inbox
+		return fuse.EPERM
+	}
 
-func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
-	log.Infof(2, "BEGIN Unlink(%v)", name)
-	defer log.Infof(2, "END Unlink(%v)", name)
+	targetPath := value
+	if !filepath.IsAbs(targetPath) {
+		targetPath = filepath.Join(vfs.mountPath, filepath.Join(path[:len(path)-1]...), targetPath)
+	}
+	if targetPath == vfs.mountPath || strings.HasPrefix(targetPath, vfs.mountPath+string(filepath.Separator)) {
+		// links to the virtual filesystem itself cannot be tagged
+		return fuse.EPERM
+	}
 
 	tx, err := vfs.store.Begin()
 	if err != nil {
@@ -485,52 +897,133 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 	}
 	defer tx.Commit()
 
-	fileId := vfs.parseFileId(name)
-	if fileId == 0 {
-		// can only unlink file symbolic links
-		return fuse.EPERM
+	var pairs entities.TagIdValueIdPairs
+	var status fuse.Status
+	if path[0] == inboxDir {
+		pairs, status = vfs.xattrTagValuePairs(tx, vfs.inboxTags(tx), "")
+	} else {
+		pairs, status = vfs.tagValuePairsForPath(tx, entryDirPath(path))
+	}
+	if status != fuse.OK {
+		return status
 	}
 
-	file, err := vfs.store.File(tx, fileId)
-	if err != nil {
-		log.Fatalf("could not retrieve file '%v': %v", fileId, err)
+	file, status := vfs.fileForPath(tx, targetPath)
+	if status != fuse.OK {
+		return status
 	}
-	if file == nil {
-		// reply ok if file doesn't exist otherwise recursive deletes fail
-		return fuse.OK
+
+	for _, pair := range pairs {
+		if _, err := vfs.store.AddFileTag(tx, file.Id, pair.TagId, pair.ValueId); err != nil {
+			log.Fatalf("could not tag file '%v': %v", targetPath, err)
+		}
 	}
-	path := vfs.splitPath(name)
 
-	switch path[0] {
-	case tagsDir:
-		dirName := path[len(path)-2]
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
 
-		var tagName, valueName string
-		if dirName[0] == '=' {
-			tagName = unescape(path[len(path)-3])
-			valueName = unescape(dirName[1:])
-		} else {
-			tagName = unescape(dirName)
-			valueName = ""
-		}
+	vfs.links.add(linkName, file.Id)
 
-		tag, err := vfs.store.TagByName(tx, tagName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if tag == nil {
-			log.Fatalf("could not retrieve tag '%v'.", tagName)
-		}
+	return fuse.OK
+}
 
-		value, err := vfs.store.ValueByName(tx, valueName)
-		if err != nil {
-			log.Fatal(err)
+// saves the query as a view named after the symlink, which is then listed as a
+// directory like any other view
+func (vfs FuseVfs) addViewLink(queryText, linkName string, path []string) fuse.Status {
+	if len(path) != 1 {
+		// views cannot be nested
+		return fuse.EPERM
+	}
+
+	viewName := unescape(path[0])
+	if entities.ValidateViewName(viewName) != nil || strings.TrimSpace(queryText) == "" {
+		return fuse.EINVAL
+	}
+
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	if status := vfs.checkQuery(tx, queryText); status != fuse.OK {
+		return status
+	}
+
+	view, err := vfs.store.ViewByName(tx, viewName)
+	if err != nil {
+		log.Fatalf("could not retrieve view '%v': %v", viewName, err)
+	}
+	if view != nil {
+		return fuse.Status(syscall.EEXIST)
+	}
+
+	if _, err := vfs.store.AddView(tx, viewName, queryText); err != nil {
+		log.Fatalf("could not add view '%v': %v", viewName, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
+
+	// the look-ups that follow the creation of a symlink expect a symlink
+	vfs.links.addTarget(linkName, queryText)
+
+	return fuse.OK
+}
+
+func (vfs FuseVfs) Truncate(name string, offset uint64, context *fuse.Context) fuse.Status {
+	log.Infof(2, "BEGIN Truncate(%v)", name)
+	defer log.Infof(2, "END Truncate(%v)", name)
+
+	return fuse.ENOSYS
+}
+
+func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
+	log.Infof(2, "BEGIN Unlink(%v)", name)
+	defer log.Infof(2, "END Unlink(%v)", name)
+	defer vfs.cache.clear()
+
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	path := vfs.splitPath(name)
+
+	fileId := vfs.linkFileId(tx, path)
+	if fileId == 0 {
+		// can only unlink file symbolic links
+		return fuse.EPERM
+	}
+
+	file, err := vfs.store.File(tx, fileId)
+	if err != nil {
+		log.Fatalf("could not retrieve file '%v': %v", fileId, err)
+	}
+	if file == nil {
+		// reply ok if file doesn't exist otherwise recursive deletes fail
+		return fuse.OK
+	}
+
+	if vfs.policy != trash.UntagOnly {
+		switch path[0] {
+		case tagsDir, queriesDir, viewsDir, favoritesDir, untaggedDir, recentDir, inboxDir:
+			return vfs.deleteFile(tx, file)
 		}
-		if value == nil {
-			log.Fatalf("could not retrieve value '%v'.", valueName)
+	}
+
+	switch path[0] {
+	case tagsDir:
+		pairs, status := vfs.tagValuePairsForPath(tx, entryDirPath(path))
+		if status != fuse.OK {
+			return status
 		}
+		pair := pairs[len(pairs)-1]
 
-		if err = vfs.store.DeleteFileTag(tx, fileId, tag.Id, value.Id); err != nil {
+		if err = vfs.store.DeleteFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
 			log.Fatal(err)
 		}
 
@@ -539,7 +1032,10 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 		}
 
 		return fuse.OK
-	case queriesDir:
+	case inboxDir:
+		// the file is taken out of the inbox by removing the tags it was given
+		return vfs.removeFromInbox(tx, fileId)
+	case queriesDir, viewsDir, favoritesDir, untaggedDir, recentDir:
 		return fuse.EPERM
 	}
 
@@ -552,6 +1048,64 @@ func (vfs FuseVfs) Utimens(name string, Atime *time.Time, Mtime *time.Time, cont
 
 // unexported
 
+// applies the delete policy to the file on disk and then removes the file, and
+// any files beneath it, from the database
+func (vfs FuseVfs) deleteFile(tx *storage.Tx, file *entities.File) fuse.Status {
+	log.Infof(2, "%v: applying '%v' policy", file.Path(), vfs.policy)
+
+	if err := trash.Remove(file.Path(), vfs.policy); err != nil && !os.IsNotExist(err) {
+		log.Warnf("%v: could not delete: %v", file.Path(), err)
+		return fuse.ToStatus(err)
+	}
+
+	files := entities.Files{file}
+	if file.IsDir {
+		dirFiles, err := vfs.store.FilesByDirectory(tx, file.Path())
+		if err != nil {
+			log.Fatalf("could not retrieve files for directory '%v': %v", file.Path(), err)
+		}
+
+		files = append(files, dirFiles...)
+	}
+
+	for _, file := range files {
+		if err := vfs.store.DeleteFileTagsByFileId(tx, file.Id); err != nil {
+			log.Fatalf("could not remove tags for file '%v': %v", file.Path(), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
+
+	return fuse.OK
+}
+
+// adds each of the default mount options unless the same option, or its
+// negation, has been specified
+func addDefaultMountOptions(options []string, defaults ...string) []string {
+	names := make(map[string]bool, len(options))
+	for _, option := range options {
+		names[mountOptionName(option)] = true
+	}
+
+	for _, option := range defaults {
+		if !names[mountOptionName(option)] {
+			options = append(options, option)
+		}
+	}
+
+	return options
+}
+
+func mountOptionName(option string) string {
+	if index := strings.Index(option, "="); index != -1 {
+		option = option[:index]
+	}
+
+	return strings.TrimPrefix(option, "no")
+}
+
 func (vfs FuseVfs) splitPath(path string) []string {
 	return strings.Split(path, string(filepath.Separator))
 }
@@ -577,6 +1131,38 @@ func (vfs FuseVfs) parseFileId(name string) entities.FileId {
 	return entities.FileId(id)
 }
 
+func (vfs FuseVfs) openDir(tx *storage.Tx, name string) ([]fuse.DirEntry, fuse.Status) {
+	switch name {
+	case "":
+		return vfs.topFiles()
+	case tagsDir:
+		return vfs.tagDirectories(tx)
+	case queriesDir:
+		return vfs.queriesDirectories(tx)
+	case viewsDir:
+		return vfs.viewDirectories(tx)
+	case favoritesDir, untaggedDir, recentDir:
+		return vfs.openFileListDir(tx, name)
+	case inboxDir:
+		if vfs.inbox {
+			return vfs.openFileListDir(tx, name)
+		}
+	}
+
+	path := vfs.splitPath(name)
+
+	switch path[0] {
+	case tagsDir:
+		return vfs.openTaggedEntryDir(tx, path[1:])
+	case queriesDir:
+		return vfs.openQueryEntryDir(tx, path[1:])
+	case viewsDir:
+		return vfs.openViewEntryDir(tx, path[1:])
+	}
+
+	return nil, fuse.ENOENT
+}
+
 func (vfs FuseVfs) topFiles() ([]fuse.DirEntry, fuse.Status) {
 	log.Infof(2, "BEGIN topFiles")
 	defer log.Infof(2, "END topFiles")
@@ -584,7 +1170,15 @@ func (vfs FuseVfs) topFiles() ([]fuse.DirEntry, fuse.Status) {
 	entries := []fuse.DirEntry{
 		{Name: databaseFilename, Mode: fuse.S_IFLNK},
 		{Name: tagsDir, Mode: fuse.S_IFDIR},
-		{Name: queriesDir, Mode: fuse.S_IFDIR}}
+		{Name: queriesDir, Mode: fuse.S_IFDIR},
+		{Name: viewsDir, Mode: fuse.S_IFDIR},
+		{Name: favoritesDir, Mode: fuse.S_IFDIR},
+		{Name: untaggedDir, Mode: fuse.S_IFDIR},
+		{Name: recentDir, Mode: fuse.S_IFDIR}}
+	if vfs.inbox {
+		entries = append(entries, fuse.DirEntry{Name: inboxDir, Mode: fuse.S_IFDIR})
+	}
+
 	return entries, fuse.OK
 }
 
@@ -627,7 +1221,7 @@ func (vfs FuseVfs) queriesDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Sta
 
 	entries := make([]fuse.DirEntry, len(queries))
 	for index, query := range queries {
-		entries[index] = fuse.DirEntry{Name: query.Text, Mode: fuse.S_IFDIR}
+		entries[index] = fuse.DirEntry{Name: encodeQueryName(query.Text), Mode: fuse.S_IFDIR}
 	}
 
 	if len(queries) < 1 {
@@ -637,6 +1231,27 @@ func (vfs FuseVfs) queriesDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Sta
 	return entries, fuse.OK
 }
 
+func (vfs FuseVfs) viewDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN viewDirectories")
+	defer log.Infof(2, "END viewDirectories")
+
+	views, err := vfs.store.Views(tx)
+	if err != nil {
+		log.Fatalf("could not retrieve views: %v", err)
+	}
+
+	entries := make([]fuse.DirEntry, len(views))
+	for index, view := range views {
+		entries[index] = fuse.DirEntry{Name: view.Name, Mode: fuse.S_IFDIR}
+	}
+
+	if len(views) < 1 {
+		entries = append(entries, fuse.DirEntry{Name: helpFilename, Mode: fuse.S_IFREG})
+	}
+
+	return entries, fuse.OK
+}
+
 func (vfs FuseVfs) getFilesAttr(path []string) (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getFilesAttr")
 	defer log.Infof(2, "END getFilesAttr")
@@ -672,6 +1287,23 @@ func (vfs FuseVfs) getQueryAttr() (*fuse.Attr, fuse.Status) {
 	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 }
 
+func (vfs FuseVfs) getViewsAttr() (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getViewsAttr")
+	defer log.Infof(2, "END getViewsAttr")
+
+	now := time.Now()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+}
+
+// the attributes of the top-level directories that list files, such as 'favorites'
+func (vfs FuseVfs) getFileListAttr() (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getFileListAttr")
+	defer log.Infof(2, "END getFileListAttr")
+
+	now := time.Now()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+}
+
 func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getTaggedEntryAttr(%v)", path)
 	defer log.Infof(2, "END getTaggedEntryAttr(%v)", path)
@@ -687,7 +1319,7 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return vfs.getFilesAttr(path)
 	}
 
-	fileId := vfs.parseFileId(name)
+	fileId := vfs.pathFileId(append([]string{tagsDir}, path...))
 	if fileId != 0 {
 		return vfs.getFileEntryAttr(fileId)
 	}
@@ -727,10 +1359,12 @@ func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(queryDirHelp)), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 	}
 
-	name := path[len(path)-1]
+	if vfs.previews != nil && len(path) > 1 && path[1] == previewsDir {
+		return vfs.getPreviewAttr(append([]string{queriesDir}, path...))
+	}
 
 	if len(path) > 1 {
-		fileId := vfs.parseFileId(name)
+		fileId := vfs.pathFileId(append([]string{queriesDir}, path...))
 		if fileId != 0 {
 			return vfs.getFileEntryAttr(fileId)
 		}
@@ -738,51 +1372,87 @@ func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return nil, fuse.ENOENT
 	}
 
-	queryText := path[0]
+	queryText := decodeQueryName(path[0])
+
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
 
-	if queryText[len(queryText)-1] == ' ' {
-		// prevent multiple entries for same query when typing path in a GUI
+	if status := vfs.checkQuery(tx, queryText); status != fuse.OK {
 		return nil, fuse.ENOENT
 	}
 
-	expression, err := query.Parse(queryText)
+	q, err := vfs.store.Query(tx, queryText)
 	if err != nil {
+		log.Fatalf("could not retrieve query '%v': %v", queryText, err)
+	}
+	if q == nil {
+		// queries must be created before they can be browsed
 		return nil, fuse.ENOENT
 	}
 
-	tx, err := vfs.store.Begin()
-	if err != nil {
-		log.Fatalf("could not begin transaction: %v", err)
+	now := time.Now()
+	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+}
+
+func (vfs FuseVfs) getViewEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getViewEntryAttr(%v)", path)
+	defer log.Infof(2, "END getViewEntryAttr(%v)", path)
+
+	if len(path) == 1 && path[0] == helpFilename {
+		now := time.Now()
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(viewsDirHelp)), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 	}
-	defer tx.Commit()
 
-	tagNames, err := query.TagNames(expression)
-	if err != nil {
-		log.Fatalf("could not identify tag names: %v", err)
+	if vfs.previews != nil && len(path) > 1 && path[1] == previewsDir {
+		return vfs.getPreviewAttr(append([]string{viewsDir}, path...))
 	}
 
-	tags, err := vfs.store.TagsByNames(tx, tagNames)
-	for _, tagName := range tagNames {
-		if !containsTag(tags, tagName) {
-			return nil, fuse.ENOENT
+	if len(path) > 1 {
+		fileId := vfs.pathFileId(append([]string{viewsDir}, path...))
+		if fileId != 0 {
+			return vfs.getFileEntryAttr(fileId)
 		}
+
+		return nil, fuse.ENOENT
 	}
 
-	q, err := vfs.store.Query(tx, queryText)
+	tx, err := vfs.store.Begin()
 	if err != nil {
-		log.Fatalf("could not retrieve query '%v': %v", queryText, err)
+		log.Fatalf("could not begin transaction: %v", err)
 	}
-	if q == nil {
-		_, err = vfs.store.AddQuery(tx, queryText)
-		if err != nil {
-			log.Fatalf("could not add query '%v': %v", queryText, err)
-		}
+	defer tx.Commit()
+
+	view, err := vfs.store.ViewByName(tx, path[0])
+	if err != nil {
+		log.Fatalf("could not retrieve view '%v': %v", path[0], err)
+	}
+	if view == nil {
+		return nil, fuse.ENOENT
 	}
 
 	now := time.Now()
 	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: uint64(0), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 }
 
+func (vfs FuseVfs) getFileListEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getFileListEntryAttr(%v)", path)
+	defer log.Infof(2, "END getFileListEntryAttr(%v)", path)
+
+	if len(path) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	fileId := vfs.pathFileId(path)
+	if fileId == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	return vfs.getFileEntryAttr(fileId)
+}
+
 func (vfs FuseVfs) getDatabaseFileAttr() (*fuse.Attr, fuse.Status) {
 	databasePath := vfs.store.DbPath
 
@@ -836,7 +1506,7 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 	}
 
 	expression := pathToExpression(path)
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+	files, err := vfs.store.FilesForQuery(tx, expression, nil, "", false, false, "name", false, 0)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -844,7 +1514,7 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 	var valueNames []string
 	if lastPathElement[0] != '=' {
 		expression := pathToExpression(path[:len(path)-1])
-		files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+		files, err := vfs.store.FilesForQuery(tx, expression, nil, "", false, false, "name", false, 0)
 		if err != nil {
 			log.Fatalf("could not query files: %v", err)
 		}
@@ -866,9 +1536,9 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 
 	entries := make([]fuse.DirEntry, 0, len(files)+len(furtherTagNames))
 	for _, tagName := range furtherTagNames {
-		tagName = escape(tagName)
+		escapedTagName := escape(tagName)
 
-		if tagName == filesDir {
+		if escapedTagName == filesDir {
 			continue
 		}
 
@@ -877,11 +1547,11 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 			log.Fatalf("could not determine whether tag has values: %v", err)
 		}
 
-		if !hasValues && containsString(path, tagName) {
+		if !hasValues && containsString(path, escapedTagName) {
 			continue
 		}
 
-		entries = append(entries, fuse.DirEntry{Name: tagName, Mode: fuse.S_IFDIR | 0755})
+		entries = append(entries, fuse.DirEntry{Name: escapedTagName, Mode: fuse.S_IFDIR | 0755})
 	}
 
 	for _, valueName := range valueNames {
@@ -899,56 +1569,253 @@ func (vfs FuseVfs) openTaggedEntryFilesDir(tx *storage.Tx, path []string) ([]fus
 	defer log.Infof(2, "END openTaggedEntryFilesDir(%v)", path)
 
 	expression := pathToExpression(path)
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
-	if err != nil {
-		log.Fatalf("could not query files: %v", err)
-	}
-
-	entries := make([]fuse.DirEntry, 0, len(files))
-
-	for _, file := range files {
-		linkName := vfs.getLinkName(file)
-		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
-	}
-
-	return entries, fuse.OK
+	dirPath := append(append([]string{tagsDir}, path...), filesDir)
+	return vfs.fileEntries(tx, dirPath, vfs.fileCursor(tx, expression)), fuse.OK
 }
 
 func (vfs FuseVfs) openQueryEntryDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
 	log.Infof(2, "BEGIN openQueryEntryDir(%v)", path)
 	defer log.Infof(2, "END openQueryEntryDir(%v)", path)
 
-	queryText := path[0]
+	if vfs.previews != nil && len(path) == 2 && path[1] == previewsDir {
+		return vfs.openPreviewsDir(tx, []string{queriesDir, path[0]})
+	}
+	if len(path) > 1 {
+		return nil, fuse.ENOENT
+	}
+
+	queryText := decodeQueryName(path[0])
 
 	expression, err := query.Parse(queryText)
 	if err != nil {
 		log.Fatalf("could not parse query: %v", err)
 	}
 
+	if status := vfs.checkQuery(tx, queryText); status != fuse.OK {
+		return nil, fuse.ENOENT
+	}
+
+	return vfs.withPreviewsDir(vfs.fileEntries(tx, []string{queriesDir, path[0]}, vfs.fileCursor(tx, expression))), fuse.OK
+}
+
+// checks that the query parses and that the tags it refers to exist
+func (vfs FuseVfs) checkQuery(tx *storage.Tx, queryText string) fuse.Status {
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return fuse.EINVAL
+	}
+
+	expression, err = vfs.store.ResolveTagNames(tx, expression, false)
+	if err != nil {
+		log.Fatalf("could not resolve tag names: %v", err)
+	}
+
+	expression, err = vfs.store.ExpandTagPrefixes(tx, expression, false)
+	if err != nil {
+		log.Fatalf("could not expand tag prefixes: %v", err)
+	}
+
 	tagNames, err := query.TagNames(expression)
 	if err != nil {
 		log.Fatalf("could not identify tag names: %v", err)
 	}
 
 	tags, err := vfs.store.TagsByNames(tx, tagNames)
+	if err != nil {
+		log.Fatalf("could not retrieve tags: %v", err)
+	}
+
 	for _, tagName := range tagNames {
 		if !containsTag(tags, tagName) {
-			return nil, fuse.ENOENT
+			return fuse.ENOENT
 		}
 	}
 
-	files, err := vfs.store.FilesForQuery(tx, expression, "", false, false, "name")
+	return fuse.OK
+}
+
+func (vfs FuseVfs) openViewEntryDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN openViewEntryDir(%v)", path)
+	defer log.Infof(2, "END openViewEntryDir(%v)", path)
+
+	if vfs.previews != nil && len(path) == 2 && path[1] == previewsDir {
+		return vfs.openPreviewsDir(tx, []string{viewsDir, path[0]})
+	}
+	if len(path) > 1 {
+		return nil, fuse.ENOENT
+	}
+
+	view, err := vfs.store.ViewByName(tx, path[0])
 	if err != nil {
-		log.Fatalf("could not query files: %v", err)
+		log.Fatalf("could not retrieve view '%v': %v", path[0], err)
+	}
+	if view == nil {
+		return nil, fuse.ENOENT
 	}
 
-	entries := make([]fuse.DirEntry, 0, len(files))
-	for _, file := range files {
-		linkName := vfs.getLinkName(file)
-		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+	expression, err := query.Parse(view.Query)
+	if err != nil {
+		log.Fatalf("could not parse query of view '%v': %v", view.Name, err)
 	}
 
-	return entries, fuse.OK
+	return vfs.withPreviewsDir(vfs.fileEntries(tx, []string{viewsDir, path[0]}, vfs.fileCursor(tx, expression))), fuse.OK
+}
+
+func (vfs FuseVfs) openFileListDir(tx *storage.Tx, dirName string) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN openFileListDir(%v)", dirName)
+	defer log.Infof(2, "END openFileListDir(%v)", dirName)
+
+	cursor, _ := vfs.listedFiles(tx, []string{dirName})
+
+	return vfs.fileEntries(tx, []string{dirName}, cursor), fuse.OK
+}
+
+// whether the path is of a preview within the previews directory of a query or
+// view directory
+func (vfs FuseVfs) isPreviewPath(path []string) bool {
+	return vfs.previews != nil && len(path) == 4 && (path[0] == queriesDir || path[0] == viewsDir) && path[2] == previewsDir
+}
+
+// the entries of a query or view directory along with its previews directory,
+// if previews are enabled
+func (vfs FuseVfs) withPreviewsDir(entries []fuse.DirEntry) []fuse.DirEntry {
+	if vfs.previews == nil {
+		return entries
+	}
+
+	return append([]fuse.DirEntry{{Name: previewsDir, Mode: fuse.S_IFDIR}}, entries...)
+}
+
+// the previews of the files listed within the query or view directory that can
+// be previewed, each named after the file's symlink
+func (vfs FuseVfs) openPreviewsDir(tx *storage.Tx, dirPath []string) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN openPreviewsDir(%v)", dirPath)
+	defer log.Infof(2, "END openPreviewsDir(%v)", dirPath)
+
+	cursor, ok := vfs.listedFiles(tx, dirPath)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	entries := vfs.fileEntries(tx, dirPath, cursor)
+
+	previews := make([]fuse.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if _, mimeType := vfs.previewedFile(tx, append(dirPath, entry.Name)); mimeType != "" {
+			previews = append(previews, fuse.DirEntry{Name: entry.Name + previewExtension, Mode: fuse.S_IFREG})
+		}
+	}
+
+	return previews, fuse.OK
+}
+
+// the previewed file the file symlink path is of and its MIME type, which is
+// empty if the file cannot be previewed
+func (vfs FuseVfs) previewedFile(tx *storage.Tx, linkPath []string) (*entities.File, string) {
+	fileId := vfs.linkFileId(tx, linkPath)
+	if fileId == 0 {
+		return nil, ""
+	}
+
+	file, err := vfs.store.File(tx, fileId)
+	if err != nil {
+		log.Fatalf("could not retrieve file #%v: %v", fileId, err)
+	}
+	if file == nil || file.IsDir {
+		return nil, ""
+	}
+
+	mimeType, err := mimetype.Detect(file.Path())
+	if err != nil || !vfs.previews.previewable(mimeType) {
+		return nil, ""
+	}
+
+	return file, mimeType
+}
+
+// the path of the preview at the path within a previews directory, which is
+// generated if need be
+func (vfs FuseVfs) previewPath(path []string) (string, fuse.Status) {
+	name := path[len(path)-1]
+	if !strings.HasSuffix(name, previewExtension) {
+		return "", fuse.ENOENT
+	}
+
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	linkPath := []string{path[0], path[1], strings.TrimSuffix(name, previewExtension)}
+	file, mimeType := vfs.previewedFile(tx, linkPath)
+	if file == nil {
+		return "", fuse.ENOENT
+	}
+
+	previewPath, err := vfs.previews.preview(file.Path(), mimeType)
+	if err != nil {
+		log.Warn(err)
+		return "", fuse.EIO
+	}
+
+	return previewPath, fuse.OK
+}
+
+func (vfs FuseVfs) getPreviewAttr(path []string) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getPreviewAttr(%v)", path)
+	defer log.Infof(2, "END getPreviewAttr(%v)", path)
+
+	switch len(path) {
+	case 3:
+		tx, err := vfs.store.Begin()
+		if err != nil {
+			log.Fatalf("could not begin transaction: %v", err)
+		}
+		defer tx.Commit()
+
+		cursor, ok := vfs.listedFiles(tx, path[:2])
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		cursor.Close()
+
+		now := time.Now()
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0555, Nlink: 2, Size: uint64(0), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+	case 4:
+		previewPath, status := vfs.previewPath(path)
+		if status != fuse.OK {
+			return nil, status
+		}
+
+		fileInfo, err := os.Stat(previewPath)
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		modTime := fileInfo.ModTime()
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(fileInfo.Size()), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
+	}
+
+	return nil, fuse.ENOENT
+}
+
+func (vfs FuseVfs) openPreview(path []string) (nodefs.File, fuse.Status) {
+	log.Infof(2, "BEGIN openPreview(%v)", path)
+	defer log.Infof(2, "END openPreview(%v)", path)
+
+	previewPath, status := vfs.previewPath(path)
+	if status != fuse.OK {
+		return nil, status
+	}
+
+	data, err := ioutil.ReadFile(previewPath)
+	if err != nil {
+		log.Warnf("could not read preview '%v': %v", previewPath, err)
+		return nil, fuse.EIO
+	}
+
+	return nodefs.NewDataFile(data), fuse.OK
 }
 
 func (vfs FuseVfs) readDatabaseFileLink() (string, fuse.Status) {
@@ -962,9 +1829,7 @@ func (vfs FuseVfs) readTaggedEntryLink(tx *storage.Tx, path []string) (string, f
 	log.Infof(2, "BEGIN readTaggedEntryLink(%v)", path)
 	defer log.Infof(2, "END readTaggedEntryLink(%v)", path)
 
-	name := path[len(path)-1]
-
-	fileId := vfs.parseFileId(name)
+	fileId := vfs.linkFileId(tx, path)
 	if fileId == 0 {
 		return "", fuse.ENOENT
 	}
@@ -983,17 +1848,621 @@ func (vfs FuseVfs) readTaggedEntryLink(tx *storage.Tx, path []string) (string, f
 	return relPath, fuse.OK
 }
 
-func (vfs FuseVfs) getLinkName(file *entities.File) string {
-	extension := filepath.Ext(file.Path())
-	fileName := filepath.Base(file.Path())
-	linkName := fileName[0 : len(fileName)-len(extension)]
-	suffix := "." + fileIdToAscii(file.Id) + extension
+// the number of files read from the database at a time whilst listing a directory
+const listingPageSize = 1000
+
+// a file listed within a directory, of which only what is needed to name its
+// symlink is retained
+type listedFile struct {
+	id   entities.FileId
+	path string
+}
+
+// the symlink entries for the files listed within a directory
+func (vfs FuseVfs) fileEntries(tx *storage.Tx, dirPath []string, cursor *storage.FileCursor) []fuse.DirEntry {
+	files := readListedFiles(cursor)
+
+	template := vfs.fileNameTemplate(tx)
+	linkNames := vfs.linkNames(tx, template, files)
+
+	entries := make([]fuse.DirEntry, 0, len(files))
+	fileIds := make(map[string]entities.FileId, len(files))
+	for index, file := range files {
+		entries = append(entries, fuse.DirEntry{Name: linkNames[index], Mode: fuse.S_IFLNK})
+		fileIds[linkNames[index]] = file.id
+	}
+
+	if !template.IsDefault() {
+		vfs.names.set(strings.Join(dirPath, string(filepath.Separator)), fileIds)
+	}
+
+	return entries
+}
+
+// reads the files from the cursor a page at a time, closing it afterwards so that
+// the values for their symlink names can then be retrieved
+func readListedFiles(cursor *storage.FileCursor) []listedFile {
+	defer cursor.Close()
+
+	listed := make([]listedFile, 0, 10)
+	for {
+		files, err := cursor.Next(listingPageSize)
+		if err != nil {
+			log.Fatalf("could not query files: %v", err)
+		}
+		if len(files) == 0 {
+			return listed
+		}
+
+		for _, file := range files {
+			listed = append(listed, listedFile{file.Id, file.Path()})
+		}
+	}
+}
+
+// the symlink names for files, falling back to the default template for any
+// files whose names would otherwise clash
+func (vfs FuseVfs) linkNames(tx *storage.Tx, template *FileNameTemplate, files []listedFile) []string {
+	var tags entities.Tags
+	if tagNames := template.TagNames(); len(tagNames) > 0 {
+		var err error
+		tags, err = vfs.store.TagsByNames(tx, tagNames)
+		if err != nil {
+			log.Fatalf("could not retrieve tags: %v", err)
+		}
+	}
+
+	valueNames := make(map[entities.ValueId]string)
+	linkNames := make([]string, len(files))
+	counts := make(map[string]int, len(files))
+	for index, file := range files {
+		values := vfs.templateValues(tx, tags, file.id, valueNames)
+		linkName := template.Render(file.path, file.id, values)
+
+		linkNames[index] = linkName
+		counts[linkName]++
+	}
+
+	for index, linkName := range linkNames {
+		if counts[linkName] > 1 || linkName == "" || linkName == "." || linkName == ".." {
+			linkNames[index] = defaultFileNameTemplate.Render(files[index].path, files[index].id, nil)
+		}
+	}
+
+	return linkNames
+}
+
+// the file's values for the tags a file name template includes, keyed by tag name
+func (vfs FuseVfs) templateValues(tx *storage.Tx, tags entities.Tags, fileId entities.FileId, valueNames map[entities.ValueId]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	fileTags, err := vfs.store.FileTagsByFileId(tx, fileId, false)
+	if err != nil {
+		log.Fatalf("could not retrieve tags for file #%v: %v", fileId, err)
+	}
+
+	values := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		names := make([]string, 0, 1)
+		for _, fileTag := range fileTags {
+			if fileTag.TagId != tag.Id || fileTag.ValueId == 0 {
+				continue
+			}
+
+			valueName, ok := valueNames[fileTag.ValueId]
+			if !ok {
+				value, err := vfs.store.Value(tx, fileTag.ValueId)
+				if err != nil {
+					log.Fatalf("could not retrieve value #%v: %v", fileTag.ValueId, err)
+				}
+				if value != nil {
+					valueName = escape(value.Name)
+				}
+
+				valueNames[fileTag.ValueId] = valueName
+			}
+
+			if !containsString(names, valueName) {
+				names = append(names, valueName)
+			}
+		}
+
+		sort.Strings(names)
+		values[tag.Name] = strings.Join(names, ",")
+	}
+
+	return values
+}
+
+func (vfs FuseVfs) fileNameTemplate(tx *storage.Tx) *FileNameTemplate {
+	settings, err := vfs.store.Settings(tx)
+	if err != nil {
+		log.Fatalf("could not retrieve settings: %v", err)
+	}
+
+	template, err := ParseFileNameTemplate(settings.VfsFileNameTemplate())
+	if err != nil {
+		log.Warnf("%v: using '%v' instead", err, DefaultFileNameTemplate)
+		return defaultFileNameTemplate
+	}
+
+	return template
+}
+
+// the ID of the file a file symlink path is of, or zero if it is not of one
+func (vfs FuseVfs) linkFileId(tx *storage.Tx, path []string) entities.FileId {
+	// previews are named after the symlinks of the files they are of
+	if vfs.isPreviewPath(path) {
+		return 0
+	}
+
+	name := path[len(path)-1]
+
+	if vfs.fileNameTemplate(tx).IsDefault() {
+		return vfs.parseFileId(name)
+	}
+
+	if len(path) < 2 {
+		return 0
+	}
+
+	dirPath := path[:len(path)-1]
+	dirName := strings.Join(dirPath, string(filepath.Separator))
+
+	// names rendered from a template cannot be parsed so are looked up in the
+	// most recent listing of the directory, which is refreshed if need be
+	if fileId := vfs.names.fileId(dirName, name); fileId != 0 {
+		return fileId
+	}
+
+	cursor, ok := vfs.listedFiles(tx, dirPath)
+	if !ok {
+		return 0
+	}
+	vfs.fileEntries(tx, dirPath, cursor)
+
+	return vfs.names.fileId(dirName, name)
+}
+
+func (vfs FuseVfs) pathFileId(path []string) entities.FileId {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		log.Fatalf("could not begin transaction: %v", err)
+	}
+	defer tx.Commit()
+
+	return vfs.linkFileId(tx, path)
+}
+
+// a cursor over the files listed within a directory of file symlinks
+func (vfs FuseVfs) listedFiles(tx *storage.Tx, path []string) (*storage.FileCursor, bool) {
+	var queryText string
+	switch {
+	case path[0] == tagsDir && len(path) > 2 && path[len(path)-1] == filesDir:
+		expression := pathToExpression(path[1 : len(path)-1])
+		cursor, err := vfs.store.FileCursorForQuery(tx, expression, nil, "", false, false, "name", false, 0)
+		if err != nil {
+			return nil, false
+		}
+
+		return cursor, true
+	case path[0] == queriesDir && len(path) == 2:
+		queryText = decodeQueryName(path[1])
+		if status := vfs.checkQuery(tx, queryText); status != fuse.OK {
+			return nil, false
+		}
+	case path[0] == viewsDir && len(path) == 2:
+		view, err := vfs.store.ViewByName(tx, path[1])
+		if err != nil {
+			log.Fatalf("could not retrieve view '%v': %v", path[1], err)
+		}
+		if view == nil {
+			return nil, false
+		}
+
+		queryText = view.Query
+	case path[0] == favoritesDir && len(path) == 1:
+		queryText = entities.FavoritesQuery
+	case path[0] == untaggedDir && len(path) == 1:
+		cursor, err := vfs.store.UntaggedFileCursor(tx)
+		if err != nil {
+			log.Fatalf("could not query untagged files: %v", err)
+		}
+
+		return cursor, true
+	case path[0] == recentDir && len(path) == 1:
+		queryText = vfs.recentQuery(tx)
+	case path[0] == inboxDir && len(path) == 1 && vfs.inbox:
+		return vfs.fileCursor(tx, vfs.inboxQuery(tx)), true
+	default:
+		return nil, false
+	}
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return nil, false
+	}
+
+	return vfs.fileCursor(tx, expression), true
+}
+
+// the query for the files tagged within the number of days of the 'vfsRecentDays' setting
+func (vfs FuseVfs) recentQuery(tx *storage.Tx) string {
+	settings, err := vfs.store.Settings(tx)
+	if err != nil {
+		log.Fatalf("could not retrieve settings: %v", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -int(settings.VfsRecentDays()))
+
+	return fmt.Sprintf("%v = %v", entities.TaggedAfterTagName, since.Format("2006-01-02T15:04:05"))
+}
+
+// the tags, as per the 'vfsInboxTags' setting, given to the files linked into
+// the inbox directory
+func (vfs FuseVfs) inboxTags(tx *storage.Tx) []string {
+	settings, err := vfs.store.Settings(tx)
+	if err != nil {
+		log.Fatalf("could not retrieve settings: %v", err)
+	}
 
-	if len(linkName)+len(suffix) > 255 {
-		linkName = linkName[0 : 255-len(suffix)]
+	return text.Tokenize(settings.VfsInboxTags())
+}
+
+// the query for the files having every one of the inbox tags
+func (vfs FuseVfs) inboxQuery(tx *storage.Tx) query.Expression {
+	var expression query.Expression
+	for _, word := range vfs.inboxTags(tx) {
+		tagName, valueName := parseXAttrTag(word)
+
+		var operand query.Expression = query.TagExpression{tagName}
+		if valueName != "" {
+			operand = query.ComparisonExpression{query.TagExpression{tagName}, "=", query.ValueExpression{valueName, ""}}
+		}
+
+		if expression == nil {
+			expression = operand
+		} else {
+			expression = query.AndExpression{expression, operand}
+		}
 	}
 
-	return linkName + suffix
+	return expression
+}
+
+// untags the file with the inbox tags so that it is no longer listed within the
+// inbox directory
+func (vfs FuseVfs) removeFromInbox(tx *storage.Tx, fileId entities.FileId) fuse.Status {
+	for _, word := range vfs.inboxTags(tx) {
+		tagName, valueName := parseXAttrTag(word)
+
+		tag, err := vfs.store.TagByName(tx, tagName)
+		if err != nil {
+			log.Fatalf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			continue
+		}
+
+		// as applied, such as with the tag's default value
+		valueName, err = vfs.store.TagValueName(tx, *tag, valueName)
+		if err != nil {
+			continue
+		}
+
+		value, err := vfs.store.ValueByName(tx, valueName)
+		if err != nil {
+			log.Fatalf("could not retrieve value '%v': %v", valueName, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		if err := vfs.store.DeleteFileTag(tx, fileId, tag.Id, value.Id); err != nil {
+			if _, ok := err.(storage.FileTagDoesNotExist); ok {
+				continue
+			}
+
+			log.Fatalf("could not untag file #%v: %v", fileId, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
+
+	return fuse.OK
+}
+
+// a cursor over the files matching the query, by name
+func (vfs FuseVfs) fileCursor(tx *storage.Tx, expression query.Expression) *storage.FileCursor {
+	cursor, err := vfs.store.FileCursorForQuery(tx, expression, nil, "", false, false, "name", false, 0)
+	if err != nil {
+		log.Fatalf("could not query files: %v", err)
+	}
+
+	return cursor
+}
+
+func (vfs FuseVfs) moveTaggedEntry(tx *storage.Tx, fileId entities.FileId, oldPath, newPath []string) fuse.Status {
+	log.Infof(2, "BEGIN moveTaggedEntry(%v, %v, %v)", fileId, oldPath, newPath)
+	defer log.Infof(2, "END moveTaggedEntry(%v, %v, %v)", fileId, oldPath, newPath)
+
+	if oldPath[0] != tagsDir || newPath[0] != tagsDir || len(newPath) < 3 {
+		return fuse.EPERM
+	}
+
+	oldDir := entryDirPath(oldPath)
+	newDir := entryDirPath(newPath)
+	if strings.Join(oldDir, string(filepath.Separator)) == strings.Join(newDir, string(filepath.Separator)) {
+		// file symlinks cannot be renamed
+		return fuse.EPERM
+	}
+
+	file, err := vfs.store.File(tx, fileId)
+	if err != nil {
+		log.Fatalf("could not retrieve file #%v: %v", fileId, err)
+	}
+	if file == nil {
+		return fuse.ENOENT
+	}
+
+	oldPairs, status := vfs.tagValuePairsForPath(tx, oldDir)
+	if status != fuse.OK {
+		return status
+	}
+
+	newPairs, status := vfs.tagValuePairsForPath(tx, newDir)
+	if status != fuse.OK {
+		return status
+	}
+
+	for _, pair := range newPairs {
+		if _, err := vfs.store.AddFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+			log.Fatalf("could not tag file #%v: %v", fileId, err)
+		}
+	}
+
+	// the file loses each tag of the directory it is moved out of, including
+	// those of its parent directories, but not those it is moved into
+	for _, pair := range oldPairs {
+		if newPairs.Contains(pair) {
+			continue
+		}
+
+		if err := vfs.store.DeleteFileTag(tx, fileId, pair.TagId, pair.ValueId); err != nil {
+			if _, ok := err.(storage.FileTagDoesNotExist); ok {
+				// e.g. the tag is implied
+				continue
+			}
+
+			log.Fatalf("could not untag file #%v: %v", fileId, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("could not commit transaction: %v", err)
+	}
+
+	return fuse.OK
+}
+
+// the file a path's extended attributes are of, or zero if it is not of a file symlink
+func (vfs FuseVfs) xattrFileId(tx *storage.Tx, name string) entities.FileId {
+	if fileId := vfs.links.fileId(name); fileId != 0 {
+		return fileId
+	}
+
+	return vfs.linkFileId(tx, vfs.splitPath(name))
+}
+
+// the information of the tag of a tag directory, or nil if name is not one
+func (vfs FuseVfs) xattrTagInfo(tx *storage.Tx, name string) *entities.TagInfo {
+	path := vfs.splitPath(name)
+	if len(path) != 2 || path[0] != tagsDir {
+		return nil
+	}
+
+	tag, err := vfs.store.TagByName(tx, unescape(path[1]))
+	if err != nil {
+		log.Fatalf("could not retrieve tag '%v': %v", path[1], err)
+	}
+	if tag == nil {
+		return nil
+	}
+
+	tagInfo, err := vfs.store.TagInfo(tx, *tag)
+	if err != nil {
+		log.Fatalf("could not retrieve information of tag '%v': %v", tag.Name, err)
+	}
+
+	return tagInfo
+}
+
+// the tags explicitly applied to a file, as exposed by its extended attributes
+func (vfs FuseVfs) xattrTagsForFile(tx *storage.Tx, fileId entities.FileId) xattrTags {
+	fileTags, err := vfs.store.FileTagsByFileId(tx, fileId, true)
+	if err != nil {
+		log.Fatalf("could not retrieve tags for file #%v: %v", fileId, err)
+	}
+
+	tags := make(xattrTags, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tag, err := vfs.store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			log.Fatalf("could not retrieve tag #%v: %v", fileTag.TagId, err)
+		}
+		if tag == nil {
+			continue
+		}
+
+		var valueName string
+		if fileTag.ValueId != 0 {
+			value, err := vfs.store.Value(tx, fileTag.ValueId)
+			if err != nil {
+				log.Fatalf("could not retrieve value #%v: %v", fileTag.ValueId, err)
+			}
+			if value == nil {
+				continue
+			}
+
+			valueName = value.Name
+		}
+
+		tags = append(tags, xattrTag{tag.Name, valueName, fileTag.ToTagIdValueIdPair()})
+	}
+
+	collator, err := vfs.store.Collator(tx)
+	if err != nil {
+		log.Fatalf("could not retrieve collation: %v", err)
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].tagName == tags[j].tagName {
+			return collator.Less(tags[i].valueName, tags[j].valueName)
+		}
+
+		return collator.Less(tags[i].tagName, tags[j].tagName)
+	})
+
+	return tags
+}
+
+// the tag/value pairs written to an extended attribute, which are either
+// TAG[=VALUE] arguments or, for a tag attribute, the values of that tag
+func (vfs FuseVfs) xattrTagValuePairs(tx *storage.Tx, words []string, tagName string) (entities.TagIdValueIdPairs, fuse.Status) {
+	pairs := make(entities.TagIdValueIdPairs, 0, len(words)+1)
+
+	if tagName != "" && len(words) == 0 {
+		words = []string{""}
+	}
+
+	for _, word := range words {
+		wordTagName, valueName := tagName, unescapeXAttrText(word)
+		if tagName == "" {
+			wordTagName, valueName = parseXAttrTag(word)
+		}
+
+		tag, err := vfs.store.TagByName(tx, wordTagName)
+		if err != nil {
+			log.Fatalf("could not retrieve tag '%v': %v", wordTagName, err)
+		}
+		if tag == nil {
+			if tag, err = vfs.store.AddTag(tx, wordTagName); err != nil {
+				log.Warnf("could not create tag '%v': %v", wordTagName, err)
+				return nil, fuse.EINVAL
+			}
+		}
+
+		valueName, err = vfs.store.TagValueName(tx, *tag, valueName)
+		if err != nil {
+			log.Warn(err)
+			return nil, fuse.EINVAL
+		}
+
+		value, err := vfs.store.ValueByName(tx, valueName)
+		if err != nil {
+			log.Fatalf("could not retrieve value '%v': %v", valueName, err)
+		}
+		if value == nil {
+			if value, err = vfs.store.AddValue(tx, valueName); err != nil {
+				log.Warnf("could not create value '%v': %v", valueName, err)
+				return nil, fuse.EINVAL
+			}
+		}
+
+		pairs = append(pairs, entities.TagIdValueIdPair{tag.Id, value.Id})
+	}
+
+	return pairs, fuse.OK
+}
+
+// the tag/value pairs a file must have to be listed within a tags directory path
+func (vfs FuseVfs) tagValuePairsForPath(tx *storage.Tx, path []string) (entities.TagIdValueIdPairs, fuse.Status) {
+	pairs := make(entities.TagIdValueIdPairs, 0, len(path))
+
+	for index, element := range path {
+		if element == "" || element[0] == '=' {
+			continue
+		}
+
+		tagName := unescape(element)
+		tag, err := vfs.store.TagByName(tx, tagName)
+		if err != nil {
+			log.Fatalf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return nil, fuse.ENOENT
+		}
+
+		var valueName string
+		if index+1 < len(path) && path[index+1] != "" && path[index+1][0] == '=' {
+			valueName = unescape(path[index+1][1:])
+		}
+
+		value, err := vfs.store.ValueByName(tx, valueName)
+		if err != nil {
+			log.Fatalf("could not retrieve value '%v': %v", valueName, err)
+		}
+		if value == nil {
+			return nil, fuse.ENOENT
+		}
+
+		pairs = append(pairs, entities.TagIdValueIdPair{tag.Id, value.Id})
+	}
+
+	if len(pairs) == 0 {
+		return nil, fuse.EPERM
+	}
+
+	return pairs, fuse.OK
+}
+
+// retrieves the file at the specified path, adding it to the database if necessary
+func (vfs FuseVfs) fileForPath(tx *storage.Tx, path string) (*entities.File, fuse.Status) {
+	file, err := vfs.store.FileByPath(tx, path)
+	if err != nil {
+		log.Fatalf("could not retrieve file '%v': %v", path, err)
+	}
+	if file != nil {
+		return file, fuse.OK
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return nil, fuse.ENOENT
+		case os.IsPermission(err):
+			return nil, fuse.EACCES
+		}
+
+		log.Fatalf("could not stat '%v': %v", path, err)
+	}
+
+	settings, err := vfs.store.Settings(tx)
+	if err != nil {
+		log.Fatalf("could not retrieve settings: %v", err)
+	}
+
+	fp, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm(), settings.SymlinkFingerprintAlgorithm())
+	if err != nil {
+		log.Fatalf("could not create fingerprint for '%v': %v", path, err)
+	}
+
+	mimeType, err := mimetype.Detect(path)
+	if err != nil {
+		log.Warnf("could not detect MIME type of '%v': %v", path, err)
+	}
+
+	file, err = vfs.store.AddFile(tx, path, fp, stat.ModTime(), stat.Size(), stat.IsDir(), mimeType)
+	if err != nil {
+		log.Fatalf("could not add file '%v': %v", path, err)
+	}
+
+	return file, fuse.OK
 }
 
 func (vfs FuseVfs) tagNamesToIds(tx *storage.Tx, tagNames []string) (entities.TagIds, error) {
@@ -1106,7 +2575,7 @@ func pathToExpression(path []string) query.Expression {
 			tagName := unescape(path[index-1])
 			valueName := unescape(element[1:])
 
-			elementExpression = query.ComparisonExpression{query.TagExpression{tagName}, "==", query.ValueExpression{valueName}}
+			elementExpression = query.ComparisonExpression{query.TagExpression{tagName}, "==", query.ValueExpression{Name: valueName}}
 		} else {
 			if index+1 < len(path) && path[index+1][0] == '=' {
 				continue
@@ -1122,8 +2591,188 @@ func pathToExpression(path []string) query.Expression {
 	return expression
 }
 
-func fileIdToAscii(fileId entities.FileId) string {
-	return strconv.FormatUint(uint64(fileId), 10)
+// the tags directory path, less any files directory, of a file symlink
+func entryDirPath(path []string) []string {
+	dirPath := path[1 : len(path)-1]
+	if len(dirPath) > 0 && dirPath[len(dirPath)-1] == filesDir {
+		dirPath = dirPath[:len(dirPath)-1]
+	}
+
+	return dirPath
+}
+
+// the extended attributes of file symlinks: the first holds all of the file's
+// tags, as TAG[=VALUE] arguments, and there is one of the second for each tag,
+// holding the values of that tag
+const tagsXAttr = "user.tmsu.tags"
+const tagXAttrPrefix = "user.tmsu.tag."
+
+// the extended attributes of tag directories, holding the information set by
+// the 'tag-info' subcommand
+const descriptionXAttr = "user.tmsu.description"
+const colourXAttr = "user.tmsu.color"
+const iconXAttr = "user.tmsu.icon"
+
+func tagInfoXAttrs(tagInfo entities.TagInfo) map[string]string {
+	return map[string]string{descriptionXAttr: tagInfo.Description,
+		colourXAttr: tagInfo.Colour,
+		iconXAttr:   tagInfo.Icon}
+}
+
+type xattrTag struct {
+	tagName   string
+	valueName string
+	pair      entities.TagIdValueIdPair
+}
+
+type xattrTags []xattrTag
+
+func (tags xattrTags) Len() int {
+	return len(tags)
+}
+
+func (tags xattrTags) Less(i, j int) bool {
+	if tags[i].tagName == tags[j].tagName {
+		return tags[i].valueName < tags[j].valueName
+	}
+
+	return tags[i].tagName < tags[j].tagName
+}
+
+func (tags xattrTags) Swap(i, j int) {
+	tags[i], tags[j] = tags[j], tags[i]
+}
+
+func (tags xattrTags) contain(tagName string) bool {
+	return len(tags.withTagName(tagName)) > 0
+}
+
+func (tags xattrTags) containPair(pair entities.TagIdValueIdPair) bool {
+	for _, tag := range tags {
+		if tag.pair == pair {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (tags xattrTags) withTagName(tagName string) xattrTags {
+	matching := make(xattrTags, 0, 1)
+	for _, tag := range tags {
+		if tag.tagName == tagName {
+			matching = append(matching, tag)
+		}
+	}
+
+	return matching
+}
+
+// how long a file symlink remains visible under the name it was created with
+const createdLinkLifetime = 5 * time.Second
+
+type createdLink struct {
+	fileId  entities.FileId
+	target  string
+	created time.Time
+}
+
+// file symlinks created in tag directories, keyed by the name they were created
+// with, so that the look-ups that follow their creation succeed even though they
+// are subsequently listed under the usual symlink name. Likewise the symlinks by
+// which views are saved, which are subsequently listed as directories.
+type createdLinks struct {
+	sync.Mutex
+	links map[string]createdLink
+}
+
+func (links *createdLinks) add(name string, fileId entities.FileId) {
+	links.put(name, createdLink{fileId: fileId})
+}
+
+func (links *createdLinks) addTarget(name, target string) {
+	links.put(name, createdLink{target: target})
+}
+
+func (links *createdLinks) put(name string, link createdLink) {
+	links.Lock()
+	defer links.Unlock()
+
+	now := time.Now()
+	for linkName, existing := range links.links {
+		if now.Sub(existing.created) > createdLinkLifetime {
+			delete(links.links, linkName)
+		}
+	}
+
+	link.created = now
+	links.links[name] = link
+}
+
+func (links *createdLinks) fileId(name string) entities.FileId {
+	links.Lock()
+	defer links.Unlock()
+
+	link, ok := links.links[name]
+	if !ok || time.Since(link.created) > createdLinkLifetime {
+		return 0
+	}
+
+	return link.fileId
+}
+
+func (links *createdLinks) target(name string) string {
+	links.Lock()
+	defer links.Unlock()
+
+	link, ok := links.links[name]
+	if !ok || time.Since(link.created) > createdLinkLifetime {
+		return ""
+	}
+
+	return link.target
+}
+
+// how long the symlink names of a directory listing are remembered for
+const listedNameLifetime = 5 * time.Second
+
+type listedDir struct {
+	fileIds map[string]entities.FileId
+	listed  time.Time
+}
+
+// the file symlink names of the most recent listing of each directory, keyed by
+// directory path, so that names rendered from a file name template, which
+// cannot be parsed for the file ID, can be looked up
+type listedNames struct {
+	sync.Mutex
+	dirs map[string]listedDir
+}
+
+func (names *listedNames) set(dirPath string, fileIds map[string]entities.FileId) {
+	names.Lock()
+	defer names.Unlock()
+
+	now := time.Now()
+	for path, dir := range names.dirs {
+		if now.Sub(dir.listed) > listedNameLifetime {
+			delete(names.dirs, path)
+		}
+	}
+
+	names.dirs[dirPath] = listedDir{fileIds, now}
+}
+
+func (names *listedNames) fileId(dirPath, name string) entities.FileId {
+	names.Lock()
+	defer names.Unlock()
+
+	dir, ok := names.dirs[dirPath]
+	if !ok || time.Since(dir.listed) > listedNameLifetime {
+		return 0
+	}
+
+	return dir.fileIds[name]
 }
 
 func asciiToFileId(str string) (entities.FileId, error) {
@@ -1162,3 +2811,16 @@ func unescape(name string) string {
 	name = strings.Replace(name, "\u200B\u2216", `\`, -1)
 	return name
 }
+
+// query directory names cannot contain a slash so slashes, and the characters
+// used to escape them, are percent-encoded
+var queryNameEncoder = strings.NewReplacer(`%`, "%25", `/`, "%2F", `\`, "%5C")
+var queryNameDecoder = strings.NewReplacer("%25", `%`, "%2F", `/`, "%2f", `/`, "%5C", `\`, "%5c", `\`)
+
+func encodeQueryName(queryText string) string {
+	return queryNameEncoder.Replace(queryText)
+}
+
+func decodeQueryName(name string) string {
+	return queryNameDecoder.Replace(unescape(name))
+}
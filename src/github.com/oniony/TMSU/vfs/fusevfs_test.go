@@ -0,0 +1,416 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"fmt"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/common/trash"
+	"github.com/oniony/TMSU/entities"
+	"github.com/oniony/TMSU/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestXAttrTagRoundTrip(test *testing.T) {
+	assertXAttrTagRoundTrip("photo", "", `photo`, test)
+	assertXAttrTagRoundTrip("year", "2019", `year=2019`, test)
+	assertXAttrTagRoundTrip("big cat", "x y", `big\ cat=x\ y`, test)
+	assertXAttrTagRoundTrip("a=b", "c=d", `a\=b=c=d`, test)
+}
+
+func TestSymlinkIntoTagDirectoryTagsFile(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	path := createTestFile(dir, "beach.jpg", test)
+	addTestTags(vfs, test, "holiday", "sea")
+
+	// test
+
+	status := vfs.Symlink(path, "tags/holiday/sea/beach.jpg", nil)
+
+	// validate
+
+	if status != fuse.OK {
+		test.Fatalf("Expected symlink to be created but was %v", status)
+	}
+
+	assertFileTags(vfs, path, []string{"holiday", "sea"}, test)
+}
+
+func TestSymlinkOutsideTagDirectoryIsRefused(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	path := createTestFile(dir, "beach.jpg", test)
+	addTestTags(vfs, test, "holiday")
+
+	// test
+
+	tagsStatus := vfs.Symlink(path, "tags/beach.jpg", nil)
+	queriesStatus := vfs.Symlink(path, "queries/holiday/beach.jpg", nil)
+	missingStatus := vfs.Symlink(path, "tags/unknown/beach.jpg", nil)
+
+	// validate
+
+	if tagsStatus != fuse.EPERM {
+		test.Fatalf("Expected symlink within tags directory to be refused with %v but was %v", fuse.EPERM, tagsStatus)
+	}
+	if queriesStatus != fuse.EPERM {
+		test.Fatalf("Expected symlink within query directory to be refused with %v but was %v", fuse.EPERM, queriesStatus)
+	}
+	if missingStatus != fuse.ENOENT {
+		test.Fatalf("Expected symlink within unknown tag directory to be refused with %v but was %v", fuse.ENOENT, missingStatus)
+	}
+
+	assertFileTags(vfs, path, nil, test)
+}
+
+func TestRenameBetweenTagDirectoriesRetagsFile(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	path := createTestFile(dir, "beach.jpg", test)
+	addTestTags(vfs, test, "holiday", "sea", "work")
+	if status := vfs.Symlink(path, "tags/holiday/sea/beach.jpg", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+	linkName := testLinkName(vfs, path, test)
+
+	// test
+
+	status := vfs.Rename("tags/holiday/sea/"+linkName, "tags/work/"+linkName, nil)
+
+	// validate
+
+	if status != fuse.OK {
+		test.Fatalf("Expected symlink to be moved but was %v", status)
+	}
+
+	assertFileTags(vfs, path, []string{"work"}, test)
+}
+
+func TestRenameWithinNestedTagDirectoryKeepsSharedTags(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	path := createTestFile(dir, "beach.jpg", test)
+	addTestTags(vfs, test, "holiday", "sea", "sand")
+	if status := vfs.Symlink(path, "tags/holiday/sea/beach.jpg", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+	linkName := testLinkName(vfs, path, test)
+
+	// test
+
+	status := vfs.Rename("tags/holiday/sea/"+linkName, "tags/holiday/sand/"+linkName, nil)
+
+	// validate
+
+	if status != fuse.OK {
+		test.Fatalf("Expected symlink to be moved but was %v", status)
+	}
+
+	assertFileTags(vfs, path, []string{"holiday", "sand"}, test)
+}
+
+func TestRenameWithinTagDirectoryIsRefused(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	path := createTestFile(dir, "beach.jpg", test)
+	addTestTags(vfs, test, "holiday")
+	if status := vfs.Symlink(path, "tags/holiday/beach.jpg", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+	linkName := testLinkName(vfs, path, test)
+
+	// test
+
+	status := vfs.Rename("tags/holiday/"+linkName, "tags/holiday/renamed.jpg", nil)
+
+	// validate
+
+	if status != fuse.EPERM {
+		test.Fatalf("Expected rename to be refused with %v but was %v", fuse.EPERM, status)
+	}
+
+	assertFileTags(vfs, path, []string{"holiday"}, test)
+}
+
+func TestSymlinkIntoViewsDirectoryAddsView(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	addTestTags(vfs, test, "holiday", "video")
+
+	// test
+
+	status := vfs.Symlink("holiday and video", "views/holiday-videos", nil)
+
+	// validate
+
+	if status != fuse.OK {
+		test.Fatalf("Expected view to be added but was %v", status)
+	}
+
+	assertViews(vfs, []string{"holiday-videos=holiday and video"}, test)
+
+	entries, status := vfs.OpenDir("views", nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if len(entries) != 1 || entries[0].Name != "holiday-videos" || entries[0].Mode != fuse.S_IFDIR {
+		test.Fatalf("Expected view to be listed as a directory but listing was %v", entries)
+	}
+
+	// once the symlink just created is forgotten the view is a directory
+	vfs.links = &createdLinks{links: make(map[string]createdLink)}
+	attr, status := vfs.GetAttr("views/holiday-videos", nil)
+	if status != fuse.OK {
+		test.Fatal(status)
+	}
+	if attr.Mode&fuse.S_IFDIR == 0 {
+		test.Fatalf("Expected view to be a directory but mode was %o", attr.Mode)
+	}
+}
+
+func TestSymlinkIntoViewsDirectoryRefusesInvalidViews(test *testing.T) {
+	// set-up
+
+	vfs, dir := createTestVfs(test)
+	defer os.RemoveAll(dir)
+	defer vfs.store.Close()
+
+	addTestTags(vfs, test, "holiday")
+	if status := vfs.Symlink("holiday", "views/holidays", nil); status != fuse.OK {
+		test.Fatal(status)
+	}
+
+	// test & validate
+
+	assertSymlinkStatus(vfs, "holiday", "views/holidays/nested", fuse.EPERM, test)
+	assertSymlinkStatus(vfs, "holiday and", "views/incomplete", fuse.EINVAL, test)
+	assertSymlinkStatus(vfs, " ", "views/blank", fuse.EINVAL, test)
+	assertSymlinkStatus(vfs, "holiday", "views/..", fuse.EINVAL, test)
+	assertSymlinkStatus(vfs, "unknown", "views/unknown", fuse.ENOENT, test)
+	assertSymlinkStatus(vfs, "holiday", "views/holidays", fuse.Status(syscall.EEXIST), test)
+
+	assertViews(vfs, []string{"holidays=holiday"}, test)
+}
+
+// unexported
+
+func assertXAttrTagRoundTrip(tagName, valueName, expected string, test *testing.T) {
+	formatted := formatXAttrTag(tagName, valueName)
+	if formatted != expected {
+		test.Fatalf("Expected '%v' but was '%v'", expected, formatted)
+	}
+
+	words := text.Tokenize(formatted)
+	if len(words) != 1 {
+		test.Fatalf("Expected one word but were %v", words)
+	}
+
+	parsedTagName, parsedValueName := parseXAttrTag(words[0])
+	if parsedTagName != tagName || parsedValueName != valueName {
+		test.Fatalf("Expected '%v' and '%v' but were '%v' and '%v'", tagName, valueName, parsedTagName, parsedValueName)
+	}
+}
+
+func TestAddDefaultMountOptions(test *testing.T) {
+	assertMountOptions([]string{}, []string{"volname=mp", "noappledouble"}, test)
+	assertMountOptions([]string{"allow_other"}, []string{"allow_other", "volname=mp", "noappledouble"}, test)
+	assertMountOptions([]string{"volname=Photos"}, []string{"volname=Photos", "noappledouble"}, test)
+	assertMountOptions([]string{"appledouble"}, []string{"appledouble", "volname=mp"}, test)
+}
+
+func assertMountOptions(options []string, expected []string, test *testing.T) {
+	actual := addDefaultMountOptions(options, "volname=mp", "noappledouble")
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		test.Fatalf("Expected options %v but were %v", expected, actual)
+	}
+}
+
+// a virtual filesystem, not mounted, of a new database within a new temporary
+// directory, which the caller removes
+func createTestVfs(test *testing.T) (FuseVfs, string) {
+	dir, err := ioutil.TempDir("", "tmsu-vfs")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, ".tmsu", "db")
+	if err := os.Mkdir(filepath.Dir(dbPath), 0755); err != nil {
+		test.Fatal(err)
+	}
+	if err := storage.CreateAt(dbPath); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.OpenAt(dbPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	vfs := FuseVfs{store, filepath.Join(dir, "mp"), nil, &createdLinks{links: make(map[string]createdLink)}, &listedNames{dirs: make(map[string]listedDir)}, newResultCache(dbPath), trash.UntagOnly, nil, false}
+
+	return vfs, dir
+}
+
+func createTestFile(dir, name string, test *testing.T) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	return path
+}
+
+func addTestTags(vfs FuseVfs, test *testing.T, tagNames ...string) {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, tagName := range tagNames {
+		if _, err := vfs.store.AddTag(tx, tagName); err != nil {
+			tx.Rollback()
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+}
+
+// the name of the symlink to the file within the tag directories it is listed in
+func testLinkName(vfs FuseVfs, path string, test *testing.T) string {
+	file := testFile(vfs, path, test)
+	if file == nil {
+		test.Fatalf("Expected file '%v' to have been added", path)
+	}
+
+	extension := filepath.Ext(file.Name)
+	return fmt.Sprintf("%v.%v%v", strings.TrimSuffix(file.Name, extension), file.Id, extension)
+}
+
+func testFile(vfs FuseVfs, path string, test *testing.T) *entities.File {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := vfs.store.FileByPath(tx, path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return file
+}
+
+func assertFileTags(vfs FuseVfs, path string, expected []string, test *testing.T) {
+	file := testFile(vfs, path, test)
+	if file == nil {
+		if len(expected) > 0 {
+			test.Fatalf("Expected file '%v' to have been added", path)
+		}
+		return
+	}
+
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	fileTags, err := vfs.store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagNames := make([]string, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tag, err := vfs.store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		tagNames = append(tagNames, tag.Name)
+	}
+	sort.Strings(tagNames)
+
+	if strings.Join(tagNames, ",") != strings.Join(expected, ",") {
+		test.Fatalf("Expected file '%v' to have tags %v but had %v", path, expected, tagNames)
+	}
+}
+
+func assertSymlinkStatus(vfs FuseVfs, value, linkName string, expected fuse.Status, test *testing.T) {
+	if status := vfs.Symlink(value, linkName, nil); status != expected {
+		test.Fatalf("Expected symlink '%v' to '%v' to give %v but was %v", linkName, value, expected, status)
+	}
+}
+
+func assertViews(vfs FuseVfs, expected []string, test *testing.T) {
+	tx, err := vfs.store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	views, err := vfs.store.Views(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	actual := make([]string, len(views))
+	for index, view := range views {
+		actual[index] = view.Name + "=" + view.Query
+	}
+
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		test.Fatalf("Expected views %v but were %v", expected, actual)
+	}
+}
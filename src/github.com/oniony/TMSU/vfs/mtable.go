@@ -18,50 +18,50 @@
 package vfs
 
 import (
-	"bufio"
-	"fmt"
-	"github.com/oniony/TMSU/common/path"
-	"io"
+	"errors"
 	"os"
 	"path/filepath"
-	"strings"
+	"syscall"
 )
 
 type Mount struct {
 	DatabasePath string
 	MountPath    string
+	Connected    bool // false where the process serving the mount has gone
 }
 
 func GetMountTable() ([]Mount, error) {
-	mountTable := make([]Mount, 0, 10)
-
-	file, err := os.Open("/proc/mounts")
+	mountpoints, err := fuseMountpoints()
 	if err != nil {
-		return nil, fmt.Errorf("could not open system mount table")
+		return nil, err
 	}
-	defer file.Close()
-
-	reader := bufio.NewReader(file)
-	for line, err := reader.ReadString('\n'); err != io.EOF; line, err = reader.ReadString('\n') {
-		if err != nil {
-			return nil, err
-		}
 
-		parts := strings.Split(line, " ")
-
-		if parts[0] != "pathfs.pathInode" {
-			continue
-		}
+	return mountTable(mountpoints, os.Readlink)
+}
 
-		mountpoint := path.UnescapeOctal(parts[1])
+// unexported
 
+// the mounts of TMSU amongst the FUSE mount points, identified by reading
+// their '.database' symbolic links with readlink
+func mountTable(mountpoints []string, readlink func(string) (string, error)) ([]Mount, error) {
+	mountTable := make([]Mount, 0, 10)
+	for _, mountpoint := range mountpoints {
 		databaseSymlink := filepath.Join(mountpoint, ".database")
-		databasePath, err := os.Readlink(databaseSymlink)
+		databasePath, err := readlink(databaseSymlink)
+		connected := err == nil
 		if err != nil {
-			return nil, err
+			switch {
+			case errors.Is(err, syscall.ENOTCONN):
+				// the mount is left behind by a virtual filesystem that has exited
+			case os.IsNotExist(err), errors.Is(err, syscall.EINVAL):
+				// some other filesystem built with the same FUSE library
+				continue
+			default:
+				return nil, err
+			}
 		}
 
-		mountTable = append(mountTable, Mount{databasePath, mountpoint})
+		mountTable = append(mountTable, Mount{databasePath, mountpoint, connected})
 	}
 
 	return mountTable, nil
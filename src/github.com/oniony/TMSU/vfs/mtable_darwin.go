@@ -0,0 +1,65 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build darwin
+
+package vfs
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+const mntNoWait = 2
+
+// the mount points of the macFUSE (formerly osxfuse) filesystems
+func fuseMountpoints() ([]string, error) {
+	count, err := syscall.Getfsstat(nil, mntNoWait)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve system mount table: %w", err)
+	}
+
+	stats := make([]syscall.Statfs_t, count)
+	count, err = syscall.Getfsstat(stats, mntNoWait)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve system mount table: %w", err)
+	}
+
+	mountpoints := make([]string, 0, 10)
+	for _, stat := range stats[:count] {
+		fsType := cString(stat.Fstypename[:])
+		if !strings.HasPrefix(fsType, "macfuse") && !strings.HasPrefix(fsType, "osxfuse") {
+			continue
+		}
+
+		mountpoints = append(mountpoints, cString(stat.Mntonname[:]))
+	}
+
+	return mountpoints, nil
+}
+
+func cString(chars []int8) string {
+	bytes := make([]byte, 0, len(chars))
+	for _, char := range chars {
+		if char == 0 {
+			break
+		}
+
+		bytes = append(bytes, byte(char))
+	}
+
+	return string(bytes)
+}
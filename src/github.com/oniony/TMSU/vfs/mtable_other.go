@@ -0,0 +1,61 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!darwin
+
+package vfs
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oniony/TMSU/common/path"
+	"io"
+	"os"
+	"strings"
+)
+
+// the mount points of the filesystems built with the FUSE library
+func fuseMountpoints() ([]string, error) {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("could not open system mount table")
+	}
+	defer file.Close()
+
+	return parseMountpoints(file)
+}
+
+// the mount points of the FUSE filesystems listed in a mount table in the
+// format of /proc/mounts
+func parseMountpoints(mounts io.Reader) ([]string, error) {
+	mountpoints := make([]string, 0, 10)
+
+	reader := bufio.NewReader(mounts)
+	for line, err := reader.ReadString('\n'); err != io.EOF; line, err = reader.ReadString('\n') {
+		if err != nil {
+			return nil, err
+		}
+
+		parts := strings.Split(line, " ")
+
+		if parts[0] != "pathfs.pathInode" {
+			continue
+		}
+
+		mountpoints = append(mountpoints, path.UnescapeOctal(parts[1]))
+	}
+
+	return mountpoints, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!darwin
+
+package vfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMountpoints(test *testing.T) {
+	// set-up
+
+	mounts := `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+pathfs.pathInode /mnt/tags fuse rw,nosuid,nodev,relatime,user_id=1000,group_id=1000 0 0
+sshfs#host: /mnt/sshfs fuse.sshfs rw,nosuid,nodev,relatime,user_id=1000,group_id=1000 0 0
+pathfs.pathInode /mnt/my\040photos fuse rw,nosuid,nodev,relatime,user_id=1000,group_id=1000 0 0
+`
+
+	// test
+
+	mountpoints, err := parseMountpoints(strings.NewReader(mounts))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(mountpoints) != 2 {
+		test.Fatalf("Expected 2 mount points but were %v", mountpoints)
+	}
+	if mountpoints[0] != "/mnt/tags" {
+		test.Fatalf("Expected '/mnt/tags' but was '%v'", mountpoints[0])
+	}
+	if mountpoints[1] != "/mnt/my photos" {
+		test.Fatalf("Expected '/mnt/my photos' but was '%v'", mountpoints[1])
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestMountTable(test *testing.T) {
+	// set-up
+
+	links := map[string]error{
+		"/mnt/tags/.database":    nil,
+		"/mnt/stale/.database":   &os.PathError{"readlink", "/mnt/stale/.database", syscall.ENOTCONN},
+		"/mnt/sshfs/.database":   &os.PathError{"readlink", "/mnt/sshfs/.database", syscall.ENOENT},
+		"/mnt/archive/.database": &os.PathError{"readlink", "/mnt/archive/.database", syscall.EINVAL},
+	}
+
+	readlink := func(path string) (string, error) {
+		if err := links[path]; err != nil {
+			return "", err
+		}
+
+		return "/home/alice/.tmsu/db", nil
+	}
+
+	// test
+
+	mounts, err := mountTable([]string{"/mnt/tags", "/mnt/stale", "/mnt/sshfs", "/mnt/archive"}, readlink)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(mounts) != 2 {
+		test.Fatalf("Expected 2 mounts but were %v", mounts)
+	}
+	assertMount(mounts[0], Mount{"/home/alice/.tmsu/db", "/mnt/tags", true}, test)
+	assertMount(mounts[1], Mount{"", "/mnt/stale", false}, test)
+}
+
+func TestMountTableReportsUnexpectedErrors(test *testing.T) {
+	readlink := func(path string) (string, error) {
+		return "", &os.PathError{"readlink", path, syscall.EACCES}
+	}
+
+	if _, err := mountTable([]string{"/mnt/tags"}, readlink); err == nil {
+		test.Fatal("Expected an error")
+	}
+}
+
+// unexported
+
+func assertMount(actual, expected Mount, test *testing.T) {
+	if actual != expected {
+		test.Fatalf("Expected mount %+v but was %+v", expected, actual)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build darwin
+
+package vfs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// macFUSE is asked to name the volume after the mount point, rather than
+// giving it a generic name, and to keep the Finder from storing its AppleDouble
+// ('._') files and 'com.apple' extended attributes, which the virtual
+// filesystem has nowhere to store
+func platformMountOptions(mountPath string, options []string) []string {
+	volumeName := strings.Replace(filepath.Base(mountPath), ",", " ", -1)
+
+	return addDefaultMountOptions(options, "volname="+volumeName, "noappledouble", "noapplexattr")
+}
+
+// whether the name is one the Finder uses for the metadata files it creates
+func isPlatformMetadata(name string) bool {
+	return strings.HasPrefix(name, "._") || name == ".DS_Store"
+}
@@ -0,0 +1,234 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/oniony/TMSU/storage"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// the directory within each query directory holding the previews of its files
+const previewsDir = ".previews"
+
+// the extension added to a file's symlink name to name its preview
+const previewExtension = ".jpg"
+
+// the width and height of the square a preview is fitted within
+const previewSize = 256
+
+// the number of samples taken along each axis of a preview's pixels when
+// scaling an image down
+const previewSamples = 4
+
+// the image types that can be decoded without an external tool
+var decodableImageTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// generates thumbnails of image and video files, which are cached as files so
+// that they are generated only once for each version of a file
+type previewer struct {
+	cacheDir   string
+	ffmpegPath string // empty if ffmpeg is not installed
+}
+
+// a previewer caching its thumbnails in the 'cache' directory beside the database
+// or, for a database that is not held in a local file, in the user's cache directory
+func newPreviewer(dbPath string) *previewer {
+	cacheDir := filepath.Join(filepath.Dir(dbPath), "cache", "previews")
+	if storage.IsPostgres(dbPath) {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			userCacheDir = os.TempDir()
+		}
+
+		cacheDir = filepath.Join(userCacheDir, "tmsu", "previews")
+	}
+
+	ffmpegPath, _ := exec.LookPath("ffmpeg")
+
+	return &previewer{cacheDir, ffmpegPath}
+}
+
+// whether files of the MIME type can be previewed: images that can be decoded
+// and, if ffmpeg is installed, videos and images of other types
+func (previewer *previewer) previewable(mimeType string) bool {
+	if containsString(decodableImageTypes, mimeType) {
+		return true
+	}
+
+	if previewer.ffmpegPath == "" {
+		return false
+	}
+
+	return strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/")
+}
+
+// the path of the cached preview of the file, which is generated if there is none
+// for the file as it currently is
+func (previewer *previewer) preview(path string, mimeType string) (string, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	// the file's size and modification time are part of the key so that the
+	// preview of a file that has since changed is not used
+	key := sha256.Sum256([]byte(path + "\000" + strconv.FormatInt(fileInfo.Size(), 10) + "\000" + strconv.FormatInt(fileInfo.ModTime().UnixNano(), 10)))
+	previewPath := filepath.Join(previewer.cacheDir, hex.EncodeToString(key[:])+previewExtension)
+
+	if _, err := os.Stat(previewPath); err == nil {
+		return previewPath, nil
+	}
+
+	if err := os.MkdirAll(previewer.cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("could not create preview cache directory '%v': %w", previewer.cacheDir, err)
+	}
+
+	// the preview is written to a temporary file and then renamed so that a
+	// partially written preview is never used
+	tempFile, err := ioutil.TempFile(previewer.cacheDir, "preview-")
+	if err != nil {
+		return "", fmt.Errorf("could not create preview: %w", err)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer os.Remove(tempPath)
+
+	if containsString(decodableImageTypes, mimeType) {
+		err = writeImagePreview(path, tempPath)
+	} else {
+		err = previewer.writeFfmpegPreview(path, tempPath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not generate preview of '%v': %w", path, err)
+	}
+
+	if err := os.Rename(tempPath, previewPath); err != nil {
+		return "", fmt.Errorf("could not create preview: %w", err)
+	}
+
+	return previewPath, nil
+}
+
+// writes a preview of a video, or an image of a type that cannot be decoded, by
+// extracting a frame with ffmpeg
+func (previewer *previewer) writeFfmpegPreview(path, previewPath string) error {
+	scale := fmt.Sprintf("scale=%[1]v:%[1]v:force_original_aspect_ratio=decrease", previewSize)
+
+	// a frame a second in is more representative of a video than the first
+	// unless the video is shorter than that
+	for _, offset := range []string{"1", "0"} {
+		command := exec.Command(previewer.ffmpegPath, "-v", "error", "-y", "-ss", offset, "-i", path, "-frames:v", "1", "-vf", scale, "-f", "image2", "-c:v", "mjpeg", previewPath)
+		output, err := command.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("ffmpeg failed: %v: %v", err, strings.TrimSpace(string(output)))
+		}
+
+		if fileInfo, err := os.Stat(previewPath); err == nil && fileInfo.Size() > 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("ffmpeg extracted no frame")
+}
+
+// writes a preview of an image that the standard library can decode
+func writeImagePreview(path, previewPath string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return err
+	}
+
+	previewFile, err := os.Create(previewPath)
+	if err != nil {
+		return err
+	}
+
+	if err := jpeg.Encode(previewFile, scaleImage(img, previewSize), &jpeg.Options{Quality: 85}); err != nil {
+		previewFile.Close()
+		return err
+	}
+
+	return previewFile.Close()
+}
+
+// scales the image down to fit within a square of the size, keeping its aspect
+// ratio, and flattens it onto a white background as JPEG has no transparency.
+// Each pixel is the average of a grid of samples taken from the area it covers.
+func scaleImage(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	scaledWidth, scaledHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			scaledWidth, scaledHeight = size, height*size/width
+		} else {
+			scaledWidth, scaledHeight = width*size/height, size
+		}
+	}
+	if scaledWidth == 0 {
+		scaledWidth = 1
+	}
+	if scaledHeight == 0 {
+		scaledHeight = 1
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := 0; y < scaledHeight; y++ {
+		for x := 0; x < scaledWidth; x++ {
+			var red, green, blue uint64
+			for sampleY := 0; sampleY < previewSamples; sampleY++ {
+				for sampleX := 0; sampleX < previewSamples; sampleX++ {
+					sourceX := bounds.Min.X + (x*previewSamples+sampleX)*width/(scaledWidth*previewSamples)
+					sourceY := bounds.Min.Y + (y*previewSamples+sampleY)*height/(scaledHeight*previewSamples)
+
+					// the colours are premultiplied by alpha so white shows
+					// through in proportion to the transparency
+					r, g, b, a := img.At(sourceX, sourceY).RGBA()
+					red += uint64(r + 0xffff - a)
+					green += uint64(g + 0xffff - a)
+					blue += uint64(b + 0xffff - a)
+				}
+			}
+
+			const sampleCount = previewSamples * previewSamples
+			scaled.SetRGBA(x, y, color.RGBA{uint8(red / sampleCount >> 8), uint8(green / sampleCount >> 8), uint8(blue / sampleCount >> 8), 0xff})
+		}
+	}
+
+	return scaled
+}
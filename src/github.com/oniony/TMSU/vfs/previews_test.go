@@ -0,0 +1,141 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScaleImageFitsWithinSquare(test *testing.T) {
+	assertScaledSize(1000, 500, 256, 128, test)
+	assertScaledSize(300, 600, 128, 256, test)
+	assertScaledSize(100, 50, 100, 50, test)
+	assertScaledSize(5000, 1, 256, 1, test)
+}
+
+func TestScaleImageFlattensTransparencyOntoWhite(test *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 512; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 0})
+		}
+	}
+
+	scaled := scaleImage(img, 256)
+
+	if pixel := scaled.RGBAAt(10, 10); pixel != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		test.Fatalf("Expected a white pixel but was %v", pixel)
+	}
+}
+
+func TestPreviewIsGeneratedOnceAndCached(test *testing.T) {
+	// set-up
+
+	dir, err := ioutil.TempDir("", "tmsu-previews")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imagePath := filepath.Join(dir, "red.png")
+	writePng(imagePath, 600, 300, color.RGBA{0xff, 0, 0, 0xff}, test)
+
+	previewer := newPreviewer(filepath.Join(dir, ".tmsu", "db"))
+
+	// test
+
+	previewPath, err := previewer.preview(imagePath, "image/png")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if filepath.Dir(previewPath) != filepath.Join(dir, ".tmsu", "cache", "previews") {
+		test.Fatalf("Expected preview within the cache directory but was '%v'", previewPath)
+	}
+
+	file, err := os.Open(previewPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	preview, err := jpeg.Decode(file)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if size := preview.Bounds().Size(); size.X != 256 || size.Y != 128 {
+		test.Fatalf("Expected a 256x128 preview but was %vx%v", size.X, size.Y)
+	}
+	if red, green, _, _ := preview.At(128, 64).RGBA(); red < 0xf000 || green > 0x1000 {
+		test.Fatalf("Expected a red preview but was %v", preview.At(128, 64))
+	}
+
+	cachedPath, err := previewer.preview(imagePath, "image/png")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if cachedPath != previewPath {
+		test.Fatalf("Expected cached preview '%v' but was '%v'", previewPath, cachedPath)
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(previewPath))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(entries) != 1 {
+		test.Fatalf("Expected one cached preview but were %v", len(entries))
+	}
+}
+
+// unexported
+
+func assertScaledSize(width, height, expectedWidth, expectedHeight int, test *testing.T) {
+	scaled := scaleImage(image.NewRGBA(image.Rect(0, 0, width, height)), 256)
+
+	if size := scaled.Bounds().Size(); size.X != expectedWidth || size.Y != expectedHeight {
+		test.Fatalf("Expected %vx%v to scale to %vx%v but was %vx%v", width, height, expectedWidth, expectedHeight, size.X, size.Y)
+	}
+}
+
+func writePng(path string, width, height int, fill color.RGBA, test *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, fill)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		test.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2011-2018 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"fmt"
+	"github.com/oniony/TMSU/common/text"
+	"github.com/oniony/TMSU/entities"
+	"strings"
+)
+
+// Validates the 'vfsInboxTags' setting: a list of TAG[=VALUE] words naming the
+// tags given to the files linked into the inbox directory.
+func ValidateInboxTags(settingText string) error {
+	words := text.Tokenize(settingText)
+	if len(words) == 0 {
+		return fmt.Errorf("invalid inbox tags '%v': at least one tag must be specified", settingText)
+	}
+
+	for _, word := range words {
+		tagName, valueName := parseXAttrTag(word)
+
+		if err := entities.ValidateTagName(tagName); err != nil {
+			return fmt.Errorf("invalid inbox tags '%v': %w", settingText, err)
+		}
+		if valueName != "" {
+			if err := entities.ValidateValueName(valueName); err != nil {
+				return fmt.Errorf("invalid inbox tags '%v': %w", settingText, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+func formatXAttrTag(tagName, valueName string) string {
+	tagName = strings.Replace(escapeXAttrText(tagName), "=", `\=`, -1)
+	if valueName == "" {
+		return tagName
+	}
+
+	return tagName + "=" + escapeXAttrText(valueName)
+}
+
+// splits a TAG[=VALUE] argument at the first unescaped equals sign
+func parseXAttrTag(word string) (string, string) {
+	for index := 0; index < len(word); index++ {
+		switch word[index] {
+		case '\\':
+			index++
+		case '=':
+			return unescapeXAttrText(word[:index]), unescapeXAttrText(word[index+1:])
+		}
+	}
+
+	return unescapeXAttrText(word), ""
+}
+
+var xattrTextEscaper = strings.NewReplacer(`\`, `\\`, " ", `\ `, "\t", "\\\t", `"`, `\"`, `'`, `\'`)
+var xattrTextUnescaper = strings.NewReplacer(`\=`, "=")
+
+func escapeXAttrText(text string) string {
+	return xattrTextEscaper.Replace(text)
+}
+
+func unescapeXAttrText(text string) string {
+	return xattrTextUnescaper.Replace(text)
+}